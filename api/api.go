@@ -206,9 +206,19 @@ func New(requiredUserAgent string, requiredPassword string, cs modules.Consensus
 	if api.renter != nil {
 		router.GET("/renter", api.renterHandlerGET)
 		router.POST("/renter", RequirePassword(api.renterHandlerPOST, requiredPassword))
+		router.GET("/renter/audits", api.renterAuditsHandler)
+		router.GET("/renter/backup", api.renterBackupHandlerGET)
+		router.POST("/renter/backup", RequirePassword(api.renterBackupHandlerPOST, requiredPassword))
 		router.GET("/renter/contracts", api.renterContractsHandler)
 		router.GET("/renter/downloads", api.renterDownloadsHandler)
+		router.POST("/renter/downloads/:id", RequirePassword(api.renterDownloadsHandlerPOST, requiredPassword))
 		router.GET("/renter/files", api.renterFilesHandler)
+		router.GET("/renter/files/search", api.renterFilesSearchHandler)
+		router.GET("/renter/performance", api.renterPerformanceHandler)
+		router.POST("/renter/recover", RequirePassword(api.renterRecoverHandler, requiredPassword))
+		router.GET("/renter/snapshots", api.renterSnapshotsHandler)
+		router.GET("/renter/snapshots/:name", api.renterSnapshotHandlerGET)
+		router.POST("/renter/snapshots/:name", RequirePassword(api.renterSnapshotHandlerPOST, requiredPassword))
 
 		// TODO: re-enable these routes once the new .sia format has been
 		// standardized and implemented.
@@ -218,13 +228,26 @@ func New(requiredUserAgent string, requiredPassword string, cs modules.Consensus
 		// router.GET("/renter/shareascii", RequirePassword(api.renterShareAsciiHandler, requiredPassword))
 
 		router.POST("/renter/delete/*siapath", RequirePassword(api.renterDeleteHandler, requiredPassword))
+		router.GET("/renter/dir/*siapath", api.renterDirHandlerGET)
+		router.POST("/renter/dir/*siapath", RequirePassword(api.renterDirHandlerPOST, requiredPassword))
 		router.GET("/renter/download/*siapath", RequirePassword(api.renterDownloadHandler, requiredPassword))
+		router.POST("/renter/expiration/*siapath", RequirePassword(api.renterExpirationHandler, requiredPassword))
+		router.GET("/renter/health/*siapath", api.renterHealthHandler)
+		router.POST("/renter/metadata/*siapath", RequirePassword(api.renterMetadataHandler, requiredPassword))
 		router.POST("/renter/rename/*siapath", RequirePassword(api.renterRenameHandler, requiredPassword))
+		router.GET("/renter/stream/*siapath", RequirePassword(api.renterStreamHandler, requiredPassword))
+		router.POST("/renter/update/*siapath", RequirePassword(api.renterUpdateHandler, requiredPassword))
 		router.POST("/renter/upload/*siapath", RequirePassword(api.renterUploadHandler, requiredPassword))
+		router.POST("/renter/uploadstream/*siapath", RequirePassword(api.renterUploadStreamHandler, requiredPassword))
+		router.GET("/renter/versions/*siapath", api.renterVersionsHandlerGET)
+		router.POST("/renter/versions/*siapath", RequirePassword(api.renterVersionsHandlerPOST, requiredPassword))
 
 		// HostDB endpoints.
 		router.GET("/hostdb/active", api.renterHostsActiveHandler)
 		router.GET("/hostdb/all", api.renterHostsAllHandler)
+		router.GET("/hostdb/filter", api.renterHostsFilterHandlerGET)
+		router.GET("/hostdb/hosts/:pubkey", api.renterHostsHandlerGET)
+		router.POST("/hostdb/filter", RequirePassword(api.renterHostsFilterHandlerPOST, requiredPassword))
 	}
 
 	// TransactionPool API Calls
@@ -4,9 +4,11 @@ package api
 // zeroing them out.
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -18,6 +20,10 @@ import (
 )
 
 var (
+	// errRangeNotSatisfiable is returned if a requested byte range lies
+	// beyond the end of the file.
+	errRangeNotSatisfiable = errors.New("requested range cannot be satisfied")
+
 	// recommendedHosts is the number of hosts that the renter will form
 	// contracts with if the value is not specified explicity in the call to
 	// SetSettings.
@@ -70,6 +76,14 @@ type (
 		Settings         modules.RenterSettings `json:"settings"`
 		FinancialMetrics RenterFinancialMetrics `json:"financialmetrics"`
 		CurrentPeriod    types.BlockHeight      `json:"currentperiod"`
+
+		// Throughput is the bandwidth that the renter has recently used to
+		// transfer data to and from hosts.
+		Throughput modules.RenterThroughput `json:"throughput"`
+
+		// ChunkCache describes the cache of recovered chunks and how often
+		// downloads were served from it.
+		ChunkCache modules.ChunkCacheStats `json:"chunkcache"`
 	}
 
 	// RenterFinancialMetrics contains metrics about how much the Renter has
@@ -87,9 +101,22 @@ type (
 		Unspent types.Currency `json:"unspent"`
 	}
 
+	// RenterAudits contains the results of the renter's audits of the pieces
+	// stored on each host.
+	RenterAudits struct {
+		Hosts []modules.HostAuditInfo `json:"hosts"`
+	}
+
+	// RenterBackup contains information on the most recent backup of the
+	// renter's metadata that was stored on its hosts.
+	RenterBackup struct {
+		Backup modules.BackupInfo `json:"backup"`
+	}
+
 	// RenterContract represents a contract formed by the renter.
 	RenterContract struct {
 		EndHeight       types.BlockHeight    `json:"endheight"`
+		HostPublicKey   types.SiaPublicKey   `json:"hostpublickey"`
 		ID              types.FileContractID `json:"id"`
 		LastTransaction types.Transaction    `json:"lasttransaction"`
 		NetAddress      modules.NetAddress   `json:"netaddress"`
@@ -102,26 +129,69 @@ type (
 		Contracts []RenterContract `json:"contracts"`
 	}
 
+	// RenterDirectory lists a directory in the renter. The first entry of
+	// Directories describes the directory itself, and the remaining entries
+	// describe its immediate subdirectories. Files contains the files stored
+	// directly in the directory.
+	RenterDirectory struct {
+		Directories []modules.DirectoryInfo `json:"directories"`
+		Files       []modules.FileInfo      `json:"files"`
+	}
+
 	// DownloadQueue contains the renter's download queue.
 	RenterDownloadQueue struct {
 		Downloads []modules.DownloadInfo `json:"downloads"`
 	}
 
+	// RenterFileHealth lists the locations of the pieces of each chunk of a
+	// file.
+	RenterFileHealth struct {
+		Chunks []modules.ChunkHealth `json:"chunks"`
+	}
+
 	// RenterFiles lists the files known to the renter.
 	RenterFiles struct {
 		Files []modules.FileInfo `json:"files"`
 	}
 
+	// RenterFilesSearch contains a page of the files that matched a search,
+	// and the total number of files that matched it.
+	RenterFilesSearch struct {
+		Files []modules.FileInfo `json:"files"`
+		Total int                `json:"total"`
+	}
+
 	// RenterLoad lists files that were loaded into the renter.
 	RenterLoad struct {
 		FilesAdded []string `json:"filesadded"`
 	}
 
+	// RenterPerformance contains the performance of each host that the
+	// renter has downloaded from.
+	RenterPerformance struct {
+		Hosts []modules.HostPerformanceInfo `json:"hosts"`
+	}
+
 	// RenterShareASCII contains an ASCII-encoded .sia file.
 	RenterShareASCII struct {
 		ASCIIsia string `json:"asciisia"`
 	}
 
+	// RenterSnapshot lists the files in a snapshot.
+	RenterSnapshot struct {
+		Files []modules.FileInfo `json:"files"`
+	}
+
+	// RenterSnapshots lists the renter's snapshots.
+	RenterSnapshots struct {
+		Snapshots []modules.SnapshotInfo `json:"snapshots"`
+	}
+
+	// RenterVersions lists the earlier versions of a file.
+	RenterVersions struct {
+		Versions []modules.FileVersionInfo `json:"versions"`
+	}
+
 	// ActiveHosts lists active hosts on the network.
 	ActiveHosts struct {
 		Hosts []modules.HostDBEntry `json:"hosts"`
@@ -131,6 +201,19 @@ type (
 	AllHosts struct {
 		Hosts []modules.HostDBEntry `json:"hosts"`
 	}
+
+	// HostdbFilterGET contains the filter that restricts the hosts that the
+	// renter forms contracts with.
+	HostdbFilterGET struct {
+		Filter modules.HostDBFilter `json:"filter"`
+	}
+
+	// HostdbHostsGET contains the entry of a host in the hostdb, and the
+	// contribution of each factor to the score of the host.
+	HostdbHostsGET struct {
+		Entry          modules.HostDBEntry        `json:"entry"`
+		ScoreBreakdown modules.HostScoreBreakdown `json:"scorebreakdown"`
+	}
 )
 
 // renterHandlerGET handles the API call to /renter.
@@ -163,16 +246,115 @@ func (api *API) renterHandlerGET(w http.ResponseWriter, req *http.Request, _ htt
 		Settings:         settings,
 		FinancialMetrics: fm,
 		CurrentPeriod:    periodStart,
+		Throughput:       api.renter.Throughput(),
+		ChunkCache:       api.renter.ChunkCacheStats(),
 	})
 }
 
-// renterHandlerPOST handles the API call to set the Renter's settings.
+// renterHandlerPOST handles the API call to set the Renter's settings. The
+// allowance is only changed if funds or period are supplied, and the other
+// settings are left unchanged if they are not supplied.
 func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	settings := api.renter.Settings()
+	if req.FormValue("funds") != "" || req.FormValue("period") != "" {
+		allowance, err := scanAllowance(req)
+		if err != nil {
+			WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+			return
+		}
+		// The maximum prices are kept unless they are supplied.
+		allowance.MaxContractPrice = settings.Allowance.MaxContractPrice
+		allowance.MaxDownloadBandwidthPrice = settings.Allowance.MaxDownloadBandwidthPrice
+		allowance.MaxStoragePrice = settings.Allowance.MaxStoragePrice
+		allowance.MaxUploadBandwidthPrice = settings.Allowance.MaxUploadBandwidthPrice
+		settings.Allowance = allowance
+	}
+
+	// Scan the maximum prices of the allowance. (optional parameters)
+	maxPrices := []struct {
+		name  string
+		price *types.Currency
+	}{
+		{"maxcontractprice", &settings.Allowance.MaxContractPrice},
+		{"maxdownloadbandwidthprice", &settings.Allowance.MaxDownloadBandwidthPrice},
+		{"maxstorageprice", &settings.Allowance.MaxStoragePrice},
+		{"maxuploadbandwidthprice", &settings.Allowance.MaxUploadBandwidthPrice},
+	}
+	for _, mp := range maxPrices {
+		if req.FormValue(mp.name) == "" {
+			continue
+		}
+		price, ok := scanAmount(req.FormValue(mp.name))
+		if !ok {
+			WriteError(w, Error{"unable to parse " + mp.name}, http.StatusBadRequest)
+			return
+		}
+		*mp.price = price
+	}
+
+	// Scan the download overdrive, and the bandwidth and version limits.
+	// (optional parameters)
+	limits := []struct {
+		name  string
+		limit *uint64
+	}{
+		{"chunkcachesize", &settings.ChunkCacheSize},
+		{"downloadoverdrive", &settings.DownloadOverdrive},
+		{"maxbandwidth", &settings.MaxBandwidth},
+		{"maxdownloadspeed", &settings.MaxDownloadSpeed},
+		{"maxuploadspeed", &settings.MaxUploadSpeed},
+		{"maxversions", &settings.MaxVersions},
+		{"maxversionage", &settings.MaxVersionAge},
+	}
+	for _, l := range limits {
+		if req.FormValue(l.name) == "" {
+			continue
+		}
+		_, err := fmt.Sscan(req.FormValue(l.name), l.limit)
+		if err != nil {
+			WriteError(w, Error{"unable to parse " + l.name + ": " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Scan the weights of the host score factors. (optional parameters)
+	scoreWeights := []struct {
+		name   string
+		weight *float64
+	}{
+		{"scoreweightage", &settings.HostScoreWeights.Age},
+		{"scoreweightcollateral", &settings.HostScoreWeights.Collateral},
+		{"scoreweightprice", &settings.HostScoreWeights.Price},
+		{"scoreweightstorage", &settings.HostScoreWeights.Storage},
+		{"scoreweightuptime", &settings.HostScoreWeights.Uptime},
+		{"scoreweightversion", &settings.HostScoreWeights.Version},
+	}
+	for _, sw := range scoreWeights {
+		if req.FormValue(sw.name) == "" {
+			continue
+		}
+		_, err := fmt.Sscan(req.FormValue(sw.name), sw.weight)
+		if err != nil {
+			WriteError(w, Error{"unable to parse " + sw.name + ": " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Set the settings in the renter.
+	err := api.renter.SetSettings(settings)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// scanAllowance parses the allowance supplied to a call to /renter [POST].
+func scanAllowance(req *http.Request) (modules.Allowance, error) {
 	// Scan the allowance amount.
 	funds, ok := scanAmount(req.FormValue("funds"))
 	if !ok {
-		WriteError(w, Error{"unable to parse funds"}, http.StatusBadRequest)
-		return
+		return modules.Allowance{}, errors.New("unable to parse funds")
 	}
 
 	// Scan the number of hosts to use. (optional parameter)
@@ -180,12 +362,10 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 	if req.FormValue("hosts") != "" {
 		_, err := fmt.Sscan(req.FormValue("hosts"), &hosts)
 		if err != nil {
-			WriteError(w, Error{"unable to parse hosts: " + err.Error()}, http.StatusBadRequest)
-			return
+			return modules.Allowance{}, errors.New("unable to parse hosts: " + err.Error())
 		}
 		if hosts != 0 && hosts < requiredHosts {
-			WriteError(w, Error{fmt.Sprintf("insufficient number of hosts, need at least %v but have %v", recommendedHosts, hosts)}, http.StatusBadRequest)
-			return
+			return modules.Allowance{}, fmt.Errorf("insufficient number of hosts, need at least %v but have %v", recommendedHosts, hosts)
 		}
 	} else {
 		hosts = recommendedHosts
@@ -195,8 +375,7 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 	var period types.BlockHeight
 	_, err := fmt.Sscan(req.FormValue("period"), &period)
 	if err != nil {
-		WriteError(w, Error{"unable to parse period: " + err.Error()}, http.StatusBadRequest)
-		return
+		return modules.Allowance{}, errors.New("unable to parse period: " + err.Error())
 	}
 
 	// Scan the renew window. (optional parameter)
@@ -204,28 +383,73 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 	if req.FormValue("renewwindow") != "" {
 		_, err = fmt.Sscan(req.FormValue("renewwindow"), &renewWindow)
 		if err != nil {
-			WriteError(w, Error{"unable to parse renewwindow: " + err.Error()}, http.StatusBadRequest)
-			return
+			return modules.Allowance{}, errors.New("unable to parse renewwindow: " + err.Error())
 		}
 		if renewWindow != 0 && renewWindow < requiredRenewWindow {
-			WriteError(w, Error{fmt.Sprintf("renew window is too small, must be at least %v blocks but have %v blocks", requiredRenewWindow, renewWindow)}, http.StatusBadRequest)
-			return
+			return modules.Allowance{}, fmt.Errorf("renew window is too small, must be at least %v blocks but have %v blocks", requiredRenewWindow, renewWindow)
 		}
 	} else {
 		renewWindow = period / 2
 	}
 
-	// Set the settings in the renter.
-	err = api.renter.SetSettings(modules.RenterSettings{
-		Allowance: modules.Allowance{
-			Funds:       funds,
-			Hosts:       hosts,
-			Period:      period,
-			RenewWindow: renewWindow,
-		},
+	return modules.Allowance{
+		Funds:       funds,
+		Hosts:       hosts,
+		Period:      period,
+		RenewWindow: renewWindow,
+	}, nil
+}
+
+// renterAuditsHandler handles the API call to request the results of the
+// renter's audits of its hosts.
+func (api *API) renterAuditsHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterAudits{
+		Hosts: api.renter.HostAudits(),
 	})
-	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+}
+
+// renterPerformanceHandler handles the API call to request the performance of
+// each host that the renter has downloaded from.
+func (api *API) renterPerformanceHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterPerformance{
+		Hosts: api.renter.HostPerformance(),
+	})
+}
+
+// renterBackupHandlerGET handles the API call to request information on the
+// most recent backup of the renter's metadata that was stored on its hosts.
+func (api *API) renterBackupHandlerGET(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterBackup{
+		Backup: api.renter.Backup(),
+	})
+}
+
+// renterBackupHandlerPOST handles the API call to create a backup of the
+// renter's metadata, either on the renter's hosts or in a local file.
+func (api *API) renterBackupHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	destination := req.FormValue("destination")
+	if destination != "" && !filepath.IsAbs(destination) {
+		WriteError(w, Error{"destination must be an absolute path"}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.CreateBackup(destination); err != nil {
+		WriteError(w, Error{"backup failed: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterRecoverHandler handles the API call to recover the renter's contracts
+// and files from a backup, either from the renter's hosts or from a local
+// file.
+func (api *API) renterRecoverHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	source := req.FormValue("source")
+	if source != "" && !filepath.IsAbs(source) {
+		WriteError(w, Error{"source must be an absolute path"}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.RecoverBackup(source); err != nil {
+		WriteError(w, Error{"recovery failed: " + err.Error()}, http.StatusInternalServerError)
 		return
 	}
 	WriteSuccess(w)
@@ -237,6 +461,7 @@ func (api *API) renterContractsHandler(w http.ResponseWriter, _ *http.Request, _
 	for _, c := range api.renter.Contracts() {
 		contracts = append(contracts, RenterContract{
 			EndHeight:       c.EndHeight(),
+			HostPublicKey:   c.HostPublicKey,
 			ID:              c.ID,
 			NetAddress:      c.NetAddress,
 			LastTransaction: c.LastRevisionTxn,
@@ -256,6 +481,32 @@ func (api *API) renterDownloadsHandler(w http.ResponseWriter, _ *http.Request, _
 	})
 }
 
+// renterDownloadsHandlerPOST handles the API calls to pause, resume, and
+// cancel downloads in the download queue.
+func (api *API) renterDownloadsHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+	var err error
+	switch action := req.FormValue("action"); action {
+	case "cancel":
+		err = api.renter.CancelDownload(id)
+	case "pause":
+		err = api.renter.PauseDownload(id)
+	case "resume":
+		err = api.renter.ResumeDownload(id)
+	default:
+		WriteError(w, Error{"unrecognized action: '" + action + "', must be 'cancel', 'pause', or 'resume'"}, http.StatusBadRequest)
+		return
+	}
+	if err == renter.ErrUnknownDownload {
+		WriteError(w, Error{err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // renterLoadHandler handles the API call to load a '.sia' file.
 func (api *API) renterLoadHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	source := req.FormValue("source")
@@ -285,6 +536,64 @@ func (api *API) renterLoadAsciiHandler(w http.ResponseWriter, req *http.Request,
 	WriteJSON(w, RenterLoad{FilesAdded: files})
 }
 
+// renterExpirationHandler handles the API call to set the height at which a
+// file expires. Setting keepforever instead of a height removes the expiration
+// height of the file.
+func (api *API) renterExpirationHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var height types.BlockHeight
+	keepForever := req.FormValue("keepforever")
+	if keepForever != "" {
+		forever, err := strconv.ParseBool(keepForever)
+		if err != nil {
+			WriteError(w, Error{"unable to parse keepforever: " + err.Error()}, http.StatusBadRequest)
+			return
+		} else if !forever {
+			WriteError(w, Error{"keepforever must be true if it is supplied"}, http.StatusBadRequest)
+			return
+		} else if req.FormValue("height") != "" {
+			WriteError(w, Error{"height and keepforever cannot both be supplied"}, http.StatusBadRequest)
+			return
+		}
+	} else {
+		if _, err := fmt.Sscan(req.FormValue("height"), &height); err != nil {
+			WriteError(w, Error{"unable to parse height: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if height == 0 {
+			WriteError(w, Error{"height must be nonzero; use keepforever to keep the file forever"}, http.StatusBadRequest)
+			return
+		}
+	}
+	err := api.renter.SetFileExpiration(strings.TrimPrefix(ps.ByName("siapath"), "/"), height)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	WriteSuccess(w)
+}
+
+// renterMetadataHandler handles the API call to set the metadata of a file.
+// Each parameter sets the metadata key of the same name, and parameters with
+// an empty value remove the key.
+func (api *API) renterMetadataHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if err := req.ParseForm(); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	metadata := make(map[string]string)
+	for k, v := range req.Form {
+		metadata[k] = v[0]
+	}
+	err := api.renter.SetFileMetadata(strings.TrimPrefix(ps.ByName("siapath"), "/"), metadata)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	WriteSuccess(w)
+}
+
 // renterRenameHandler handles the API call to rename a file entry in the
 // renter.
 func (api *API) renterRenameHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
@@ -297,6 +606,123 @@ func (api *API) renterRenameHandler(w http.ResponseWriter, req *http.Request, ps
 	WriteSuccess(w)
 }
 
+// renterDirHandlerGET handles the API call to list a directory.
+func (api *API) renterDirHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	dirs, files, err := api.renter.DirList(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterDirectory{
+		Directories: dirs,
+		Files:       files,
+	})
+}
+
+// renterDirHandlerPOST handles the API calls to create, delete, and rename
+// directories.
+func (api *API) renterDirHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	siapath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+	var err error
+	switch action := req.FormValue("action"); action {
+	case "create":
+		err = api.renter.CreateDir(siapath)
+	case "delete":
+		err = api.renter.DeleteDir(siapath)
+	case "rename":
+		err = api.renter.RenameDir(siapath, req.FormValue("newsiapath"))
+	default:
+		WriteError(w, Error{"unrecognized action: '" + action + "', must be 'create', 'delete', or 'rename'"}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterSnapshotsHandler handles the API call to list the snapshots.
+func (api *API) renterSnapshotsHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterSnapshots{
+		Snapshots: api.renter.Snapshots(),
+	})
+}
+
+// renterSnapshotHandlerGET handles the API call to list the files in a
+// snapshot.
+func (api *API) renterSnapshotHandlerGET(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	files, err := api.renter.SnapshotFiles(ps.ByName("name"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterSnapshot{
+		Files: files,
+	})
+}
+
+// renterSnapshotHandlerPOST handles the API calls to create, restore, and
+// delete snapshots.
+func (api *API) renterSnapshotHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	var err error
+	switch action := req.FormValue("action"); action {
+	case "create":
+		err = api.renter.CreateSnapshot(name, req.FormValue("dir"))
+	case "restore":
+		err = api.renter.RestoreSnapshot(name)
+	case "delete":
+		err = api.renter.DeleteSnapshot(name)
+	default:
+		WriteError(w, Error{"unrecognized action: '" + action + "', must be 'create', 'restore', or 'delete'"}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterVersionsHandlerGET handles the API call to list the earlier versions
+// of a file.
+func (api *API) renterVersionsHandlerGET(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	versions, err := api.renter.FileVersions(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterVersions{
+		Versions: versions,
+	})
+}
+
+// renterVersionsHandlerPOST handles the API calls to restore and delete
+// earlier versions of a file.
+func (api *API) renterVersionsHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	siapath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+	version, err := strconv.ParseUint(req.FormValue("version"), 10, 64)
+	if err != nil {
+		WriteError(w, Error{"unable to parse version: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	switch action := req.FormValue("action"); action {
+	case "restore":
+		err = api.renter.RestoreVersion(siapath, version)
+	case "delete":
+		err = api.renter.DeleteVersion(siapath, version)
+	default:
+		WriteError(w, Error{"unrecognized action: '" + action + "', must be 'restore' or 'delete'"}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // renterFilesHandler handles the API call to list all of the files.
 func (api *API) renterFilesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	WriteJSON(w, RenterFiles{
@@ -304,6 +730,93 @@ func (api *API) renterFilesHandler(w http.ResponseWriter, req *http.Request, _ h
 	})
 }
 
+// renterFilesSearchHandler handles the API call to list the files that match
+// the given tags, SiaPath prefix, size range, and redundancy range, one page at
+// a time.
+func (api *API) renterFilesSearchHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	filter := modules.FileFilter{
+		Tags:   make(map[string]string),
+		Prefix: req.FormValue("prefix"),
+	}
+	// Each tag is given as key:value, or as key to match any value.
+	for _, tag := range req.URL.Query()["tag"] {
+		kv := strings.SplitN(tag, ":", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		filter.Tags[kv[0]] = kv[1]
+	}
+
+	// Scan the size, pagination, and redundancy parameters.
+	for _, p := range []struct {
+		name  string
+		value *uint64
+	}{
+		{"minsize", &filter.MinSize},
+		{"maxsize", &filter.MaxSize},
+	} {
+		if v := req.FormValue(p.name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				WriteError(w, Error{"unable to parse " + p.name + ": " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+			*p.value = n
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{
+		{"offset", &filter.Offset},
+		{"limit", &filter.Limit},
+	} {
+		if v := req.FormValue(p.name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 31)
+			if err != nil {
+				WriteError(w, Error{"unable to parse " + p.name + ": " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+			*p.value = int(n)
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value *float64
+	}{
+		{"minredundancy", &filter.MinRedundancy},
+		{"maxredundancy", &filter.MaxRedundancy},
+	} {
+		if v := req.FormValue(p.name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				WriteError(w, Error{"unable to parse " + p.name + ": " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+			*p.value = f
+		}
+	}
+
+	files, total := api.renter.FilterFiles(filter)
+	WriteJSON(w, RenterFilesSearch{
+		Files: files,
+		Total: total,
+	})
+}
+
+// renterHealthHandler handles the API call to list the locations of the pieces
+// of each chunk of a file.
+func (api *API) renterHealthHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	chunks, err := api.renter.FileHealth(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterFileHealth{
+		Chunks: chunks,
+	})
+}
+
 // renterDeleteHandler handles the API call to delete a file entry from the
 // renter.
 func (api *API) renterDeleteHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
@@ -316,7 +829,9 @@ func (api *API) renterDeleteHandler(w http.ResponseWriter, req *http.Request, ps
 	WriteSuccess(w)
 }
 
-// renterDownloadHandler handles the API call to download a file.
+// renterDownloadHandler handles the API call to download a file. An earlier
+// version of the file, or the file as it was recorded by a snapshot, can be
+// downloaded instead of the current file.
 func (api *API) renterDownloadHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	destination := req.FormValue("destination")
 	// Check that the destination path is absolute.
@@ -325,7 +840,24 @@ func (api *API) renterDownloadHandler(w http.ResponseWriter, req *http.Request,
 		return
 	}
 
-	err := api.renter.Download(strings.TrimPrefix(ps.ByName("siapath"), "/"), destination)
+	siapath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+	var err error
+	switch version, snapshot := req.FormValue("version"), req.FormValue("snapshot"); {
+	case version != "" && snapshot != "":
+		WriteError(w, Error{"version and snapshot cannot both be specified"}, http.StatusBadRequest)
+		return
+	case version != "":
+		n, parseErr := strconv.ParseUint(version, 10, 64)
+		if parseErr != nil {
+			WriteError(w, Error{"unable to parse version: " + parseErr.Error()}, http.StatusBadRequest)
+			return
+		}
+		err = api.renter.DownloadVersion(siapath, n, destination)
+	case snapshot != "":
+		err = api.renter.DownloadSnapshotFile(snapshot, siapath, destination)
+	default:
+		err = api.renter.Download(siapath, destination)
+	}
 	if err != nil {
 		WriteError(w, Error{"download failed: " + err.Error()}, http.StatusInternalServerError)
 		return
@@ -334,6 +866,132 @@ func (api *API) renterDownloadHandler(w http.ResponseWriter, req *http.Request,
 	WriteSuccess(w)
 }
 
+// parseRange parses the value of an HTTP Range header for a file of the
+// provided size, returning the offset and length of the requested section.
+// Only a single byte range is supported; headers that are empty, malformed, or
+// request multiple ranges select the entire file, and partial is false.
+// errRangeNotSatisfiable is returned if the range lies beyond the end of the
+// file.
+func parseRange(header string, size uint64) (offset, length uint64, partial bool, err error) {
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, size, false, nil
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return 0, size, false, nil
+	}
+	startStr, endStr := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	// A suffix range, such as "bytes=-500", selects the final bytes of the
+	// file.
+	if startStr == "" {
+		suffix, err := strconv.ParseUint(endStr, 10, 64)
+		if err != nil {
+			return 0, size, false, nil
+		}
+		if suffix == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true, nil
+	}
+
+	start, err := strconv.ParseUint(startStr, 10, 64)
+	if err != nil {
+		return 0, size, false, nil
+	}
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseUint(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, size, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+	return start, end - start + 1, true, nil
+}
+
+// A streamResponseWriter sends the status code of a response along with the
+// first write to the response body, so that an error that occurs before any
+// data of a stream is available can still be reported to the client.
+type streamResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+// Write writes data to the response body, sending the status code first.
+func (w *streamResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// renterStreamHandler handles the API call to stream a file, or a byte range
+// of a file, directly in the response body.
+func (api *API) renterStreamHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	siapath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+	file, err := api.renter.File(siapath)
+	if err == renter.ErrUnknownPath {
+		WriteError(w, Error{err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if !file.Available {
+		WriteError(w, Error{"file is not available for download"}, http.StatusServiceUnavailable)
+		return
+	}
+
+	offset, length, partial, err := parseRange(req.Header.Get("Range"), file.Filesize)
+	if err == errRangeNotSatisfiable {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", file.Filesize))
+		WriteError(w, Error{err.Error()}, http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	contentType := file.Metadata[modules.MetadataContentType]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	sw := &streamResponseWriter{ResponseWriter: w, status: http.StatusOK}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatUint(length, 10))
+	if partial {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, file.Filesize))
+		sw.status = http.StatusPartialContent
+	}
+
+	err = api.renter.DownloadSection(siapath, sw, offset, length)
+	if err != nil && !sw.wroteHeader {
+		w.Header().Del("Accept-Ranges")
+		w.Header().Del("Content-Length")
+		w.Header().Del("Content-Range")
+		WriteError(w, Error{"download failed: " + err.Error()}, http.StatusInternalServerError)
+		return
+	} else if err != nil {
+		// Part of the body has already been sent, so the error cannot be
+		// reported to the client. Abort the response, so that the client
+		// does not mistake the truncated body for a complete one.
+		panic(http.ErrAbortHandler)
+	}
+	if !sw.wroteHeader {
+		w.WriteHeader(sw.status)
+	}
+}
+
 // renterShareHandler handles the API call to create a '.sia' file that
 // shares a set of file.
 func (api *API) renterShareHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
@@ -366,6 +1024,82 @@ func (api *API) renterShareAsciiHandler(w http.ResponseWriter, req *http.Request
 	})
 }
 
+// erasureCodeTypes maps the names accepted by the 'erasurecode' upload
+// parameter to the types of erasure code that files can be uploaded with.
+var erasureCodeTypes = map[string]types.Specifier{
+	"reedsolomon": modules.ErasureCodeReedSolomon,
+	"replication": modules.ErasureCodeReplication,
+	"lrc":         modules.ErasureCodeLRC,
+}
+
+// parseErasureCodingParameters parses the optional 'erasurecode' upload
+// parameter, which selects the type of erasure code, and the parameters of
+// that type: 'datapieces' and 'paritypieces' for Reed-Solomon codes, 'copies'
+// for replication codes, and 'datapieces', 'paritypieces', and 'localgroups'
+// for locally repairable codes. get returns the value of a parameter. A nil
+// ErasureCoder is returned if no parameter has been supplied, in which case
+// the renter picks its defaults.
+func parseErasureCodingParameters(get func(string) string) (modules.ErasureCoder, error) {
+	codeName := get("erasurecode")
+	if codeName == "" && get("datapieces") == "" && get("paritypieces") == "" {
+		return nil, nil
+	} else if codeName == "" {
+		codeName = "reedsolomon"
+	}
+	codeType, exists := erasureCodeTypes[codeName]
+	if !exists {
+		return nil, errors.New("unknown erasure code '" + codeName + "'")
+	}
+
+	// Check that the parameters of the erasure code have been supplied.
+	var names []string
+	switch codeType {
+	case modules.ErasureCodeReedSolomon:
+		names = []string{"datapieces", "paritypieces"}
+	case modules.ErasureCodeReplication:
+		names = []string{"copies"}
+	case modules.ErasureCodeLRC:
+		names = []string{"datapieces", "paritypieces", "localgroups"}
+	}
+	for _, name := range names {
+		if get(name) == "" {
+			return nil, fmt.Errorf("must provide the parameters %v if specifying erasure coding parameters of a %v code", strings.Join(names, ", "), codeName)
+		}
+	}
+
+	// Parse the erasure coding parameters.
+	params := make([]uint64, len(names))
+	for i, name := range names {
+		_, err := fmt.Sscan(get(name), &params[i])
+		if err != nil {
+			return nil, fmt.Errorf("unable to read parameter '%v': %v", name, err)
+		}
+	}
+
+	// Verify that sane values for parityPieces and redundancy are being
+	// supplied. The local parity pieces of a locally repairable code do not
+	// add to its redundancy, and a replication code has no parity pieces.
+	if codeType != modules.ErasureCodeReplication && int(params[1]) < requiredParityPieces {
+		return nil, fmt.Errorf("a minimum of %v parity pieces is required, but %v parity pieces requested", requiredParityPieces, params[1])
+	}
+	var redundancy float64
+	if codeType == modules.ErasureCodeReplication {
+		redundancy = float64(params[0])
+	} else if params[0] != 0 {
+		redundancy = float64(params[0]+params[1]) / float64(params[0])
+	}
+	if redundancy < requiredRedundancy {
+		return nil, fmt.Errorf("a redundancy of %.2f is required, but redundancy of %.2f supplied", requiredRedundancy, redundancy)
+	}
+
+	// Create the erasure coder.
+	ec, err := renter.NewErasureCoder(codeType, params)
+	if err != nil {
+		return nil, errors.New("unable to encode file using the provided parameters: " + err.Error())
+	}
+	return ec, nil
+}
+
 // renterUploadHandler handles the API call to upload a file.
 func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	source := req.FormValue("source")
@@ -375,53 +1109,96 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 	}
 
 	// Check whether the erasure coding parameters have been supplied.
-	var ec modules.ErasureCoder
-	if req.FormValue("datapieces") != "" || req.FormValue("paritypieces") != "" {
-		// Check that both values have been supplied.
-		if req.FormValue("datapieces") == "" || req.FormValue("paritypieces") == "" {
-			WriteError(w, Error{"must provide both the datapieces paramaeter and the paritypieces parameter if specifying erasure coding parameters"}, http.StatusBadRequest)
-			return
-		}
+	ec, err := parseErasureCodingParameters(req.FormValue)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
 
-		// Parse the erasure coding parameters.
-		var dataPieces, parityPieces int
-		_, err := fmt.Sscan(req.FormValue("datapieces"), &dataPieces)
+	// Check whether the file should be packed with other small files.
+	var pack bool
+	if p := req.FormValue("pack"); p != "" {
+		pack, err = strconv.ParseBool(p)
 		if err != nil {
-			WriteError(w, Error{"unable to read parameter 'datapieces': " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{"unable to parse pack: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
-		_, err = fmt.Sscan(req.FormValue("paritypieces"), &parityPieces)
+	}
+
+	// Check whether identical chunks should be shared with other files.
+	var dedup bool
+	if d := req.FormValue("dedup"); d != "" {
+		dedup, err = strconv.ParseBool(d)
 		if err != nil {
-			WriteError(w, Error{"unable to read parameter 'paritypieces': " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{"unable to parse dedup: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
+	}
 
-		// Verify that sane values for parityPieces and redundancy are being
-		// supplied.
-		if parityPieces < requiredParityPieces {
-			WriteError(w, Error{fmt.Sprintf("a minimum of %v parity pieces is required, but %v parity pieces requested", parityPieces, requiredParityPieces)}, http.StatusBadRequest)
+	// Check whether an existing file should be kept as an earlier version.
+	var versioned bool
+	if v := req.FormValue("versioned"); v != "" {
+		versioned, err = strconv.ParseBool(v)
+		if err != nil {
+			WriteError(w, Error{"unable to parse versioned: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
-		redundancy := float64(dataPieces+parityPieces) / float64(dataPieces)
-		if float64(dataPieces+parityPieces)/float64(dataPieces) < requiredRedundancy {
-			WriteError(w, Error{fmt.Sprintf("a redundancy of %.2f is required, but redundancy of %.2f supplied", redundancy, requiredRedundancy)}, http.StatusBadRequest)
+	}
+
+	// Check whether the file should expire at a given height.
+	var expirationHeight types.BlockHeight
+	if h := req.FormValue("expirationheight"); h != "" {
+		if _, err := fmt.Sscan(h, &expirationHeight); err != nil {
+			WriteError(w, Error{"unable to parse expirationheight: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
+	}
 
-		// Create the erasure coder.
-		ec, err = renter.NewRSCode(dataPieces, parityPieces)
+	// Call the renter to upload the file.
+	err = api.renter.Upload(modules.FileUploadParams{
+		Source:           source,
+		SiaPath:          strings.TrimPrefix(ps.ByName("siapath"), "/"),
+		ErasureCode:      ec,
+		Pack:             pack,
+		Dedup:            dedup,
+		Compression:      req.FormValue("compression"),
+		Versioned:        versioned,
+		ExpirationHeight: expirationHeight,
+	})
+	if err != nil {
+		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterUploadStreamHandler handles the API call to upload a file from the
+// body of the request. The erasure coding parameters are read from the query
+// string, as the body is reserved for the contents of the file.
+func (api *API) renterUploadStreamHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	query := req.URL.Query()
+	ec, err := parseErasureCodingParameters(query.Get)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// Check whether an existing file should be kept as an earlier version.
+	var versioned bool
+	if v := query.Get("versioned"); v != "" {
+		versioned, err = strconv.ParseBool(v)
 		if err != nil {
-			WriteError(w, Error{"unable to encode file using the provided parameters: " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{"unable to parse versioned: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 	}
 
 	// Call the renter to upload the file.
-	err := api.renter.Upload(modules.FileUploadParams{
-		Source:      source,
+	err = api.renter.UploadStreamFromReader(modules.FileUploadParams{
 		SiaPath:     strings.TrimPrefix(ps.ByName("siapath"), "/"),
 		ErasureCode: ec,
-	})
+		Versioned:   versioned,
+	}, req.Body)
 	if err != nil {
 		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
 		return
@@ -429,6 +1206,42 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 	WriteSuccess(w)
 }
 
+// isUpdateClientError returns whether err is returned by an update because
+// the file cannot be updated as requested, rather than because the update
+// failed.
+func isUpdateClientError(err error) bool {
+	switch err {
+	case renter.ErrUpdateArchived, renter.ErrUpdateCompressed, renter.ErrUpdateDeduplicated,
+		renter.ErrUpdateInProgress, renter.ErrUpdateOffset, renter.ErrUpdatePacked:
+		return true
+	}
+	return false
+}
+
+// renterUpdateHandler handles the API call to write the body of the request
+// into an uploaded file. The body is streamed into the file one chunk at a
+// time.
+func (api *API) renterUpdateHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	offset, err := strconv.ParseUint(req.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		WriteError(w, Error{"unable to parse offset: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	err = api.renter.UpdateFile(strings.TrimPrefix(ps.ByName("siapath"), "/"), offset, req.Body)
+	if err == renter.ErrUnknownPath {
+		WriteError(w, Error{err.Error()}, http.StatusNotFound)
+		return
+	} else if isUpdateClientError(err) {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		WriteError(w, Error{"update failed: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // renterHostsActiveHandler handles the API call asking for the list of active
 // hosts.
 func (api *API) renterHostsActiveHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
@@ -463,3 +1276,54 @@ func (api *API) renterHostsAllHandler(w http.ResponseWriter, req *http.Request,
 		Hosts: api.renter.AllHosts(),
 	})
 }
+
+// renterHostsHandlerGET handles the API call asking for a host in the hostdb,
+// selected by public key.
+func (api *API) renterHostsHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var spk types.SiaPublicKey
+	if err := spk.LoadString(ps.ByName("pubkey")); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	entry, exists := api.renter.Host(spk)
+	if !exists {
+		WriteError(w, Error{"no host with that public key in the hostdb"}, http.StatusNotFound)
+		return
+	}
+	WriteJSON(w, HostdbHostsGET{
+		Entry:          entry,
+		ScoreBreakdown: api.renter.ScoreBreakdown(entry),
+	})
+}
+
+// renterHostsFilterHandlerGET handles the API call asking for the host filter.
+func (api *API) renterHostsFilterHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	WriteJSON(w, HostdbFilterGET{
+		Filter: api.renter.HostDBFilter(),
+	})
+}
+
+// renterHostsFilterHandlerPOST handles the API call to set the host filter.
+// The hosts are given as a comma-separated list.
+func (api *API) renterHostsFilterHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	mode := req.FormValue("mode")
+	if mode == "" {
+		WriteError(w, Error{"mode must be specified"}, http.StatusBadRequest)
+		return
+	}
+	var hosts []string
+	for _, host := range strings.Split(req.FormValue("hosts"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	err := api.renter.SetHostDBFilter(modules.HostDBFilter{
+		Mode:  mode,
+		Hosts: hosts,
+	})
+	if err != nil {
+		WriteError(w, Error{"unable to set the host filter: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
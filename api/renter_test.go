@@ -2,6 +2,7 @@ package api
 
 import (
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"path/filepath"
 	"strconv"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter"
 	"github.com/NebulousLabs/Sia/modules/renter/contractor"
 	"github.com/NebulousLabs/Sia/types"
@@ -259,6 +261,155 @@ func TestRenterHostsAllHandler(t *testing.T) {
 	}
 }
 
+// TestRenterHostsFilterHandler checks that the host filter can be set and
+// retrieved, and that filtered hosts are not listed as active.
+func TestRenterHostsFilterHandler(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHostsFilterHandler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	var ah ActiveHosts
+	if err = st.getAPI("/hostdb/active", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 1 {
+		t.Fatalf("expected 1 active host, got %v", len(ah.Hosts))
+	}
+	addr := string(ah.Hosts[0].NetAddress)
+
+	// Invalid filters should be rejected.
+	for _, vals := range []url.Values{
+		{},
+		{"mode": {"greylist"}},
+		{"mode": {"blacklist"}, "hosts": {"foo"}},
+	} {
+		if err = st.stdPostAPI("/hostdb/filter", vals); err == nil {
+			t.Fatalf("expected an error when setting the filter with %v", vals)
+		}
+	}
+
+	// Blacklist the host.
+	err = st.stdPostAPI("/hostdb/filter", url.Values{"mode": {"blacklist"}, "hosts": {addr + ", 10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hf HostdbFilterGET
+	if err = st.getAPI("/hostdb/filter", &hf); err != nil {
+		t.Fatal(err)
+	}
+	if hf.Filter.Mode != modules.HostDBFilterBlacklist || len(hf.Filter.Hosts) != 2 || hf.Filter.Hosts[0] != addr {
+		t.Fatal("wrong filter:", hf.Filter)
+	}
+	if err = st.getAPI("/hostdb/active", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 0 {
+		t.Fatalf("expected 0 active hosts, got %v", len(ah.Hosts))
+	}
+
+	// Disable the filter.
+	if err = st.stdPostAPI("/hostdb/filter", url.Values{"mode": {"disabled"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/hostdb/active", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 1 {
+		t.Fatalf("expected 1 active host, got %v", len(ah.Hosts))
+	}
+}
+
+// TestRenterHostsHandler checks that a host and the breakdown of its score can
+// be retrieved by public key, and that the score weights can be set.
+func TestRenterHostsHandler(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHostsHandler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	var ah ActiveHosts
+	if err = st.getAPI("/hostdb/active", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 1 {
+		t.Fatalf("expected 1 active host, got %v", len(ah.Hosts))
+	}
+
+	// Get the host and the breakdown of its score.
+	var hh HostdbHostsGET
+	if err = st.getAPI("/hostdb/hosts/"+ah.Hosts[0].PublicKey.String(), &hh); err != nil {
+		t.Fatal(err)
+	}
+	if hh.Entry.NetAddress != ah.Hosts[0].NetAddress {
+		t.Fatal("wrong host returned:", hh.Entry.NetAddress)
+	}
+	sb := hh.ScoreBreakdown
+	if sb.Score.IsZero() || sb.PriceScore.IsZero() || sb.UptimeAdjustment != 1 {
+		t.Fatal("bad score breakdown:", sb)
+	}
+
+	// Invalid and unknown public keys should be rejected.
+	if err = st.getAPI("/hostdb/hosts/foo", &hh); err == nil {
+		t.Fatal("expected an error for an invalid public key")
+	}
+	resp, err := HttpGET("http://" + st.server.listener.Addr().String() + "/hostdb/hosts/ed25519:0102")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal("expected 404 for an unknown public key, got", resp.StatusCode)
+	}
+
+	// Ignore the price of hosts.
+	if err = st.stdPostAPI("/renter", url.Values{"scoreweightprice": {"0"}}); err != nil {
+		t.Fatal(err)
+	}
+	var rg RenterGET
+	if err = st.getAPI("/renter", &rg); err != nil {
+		t.Fatal(err)
+	}
+	expected := modules.DefaultHostScoreWeights
+	expected.Price = 0
+	if rg.Settings.HostScoreWeights != expected {
+		t.Fatal("score weights were not set:", rg.Settings.HostScoreWeights)
+	}
+	if err = st.getAPI("/hostdb/hosts/"+ah.Hosts[0].PublicKey.String(), &hh); err != nil {
+		t.Fatal(err)
+	}
+	if hh.ScoreBreakdown.PriceScore.Cmp(sb.PriceScore) <= 0 {
+		t.Fatal("price score did not increase after ignoring price")
+	}
+	if err = st.stdPostAPI("/renter", url.Values{"scoreweightuptime": {"-1"}}); err == nil {
+		t.Fatal("expected an error for a negative score weight")
+	}
+}
+
 // TestRenterHandlerContracts checks that contract formation between a host and
 // renter behaves as expected, and that contract spending is the right amount.
 func TestRenterHandlerContracts(t *testing.T) {
@@ -322,6 +473,99 @@ func TestRenterHandlerContracts(t *testing.T) {
 	}
 }
 
+// TestRenterHandlerMaxPrices checks that the renter does not form contracts
+// with hosts whose prices exceed the maximum prices of the allowance, and that
+// contracts with hosts are dropped once their prices exceed them.
+func TestRenterHandlerMaxPrices(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHandlerMaxPrices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	var ah ActiveHosts
+	if err = st.getAPI("/hostdb/active", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 1 {
+		t.Fatal("expected 1 active host, got", len(ah.Hosts))
+	}
+	storagePrice := ah.Hosts[0].StoragePrice
+
+	// Invalid maximum prices should be rejected.
+	if err = st.stdPostAPI("/renter", url.Values{"maxstorageprice": {"foo"}}); err == nil {
+		t.Fatal("expected an invalid maximum price to be rejected")
+	}
+
+	// No contract should be formed if the host is too expensive.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	allowanceValues.Set("maxstorageprice", storagePrice.Sub(types.NewCurrency64(1)).String())
+	if err = st.stdPostAPI("/renter", allowanceValues); err == nil {
+		t.Fatal("expected contract formation with an expensive host to fail")
+	}
+	var contracts RenterContracts
+	if err = st.getAPI("/renter/contracts", &contracts); err != nil {
+		t.Fatal(err)
+	}
+	if len(contracts.Contracts) != 0 {
+		t.Fatalf("expected renter to have 0 contracts; got %v", len(contracts.Contracts))
+	}
+
+	// A contract should be formed if the host charges the maximum price.
+	allowanceValues.Set("maxstorageprice", storagePrice.String())
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter/contracts", &contracts); err != nil {
+		t.Fatal(err)
+	}
+	if len(contracts.Contracts) != 1 {
+		t.Fatalf("expected renter to have 1 contract; got %v", len(contracts.Contracts))
+	}
+
+	// The maximum price should be kept when the allowance is changed without
+	// it.
+	allowanceValues.Del("maxstorageprice")
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	var get RenterGET
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if !get.Settings.Allowance.MaxStoragePrice.Equals(storagePrice) {
+		t.Fatalf("expected max storage price to be %v; got %v", storagePrice, get.Settings.Allowance.MaxStoragePrice)
+	}
+
+	// Lowering the maximum price below the price of the host should flag the
+	// contract for replacement.
+	if err = st.stdPostAPI("/renter", url.Values{"maxstorageprice": {storagePrice.Sub(types.NewCurrency64(1)).String()}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter/contracts", &contracts); err != nil {
+		t.Fatal(err)
+	}
+	if len(contracts.Contracts) != 0 {
+		t.Fatalf("expected renter to have 0 online contracts; got %v", len(contracts.Contracts))
+	}
+}
+
 // TestRenterHandlerGetAndPost checks that valid /renter calls successfully set
 // allowance values, while /renter calls with invalid allowance values are
 // correctly handled.
@@ -620,11 +864,27 @@ func TestRenterHandlerDelete(t *testing.T) {
 	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
 		t.Fatal(err)
 	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || !rf.Files[0].Available); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || !rf.Files[0].Available {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
 
-	// Delete the file.
+	// Delete the file. Its sectors should be deleted from the host.
 	if err = st.stdPostAPI("/renter/delete/test", url.Values{}); err != nil {
 		t.Fatal(err)
 	}
+	contracts := st.renter.Contracts()
+	for i := 0; i < 100 && len(contracts[0].MerkleRoots) != 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		contracts = st.renter.Contracts()
+	}
+	if len(contracts[0].MerkleRoots) != 0 {
+		t.Fatal("sectors were not deleted from the host:", len(contracts[0].MerkleRoots))
+	}
 
 	// The renter's list of files should now be empty.
 	var files RenterFiles
@@ -767,3 +1027,156 @@ func TestRenterRelativePathErrorDownload(t *testing.T) {
 		t.Fatal("expecting an error")
 	}
 }
+
+// TestParseRange probes the parseRange function.
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header         string
+		size           uint64
+		offset, length uint64
+		partial        bool
+		notSatisfiable bool
+	}{
+		{"", 100, 0, 100, false, false},
+		{"bytes=0-9", 100, 0, 10, true, false},
+		{"bytes=90-", 100, 90, 10, true, false},
+		{"bytes=90-200", 100, 90, 10, true, false},
+		{"bytes=-10", 100, 90, 10, true, false},
+		{"bytes=-200", 100, 0, 100, true, false},
+		{"bytes=50-50", 100, 50, 1, true, false},
+		{"bytes=100-", 100, 0, 0, false, true},
+		{"bytes=-0", 100, 0, 0, false, true},
+		{"bytes=0-", 0, 0, 0, false, true},
+
+		// Malformed and multi-range headers select the whole file.
+		{"bytes=0-9,20-29", 100, 0, 100, false, false},
+		{"bytes=9-0", 100, 0, 100, false, false},
+		{"bytes=a-b", 100, 0, 100, false, false},
+		{"items=0-9", 100, 0, 100, false, false},
+	}
+	for _, test := range tests {
+		offset, length, partial, err := parseRange(test.header, test.size)
+		if test.notSatisfiable {
+			if err != errRangeNotSatisfiable {
+				t.Errorf("%q: expected errRangeNotSatisfiable, got %v", test.header, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.header, err)
+			continue
+		}
+		if offset != test.offset || length != test.length || partial != test.partial {
+			t.Errorf("%q: expected (%v, %v, %v), got (%v, %v, %v)", test.header, test.offset, test.length, test.partial, offset, length, partial)
+		}
+	}
+}
+
+// TestRenterHandlerDir checks that directories can be listed, created,
+// renamed, and deleted through the API.
+func TestRenterHandlerDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHandlerDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file into a directory.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 512); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/foo/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create an empty directory.
+	createValues := url.Values{}
+	createValues.Set("action", "create")
+	if err = st.stdPostAPI("/renter/dir/bar", createValues); err != nil {
+		t.Fatal(err)
+	}
+	err = st.stdPostAPI("/renter/dir/foo", createValues)
+	if err == nil || err.Error() != renter.ErrDirExists.Error() {
+		t.Errorf("expected error to be %v; got %v", renter.ErrDirExists, err)
+	}
+
+	// List the root directory.
+	var rd RenterDirectory
+	if err = st.getAPI("/renter/dir/", &rd); err != nil {
+		t.Fatal(err)
+	}
+	if len(rd.Directories) != 3 || rd.Directories[1].SiaPath != "bar" || rd.Directories[2].SiaPath != "foo" {
+		t.Fatal("unexpected directories:", rd.Directories)
+	}
+	if rd.Directories[2].NumFiles != 1 || rd.Directories[2].AggregateSize != 512 {
+		t.Error("unexpected directory info:", rd.Directories[2])
+	}
+	if len(rd.Files) != 0 {
+		t.Error("unexpected files:", rd.Files)
+	}
+
+	// Rename the directory, and list it under its new name.
+	renameValues := url.Values{}
+	renameValues.Set("action", "rename")
+	renameValues.Set("newsiapath", "bar/foo")
+	if err = st.stdPostAPI("/renter/dir/foo", renameValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter/dir/bar/foo", &rd); err != nil {
+		t.Fatal(err)
+	}
+	if len(rd.Files) != 1 || rd.Files[0].SiaPath != "bar/foo/test" {
+		t.Fatal("unexpected files:", rd.Files)
+	}
+
+	// Delete the parent directory.
+	deleteValues := url.Values{}
+	deleteValues.Set("action", "delete")
+	if err = st.stdPostAPI("/renter/dir/bar", deleteValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	if err = st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Files) != 0 {
+		t.Error("files were not deleted:", rf.Files)
+	}
+	err = st.getAPI("/renter/dir/bar", &rd)
+	if err == nil || err.Error() != renter.ErrUnknownDir.Error() {
+		t.Errorf("expected error to be %v; got %v", renter.ErrUnknownDir, err)
+	}
+
+	// An unknown action should be rejected.
+	badValues := url.Values{}
+	badValues.Set("action", "explode")
+	if err = st.stdPostAPI("/renter/dir/baz", badValues); err == nil {
+		t.Error("expected an unknown action to be rejected")
+	}
+}
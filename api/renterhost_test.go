@@ -5,15 +5,22 @@ package api
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // TestHostAndRentVanilla sets up an integration test where a host and renter
@@ -568,6 +575,12 @@ func TestRenterUploadDownload(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	// Download with overdrive enabled. Only one host has a piece of the
+	// file, so no extra pieces can be requested.
+	err = st.stdPostAPI("/renter", url.Values{"downloadoverdrive": {"2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
 	downpath := filepath.Join(st.dir, "testdown.dat")
 	err = st.stdGetAPI("/renter/download/test?destination=" + downpath)
 	if err != nil {
@@ -585,6 +598,44 @@ func TestRenterUploadDownload(t *testing.T) {
 	if bytes.Compare(orig, download) != 0 {
 		t.Fatal("data mismatch when downloading a file")
 	}
+	// The performance of the host should have been recorded.
+	var rp RenterPerformance
+	err = st.getAPI("/renter/performance", &rp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rp.Hosts) != 1 || rp.Hosts[0].Downloads == 0 || rp.Hosts[0].Throughput == 0 {
+		t.Fatal("host performance was not recorded:", rp.Hosts)
+	}
+
+	// Enable the chunk cache and download the file twice. The second download
+	// should be served from the cache.
+	err = st.stdPostAPI("/renter", url.Values{"chunkcachesize": {"1073741824"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		os.Remove(downpath)
+		err = st.stdGetAPI("/renter/download/test?destination=" + downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		download, err = ioutil.ReadFile(downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Compare(orig, download) != 0 {
+			t.Fatal("data mismatch when downloading a file through the chunk cache")
+		}
+	}
+	var cacheGET RenterGET
+	err = st.getAPI("/renter", &cacheGET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cacheGET.Settings.ChunkCacheSize != 1073741824 || cacheGET.ChunkCache.Chunks == 0 || cacheGET.ChunkCache.Hits == 0 || cacheGET.ChunkCache.Misses == 0 {
+		t.Fatalf("chunk cache was not used: %+v", cacheGET.ChunkCache)
+	}
 
 	// Wait for upload to complete.
 	for i := 0; i < 200 && (len(rf.Files) != 2 || rf.Files[0].UploadProgress < 10 || rf.Files[1].UploadProgress < 10); i++ {
@@ -799,3 +850,2109 @@ func TestRenterParallelDelete(t *testing.T) {
 		t.Fatal("file was not deleted properly:", rf.Files)
 	}
 }
+
+// TestRenterStream checks that files can be streamed from the renter, both
+// whole and in byte ranges.
+func TestRenterStream(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterStream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file that spans several chunks.
+	path := filepath.Join(st.dir, "test.dat")
+	fileSize := int(modules.SectorSize*3 + 100)
+	err = createRandFile(path, fileSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	err = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || !rf.Files[0].Available); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || !rf.Files[0].Available {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stream fetches /renter/stream/test with the provided Range header.
+	stream := func(rangeHeader string) (*http.Response, []byte) {
+		req, err := http.NewRequest("GET", "http://"+st.server.listener.Addr().String()+"/renter/stream/test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("User-Agent", "Sia-Agent")
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, body
+	}
+
+	// Stream the whole file.
+	resp, body := stream("")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("expected status 200, got", resp.StatusCode)
+	}
+	if !bytes.Equal(body, orig) {
+		t.Fatal("streamed file does not match the original")
+	}
+
+	// Stream a range that crosses a chunk boundary.
+	start := int(modules.SectorSize) - 10
+	end := int(modules.SectorSize)*2 + 10
+	resp, body = stream(fmt.Sprintf("bytes=%d-%d", start, end))
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatal("expected status 206, got", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Range") != fmt.Sprintf("bytes %d-%d/%d", start, end, fileSize) {
+		t.Fatal("wrong Content-Range:", resp.Header.Get("Content-Range"))
+	}
+	if !bytes.Equal(body, orig[start:end+1]) {
+		t.Fatal("streamed range does not match the original")
+	}
+
+	// Stream the final bytes of the file.
+	resp, body = stream("bytes=-50")
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatal("expected status 206, got", resp.StatusCode)
+	}
+	if !bytes.Equal(body, orig[fileSize-50:]) {
+		t.Fatal("streamed suffix does not match the original")
+	}
+
+	// Streams should not be added to the download queue.
+	var queue RenterDownloadQueue
+	if err := st.getAPI("/renter/downloads", &queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Downloads) != 0 {
+		t.Fatal("expected an empty download queue, got", len(queue.Downloads), "downloads")
+	}
+
+	// Request a range past the end of the file.
+	resp, _ = stream(fmt.Sprintf("bytes=%d-", fileSize))
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatal("expected status 416, got", resp.StatusCode)
+	}
+
+	// Stream a file that does not exist.
+	resp, err = HttpGET("http://" + st.server.listener.Addr().String() + "/renter/stream/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal("expected status 404, got", resp.StatusCode)
+	}
+}
+
+// TestRenterRepairWithoutSource checks that the renter can repair a file
+// after its local source has been deleted, by downloading the missing chunk
+// data from the hosts that are still storing it.
+func TestRenterRepairWithoutSource(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterRepairWithoutSource-Host1andRenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	stH1, err := blankServerTester("TestRenterRepairWithoutSource - Host 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH1.server.Close()
+	stH2, err := blankServerTester("TestRenterRepairWithoutSource - Host 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH2.server.Close()
+	testGroup := []*serverTester{st, stH1, stH2}
+
+	// Connect the testers, fund them, and announce every host.
+	err = fullyConnectNodes(testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fundAllNodes(testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = addStorageToAllHosts(testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = announceAllHosts(testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance with only two hosts, so that the file cannot reach
+	// full redundancy.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", "50000000000000000000000000000") // 50k SC
+	allowanceValues.Set("hosts", "2")
+	allowanceValues.Set("period", "10")
+	allowanceValues.Set("renewwindow", "2")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file with 1-of-3 redundancy, and a file with a locally
+	// repairable code of three pieces. Two pieces of each file should get
+	// uploaded.
+	path := filepath.Join(st.dir, "test.dat")
+	err = createRandFile(path, 12345)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads := map[string]url.Values{
+		"test": {"datapieces": {"1"}, "paritypieces": {"2"}},
+		"lrc":  {"erasurecode": {"lrc"}, "datapieces": {"1"}, "paritypieces": {"1"}, "localgroups": {"1"}},
+	}
+	for name, uploadValues := range uploads {
+		uploadValues.Set("source", path)
+		err = st.stdPostAPI("/renter/upload/"+name, uploadValues)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 2 || rf.Files[0].UploadProgress < 66 || rf.Files[1].UploadProgress < 66); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 2 || rf.Files[0].UploadProgress < 66 || rf.Files[1].UploadProgress < 66 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+
+	// Delete the local source, then allow the renter to form a contract with
+	// the third host. The renter should repair the files using the data
+	// stored on the first two hosts.
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues.Set("hosts", "3")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200 && (len(rf.Files) != 2 || rf.Files[0].UploadProgress < 100 || rf.Files[1].UploadProgress < 100); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 2 || rf.Files[0].UploadProgress < 100 || rf.Files[1].UploadProgress < 100 {
+		t.Fatal("the files were not repaired:", rf.Files)
+	}
+
+	// Download the files and check that they have the right contents.
+	for name := range uploads {
+		downpath := filepath.Join(st.dir, name+"down.dat")
+		err = st.stdGetAPI("/renter/download/" + name + "?destination=" + downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		download, err := ioutil.ReadFile(downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(orig, download) {
+			t.Fatal("data mismatch when downloading a repaired file:", name)
+		}
+	}
+}
+
+// TestRenterUploadStream checks that a file can be uploaded from the body of
+// a request, and that the uploaded file can be downloaded again.
+func TestRenterUploadStream(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterUploadStream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file that spans several chunks from the request body.
+	orig, err := crypto.RandBytes(int(modules.SectorSize*2 + 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadStream := func(call string, data []byte) error {
+		resp, err := HttpPOST("http://"+st.server.listener.Addr().String()+call, string(data))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if non2xx(resp.StatusCode) {
+			return decodeError(resp)
+		}
+		return nil
+	}
+	err = uploadStream("/renter/uploadstream/test?datapieces=1&paritypieces=1", orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file should be available as soon as the upload has returned.
+	var rf RenterFiles
+	err = st.getAPI("/renter/files", &rf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Files) != 1 || !rf.Files[0].Available || rf.Files[0].Filesize != uint64(len(orig)) {
+		t.Fatal("file was not uploaded correctly:", rf.Files)
+	}
+
+	// Download the file and compare it to the original.
+	downpath := filepath.Join(st.dir, "testdown.dat")
+	err = st.stdGetAPI("/renter/download/test?destination=" + downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, orig) {
+		t.Fatal("downloaded file does not match the original")
+	}
+
+	// Uploading to a path that is in use should fail.
+	err = uploadStream("/renter/uploadstream/test", orig)
+	if err == nil {
+		t.Fatal("expected an error when uploading to an existing siapath")
+	}
+
+	// Uploading with bad erasure coding parameters should fail.
+	err = uploadStream("/renter/uploadstream/test2?datapieces=1", orig)
+	if err == nil {
+		t.Fatal("expected an error when only supplying datapieces")
+	}
+}
+
+// TestRenterUpdate checks that a range of an uploaded file can be overwritten
+// without uploading the file again, and that a file can be extended.
+func TestRenterUpdate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterUpdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file that spans several chunks.
+	orig, err := crypto.RandBytes(int(modules.SectorSize*2 + 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(call string, data []byte) error {
+		resp, err := HttpPOST("http://"+st.server.listener.Addr().String()+call, string(data))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if non2xx(resp.StatusCode) {
+			return decodeError(resp)
+		}
+		return nil
+	}
+	err = post("/renter/uploadstream/test?datapieces=1&paritypieces=1", orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractSize := func() (size uint64) {
+		var rc RenterContracts
+		if err := st.getAPI("/renter/contracts", &rc); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range rc.Contracts {
+			size += c.Size
+		}
+		return size
+	}
+	sizeBefore := contractSize()
+
+	// Overwrite a range that crosses the boundary between the first two
+	// chunks.
+	update, err := crypto.RandBytes(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := modules.SectorSize - 100
+	err = post(fmt.Sprintf("/renter/update/test?offset=%v", offset), update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(orig[offset:], update)
+	if size := contractSize(); size != sizeBefore {
+		t.Fatalf("updating the file changed the amount of data stored from %v to %v", sizeBefore, size)
+	}
+
+	// Extend the file past its last chunk.
+	extension, err := crypto.RandBytes(int(modules.SectorSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset = uint64(len(orig)) - 10
+	err = post(fmt.Sprintf("/renter/update/test?offset=%v", offset), extension)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig = append(orig[:offset], extension...)
+	if size := contractSize(); size <= sizeBefore {
+		t.Fatal("extending the file did not upload a new chunk")
+	}
+
+	// Download the file and compare it to the updated data.
+	var rf RenterFiles
+	err = st.getAPI("/renter/files", &rf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].Filesize != uint64(len(orig)) {
+		t.Fatal("file has the wrong size after being updated:", rf.Files)
+	}
+	downpath := filepath.Join(st.dir, "testdown.dat")
+	err = st.stdGetAPI("/renter/download/test?destination=" + downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, orig) {
+		t.Fatal("downloaded file does not match the updated data")
+	}
+
+	// The offset may not be past the end of the file, and only known files
+	// can be updated.
+	updateStatus := func(siapath string, offset int) int {
+		resp, err := HttpPOST(fmt.Sprintf("http://%v/renter/update/%v?offset=%v", st.server.listener.Addr(), siapath, offset), string(update))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := updateStatus("test", len(orig)+1); code != http.StatusBadRequest {
+		t.Fatal("expected status 400 when updating past the end of the file, got", code)
+	}
+	if code := updateStatus("missing", 0); code != http.StatusNotFound {
+		t.Fatal("expected status 404 when updating an unknown file, got", code)
+	}
+}
+
+// TestRenterStreamPartialSector checks that streaming a small range of a file
+// only downloads the needed part of each sector, and that the data is still
+// correct.
+func TestRenterStreamPartialSector(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterStreamPartialSector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file that fits in a single chunk.
+	path := filepath.Join(st.dir, "test.dat")
+	fileSize := int(modules.SectorSize / 2)
+	err = createRandFile(path, fileSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	err = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || !rf.Files[0].Available); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || !rf.Files[0].Available {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stream fetches a range of /renter/stream/test, returning the body and
+	// the amount spent on the download.
+	stream := func(start, end int) ([]byte, types.Currency) {
+		var before, after RenterGET
+		err := st.getAPI("/renter", &before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest("GET", "http://"+st.server.listener.Addr().String()+"/renter/stream/test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("User-Agent", "Sia-Agent")
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = st.getAPI("/renter", &after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body, after.FinancialMetrics.DownloadSpending.Sub(before.FinancialMetrics.DownloadSpending)
+	}
+
+	// Stream the whole file, which downloads a full sector.
+	body, fullCost := stream(0, fileSize-1)
+	if !bytes.Equal(body, orig) {
+		t.Fatal("streamed file does not match the original")
+	}
+
+	// Stream a small range, which should download only a few segments of the
+	// sector. The range proofs sent by the host are paid for as well, and
+	// are a large part of the download with the small sectors of the testing
+	// build.
+	body, partialCost := stream(100, 199)
+	if !bytes.Equal(body, orig[100:200]) {
+		t.Fatal("streamed range does not match the original")
+	}
+	if partialCost.IsZero() || partialCost.Mul64(2).Cmp(fullCost) >= 0 {
+		t.Fatalf("partial download cost %v, which is not much cheaper than the full download cost of %v", partialCost, fullCost)
+	}
+}
+
+// TestRenterUploadPacked checks that small files can be packed into a shared
+// chunk, that each of them can be downloaded, and that the shared chunk is
+// deleted from the host once every file in it has been deleted.
+func TestRenterUploadPacked(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterUploadPacked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload three small files, packing them into a single chunk.
+	fileSize := int(modules.SectorSize / 8)
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(st.dir, fmt.Sprintf("test%d.dat", i))
+		err = createRandFile(path, fileSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uploadValues := url.Values{}
+		uploadValues.Set("source", path)
+		uploadValues.Set("datapieces", "1")
+		uploadValues.Set("paritypieces", "1")
+		uploadValues.Set("pack", "true")
+		err = st.stdPostAPI(fmt.Sprintf("/renter/upload/test%d", i), uploadValues)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Invalid values for pack should be rejected.
+	uploadValues := url.Values{}
+	uploadValues.Set("source", filepath.Join(st.dir, "test0.dat"))
+	uploadValues.Set("pack", "sometimes")
+	err = st.stdPostAPI("/renter/upload/test3", uploadValues)
+	if err == nil {
+		t.Fatal("expected an error when supplying an invalid value for pack")
+	}
+
+	// The files are uploaded once the pack is closed.
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 3 || !rf.Files[0].Available || !rf.Files[1].Available || !rf.Files[2].Available); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(rf.Files) != 3 || !rf.Files[0].Available || !rf.Files[1].Available || !rf.Files[2].Available {
+		t.Fatal("packed files did not become available:", rf.Files)
+	}
+
+	// The files should share a single sector on the host.
+	var rc RenterContracts
+	err = st.getAPI("/renter/contracts", &rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) != 1 || rc.Contracts[0].Size != modules.SectorSize {
+		t.Fatal("expected the files to share a single sector:", rc.Contracts)
+	}
+
+	// Download each of the files and compare them to the originals.
+	for i := 0; i < 3; i++ {
+		downpath := filepath.Join(st.dir, fmt.Sprintf("testdown%d.dat", i))
+		err = st.stdGetAPI(fmt.Sprintf("/renter/download/test%d?destination=%s", i, downpath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig, err := ioutil.ReadFile(filepath.Join(st.dir, fmt.Sprintf("test%d.dat", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		downloaded, err := ioutil.ReadFile(downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(orig, downloaded) {
+			t.Fatal("downloaded file", i, "does not match the original")
+		}
+	}
+
+	// The download queue should report the packed file rather than the pack.
+	var queue RenterDownloadQueue
+	err = st.getAPI("/renter/downloads", &queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range queue.Downloads {
+		if d.Filesize != uint64(fileSize) || d.Offset != 0 || d.Length != uint64(fileSize) {
+			t.Fatal("download queue does not report the packed file:", d)
+		}
+	}
+
+	// Deleting some of the files should leave the pack intact.
+	for i := 0; i < 2; i++ {
+		err = st.stdPostAPI(fmt.Sprintf("/renter/delete/test%d", i), url.Values{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	downpath := filepath.Join(st.dir, "testdown.dat")
+	err = st.stdGetAPI("/renter/download/test2?destination=" + downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting the last file should delete the pack from the host.
+	err = st.stdPostAPI("/renter/delete/test2", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && (len(rc.Contracts) != 1 || rc.Contracts[0].Size != 0); i++ {
+		time.Sleep(50 * time.Millisecond)
+		st.getAPI("/renter/contracts", &rc)
+	}
+	if len(rc.Contracts) != 1 || rc.Contracts[0].Size != 0 {
+		t.Fatal("pack was not deleted from the host:", rc.Contracts)
+	}
+}
+
+// TestRenterDownloadActions checks that downloads can be paused, resumed, and
+// cancelled through the API.
+func TestRenterDownloadActions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterDownloadActions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file that spans several chunks.
+	path := filepath.Join(st.dir, "test.dat")
+	err = createRandFile(path, int(modules.SectorSize*8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	err = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || !rf.Files[0].Available); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || !rf.Files[0].Available {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+
+	// Download the file, and pause the download as soon as it appears in the
+	// queue. The download may finish before it can be paused.
+	downpath := filepath.Join(st.dir, "testdown.dat")
+	done := make(chan error)
+	go func() {
+		done <- st.stdGetAPI("/renter/download/test?destination=" + downpath)
+	}()
+	var queue RenterDownloadQueue
+	for i := 0; i < 100 && len(queue.Downloads) == 0; i++ {
+		st.getAPI("/renter/downloads", &queue)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(queue.Downloads) != 1 || queue.Downloads[0].ID == "" {
+		t.Fatal("download did not appear in the queue:", queue.Downloads)
+	}
+	id := queue.Downloads[0].ID
+	err = st.stdPostAPI("/renter/downloads/"+id, url.Values{"action": {"pause"}})
+	if err == nil {
+		err = st.getAPI("/renter/downloads", &queue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if queue.Downloads[0].Status != modules.DownloadStatusPaused && queue.Downloads[0].Status != modules.DownloadStatusComplete {
+			t.Fatal("download was not paused:", queue.Downloads[0])
+		}
+		err = st.stdPostAPI("/renter/downloads/"+id, url.Values{"action": {"resume"}})
+		if err != nil && err.Error() != "download has already finished" {
+			t.Fatal(err)
+		}
+	} else if err.Error() != "download has already finished" {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("resumed download did not finish")
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(orig, downloaded) {
+		t.Fatal("data mismatch when downloading a paused file")
+	}
+
+	// The finished download should be reported as complete, and can no longer
+	// be paused, resumed, or cancelled.
+	err = st.getAPI("/renter/downloads", &queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Downloads[0].Status != modules.DownloadStatusComplete || queue.Downloads[0].Received != queue.Downloads[0].Length {
+		t.Fatal("download is not reported as complete:", queue.Downloads[0])
+	}
+	for _, action := range []string{"pause", "resume", "cancel"} {
+		err = st.stdPostAPI("/renter/downloads/"+id, url.Values{"action": {action}})
+		if err == nil || err.Error() != "download has already finished" {
+			t.Fatal("expected an error when trying to", action, "a finished download, got", err)
+		}
+	}
+
+	// Unknown downloads and actions should be rejected.
+	err = st.stdPostAPI("/renter/downloads/foo", url.Values{"action": {"pause"}})
+	if err == nil || err.Error() != "no download with that id" {
+		t.Fatal("expected an error for an unknown download, got", err)
+	}
+	resp, err := HttpPOST("http://"+st.server.listener.Addr().String()+"/renter/downloads/foo", "action=pause")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal("expected 404 for an unknown download, got", resp.StatusCode)
+	}
+	err = st.stdPostAPI("/renter/downloads/"+id, url.Values{"action": {"stop"}})
+	if err == nil {
+		t.Fatal("expected an error for an unrecognized action")
+	}
+}
+
+// TestRenterBandwidthLimits checks that the bandwidth limits in the renter
+// settings slow down uploads, and that the throughput is reported.
+func TestRenterBandwidthLimits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterBandwidthLimits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Limit the upload speed to one sector per second. The allowance should
+	// not be changed.
+	limitValues := url.Values{}
+	limitValues.Set("maxuploadspeed", fmt.Sprint(modules.SectorSize))
+	err = st.stdPostAPI("/renter", limitValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rg RenterGET
+	err = st.getAPI("/renter", &rg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rg.Settings.MaxUploadSpeed != modules.SectorSize || rg.Settings.MaxDownloadSpeed != 0 || rg.Settings.MaxBandwidth != 0 {
+		t.Fatal("bandwidth limits were not set:", rg.Settings)
+	}
+	if rg.Settings.Allowance.Funds.String() != testFunds {
+		t.Fatal("allowance was changed when setting the bandwidth limits:", rg.Settings.Allowance)
+	}
+
+	// Invalid limits should be rejected.
+	limitValues.Set("maxbandwidth", "fast")
+	err = st.stdPostAPI("/renter", limitValues)
+	if err == nil || !strings.HasPrefix(err.Error(), "unable to parse maxbandwidth") {
+		t.Fatal("expected an error for an invalid limit, got", err)
+	}
+
+	// Upload a file of four sectors. The upload should take at least three
+	// seconds.
+	path := filepath.Join(st.dir, "test.dat")
+	err = createRandFile(path, int(modules.SectorSize-crypto.TwofishOverhead)*4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	start := time.Now()
+	err = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	var sawThroughput bool
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50); i++ {
+		st.getAPI("/renter/files", &rf)
+		st.getAPI("/renter", &rg)
+		sawThroughput = sawThroughput || rg.Throughput.Upload > 0
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	if elapsed := time.Since(start); elapsed < 3*time.Second {
+		t.Fatal("upload was not slowed down by the bandwidth limit:", elapsed)
+	}
+	if !sawThroughput {
+		t.Fatal("upload throughput was not reported")
+	}
+	if rg.Throughput.Upload > 2*modules.SectorSize {
+		t.Fatal("reported throughput exceeds the limit:", rg.Throughput.Upload)
+	}
+}
+
+// TestRenterFileHealth checks that the health of each chunk of a file is
+// reported by /renter/health.
+func TestRenterFileHealth(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterFileHealth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file of two chunks.
+	path := filepath.Join(st.dir, "test.dat")
+	err = createRandFile(path, int(modules.SectorSize-crypto.TwofishOverhead)*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	err = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+
+	// With a single host, each chunk should have one piece online.
+	var hg HostGET
+	err = st.getAPI("/host", &hg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rh RenterFileHealth
+	err = st.getAPI("/renter/health/test", &rh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rh.Chunks) != 2 {
+		t.Fatal("expected 2 chunks, got", len(rh.Chunks))
+	}
+	for _, chunk := range rh.Chunks {
+		if chunk.MinPieces != 1 || chunk.NumPieces != 2 || chunk.OnlinePieces != 1 || len(chunk.Pieces) != 1 {
+			t.Fatal("chunk has wrong health:", chunk)
+		}
+		p := chunk.Pieces[0]
+		if p.Offline || p.NetAddress != hg.ExternalSettings.NetAddress || p.BlocksRemaining == 0 {
+			t.Fatal("piece has wrong location:", p)
+		}
+	}
+
+	// Unknown files should be rejected.
+	err = st.getAPI("/renter/health/foo", &rh)
+	if err == nil {
+		t.Fatal("expected an error for an unknown file")
+	}
+}
+
+// TestRenterAudits checks that the renter audits the pieces stored on its
+// hosts, and marks pieces that a host has lost as unavailable.
+func TestRenterAudits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterAudits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file of one chunk.
+	path := filepath.Join(st.dir, "test.dat")
+	err = createRandFile(path, int(modules.SectorSize-crypto.TwofishOverhead))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	err = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+
+	// The host should pass the audits of the piece.
+	var ra RenterAudits
+	for i := 0; i < 100 && (len(ra.Hosts) != 1 || ra.Hosts[0].Audits == 0); i++ {
+		st.getAPI("/renter/audits", &ra)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(ra.Hosts) != 1 || ra.Hosts[0].Audits == 0 {
+		t.Fatal("the host was not audited:", ra.Hosts)
+	}
+	if ra.Hosts[0].Failures != 0 {
+		t.Fatal("the host failed an audit of a piece it stores:", ra.Hosts[0])
+	}
+
+	// Make the host lose the piece. The next audit should fail, and the piece
+	// should be marked as unavailable.
+	contracts := st.renter.Contracts()
+	if len(contracts) != 1 || len(contracts[0].MerkleRoots) != 1 {
+		t.Fatal("expected one contract storing one sector, got", contracts)
+	}
+	err = st.host.DeleteSector(contracts[0].MerkleRoots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && ra.Hosts[0].Failures == 0; i++ {
+		st.getAPI("/renter/audits", &ra)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if ra.Hosts[0].Failures == 0 || ra.Hosts[0].LastFailure.IsZero() {
+		t.Fatal("the host did not fail an audit of a lost piece:", ra.Hosts[0])
+	}
+	var rh RenterFileHealth
+	err = st.getAPI("/renter/health/test", &rh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rh.Chunks) != 1 || len(rh.Chunks[0].Pieces) != 1 {
+		t.Fatal("file has wrong health:", rh.Chunks)
+	}
+	if !rh.Chunks[0].Pieces[0].Unavailable || rh.Chunks[0].OnlinePieces != 0 {
+		t.Fatal("lost piece was not marked as unavailable:", rh.Chunks[0])
+	}
+}
+
+// TestRenterDedup checks that identical files uploaded with deduplication
+// share the same sectors, and that the sectors are only deleted once every
+// file using them has been deleted.
+func TestRenterDedup(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterDedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file of one chunk.
+	path := filepath.Join(st.dir, "test.dat")
+	err = createRandFile(path, int(modules.SectorSize-crypto.TwofishOverhead))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	uploadValues.Set("dedup", "true")
+	err = st.stdPostAPI("/renter/upload/test1", uploadValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	contracts := st.renter.Contracts()
+	if len(contracts) != 1 || len(contracts[0].MerkleRoots) != 1 {
+		t.Fatal("expected one contract storing one sector, got", contracts)
+	}
+
+	// Upload a copy of the file. It should be available immediately, without
+	// uploading another sector.
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path2 := filepath.Join(st.dir, "test2.dat")
+	err = ioutil.WriteFile(path2, orig, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues.Set("source", path2)
+	err = st.stdPostAPI("/renter/upload/test2", uploadValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.getAPI("/renter/files", &rf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Files) != 2 {
+		t.Fatal("expected 2 files, got", rf.Files)
+	}
+	for _, fi := range rf.Files {
+		if !fi.Available || fi.UploadProgress < 50 {
+			t.Fatal("the copy should share the pieces of the original file:", rf.Files)
+		}
+	}
+	if contracts = st.renter.Contracts(); len(contracts[0].MerkleRoots) != 1 {
+		t.Fatal("the copy was uploaded again:", len(contracts[0].MerkleRoots))
+	}
+
+	// Delete the original file. The copy should still be downloadable.
+	err = st.stdPostAPI("/renter/delete/test1", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	downpath := filepath.Join(st.dir, "testdown.dat")
+	err = st.stdGetAPI("/renter/download/test2?destination=" + downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Compare(orig, download) != 0 {
+		t.Fatal("data mismatch when downloading a file")
+	}
+	if contracts = st.renter.Contracts(); len(contracts[0].MerkleRoots) != 1 {
+		t.Fatal("shared sector was deleted:", len(contracts[0].MerkleRoots))
+	}
+
+	// Delete the copy. The sector should be deleted from the host.
+	err = st.stdPostAPI("/renter/delete/test2", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && len(contracts[0].MerkleRoots) != 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		contracts = st.renter.Contracts()
+	}
+	if len(contracts[0].MerkleRoots) != 0 {
+		t.Fatal("sector was not deleted after the last file using it was deleted")
+	}
+}
+
+// TestRenterCompression checks that compressed files use fewer sectors than
+// their size would require, and that they can be downloaded whole or in
+// sections.
+func TestRenterCompression(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterCompression")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a compressible file that spans 20 chunks when uncompressed.
+	chunkSize := int(modules.SectorSize - crypto.TwofishOverhead)
+	var orig []byte
+	for i := 0; len(orig) < 20*chunkSize; i++ {
+		orig = append(orig, fmt.Sprintf("line %d of a log file that compresses well\n", i)...)
+	}
+	orig = orig[:20*chunkSize]
+	path := filepath.Join(st.dir, "test.log")
+	err = ioutil.WriteFile(path, orig, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	uploadValues.Set("compression", "lzma")
+	err = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err == nil {
+		t.Fatal("expected an unknown compression algorithm to be rejected")
+	}
+	uploadValues.Set("compression", "gzip")
+	err = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || !rf.Files[0].Available); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || !rf.Files[0].Available {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	if rf.Files[0].Filesize != uint64(len(orig)) {
+		t.Fatal("expected the size of the uncompressed file, got", rf.Files[0].Filesize)
+	}
+	contracts := st.renter.Contracts()
+	if len(contracts) != 1 || len(contracts[0].MerkleRoots) == 0 || len(contracts[0].MerkleRoots) >= 10 {
+		t.Fatal("expected the compressed file to use fewer sectors, got", len(contracts[0].MerkleRoots))
+	}
+
+	// Download the whole file.
+	downpath := filepath.Join(st.dir, "testdown.log")
+	err = st.stdGetAPI("/renter/download/test?destination=" + downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(orig, download) {
+		t.Fatal("data mismatch when downloading a compressed file")
+	}
+
+	// Stream a section of the file.
+	req, err := http.NewRequest("GET", "http://"+st.server.listener.Addr().String()+"/renter/stream/test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "Sia-Agent")
+	offset := 7*chunkSize + 100
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+3*chunkSize))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatal("expected status 206, got", resp.StatusCode)
+	}
+	if !bytes.Equal(body, orig[offset:offset+3*chunkSize+1]) {
+		t.Fatal("data mismatch when streaming a section of a compressed file")
+	}
+}
+
+// TestRenterVersions checks that versioned uploads keep earlier versions that
+// can be downloaded and restored, that snapshots keep the files they record,
+// and that the sectors of a version are deleted once nothing refers to it.
+func TestRenterVersions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterVersions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	allowanceValues.Set("maxversions", "5")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rg RenterGET
+	if err = st.getAPI("/renter", &rg); err != nil {
+		t.Fatal(err)
+	}
+	if rg.Settings.MaxVersions != 5 {
+		t.Fatal("version limit was not set:", rg.Settings.MaxVersions)
+	}
+
+	// Upload two versions of a file. Each version occupies a sector.
+	path := filepath.Join(st.dir, "test.dat")
+	upload := func(versioned bool) ([]byte, error) {
+		if err := createRandFile(path, 1024); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uploadValues := url.Values{}
+		uploadValues.Set("source", path)
+		uploadValues.Set("datapieces", "1")
+		uploadValues.Set("paritypieces", "1")
+		uploadValues.Set("versioned", strconv.FormatBool(versioned))
+		if err := st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+			return nil, err
+		}
+		var rf RenterFiles
+		for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50); i++ {
+			st.getAPI("/renter/files", &rf)
+			time.Sleep(50 * time.Millisecond)
+		}
+		if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50 {
+			t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+		}
+		return data, nil
+	}
+	v1, err := upload(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = upload(false); err == nil {
+		t.Fatal("expected an unversioned upload to an existing path to fail")
+	}
+	v2, err := upload(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contracts := st.renter.Contracts(); len(contracts) != 1 || len(contracts[0].MerkleRoots) != 2 {
+		t.Fatal("expected one contract storing two sectors, got", contracts)
+	}
+	var rv RenterVersions
+	if err = st.getAPI("/renter/versions/test", &rv); err != nil {
+		t.Fatal(err)
+	}
+	if len(rv.Versions) != 1 || rv.Versions[0].Version != 1 || rv.Versions[0].Filesize != 1024 {
+		t.Fatal("wrong versions:", rv.Versions)
+	}
+
+	// Download the earlier version.
+	downpath := filepath.Join(st.dir, "testdown.dat")
+	checkDownload := func(query string, expected []byte) {
+		if err := st.stdGetAPI("/renter/download/test?destination=" + downpath + query); err != nil {
+			t.Fatal(err)
+		}
+		download, err := ioutil.ReadFile(downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(download, expected) {
+			t.Fatal("data mismatch when downloading", query)
+		}
+	}
+	checkDownload("&version=1", v1)
+	checkDownload("", v2)
+
+	// Take a snapshot, then restore the first version. The second version
+	// should remain available from the snapshot.
+	snapshotValues := url.Values{}
+	snapshotValues.Set("action", "create")
+	if err = st.stdPostAPI("/renter/snapshots/snap", snapshotValues); err != nil {
+		t.Fatal(err)
+	}
+	var rs RenterSnapshots
+	if err = st.getAPI("/renter/snapshots", &rs); err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Snapshots) != 1 || rs.Snapshots[0].Name != "snap" || rs.Snapshots[0].NumFiles != 1 {
+		t.Fatal("wrong snapshots:", rs.Snapshots)
+	}
+	versionValues := url.Values{}
+	versionValues.Set("action", "restore")
+	versionValues.Set("version", "1")
+	if err = st.stdPostAPI("/renter/versions/test", versionValues); err != nil {
+		t.Fatal(err)
+	}
+	checkDownload("", v1)
+	checkDownload("&snapshot=snap", v2)
+	if err = st.getAPI("/renter/versions/test", &rv); err != nil {
+		t.Fatal(err)
+	}
+	if len(rv.Versions) != 1 || rv.Versions[0].Version != 2 {
+		t.Fatal("the replaced file was not kept as a version:", rv.Versions)
+	}
+
+	// Deleting the version keeps its sector, as the snapshot refers to it.
+	// Deleting the snapshot as well should delete the sector from the host.
+	versionValues.Set("action", "delete")
+	versionValues.Set("version", "2")
+	if err = st.stdPostAPI("/renter/versions/test", versionValues); err != nil {
+		t.Fatal(err)
+	}
+	contracts := st.renter.Contracts()
+	if len(contracts[0].MerkleRoots) != 2 {
+		t.Fatal("sector of a version kept by a snapshot was deleted")
+	}
+	snapshotValues.Set("action", "delete")
+	if err = st.stdPostAPI("/renter/snapshots/snap", snapshotValues); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && len(contracts[0].MerkleRoots) != 1; i++ {
+		time.Sleep(100 * time.Millisecond)
+		contracts = st.renter.Contracts()
+	}
+	if len(contracts[0].MerkleRoots) != 1 {
+		t.Fatal("sector was not deleted after the version was released:", len(contracts[0].MerkleRoots))
+	}
+	checkDownload("", v1)
+}
+
+// TestRenterBackup checks that the renter's metadata can be backed up to its
+// hosts and to a local file, and that a new renter can recover its contracts
+// and files using only the wallet seed.
+func TestRenterBackup(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterBackup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed. The
+	// period is long enough for the contract to be revised after it has been
+	// confirmed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", "20")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 50 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	contractRoots := st.renter.Contracts()[0].MerkleRoots
+	numSectors := len(contractRoots)
+
+	// Store a backup on the host. The backup occupies a data sector, followed
+	// by a marker sector and an index sector.
+	var rb RenterBackup
+	if err = st.getAPI("/renter/backup", &rb); err != nil {
+		t.Fatal(err)
+	}
+	if rb.Backup.NumHosts != 0 {
+		t.Fatal("backup reported before a backup was created:", rb.Backup)
+	}
+	if err = st.stdPostAPI("/renter/backup", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter/backup", &rb); err != nil {
+		t.Fatal(err)
+	}
+	if rb.Backup.NumHosts != 1 || rb.Backup.Size == 0 {
+		t.Fatal("backup was not stored on the host:", rb.Backup)
+	}
+	roots := st.renter.Contracts()[0].MerkleRoots
+	if len(roots) != numSectors+3 {
+		t.Fatalf("expected %v sectors after the backup, got %v", numSectors+3, len(roots))
+	}
+	// The sectors of the uploaded file should not have moved.
+	for i, root := range roots[:numSectors] {
+		if root != contractRoots[i] {
+			t.Fatal("backup moved the sectors of the file")
+		}
+	}
+
+	// Storing another backup should replace the first one.
+	if err = st.stdPostAPI("/renter/backup", nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(st.renter.Contracts()[0].MerkleRoots); n != numSectors+3 {
+		t.Fatalf("expected %v sectors after replacing the backup, got %v", numSectors+3, n)
+	}
+
+	// Export a backup to a file.
+	backupPath := filepath.Join(st.dir, "renter.backup")
+	backupValues := url.Values{}
+	backupValues.Set("destination", "renter.backup")
+	if err = st.stdPostAPI("/renter/backup", backupValues); err == nil {
+		t.Fatal("expected a relative destination to be rejected")
+	}
+	backupValues.Set("destination", backupPath)
+	if err = st.stdPostAPI("/renter/backup", backupValues); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(backupPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate the loss of the renter directory by creating a new renter
+	// that shares only the wallet, and recover from the backup on the host.
+	// The contract must be confirmed for it to be found on the blockchain.
+	if _, err = st.miner.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := renter.New(st.cs, st.wallet, st.tpool, filepath.Join(st.dir, "recovered"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; i < 100 && len(r.ActiveHosts()) == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err = r.RecoverBackup(""); err != nil {
+		t.Fatal(err)
+	}
+	if contracts := r.Contracts(); len(contracts) != 1 || contracts[0].ID != st.renter.Contracts()[0].ID {
+		t.Fatal("contract was not recovered:", contracts)
+	}
+	if r.Backup().NumHosts != 1 {
+		t.Fatal("backup location was not recovered:", r.Backup())
+	}
+	if r.Settings().Allowance.Hosts == 0 {
+		t.Fatal("allowance was not recovered")
+	}
+	downpath := filepath.Join(st.dir, "testdown.dat")
+	if err = r.Download("test", downpath); err != nil {
+		t.Fatal(err)
+	}
+	download, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(download, data) {
+		t.Fatal("recovered file does not match the original")
+	}
+
+	// Recover from the exported file into another new renter.
+	r2, err := renter.New(st.cs, st.wallet, st.tpool, filepath.Join(st.dir, "imported"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	if err = r2.RecoverBackup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r2.File("test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenterMetadata checks that metadata can be attached to files, that files
+// can be searched by their metadata, and that the content type of a file is
+// used when it is streamed.
+func TestRenterMetadata(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterMetadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload three files.
+	for _, name := range []string{"photos/a", "photos/b", "docs/c"} {
+		path := filepath.Join(st.dir, filepath.Base(name))
+		err = createRandFile(path, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = st.stdPostAPI("/renter/upload/"+name, url.Values{"source": {path}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tag the photos.
+	err = st.stdPostAPI("/renter/metadata/photos/a", url.Values{"contenttype": {"image/jpeg"}, "owner": {"alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.stdPostAPI("/renter/metadata/photos/b", url.Values{"contenttype": {"image/png"}, "owner": {"alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.stdPostAPI("/renter/metadata/dne", url.Values{"owner": {"alice"}})
+	if err == nil {
+		t.Fatal("expected an error when tagging a file that does not exist")
+	}
+
+	// Search for the files.
+	tests := []struct {
+		query string
+		names []string
+		total int
+	}{
+		{"", []string{"docs/c", "photos/a", "photos/b"}, 3},
+		{"tag=owner:alice", []string{"photos/a", "photos/b"}, 2},
+		{"tag=owner:alice&tag=contenttype:image/png", []string{"photos/b"}, 1},
+		{"tag=owner", []string{"photos/a", "photos/b"}, 2},
+		{"prefix=docs/", []string{"docs/c"}, 1},
+		{"minsize=1025", nil, 0},
+		{"offset=1&limit=1", []string{"photos/a"}, 3},
+	}
+	for _, test := range tests {
+		var rfs RenterFilesSearch
+		err = st.getAPI("/renter/files/search?"+test.query, &rfs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range rfs.Files {
+			names = append(names, f.SiaPath)
+		}
+		if strings.Join(names, ",") != strings.Join(test.names, ",") || rfs.Total != test.total {
+			t.Errorf("search %q returned %v of %v files, expected %v of %v", test.query, names, rfs.Total, test.names, test.total)
+		}
+	}
+	var rfs RenterFilesSearch
+	if err = st.getAPI("/renter/files/search?limit=x", &rfs); err == nil {
+		t.Fatal("expected an error for an invalid limit")
+	}
+
+	// Wait for the upload to complete, then stream the first photo.
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 3 || rf.Files[0].UploadProgress < 10 || rf.Files[1].UploadProgress < 10 || rf.Files[2].UploadProgress < 10); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 3 || rf.Files[0].UploadProgress < 10 || rf.Files[1].UploadProgress < 10 || rf.Files[2].UploadProgress < 10 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	req, err := http.NewRequest("GET", "http://"+st.server.listener.Addr().String()+"/renter/stream/photos/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "Sia-Agent")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "image/jpeg" {
+		t.Fatal("expected the content type of the file, got", ct)
+	}
+}
+
+// TestRenterExpiration checks that a file can be given an expiration height,
+// and that it is deleted once the height is reached.
+func TestRenterExpiration(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterExpiration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload two files, one of which expires.
+	height := st.cs.Height()
+	expiration := strconv.Itoa(int(height + 3))
+	for _, name := range []string{"forever", "expiring"} {
+		path := filepath.Join(st.dir, name)
+		err = createRandFile(path, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uploadValues := url.Values{"source": {path}}
+		if name == "expiring" {
+			uploadValues.Set("expirationheight", expiration)
+		}
+		err = st.stdPostAPI("/renter/upload/"+name, uploadValues)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = st.stdPostAPI("/renter/upload/past", url.Values{"source": {filepath.Join(st.dir, "forever")}, "expirationheight": {strconv.Itoa(int(height))}})
+	if err == nil {
+		t.Fatal("expected an error when uploading a file that has already expired")
+	}
+
+	// Invalid expirations should be rejected.
+	for _, vals := range []url.Values{
+		{},
+		{"height": {"0"}},
+		{"keepforever": {"false"}},
+		{"height": {expiration}, "keepforever": {"true"}},
+	} {
+		if err := st.stdPostAPI("/renter/expiration/forever", vals); err == nil {
+			t.Fatalf("expected an error when setting the expiration with %v", vals)
+		}
+	}
+	err = st.stdPostAPI("/renter/expiration/forever", url.Values{"keepforever": {"true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rf RenterFiles
+	if err = st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range rf.Files {
+		if f.SiaPath == "expiring" && f.ExpirationHeight != height+3 {
+			t.Fatal("wrong expiration of expiring file:", f.ExpirationHeight)
+		} else if f.SiaPath == "forever" && (f.ExpirationHeight != 0 || !f.Renewing) {
+			t.Fatal("wrong expiration of file kept forever:", f.ExpirationHeight, f.Renewing)
+		}
+	}
+
+	// Mine blocks until the expiration height is reached. The expiring file
+	// should be deleted.
+	for st.cs.Height() < height+3 {
+		if _, err = st.miner.AddBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if err = st.getAPI("/renter/files", &rf); err != nil {
+			t.Fatal(err)
+		}
+		if len(rf.Files) == 1 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].SiaPath != "forever" {
+		t.Fatal("expiring file was not deleted:", rf.Files)
+	}
+}
+
+// TestRenterErasureCodes checks that files can be uploaded with each type of
+// erasure code and downloaded again.
+func TestRenterErasureCodes(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterErasureCodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	err = st.announceHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.acceptContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.setHostStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(st.dir, "test.dat")
+	err = createRandFile(path, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown erasure codes and missing parameters should be rejected.
+	for _, vals := range []url.Values{
+		{"erasurecode": {"foo"}},
+		{"erasurecode": {"replication"}},
+		{"erasurecode": {"lrc"}, "datapieces": {"1"}, "paritypieces": {"1"}},
+		{"erasurecode": {"lrc"}, "datapieces": {"1"}, "paritypieces": {"1"}, "localgroups": {"2"}},
+	} {
+		vals.Set("source", path)
+		if err := st.stdPostAPI("/renter/upload/bad", vals); err == nil {
+			t.Fatalf("expected an error when uploading with %v", vals)
+		}
+	}
+
+	// Upload the file with a replication code and a locally repairable code.
+	uploads := map[string]url.Values{
+		"replicated": {"erasurecode": {"replication"}, "copies": {"2"}},
+		"lrc":        {"erasurecode": {"lrc"}, "datapieces": {"1"}, "paritypieces": {"1"}, "localgroups": {"1"}},
+	}
+	for name, vals := range uploads {
+		vals.Set("source", path)
+		if err := st.stdPostAPI("/renter/upload/"+name, vals); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 2 || !rf.Files[0].Available || !rf.Files[1].Available); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 2 || !rf.Files[0].Available || !rf.Files[1].Available {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+
+	// Download both files and check their contents.
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range uploads {
+		downpath := filepath.Join(st.dir, name+".dat")
+		if err := st.stdGetAPI("/renter/download/" + name + "?destination=" + downpath); err != nil {
+			t.Fatal(err)
+		}
+		download, err := ioutil.ReadFile(downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(orig, download) {
+			t.Fatal("data mismatch when downloading", name)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package crypto
 import (
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"io"
@@ -14,7 +15,8 @@ import (
 )
 
 const (
-	TwofishOverhead = 28 // number of bytes added by EncryptBytes
+	TwofishOverhead  = 28 // number of bytes added by EncryptBytes
+	TwofishNonceSize = 12 // number of nonce bytes prepended by EncryptBytes
 )
 
 var (
@@ -74,6 +76,35 @@ func (key TwofishKey) DecryptBytes(ct Ciphertext) ([]byte, error) {
 	return aead.Open(nil, ct[:aead.NonceSize()], ct[aead.NonceSize():], nil)
 }
 
+// DecryptBytesInRange decrypts a section of a ciphertext created by
+// EncryptBytes, without needing the rest of the ciphertext. 'nonce' is the
+// nonce at the start of the ciphertext, and 'section' holds the encrypted
+// bytes that begin 'offset' bytes after the nonce. GCM encrypts with a
+// counter mode stream, so any section can be decrypted independently. The
+// section is NOT authenticated; the caller must verify the ciphertext through
+// other means, such as a Merkle proof against the root of the ciphertext.
+func (key TwofishKey) DecryptBytesInRange(nonce, section []byte, offset uint64) ([]byte, error) {
+	if len(nonce) != TwofishNonceSize {
+		return nil, ErrInsufficientLen
+	}
+
+	// GCM reserves the first counter block for the authentication tag, so the
+	// first block of data is encrypted with a counter of 2.
+	block := key.NewCipher()
+	counter := make([]byte, twofish.BlockSize)
+	copy(counter, nonce)
+	binary.BigEndian.PutUint32(counter[12:], uint32(2+offset/twofish.BlockSize))
+	stream := cipher.NewCTR(block, counter)
+
+	// Discard the keystream that precedes the offset within its block.
+	skip := make([]byte, offset%twofish.BlockSize)
+	stream.XORKeyStream(skip, skip)
+
+	plaintext := make([]byte, len(section))
+	stream.XORKeyStream(plaintext, section)
+	return plaintext, nil
+}
+
 // NewWriter returns a writer that encrypts or decrypts its input stream.
 func (key TwofishKey) NewWriter(w io.Writer) io.Writer {
 	// OK to use a zero IV if the key is unique for each ciphertext.
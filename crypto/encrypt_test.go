@@ -80,6 +80,53 @@ func TestTwofishEncryption(t *testing.T) {
 	}
 }
 
+// TestDecryptBytesInRange checks that sections of a ciphertext can be
+// decrypted independently of the rest of the ciphertext.
+func TestDecryptBytesInRange(t *testing.T) {
+	key, err := GenerateTwofishKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := make([]byte, 600)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := key.EncryptBytes(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := ciphertext[:TwofishNonceSize]
+	encrypted := ciphertext[TwofishNonceSize:]
+
+	// Decrypt sections that start and end both on and off block boundaries.
+	sections := []struct {
+		offset, length uint64
+	}{
+		{0, 600},
+		{0, 1},
+		{16, 32},
+		{17, 100},
+		{250, 350},
+		{599, 1},
+	}
+	for _, section := range sections {
+		pt, err := key.DecryptBytesInRange(nonce, encrypted[section.offset:section.offset+section.length], section.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pt, plaintext[section.offset:section.offset+section.length]) {
+			t.Errorf("section at %v of length %v was not decrypted correctly", section.offset, section.length)
+		}
+	}
+
+	// A nonce of the wrong size should be rejected.
+	_, err = key.DecryptBytesInRange(nonce[:11], encrypted, 0)
+	if err != ErrInsufficientLen {
+		t.Error("expected ErrInsufficientLen, got", err)
+	}
+}
+
 // TestReaderWriter probes the NewReader and NewWriter methods of the key type.
 func TestReaderWriter(t *testing.T) {
 	// Get a key for encryption.
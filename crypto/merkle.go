@@ -148,3 +148,169 @@ func VerifySegment(base []byte, hashSet []Hash, numSegments, proofIndex uint64,
 	}
 	return merkletree.VerifyProof(NewHash(), root[:], proofSet, proofIndex, numSegments)
 }
+
+// subtreeSplit returns the number of leaves in the left subtree of a Merkle
+// tree with n leaves, which is the largest power of two that is smaller than
+// n. n must be at least 2.
+func subtreeSplit(n uint64) uint64 {
+	split := uint64(1)
+	for split*2 < n {
+		split *= 2
+	}
+	return split
+}
+
+// nodeHash returns the hash of a Merkle tree node with the provided children.
+func nodeHash(left, right Hash) Hash {
+	return HashBytes(append(append([]byte{1}, left[:]...), right[:]...))
+}
+
+// segmentRange returns the data covering the segments [start, end) of b,
+// where b begins with segment 'offset'. The final segment may be short.
+func segmentRange(b []byte, offset, start, end uint64) []byte {
+	lo := (start - offset) * SegmentSize
+	hi := (end - offset) * SegmentSize
+	if hi > uint64(len(b)) {
+		hi = uint64(len(b))
+	}
+	return b[lo:hi]
+}
+
+// MerkleRangeProof builds a Merkle proof that the segments in the range
+// [start, end) are a part of the Merkle root formed by 'b'. The proof contains
+// the roots of the largest subtrees that lie entirely outside of the range,
+// ordered from left to right.
+func MerkleRangeProof(b []byte, start, end uint64) []Hash {
+	numSegments := CalculateLeaves(uint64(len(b)))
+	if start >= end || end > numSegments {
+		return nil
+	}
+	var proof []Hash
+	var buildProof func(lo, hi uint64)
+	buildProof = func(lo, hi uint64) {
+		if hi <= start || lo >= end {
+			proof = append(proof, MerkleRoot(segmentRange(b, 0, lo, hi)))
+			return
+		} else if start <= lo && hi <= end {
+			return
+		}
+		mid := lo + subtreeSplit(hi-lo)
+		buildProof(lo, mid)
+		buildProof(mid, hi)
+	}
+	buildProof(0, numSegments)
+	return proof
+}
+
+// RangeProofSize returns the number of hashes in the proof created by
+// MerkleRangeProof for the segments in the range [start, end) of data that is
+// 'numSegments' segments long.
+func RangeProofSize(numSegments, start, end uint64) uint64 {
+	if start >= end || end > numSegments {
+		return 0
+	}
+	var size uint64
+	var countProof func(lo, hi uint64)
+	countProof = func(lo, hi uint64) {
+		if hi <= start || lo >= end {
+			size++
+			return
+		} else if start <= lo && hi <= end {
+			return
+		}
+		mid := lo + subtreeSplit(hi-lo)
+		countProof(lo, mid)
+		countProof(mid, hi)
+	}
+	countProof(0, numSegments)
+	return size
+}
+
+// VerifyRangeProof verifies that 'segments' contains the segments in the
+// range [start, end) of data that is 'numSegments' segments long and has the
+// Merkle root 'root', using a proof created by MerkleRangeProof. Only the
+// final segment of the data may be short.
+func VerifyRangeProof(segments []byte, proof []Hash, numSegments, start, end uint64, root Hash) bool {
+	if start >= end || end > numSegments {
+		return false
+	}
+	// All segments must be full, except for the final segment of the data.
+	minLen := (end - start - 1) * SegmentSize
+	maxLen := (end - start) * SegmentSize
+	if uint64(len(segments)) <= minLen || uint64(len(segments)) > maxLen {
+		return false
+	} else if end < numSegments && uint64(len(segments)) != maxLen {
+		return false
+	}
+
+	var verifyProof func(lo, hi uint64) (Hash, bool)
+	verifyProof = func(lo, hi uint64) (Hash, bool) {
+		if hi <= start || lo >= end {
+			if len(proof) == 0 {
+				return Hash{}, false
+			}
+			h := proof[0]
+			proof = proof[1:]
+			return h, true
+		} else if start <= lo && hi <= end {
+			return MerkleRoot(segmentRange(segments, start, lo, hi)), true
+		}
+		mid := lo + subtreeSplit(hi-lo)
+		left, ok := verifyProof(lo, mid)
+		if !ok {
+			return Hash{}, false
+		}
+		right, ok := verifyProof(mid, hi)
+		if !ok {
+			return Hash{}, false
+		}
+		return nodeHash(left, right), true
+	}
+	h, ok := verifyProof(0, numSegments)
+	return ok && len(proof) == 0 && h == root
+}
+
+// SegmentProof converts a proof created by MerkleRangeProof for the single
+// segment [proofIndex, proofIndex+1) into the hash set expected by
+// VerifySegment. A range proof lists the sibling subtrees from left to right,
+// whereas VerifySegment expects them ordered from the leaf up to the root.
+// false is returned if the proof has the wrong number of hashes.
+func SegmentProof(proof []Hash, numSegments, proofIndex uint64) ([]Hash, bool) {
+	if proofIndex >= numSegments {
+		return nil, false
+	}
+	// Walk from the root down to the segment, recording on which side the
+	// sibling subtree lies at each level.
+	var siblingIsLeft []bool
+	var numLeft int
+	lo, hi := uint64(0), numSegments
+	for hi-lo > 1 {
+		mid := lo + subtreeSplit(hi-lo)
+		if proofIndex < mid {
+			hi = mid
+			siblingIsLeft = append(siblingIsLeft, false)
+		} else {
+			lo = mid
+			siblingIsLeft = append(siblingIsLeft, true)
+			numLeft++
+		}
+	}
+	if len(proof) != len(siblingIsLeft) {
+		return nil, false
+	}
+
+	// The left siblings appear first, ordered from the root down, followed by
+	// the right siblings ordered from the leaf up.
+	left, right := proof[:numLeft], proof[numLeft:]
+	hashSet := make([]Hash, 0, len(proof))
+	for i := len(siblingIsLeft) - 1; i >= 0; i-- {
+		if siblingIsLeft[i] {
+			hashSet = append(hashSet, left[len(left)-1])
+			left = left[:len(left)-1]
+		} else {
+			hashSet = append(hashSet, right[0])
+			right = right[1:]
+		}
+	}
+	return hashSet, true
+}
@@ -179,3 +179,115 @@ func TestOddDataSize(t *testing.T) {
 		}
 	}
 }
+
+// TestRangeProof builds range proofs for every range of several data sizes and
+// checks that they verify correctly and have the size given by RangeProofSize.
+func TestRangeProof(t *testing.T) {
+	for _, dataSize := range []uint64{SegmentSize, 7 * SegmentSize, 8*SegmentSize + 10, 13 * SegmentSize} {
+		data := make([]byte, dataSize)
+		rand.Read(data)
+		rootHash := MerkleRoot(data)
+		numSegments := CalculateLeaves(dataSize)
+
+		for start := uint64(0); start < numSegments; start++ {
+			for end := start + 1; end <= numSegments; end++ {
+				segments := segmentRange(data, 0, start, end)
+				proof := MerkleRangeProof(data, start, end)
+				if !VerifyRangeProof(segments, proof, numSegments, start, end, rootHash) {
+					t.Errorf("range proof for [%v, %v) of %v bytes did not pass verification", start, end, dataSize)
+				}
+				if uint64(len(proof)) != RangeProofSize(numSegments, start, end) {
+					t.Errorf("range proof for [%v, %v) of %v bytes has %v hashes, expected %v", start, end, dataSize, len(proof), RangeProofSize(numSegments, start, end))
+				}
+			}
+		}
+	}
+}
+
+// TestBadRangeProof checks that VerifyRangeProof rejects proofs that do not
+// match the data, range, or root.
+func TestBadRangeProof(t *testing.T) {
+	numSegments := uint64(11)
+	data := make([]byte, numSegments*SegmentSize)
+	rand.Read(data)
+	rootHash := MerkleRoot(data)
+	segments := segmentRange(data, 0, 3, 6)
+	proof := MerkleRangeProof(data, 3, 6)
+	if !VerifyRangeProof(segments, proof, numSegments, 3, 6, rootHash) {
+		t.Fatal("valid range proof did not pass verification")
+	}
+
+	// Corrupt the data.
+	badSegments := append([]byte(nil), segments...)
+	badSegments[0]++
+	if VerifyRangeProof(badSegments, proof, numSegments, 3, 6, rootHash) {
+		t.Error("verified a proof with corrupted data")
+	}
+	// Shift the range.
+	if VerifyRangeProof(segments, proof, numSegments, 4, 7, rootHash) {
+		t.Error("verified a proof for the wrong range")
+	}
+	// Truncate the data.
+	if VerifyRangeProof(segments[:len(segments)-1], proof, numSegments, 3, 6, rootHash) {
+		t.Error("verified a proof with truncated data")
+	}
+	// Drop a hash from the proof.
+	if VerifyRangeProof(segments, proof[1:], numSegments, 3, 6, rootHash) {
+		t.Error("verified a proof that is missing a hash")
+	}
+	// Add a hash to the proof.
+	if VerifyRangeProof(segments, append(proof, Hash{}), numSegments, 3, 6, rootHash) {
+		t.Error("verified a proof with an extra hash")
+	}
+	// Use the wrong root.
+	if VerifyRangeProof(segments, proof, numSegments, 3, 6, Hash{}) {
+		t.Error("verified a proof against the wrong root")
+	}
+	// Use an invalid range.
+	if VerifyRangeProof(segments, proof, numSegments, 6, 3, rootHash) || VerifyRangeProof(segments, proof, numSegments, 9, 12, rootHash) {
+		t.Error("verified a proof for an invalid range")
+	}
+}
+
+// TestSegmentProof checks that range proofs for a single segment can be
+// converted into proofs that pass VerifySegment.
+func TestSegmentProof(t *testing.T) {
+	for _, dataSize := range []uint64{SegmentSize, 2 * SegmentSize, 7 * SegmentSize, 8*SegmentSize + 10, 13 * SegmentSize, 64 * SegmentSize} {
+		data := make([]byte, dataSize)
+		rand.Read(data)
+		rootHash := MerkleRoot(data)
+		numSegments := CalculateLeaves(dataSize)
+
+		for i := uint64(0); i < numSegments; i++ {
+			base, expected := MerkleProof(data, i)
+			hashSet, ok := SegmentProof(MerkleRangeProof(data, i, i+1), numSegments, i)
+			if !ok {
+				t.Fatalf("could not convert range proof for segment %v of %v bytes", i, dataSize)
+			}
+			if len(hashSet) != len(expected) {
+				t.Fatalf("converted proof for segment %v of %v bytes has %v hashes, expected %v", i, dataSize, len(hashSet), len(expected))
+			}
+			for j := range hashSet {
+				if hashSet[j] != expected[j] {
+					t.Fatalf("converted proof for segment %v of %v bytes does not match MerkleProof", i, dataSize)
+				}
+			}
+			if !VerifySegment(base, hashSet, numSegments, i, rootHash) {
+				t.Errorf("converted proof for segment %v of %v bytes did not pass verification", i, dataSize)
+			}
+		}
+	}
+
+	// Proofs with the wrong number of hashes cannot be converted.
+	data := make([]byte, 8*SegmentSize)
+	proof := MerkleRangeProof(data, 3, 4)
+	if _, ok := SegmentProof(proof[1:], 8, 3); ok {
+		t.Error("converted a proof that is missing a hash")
+	}
+	if _, ok := SegmentProof(append(proof, Hash{}), 8, 3); ok {
+		t.Error("converted a proof with an extra hash")
+	}
+	if _, ok := SegmentProof(proof, 8, 8); ok {
+		t.Error("converted a proof for a segment outside of the data")
+	}
+}
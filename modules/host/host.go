@@ -122,6 +122,7 @@ type Host struct {
 	atomicRenewCalls          uint64
 	atomicReviseCalls         uint64
 	atomicRecentRevisionCalls uint64
+	atomicSectorRootsCalls    uint64
 	atomicSettingsCalls       uint64
 	atomicUnrecognizedCalls   uint64
 
@@ -5,6 +5,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -67,13 +68,15 @@ func (h *Host) managedDownloadIteration(conn net.Conn, so *storageObligation) er
 	var payload [][]byte
 	err = func() error {
 		// Check that the length of each file is in-bounds, and that the total
-		// size being requested is acceptable.
-		var totalSize uint64
+		// size being requested is acceptable. Range proofs are paid for like
+		// the requested data.
+		var totalSize, proofSize uint64
 		for _, request := range requests {
 			if request.Length > modules.SectorSize || request.Offset+request.Length > modules.SectorSize {
 				return extendErr("download iteration request failed: ", errRequestOutOfBounds)
 			}
 			totalSize += request.Length
+			proofSize += modules.RangeProofLength(request)
 		}
 		if totalSize > settings.MaxDownloadBatchSize {
 			return extendErr("download iteration batch failed: ", errLargeDownloadBatch)
@@ -81,7 +84,7 @@ func (h *Host) managedDownloadIteration(conn net.Conn, so *storageObligation) er
 
 		// Verify that the correct amount of money has been moved from the
 		// renter's contract funds to the host's contract funds.
-		expectedTransfer := settings.MinDownloadBandwidthPrice.Mul64(totalSize)
+		expectedTransfer := settings.MinDownloadBandwidthPrice.Mul64(totalSize + proofSize)
 		err = verifyPaymentRevision(existingRevision, paymentRevision, blockHeight, expectedTransfer)
 		if err != nil {
 			return extendErr("payment verification failed: ", err)
@@ -93,7 +96,18 @@ func (h *Host) managedDownloadIteration(conn net.Conn, so *storageObligation) er
 			if err != nil {
 				return extendErr("failed to load sector: ", ErrorInternal(err.Error()))
 			}
-			payload = append(payload, sectorData[request.Offset:request.Offset+request.Length])
+			data := sectorData[request.Offset : request.Offset+request.Length]
+
+			// Requests for a segment-aligned part of a sector are answered
+			// with a range proof appended to the data, so that the renter
+			// can verify the data against the sector's Merkle root.
+			if modules.IsRangeProofRequest(request) {
+				start := request.Offset / crypto.SegmentSize
+				end := (request.Offset + request.Length) / crypto.SegmentSize
+				proof := crypto.MerkleRangeProof(sectorData, start, end)
+				data = append(data[:len(data):len(data)], modules.EncodeRangeProof(proof)...)
+			}
+			payload = append(payload, data)
 		}
 		return nil
 	}()
@@ -0,0 +1,78 @@
+package host
+
+import (
+	"crypto/rand"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// managedRPCSectorRoots sends the most recent known file contract revision,
+// including signatures, to the renter, followed by the Merkle roots of the
+// sectors covered by the file contract. Renters use the roots to recover a
+// file contract when they have lost their own record of it.
+//
+// Only the renter of the file contract can request its roots, as the renter
+// must answer a challenge with the key of the contract.
+func (h *Host) managedRPCSectorRoots(conn net.Conn) error {
+	// Set the negotiation deadline.
+	conn.SetDeadline(time.Now().Add(modules.NegotiateSectorRootsTime))
+
+	// Receive the file contract id from the renter.
+	var fcid types.FileContractID
+	err := encoding.ReadObject(conn, &fcid, uint64(len(fcid)))
+	if err != nil {
+		return extendErr("could not read file contract id: ", ErrorConnection(err.Error()))
+	}
+
+	// Send a challenge to the renter to verify that the renter has write
+	// access to the file contract.
+	var challenge crypto.Hash
+	_, err = rand.Read(challenge[:])
+	if err != nil {
+		return ErrorInternal(err.Error())
+	}
+	err = encoding.WriteObject(conn, challenge)
+	if err != nil {
+		return extendErr("cound not write challenge: ", ErrorConnection(err.Error()))
+	}
+
+	// Read and verify the signed response from the renter.
+	var challengeResponse crypto.Signature
+	err = encoding.ReadObject(conn, &challengeResponse, uint64(len(challengeResponse)))
+	if err != nil {
+		return extendErr("could not read challenge response: ", ErrorConnection(err.Error()))
+	}
+	so, recentRevision, revisionSigs, err := h.managedVerifyChallengeResponse(fcid, challenge, challengeResponse)
+	if err != nil {
+		modules.WriteNegotiationRejection(conn, err) // Error not reported to preserve error type in extendErr.
+		return extendErr("challenge failed: ", err)
+	}
+	// No action is taken with the storage obligation, so it can be unlocked
+	// once the roots have been sent.
+	defer h.managedUnlockStorageObligation(fcid)
+
+	// Send the file contract revision, the corresponding signatures, and the
+	// sector roots to the renter.
+	err = modules.WriteNegotiationAcceptance(conn)
+	if err != nil {
+		return extendErr("failed to write challenge acceptance: ", ErrorConnection(err.Error()))
+	}
+	err = encoding.WriteObject(conn, recentRevision)
+	if err != nil {
+		return extendErr("failed to write recent revision: ", ErrorConnection(err.Error()))
+	}
+	err = encoding.WriteObject(conn, revisionSigs)
+	if err != nil {
+		return extendErr("failed to write recent revision signatures: ", ErrorConnection(err.Error()))
+	}
+	err = encoding.WriteObject(conn, so.SectorRoots)
+	if err != nil {
+		return extendErr("failed to write sector roots: ", ErrorConnection(err.Error()))
+	}
+	return nil
+}
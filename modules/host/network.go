@@ -165,6 +165,9 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 			// the storage obligation that gets returned.
 			h.managedUnlockStorageObligation(so.id())
 		}
+	case modules.RPCSectorRoots:
+		atomic.AddUint64(&h.atomicSectorRootsCalls, 1)
+		err = extendErr("incoming RPCSectorRoots failed: ", h.managedRPCSectorRoots(conn))
 	case modules.RPCSettings:
 		atomic.AddUint64(&h.atomicSettingsCalls, 1)
 		err = extendErr("incoming RPCSettings failed: ", h.managedRPCSettings(conn))
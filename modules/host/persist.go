@@ -23,6 +23,7 @@ type persistence struct {
 	RenewCalls          uint64 `json:"renewcalls"`
 	ReviseCalls         uint64 `json:"revisecalls"`
 	RecentRevisionCalls uint64 `json:"recentrevisioncalls"`
+	SectorRootsCalls    uint64 `json:"sectorrootscalls"`
 	SettingsCalls       uint64 `json:"settingscalls"`
 	UnrecognizedCalls   uint64 `json:"unrecognizedcalls"`
 
@@ -51,6 +52,7 @@ func (h *Host) persistData() persistence {
 		RenewCalls:          atomic.LoadUint64(&h.atomicRenewCalls),
 		ReviseCalls:         atomic.LoadUint64(&h.atomicReviseCalls),
 		RecentRevisionCalls: atomic.LoadUint64(&h.atomicRecentRevisionCalls),
+		SectorRootsCalls:    atomic.LoadUint64(&h.atomicSectorRootsCalls),
 		SettingsCalls:       atomic.LoadUint64(&h.atomicSettingsCalls),
 		UnrecognizedCalls:   atomic.LoadUint64(&h.atomicUnrecognizedCalls),
 
@@ -159,6 +161,7 @@ func (h *Host) load() error {
 	atomic.StoreUint64(&h.atomicRenewCalls, p.RenewCalls)
 	atomic.StoreUint64(&h.atomicReviseCalls, p.ReviseCalls)
 	atomic.StoreUint64(&h.atomicRecentRevisionCalls, p.RecentRevisionCalls)
+	atomic.StoreUint64(&h.atomicSectorRootsCalls, p.SectorRootsCalls)
 	atomic.StoreUint64(&h.atomicSettingsCalls, p.SettingsCalls)
 	atomic.StoreUint64(&h.atomicUnrecognizedCalls, p.UnrecognizedCalls)
 
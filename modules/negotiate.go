@@ -54,6 +54,12 @@ const (
 	// tree calculations that may be involved with renewing a file contract.
 	NegotiateRenewContractTime = 600 * time.Second
 
+	// NegotiateSectorRootsTime establishes the minimum amount of time that the
+	// connection deadline is expected to be set to when the sector roots of a
+	// file contract are being requested from the host. The deadline is long
+	// enough that the roots of a large contract can be transferred over Tor.
+	NegotiateSectorRootsTime = 600 * time.Second
+
 	// NegotiateSettingsTime establishes the minimum amount of time that the
 	// connection deadline is expected to be set to when settings are being
 	// requested from the host. The deadline is long enough that the connection
@@ -124,6 +130,10 @@ var (
 	// announcement is not a type of signature that is recognized.
 	ErrAnnUnrecognizedSignature = errors.New("the signature provided in the host announcement is not recognized")
 
+	// ErrNoRangeProof is returned when a host answers a partial sector
+	// download without a range proof, which happens with older hosts.
+	ErrNoRangeProof = errors.New("host did not send a range proof")
+
 	// ErrRevisionCoveredFields is returned if there is a covered fields object
 	// in a transaction signature which has the 'WholeTransaction' field set to
 	// true, meaning that miner fees cannot be added to the transaction without
@@ -160,6 +170,11 @@ var (
 	// contract revision for a given file contract.
 	RPCRecentRevision = types.Specifier{'R', 'e', 'c', 'e', 'n', 't', 'R', 'e', 'v', 'i', 's', 'i', 'o', 'n', 2}
 
+	// RPCSectorRoots is the specifier for getting the most recent file
+	// contract revision for a given file contract, along with the Merkle roots
+	// of the sectors covered by the contract.
+	RPCSectorRoots = types.Specifier{'S', 'e', 'c', 't', 'o', 'r', 'R', 'o', 'o', 't', 's', 2}
+
 	// RPCSettings is the specifier for requesting settings from the host.
 	RPCSettings = types.Specifier{'S', 'e', 't', 't', 'i', 'n', 'g', 's', 2}
 
@@ -181,6 +196,13 @@ type (
 	// offset indicates what portion of the sector is being downloaded, and the
 	// length indicates how many bytes should be grabbed starting from the
 	// offset.
+	//
+	// If the offset and length are aligned to crypto.SegmentSize and the
+	// action does not cover the whole sector, the host appends a range proof
+	// to the returned data. The range proof is the output of
+	// crypto.MerkleRangeProof for the requested segments, with each hash
+	// written out in order, and is paid for like the requested data. Older
+	// hosts return the data without a range proof.
 	DownloadAction struct {
 		MerkleRoot crypto.Hash
 		Offset     uint64
@@ -325,6 +347,57 @@ func WriteNegotiationStop(w io.Writer) error {
 	return encoding.WriteObject(w, StopResponse)
 }
 
+// IsRangeProofRequest returns true if the host should answer the download
+// action with a range proof.
+func IsRangeProofRequest(da DownloadAction) bool {
+	return da.Length > 0 && da.Length < SectorSize &&
+		da.Offset%crypto.SegmentSize == 0 && da.Length%crypto.SegmentSize == 0
+}
+
+// RangeProofLength returns the number of bytes of the range proof that the
+// host appends to the data returned for the download action, which is zero if
+// the action is not answered with a range proof.
+func RangeProofLength(da DownloadAction) uint64 {
+	if !IsRangeProofRequest(da) {
+		return 0
+	}
+	numSegments := SectorSize / crypto.SegmentSize
+	start := da.Offset / crypto.SegmentSize
+	end := (da.Offset + da.Length) / crypto.SegmentSize
+	return crypto.RangeProofSize(numSegments, start, end) * crypto.HashSize
+}
+
+// EncodeRangeProof encodes a range proof so that it can be appended to the
+// data returned for a download action.
+func EncodeRangeProof(proof []crypto.Hash) []byte {
+	b := make([]byte, 0, len(proof)*crypto.HashSize)
+	for _, h := range proof {
+		b = append(b, h[:]...)
+	}
+	return b
+}
+
+// DecodeRangeProof splits the data returned for a download action into the
+// requested data and the range proof that follows it. An error is returned if
+// the host did not append a range proof of the expected length, and
+// ErrNoRangeProof if it did not append a range proof at all.
+func DecodeRangeProof(da DownloadAction, data []byte) ([]byte, []crypto.Hash, error) {
+	if uint64(len(data)) < da.Length {
+		return nil, nil, errors.New("host did not send enough data")
+	}
+	proofBytes := data[da.Length:]
+	if len(proofBytes) == 0 {
+		return nil, nil, ErrNoRangeProof
+	} else if uint64(len(proofBytes)) != RangeProofLength(da) {
+		return nil, nil, errors.New("host sent a malformed range proof")
+	}
+	proof := make([]crypto.Hash, len(proofBytes)/crypto.HashSize)
+	for i := range proof {
+		copy(proof[i][:], proofBytes[i*crypto.HashSize:])
+	}
+	return data[:da.Length], proof, nil
+}
+
 // CreateAnnouncement will take a host announcement and encode it, returning
 // the exact []byte that should be added to the arbitrary data of a
 // transaction.
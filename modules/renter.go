@@ -1,6 +1,7 @@
 package modules
 
 import (
+	"errors"
 	"io"
 	"time"
 
@@ -13,6 +14,35 @@ const (
 	// RenterDir is the name of the directory that is used to store the
 	// renter's persistent data.
 	RenterDir = "renter"
+
+	// CompressionGzip is the name of the gzip compression algorithm, which
+	// can be applied to files before they are uploaded.
+	CompressionGzip = "gzip"
+
+	// MetadataContentType and MetadataOwner are the metadata keys that hold
+	// the content type and the owner of a file.
+	MetadataContentType = "contenttype"
+	MetadataOwner       = "owner"
+)
+
+var (
+	// ErasureCodeReedSolomon, ErasureCodeReplication, and ErasureCodeLRC
+	// identify the types of erasure code that files can be uploaded with. A
+	// Reed-Solomon code splits a chunk into data pieces and parity pieces, a
+	// replication code stores full copies of a chunk, and a locally
+	// repairable code adds a parity piece to each group of data pieces of a
+	// Reed-Solomon code.
+	ErasureCodeReedSolomon = types.Specifier{'R', 'e', 'e', 'd', '-', 'S', 'o', 'l', 'o', 'm', 'o', 'n'}
+	ErasureCodeReplication = types.Specifier{'R', 'e', 'p', 'l', 'i', 'c', 'a', 't', 'i', 'o', 'n'}
+	ErasureCodeLRC         = types.Specifier{'L', 'R', 'C'}
+
+	// ErrMaxContractPrice, ErrMaxDownloadBandwidthPrice, ErrMaxStoragePrice,
+	// and ErrMaxUploadBandwidthPrice are returned when a host charges more
+	// than the corresponding maximum price of the allowance.
+	ErrMaxContractPrice          = errors.New("host contract price exceeds the maximum contract price of the allowance")
+	ErrMaxDownloadBandwidthPrice = errors.New("host download bandwidth price exceeds the maximum download bandwidth price of the allowance")
+	ErrMaxStoragePrice           = errors.New("host storage price exceeds the maximum storage price of the allowance")
+	ErrMaxUploadBandwidthPrice   = errors.New("host upload bandwidth price exceeds the maximum upload bandwidth price of the allowance")
 )
 
 // An ErasureCoder is an error-correcting encoder and decoder.
@@ -35,6 +65,13 @@ type ErasureCoder interface {
 	// necessary because pieces may have been padded with zeros during
 	// encoding.
 	Recover(pieces [][]byte, n uint64, w io.Writer) error
+
+	// Type returns the identifier of the type of the erasure code.
+	Type() types.Specifier
+
+	// Params returns the parameters of the erasure code, which recreate the
+	// erasure code when they are passed to the constructor of its type.
+	Params() []uint64
 }
 
 // FileUploadParams contains the information used by the Renter to upload a
@@ -43,41 +80,344 @@ type FileUploadParams struct {
 	Source      string
 	SiaPath     string
 	ErasureCode ErasureCoder
+
+	// Pack indicates that the file should share a chunk with other small
+	// files instead of occupying a chunk of its own.
+	Pack bool
+
+	// Dedup indicates that the chunks of the file should be encrypted with
+	// keys derived from their content, so that chunks that are identical to
+	// chunks of other deduplicated files are only stored once.
+	Dedup bool
+
+	// Compression is the name of the algorithm that the file is compressed
+	// with before it is erasure coded and encrypted. The file is not
+	// compressed if Compression is empty.
+	Compression string
+
+	// Versioned indicates that a file that already exists at SiaPath should
+	// be kept as an earlier version of the file instead of causing the upload
+	// to fail.
+	Versioned bool
+
+	// ExpirationHeight is the height at which the file expires and is
+	// removed from the renter and the hosts. A value of 0 keeps the file
+	// forever.
+	ExpirationHeight types.BlockHeight
 }
 
-// FileInfo provides information about a file.
+// FileInfo provides information about a file. Metadata contains the
+// key/value tags attached to the file, such as its content type and owner.
+// ExpirationHeight is the height at which the file expires, or 0 if the file
+// is kept forever. Renewing indicates whether the file is still kept when the
+// contracts storing it end at Expiration.
 type FileInfo struct {
-	SiaPath        string            `json:"siapath"`
-	Filesize       uint64            `json:"filesize"`
-	Available      bool              `json:"available"`
-	Renewing       bool              `json:"renewing"`
-	Redundancy     float64           `json:"redundancy"`
-	UploadProgress float64           `json:"uploadprogress"`
-	Expiration     types.BlockHeight `json:"expiration"`
+	SiaPath          string            `json:"siapath"`
+	Filesize         uint64            `json:"filesize"`
+	Available        bool              `json:"available"`
+	Renewing         bool              `json:"renewing"`
+	Redundancy       float64           `json:"redundancy"`
+	UploadProgress   float64           `json:"uploadprogress"`
+	Expiration       types.BlockHeight `json:"expiration"`
+	ExpirationHeight types.BlockHeight `json:"expirationheight"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// FileFilter selects the files returned by a file search. A file matches the
+// filter if it has every tag in Tags, where an empty value matches any value
+// of the tag, if its SiaPath begins with Prefix, and if its size and
+// redundancy fall within the given ranges. A maximum of 0 does not limit the
+// size or redundancy. The matching files are sorted by SiaPath, and Offset
+// and Limit select a page of them; a Limit of 0 returns every file after
+// Offset.
+type FileFilter struct {
+	Tags          map[string]string
+	Prefix        string
+	MinSize       uint64
+	MaxSize       uint64
+	MinRedundancy float64
+	MaxRedundancy float64
+	Offset        int
+	Limit         int
+}
+
+// DirectoryInfo provides information about a directory in the renter. The
+// file count, size, and health of a directory are aggregated over every file
+// beneath it, including files in subdirectories.
+type DirectoryInfo struct {
+	SiaPath       string  `json:"siapath"`
+	NumFiles      uint64  `json:"numfiles"`
+	NumSubDirs    uint64  `json:"numsubdirs"`
+	AggregateSize uint64  `json:"aggregatesize"`
+	Available     bool    `json:"available"`
+	MinRedundancy float64 `json:"minredundancy"`
+}
+
+// The possible statuses of a download.
+const (
+	DownloadStatusActive    = "active"
+	DownloadStatusPaused    = "paused"
+	DownloadStatusComplete  = "complete"
+	DownloadStatusFailed    = "failed"
+	DownloadStatusCancelled = "cancelled"
+)
+
+// ChunkHealth describes where the pieces of a chunk of a file are stored. A
+// chunk can be recovered as long as MinPieces distinct pieces are stored on
+// hosts that are online. OnlinePieces is the number of distinct pieces that
+// are stored on hosts that are online.
+type ChunkHealth struct {
+	Index        uint64          `json:"index"`
+	MinPieces    int             `json:"minpieces"`
+	NumPieces    int             `json:"numpieces"`
+	OnlinePieces int             `json:"onlinepieces"`
+	Pieces       []PieceLocation `json:"pieces"`
+}
+
+// PieceLocation describes the contract and host that store a piece of a
+// chunk. NetAddress is the most recent address of the host. BlocksRemaining
+// is the number of blocks left until the contract ends, at which point the
+// host may discard the piece. Unavailable is set if the host failed an audit
+// of the piece. Replaced is set if the host is excluded by the host filter or
+// exceeds the maximum prices of the allowance, in which case the piece is
+// moved to another host but can still be downloaded until then.
+type PieceLocation struct {
+	Piece           uint64               `json:"piece"`
+	ContractID      types.FileContractID `json:"contractid"`
+	HostPublicKey   types.SiaPublicKey   `json:"hostpublickey"`
+	NetAddress      NetAddress           `json:"netaddress"`
+	Offline         bool                 `json:"offline"`
+	Replaced        bool                 `json:"replaced"`
+	Unavailable     bool                 `json:"unavailable"`
+	EndHeight       types.BlockHeight    `json:"endheight"`
+	BlocksRemaining types.BlockHeight    `json:"blocksremaining"`
+}
+
+// HostAuditInfo contains the results of the renter's audits of the pieces
+// stored on a host. Each audit requests a random segment of a piece and
+// checks it against the Merkle root of the piece. Unreachable counts the
+// audits that could not be performed because the renter could not connect to
+// the host. NetAddress is the most recent address of the host.
+type HostAuditInfo struct {
+	HostPublicKey types.SiaPublicKey `json:"hostpublickey"`
+	NetAddress    NetAddress         `json:"netaddress"`
+	Audits        uint64             `json:"audits"`
+	Failures      uint64             `json:"failures"`
+	Unreachable   uint64             `json:"unreachable"`
+	LastAudit     time.Time          `json:"lastaudit"`
+	LastFailure   time.Time          `json:"lastfailure"`
+}
+
+// HostPerformanceInfo describes how quickly a host has served the pieces that
+// the renter downloaded from it. Latency and Throughput are moving averages
+// over the host's recent downloads. Cancelled counts the piece downloads that
+// were cancelled before they began because enough other pieces of the chunk
+// had already arrived. NetAddress is the most recent address of the host.
+type HostPerformanceInfo struct {
+	HostPublicKey types.SiaPublicKey `json:"hostpublickey"`
+	NetAddress    NetAddress         `json:"netaddress"`
+	Downloads     uint64             `json:"downloads"`
+	Failures      uint64             `json:"failures"`
+	Cancelled     uint64             `json:"cancelled"`
+	Latency       uint64             `json:"latency"`    // milliseconds
+	Throughput    uint64             `json:"throughput"` // bytes per second
+	LastDownload  time.Time          `json:"lastdownload"`
+}
+
+// A FileVersionInfo describes an earlier version of a file. Versions are
+// numbered in the order in which they were replaced, and Archived is the time
+// at which the version was replaced.
+type FileVersionInfo struct {
+	Version        uint64    `json:"version"`
+	Filesize       uint64    `json:"filesize"`
+	Available      bool      `json:"available"`
+	UploadProgress float64   `json:"uploadprogress"`
+	Archived       time.Time `json:"archived"`
+}
+
+// A BackupInfo describes the most recent backup of the renter's metadata that
+// was stored on its hosts. NumHosts is the number of hosts that store the
+// backup.
+type BackupInfo struct {
+	Created  time.Time `json:"created"`
+	Size     uint64    `json:"size"`
+	NumHosts uint64    `json:"numhosts"`
+}
+
+// A SnapshotInfo describes a named snapshot of the files in a directory tree.
+// Dir is the directory that the snapshot was taken of, where the empty string
+// is the root directory.
+type SnapshotInfo struct {
+	Name     string    `json:"name"`
+	Dir      string    `json:"dir"`
+	Created  time.Time `json:"created"`
+	NumFiles uint64    `json:"numfiles"`
+	Size     uint64    `json:"size"`
 }
 
 // DownloadInfo provides information about a file that has been requested for
 // download.
 type DownloadInfo struct {
-	SiaPath     string    `json:"siapath"`
-	Destination string    `json:"destination"`
-	Filesize    uint64    `json:"filesize"`
-	Received    uint64    `json:"received"`
-	StartTime   time.Time `json:"starttime"`
+	ID              string    `json:"id"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error"`
+	SiaPath         string    `json:"siapath"`
+	Destination     string    `json:"destination"`
+	DestinationType string    `json:"destinationtype"`
+	Filesize        uint64    `json:"filesize"`
+	Offset          uint64    `json:"offset"`
+	Length          uint64    `json:"length"`
+	Received        uint64    `json:"received"`
+	StartTime       time.Time `json:"starttime"`
 }
 
 // An Allowance dictates how much the Renter is allowed to spend in a given
 // period. Note that funds are spent on both storage and bandwidth.
+//
+// The maximum prices limit what the Renter will pay a host, in the units that
+// hosts announce their prices in. A zero maximum price means that the price
+// is not limited.
 type Allowance struct {
 	Funds       types.Currency    `json:"funds"`
 	Hosts       uint64            `json:"hosts"`
 	Period      types.BlockHeight `json:"period"`
 	RenewWindow types.BlockHeight `json:"renewwindow"`
+
+	MaxContractPrice          types.Currency `json:"maxcontractprice"`
+	MaxDownloadBandwidthPrice types.Currency `json:"maxdownloadbandwidthprice"`
+	MaxStoragePrice           types.Currency `json:"maxstorageprice"`
+	MaxUploadBandwidthPrice   types.Currency `json:"maxuploadbandwidthprice"`
+}
+
+// CheckPrices returns an error if any of the prices in the settings of a host
+// exceed the maximum prices of the allowance.
+func (a Allowance) CheckPrices(s HostExternalSettings) error {
+	if !a.MaxContractPrice.IsZero() && s.ContractPrice.Cmp(a.MaxContractPrice) > 0 {
+		return ErrMaxContractPrice
+	}
+	if err := a.CheckDownloadPrices(s); err != nil {
+		return err
+	}
+	return a.CheckUploadPrices(s)
+}
+
+// CheckDownloadPrices returns an error if the price that a host charges for
+// downloads exceeds the maximum price of the allowance.
+func (a Allowance) CheckDownloadPrices(s HostExternalSettings) error {
+	if !a.MaxDownloadBandwidthPrice.IsZero() && s.DownloadBandwidthPrice.Cmp(a.MaxDownloadBandwidthPrice) > 0 {
+		return ErrMaxDownloadBandwidthPrice
+	}
+	return nil
+}
+
+// CheckUploadPrices returns an error if the prices that a host charges for
+// uploads exceed the maximum prices of the allowance.
+func (a Allowance) CheckUploadPrices(s HostExternalSettings) error {
+	if !a.MaxStoragePrice.IsZero() && s.StoragePrice.Cmp(a.MaxStoragePrice) > 0 {
+		return ErrMaxStoragePrice
+	} else if !a.MaxUploadBandwidthPrice.IsZero() && s.UploadBandwidthPrice.Cmp(a.MaxUploadBandwidthPrice) > 0 {
+		return ErrMaxUploadBandwidthPrice
+	}
+	return nil
+}
+
+// MaxPricesEqual reports whether two allowances have the same maximum prices.
+func (a Allowance) MaxPricesEqual(b Allowance) bool {
+	return a.MaxContractPrice.Equals(b.MaxContractPrice) &&
+		a.MaxDownloadBandwidthPrice.Equals(b.MaxDownloadBandwidthPrice) &&
+		a.MaxStoragePrice.Equals(b.MaxStoragePrice) &&
+		a.MaxUploadBandwidthPrice.Equals(b.MaxUploadBandwidthPrice)
 }
 
 // RenterSettings control the behavior of the Renter.
+//
+// DownloadOverdrive is the number of pieces of each chunk that are downloaded
+// in addition to the minimum needed to recover the chunk. The chunk is
+// recovered from the pieces that arrive first, so that a slow host does not
+// stall the download. A value of zero disables overdrive.
+//
+// MaxDownloadSpeed and MaxUploadSpeed limit the bandwidth, in bytes per
+// second, that the renter uses to download data from hosts and to upload data
+// to hosts. MaxBandwidth limits the combined bandwidth of uploads and
+// downloads. A limit of zero means that the bandwidth is not limited.
+//
+// MaxVersions is the number of earlier versions that are kept for each file,
+// and MaxVersionAge is the number of seconds that an earlier version is kept
+// after it has been replaced. Versions that are still part of a snapshot are
+// kept regardless. A value of zero means that versions are not limited.
+//
+// HostScoreWeights control how the hosts that the renter forms contracts with
+// are scored.
 type RenterSettings struct {
-	Allowance Allowance `json:"allowance"`
+	Allowance         Allowance        `json:"allowance"`
+	DownloadOverdrive uint64           `json:"downloadoverdrive"`
+	MaxBandwidth      uint64           `json:"maxbandwidth"`
+	MaxDownloadSpeed  uint64           `json:"maxdownloadspeed"`
+	MaxUploadSpeed    uint64           `json:"maxuploadspeed"`
+	MaxVersions       uint64           `json:"maxversions"`
+	MaxVersionAge     uint64           `json:"maxversionage"`
+	ChunkCacheSize    uint64           `json:"chunkcachesize"`
+	HostScoreWeights  HostScoreWeights `json:"hostscoreweights"`
+}
+
+// HostScoreWeights are the weights of the factors that make up the score of a
+// host. The score of a host is its price score, which is inversely
+// proportional to its total price raised to the Price weight, multiplied by an
+// adjustment between 0 and 1 for each of the other factors, raised to the
+// weight of that factor. A weight of zero ignores a factor. If every weight is
+// zero, DefaultHostScoreWeights are used.
+type HostScoreWeights struct {
+	Price      float64 `json:"price"`
+	Storage    float64 `json:"storage"`
+	Uptime     float64 `json:"uptime"`
+	Age        float64 `json:"age"`
+	Collateral float64 `json:"collateral"`
+	Version    float64 `json:"version"`
+}
+
+// DefaultHostScoreWeights are the weights used to score hosts unless the
+// renter is configured otherwise.
+var DefaultHostScoreWeights = HostScoreWeights{
+	Price:      5,
+	Storage:    1,
+	Uptime:     3,
+	Age:        1,
+	Collateral: 1,
+	Version:    1,
+}
+
+// A HostScoreBreakdown explains the score of a host. Score is PriceScore
+// multiplied by each of the adjustments, which have already been raised to
+// the weights of their factors.
+type HostScoreBreakdown struct {
+	Score      types.Currency `json:"score"`
+	PriceScore types.Currency `json:"pricescore"`
+
+	StorageRemainingAdjustment float64 `json:"storageremainingadjustment"`
+	UptimeAdjustment           float64 `json:"uptimeadjustment"`
+	AgeAdjustment              float64 `json:"ageadjustment"`
+	CollateralAdjustment       float64 `json:"collateraladjustment"`
+	VersionAdjustment          float64 `json:"versionadjustment"`
+}
+
+// ChunkCacheStats describes the renter's cache of recovered chunks. Hits and
+// Misses count the chunks of downloads that were and were not found in the
+// cache since the renter started, and HitRate is the fraction of lookups that
+// were hits.
+type ChunkCacheStats struct {
+	Chunks  uint64  `json:"chunks"`
+	Size    uint64  `json:"size"`
+	MaxSize uint64  `json:"maxsize"`
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hitrate"`
+}
+
+// RenterThroughput is the bandwidth, in bytes per second, that the renter has
+// recently used to download data from hosts and to upload data to hosts.
+type RenterThroughput struct {
+	Download uint64 `json:"download"`
+	Upload   uint64 `json:"upload"`
 }
 
 // A HostDBEntry represents one host entry in the Renter's host DB. It
@@ -90,6 +430,38 @@ type HostDBEntry struct {
 	ScanHistory HostDBScans
 	// FirstSeen is the last block height at which this host was announced.
 	FirstSeen types.BlockHeight
+	// IPNets are the subnets (/24 for IPv4, /54 for IPv6) of the addresses
+	// that the NetAddress of the host resolved to when it was last scanned.
+	// No more than one host per subnet is selected for contracts.
+	IPNets []string `json:"ipnets"`
+}
+
+// SharesIPNet reports whether the host is in any of the subnets in ipnets.
+func (he HostDBEntry) SharesIPNet(ipnets map[string]struct{}) bool {
+	for _, ipnet := range he.IPNets {
+		if _, exists := ipnets[ipnet]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// HostDBFilterDisabled, HostDBFilterBlacklist, and HostDBFilterWhitelist are
+// the modes of a HostDBFilter.
+const (
+	HostDBFilterDisabled  = "disabled"
+	HostDBFilterBlacklist = "blacklist"
+	HostDBFilterWhitelist = "whitelist"
+)
+
+// A HostDBFilter restricts the hosts that the renter forms contracts with. In
+// blacklist mode the listed hosts are never used, and in whitelist mode only
+// the listed hosts are used. Hosts are listed by public key (e.g.
+// "ed25519:<hex>"), by NetAddress, or by IP subnet in CIDR notation. The list
+// is kept, but ignored, while the filter is disabled.
+type HostDBFilter struct {
+	Mode  string   `json:"mode"`
+	Hosts []string `json:"hosts"`
 }
 
 // HostDBScan represents a single scan event.
@@ -109,6 +481,7 @@ func (s HostDBScans) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 // file contract.
 type RenterContract struct {
 	FileContract    types.FileContract         `json:"filecontract"`
+	HostPublicKey   types.SiaPublicKey         `json:"hostpublickey"`
 	ID              types.FileContractID       `json:"id"`
 	LastRevision    types.FileContractRevision `json:"lastrevision"`
 	LastRevisionTxn types.Transaction          `json:"lastrevisiontxn"`
@@ -153,9 +526,16 @@ type Renter interface {
 	// AllHosts returns the full list of hosts known to the renter.
 	AllHosts() []HostDBEntry
 
+	// Backup returns information on the most recent backup of the renter's
+	// metadata that was stored on its hosts.
+	Backup() BackupInfo
+
 	// Close closes the Renter.
 	Close() error
 
+	// CancelDownload cancels an unfinished download.
+	CancelDownload(id string) error
+
 	// Contracts returns the contracts formed by the renter.
 	Contracts() []RenterContract
 
@@ -163,18 +543,88 @@ type Renter interface {
 	// began.
 	CurrentPeriod() types.BlockHeight
 
+	// CreateBackup creates an encrypted backup of the renter's metadata. The
+	// backup is written to destination, or stored on the renter's hosts if
+	// destination is empty.
+	CreateBackup(destination string) error
+
+	// CreateDir creates an empty directory in the renter.
+	CreateDir(siaPath string) error
+
+	// CreateSnapshot records the current version of every file in a
+	// directory tree under the given name.
+	CreateSnapshot(name, dir string) error
+
+	// DeleteDir deletes a directory, along with every file and directory
+	// inside of it, from the renter.
+	DeleteDir(siaPath string) error
+
 	// DeleteFile deletes a file entry from the renter.
 	DeleteFile(path string) error
 
+	// DeleteSnapshot deletes a snapshot. Files that are no longer part of
+	// any snapshot or version are deleted from the hosts.
+	DeleteSnapshot(name string) error
+
+	// DeleteVersion deletes an earlier version of a file.
+	DeleteVersion(siaPath string, version uint64) error
+
+	// DirList returns information on a directory followed by its immediate
+	// subdirectories, along with the files stored directly in the directory.
+	DirList(siaPath string) ([]DirectoryInfo, []FileInfo, error)
+
 	// Download downloads a file to the given destination.
 	Download(path, destination string) error
 
+	// DownloadSection downloads length bytes of a file, starting at offset,
+	// and writes them to w in order.
+	DownloadSection(path string, w io.Writer, offset, length uint64) error
+
 	// DownloadQueue lists all the files that have been scheduled for download.
 	DownloadQueue() []DownloadInfo
 
+	// DownloadSnapshotFile downloads the version of a file that is part of a
+	// snapshot to the given destination.
+	DownloadSnapshotFile(name, siaPath, destination string) error
+
+	// DownloadVersion downloads an earlier version of a file to the given
+	// destination.
+	DownloadVersion(siaPath string, version uint64, destination string) error
+
+	// File returns information on the file stored at siaPath.
+	File(siaPath string) (FileInfo, error)
+
+	// FileHealth returns the locations of the pieces of each chunk of a
+	// file.
+	FileHealth(siaPath string) ([]ChunkHealth, error)
+
 	// FileList returns information on all of the files stored by the renter.
 	FileList() []FileInfo
 
+	// FilterFiles returns a page of the files that match a filter, along
+	// with the total number of matching files.
+	FilterFiles(FileFilter) (files []FileInfo, total int)
+
+	// FileVersions returns information on the earlier versions of a file,
+	// from oldest to newest.
+	FileVersions(siaPath string) ([]FileVersionInfo, error)
+
+	// HostAudits returns the results of the audits of the pieces stored on
+	// each host.
+	HostAudits() []HostAuditInfo
+
+	// Host returns the entry of the host with the given public key in the
+	// host database.
+	Host(types.SiaPublicKey) (HostDBEntry, bool)
+
+	// HostDBFilter returns the filter that restricts the hosts that the
+	// renter forms contracts with.
+	HostDBFilter() HostDBFilter
+
+	// HostPerformance returns the performance of each host that the renter
+	// has downloaded from.
+	HostPerformance() []HostPerformanceInfo
+
 	// LoadSharedFiles loads a '.sia' file into the renter. A .sia file may
 	// contain multiple files. The paths of the added files are returned.
 	LoadSharedFiles(source string) ([]string, error)
@@ -183,12 +633,54 @@ type Renter interface {
 	// renter.
 	LoadSharedFilesAscii(asciiSia string) ([]string, error)
 
+	// PauseDownload stops an unfinished download from fetching more data
+	// until it is resumed.
+	PauseDownload(id string) error
+
+	// RecoverBackup restores the renter's contracts and files from the
+	// backup at source, or from the most recent backup stored on the hosts
+	// of the renter if source is empty.
+	RecoverBackup(source string) error
+
+	// RenameDir changes the path of a directory, along with every file and
+	// directory inside of it.
+	RenameDir(siaPath, newSiaPath string) error
+
 	// RenameFile changes the path of a file.
 	RenameFile(path, newPath string) error
 
+	// RestoreSnapshot makes the version of each file in a snapshot the
+	// current version of the file. Files that are replaced are kept as
+	// earlier versions.
+	RestoreSnapshot(name string) error
+
+	// RestoreVersion makes an earlier version of a file the current version.
+	// The file that is replaced is kept as an earlier version.
+	RestoreVersion(siaPath string, version uint64) error
+
+	// ResumeDownload resumes a paused download.
+	ResumeDownload(id string) error
+
+	// ScoreBreakdown returns the score of a host and the contribution of each
+	// factor to it.
+	ScoreBreakdown(HostDBEntry) HostScoreBreakdown
+
 	// Settings returns the Renter's current settings.
 	Settings() RenterSettings
 
+	// SetFileExpiration sets the height at which a file expires. A height of
+	// 0 keeps the file forever.
+	SetFileExpiration(siaPath string, height types.BlockHeight) error
+
+	// SetHostDBFilter sets the filter that restricts the hosts that the
+	// renter forms contracts with. Contracts with hosts that the filter
+	// excludes are not renewed, and their data is moved to other hosts.
+	SetHostDBFilter(HostDBFilter) error
+
+	// SetFileMetadata sets the metadata of a file. Keys with an empty value
+	// are removed from the metadata.
+	SetFileMetadata(siaPath string, metadata map[string]string) error
+
 	// SetSettings sets the Renter's settings.
 	SetSettings(RenterSettings) error
 
@@ -198,6 +690,30 @@ type Renter interface {
 	// ShareFilesAscii creates an ASCII-encoded '.sia' file.
 	ShareFilesAscii(paths []string) (asciiSia string, err error)
 
+	// SnapshotFiles returns information on the files in a snapshot.
+	SnapshotFiles(name string) ([]FileInfo, error)
+
+	// Snapshots returns information on each snapshot.
+	Snapshots() []SnapshotInfo
+
+	// Throughput returns the bandwidth that the renter has recently used to
+	// transfer data to and from hosts.
+	Throughput() RenterThroughput
+
+	// ChunkCacheStats returns the size of the cache of recovered chunks and
+	// how often chunks were served from it.
+	ChunkCacheStats() ChunkCacheStats
+
+	// UpdateFile writes the data read from a reader into an uploaded file at
+	// the given offset, replacing only the pieces of the chunks that the data
+	// overlaps.
+	UpdateFile(siaPath string, offset uint64, reader io.Reader) error
+
 	// Upload uploads a file using the input parameters.
 	Upload(FileUploadParams) error
+
+	// UploadStreamFromReader uploads the data read from a reader to the
+	// siapath given in the input parameters. The source parameter is
+	// ignored.
+	UploadStreamFromReader(up FileUploadParams, reader io.Reader) error
 }
@@ -0,0 +1,311 @@
+package renter
+
+// The auditor periodically checks that hosts are still storing the pieces
+// that were uploaded to them. For a random sample of the pieces stored under
+// each contract, it requests a random segment of the piece along with a Merkle
+// proof, and verifies the segment against the Merkle root of the piece. Pieces
+// that fail an audit are marked as unavailable, which causes the repair loop
+// to upload them to another host.
+//
+// A segment that does not match its proof shows that the host has lost or
+// corrupted the piece, which is marked as unavailable right away. A host that
+// rejects a download request closes the download loop, however, so the
+// auditor cannot tell a host that lost a piece apart from a host that dropped
+// the connection mid-audit. A request that fails is counted against the
+// piece, which is audited first on the following audits of the contract, and
+// the piece is only marked as unavailable once its requests have failed
+// auditMaxRequestFailures times in a row. Until then, the host is recorded as
+// unreachable rather than as failing the audit.
+
+import (
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// auditInterval is the amount of time that the auditor waits between
+	// audits of the hosts.
+	auditInterval = build.Select(build.Var{
+		Standard: time.Hour,
+		Dev:      10 * time.Minute,
+		Testing:  2 * time.Second,
+	}).(time.Duration)
+
+	// auditPiecesPerContract is the number of randomly selected pieces that
+	// are audited on each contract during an audit.
+	auditPiecesPerContract = build.Select(build.Var{
+		Standard: 4,
+		Dev:      4,
+		Testing:  10,
+	}).(int)
+
+	// auditMaxRequestFailures is the number of audits in a row in which the
+	// request for a piece must fail before the piece is marked as
+	// unavailable.
+	auditMaxRequestFailures = build.Select(build.Var{
+		Standard: 3,
+		Dev:      3,
+		Testing:  2,
+	}).(int)
+)
+
+// An auditTarget is a piece of a file that can be audited.
+type auditTarget struct {
+	file  *file
+	piece pieceData
+}
+
+// hostAuditsByAddress implements sort.Interface for a slice of HostAuditInfo,
+// sorting by the address of the host.
+type hostAuditsByAddress []modules.HostAuditInfo
+
+func (ha hostAuditsByAddress) Len() int           { return len(ha) }
+func (ha hostAuditsByAddress) Less(i, j int) bool { return ha[i].NetAddress < ha[j].NetAddress }
+func (ha hostAuditsByAddress) Swap(i, j int)      { ha[i], ha[j] = ha[j], ha[i] }
+
+// managedAuditTargets returns the pieces that have not yet been marked as
+// unavailable, grouped by the contract that stores them, along with the
+// public key of the host of each contract.
+func (r *Renter) managedAuditTargets() (map[types.FileContractID][]auditTarget, map[types.FileContractID]types.SiaPublicKey) {
+	// Packed files are audited through their packs.
+	id := r.mu.RLock()
+	var files []*file
+	for _, f := range r.files {
+		if f.pack == nil {
+			files = append(files, f)
+		}
+	}
+	for _, p := range r.packs {
+		files = append(files, p)
+	}
+	r.mu.RUnlock(id)
+
+	targets := make(map[types.FileContractID][]auditTarget)
+	hosts := make(map[types.FileContractID]types.SiaPublicKey)
+	for _, f := range files {
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			for _, p := range fc.Pieces {
+				if !p.Unavailable {
+					targets[fc.ID] = append(targets[fc.ID], auditTarget{file: f, piece: p})
+				}
+			}
+			hosts[fc.ID] = fc.HostPublicKey
+		}
+		f.mu.RUnlock()
+	}
+	return targets, hosts
+}
+
+// managedAuditContract audits a random sample of the pieces stored under a
+// contract.
+func (r *Renter) managedAuditContract(id types.FileContractID, hostKey types.SiaPublicKey, targets []auditTarget) {
+	if r.hostContractor.IsOffline(id) {
+		r.managedRecordAudit(hostKey, false, true)
+		return
+	}
+	perm, err := crypto.Perm(len(targets))
+	if err != nil {
+		r.log.Println("WARN: could not select pieces to audit:", err)
+		return
+	}
+	perm = r.managedAuditOrder(targets, perm)
+	if len(perm) > auditPiecesPerContract {
+		perm = perm[:auditPiecesPerContract]
+	}
+
+	d, err := r.hostContractor.Downloader(id)
+	if err != nil {
+		r.log.Debugln("Unable to audit", hostKey.String(), "::", err)
+		r.managedRecordAudit(hostKey, false, true)
+		return
+	}
+	defer d.Close()
+
+	numSegments := modules.SectorSize / crypto.SegmentSize
+	for _, i := range perm {
+		select {
+		case <-r.tg.StopChan():
+			return
+		default:
+		}
+		if err := r.managedWaitDownload(crypto.SegmentSize); err != nil {
+			return
+		}
+		index, err := crypto.RandIntn(int(numSegments))
+		if err != nil {
+			r.log.Println("WARN: could not select segment to audit:", err)
+			return
+		}
+
+		root := targets[i].piece.MerkleRoot
+		segment, hashSet, err := d.Segment(root, uint64(index))
+		if err == modules.ErrNoRangeProof {
+			// The host predates range proofs and cannot be audited.
+			r.log.Debugln("Unable to audit", hostKey.String(), "::", err)
+			return
+		}
+		if err == nil {
+			r.bandwidth.downloadMeter.record(uint64(len(segment)))
+		}
+		if err == nil && crypto.VerifySegment(segment, hashSet, numSegments, uint64(index), root) {
+			r.managedClearRequestFailures(root)
+			r.managedRecordAudit(hostKey, false, false)
+			continue
+		}
+
+		// The request failed, or the segment did not match its proof. The
+		// host ends the download loop after rejecting a request, so the
+		// remaining pieces are audited later.
+		if err != nil {
+			failures := r.managedRecordRequestFailure(root)
+			r.log.Printf("Host %v could not serve piece %v of chunk %v of %v for an audit (%v in a row): %v", hostKey.String(), targets[i].piece.Piece, targets[i].piece.Chunk, targets[i].file.name, failures, err)
+			if failures < auditMaxRequestFailures {
+				r.managedRecordAudit(hostKey, false, true)
+				return
+			}
+		} else {
+			r.log.Printf("Host %v failed an audit of piece %v of chunk %v of %v: invalid proof", hostKey.String(), targets[i].piece.Piece, targets[i].piece.Chunk, targets[i].file.name)
+		}
+		r.managedClearRequestFailures(root)
+		r.managedRecordAudit(hostKey, true, false)
+		r.managedMarkUnavailable(targets[i].file, id, targets[i].piece)
+		return
+	}
+}
+
+// managedAuditOrder reorders perm, a permutation of the indices of targets,
+// so that the pieces whose requests failed during earlier audits are audited
+// first.
+func (r *Renter) managedAuditOrder(targets []auditTarget, perm []int) []int {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	order := make([]int, 0, len(perm))
+	for _, i := range perm {
+		if r.auditFailures[targets[i].piece.MerkleRoot] > 0 {
+			order = append(order, i)
+		}
+	}
+	for _, i := range perm {
+		if r.auditFailures[targets[i].piece.MerkleRoot] == 0 {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// managedRecordRequestFailure records that the request for the piece with
+// the given Merkle root failed during an audit, and returns the number of
+// audits in a row in which it has failed.
+func (r *Renter) managedRecordRequestFailure(root crypto.Hash) int {
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.auditFailures[root]++
+	return r.auditFailures[root]
+}
+
+// managedClearRequestFailures forgets the failed requests for the piece with
+// the given Merkle root, once the piece has passed or failed an audit.
+func (r *Renter) managedClearRequestFailures(root crypto.Hash) {
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	delete(r.auditFailures, root)
+}
+
+// managedMarkUnavailable marks a piece stored under a contract as
+// unavailable and queues the file for repair.
+func (r *Renter) managedMarkUnavailable(f *file, contractID types.FileContractID, piece pieceData) {
+	id := r.mu.Lock()
+	f.mu.Lock()
+	if fc, ok := f.contracts[contractID]; ok {
+		for i, p := range fc.Pieces {
+			if p.Chunk == piece.Chunk && p.Piece == piece.Piece && p.MerkleRoot == piece.MerkleRoot {
+				fc.Pieces[i].Unavailable = true
+			}
+		}
+	}
+	// The file is not saved if it was deleted during the audit.
+	r.persistFile(f)
+	f.mu.Unlock()
+	if len(f.chunkHashes) != 0 {
+		r.dropDedupPiece(f, contractID, piece)
+	}
+	r.mu.Unlock(id)
+
+	select {
+	case r.newRepairs <- f:
+	case <-r.tg.StopChan():
+	}
+}
+
+// managedRecordAudit records the result of an audit of the host with public
+// key hostKey.
+func (r *Renter) managedRecordAudit(hostKey types.SiaPublicKey, failed, unreachable bool) {
+	host, _ := r.hostDB.Host(hostKey)
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	info := r.audits[hostKey.String()]
+	info.HostPublicKey = hostKey
+	if host.NetAddress != "" {
+		info.NetAddress = host.NetAddress
+	}
+	if unreachable {
+		info.Unreachable++
+		r.audits[hostKey.String()] = info
+		return
+	}
+	info.Audits++
+	info.LastAudit = time.Now()
+	if failed {
+		info.Failures++
+		info.LastFailure = info.LastAudit
+	}
+	r.audits[hostKey.String()] = info
+}
+
+// managedAudit audits each of the renter's contracts, and then saves the
+// results.
+func (r *Renter) managedAudit() {
+	targets, hosts := r.managedAuditTargets()
+	for id, pieces := range targets {
+		r.managedAuditContract(id, hosts[id], pieces)
+	}
+
+	id := r.mu.Lock()
+	err := r.saveSync()
+	r.mu.Unlock(id)
+	if err != nil {
+		r.log.Println("WARN: could not save the audit results:", err)
+	}
+}
+
+// threadedAuditLoop periodically audits the pieces stored on the renter's
+// hosts.
+func (r *Renter) threadedAuditLoop() {
+	for {
+		select {
+		case <-time.After(auditInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+		r.managedAudit()
+	}
+}
+
+// HostAudits returns the results of the audits of the pieces stored on each
+// host.
+func (r *Renter) HostAudits() []modules.HostAuditInfo {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	audits := make([]modules.HostAuditInfo, 0, len(r.audits))
+	for _, info := range r.audits {
+		audits = append(audits, info)
+	}
+	sort.Sort(hostAuditsByAddress(audits))
+	return audits
+}
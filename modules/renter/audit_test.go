@@ -0,0 +1,143 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestMarkUnavailable checks that pieces that failed an audit are no longer
+// counted towards the health of their file, and that the flag survives
+// marshalling.
+func TestMarkUnavailable(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestMarkUnavailable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Put a file of one chunk in the renter, with each of its pieces stored
+	// on a different host.
+	rsc, _ := NewRSCode(1, 1)
+	f := newFile("foo", rsc, pieceSize, pieceSize)
+	lost := pieceData{Chunk: 0, Piece: 1, MerkleRoot: crypto.Hash{1}}
+	f.contracts[types.FileContractID{1}] = fileContract{
+		ID:            types.FileContractID{1},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("foo")},
+		Pieces:        []pieceData{lost},
+	}
+	f.contracts[types.FileContractID{2}] = fileContract{
+		ID:            types.FileContractID{2},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("bar")},
+		Pieces:        []pieceData{{Chunk: 0, Piece: 0, MerkleRoot: crypto.Hash{2}}},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.addFileEntry(f.name, f)
+	rt.renter.mu.Unlock(id)
+
+	rt.renter.managedMarkUnavailable(f, types.FileContractID{1}, lost)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if !f.contracts[types.FileContractID{1}].Pieces[0].Unavailable {
+		t.Fatal("piece was not marked as unavailable")
+	}
+	if f.contracts[types.FileContractID{2}].Pieces[0].Unavailable {
+		t.Fatal("wrong piece was marked as unavailable")
+	}
+	if !f.available() {
+		t.Error("file should still be available")
+	}
+	if f.numChunkPieces(0) != 1 {
+		t.Error("expected 1 piece, got", f.numChunkPieces(0))
+	}
+	if p := f.uploadProgress(); p != 50 {
+		t.Error("expected 50% upload progress, got", p)
+	}
+
+	// The flag should survive marshalling.
+	buf := new(bytes.Buffer)
+	if err := f.MarshalSia(buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(file)
+	if err := loaded.UnmarshalSia(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.contracts[types.FileContractID{1}].Pieces[0].Unavailable {
+		t.Error("unavailable flag was lost by marshalling")
+	}
+}
+
+// TestHostAudits checks that audit results are recorded per host.
+func TestHostAudits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestHostAudits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	fooKey := types.SiaPublicKey{Key: []byte("foo")}
+	barKey := types.SiaPublicKey{Key: []byte("bar")}
+	rt.renter.managedRecordAudit(fooKey, false, false)
+	rt.renter.managedRecordAudit(fooKey, true, false)
+	rt.renter.managedRecordAudit(barKey, false, false)
+	rt.renter.managedRecordAudit(barKey, false, true)
+
+	audits := rt.renter.HostAudits()
+	if len(audits) != 2 {
+		t.Fatal("expected 2 hosts, got", len(audits))
+	}
+	bar, foo := audits[0], audits[1]
+	if string(bar.HostPublicKey.Key) != "bar" {
+		bar, foo = foo, bar
+	}
+	if string(bar.HostPublicKey.Key) != "bar" || bar.Audits != 1 || bar.Failures != 0 || bar.Unreachable != 1 || bar.LastAudit.IsZero() || !bar.LastFailure.IsZero() {
+		t.Error("wrong audit results for bar:", bar)
+	}
+	if string(foo.HostPublicKey.Key) != "foo" || foo.Audits != 2 || foo.Failures != 1 || foo.Unreachable != 0 || foo.LastFailure.IsZero() {
+		t.Error("wrong audit results for foo:", foo)
+	}
+}
+
+// TestAuditRequestFailures checks that failed audit requests are counted per
+// piece, and that pieces with failed requests are audited first.
+func TestAuditRequestFailures(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestAuditRequestFailures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	targets := make([]auditTarget, 4)
+	for i := range targets {
+		targets[i].piece.MerkleRoot[0] = byte(i)
+	}
+	suspect := targets[2].piece.MerkleRoot
+
+	for i := 1; i <= auditMaxRequestFailures; i++ {
+		if failures := rt.renter.managedRecordRequestFailure(suspect); failures != i {
+			t.Fatalf("expected %v failures, got %v", i, failures)
+		}
+	}
+	order := rt.renter.managedAuditOrder(targets, []int{0, 1, 2, 3})
+	if len(order) != 4 || order[0] != 2 || order[1] != 0 || order[2] != 1 || order[3] != 3 {
+		t.Fatal("piece with failed requests was not audited first:", order)
+	}
+
+	rt.renter.managedClearRequestFailures(suspect)
+	if failures := rt.renter.managedRecordRequestFailure(suspect); failures != 1 {
+		t.Fatal("failures were not cleared:", failures)
+	}
+}
@@ -0,0 +1,674 @@
+package renter
+
+// The renter periodically backs up its metadata to its hosts, so that the
+// files of a renter can be recovered from the wallet seed alone. A backup
+// contains the renter's files, packs, tracking data, and directories, along
+// with its allowance and contracts. Earlier versions and snapshots of files
+// are not backed up. The backup is encrypted with a key derived from the
+// wallet seed.
+//
+// The backup is stored on at most backupHosts hosts. Each of them stores the
+// encrypted backup in sectors appended to the renter's contract, followed by a
+// marker sector and an encrypted index of the backup sectors. The marker is
+// derived from the backup key and the public key of the host, so a renter
+// that has lost its metadata can locate the index among the sector roots of a
+// contract without downloading any sectors. Later backups overwrite the index
+// in place, so the sectors of the renter's files are never moved. A renter
+// recovers its contracts from the blockchain (see
+// contractor.RecoverContracts), reads the index that follows the marker in
+// each contract, and restores the most recent backup that it can decrypt.
+//
+// Backups can also be exported to a local file, which is encrypted with the
+// same key.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// backupFilename is the name of the file that records where the most
+	// recent backup is stored on the hosts.
+	backupFilename = "backup.json"
+
+	// backupHosts is the maximum number of hosts that store a backup.
+	backupHosts = 3
+)
+
+var (
+	// backupInterval is the amount of time that the renter waits between
+	// backups of its metadata to its hosts.
+	backupInterval = build.Select(build.Var{
+		Standard: 24 * time.Hour,
+		Dev:      10 * time.Minute,
+		Testing:  time.Hour,
+	}).(time.Duration)
+
+	// backupFileSpecifier is the header of an exported backup file.
+	backupFileSpecifier = types.Specifier{'r', 'e', 'n', 't', 'e', 'r', ' ', 'b', 'a', 'c', 'k', 'u', 'p'}
+
+	// backupKeySpecifier is used to derive the key of backups from the wallet
+	// seed.
+	backupKeySpecifier = types.Specifier{'b', 'a', 'c', 'k', 'u', 'p', ' ', 'k', 'e', 'y'}
+
+	// backupMarkerSpecifier is used to derive the marker that precedes the
+	// backup index on each host.
+	backupMarkerSpecifier = types.Specifier{'b', 'a', 'c', 'k', 'u', 'p', ' ', 'm', 'a', 'r', 'k', 'e', 'r'}
+
+	// backupMetadata is the header of the backup file.
+	backupMetadata = persist.Metadata{
+		Header:  "Renter Backup",
+		Version: "1.0",
+	}
+
+	// errBadBackup is returned when a backup cannot be read.
+	errBadBackup = errors.New("not a renter backup, or the backup was created with a different seed")
+
+	// errNoBackup is returned when none of the hosts of the renter store a
+	// backup.
+	errNoBackup = errors.New("no backup could be found on the hosts")
+
+	// errNoBackupHosts is returned when a backup could not be stored on any
+	// host.
+	errNoBackupHosts = errors.New("the backup could not be stored on any host")
+)
+
+type (
+	// backupData is the renter metadata contained in a backup. Files and
+	// Packs hold the .sia data of each file and pack.
+	backupData struct {
+		Allowance     modules.Allowance
+		Contracts     []modules.RenterContract
+		Created       time.Time
+		CurrentPeriod types.BlockHeight
+		Directories   map[string]struct{}
+		Files         [][]byte
+		Packs         [][]byte
+		Tracking      map[string]trackedFile
+	}
+
+	// A backupIndex is stored in the sector that follows the backup marker in
+	// each contract that holds a backup. It records the sectors that hold the
+	// encrypted backup, and the size of the encrypted backup.
+	backupIndex struct {
+		Created time.Time
+		Size    uint64
+		Roots   []crypto.Hash
+	}
+
+	// A backupLocation records the sectors of a backup stored on a host.
+	backupLocation struct {
+		Index crypto.Hash
+		Data  []crypto.Hash
+	}
+
+	// A backupRecord records the hosts that store the most recent backup.
+	// Locations is indexed by the public key of the host.
+	backupRecord struct {
+		Created   time.Time
+		Size      uint64
+		Locations map[string]backupLocation
+	}
+
+	// A foundBackup is a backup index that was read from a host.
+	foundBackup struct {
+		contract modules.RenterContract
+		index    backupIndex
+	}
+
+	// backupsByAge implements sort.Interface for a slice of
+	// foundBackups, sorting the most recent backup first.
+	backupsByAge []foundBackup
+)
+
+func (b backupsByAge) Len() int           { return len(b) }
+func (b backupsByAge) Less(i, j int) bool { return b[i].index.Created.After(b[j].index.Created) }
+func (b backupsByAge) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// backupKey returns the key of the renter's backups, which is derived from
+// the primary seed of the wallet. The wallet must be unlocked.
+func (r *Renter) backupKey() (crypto.TwofishKey, error) {
+	seed, _, err := r.wallet.PrimarySeed()
+	if err != nil {
+		return crypto.TwofishKey{}, err
+	}
+	return crypto.TwofishKey(crypto.HashAll(seed, backupKeySpecifier)), nil
+}
+
+// encryptBackup encodes v as compressed JSON and encrypts it with key.
+func encryptBackup(key crypto.TwofishKey, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	zip := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zip).Encode(v); err != nil {
+		return nil, err
+	}
+	if err := zip.Close(); err != nil {
+		return nil, err
+	}
+	return key.EncryptBytes(buf.Bytes())
+}
+
+// decryptBackup decrypts ciphertext with key and decodes the result into v.
+func decryptBackup(key crypto.TwofishKey, ciphertext []byte, v interface{}) error {
+	plaintext, err := key.DecryptBytes(ciphertext)
+	if err != nil {
+		return errBadBackup
+	}
+	unzip, err := gzip.NewReader(bytes.NewReader(plaintext))
+	if err != nil {
+		return errBadBackup
+	}
+	if err := json.NewDecoder(unzip).Decode(v); err != nil {
+		return errBadBackup
+	}
+	return nil
+}
+
+// backupSectors splits the encrypted backup into sectors, padding the last
+// sector with zeros.
+func backupSectors(ciphertext []byte) [][]byte {
+	var sectors [][]byte
+	for len(ciphertext) > 0 {
+		sector := make([]byte, modules.SectorSize)
+		n := copy(sector, ciphertext)
+		ciphertext = ciphertext[n:]
+		sectors = append(sectors, sector)
+	}
+	return sectors
+}
+
+// backupMarker returns the sector that precedes the backup index on the host
+// with the given public key.
+func backupMarker(key crypto.TwofishKey, hostKey types.SiaPublicKey) []byte {
+	sector := make([]byte, modules.SectorSize)
+	marker := crypto.HashAll(key, backupMarkerSpecifier, hostKey)
+	copy(sector, marker[:])
+	return sector
+}
+
+// findBackupIndex returns the root of the backup index in roots, which is the
+// sector that follows the last occurrence of the marker root.
+func findBackupIndex(roots []crypto.Hash, markerRoot crypto.Hash) (crypto.Hash, bool) {
+	for i := len(roots) - 2; i >= 0; i-- {
+		if roots[i] == markerRoot {
+			return roots[i+1], true
+		}
+	}
+	return crypto.Hash{}, false
+}
+
+// indexSector returns the sector that stores an encrypted backup index. The
+// ciphertext is prefixed with its length and padded with zeros.
+func indexSector(key crypto.TwofishKey, index backupIndex) ([]byte, error) {
+	ciphertext, err := encryptBackup(key, index)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(ciphertext))+8 > modules.SectorSize {
+		return nil, errors.New("backup index does not fit in a sector")
+	}
+	sector := make([]byte, modules.SectorSize)
+	copy(sector, encoding.EncUint64(uint64(len(ciphertext))))
+	copy(sector[8:], ciphertext)
+	return sector, nil
+}
+
+// readIndexSector decrypts the backup index stored in sector. It returns
+// errBadBackup if the sector does not store a backup index.
+func readIndexSector(key crypto.TwofishKey, sector []byte) (backupIndex, error) {
+	var index backupIndex
+	if len(sector) < 8 {
+		return index, errBadBackup
+	}
+	n := encoding.DecUint64(sector[:8])
+	if n > uint64(len(sector)-8) {
+		return index, errBadBackup
+	}
+	err := decryptBackup(key, sector[8:8+n], &index)
+	return index, err
+}
+
+// writeBackupFile writes an encrypted backup to path.
+func writeBackupFile(path string, ciphertext []byte) error {
+	handle, err := persist.NewSafeFile(path)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	if _, err := handle.Write(backupFileSpecifier[:]); err != nil {
+		return err
+	}
+	if _, err := handle.Write(ciphertext); err != nil {
+		return err
+	}
+	return handle.Commit()
+}
+
+// readBackupFile reads an encrypted backup from path.
+func readBackupFile(path string) ([]byte, error) {
+	handle, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	var specifier types.Specifier
+	if _, err := io.ReadFull(handle, specifier[:]); err != nil || specifier != backupFileSpecifier {
+		return nil, errBadBackup
+	}
+	return ioutil.ReadAll(handle)
+}
+
+// saveBackup saves the record of the most recent backup stored on the hosts.
+func (r *Renter) saveBackup() error {
+	return persist.SaveFileSync(backupMetadata, r.backup, filepath.Join(r.persistDir, backupFilename))
+}
+
+// loadBackup loads the record of the most recent backup stored on the hosts.
+func (r *Renter) loadBackup() error {
+	err := persist.LoadFile(backupMetadata, &r.backup, filepath.Join(r.persistDir, backupFilename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// managedBackupData collects the renter metadata that is backed up.
+func (r *Renter) managedBackupData() (backupData, error) {
+	data := backupData{
+		Allowance:     r.hostContractor.Allowance(),
+		Contracts:     r.hostContractor.Contracts(),
+		Created:       time.Now(),
+		CurrentPeriod: r.hostContractor.CurrentPeriod(),
+		Directories:   make(map[string]struct{}),
+		Tracking:      make(map[string]trackedFile),
+	}
+
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	share := func(f *file) ([]byte, error) {
+		var buf bytes.Buffer
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+		err := shareFiles([]*file{f}, &buf)
+		return buf.Bytes(), err
+	}
+	for _, f := range r.files {
+		b, err := share(f)
+		if err != nil {
+			return backupData{}, err
+		}
+		data.Files = append(data.Files, b)
+	}
+	for _, p := range r.packs {
+		b, err := share(p)
+		if err != nil {
+			return backupData{}, err
+		}
+		data.Packs = append(data.Packs, b)
+	}
+	for siaPath, tf := range r.tracking {
+		data.Tracking[siaPath] = tf
+	}
+	for dir := range r.dirs {
+		data.Directories[dir] = struct{}{}
+	}
+	return data, nil
+}
+
+// managedUploadBackupTo stores the sectors of a backup on the host of a
+// contract, followed by the index of the backup. If the contract holds the
+// index of the previous backup, the index is overwritten in place; otherwise
+// the marker and the index are appended to the contract. The sectors of the
+// previous backup are deleted once the new backup is stored.
+func (r *Renter) managedUploadBackupTo(contract modules.RenterContract, marker, index []byte, sectors [][]byte, prev backupLocation) (backupLocation, error) {
+	editor, err := r.hostContractor.Editor(contract.ID)
+	if err != nil {
+		return backupLocation{}, err
+	}
+	defer editor.Close()
+
+	var loc backupLocation
+	for _, sector := range sectors {
+		root, err := editor.Upload(sector)
+		if err != nil {
+			return backupLocation{}, err
+		}
+		loc.Data = append(loc.Data, root)
+	}
+	loc.Index = crypto.MerkleRoot(index)
+	if prevIndex, ok := findBackupIndex(contract.MerkleRoots, crypto.MerkleRoot(marker)); ok && prevIndex == prev.Index {
+		err = editor.Modify(prev.Index, loc.Index, 0, index)
+	} else {
+		if _, err = editor.Upload(marker); err == nil {
+			_, err = editor.Upload(index)
+		}
+	}
+	if err != nil {
+		return backupLocation{}, err
+	}
+
+	// Delete the sectors of the previous backup. A host that fails to delete
+	// the sectors keeps them until the contract expires.
+	current := make(map[crypto.Hash]struct{})
+	for _, root := range loc.Data {
+		current[root] = struct{}{}
+	}
+	for _, root := range prev.Data {
+		if _, exists := current[root]; exists {
+			continue
+		}
+		if err := editor.Delete(root); err != nil {
+			r.log.Debugln("Unable to delete backup sector from", contract.NetAddress, "::", err)
+			continue
+		}
+	}
+	return loc, nil
+}
+
+// managedUploadBackup stores an encrypted backup on the hosts of up to
+// backupHosts contracts of the renter. The hosts that store the previous
+// backup are preferred, so that their copy is replaced.
+func (r *Renter) managedUploadBackup(key crypto.TwofishKey, created time.Time, ciphertext []byte) error {
+	sectors := backupSectors(ciphertext)
+	index := backupIndex{
+		Created: created,
+		Size:    uint64(len(ciphertext)),
+	}
+	for _, sector := range sectors {
+		index.Roots = append(index.Roots, crypto.MerkleRoot(sector))
+	}
+	indexData, err := indexSector(key, index)
+	if err != nil {
+		return err
+	}
+
+	lockID := r.mu.RLock()
+	prev := r.backup.Locations
+	r.mu.RUnlock(lockID)
+
+	var contracts, others []modules.RenterContract
+	for _, contract := range r.hostContractor.Contracts() {
+		if _, exists := prev[contract.HostPublicKey.String()]; exists {
+			contracts = append(contracts, contract)
+		} else {
+			others = append(others, contract)
+		}
+	}
+	contracts = append(contracts, others...)
+	locations := make(map[string]backupLocation)
+	for _, contract := range contracts {
+		if len(locations) >= backupHosts {
+			break
+		}
+		select {
+		case <-r.tg.StopChan():
+			return errors.New("renter is shutting down")
+		default:
+		}
+		hostKey := contract.HostPublicKey.String()
+		loc, err := r.managedUploadBackupTo(contract, backupMarker(key, contract.HostPublicKey), indexData, sectors, prev[hostKey])
+		if err != nil {
+			r.log.Println("WARN: could not store backup on", contract.NetAddress, "::", err)
+			continue
+		}
+		locations[hostKey] = loc
+	}
+	if len(locations) == 0 {
+		return errNoBackupHosts
+	}
+
+	lockID = r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	r.backup = backupRecord{
+		Created:   created,
+		Size:      index.Size,
+		Locations: locations,
+	}
+	return r.saveBackup()
+}
+
+// managedDownloadBackup reads the backup index of each contract of the
+// renter, and downloads the most recent backup that can be decrypted. The
+// hosts that store a backup are returned along with the encrypted backup.
+func (r *Renter) managedDownloadBackup(key crypto.TwofishKey) ([]byte, backupRecord, error) {
+	record := backupRecord{
+		Locations: make(map[string]backupLocation),
+	}
+	var found []foundBackup
+	for _, contract := range r.hostContractor.Contracts() {
+		indexRoot, ok := findBackupIndex(contract.MerkleRoots, crypto.MerkleRoot(backupMarker(key, contract.HostPublicKey)))
+		if !ok {
+			continue
+		}
+		downloader, err := r.hostContractor.Downloader(contract.ID)
+		if err != nil {
+			r.log.Debugln("Unable to read backup index from", contract.NetAddress, "::", err)
+			continue
+		}
+		sector, err := downloader.Sector(indexRoot)
+		downloader.Close()
+		if err != nil {
+			r.log.Debugln("Unable to read backup index from", contract.NetAddress, "::", err)
+			continue
+		}
+		index, err := readIndexSector(key, sector)
+		if err != nil {
+			continue
+		}
+		found = append(found, foundBackup{contract, index})
+		record.Locations[contract.HostPublicKey.String()] = backupLocation{
+			Index: indexRoot,
+			Data:  index.Roots,
+		}
+	}
+	if len(found) == 0 {
+		return nil, backupRecord{}, errNoBackup
+	}
+
+	// Download the most recent backup, falling back to older backups if
+	// the hosts storing a backup cannot provide it.
+	sort.Sort(backupsByAge(found))
+	for _, fb := range found {
+		downloader, err := r.hostContractor.Downloader(fb.contract.ID)
+		if err != nil {
+			continue
+		}
+		var ciphertext []byte
+		for _, root := range fb.index.Roots {
+			sector, err := downloader.Sector(root)
+			if err != nil {
+				break
+			}
+			ciphertext = append(ciphertext, sector...)
+		}
+		downloader.Close()
+		if uint64(len(ciphertext)) < fb.index.Size {
+			r.log.Debugln("Unable to download backup from", fb.contract.NetAddress)
+			continue
+		}
+		record.Created = fb.index.Created
+		record.Size = fb.index.Size
+		return ciphertext[:fb.index.Size], record, nil
+	}
+	return nil, backupRecord{}, errNoBackup
+}
+
+// restoreBackup adds the files, packs, and directories of a backup to the
+// renter. Files whose paths are already in use are skipped.
+func (r *Renter) restoreBackup(data backupData) error {
+	for _, b := range data.Packs {
+		packs, err := readSharedFiles(bytes.NewReader(b))
+		if err != nil || len(packs) != 1 {
+			r.log.Println("ERROR: could not restore pack from backup:", err)
+			continue
+		}
+		p := packs[0]
+		if _, exists := r.packs[p.name]; exists {
+			continue
+		}
+		r.resolveHostKeys(p)
+		r.packs[p.name] = p
+		r.packMembers[p.name] = make(map[*file]struct{})
+		if err := r.savePack(p); err != nil {
+			return err
+		}
+	}
+	for _, b := range data.Files {
+		files, err := readSharedFiles(bytes.NewReader(b))
+		if err != nil || len(files) != 1 {
+			r.log.Println("ERROR: could not restore file from backup:", err)
+			continue
+		}
+		f := files[0]
+		if _, exists := r.files[f.name]; exists {
+			continue
+		}
+		if err := r.checkPathConflict(f.name); err != nil {
+			r.log.Println("WARN: could not restore", f.name, "from backup:", err)
+			continue
+		}
+		r.resolveHostKeys(f)
+		r.addFileEntry(f.name, f)
+		if tf, exists := data.Tracking[f.name]; exists {
+			r.tracking[f.name] = tf
+		}
+		r.linkDedupChunks(f)
+		if err := r.saveFile(f); err != nil {
+			return err
+		}
+	}
+	for dir := range data.Directories {
+		if _, exists := r.files[dir]; !exists {
+			r.addDirEntry(dir)
+		}
+	}
+	r.linkPackedFiles()
+	return r.saveSync()
+}
+
+// Backup returns information on the most recent backup of the renter's
+// metadata that was stored on its hosts.
+func (r *Renter) Backup() modules.BackupInfo {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	return modules.BackupInfo{
+		Created:  r.backup.Created,
+		Size:     r.backup.Size,
+		NumHosts: uint64(len(r.backup.Locations)),
+	}
+}
+
+// CreateBackup creates an encrypted backup of the renter's metadata. The
+// backup is written to destination, or stored on the hosts of the renter if
+// destination is empty. The wallet must be unlocked.
+func (r *Renter) CreateBackup(destination string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	r.backupMu.Lock()
+	defer r.backupMu.Unlock()
+
+	key, err := r.backupKey()
+	if err != nil {
+		return err
+	}
+	data, err := r.managedBackupData()
+	if err != nil {
+		return err
+	}
+	ciphertext, err := encryptBackup(key, data)
+	if err != nil {
+		return err
+	}
+	if destination != "" {
+		return writeBackupFile(destination, ciphertext)
+	}
+	return r.managedUploadBackup(key, data.Created, ciphertext)
+}
+
+// RecoverBackup restores the renter's contracts and files from the backup at
+// source, or from the most recent backup stored on the hosts of the renter if
+// source is empty. The contracts formed using keys derived from the wallet
+// seed are recovered first, followed by the contracts recorded in the backup.
+// Files that are already known to the renter are kept. The wallet must be
+// unlocked.
+func (r *Renter) RecoverBackup(source string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	r.backupMu.Lock()
+	defer r.backupMu.Unlock()
+
+	key, err := r.backupKey()
+	if err != nil {
+		return err
+	}
+	if _, err := r.hostContractor.RecoverContracts(); err != nil {
+		return build.ExtendErr("unable to recover contracts", err)
+	}
+	var ciphertext []byte
+	var record backupRecord
+	if source != "" {
+		ciphertext, err = readBackupFile(source)
+	} else {
+		ciphertext, record, err = r.managedDownloadBackup(key)
+	}
+	if err != nil {
+		return err
+	}
+	var data backupData
+	if err := decryptBackup(key, ciphertext, &data); err != nil {
+		return err
+	}
+	if err := r.hostContractor.RestoreContracts(data.Allowance, data.CurrentPeriod, data.Contracts); err != nil {
+		return build.ExtendErr("unable to restore contracts", err)
+	}
+
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	if err := r.restoreBackup(data); err != nil {
+		return err
+	}
+	r.updateWorkerPool()
+	if source == "" {
+		r.backup = record
+		return r.saveBackup()
+	}
+	return nil
+}
+
+// threadedBackup periodically stores a backup of the renter's metadata on
+// its hosts. Backups are skipped while the wallet is locked or the renter has
+// no contracts.
+func (r *Renter) threadedBackup() {
+	for {
+		select {
+		case <-time.After(backupInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+		if !r.wallet.Unlocked() || len(r.hostContractor.Contracts()) == 0 {
+			continue
+		}
+		if err := r.CreateBackup(""); err != nil {
+			r.log.Println("WARN: could not back up renter metadata:", err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package renter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestIndexSector checks that a backup index can only be read from its sector
+// using the key that it was encrypted with.
+func TestIndexSector(t *testing.T) {
+	key, err := crypto.GenerateTwofishKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := backupIndex{
+		Created: time.Unix(1234567890, 0),
+		Size:    12345,
+		Roots:   []crypto.Hash{{1}, {2}},
+	}
+	sector, err := indexSector(key, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(sector)) != modules.SectorSize {
+		t.Fatal("index sector has the wrong size:", len(sector))
+	}
+	read, err := readIndexSector(key, sector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !read.Created.Equal(index.Created) || read.Size != index.Size || len(read.Roots) != 2 || read.Roots[1] != index.Roots[1] {
+		t.Fatal("index was not read correctly:", read)
+	}
+
+	// A different key, or a sector that does not store an index, should not
+	// yield an index.
+	otherKey, err := crypto.GenerateTwofishKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readIndexSector(otherKey, sector); err != errBadBackup {
+		t.Fatal("expected errBadBackup, got", err)
+	}
+	random, err := crypto.RandBytes(int(modules.SectorSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readIndexSector(key, random); err != errBadBackup {
+		t.Fatal("expected errBadBackup, got", err)
+	}
+}
+
+// TestFindBackupIndex checks that the backup index is found after the last
+// marker of a host, and only the marker of that host.
+func TestFindBackupIndex(t *testing.T) {
+	key, err := crypto.GenerateTwofishKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte("foo")}
+	otherKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte("bar")}
+	marker := crypto.MerkleRoot(backupMarker(key, hostKey))
+	if marker == crypto.MerkleRoot(backupMarker(key, otherKey)) {
+		t.Fatal("hosts share a backup marker")
+	}
+
+	roots := []crypto.Hash{{1}, marker, {2}, {3}, marker, {4}, {5}}
+	if index, ok := findBackupIndex(roots, marker); !ok || index != (crypto.Hash{4}) {
+		t.Fatal("wrong backup index:", index, ok)
+	}
+	// A marker in the last sector is not followed by an index.
+	if _, ok := findBackupIndex([]crypto.Hash{{1}, marker}, marker); ok {
+		t.Fatal("found an index after the last sector")
+	}
+	if _, ok := findBackupIndex(roots, crypto.MerkleRoot(backupMarker(key, otherKey))); ok {
+		t.Fatal("found an index using the marker of another host")
+	}
+}
+
+// TestBackupFile checks that the files and directories of a renter can be
+// recovered by a new renter from an exported backup.
+func TestBackupFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestBackupFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Upload a file and create a directory.
+	sourceDir := build.TempDir("renter", "TestBackupFile", "sources")
+	if err := os.MkdirAll(sourceDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(sourceDir, "source")
+	if err := ioutil.WriteFile(source, make([]byte, 10), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(1, 1)
+	err = rt.renter.Upload(modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     "foo/bar",
+		ErasureCode: rsc,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateDir("baz"); err != nil {
+		t.Fatal(err)
+	}
+
+	backupPath := filepath.Join(sourceDir, "backup")
+	if err := rt.renter.CreateBackup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Recover the backup into a new renter that uses the same wallet.
+	r, err := New(rt.cs, rt.wallet, rt.tpool, build.TempDir("renter", "TestBackupFile", "recovered"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.RecoverBackup(source); err != errBadBackup {
+		t.Fatal("expected errBadBackup, got", err)
+	}
+	if err := r.RecoverBackup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := r.File("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Filesize != 10 {
+		t.Fatal("recovered file has the wrong size:", fi.Filesize)
+	}
+	id := r.mu.RLock()
+	_, dirExists := r.dirs["baz"]
+	tf, tracked := r.tracking["foo/bar"]
+	r.mu.RUnlock(id)
+	if !dirExists {
+		t.Fatal("directory was not recovered")
+	}
+	if !tracked || tf.RepairPath != source {
+		t.Fatal("tracking data was not recovered:", tf)
+	}
+
+	// Recovering the same backup again should keep the existing files.
+	if err := r.RecoverBackup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if files := r.FileList(); len(files) != 1 {
+		t.Fatal("expected 1 file after recovering twice, got", len(files))
+	}
+}
@@ -0,0 +1,192 @@
+package renter
+
+// The bandwidth used by the workers is limited by delaying each transfer until
+// the bandwidth used by earlier transfers has been paid for. Pieces are
+// transferred as a whole, so the limits are enforced on average rather than
+// at every instant: a transfer of a sector is followed by a pause long enough
+// to bring the average back down to the limit.
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// errTransferInterrupted is returned by a worker that was waiting for
+	// bandwidth when the renter shut down.
+	errTransferInterrupted = errors.New("transfer was interrupted by the renter shutting down")
+
+	// throughputWindow is the period over which the throughput reported by
+	// the renter is averaged.
+	throughputWindow = build.Select(build.Var{
+		Standard: time.Second * 10,
+		Dev:      time.Second * 10,
+		Testing:  time.Second,
+	}).(time.Duration)
+)
+
+type (
+	// A rateLimit limits the rate of transfers to a number of bytes per
+	// second. A limit of zero means that transfers are not limited.
+	rateLimit struct {
+		bps  uint64
+		next time.Time // time at which the next transfer may start
+		mu   sync.Mutex
+	}
+
+	// A throughputMeter measures the number of bytes that were transferred
+	// during the last throughputWindow.
+	throughputMeter struct {
+		transfers []transfer
+		mu        sync.Mutex
+	}
+
+	// A transfer records the size and completion time of a transfer.
+	transfer struct {
+		size uint64
+		time time.Time
+	}
+
+	// bandwidthLimits are the bandwidth limits set in the renter's settings.
+	bandwidthLimits struct {
+		MaxBandwidth     uint64
+		MaxDownloadSpeed uint64
+		MaxUploadSpeed   uint64
+	}
+
+	// A bandwidthManager limits and measures the bandwidth used by the
+	// workers of the renter.
+	bandwidthManager struct {
+		download rateLimit
+		total    rateLimit
+		upload   rateLimit
+
+		downloadMeter throughputMeter
+		uploadMeter   throughputMeter
+	}
+)
+
+// setLimit sets the maximum rate of transfers in bytes per second.
+func (rl *rateLimit) setLimit(bps uint64) {
+	rl.mu.Lock()
+	rl.bps = bps
+	rl.next = time.Time{}
+	rl.mu.Unlock()
+}
+
+// reserve reserves bandwidth for a transfer of n bytes, returning the amount
+// of time to wait before the transfer may start.
+func (rl *rateLimit) reserve(n uint64) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.bps == 0 {
+		return 0
+	}
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	delay := rl.next.Sub(now)
+	rl.next = rl.next.Add(time.Duration(n * uint64(time.Second) / rl.bps))
+	return delay
+}
+
+// trim drops the transfers that are older than the window. tm.mu must be held.
+func (tm *throughputMeter) trim(now time.Time) {
+	cutoff := now.Add(-throughputWindow)
+	i := 0
+	for i < len(tm.transfers) && tm.transfers[i].time.Before(cutoff) {
+		i++
+	}
+	tm.transfers = tm.transfers[i:]
+}
+
+// record records a transfer of n bytes. Old transfers are dropped, so that the
+// meter does not grow while its rate is not read.
+func (tm *throughputMeter) record(n uint64) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	now := time.Now()
+	tm.trim(now)
+	tm.transfers = append(tm.transfers, transfer{size: n, time: now})
+}
+
+// rate returns the average number of bytes per second that were transferred
+// during the last throughputWindow.
+func (tm *throughputMeter) rate() uint64 {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.trim(time.Now())
+
+	var total uint64
+	for _, t := range tm.transfers {
+		total += t.size
+	}
+	return uint64(float64(total) / throughputWindow.Seconds())
+}
+
+// limits returns the bandwidth limits of the manager.
+func (bm *bandwidthManager) limits() bandwidthLimits {
+	bm.total.mu.Lock()
+	bm.download.mu.Lock()
+	bm.upload.mu.Lock()
+	defer bm.total.mu.Unlock()
+	defer bm.download.mu.Unlock()
+	defer bm.upload.mu.Unlock()
+	return bandwidthLimits{
+		MaxBandwidth:     bm.total.bps,
+		MaxDownloadSpeed: bm.download.bps,
+		MaxUploadSpeed:   bm.upload.bps,
+	}
+}
+
+// setLimits sets the bandwidth limits of the manager.
+func (bm *bandwidthManager) setLimits(bl bandwidthLimits) {
+	bm.total.setLimit(bl.MaxBandwidth)
+	bm.download.setLimit(bl.MaxDownloadSpeed)
+	bm.upload.setLimit(bl.MaxUploadSpeed)
+}
+
+// wait blocks until a transfer of n bytes in the given direction is allowed
+// by both the limit of that direction and the limit on the combined
+// bandwidth.
+func (bm *bandwidthManager) wait(direction *rateLimit, n uint64, stop <-chan struct{}) error {
+	delay := direction.reserve(n)
+	if totalDelay := bm.total.reserve(n); totalDelay > delay {
+		delay = totalDelay
+	}
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-stop:
+		return errTransferInterrupted
+	}
+}
+
+// managedWaitDownload blocks until the bandwidth limits allow n bytes to be
+// downloaded from a host.
+func (r *Renter) managedWaitDownload(n uint64) error {
+	return r.bandwidth.wait(&r.bandwidth.download, n, r.tg.StopChan())
+}
+
+// managedWaitUpload blocks until the bandwidth limits allow n bytes to be
+// uploaded to a host.
+func (r *Renter) managedWaitUpload(n uint64) error {
+	return r.bandwidth.wait(&r.bandwidth.upload, n, r.tg.StopChan())
+}
+
+// Throughput returns the bandwidth that the renter has recently used to
+// transfer data to and from hosts.
+func (r *Renter) Throughput() modules.RenterThroughput {
+	return modules.RenterThroughput{
+		Download: r.bandwidth.downloadMeter.rate(),
+		Upload:   r.bandwidth.uploadMeter.rate(),
+	}
+}
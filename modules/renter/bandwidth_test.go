@@ -0,0 +1,65 @@
+package renter
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRateLimitReserve checks that transfers are delayed until the bandwidth
+// used by earlier transfers has been paid for.
+func TestRateLimitReserve(t *testing.T) {
+	var rl rateLimit
+	if delay := rl.reserve(1e9); delay != 0 {
+		t.Fatal("unlimited transfer was delayed by", delay)
+	}
+
+	rl.setLimit(1000)
+	if delay := rl.reserve(500); delay != 0 {
+		t.Fatal("first transfer was delayed by", delay)
+	}
+	if delay := rl.reserve(500); delay < 450*time.Millisecond || delay > 500*time.Millisecond {
+		t.Fatal("second transfer has wrong delay:", delay)
+	}
+	if delay := rl.reserve(0); delay < 950*time.Millisecond || delay > time.Second {
+		t.Fatal("third transfer has wrong delay:", delay)
+	}
+
+	// Changing the limit should discard the earlier reservations.
+	rl.setLimit(2000)
+	if delay := rl.reserve(500); delay != 0 {
+		t.Fatal("transfer after changing the limit was delayed by", delay)
+	}
+}
+
+// TestThroughputMeter checks that the throughput meter only counts the
+// transfers of the last throughputWindow.
+func TestThroughputMeter(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	var tm throughputMeter
+	if rate := tm.rate(); rate != 0 {
+		t.Fatal("expected a rate of 0, got", rate)
+	}
+	tm.record(1000)
+	tm.record(3000)
+	if rate, expected := tm.rate(), uint64(4000/throughputWindow.Seconds()); rate != expected {
+		t.Fatal("expected a rate of", expected, "got", rate)
+	}
+	time.Sleep(throughputWindow)
+	if rate := tm.rate(); rate != 0 {
+		t.Fatal("old transfers were counted:", rate)
+	}
+
+	// Recording a transfer drops the old transfers, even if the rate is not
+	// read.
+	tm.record(1000)
+	time.Sleep(throughputWindow)
+	tm.record(2000)
+	tm.mu.Lock()
+	transfers := len(tm.transfers)
+	tm.mu.Unlock()
+	if transfers != 1 {
+		t.Fatal("old transfers were kept:", transfers)
+	}
+}
@@ -0,0 +1,290 @@
+package renter
+
+// Recovered chunks are kept in a size-bounded cache on disk, so that files that
+// are read repeatedly are served without downloading their pieces from the
+// hosts again. The cache holds the decrypted and decoded data of whole chunks,
+// keyed by the master key of the file storing the chunk and the index of the
+// chunk, which stay the same when a file is renamed or kept as an earlier
+// version. Chunks are evicted in least recently used order once the cache
+// exceeds its size, and are invalidated when the file storing them is updated
+// or its data is released. While the cache is enabled, whole chunks are
+// downloaded even if only a small section of a chunk is requested, so that the
+// chunk can be cached.
+//
+// The index of the cache is kept in memory, so the cache is emptied when the
+// renter starts.
+
+import (
+	"container/list"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// chunkCacheDir is the name of the directory within the renter's persist
+	// directory that stores the cached chunks.
+	chunkCacheDir = "chunkcache"
+
+	// chunkCacheExtension is the extension of the files that store the
+	// cached chunks.
+	chunkCacheExtension = ".chunk"
+)
+
+type (
+	// A chunkCache is an on-disk LRU cache of recovered chunks. A maxSize of
+	// zero disables the cache. The files of the cache are read and written
+	// without holding mu, so every chunk that is put in the cache is written
+	// to a new file.
+	chunkCache struct {
+		dir     string
+		maxSize uint64
+		size    uint64
+
+		// entries contains the list element of each cached chunk. Elements
+		// hold a *cachedChunk, and the most recently used chunk is at the
+		// front of lru.
+		entries map[crypto.Hash]*list.Element
+		lru     *list.List
+
+		// nextFile numbers the files of the cache. generation is incremented
+		// whenever chunks are invalidated, so that chunks that were being
+		// written at the time are not added to the cache.
+		nextFile   uint64
+		generation uint64
+
+		hits   uint64
+		misses uint64
+		mu     sync.Mutex
+	}
+
+	// A cachedChunk is a chunk that is stored in the cache.
+	cachedChunk struct {
+		id        crypto.Hash
+		masterKey crypto.TwofishKey
+		index     uint64
+		size      uint64
+		path      string
+	}
+)
+
+// chunkCacheID returns the identifier of a chunk in the cache.
+func chunkCacheID(masterKey crypto.TwofishKey, index uint64) crypto.Hash {
+	return crypto.HashAll(masterKey, index)
+}
+
+// removeFiles removes the files of chunks that were removed from the cache.
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
+// init removes the cached chunks left in the cache directory dir, which the
+// cache is stored in. Only the files of cached chunks are removed, as the
+// directory may also hold the .sia files of renter files that were created
+// beneath it before its name was reserved.
+func (c *chunkCache) init(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+chunkCacheExtension))
+	if err != nil {
+		return err
+	}
+	removeFiles(paths)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = dir
+	c.size = 0
+	c.entries = make(map[crypto.Hash]*list.Element)
+	c.lru = list.New()
+	return nil
+}
+
+// remove removes a chunk from the cache, returning the path of the file that
+// stored it. c.mu must be held.
+func (c *chunkCache) remove(e *list.Element) string {
+	cc := c.lru.Remove(e).(*cachedChunk)
+	delete(c.entries, cc.id)
+	c.size -= cc.size
+	return cc.path
+}
+
+// evict removes the least recently used chunks until the cache fits within
+// its size, returning the paths of the files that stored them. c.mu must be
+// held.
+func (c *chunkCache) evict() []string {
+	var paths []string
+	for c.size > c.maxSize {
+		paths = append(paths, c.remove(c.lru.Back()))
+	}
+	return paths
+}
+
+// lookup reports whether the chunk at index of the file with the given master
+// key is cached, counting a miss if it is not. The hit is counted when the
+// chunk is read with get.
+func (c *chunkCache) lookup(masterKey crypto.TwofishKey, index uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxSize == 0 {
+		return false
+	}
+	if _, exists := c.entries[chunkCacheID(masterKey, index)]; !exists {
+		c.misses++
+		return false
+	}
+	return true
+}
+
+// get returns the data of the chunk at index of the file with the given master
+// key, if it is cached.
+func (c *chunkCache) get(masterKey crypto.TwofishKey, index uint64) ([]byte, bool) {
+	c.mu.Lock()
+	if c.maxSize == 0 {
+		c.mu.Unlock()
+		return nil, false
+	}
+	e, exists := c.entries[chunkCacheID(masterKey, index)]
+	if !exists {
+		c.misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+	cc := e.Value.(*cachedChunk)
+	c.lru.MoveToFront(e)
+	c.mu.Unlock()
+
+	// If the file can't be read, the chunk was removed while it was being
+	// read, or the file is damaged and the chunk is removed now.
+	data, err := ioutil.ReadFile(cc.path)
+	c.mu.Lock()
+	if err != nil || uint64(len(data)) != cc.size {
+		var paths []string
+		if c.entries[cc.id] == e {
+			paths = append(paths, c.remove(e))
+		}
+		c.misses++
+		c.mu.Unlock()
+		removeFiles(paths)
+		return nil, false
+	}
+	c.hits++
+	c.mu.Unlock()
+	return data, true
+}
+
+// put adds the data of the chunk at index of the file with the given master key
+// to the cache, evicting the least recently used chunks to make room for it.
+func (c *chunkCache) put(masterKey crypto.TwofishKey, index uint64, data []byte) {
+	c.mu.Lock()
+	if c.maxSize == 0 || uint64(len(data)) > c.maxSize {
+		c.mu.Unlock()
+		return
+	}
+	id := chunkCacheID(masterKey, index)
+	c.nextFile++
+	path := filepath.Join(c.dir, fmt.Sprintf("%v-%d%v", hex.EncodeToString(id[:]), c.nextFile, chunkCacheExtension))
+	generation := c.generation
+	c.mu.Unlock()
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		os.Remove(path)
+		return
+	}
+
+	// The chunk is not added if chunks were invalidated while it was being
+	// written, as the chunk may be stale, or if it no longer fits.
+	c.mu.Lock()
+	if c.generation != generation || uint64(len(data)) > c.maxSize {
+		c.mu.Unlock()
+		os.Remove(path)
+		return
+	}
+	var paths []string
+	if e, exists := c.entries[id]; exists {
+		paths = append(paths, c.remove(e))
+	}
+	c.entries[id] = c.lru.PushFront(&cachedChunk{
+		id:        id,
+		masterKey: masterKey,
+		index:     index,
+		size:      uint64(len(data)),
+		path:      path,
+	})
+	c.size += uint64(len(data))
+	paths = append(paths, c.evict()...)
+	c.mu.Unlock()
+	removeFiles(paths)
+}
+
+// invalidate removes the chunks of the file with the given master key from the
+// cache.
+func (c *chunkCache) invalidate(masterKey crypto.TwofishKey) {
+	var paths []string
+	c.mu.Lock()
+	c.generation++
+	for _, e := range c.entries {
+		if e.Value.(*cachedChunk).masterKey == masterKey {
+			paths = append(paths, c.remove(e))
+		}
+	}
+	c.mu.Unlock()
+	removeFiles(paths)
+}
+
+// invalidateChunk removes the chunk at index of the file with the given master
+// key from the cache.
+func (c *chunkCache) invalidateChunk(masterKey crypto.TwofishKey, index uint64) {
+	var paths []string
+	c.mu.Lock()
+	c.generation++
+	if e, exists := c.entries[chunkCacheID(masterKey, index)]; exists {
+		paths = append(paths, c.remove(e))
+	}
+	c.mu.Unlock()
+	removeFiles(paths)
+}
+
+// setMaxSize sets the size of the cache, evicting chunks that no longer fit.
+func (c *chunkCache) setMaxSize(maxSize uint64) {
+	c.mu.Lock()
+	c.maxSize = maxSize
+	paths := c.evict()
+	c.mu.Unlock()
+	removeFiles(paths)
+}
+
+// getMaxSize returns the size of the cache.
+func (c *chunkCache) getMaxSize() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxSize
+}
+
+// ChunkCacheStats returns the size of the chunk cache and how often chunks
+// were served from it.
+func (r *Renter) ChunkCacheStats() modules.ChunkCacheStats {
+	c := &r.chunkCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var hitRate float64
+	if c.hits+c.misses != 0 {
+		hitRate = float64(c.hits) / float64(c.hits+c.misses)
+	}
+	return modules.ChunkCacheStats{
+		Chunks:  uint64(len(c.entries)),
+		Size:    c.size,
+		MaxSize: c.maxSize,
+		Hits:    c.hits,
+		Misses:  c.misses,
+		HitRate: hitRate,
+	}
+}
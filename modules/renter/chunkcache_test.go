@@ -0,0 +1,84 @@
+package renter
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// TestChunkCache checks that chunks are cached, evicted in least recently used
+// order, and invalidated, and that hits and misses are counted.
+func TestChunkCache(t *testing.T) {
+	r := &Renter{}
+	if err := r.chunkCache.init(filepath.Join(build.TempDir("renter", "TestChunkCache"), chunkCacheDir)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is cached while the cache is disabled.
+	keyA, keyB := crypto.TwofishKey{1}, crypto.TwofishKey{2}
+	r.chunkCache.put(keyA, 0, []byte("foo"))
+	if _, cached := r.chunkCache.get(keyA, 0); cached {
+		t.Fatal("chunk was cached while the cache was disabled")
+	}
+
+	r.chunkCache.setMaxSize(9)
+	r.chunkCache.put(keyA, 0, []byte("foo"))
+	r.chunkCache.put(keyA, 1, []byte("bar"))
+	r.chunkCache.put(keyB, 0, []byte("baz"))
+	if data, cached := r.chunkCache.get(keyA, 0); !cached || !bytes.Equal(data, []byte("foo")) {
+		t.Fatal("cached chunk was not returned:", string(data))
+	}
+
+	// Adding another chunk evicts the least recently used chunk.
+	r.chunkCache.put(keyB, 1, []byte("qux"))
+	if _, cached := r.chunkCache.get(keyA, 1); cached {
+		t.Error("least recently used chunk was not evicted")
+	}
+	if _, cached := r.chunkCache.get(keyA, 0); !cached {
+		t.Error("recently used chunk was evicted")
+	}
+
+	// Chunks that are larger than the cache are not cached.
+	r.chunkCache.put(keyA, 2, make([]byte, 10))
+	if _, cached := r.chunkCache.get(keyA, 2); cached {
+		t.Error("chunk larger than the cache was cached")
+	}
+
+	// Invalidation removes a single chunk or every chunk of a file.
+	r.chunkCache.invalidateChunk(keyB, 0)
+	if _, cached := r.chunkCache.get(keyB, 0); cached {
+		t.Error("invalidated chunk is still cached")
+	}
+	r.chunkCache.invalidate(keyA)
+	if _, cached := r.chunkCache.get(keyA, 0); cached {
+		t.Error("chunk of invalidated file is still cached")
+	}
+	if _, cached := r.chunkCache.get(keyB, 1); !cached {
+		t.Error("chunk of another file was invalidated")
+	}
+
+	stats := r.ChunkCacheStats()
+	if stats.Chunks != 1 || stats.Size != 3 || stats.MaxSize != 9 || stats.Hits != 3 || stats.Misses != 4 {
+		t.Errorf("wrong cache stats: %+v", stats)
+	}
+	if stats.HitRate != 3.0/7.0 {
+		t.Error("wrong hit rate:", stats.HitRate)
+	}
+
+	// A lookup counts a miss, but leaves the hit to be counted by get.
+	if !r.chunkCache.lookup(keyB, 1) || r.chunkCache.lookup(keyA, 0) {
+		t.Error("lookup did not report which chunks are cached")
+	}
+	if stats := r.ChunkCacheStats(); stats.Hits != 3 || stats.Misses != 5 {
+		t.Errorf("wrong cache stats after lookup: %+v", stats)
+	}
+
+	// Shrinking the cache evicts the chunks that no longer fit.
+	r.chunkCache.setMaxSize(2)
+	if stats := r.ChunkCacheStats(); stats.Chunks != 0 || stats.Size != 0 {
+		t.Errorf("chunks were not evicted when the cache shrank: %+v", stats)
+	}
+}
@@ -0,0 +1,264 @@
+package renter
+
+// Files that are uploaded with compression are compressed before they are
+// erasure coded and encrypted. Each chunk of a compressed file is compressed
+// on its own, so that any section of the file can be downloaded by fetching
+// and decompressing only the chunks that hold it. A chunk is filled with as
+// much of the file as fits once compressed, so the chunks of a compressed
+// file hold a variable amount of the file's data.
+//
+// The data of a chunk is compressed in blocks, and the compressor is flushed
+// after each block so that the size of the compressed chunk is known before
+// the next block is added. When a chunk needs to be repaired from the local
+// source, the same blocks are compressed again in the same way, which
+// reproduces the compressed chunk as long as neither the source nor the
+// compressor has changed. The hash of each compressed chunk is stored with
+// the file, and chunks that no longer compress to the uploaded data are
+// fetched from the network instead.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// maxCompressionBlockSize is the largest block of data that is compressed
+	// at a time.
+	maxCompressionBlockSize = 1 << 15
+
+	// compressionOverhead is the space reserved in each chunk for the gzip
+	// header and footer, and for the final deflate block.
+	compressionOverhead = 64
+)
+
+var (
+	// errCompressedChunkChanged is returned when the data of a chunk read
+	// from the local source no longer compresses to the data that was
+	// uploaded.
+	errCompressedChunkChanged = errors.New("compressed chunk does not match the uploaded chunk")
+
+	// errCompressedChunkTooLarge is returned when the data of a chunk no
+	// longer fits in the chunk once compressed, which happens if the local
+	// source of the file has changed since it was uploaded.
+	errCompressedChunkTooLarge = errors.New("compressed chunk is larger than the chunk size")
+
+	// errCompressedSharedFile is returned when a file is uploaded with
+	// compression and with either packing or deduplication.
+	errCompressedSharedFile = errors.New("compressed files cannot be packed or deduplicated")
+
+	// errCompressedStream is returned when a stream is uploaded with
+	// compression.
+	errCompressedStream = errors.New("uploads from a stream cannot be compressed")
+
+	// errDecompressedChunkSize is returned when a downloaded chunk does not
+	// decompress to the amount of data that the chunk holds.
+	errDecompressedChunkSize = errors.New("decompressed chunk has the wrong size")
+
+	// errUnknownCompression is returned when a file is uploaded with an
+	// unsupported compression algorithm.
+	errUnknownCompression = errors.New("unknown compression algorithm")
+)
+
+// compressionBlockSize returns the size of the blocks in which the data of a
+// chunk is compressed. Blocks must be small enough that several of them fit
+// in a chunk.
+func compressionBlockSize(chunkSize uint64) uint64 {
+	blockSize := chunkSize / 8
+	if blockSize > maxCompressionBlockSize {
+		blockSize = maxCompressionBlockSize
+	}
+	return blockSize
+}
+
+// maxCompressedBlockSize returns the largest amount of compressed data that
+// is produced by compressing and flushing a block of n bytes. Incompressible
+// data is stored in uncompressed deflate blocks, each of which adds a few
+// bytes of overhead.
+func maxCompressedBlockSize(n uint64) uint64 {
+	return n + n/64 + 16
+}
+
+// chunkSpan returns the section of a compressed file of the given size that
+// is held by a chunk.
+func chunkSpan(chunkOffsets []uint64, size, chunkIndex uint64) (offset, length uint64) {
+	offset = chunkOffsets[chunkIndex]
+	if chunkIndex == uint64(len(chunkOffsets))-1 {
+		return offset, size - offset
+	}
+	return offset, chunkOffsets[chunkIndex+1] - offset
+}
+
+// chunkAt returns the index of the chunk of a compressed file that holds the
+// byte at offset.
+func chunkAt(chunkOffsets []uint64, offset uint64) uint64 {
+	i := sort.Search(len(chunkOffsets), func(i int) bool {
+		return chunkOffsets[i] > offset
+	})
+	if i == 0 {
+		return 0
+	}
+	return uint64(i - 1)
+}
+
+// compressedChunks splits the file at path into chunks that are filled with
+// as much data as fits once compressed, returning the offset at which the
+// data of each chunk begins and the hash of each compressed chunk.
+func compressedChunks(path string, chunkSize uint64) ([]uint64, []crypto.Hash, error) {
+	fHandle, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fHandle.Close()
+
+	offsets := []uint64{0}
+	var hashes []crypto.Hash
+	var offset uint64
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	block := make([]byte, compressionBlockSize(chunkSize))
+	for {
+		n, err := io.ReadFull(fHandle, block)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, nil, err
+		}
+
+		// Start a new chunk if the block might not fit in the current one.
+		if offset > offsets[len(offsets)-1] && uint64(buf.Len())+maxCompressedBlockSize(uint64(n))+compressionOverhead > chunkSize {
+			if err := w.Close(); err != nil {
+				return nil, nil, err
+			}
+			hashes = append(hashes, crypto.HashBytes(buf.Bytes()))
+			offsets = append(offsets, offset)
+			buf.Reset()
+			w.Reset(buf)
+		}
+		if _, err := w.Write(block[:n]); err != nil {
+			return nil, nil, err
+		}
+		if err := w.Flush(); err != nil {
+			return nil, nil, err
+		}
+		offset += uint64(n)
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, err
+	}
+	hashes = append(hashes, crypto.HashBytes(buf.Bytes()))
+	return offsets, hashes, nil
+}
+
+// compressChunk compresses the data of a chunk in blocks, in the same way as
+// compressedChunks.
+func compressChunk(data []byte, chunkSize uint64) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	blockSize := compressionBlockSize(chunkSize)
+	for len(data) > 0 {
+		n := uint64(len(data))
+		if n > blockSize {
+			n = blockSize
+		}
+		if _, err := w.Write(data[:n]); err != nil {
+			return nil, err
+		}
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readCompressedChunk reads the data of a chunk of a compressed file from its
+// local source and compresses it. The returned data is padded with zeroes to
+// the full chunk size. errCompressedChunkChanged is returned if the chunk
+// does not compress to the data that was uploaded.
+func readCompressedChunk(path string, f *file, chunkIndex uint64) ([]byte, error) {
+	fHandle, err := os.Open(path)
+	if err != nil {
+		return nil, build.ExtendErr("unable to open file to repair chunk", err)
+	}
+	defer fHandle.Close()
+	offset, length := chunkSpan(f.chunkOffsets, f.size, chunkIndex)
+	data := make([]byte, length)
+	_, err = fHandle.ReadAt(data, int64(offset))
+	if err != nil && !(err == io.EOF && length == 0) {
+		return nil, build.ExtendErr("unable to read file to repair chunk", err)
+	}
+
+	compressed, err := compressChunk(data, f.chunkSize())
+	if err != nil {
+		return nil, build.ExtendErr("unable to compress chunk", err)
+	}
+	if uint64(len(compressed)) > f.chunkSize() {
+		return nil, errCompressedChunkTooLarge
+	}
+	if chunkIndex >= uint64(len(f.compressedHashes)) || crypto.HashBytes(compressed) != f.compressedHashes[chunkIndex] {
+		return nil, errCompressedChunkChanged
+	}
+	chunkData := make([]byte, f.chunkSize())
+	copy(chunkData, compressed)
+	return chunkData, nil
+}
+
+// decompressChunk decompresses a chunk of a compressed file that holds length
+// bytes of the file. The padding that follows the compressed data is ignored.
+func decompressChunk(compression string, chunkData []byte, length uint64) ([]byte, error) {
+	if compression != modules.CompressionGzip {
+		return nil, errUnknownCompression
+	}
+	r, err := gzip.NewReader(bytes.NewReader(chunkData))
+	if err != nil {
+		return nil, err
+	}
+	r.Multistream(false)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != length {
+		return nil, errDecompressedChunkSize
+	}
+	return data, nil
+}
+
+// newCompressedSectionDownload initializes and returns a download object that
+// fetches the section of the compressed file f that starts at offset and
+// spans length bytes. The chunks that hold the section are downloaded whole
+// and decompressed.
+func newCompressedSectionDownload(f *file, destination downloadDestination, destinationString, destinationType string, offset, length uint64) *download {
+	firstChunk := chunkAt(f.chunkOffsets, offset)
+	lastChunk := firstChunk
+	if length > 0 {
+		lastChunk = chunkAt(f.chunkOffsets, offset+length-1)
+	}
+	sectionChunks := lastChunk - firstChunk + 1
+	d := newSectionDownload(f, destination, destinationString, destinationType, firstChunk*f.chunkSize(), sectionChunks*f.chunkSize())
+	d.compression = f.compression
+	d.chunkOffsets = f.chunkOffsets
+	d.offset = offset
+	d.length = length
+
+	// Allocate the progress bar according to the size of the section rather
+	// than the size of the compressed chunks.
+	d.reportedPieceSize = d.length / (sectionChunks * uint64(d.erasureCode.MinPieces()))
+	d.atomicDataReceived = d.length - (d.reportedPieceSize * sectionChunks * uint64(d.erasureCode.MinPieces()))
+	return d
+}
@@ -0,0 +1,149 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestChunkAt checks that chunkAt finds the chunk of a compressed file that
+// holds an offset.
+func TestChunkAt(t *testing.T) {
+	offsets := []uint64{0, 10, 25}
+	tests := []struct {
+		offset uint64
+		chunk  uint64
+	}{
+		{0, 0},
+		{9, 0},
+		{10, 1},
+		{24, 1},
+		{25, 2},
+		{100, 2},
+	}
+	for _, test := range tests {
+		if chunk := chunkAt(offsets, test.offset); chunk != test.chunk {
+			t.Errorf("expected offset %v to be in chunk %v, got %v", test.offset, test.chunk, chunk)
+		}
+	}
+	if offset, length := chunkSpan(offsets, 30, 1); offset != 10 || length != 15 {
+		t.Error("wrong span for chunk 1:", offset, length)
+	}
+	if offset, length := chunkSpan(offsets, 30, 2); offset != 25 || length != 5 {
+		t.Error("wrong span for chunk 2:", offset, length)
+	}
+}
+
+// TestCompressedChunks checks that files are split into chunks that fit once
+// compressed, and that the chunks read from the local source decompress to
+// the data of the file.
+func TestCompressedChunks(t *testing.T) {
+	dir := build.TempDir("renter", "TestCompressedChunks")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(1, 1)
+
+	// Create a file that compresses well and a file that does not.
+	compressible := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), int(pieceSize))
+	incompressible, err := crypto.RandBytes(int(pieceSize * 5 / 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		data      []byte
+		maxChunks uint64
+	}{
+		{"compressible", compressible, uint64(len(compressible)) / pieceSize / 4},
+		{"incompressible", incompressible, 4},
+		{"empty", nil, 1},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(path, test.data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		f := newFile(test.name, rsc, pieceSize, uint64(len(test.data)))
+		f.compression = modules.CompressionGzip
+		f.chunkOffsets, f.compressedHashes, err = compressedChunks(path, f.chunkSize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.numChunks() > test.maxChunks {
+			t.Errorf("%v: expected at most %v chunks, got %v", test.name, test.maxChunks, f.numChunks())
+		}
+		if f.storedSize() != f.numChunks()*f.chunkSize() {
+			t.Errorf("%v: wrong stored size %v", test.name, f.storedSize())
+		}
+
+		// Each chunk should decompress to its section of the file.
+		var recovered []byte
+		for i := uint64(0); i < f.numChunks(); i++ {
+			chunkData, err := readChunk(path, f, i)
+			if err != nil {
+				t.Fatal(test.name, err)
+			}
+			if uint64(len(chunkData)) != f.chunkSize() {
+				t.Fatal(test.name, "chunk is not padded to the chunk size")
+			}
+			_, length := chunkSpan(f.chunkOffsets, f.size, i)
+			data, err := decompressChunk(f.compression, chunkData, length)
+			if err != nil {
+				t.Fatal(test.name, err)
+			}
+			recovered = append(recovered, data...)
+		}
+		if !bytes.Equal(recovered, test.data) {
+			t.Errorf("%v: decompressed chunks do not match the file", test.name)
+		}
+
+		// A chunk whose source has changed no longer matches the hash of the
+		// uploaded chunk.
+		if len(test.data) == 0 {
+			continue
+		}
+		changed := append([]byte(nil), test.data...)
+		changed[0]++
+		if err := ioutil.WriteFile(path, changed, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readChunk(path, f, 0); err != errCompressedChunkChanged {
+			t.Errorf("%v: expected errCompressedChunkChanged, got %v", test.name, err)
+		}
+	}
+}
+
+// TestCompressedFileMarshalling checks that the compression of a file
+// survives marshalling.
+func TestCompressedFileMarshalling(t *testing.T) {
+	rsc, _ := NewRSCode(1, 1)
+	f := newFile("foo", rsc, pieceSize, 100)
+	f.compression = modules.CompressionGzip
+	f.chunkOffsets = []uint64{0, 40, 80}
+	f.compressedHashes = []crypto.Hash{{1}, {2}, {3}}
+
+	buf := new(bytes.Buffer)
+	if err := f.MarshalSia(buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(file)
+	if err := loaded.UnmarshalSia(buf); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.compression != f.compression || len(loaded.chunkOffsets) != 3 || loaded.chunkOffsets[2] != 80 {
+		t.Fatal("compression was lost by marshalling:", loaded.compression, loaded.chunkOffsets)
+	}
+	if len(loaded.compressedHashes) != 3 || loaded.compressedHashes[2] != f.compressedHashes[2] {
+		t.Fatal("compressed chunk hashes were lost by marshalling:", loaded.compressedHashes)
+	}
+	if loaded.numChunks() != 3 {
+		t.Error("expected 3 chunks, got", loaded.numChunks())
+	}
+}
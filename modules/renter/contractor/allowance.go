@@ -83,6 +83,17 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 		return ErrInsufficientAllowance
 	}
 
+	// Editors and downloaders enforce the maximum prices of the allowance they
+	// were created with. If the maximum prices change, the cached editors and
+	// downloaders are invalidated once the new allowance is set, so that new
+	// ones are created with the new allowance.
+	c.mu.RLock()
+	pricesChanged := !a.MaxPricesEqual(c.allowance)
+	c.mu.RUnlock()
+	if pricesChanged {
+		defer c.managedInvalidateSessions()
+	}
+
 	c.mu.RLock()
 	shouldRenew := a.Period != c.allowance.Period || !a.Funds.Equals(c.allowance.Funds)
 	shouldWait := c.blockHeight+a.Period < c.contractEndHeight()
@@ -123,7 +134,7 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 	// renew existing contracts with new allowance parameters
 	newContracts := make(map[types.FileContractID]modules.RenterContract)
 	for _, contract := range renewSet {
-		newContract, err := c.managedRenew(contract, numSectors, endHeight)
+		newContract, err := c.managedRenew(contract, numSectors, endHeight, a)
 		if err != nil {
 			c.log.Printf("WARN: failed to renew contract with %v; a new contract will be formed in its place", contract.NetAddress)
 			remaining++
@@ -141,7 +152,7 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 
 	// if we did not renew enough contracts, form new ones
 	if remaining > 0 {
-		formed, err := c.managedFormContracts(remaining, numSectors, endHeight)
+		formed, err := c.managedFormContracts(remaining, numSectors, endHeight, a)
 		if err != nil {
 			return err
 		}
@@ -161,9 +172,12 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 	// archive the current contract set
 	for id, contract := range c.contracts {
 		c.oldContracts[id] = contract
+		c.removeContract(id)
 	}
 	// replace the current contract set with new contracts
-	c.contracts = newContracts
+	for _, contract := range newContracts {
+		c.addContract(contract)
+	}
 	// if the currentPeriod was previously unset, set it now
 	if c.currentPeriod == 0 {
 		c.currentPeriod = periodStart
@@ -178,7 +192,13 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 // need to be renewed when setting the allowance.
 func (c *Contractor) managedFormAllowanceContracts(n int, numSectors uint64, a modules.Allowance) error {
 	if n <= 0 {
-		return nil
+		// no contracts are needed, but other parameters of the allowance,
+		// such as the maximum prices, may have changed
+		c.mu.Lock()
+		c.allowance = a
+		err := c.saveSync()
+		c.mu.Unlock()
+		return err
 	}
 
 	// if we're forming contracts but not renewing, the new contracts should
@@ -192,7 +212,7 @@ func (c *Contractor) managedFormAllowanceContracts(n int, numSectors uint64, a m
 	c.mu.RUnlock()
 
 	// form the contracts
-	formed, err := c.managedFormContracts(n, numSectors, endHeight)
+	formed, err := c.managedFormContracts(n, numSectors, endHeight, a)
 	if err != nil {
 		return err
 	}
@@ -201,7 +221,7 @@ func (c *Contractor) managedFormAllowanceContracts(n int, numSectors uint64, a m
 	c.mu.Lock()
 	c.allowance = a
 	for _, contract := range formed {
-		c.contracts[contract.ID] = contract
+		c.addContract(contract)
 	}
 	err = c.saveSync()
 	c.mu.Unlock()
@@ -209,6 +229,28 @@ func (c *Contractor) managedFormAllowanceContracts(n int, numSectors uint64, a m
 	return err
 }
 
+// managedInvalidateSessions invalidates every cached editor and downloader.
+// Clients that are still using one must request a new editor or downloader.
+func (c *Contractor) managedInvalidateSessions() {
+	c.mu.RLock()
+	var editors []*hostEditor
+	for _, e := range c.editors {
+		editors = append(editors, e)
+	}
+	var downloaders []*hostDownloader
+	for _, d := range c.downloaders {
+		downloaders = append(downloaders, d)
+	}
+	c.mu.RUnlock()
+
+	for _, e := range editors {
+		e.invalidate()
+	}
+	for _, d := range downloaders {
+		d.invalidate()
+	}
+}
+
 // managedCancelAllowance handles the special case where the allowance is empty.
 func (c *Contractor) managedCancelAllowance(a modules.Allowance) error {
 	// first need to invalidate any active editors/downloaders
@@ -250,6 +292,7 @@ func (c *Contractor) managedCancelAllowance(a modules.Allowance) error {
 		c.oldContracts[id] = contract
 	}
 	c.contracts = make(map[types.FileContractID]modules.RenterContract)
+	c.hostContracts = make(map[string]types.FileContractID)
 	err := c.saveSync()
 	c.mu.Unlock()
 	return err
@@ -51,12 +51,19 @@ type Contractor struct {
 	currentPeriod   types.BlockHeight
 	downloaders     map[types.FileContractID]*hostDownloader
 	editors         map[types.FileContractID]*hostEditor
+	hostContracts   map[string]types.FileContractID // current contract with each host
+	keyIndexes      map[string]uint64               // index of the next contract key with each host
 	lastChange      modules.ConsensusChangeID
 	oldContracts    map[types.FileContractID]modules.RenterContract
 	renewedIDs      map[types.FileContractID]types.FileContractID
 	renewing        map[types.FileContractID]bool // prevent revising during renewal
 	revising        map[types.FileContractID]bool // prevent overlapping revisions
 
+	// retainer reports how much of the data stored with each host is still
+	// needed when a contract ends. If retainer is nil, every contract is
+	// renewed.
+	retainer Retainer
+
 	mu sync.RWMutex
 
 	// in addition to mu, a separate lock enforces that multiple goroutines
@@ -71,16 +78,33 @@ func (c *Contractor) Allowance() modules.Allowance {
 	return c.allowance
 }
 
-// Contract returns the latest contract formed with the specified host.
-func (c *Contractor) Contract(hostAddr modules.NetAddress) (modules.RenterContract, bool) {
+// Contract returns the latest contract formed with the host with the
+// specified public key.
+func (c *Contractor) Contract(hostKey types.SiaPublicKey) (modules.RenterContract, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	for _, c := range c.contracts {
-		if c.NetAddress == hostAddr {
-			return c, true
-		}
+	contract, ok := c.contracts[c.hostContracts[hostKey.String()]]
+	return contract, ok
+}
+
+// addContract adds a contract to the current contract set. c.mu must be held.
+func (c *Contractor) addContract(contract modules.RenterContract) {
+	c.contracts[contract.ID] = contract
+	c.hostContracts[contract.HostPublicKey.String()] = contract.ID
+}
+
+// removeContract removes a contract from the current contract set. c.mu must
+// be held.
+func (c *Contractor) removeContract(id types.FileContractID) {
+	contract, ok := c.contracts[id]
+	if !ok {
+		return
+	}
+	delete(c.contracts, id)
+	key := contract.HostPublicKey.String()
+	if c.hostContracts[key] == id {
+		delete(c.hostContracts, key)
 	}
-	return modules.RenterContract{}, false
 }
 
 // Contracts returns the contracts formed by the contractor in the current
@@ -116,6 +140,13 @@ func (c *Contractor) CurrentPeriod() types.BlockHeight {
 	return c.currentPeriod
 }
 
+// SetRetainer sets the Retainer that is consulted when contracts are renewed.
+func (c *Contractor) SetRetainer(r Retainer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retainer = r
+}
+
 // resolveID returns the ID of the most recent renewal of id.
 func (c *Contractor) resolveID(id types.FileContractID) types.FileContractID {
 	if newID, ok := c.renewedIDs[id]; ok && newID != id {
@@ -167,6 +198,8 @@ func newContractor(cs consensusSet, w wallet, tp transactionPool, hdb hostDB, p
 		contracts:       make(map[types.FileContractID]modules.RenterContract),
 		downloaders:     make(map[types.FileContractID]*hostDownloader),
 		editors:         make(map[types.FileContractID]*hostEditor),
+		hostContracts:   make(map[string]types.FileContractID),
+		keyIndexes:      make(map[string]uint64),
 		oldContracts:    make(map[types.FileContractID]modules.RenterContract),
 		renewedIDs:      make(map[types.FileContractID]types.FileContractID),
 		renewing:        make(map[types.FileContractID]bool),
@@ -21,10 +21,12 @@ type newStub struct{}
 func (newStub) ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID) error {
 	return nil
 }
-func (newStub) Synced() bool { return true }
+func (newStub) Synced() bool                               { return true }
+func (newStub) Unsubscribe(modules.ConsensusSetSubscriber) {}
 
 // wallet stubs
 func (newStub) NextAddress() (uc types.UnlockConditions, err error) { return }
+func (newStub) PrimarySeed() (s modules.Seed, n uint64, err error)  { return }
 func (newStub) StartTransaction() modules.TransactionBuilder        { return nil }
 
 // transaction pool stubs
@@ -32,8 +34,10 @@ func (newStub) AcceptTransactionSet([]types.Transaction) error      { return nil
 func (newStub) FeeEstimation() (a types.Currency, b types.Currency) { return }
 
 // hdb stubs
-func (newStub) Host(modules.NetAddress) (settings modules.HostDBEntry, ok bool) { return }
-func (newStub) RandomHosts(int, []modules.NetAddress) []modules.HostDBEntry     { return nil }
+func (newStub) AllHosts() []modules.HostDBEntry                                 { return nil }
+func (newStub) Host(types.SiaPublicKey) (settings modules.HostDBEntry, ok bool) { return }
+func (newStub) IsFiltered(types.SiaPublicKey) bool                              { return false }
+func (newStub) RandomHosts(int, []types.SiaPublicKey) []modules.HostDBEntry     { return nil }
 
 // TestNew tests the New function.
 func TestNew(t *testing.T) {
@@ -83,14 +87,14 @@ func TestNew(t *testing.T) {
 // TestContract tests the Contract method.
 func TestContract(t *testing.T) {
 	c := &Contractor{
-		contracts: map[types.FileContractID]modules.RenterContract{
-			{1}: {ID: types.FileContractID{1}, NetAddress: "foo"},
-			{2}: {ID: types.FileContractID{2}, NetAddress: "bar"},
-			{3}: {ID: types.FileContractID{3}, NetAddress: "baz"},
-		},
+		contracts:     make(map[types.FileContractID]modules.RenterContract),
+		hostContracts: make(map[string]types.FileContractID),
 	}
+	c.addContract(modules.RenterContract{ID: types.FileContractID{1}, HostPublicKey: types.SiaPublicKey{Key: []byte("foo")}})
+	c.addContract(modules.RenterContract{ID: types.FileContractID{2}, HostPublicKey: types.SiaPublicKey{Key: []byte("bar")}})
+	c.addContract(modules.RenterContract{ID: types.FileContractID{3}, HostPublicKey: types.SiaPublicKey{Key: []byte("baz")}})
 	tests := []struct {
-		addr       modules.NetAddress
+		host       string
 		exists     bool
 		contractID types.FileContractID
 	}{
@@ -101,18 +105,23 @@ func TestContract(t *testing.T) {
 		{"nope", false, types.FileContractID{}},
 	}
 	for _, test := range tests {
-		contract, ok := c.Contract(test.addr)
+		contract, ok := c.Contract(types.SiaPublicKey{Key: []byte(test.host)})
 		if ok != test.exists {
-			t.Errorf("%v: expected %v, got %v", test.addr, test.exists, ok)
+			t.Errorf("%v: expected %v, got %v", test.host, test.exists, ok)
 		} else if contract.ID != test.contractID {
-			t.Errorf("%v: expected %v, got %v", test.addr, test.contractID, contract.ID)
+			t.Errorf("%v: expected %v, got %v", test.host, test.contractID, contract.ID)
 		}
 	}
 
 	// delete all contracts
-	c.contracts = map[types.FileContractID]modules.RenterContract{}
+	for _, id := range []types.FileContractID{{1}, {2}, {3}} {
+		c.removeContract(id)
+	}
+	if len(c.hostContracts) != 0 {
+		t.Error("hosts of removed contracts were not removed:", c.hostContracts)
+	}
 	for _, test := range tests {
-		_, ok := c.Contract(test.addr)
+		_, ok := c.Contract(types.SiaPublicKey{Key: []byte(test.host)})
 		if ok {
 			t.Error("no contracts should remain")
 		}
@@ -188,8 +197,10 @@ func TestAllowance(t *testing.T) {
 // its methods.
 type stubHostDB struct{}
 
-func (stubHostDB) Host(modules.NetAddress) (h modules.HostDBEntry, ok bool)         { return }
-func (stubHostDB) RandomHosts(int, []modules.NetAddress) (hs []modules.HostDBEntry) { return }
+func (stubHostDB) AllHosts() (hs []modules.HostDBEntry)                             { return }
+func (stubHostDB) Host(types.SiaPublicKey) (h modules.HostDBEntry, ok bool)         { return }
+func (stubHostDB) IsFiltered(types.SiaPublicKey) bool                               { return false }
+func (stubHostDB) RandomHosts(int, []types.SiaPublicKey) (hs []modules.HostDBEntry) { return }
 
 // TestIntegrationSetAllowance tests the SetAllowance method.
 func TestIntegrationSetAllowance(t *testing.T) {
@@ -338,6 +349,9 @@ func (ws *testWalletShim) NextAddress() (types.UnlockConditions, error) {
 	ws.nextAddressCalled = true
 	return types.UnlockConditions{}, nil
 }
+func (ws *testWalletShim) PrimarySeed() (modules.Seed, uint64, error) {
+	return modules.Seed{}, 0, nil
+}
 func (ws *testWalletShim) StartTransaction() modules.TransactionBuilder {
 	ws.startTxnCalled = true
 	return nil
@@ -356,3 +370,41 @@ func TestWalletBridge(t *testing.T) {
 		t.Error("StartTransaction was not called on the shim")
 	}
 }
+
+// TestNextContractKey checks that each contract with a host uses a different
+// key, and that the contract scanner derives the keys in the same order.
+func TestNextContractKey(t *testing.T) {
+	c := &Contractor{
+		wallet:     &walletBridge{w: newStub{}},
+		keyIndexes: make(map[string]uint64),
+	}
+	host := modules.HostDBEntry{PublicKey: types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte("foo")}}
+	sk0, err := c.managedNextContractKey(host.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk1, err := c.managedNextContractKey(host.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sk0 == sk1 {
+		t.Fatal("two contracts with the same host use the same key")
+	}
+	if c.keyIndexes[host.PublicKey.String()] != 2 {
+		t.Fatal("expected key index 2, got", c.keyIndexes[host.PublicKey.String()])
+	}
+
+	s := &contractScanner{
+		keys: make(map[types.UnlockHash]recoveryKey),
+		next: make(map[string]uint64),
+	}
+	s.deriveKeys(host, 2)
+	if key, ok := s.keys[contractUnlockHash(sk1, host.PublicKey)]; !ok || key.index != 1 || key.sk != sk1 {
+		t.Fatal("scanner did not derive the key of the second contract")
+	}
+	// deriving fewer keys is a no-op
+	s.deriveKeys(host, 1)
+	if len(s.keys) != 2 || s.next[host.PublicKey.String()] != 2 {
+		t.Fatal("scanner derived unexpected keys:", len(s.keys))
+	}
+}
@@ -14,16 +14,19 @@ type (
 	consensusSet interface {
 		ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID) error
 		Synced() bool
+		Unsubscribe(modules.ConsensusSetSubscriber)
 	}
 	// in order to restrict the modules.TransactionBuilder interface, we must
 	// provide a shim to bridge the gap between modules.Wallet and
 	// transactionBuilder.
 	walletShim interface {
 		NextAddress() (types.UnlockConditions, error)
+		PrimarySeed() (modules.Seed, uint64, error)
 		StartTransaction() modules.TransactionBuilder
 	}
 	wallet interface {
 		NextAddress() (types.UnlockConditions, error)
+		PrimarySeed() (modules.Seed, uint64, error)
 		StartTransaction() transactionBuilder
 	}
 	transactionBuilder interface {
@@ -46,8 +49,10 @@ type (
 	}
 
 	hostDB interface {
-		Host(modules.NetAddress) (modules.HostDBEntry, bool)
-		RandomHosts(n int, exclude []modules.NetAddress) []modules.HostDBEntry
+		AllHosts() []modules.HostDBEntry
+		Host(types.SiaPublicKey) (modules.HostDBEntry, bool)
+		IsFiltered(types.SiaPublicKey) bool
+		RandomHosts(n int, exclude []types.SiaPublicKey) []modules.HostDBEntry
 	}
 
 	persister interface {
@@ -64,6 +69,7 @@ type walletBridge struct {
 }
 
 func (ws *walletBridge) NextAddress() (types.UnlockConditions, error) { return ws.w.NextAddress() }
+func (ws *walletBridge) PrimarySeed() (modules.Seed, uint64, error)   { return ws.w.PrimarySeed() }
 func (ws *walletBridge) StartTransaction() transactionBuilder         { return ws.w.StartTransaction() }
 
 // stdPersist implements the persister interface via persist.SaveFile and
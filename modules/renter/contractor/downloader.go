@@ -22,6 +22,16 @@ type Downloader interface {
 	// retrieve.
 	Sector(root crypto.Hash) ([]byte, error)
 
+	// PartialSectors retrieves segment-aligned sections of sectors, verifying
+	// each section with a range proof, and revises the underlying contract to
+	// pay the host only for the requested bytes.
+	PartialSectors(actions []modules.DownloadAction) ([][]byte, error)
+
+	// Segment retrieves a single segment of a sector together with the
+	// unverified Merkle proof supplied by the host, and revises the
+	// underlying contract to pay the host for the segment.
+	Segment(root crypto.Hash, index uint64) ([]byte, []crypto.Hash, error)
+
 	// Close terminates the connection to the host.
 	Close() error
 }
@@ -63,6 +73,19 @@ func (hd *hostDownloader) HostSettings() modules.HostExternalSettings {
 	return hd.hostSettings
 }
 
+// saveContract stores the contract returned by the proto.Downloader in the
+// contractor if it was revised. A download may fail after the host has signed
+// a revision, in which case the revision must still be saved.
+func (hd *hostDownloader) saveContract(contract modules.RenterContract) {
+	hd.contractor.mu.Lock()
+	defer hd.contractor.mu.Unlock()
+	if old, exists := hd.contractor.contracts[contract.ID]; exists && contract.LastRevision.NewRevisionNumber <= old.LastRevision.NewRevisionNumber {
+		return
+	}
+	hd.contractor.contracts[contract.ID] = contract
+	hd.contractor.saveSync()
+}
+
 // Sector retrieves the sector with the specified Merkle root, and revises
 // the underlying contract to pay the host proportionally to the data
 // retrieve.
@@ -73,16 +96,45 @@ func (hd *hostDownloader) Sector(root crypto.Hash) ([]byte, error) {
 		return nil, errInvalidDownloader
 	}
 	contract, sector, err := hd.downloader.Sector(root)
+	hd.saveContract(contract)
 	if err != nil {
 		return nil, err
 	}
+	return sector, nil
+}
 
-	hd.contractor.mu.Lock()
-	hd.contractor.contracts[contract.ID] = contract
-	hd.contractor.saveSync()
-	hd.contractor.mu.Unlock()
+// PartialSectors retrieves segment-aligned sections of sectors, verifying
+// each section with a range proof, and revises the underlying contract to pay
+// the host only for the requested bytes.
+func (hd *hostDownloader) PartialSectors(actions []modules.DownloadAction) ([][]byte, error) {
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+	if hd.invalid {
+		return nil, errInvalidDownloader
+	}
+	contract, sections, err := hd.downloader.PartialSectors(actions)
+	hd.saveContract(contract)
+	if err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
 
-	return sector, nil
+// Segment retrieves a single segment of a sector together with the
+// unverified Merkle proof supplied by the host, and revises the underlying
+// contract to pay the host for the segment.
+func (hd *hostDownloader) Segment(root crypto.Hash, index uint64) ([]byte, []crypto.Hash, error) {
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+	if hd.invalid {
+		return nil, nil, errInvalidDownloader
+	}
+	contract, segment, hashSet, err := hd.downloader.Segment(root, index)
+	hd.saveContract(contract)
+	if err != nil {
+		return nil, nil, err
+	}
+	return segment, hashSet, nil
 }
 
 // Close cleanly terminates the download loop with the host and closes the
@@ -110,6 +162,7 @@ func (c *Contractor) Downloader(id types.FileContractID) (_ Downloader, err erro
 	id = c.resolveID(id)
 	cachedDownloader, haveDownloader := c.downloaders[id]
 	height := c.blockHeight
+	allowance := c.allowance
 	contract, haveContract := c.contracts[id]
 	renewing := c.renewing[id]
 	c.mu.RUnlock()
@@ -126,7 +179,7 @@ func (c *Contractor) Downloader(id types.FileContractID) (_ Downloader, err erro
 		return cachedDownloader, nil
 	}
 
-	host, haveHost := c.hdb.Host(contract.NetAddress)
+	host, haveHost := c.hdb.Host(contract.HostPublicKey)
 	if !haveContract {
 		return nil, errors.New("no record of that contract")
 	} else if height > contract.EndHeight() {
@@ -135,6 +188,8 @@ func (c *Contractor) Downloader(id types.FileContractID) (_ Downloader, err erro
 		return nil, errors.New("no record of that host")
 	} else if host.DownloadBandwidthPrice.Cmp(maxDownloadPrice) > 0 {
 		return nil, errTooExpensive
+	} else if priceErr := allowance.CheckDownloadPrices(host.HostExternalSettings); priceErr != nil {
+		return nil, priceErr
 	}
 
 	// acquire revising lock
@@ -167,8 +222,12 @@ func (c *Contractor) Downloader(id types.FileContractID) (_ Downloader, err erro
 		}
 	}
 
+	// the host may have announced a new address since the contract was
+	// formed
+	contract.NetAddress = host.NetAddress
+
 	// create downloader
-	d, err := proto.NewDownloader(host, contract)
+	d, err := proto.NewDownloader(host, contract, allowance)
 	if proto.IsRevisionMismatch(err) {
 		// try again with the cached revision
 		c.mu.RLock()
@@ -181,7 +240,7 @@ func (c *Contractor) Downloader(id types.FileContractID) (_ Downloader, err erro
 		}
 		c.log.Printf("host %v has different revision for %v; retrying with cached revision", contract.NetAddress, contract.ID)
 		contract.LastRevision = cached.Revision
-		d, err = proto.NewDownloader(host, contract)
+		d, err = proto.NewDownloader(host, contract, allowance)
 	}
 	if err != nil {
 		return nil, err
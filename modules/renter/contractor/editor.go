@@ -32,8 +32,8 @@ type Editor interface {
 	// supplied by the caller.
 	Modify(oldRoot, newRoot crypto.Hash, offset uint64, newData []byte) error
 
-	// Address returns the address of the host.
-	Address() modules.NetAddress
+	// HostPublicKey returns the public key of the host.
+	HostPublicKey() types.SiaPublicKey
 
 	// ContractID returns the FileContractID of the contract.
 	ContractID() types.FileContractID
@@ -72,8 +72,8 @@ func (he *hostEditor) invalidate() {
 	he.contractor.mu.Unlock()
 }
 
-// Address returns the NetAddress of the host.
-func (he *hostEditor) Address() modules.NetAddress { return he.contract.NetAddress }
+// HostPublicKey returns the public key of the host.
+func (he *hostEditor) HostPublicKey() types.SiaPublicKey { return he.contract.HostPublicKey }
 
 // ContractID returns the ID of the contract being revised.
 func (he *hostEditor) ContractID() types.FileContractID { return he.contract.ID }
@@ -169,6 +169,7 @@ func (c *Contractor) Editor(id types.FileContractID) (_ Editor, err error) {
 	id = c.resolveID(id)
 	cachedEditor, haveEditor := c.editors[id]
 	height := c.blockHeight
+	allowance := c.allowance
 	contract, haveContract := c.contracts[id]
 	renewing := c.renewing[id]
 	c.mu.RUnlock()
@@ -185,7 +186,7 @@ func (c *Contractor) Editor(id types.FileContractID) (_ Editor, err error) {
 		return cachedEditor, nil
 	}
 
-	host, haveHost := c.hdb.Host(contract.NetAddress)
+	host, haveHost := c.hdb.Host(contract.HostPublicKey)
 	if !haveContract {
 		return nil, errors.New("no record of that contract")
 	} else if height > contract.EndHeight() {
@@ -194,6 +195,8 @@ func (c *Contractor) Editor(id types.FileContractID) (_ Editor, err error) {
 		return nil, errors.New("no record of that host")
 	} else if host.StoragePrice.Cmp(maxStoragePrice) > 0 {
 		return nil, errTooExpensive
+	} else if priceErr := allowance.CheckUploadPrices(host.HostExternalSettings); priceErr != nil {
+		return nil, priceErr
 	} else if build.VersionCmp(host.Version, "0.6.0") > 0 {
 		// COMPATv0.6.0: don't cap host.Collateral on old hosts
 		if host.Collateral.Cmp(maxUploadCollateral) > 0 {
@@ -231,8 +234,12 @@ func (c *Contractor) Editor(id types.FileContractID) (_ Editor, err error) {
 		}
 	}
 
+	// the host may have announced a new address since the contract was
+	// formed
+	contract.NetAddress = host.NetAddress
+
 	// create editor
-	e, err := proto.NewEditor(host, contract, height)
+	e, err := proto.NewEditor(host, contract, height, allowance)
 	if proto.IsRevisionMismatch(err) {
 		// try again with the cached revision
 		c.mu.RLock()
@@ -246,7 +253,7 @@ func (c *Contractor) Editor(id types.FileContractID) (_ Editor, err error) {
 		c.log.Printf("host %v has different revision for %v; retrying with cached revision", contract.NetAddress, contract.ID)
 		contract.LastRevision = cached.Revision
 		contract.MerkleRoots = cached.MerkleRoots
-		e, err = proto.NewEditor(host, contract, height)
+		e, err = proto.NewEditor(host, contract, height, allowance)
 	}
 	if err != nil {
 		return nil, err
@@ -24,6 +24,7 @@ var (
 	// than the amount necessary to store at least one sector
 	ErrInsufficientAllowance = errors.New("allowance is not large enough to cover fees of contract creation")
 	errTooExpensive          = errors.New("host price was too high")
+	errHostFiltered          = errors.New("host is excluded by the host filter")
 )
 
 // maxSectors is the estimated maximum number of sectors that the allowance
@@ -74,11 +75,14 @@ func maxSectors(a modules.Allowance, hdb hostDB, tp transactionPool) (uint64, er
 }
 
 // managedNewContract negotiates an initial file contract with the specified
-// host, saves it, and returns it.
-func (c *Contractor) managedNewContract(host modules.HostDBEntry, numSectors uint64, endHeight types.BlockHeight) (modules.RenterContract, error) {
+// host, saves it, and returns it. The host's prices may not exceed the maximum
+// prices of the allowance.
+func (c *Contractor) managedNewContract(host modules.HostDBEntry, numSectors uint64, endHeight types.BlockHeight, a modules.Allowance) (modules.RenterContract, error) {
 	// reject hosts that are too expensive
 	if host.StoragePrice.Cmp(maxStoragePrice) > 0 {
 		return modules.RenterContract{}, errTooExpensive
+	} else if err := a.CheckPrices(host.HostExternalSettings); err != nil {
+		return modules.RenterContract{}, err
 	}
 	// cap host.MaxCollateral
 	if host.MaxCollateral.Cmp(maxCollateral) > 0 {
@@ -91,6 +95,13 @@ func (c *Contractor) managedNewContract(host modules.HostDBEntry, numSectors uin
 		return modules.RenterContract{}, err
 	}
 
+	// derive the key of the contract from the wallet seed, so that the
+	// contract can be recovered from the seed
+	sk, err := c.managedNextContractKey(host.PublicKey)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+
 	// create contract params
 	c.mu.RLock()
 	params := proto.ContractParams{
@@ -99,6 +110,8 @@ func (c *Contractor) managedNewContract(host modules.HostDBEntry, numSectors uin
 		StartHeight:   c.blockHeight,
 		EndHeight:     endHeight,
 		RefundAddress: uc.UnlockHash(),
+		SecretKey:     sk,
+		Allowance:     a,
 	}
 	c.mu.RUnlock()
 
@@ -117,26 +130,68 @@ func (c *Contractor) managedNewContract(host modules.HostDBEntry, numSectors uin
 	return contract, nil
 }
 
+// managedSelectHosts selects up to n random hosts to form contracts with.
+// Hosts that we've already formed contracts with, hosts that share a subnet
+// with them or with another selected host, and hosts whose prices exceed the
+// maximum prices of the allowance are never selected. Hosts excluded by the
+// filter of the hostdb are never returned by the hostdb.
+func (c *Contractor) managedSelectHosts(n int, a modules.Allowance) []modules.HostDBEntry {
+	c.mu.RLock()
+	var exclude []types.SiaPublicKey
+	usedNets := make(map[string]struct{})
+	for _, contract := range c.contracts {
+		exclude = append(exclude, contract.HostPublicKey)
+		if host, ok := c.hdb.Host(contract.HostPublicKey); ok {
+			for _, ipnet := range host.IPNets {
+				usedNets[ipnet] = struct{}{}
+			}
+		}
+	}
+	c.mu.RUnlock()
+
+	// Rejected hosts are excluded from the next sample, and the hostdb is
+	// sampled again until enough hosts are found or every host has been
+	// considered.
+	var hosts []modules.HostDBEntry
+	seen := make(map[string]struct{})
+	for len(hosts) < n {
+		sampled := false
+		for _, h := range c.hdb.RandomHosts(n-len(hosts), exclude) {
+			if _, ok := seen[h.PublicKey.String()]; ok {
+				continue
+			}
+			seen[h.PublicKey.String()] = struct{}{}
+			exclude = append(exclude, h.PublicKey)
+			sampled = true
+			if h.SharesIPNet(usedNets) || a.CheckPrices(h.HostExternalSettings) != nil {
+				continue
+			}
+			hosts = append(hosts, h)
+			for _, ipnet := range h.IPNets {
+				usedNets[ipnet] = struct{}{}
+			}
+		}
+		if !sampled {
+			break
+		}
+	}
+	return hosts
+}
+
 // managedFormContracts forms contracts with n hosts using the allowance
-// parameters.
-func (c *Contractor) managedFormContracts(n int, numSectors uint64, endHeight types.BlockHeight) ([]modules.RenterContract, error) {
+// parameters. Hosts whose prices exceed the maximum prices of the allowance
+// are skipped.
+func (c *Contractor) managedFormContracts(n int, numSectors uint64, endHeight types.BlockHeight, a modules.Allowance) ([]modules.RenterContract, error) {
 	if n <= 0 {
 		return nil, nil
 	}
 
-	// Sample at least 10 hosts.
+	// Select at least 10 hosts.
 	nRandomHosts := 2 * n
 	if nRandomHosts < 10 {
 		nRandomHosts = 10
 	}
-	// Don't select from hosts we've already formed contracts with
-	c.mu.RLock()
-	var exclude []modules.NetAddress
-	for _, contract := range c.contracts {
-		exclude = append(exclude, contract.NetAddress)
-	}
-	c.mu.RUnlock()
-	hosts := c.hdb.RandomHosts(nRandomHosts, exclude)
+	hosts := c.managedSelectHosts(nRandomHosts, a)
 	if len(hosts) < n {
 		return nil, fmt.Errorf("not enough hosts in hostdb for contract formation, got %v but needed %v", len(hosts), n)
 	}
@@ -144,7 +199,7 @@ func (c *Contractor) managedFormContracts(n int, numSectors uint64, endHeight ty
 	var contracts []modules.RenterContract
 	var errs []string
 	for _, h := range hosts {
-		contract, err := c.managedNewContract(h, numSectors, endHeight)
+		contract, err := c.managedNewContract(h, numSectors, endHeight, a)
 		if err != nil {
 			errs = append(errs, fmt.Sprintf("\t%v: %v", h.NetAddress, err))
 			continue
@@ -0,0 +1,69 @@
+package contractor
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// sampleHostDB is a hostDB that returns at most one host per call to
+// RandomHosts, honoring the excluded hosts.
+type sampleHostDB struct {
+	mapHostDB
+	order []types.SiaPublicKey
+}
+
+func (hdb sampleHostDB) RandomHosts(n int, exclude []types.SiaPublicKey) []modules.HostDBEntry {
+	excluded := make(map[string]struct{})
+	for _, pk := range exclude {
+		excluded[pk.String()] = struct{}{}
+	}
+	for _, pk := range hdb.order {
+		if _, ok := excluded[pk.String()]; !ok && n > 0 {
+			return []modules.HostDBEntry{hdb.hosts[pk.String()]}
+		}
+	}
+	return nil
+}
+
+// TestSelectHosts checks that managedSelectHosts keeps sampling the hostdb
+// until it finds enough hosts that are cheap enough and that do not share a
+// subnet with the hosts of existing contracts or with each other.
+func TestSelectHosts(t *testing.T) {
+	hdb := sampleHostDB{mapHostDB: mapHostDB{hosts: make(map[string]modules.HostDBEntry)}}
+	addHost := func(name string, price uint64, ipnet string) types.SiaPublicKey {
+		var h modules.HostDBEntry
+		h.PublicKey = types.SiaPublicKey{Key: []byte(name)}
+		h.ContractPrice = types.NewCurrency64(price)
+		h.IPNets = []string{ipnet}
+		hdb.hosts[h.PublicKey.String()] = h
+		hdb.order = append(hdb.order, h.PublicKey)
+		return h.PublicKey
+	}
+	existing := addHost("existing", 1, "1.0.0.0/24")
+	addHost("expensive1", 100, "2.0.0.0/24")
+	addHost("sameAsExisting", 1, "1.0.0.0/24")
+	cheap1 := addHost("cheap1", 1, "3.0.0.0/24")
+	addHost("sameAsCheap1", 1, "3.0.0.0/24")
+	addHost("expensive2", 100, "4.0.0.0/24")
+	cheap2 := addHost("cheap2", 1, "5.0.0.0/24")
+
+	contract := modules.RenterContract{ID: types.FileContractID{1}, HostPublicKey: existing}
+	c := &Contractor{
+		contracts: map[types.FileContractID]modules.RenterContract{contract.ID: contract},
+		hdb:       hdb,
+	}
+	a := modules.Allowance{MaxContractPrice: types.NewCurrency64(10)}
+
+	hosts := c.managedSelectHosts(3, a)
+	if len(hosts) != 2 {
+		t.Fatal("expected 2 hosts, got", len(hosts))
+	}
+	if hosts[0].PublicKey.String() != cheap1.String() || hosts[1].PublicKey.String() != cheap2.String() {
+		t.Error("wrong hosts selected:", hosts)
+	}
+	if hosts = c.managedSelectHosts(1, a); len(hosts) != 1 || hosts[0].PublicKey.String() != cheap1.String() {
+		t.Error("wrong hosts selected:", hosts)
+	}
+}
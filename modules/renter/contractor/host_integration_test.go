@@ -175,6 +175,16 @@ func newTestingTrio(name string) (modules.Host, *Contractor, modules.TestMiner,
 	return h, c, m, nil
 }
 
+// hostDBEntry returns the entry of the host h in the hostdb of the contractor.
+func hostDBEntry(c *Contractor, h modules.Host) (modules.HostDBEntry, bool) {
+	for _, host := range c.hdb.AllHosts() {
+		if host.NetAddress == h.ExternalSettings().NetAddress {
+			return host, true
+		}
+	}
+	return modules.HostDBEntry{}, false
+}
+
 // TestIntegrationFormContract tests that the contractor can form contracts
 // with the host module.
 func TestIntegrationFormContract(t *testing.T) {
@@ -189,13 +199,13 @@ func TestIntegrationFormContract(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -205,6 +215,83 @@ func TestIntegrationFormContract(t *testing.T) {
 	}
 }
 
+// TestIntegrationMaxPrices tests that the contractor refuses to form
+// contracts with, and to revise contracts with, hosts whose prices exceed the
+// maximum prices of the allowance.
+func TestIntegrationMaxPrices(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio("TestIntegrationMaxPrices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok := hostDBEntry(c, h)
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// a contract should not be formed if the host is too expensive
+	a := modules.Allowance{
+		MaxStoragePrice:         hostEntry.StoragePrice.Sub(types.NewCurrency64(1)),
+		MaxUploadBandwidthPrice: hostEntry.UploadBandwidthPrice,
+	}
+	_, err = c.managedNewContract(hostEntry, 10, c.blockHeight+100, a)
+	if err != modules.ErrMaxStoragePrice {
+		t.Fatal("expected", modules.ErrMaxStoragePrice, "got", err)
+	}
+
+	// form a contract with the host at the maximum price
+	a.MaxStoragePrice = hostEntry.StoragePrice
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	c.allowance = a
+	c.contracts[contract.ID] = contract
+	c.mu.Unlock()
+
+	// raise the host's upload price without informing the hostdb; revisions
+	// should be refused during negotiation
+	settings := h.InternalSettings()
+	settings.MinUploadBandwidthPrice = settings.MinUploadBandwidthPrice.Mul64(2)
+	if err := h.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	editor, err := c.Editor(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := crypto.RandBytes(int(modules.SectorSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = editor.Upload(data); err != modules.ErrMaxUploadBandwidthPrice {
+		t.Fatal("expected", modules.ErrMaxUploadBandwidthPrice, "got", err)
+	}
+	editor.Close()
+
+	// the contract of a host whose prices in the hostdb exceed the maximum
+	// prices should be replaced, without the host being considered offline
+	if c.ShouldReplace(contract.ID) {
+		t.Fatal("host should not be replaced while its prices in the hostdb are acceptable")
+	}
+	c.mu.Lock()
+	c.allowance.MaxUploadBandwidthPrice = hostEntry.UploadBandwidthPrice.Sub(types.NewCurrency64(1))
+	c.mu.Unlock()
+	if !c.ShouldReplace(contract.ID) {
+		t.Fatal("expected host that exceeds the maximum prices to be replaced")
+	}
+	if c.IsOffline(contract.ID) {
+		t.Fatal("host that exceeds the maximum prices should not be offline")
+	}
+}
+
 // TestIntegrationReviseContract tests that the contractor can revise a
 // contract previously formed with a host.
 func TestIntegrationReviseContract(t *testing.T) {
@@ -220,13 +307,13 @@ func TestIntegrationReviseContract(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -268,13 +355,13 @@ func TestIntegrationUploadDownload(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -333,13 +420,13 @@ func TestIntegrationDelete(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -398,13 +485,13 @@ func TestIntegrationInsertDelete(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -458,13 +545,13 @@ func TestIntegrationModify(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -525,13 +612,13 @@ func TestIntegrationRenew(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -560,7 +647,7 @@ func TestIntegrationRenew(t *testing.T) {
 
 	// renew the contract
 	oldContract := c.contracts[contract.ID]
-	contract, err = c.managedRenew(oldContract, modules.SectorSize*10, c.blockHeight+200)
+	contract, err = c.managedRenew(oldContract, modules.SectorSize*10, c.blockHeight+200, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -602,7 +689,7 @@ func TestIntegrationRenew(t *testing.T) {
 
 	// renew to a lower height
 	oldContract = c.contracts[contract.ID]
-	contract, err = c.managedRenew(oldContract, modules.SectorSize*10, c.blockHeight+100)
+	contract, err = c.managedRenew(oldContract, modules.SectorSize*10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -652,13 +739,13 @@ func TestIntegrationResync(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -790,13 +877,13 @@ func TestIntegrationDownloaderCaching(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -867,6 +954,101 @@ func TestIntegrationDownloaderCaching(t *testing.T) {
 	d4.Close()
 }
 
+// TestIntegrationSetAllowanceMaxPrices tests that the cached editors and
+// downloaders are invalidated when the maximum prices of the allowance change.
+func TestIntegrationSetAllowanceMaxPrices(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, _, err := newTestingTrio("TestIntegrationSetAllowanceMaxPrices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok := hostDBEntry(c, h)
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host
+	a := modules.Allowance{
+		Funds:       types.SiacoinPrecision.Mul64(500),
+		Hosts:       1,
+		Period:      100,
+		RenewWindow: 10,
+	}
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	c.contracts[contract.ID] = contract
+	c.allowance = a
+	c.mu.Unlock()
+
+	// create an editor; setting the same allowance should not invalidate it
+	e1, err := c.Editor(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetAllowance(a); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.RLock()
+	_, ok = c.editors[contract.ID]
+	c.mu.RUnlock()
+	if !ok {
+		t.Fatal("editor should still be cached")
+	}
+
+	// changing the maximum prices should invalidate the editor
+	a.MaxStoragePrice = hostEntry.StoragePrice.Mul64(2)
+	if err := c.SetAllowance(a); err != nil {
+		t.Fatal(err)
+	}
+	e2, err := c.Editor(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e2 == e1 {
+		t.Fatal("invalidated editor was returned")
+	}
+	e1.Close()
+	e2.Close()
+
+	// the same applies to downloaders
+	d1, err := c.Downloader(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetAllowance(a); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.RLock()
+	_, ok = c.downloaders[contract.ID]
+	c.mu.RUnlock()
+	if !ok {
+		t.Fatal("downloader should still be cached")
+	}
+	a.MaxDownloadBandwidthPrice = hostEntry.DownloadBandwidthPrice.Mul64(2)
+	if err := c.SetAllowance(a); err != nil {
+		t.Fatal(err)
+	}
+	d2, err := c.Downloader(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d2 == d1 {
+		t.Fatal("invalidated downloader was returned")
+	}
+	d1.Close()
+	d2.Close()
+}
+
 // TestIntegrationEditorCaching tests that editors are properly cached
 // by the contractor. When two editors are requested for the same
 // contract, only one underlying editor should be created.
@@ -883,13 +1065,13 @@ func TestIntegrationEditorCaching(t *testing.T) {
 	defer h.Close()
 
 	// get the host's entry from the db
-	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	hostEntry, ok := hostDBEntry(c, h)
 	if !ok {
 		t.Fatal("no entry for host in db")
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, modules.Allowance{})
 	if err != nil {
 		t.Fatal(err)
 	}
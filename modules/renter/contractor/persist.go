@@ -13,6 +13,7 @@ type contractorPersist struct {
 	CachedRevisions []cachedRevision
 	Contracts       []modules.RenterContract
 	CurrentPeriod   types.BlockHeight
+	KeyIndexes      map[string]uint64
 	LastChange      modules.ConsensusChangeID
 	OldContracts    []modules.RenterContract
 	RenewedIDs      map[string]string
@@ -32,9 +33,13 @@ func (c *Contractor) persistData() contractorPersist {
 		Allowance:     c.allowance,
 		BlockHeight:   c.blockHeight,
 		CurrentPeriod: c.currentPeriod,
+		KeyIndexes:    make(map[string]uint64),
 		LastChange:    c.lastChange,
 		RenewedIDs:    make(map[string]string),
 	}
+	for host, index := range c.keyIndexes {
+		data.KeyIndexes[host] = index
+	}
 	for _, rev := range c.cachedRevisions {
 		data.CachedRevisions = append(data.CachedRevisions, rev)
 	}
@@ -83,10 +88,23 @@ func (c *Contractor) load() error {
 		if contract.StartHeight == 0 {
 			contract.StartHeight = c.currentPeriod + 1
 		}
-		c.contracts[contract.ID] = contract
+		// COMPATv1.1.0
+		// If loading old persist, the public key of the host is only known
+		// from the unlock conditions of the contract.
+		if len(contract.HostPublicKey.Key) == 0 {
+			contract.HostPublicKey = contractHostKey(contract)
+		}
+		c.addContract(contract)
+	}
+	for host, index := range data.KeyIndexes {
+		c.keyIndexes[host] = index
 	}
 	c.lastChange = data.LastChange
 	for _, contract := range data.OldContracts {
+		// COMPATv1.1.0
+		if len(contract.HostPublicKey.Key) == 0 {
+			contract.HostPublicKey = contractHostKey(contract)
+		}
 		c.oldContracts[contract.ID] = contract
 	}
 	for oldString, newString := range data.RenewedIDs {
@@ -51,6 +51,7 @@ func TestSaveLoad(t *testing.T) {
 		t.Fatal(err)
 	}
 	c.contracts = make(map[types.FileContractID]modules.RenterContract)
+	c.hostContracts = make(map[string]types.FileContractID)
 	c.renewedIDs = make(map[types.FileContractID]types.FileContractID)
 	c.cachedRevisions = make(map[types.FileContractID]cachedRevision)
 	c.oldContracts = make(map[types.FileContractID]modules.RenterContract)
@@ -94,6 +95,7 @@ func TestSaveLoad(t *testing.T) {
 		t.Fatal(err)
 	}
 	c.contracts = make(map[types.FileContractID]modules.RenterContract)
+	c.hostContracts = make(map[string]types.FileContractID)
 	c.renewedIDs = make(map[types.FileContractID]types.FileContractID)
 	c.cachedRevisions = make(map[types.FileContractID]cachedRevision)
 	c.oldContracts = make(map[types.FileContractID]modules.RenterContract)
@@ -127,3 +129,42 @@ func TestSaveLoad(t *testing.T) {
 		t.Fatal("oldContracts were not restored properly:", c.oldContracts)
 	}
 }
+
+// TestLoadHostPublicKeyCompat checks that contracts saved without the public
+// key of their host are given the host key from their unlock conditions.
+func TestLoadHostPublicKeyCompat(t *testing.T) {
+	hostKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte("host")}
+	uc := types.UnlockConditions{
+		PublicKeys: []types.SiaPublicKey{{Algorithm: types.SignatureEd25519, Key: []byte("renter")}, hostKey},
+	}
+	c := &Contractor{
+		persist:         &memPersist{},
+		contracts:       make(map[types.FileContractID]modules.RenterContract),
+		hostContracts:   make(map[string]types.FileContractID),
+		renewedIDs:      make(map[types.FileContractID]types.FileContractID),
+		cachedRevisions: make(map[types.FileContractID]cachedRevision),
+		oldContracts:    make(map[types.FileContractID]modules.RenterContract),
+	}
+	c.persist.save(contractorPersist{
+		Contracts: []modules.RenterContract{{
+			ID:           types.FileContractID{1},
+			LastRevision: types.FileContractRevision{UnlockConditions: uc},
+		}},
+		OldContracts: []modules.RenterContract{{
+			ID:           types.FileContractID{2},
+			LastRevision: types.FileContractRevision{UnlockConditions: uc},
+		}},
+	})
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	if key := c.contracts[types.FileContractID{1}].HostPublicKey; key.String() != hostKey.String() {
+		t.Error("contract was loaded with the wrong host key:", key)
+	}
+	if _, ok := c.Contract(hostKey); !ok {
+		t.Error("contract was not found by the key of its host")
+	}
+	if key := c.oldContracts[types.FileContractID{2}].HostPublicKey; key.String() != hostKey.String() {
+		t.Error("old contract was loaded with the wrong host key:", key)
+	}
+}
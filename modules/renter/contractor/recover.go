@@ -0,0 +1,323 @@
+package contractor
+
+// Contracts are formed using keys that are derived from the wallet seed, the
+// public key of the host and the index of the contract among the contracts
+// formed with the host. Each contract, including each renewal, uses a
+// different key, so that the contracts with a host cannot be linked on the
+// blockchain. The contracts of a renter can still be recovered from the seed
+// alone: the blockchain is scanned for file contracts whose unlock conditions
+// match a derived key, and the most recent revision and the sector roots of
+// each contract are requested from its host. Because contracts with a host
+// appear on the blockchain in the order of their indices, the scanner only
+// needs to derive a few keys beyond the last contract it found with each host.
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/proto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// recoveryLookahead is the number of contract keys beyond the last
+	// contract found with a host that are searched for during recovery. Keys
+	// are skipped when a contract fails to form after its key was derived.
+	recoveryLookahead = 10
+)
+
+var (
+	// contractKeySpecifier is used to derive the keys of contracts from the
+	// wallet seed.
+	contractKeySpecifier = types.Specifier{'c', 'o', 'n', 't', 'r', 'a', 'c', 't', ' ', 'k', 'e', 'y'}
+)
+
+type (
+	// A recoveryCandidate is a contract that may be recovered, along with the
+	// public key of its host.
+	recoveryCandidate struct {
+		contract modules.RenterContract
+		hostKey  types.SiaPublicKey
+	}
+
+	// A recoveryKey is the key of a contract with a host.
+	recoveryKey struct {
+		host  modules.HostDBEntry
+		index uint64
+		sk    crypto.SecretKey
+	}
+
+	// A contractScanner is a consensus set subscriber that finds the file
+	// contracts whose unlock hashes match the keys derived from a seed.
+	contractScanner struct {
+		candidates map[types.FileContractID]recoveryCandidate
+		found      map[string]uint64 // index following the last contract found with each host
+		height     types.BlockHeight
+		keys       map[types.UnlockHash]recoveryKey
+		next       map[string]uint64 // index of the next key to derive for each host
+		seed       modules.Seed
+	}
+)
+
+// deriveKeys derives the keys of the contracts with host up to, but not
+// including, index end.
+func (s *contractScanner) deriveKeys(host modules.HostDBEntry, end uint64) {
+	hk := host.PublicKey.String()
+	for i := s.next[hk]; i < end; i++ {
+		sk := deriveContractKey(s.seed, host.PublicKey, i)
+		s.keys[contractUnlockHash(sk, host.PublicKey)] = recoveryKey{
+			host:  host,
+			index: i,
+			sk:    sk,
+		}
+	}
+	if end > s.next[hk] {
+		s.next[hk] = end
+	}
+}
+
+// ProcessConsensusChange adds the file contracts that match the keys of the
+// scanner to its set of candidates.
+func (s *contractScanner) ProcessConsensusChange(cc modules.ConsensusChange) {
+	for _, block := range cc.RevertedBlocks {
+		if block.ID() != types.GenesisID {
+			s.height--
+		}
+		for _, txn := range block.Transactions {
+			for i := range txn.FileContracts {
+				delete(s.candidates, txn.FileContractID(uint64(i)))
+			}
+		}
+	}
+	for _, block := range cc.AppliedBlocks {
+		if block.ID() != types.GenesisID {
+			s.height++
+		}
+		for _, txn := range block.Transactions {
+			for i, fc := range txn.FileContracts {
+				key, exists := s.keys[fc.UnlockHash]
+				if !exists {
+					continue
+				}
+				if hk := key.host.PublicKey.String(); key.index+1 > s.found[hk] {
+					s.found[hk] = key.index + 1
+				}
+				s.deriveKeys(key.host, key.index+1+recoveryLookahead)
+				id := txn.FileContractID(uint64(i))
+				s.candidates[id] = recoveryCandidate{
+					contract: modules.RenterContract{
+						FileContract:  fc,
+						HostPublicKey: key.host.PublicKey,
+						ID:            id,
+						NetAddress:    key.host.NetAddress,
+						SecretKey:     key.sk,
+						StartHeight:   s.height,
+					},
+					hostKey: key.host.PublicKey,
+				}
+			}
+		}
+	}
+}
+
+// deriveContractKey derives the key of the contract with the given index
+// among the contracts formed with the host with the given public key.
+func deriveContractKey(seed modules.Seed, hostKey types.SiaPublicKey, index uint64) crypto.SecretKey {
+	sk, _ := crypto.GenerateKeyPairDeterministic(crypto.HashAll(seed, contractKeySpecifier, hostKey, index))
+	return sk
+}
+
+// managedNextContractKey returns the key of the next contract formed with the
+// host with the given public key. The key is derived from the primary seed of
+// the wallet, and no two contracts with the host use the same key.
+func (c *Contractor) managedNextContractKey(hostKey types.SiaPublicKey) (crypto.SecretKey, error) {
+	seed, _, err := c.wallet.PrimarySeed()
+	if err != nil {
+		return crypto.SecretKey{}, err
+	}
+	c.mu.Lock()
+	index := c.keyIndexes[hostKey.String()]
+	c.keyIndexes[hostKey.String()]++
+	c.mu.Unlock()
+	return deriveContractKey(seed, hostKey, index), nil
+}
+
+// contractUnlockHash returns the unlock hash of a contract between the renter
+// key sk and the host key hostKey.
+func contractUnlockHash(sk crypto.SecretKey, hostKey types.SiaPublicKey) types.UnlockHash {
+	pk := sk.PublicKey()
+	return types.UnlockConditions{
+		PublicKeys: []types.SiaPublicKey{{
+			Algorithm: types.SignatureEd25519,
+			Key:       pk[:],
+		}, hostKey},
+		SignaturesRequired: 2,
+	}.UnlockHash()
+}
+
+// contractHostKey returns the public key of the host of a contract.
+func contractHostKey(contract modules.RenterContract) types.SiaPublicKey {
+	if len(contract.LastRevision.UnlockConditions.PublicKeys) != 2 {
+		return types.SiaPublicKey{}
+	}
+	return contract.LastRevision.UnlockConditions.PublicKeys[1]
+}
+
+// RecoverContracts scans the blockchain for the contracts that were formed
+// using keys derived from the wallet seed, and recovers each of them that has
+// not ended and is not known to the contractor. The recovered contracts are
+// returned. The wallet must be unlocked.
+func (c *Contractor) RecoverContracts() ([]modules.RenterContract, error) {
+	seed, _, err := c.wallet.PrimarySeed()
+	if err != nil {
+		return nil, err
+	}
+	scanner := &contractScanner{
+		candidates: make(map[types.FileContractID]recoveryCandidate),
+		found:      make(map[string]uint64),
+		keys:       make(map[types.UnlockHash]recoveryKey),
+		next:       make(map[string]uint64),
+		seed:       seed,
+	}
+	for _, host := range c.hdb.AllHosts() {
+		scanner.deriveKeys(host, recoveryLookahead)
+	}
+	err = c.cs.ConsensusSetSubscribe(scanner, modules.ConsensusChangeBeginning)
+	if err != nil {
+		return nil, err
+	}
+	c.cs.Unsubscribe(scanner)
+
+	// Keys are never reused, so the next key with each host follows the keys
+	// of all the contracts that were found, including those that have ended.
+	c.mu.Lock()
+	for hk, index := range scanner.found {
+		if index > c.keyIndexes[hk] {
+			c.keyIndexes[hk] = index
+		}
+	}
+	c.mu.Unlock()
+
+	candidates := make([]recoveryCandidate, 0, len(scanner.candidates))
+	for _, rc := range scanner.candidates {
+		candidates = append(candidates, rc)
+	}
+	return c.managedRecoverContracts(candidates), nil
+}
+
+// RestoreContracts recovers the contracts of a backup that have not ended and
+// are not known to the contractor. If the contractor does not have an
+// allowance, the allowance and the current period of the backup are restored
+// as well.
+func (c *Contractor) RestoreContracts(a modules.Allowance, currentPeriod types.BlockHeight, contracts []modules.RenterContract) error {
+	c.mu.Lock()
+	if c.allowance.Hosts == 0 {
+		c.allowance = a
+		if c.currentPeriod == 0 {
+			c.currentPeriod = currentPeriod
+		}
+	}
+	err := c.saveSync()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	candidates := make([]recoveryCandidate, 0, len(contracts))
+	for _, contract := range contracts {
+		candidates = append(candidates, recoveryCandidate{
+			contract: contract,
+			hostKey:  contractHostKey(contract),
+		})
+	}
+	c.managedRecoverContracts(candidates)
+	return nil
+}
+
+// managedRecoverContracts requests the most recent revision and the sector
+// roots of each candidate from its host, and adds the candidates that could
+// be recovered to the contractor. Of the contracts with a host, only the one
+// that ends last is kept as a current contract; the others are treated as
+// having been renewed by it, so that the files that refer to them can still
+// reach the host.
+func (c *Contractor) managedRecoverContracts(candidates []recoveryCandidate) []modules.RenterContract {
+	hosts := make(map[string]modules.HostDBEntry)
+	for _, host := range c.hdb.AllHosts() {
+		hosts[host.PublicKey.String()] = host
+	}
+
+	var recovered []modules.RenterContract
+	for _, rc := range candidates {
+		contract := rc.contract
+		c.mu.RLock()
+		_, current := c.contracts[contract.ID]
+		_, old := c.oldContracts[contract.ID]
+		ended := c.blockHeight > contract.FileContract.WindowStart
+		c.mu.RUnlock()
+		if current || old || ended {
+			continue
+		}
+		host, exists := hosts[rc.hostKey.String()]
+		if !exists {
+			c.log.Printf("WARN: could not recover contract %v: no record of its host", contract.ID)
+			continue
+		}
+		txn, roots, err := proto.SectorRoots(host, contract.ID, contract.SecretKey)
+		if err != nil {
+			c.log.Printf("WARN: could not recover contract %v with %v: %v", contract.ID, host.NetAddress, err)
+			continue
+		}
+		contract.LastRevision = txn.FileContractRevisions[0]
+		contract.LastRevisionTxn = txn
+		contract.MerkleRoots = roots
+		contract.HostPublicKey = host.PublicKey
+		contract.NetAddress = host.NetAddress
+		recovered = append(recovered, contract)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, contract := range recovered {
+		c.addContract(contract)
+		c.cachedRevisions[contract.ID] = cachedRevision{contract.LastRevision, contract.MerkleRoots}
+		c.log.Printf("Recovered contract %v with %v", contract.ID, contract.NetAddress)
+	}
+
+	// Keep the contract with each host that ends last.
+	latest := make(map[string]modules.RenterContract)
+	for _, contract := range c.contracts {
+		key := contractHostKey(contract)
+		if len(key.Key) == 0 {
+			continue
+		}
+		if l, exists := latest[key.String()]; !exists || contract.EndHeight() > l.EndHeight() {
+			latest[key.String()] = contract
+		}
+	}
+	for id, contract := range c.contracts {
+		key := contractHostKey(contract)
+		if l, exists := latest[key.String()]; exists && l.ID != id {
+			c.removeContract(id)
+			c.oldContracts[id] = contract
+			c.renewedIDs[id] = l.ID
+		}
+	}
+	for key, l := range latest {
+		c.hostContracts[key] = l.ID
+	}
+	// Candidates that have ended were renewed by the current contract with
+	// their host, if there is one.
+	for _, rc := range candidates {
+		id := rc.contract.ID
+		l, exists := latest[rc.hostKey.String()]
+		if _, renewed := c.renewedIDs[id]; !exists || renewed || l.ID == id {
+			continue
+		}
+		if _, current := c.contracts[id]; !current {
+			c.renewedIDs[id] = l.ID
+		}
+	}
+	if err := c.saveSync(); err != nil {
+		c.log.Println("Unable to save recovered contracts:", err)
+	}
+	return recovered
+}
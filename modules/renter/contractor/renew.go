@@ -10,15 +10,48 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// A Retainer reports how many of the sectors stored with a host are still
+// needed at a given height. The renter implements Retainer, so that only the
+// data of files that have not expired is carried over to renewed contracts.
+type Retainer interface {
+	RetainedSectors(host types.SiaPublicKey, height types.BlockHeight) uint64
+}
+
+// renewSectors returns the number of sectors of new storage to allocate when
+// renewing contract, given an allocation of numSectors per contract. The
+// retained sectors are carried over to the renewed contract and paid for in
+// addition to its allocation, so they are subtracted from it. The allocation
+// still covers the sectors stored under the contract, because the collateral
+// of the renewed contract may not be smaller than the collateral of the data
+// that is carried over.
+func renewSectors(contract modules.RenterContract, numSectors, retained uint64) uint64 {
+	if retained < numSectors {
+		numSectors -= retained
+	} else {
+		numSectors = 0
+	}
+	if stored := contract.LastRevision.NewFileSize / modules.SectorSize; numSectors < stored {
+		numSectors = stored
+	}
+	if numSectors == 0 {
+		numSectors = 1
+	}
+	return numSectors
+}
+
 // managedRenew negotiates a new contract for data already stored with a host.
-// It returns the new contract. This is a blocking call that performs network
-// I/O.
-func (c *Contractor) managedRenew(contract modules.RenterContract, numSectors uint64, newEndHeight types.BlockHeight) (modules.RenterContract, error) {
-	host, ok := c.hdb.Host(contract.NetAddress)
+// It returns the new contract. The host's prices may not exceed the maximum
+// prices of the allowance. This is a blocking call that performs network I/O.
+func (c *Contractor) managedRenew(contract modules.RenterContract, numSectors uint64, newEndHeight types.BlockHeight, a modules.Allowance) (modules.RenterContract, error) {
+	host, ok := c.hdb.Host(contract.HostPublicKey)
 	if !ok {
 		return modules.RenterContract{}, errors.New("no record of that host")
+	} else if c.hdb.IsFiltered(contract.HostPublicKey) {
+		return modules.RenterContract{}, errHostFiltered
 	} else if host.StoragePrice.Cmp(maxStoragePrice) > 0 {
 		return modules.RenterContract{}, errTooExpensive
+	} else if err := a.CheckPrices(host.HostExternalSettings); err != nil {
+		return modules.RenterContract{}, err
 	}
 	// cap host.MaxCollateral
 	if host.MaxCollateral.Cmp(maxCollateral) > 0 {
@@ -31,6 +64,13 @@ func (c *Contractor) managedRenew(contract modules.RenterContract, numSectors ui
 		return modules.RenterContract{}, err
 	}
 
+	// derive a new key for the renewed contract, so that it cannot be linked
+	// to the old contract on the blockchain
+	sk, err := c.managedNextContractKey(host.PublicKey)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+
 	// create contract params
 	c.mu.RLock()
 	params := proto.ContractParams{
@@ -39,6 +79,8 @@ func (c *Contractor) managedRenew(contract modules.RenterContract, numSectors ui
 		StartHeight:   c.blockHeight,
 		EndHeight:     newEndHeight,
 		RefundAddress: uc.UnlockHash(),
+		SecretKey:     sk,
+		Allowance:     a,
 	}
 	c.mu.RUnlock()
 
@@ -55,20 +97,39 @@ func (c *Contractor) managedRenew(contract modules.RenterContract, numSectors ui
 }
 
 // managedRenewContracts renews any contracts that are up for renewal, using
-// the current allowance.
+// the current allowance. Contracts that store data, none of which is retained
+// past the end of the contract, are not renewed; they expire along with their
+// data, and are then replaced by new contracts.
 func (c *Contractor) managedRenewContracts() error {
 	c.mu.RLock()
 	// Renew contracts when they enter the renew window.
 	// NOTE: offline contracts are not considered here, since we may have
 	// replaced them (and we probably won't be able to connect to their host
-	// anyway)
-	var renewSet []types.FileContractID
-	for _, contract := range c.onlineContracts() {
+	// anyway). Neither are contracts whose hosts should be replaced.
+	var candidates []modules.RenterContract
+	for _, contract := range c.usableContracts() {
 		if c.blockHeight+c.allowance.RenewWindow >= contract.EndHeight() {
-			renewSet = append(renewSet, contract.ID)
+			candidates = append(candidates, contract)
 		}
 	}
+	retainer := c.retainer
 	c.mu.RUnlock()
+
+	// Ask the retainer how much of the data of each contract is still needed
+	// once the contract ends. The retainer is called without holding the
+	// lock, since it may call back into the contractor.
+	var renewSet []types.FileContractID
+	retained := make(map[types.FileContractID]uint64)
+	for _, contract := range candidates {
+		if retainer != nil {
+			retained[contract.ID] = retainer.RetainedSectors(contract.HostPublicKey, contract.EndHeight())
+			if retained[contract.ID] == 0 && contract.LastRevision.NewFileSize != 0 {
+				c.log.Debugln("not renewing contract with", contract.NetAddress, "because none of its data is retained")
+				continue
+			}
+		}
+		renewSet = append(renewSet, contract.ID)
+	}
 	if len(renewSet) == 0 {
 		// nothing to do
 		return nil
@@ -77,8 +138,9 @@ func (c *Contractor) managedRenewContracts() error {
 	c.log.Printf("renewing %v contracts", len(renewSet))
 
 	c.mu.RLock()
-	endHeight := c.blockHeight + c.allowance.Period
-	max, err := maxSectors(c.allowance, c.hdb, c.tpool)
+	allowance := c.allowance
+	endHeight := c.blockHeight + allowance.Period
+	max, err := maxSectors(allowance, c.hdb, c.tpool)
 	c.mu.RUnlock()
 	if err != nil {
 		return err
@@ -136,7 +198,7 @@ func (c *Contractor) managedRenewContracts() error {
 	// map old ID to new contract, for easy replacement later
 	newContracts := make(map[types.FileContractID]modules.RenterContract)
 	for _, contract := range oldContracts {
-		newContract, err := c.managedRenew(contract, numSectors, endHeight)
+		newContract, err := c.managedRenew(contract, renewSectors(contract, numSectors, retained[contract.ID]), endHeight, allowance)
 		if err != nil {
 			c.log.Printf("WARN: failed to renew contract with %v: %v", contract.NetAddress, err)
 		} else {
@@ -154,10 +216,10 @@ func (c *Contractor) managedRenewContracts() error {
 		// archive the old contract
 		if oldContract, ok := c.contracts[oldID]; ok {
 			c.oldContracts[oldID] = oldContract
-			delete(c.contracts, oldID)
+			c.removeContract(oldID)
 		}
 		// insert the new contract
-		c.contracts[contract.ID] = contract
+		c.addContract(contract)
 		// add a mapping from old->new contract
 		c.renewedIDs[oldID] = contract.ID
 	}
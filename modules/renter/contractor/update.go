@@ -34,7 +34,7 @@ func (c *Contractor) ProcessConsensusChange(cc modules.ConsensusChange) {
 	}
 	// delete expired contracts (can't delete while iterating)
 	for _, id := range expired {
-		delete(c.contracts, id)
+		c.removeContract(id)
 		c.log.Println("INFO: archived expired contract", id)
 	}
 
@@ -75,10 +75,11 @@ func (c *Contractor) ProcessConsensusChange(cc modules.ConsensusChange) {
 				c.log.Debugln("WARN: failed to renew contracts after processing a consensus chage:", err)
 			}
 
-			// if we don't have enough (online) contracts, form new ones
+			// if we don't have enough (online) contracts whose hosts need no
+			// replacement, form new ones
 			c.mu.RLock()
 			a := c.allowance
-			remaining := int(a.Hosts) - len(c.onlineContracts())
+			remaining := int(a.Hosts) - len(c.usableContracts())
 			c.mu.RUnlock()
 			if remaining <= 0 {
 				return
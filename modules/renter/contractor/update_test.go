@@ -120,6 +120,98 @@ func TestIntegrationAutoRenew(t *testing.T) {
 	}
 }
 
+// retainNothing is a Retainer that does not retain any data.
+type retainNothing struct{}
+
+func (retainNothing) RetainedSectors(types.SiaPublicKey, types.BlockHeight) uint64 { return 0 }
+
+// TestIntegrationSelectiveRenew tests that contracts whose data is not
+// retained past their end are not renewed.
+func TestIntegrationSelectiveRenew(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	_, c, m, err := newTestingTrio("TestIntegrationSelectiveRenew")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetRetainer(retainNothing{})
+
+	// form a contract with the host
+	a := modules.Allowance{
+		Funds:       types.SiacoinPrecision.Mul64(100), // 100 SC
+		Hosts:       1,
+		Period:      50,
+		RenewWindow: 10,
+	}
+	err = c.SetAllowance(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := c.Contracts()[0]
+
+	// upload a sector to the contract
+	editor, err := c.Editor(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := crypto.RandBytes(int(modules.SectorSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := editor.Upload(data); err != nil {
+		t.Fatal(err)
+	}
+	err = editor.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mine until we enter the renew window
+	renewHeight := contract.EndHeight() - c.allowance.RenewWindow
+	for c.blockHeight < renewHeight {
+		_, err := m.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// wait for goroutine in ProcessConsensusChange to finish
+	time.Sleep(100 * time.Millisecond)
+	c.editLock.Lock()
+	c.editLock.Unlock()
+
+	// the contract should not have been renewed
+	if contracts := c.Contracts(); len(contracts) != 1 || contracts[0].ID != contract.ID {
+		t.Fatal("contract was renewed even though none of its data is retained")
+	}
+}
+
+// TestRenewSectors tests that the allocation of a renewed contract accounts
+// for the data that is retained.
+func TestRenewSectors(t *testing.T) {
+	var stored modules.RenterContract
+	stored.LastRevision.NewFileSize = 30 * modules.SectorSize
+	tests := []struct {
+		contract   modules.RenterContract
+		numSectors uint64
+		retained   uint64
+		expected   uint64
+	}{
+		{modules.RenterContract{}, 100, 0, 100},
+		{modules.RenterContract{}, 100, 40, 60},
+		{modules.RenterContract{}, 100, 200, 1},
+		{stored, 100, 20, 80},
+		{stored, 100, 90, 30},
+	}
+	for _, test := range tests {
+		if n := renewSectors(test.contract, test.numSectors, test.retained); n != test.expected {
+			t.Errorf("expected %v sectors with %v retained out of %v, got %v", test.expected, test.retained, test.numSectors, n)
+		}
+	}
+}
+
 // TestIntegrationRenewInvalidate tests that editors and downloaders are
 // properly invalidated when a renew is queued.
 func TestIntegrationRenewInvalidate(t *testing.T) {
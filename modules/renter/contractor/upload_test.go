@@ -11,11 +11,11 @@ import (
 // editorHostDB is used to test the Editor method.
 type editorHostDB struct {
 	stubHostDB
-	hosts map[modules.NetAddress]modules.HostDBEntry
+	hosts map[string]modules.HostDBEntry
 }
 
-func (hdb editorHostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool) {
-	h, ok := hdb.hosts[addr]
+func (hdb editorHostDB) Host(pk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	h, ok := hdb.hosts[pk.String()]
 	return h, ok
 }
 
@@ -24,7 +24,7 @@ func (hdb editorHostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool
 func TestEditor(t *testing.T) {
 	// use a mock hostdb to supply hosts
 	hdb := &editorHostDB{
-		hosts: make(map[modules.NetAddress]modules.HostDBEntry),
+		hosts: make(map[string]modules.HostDBEntry),
 	}
 	c := &Contractor{
 		hdb:       hdb,
@@ -56,8 +56,8 @@ func TestEditor(t *testing.T) {
 	}
 	dbe.AcceptingContracts = true
 	dbe.StoragePrice = types.NewCurrency64(^uint64(0))
-	hdb.hosts["foo"] = dbe
-	contract := modules.RenterContract{NetAddress: "foo"}
+	hdb.hosts[dbe.PublicKey.String()] = dbe
+	contract := modules.RenterContract{HostPublicKey: dbe.PublicKey}
 	c.contracts[contract.ID] = contract
 	_, err = c.Editor(contract.ID)
 	if err == nil {
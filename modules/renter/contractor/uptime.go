@@ -37,18 +37,12 @@ func (c *Contractor) IsOffline(id types.FileContractID) bool {
 // isOffline indicates whether a contract's host should be considered offline,
 // based on its scan metrics.
 func (c *Contractor) isOffline(id types.FileContractID) bool {
-	// Get the net address associated with the contract.
-	//
-	// TODO: This should eventually be updated to query the host by public key.
+	// Get the public key of the host of the contract.
 	contract, exists := c.contracts[id]
 	if !exists {
 		return false
 	}
-	addr := contract.NetAddress
-	// Look up the host by address.
-	//
-	// TODO: Eventually the host should be getting queried by public key.
-	host, ok := c.hdb.Host(addr)
+	host, ok := c.hdb.Host(contract.HostPublicKey)
 	if !ok {
 		return false
 	}
@@ -89,6 +83,33 @@ func (c *Contractor) isOffline(id types.FileContractID) bool {
 	return windowEnd.Sub(windowStart) >= uptimeWindow
 }
 
+// ShouldReplace indicates whether a contract's host should be replaced,
+// because it is excluded by the host filter of the hostdb or because its
+// prices exceed the maximum prices of the allowance.
+func (c *Contractor) ShouldReplace(id types.FileContractID) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.shouldReplace(id)
+}
+
+// shouldReplace indicates whether a contract's host should be replaced. The
+// contract is not renewed, and the data stored with the host is repaired onto
+// other hosts, but the data can still be downloaded from the host until then.
+func (c *Contractor) shouldReplace(id types.FileContractID) bool {
+	contract, exists := c.contracts[id]
+	if !exists {
+		return false
+	}
+	if c.hdb.IsFiltered(contract.HostPublicKey) {
+		return true
+	}
+	host, ok := c.hdb.Host(contract.HostPublicKey)
+	if !ok {
+		return false
+	}
+	return c.allowance.CheckPrices(host.HostExternalSettings) != nil
+}
+
 // onlineContracts returns the subset of the Contractor's contracts whose
 // hosts are considered online.
 func (c *Contractor) onlineContracts() []modules.RenterContract {
@@ -100,3 +121,15 @@ func (c *Contractor) onlineContracts() []modules.RenterContract {
 	}
 	return cs
 }
+
+// usableContracts returns the subset of the Contractor's contracts whose
+// hosts are online and should not be replaced.
+func (c *Contractor) usableContracts() []modules.RenterContract {
+	var cs []modules.RenterContract
+	for _, contract := range c.onlineContracts() {
+		if !c.shouldReplace(contract.ID) {
+			cs = append(cs, contract)
+		}
+	}
+	return cs
+}
@@ -16,11 +16,11 @@ type offlineHostDB struct {
 	addr modules.NetAddress
 }
 
-// Host returns the host with address addr. If addr matches hdb.addr, the
-// host's scan history will be modified to make the host appear offline.
-func (hdb offlineHostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool) {
-	host, ok := hdb.hostDB.Host(addr)
-	if ok && addr == hdb.addr {
+// Host returns the host with public key pk. If the host has address hdb.addr,
+// the host's scan history will be modified to make the host appear offline.
+func (hdb offlineHostDB) Host(pk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	host, ok := hdb.hostDB.Host(pk)
+	if ok && host.NetAddress == hdb.addr {
 		// fake three scans over the past uptimeWindow, all of which failed
 		badScan1 := modules.HostDBScan{Timestamp: time.Now().Add(-uptimeWindow * 2), Success: false}
 		badScan2 := modules.HostDBScan{Timestamp: time.Now().Add(-uptimeWindow), Success: false}
@@ -104,11 +104,11 @@ func TestIntegrationReplaceOffline(t *testing.T) {
 // mapHostDB is a hostDB that implements the Host method via a simple map.
 type mapHostDB struct {
 	stubHostDB
-	hosts map[modules.NetAddress]modules.HostDBEntry
+	hosts map[string]modules.HostDBEntry
 }
 
-func (m mapHostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool) {
-	h, e := m.hosts[addr]
+func (m mapHostDB) Host(pk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	h, e := m.hosts[pk.String()]
 	return h, e
 }
 
@@ -143,15 +143,16 @@ func TestIsOffline(t *testing.T) {
 		// recent scan was good, old scans were bad.
 		{[]modules.HostDBScan{oldBadScan, newBadScan, currentBadScan, currentGoodScan}, false},
 	}
+	hostKey := types.SiaPublicKey{Key: []byte("foo")}
 	for i, test := range tests {
 		// construct a contractor with a hostdb containing the scans
 		c := &Contractor{
 			contracts: map[types.FileContractID]modules.RenterContract{
-				types.FileContractID{1}: {NetAddress: "foo"},
+				types.FileContractID{1}: {HostPublicKey: hostKey},
 			},
 			hdb: mapHostDB{
-				hosts: map[modules.NetAddress]modules.HostDBEntry{
-					"foo": {ScanHistory: test.scans},
+				hosts: map[string]modules.HostDBEntry{
+					hostKey.String(): {ScanHistory: test.scans},
 				},
 			},
 		}
@@ -160,3 +161,50 @@ func TestIsOffline(t *testing.T) {
 		}
 	}
 }
+
+// filteredHostDB is a hostDB whose filter excludes every host. Like the real
+// hostdb, it never selects a filtered host.
+type filteredHostDB struct {
+	mapHostDB
+}
+
+func (filteredHostDB) IsFiltered(types.SiaPublicKey) bool { return true }
+func (filteredHostDB) RandomHosts(int, []types.SiaPublicKey) []modules.HostDBEntry {
+	return nil
+}
+
+// TestFilteredHosts checks that contracts with hosts that are excluded by the
+// host filter are replaced without being considered offline, and that no
+// contracts are formed with or renewed with such hosts.
+func TestFilteredHosts(t *testing.T) {
+	contract := modules.RenterContract{ID: types.FileContractID{1}, HostPublicKey: types.SiaPublicKey{Key: []byte("foo")}}
+	c := &Contractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			contract.ID: contract,
+		},
+		hdb: filteredHostDB{mapHostDB{
+			hosts: map[string]modules.HostDBEntry{
+				contract.HostPublicKey.String(): {},
+			},
+		}},
+	}
+	if c.IsOffline(contract.ID) {
+		t.Error("contract with a filtered host is offline")
+	}
+	if !c.ShouldReplace(contract.ID) {
+		t.Error("contract with a filtered host should be replaced")
+	}
+	// The contract is still used to download the data stored with the host.
+	if len(c.Contracts()) != 1 {
+		t.Error("contract with a filtered host was not returned by Contracts")
+	}
+	if len(c.usableContracts()) != 0 {
+		t.Error("contract with a filtered host is usable")
+	}
+	if _, err := c.managedRenew(contract, 1, 100, modules.Allowance{}); err != errHostFiltered {
+		t.Error("expected filtered host error, got", err)
+	}
+	if _, err := c.managedFormContracts(1, 1, 100, modules.Allowance{}); err == nil {
+		t.Error("contract was formed with a filtered host")
+	}
+}
@@ -0,0 +1,266 @@
+package renter
+
+// Files that are uploaded with deduplication enabled encrypt each chunk with a
+// key derived from the hash of the chunk's content (convergent encryption)
+// instead of the file's master key. Identical chunks therefore produce
+// identical pieces, which allows them to be shared between files. The renter
+// keeps an index of the deduplicated chunks, keyed by the hash of their
+// content, erasure code and piece size, that records the pieces of each chunk and the files that refer to
+// it. The pieces of a chunk are added to every file that refers to the chunk,
+// so a chunk that is already stored on the network is not uploaded again.
+// Once the last file that refers to a chunk is deleted, the chunk is removed
+// from the index and its sectors are deleted from the hosts.
+//
+// The index is not persisted. It is rebuilt from the deduplicated files when
+// the renter is loaded.
+
+import (
+	"errors"
+	"os"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// errDedupChunkChanged is returned when the local source of a chunk of a
+	// deduplicated file no longer matches the content of the chunk when it
+	// was uploaded.
+	errDedupChunkChanged = errors.New("local source of deduplicated chunk has changed since it was uploaded")
+
+	// errDedupPackedFile is returned when a file is uploaded with both
+	// packing and deduplication enabled.
+	errDedupPackedFile = errors.New("files cannot be both packed and deduplicated")
+)
+
+// A dedupChunk is an entry in the index of deduplicated chunks.
+type dedupChunk struct {
+	// contracts contains the pieces of the chunk stored under each contract.
+	// The Chunk field of each piece is zero.
+	contracts map[types.FileContractID]fileContract
+
+	// refs contains the indices of the chunks of each file that refer to the
+	// chunk. The chunk is released once no file refers to it.
+	refs map[*file][]uint64
+}
+
+// addPiece adds a piece to a contract unless the contract already stores the
+// same piece. false is returned if the piece was already present.
+func (fc *fileContract) addPiece(piece pieceData) bool {
+	for _, p := range fc.Pieces {
+		if p.Chunk == piece.Chunk && p.Piece == piece.Piece && p.MerkleRoot == piece.MerkleRoot {
+			return false
+		}
+	}
+	fc.Pieces = append(fc.Pieces, piece)
+	return true
+}
+
+// hashChunks returns the hashes of the content of each chunk of a file, read
+// from the file's local source. The last chunk is padded with zeroes, as it
+// is when the chunk is uploaded.
+func hashChunks(path string, f *file) ([]crypto.Hash, error) {
+	hashes := make([]crypto.Hash, f.numChunks())
+	for i := range hashes {
+		chunkData, err := readChunk(path, f, uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = crypto.HashBytes(chunkData)
+	}
+	return hashes, nil
+}
+
+// managedUploadDeduplicated adds a file whose chunks are shared with other
+// deduplicated files to the renter. Chunks that are already in the index are
+// not uploaded again.
+func (r *Renter) managedUploadDeduplicated(up modules.FileUploadParams, size uint64, mode os.FileMode) error {
+	f := newFile(up.SiaPath, up.ErasureCode, pieceSize, size)
+	f.mode = uint32(mode)
+	f.expireHeight = up.ExpirationHeight
+	hashes, err := hashChunks(up.Source, f)
+	if err != nil {
+		return build.ExtendErr("unable to hash chunks of file", err)
+	}
+	f.setChunkHashes(hashes)
+
+	lockID := r.mu.Lock()
+	if err := r.replaceFile(up.SiaPath, up.Versioned); err != nil {
+		r.mu.Unlock(lockID)
+		return err
+	}
+	r.addFileEntry(up.SiaPath, f)
+	r.tracking[up.SiaPath] = trackedFile{
+		RepairPath: up.Source,
+	}
+	r.linkDedupChunks(f)
+	r.saveSync()
+	r.saveArchive()
+	f.mu.RLock()
+	err = r.saveFile(f)
+	f.mu.RUnlock()
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return err
+	}
+
+	// Send the upload to the repair loop, which uploads the chunks that were
+	// not yet stored on the network.
+	r.newRepairs <- f
+	return nil
+}
+
+// linkDedupChunks adds a deduplicated file to the index. The pieces of the
+// file are shared with the other files that refer to the same chunks, and the
+// pieces that are already stored for those chunks are added to the file. f
+// must not be locked.
+func (r *Renter) linkDedupChunks(f *file) {
+	if len(f.dedupKeys) == 0 {
+		return
+	}
+	for i, h := range f.dedupKeys {
+		dc, exists := r.dedupChunks[h]
+		if !exists {
+			dc = &dedupChunk{
+				contracts: make(map[types.FileContractID]fileContract),
+				refs:      make(map[*file][]uint64),
+			}
+			r.dedupChunks[h] = dc
+		}
+		dc.refs[f] = append(dc.refs[f], uint64(i))
+	}
+
+	// Share the pieces of the file.
+	f.mu.RLock()
+	var contracts []fileContract
+	for _, fc := range f.contracts {
+		contracts = append(contracts, fc)
+	}
+	f.mu.RUnlock()
+	for _, fc := range contracts {
+		for _, p := range fc.Pieces {
+			if !p.Unavailable {
+				r.shareDedupPiece(f, fc, p)
+			}
+		}
+	}
+
+	// Add the pieces of the chunks to the file.
+	f.mu.Lock()
+	for i, h := range f.dedupKeys {
+		for _, dfc := range r.dedupChunks[h].contracts {
+			for _, p := range dfc.Pieces {
+				p.Chunk = uint64(i)
+				addContractPiece(f.contracts, dfc, p)
+			}
+		}
+	}
+	f.mu.Unlock()
+}
+
+// addContractPiece adds a piece to the contract with the ID of fc, creating
+// the contract if necessary. false is returned if the contract already
+// stores the piece.
+func addContractPiece(contracts map[types.FileContractID]fileContract, fc fileContract, piece pieceData) bool {
+	c, exists := contracts[fc.ID]
+	if !exists {
+		c = fileContract{
+			ID:            fc.ID,
+			HostPublicKey: fc.HostPublicKey,
+			WindowStart:   fc.WindowStart,
+		}
+	}
+	if !c.addPiece(piece) {
+		return false
+	}
+	contracts[fc.ID] = c
+	return true
+}
+
+// shareDedupPiece adds a piece of a deduplicated file, stored under the
+// contract described by fc, to the index and to every file that refers to
+// the same chunk. The files that gain a piece are saved. None of the files
+// may be locked.
+func (r *Renter) shareDedupPiece(f *file, fc fileContract, piece pieceData) {
+	dc, exists := r.dedupChunks[f.dedupKeys[piece.Chunk]]
+	if !exists {
+		return
+	}
+	piece.Chunk = 0
+	if !addContractPiece(dc.contracts, fc, piece) {
+		return
+	}
+	for rf, chunks := range dc.refs {
+		rf.mu.Lock()
+		changed := false
+		for _, i := range chunks {
+			piece.Chunk = i
+			if addContractPiece(rf.contracts, fc, piece) {
+				changed = true
+			}
+		}
+		if changed {
+			r.persistFile(rf)
+		}
+		rf.mu.Unlock()
+	}
+}
+
+// dropDedupPiece removes a piece that a host has lost from the index, and
+// marks the piece as unavailable in every file that refers to the same
+// chunk. f must not be locked.
+func (r *Renter) dropDedupPiece(f *file, contractID types.FileContractID, piece pieceData) {
+	dc, exists := r.dedupChunks[f.dedupKeys[piece.Chunk]]
+	if !exists {
+		return
+	}
+	if fc, exists := dc.contracts[contractID]; exists {
+		for i, p := range fc.Pieces {
+			if p.Piece == piece.Piece && p.MerkleRoot == piece.MerkleRoot {
+				fc.Pieces = append(fc.Pieces[:i], fc.Pieces[i+1:]...)
+				break
+			}
+		}
+		dc.contracts[contractID] = fc
+	}
+	for rf := range dc.refs {
+		rf.mu.Lock()
+		fc := rf.contracts[contractID]
+		changed := false
+		for i, p := range fc.Pieces {
+			if p.Piece == piece.Piece && p.MerkleRoot == piece.MerkleRoot && !p.Unavailable {
+				fc.Pieces[i].Unavailable = true
+				changed = true
+			}
+		}
+		if changed {
+			r.persistFile(rf)
+		}
+		rf.mu.Unlock()
+	}
+}
+
+// unlinkDedupChunks removes a file that is being deleted from the index.
+// Chunks that no longer have any references are removed from the index, and
+// their sectors are deleted from the hosts in the background.
+func (r *Renter) unlinkDedupChunks(f *file) {
+	var released []fileContract
+	for _, h := range f.dedupKeys {
+		dc, exists := r.dedupChunks[h]
+		if !exists {
+			continue
+		}
+		delete(dc.refs, f)
+		if len(dc.refs) == 0 {
+			delete(r.dedupChunks, h)
+			for _, fc := range dc.contracts {
+				released = append(released, fc)
+			}
+		}
+	}
+	if len(released) != 0 {
+		go r.threadedDeleteSectors(released)
+	}
+}
@@ -0,0 +1,250 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestPieceKey checks that the pieces of deduplicated chunks are encrypted
+// with keys that depend on the content of the chunk, and not on the file or
+// the position of the chunk.
+func TestPieceKey(t *testing.T) {
+	masterKey1, _ := crypto.GenerateTwofishKey()
+	masterKey2, _ := crypto.GenerateTwofishKey()
+	hashes1 := []crypto.Hash{{1}, {2}}
+	hashes2 := []crypto.Hash{{2}, {1}}
+
+	if pieceKey(masterKey1, hashes1, 0, 3) != pieceKey(masterKey2, hashes2, 1, 3) {
+		t.Error("identical chunks have different keys")
+	}
+	if pieceKey(masterKey1, hashes1, 0, 3) == pieceKey(masterKey1, hashes1, 1, 3) {
+		t.Error("different chunks have the same key")
+	}
+	if pieceKey(masterKey1, hashes1, 0, 3) == pieceKey(masterKey1, hashes1, 0, 4) {
+		t.Error("different pieces have the same key")
+	}
+	if pieceKey(masterKey1, nil, 0, 3) != deriveKey(masterKey1, 0, 3) {
+		t.Error("files that are not deduplicated should use the master key")
+	}
+}
+
+// TestDedupIndex checks that deduplicated files share the pieces of identical
+// chunks, and that chunks are released once no file refers to them.
+func TestDedupIndex(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestDedupIndex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file of two chunks with a piece of each chunk on a host.
+	rsc, _ := NewRSCode(1, 1)
+	h1, h2, h3 := crypto.Hash{1}, crypto.Hash{2}, crypto.Hash{3}
+	f1 := newFile("foo", rsc, pieceSize, pieceSize*2)
+	f1.setChunkHashes([]crypto.Hash{h1, h2})
+	f1.contracts[types.FileContractID{1}] = fileContract{
+		ID:            types.FileContractID{1},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("foo")},
+		Pieces: []pieceData{
+			{Chunk: 0, Piece: 0, MerkleRoot: crypto.Hash{4}},
+			{Chunk: 1, Piece: 0, MerkleRoot: crypto.Hash{5}},
+		},
+	}
+
+	// Create a file whose first and last chunks are identical to the second
+	// chunk of the first file.
+	f2 := newFile("bar", rsc, pieceSize, pieceSize*3)
+	f2.setChunkHashes([]crypto.Hash{h2, h3, h2})
+
+	id := rt.renter.mu.Lock()
+	rt.renter.addFileEntry(f1.name, f1)
+	rt.renter.addFileEntry(f2.name, f2)
+	rt.renter.linkDedupChunks(f1)
+	rt.renter.linkDedupChunks(f2)
+	rt.renter.mu.Unlock(id)
+
+	f2.mu.RLock()
+	if f2.numChunkPieces(0) != 1 || f2.numChunkPieces(1) != 0 || f2.numChunkPieces(2) != 1 {
+		t.Error("pieces of identical chunks were not shared:", f2.contracts)
+	}
+	for _, p := range f2.contracts[types.FileContractID{1}].Pieces {
+		if p.MerkleRoot != (crypto.Hash{5}) {
+			t.Error("wrong piece was shared:", p)
+		}
+	}
+	f2.mu.RUnlock()
+
+	// A file with an identical chunk but a different erasure code should not
+	// share its pieces.
+	rsc2, _ := NewRSCode(1, 2)
+	f3 := newFile("baz", rsc2, pieceSize, pieceSize)
+	f3.setChunkHashes([]crypto.Hash{h2})
+	id = rt.renter.mu.Lock()
+	rt.renter.addFileEntry(f3.name, f3)
+	rt.renter.linkDedupChunks(f3)
+	rt.renter.mu.Unlock(id)
+	f3.mu.RLock()
+	if f3.numChunkPieces(0) != 0 {
+		t.Error("pieces were shared between different erasure codes:", f3.contracts)
+	}
+	f3.mu.RUnlock()
+	if err := rt.renter.DeleteFile("baz"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A piece uploaded for the second file should be shared with the first
+	// file.
+	id = rt.renter.mu.Lock()
+	fc := fileContract{ID: types.FileContractID{2}, HostPublicKey: types.SiaPublicKey{Key: []byte("bar")}}
+	rt.renter.shareDedupPiece(f2, fc, pieceData{Chunk: 2, Piece: 1, MerkleRoot: crypto.Hash{6}})
+	rt.renter.mu.Unlock(id)
+	f1.mu.RLock()
+	if f1.numChunkPieces(1) != 2 || f1.numChunkPieces(0) != 1 {
+		t.Error("uploaded piece was not shared:", f1.contracts)
+	}
+	f1.mu.RUnlock()
+	f2.mu.RLock()
+	if f2.numChunkPieces(0) != 2 || f2.numChunkPieces(2) != 2 {
+		t.Error("uploaded piece was not added to identical chunks of the same file:", f2.contracts)
+	}
+	f2.mu.RUnlock()
+
+	// Deleting the first file should only release its unshared chunk.
+	if err := rt.renter.DeleteFile("foo"); err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.RLock()
+	_, exists1 := rt.renter.dedupChunks[f1.dedupKeys[0]]
+	dc2, exists2 := rt.renter.dedupChunks[f1.dedupKeys[1]]
+	rt.renter.mu.RUnlock(id)
+	if exists1 {
+		t.Error("unshared chunk was not released")
+	}
+	if !exists2 || len(dc2.refs) != 1 || len(dc2.refs[f2]) != 2 {
+		t.Fatal("shared chunk has wrong references")
+	}
+
+	// Deleting the second file should release every chunk.
+	if err := rt.renter.DeleteFile("bar"); err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.RLock()
+	remaining := len(rt.renter.dedupChunks)
+	rt.renter.mu.RUnlock(id)
+	if remaining != 0 {
+		t.Error("expected every chunk to be released, got", remaining)
+	}
+}
+
+// TestDedupUpload checks that identical files uploaded with deduplication
+// refer to the same chunks, and that the index is rebuilt when the renter is
+// reloaded.
+func TestDedupUpload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestDedupUpload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a local file of two identical chunks.
+	rsc, _ := NewRSCode(1, 1)
+	data := make([]byte, pieceSize)
+	copy(data, "foo")
+	data = append(data, data...)
+	source := filepath.Join(build.SiaTestingDir, "renter", "TestDedupUpload", "source")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, siaPath := range []string{"foo", "bar"} {
+		err = rt.renter.Upload(modules.FileUploadParams{
+			Source:      source,
+			SiaPath:     siaPath,
+			ErasureCode: rsc,
+			Dedup:       true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = rt.renter.Upload(modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     "baz",
+		ErasureCode: rsc,
+		Dedup:       true,
+		Pack:        true,
+	})
+	if err != errDedupPackedFile {
+		t.Fatal("expected errDedupPackedFile, got", err)
+	}
+
+	id := rt.renter.mu.RLock()
+	foo, bar := rt.renter.files["foo"], rt.renter.files["bar"]
+	numChunks := len(rt.renter.dedupChunks)
+	rt.renter.mu.RUnlock(id)
+	if len(foo.chunkHashes) != 2 || foo.chunkHashes[0] != crypto.HashBytes(data[:pieceSize]) || foo.chunkHashes[0] != foo.chunkHashes[1] {
+		t.Fatal("wrong chunk hashes:", foo.chunkHashes)
+	}
+	if !bytes.Equal(foo.chunkHashes[0][:], bar.chunkHashes[0][:]) {
+		t.Fatal("identical files have different chunk hashes")
+	}
+	if numChunks != 1 {
+		t.Fatal("expected 1 chunk in the index, got", numChunks)
+	}
+
+	// Identical data uploaded with a different erasure code must not share
+	// the chunks of the other files, as its pieces differ.
+	rsc2, _ := NewRSCode(1, 2)
+	err = rt.renter.Upload(modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     "qux",
+		ErasureCode: rsc2,
+		Dedup:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.RLock()
+	qux := rt.renter.files["qux"]
+	numChunks = len(rt.renter.dedupChunks)
+	rt.renter.mu.RUnlock(id)
+	if qux.chunkHashes[0] != foo.chunkHashes[0] {
+		t.Fatal("identical data has different chunk hashes")
+	}
+	if qux.dedupKeys[0] == foo.dedupKeys[0] || numChunks != 2 {
+		t.Fatal("chunks with different erasure codes share an entry in the index")
+	}
+	if pieceKey(qux.masterKey, qux.dedupKeys, 0, 1) == pieceKey(foo.masterKey, foo.dedupKeys, 0, 1) {
+		t.Fatal("chunks with different erasure codes share piece keys")
+	}
+
+	// Reload the renter. The index should be rebuilt from the files.
+	id = rt.renter.mu.Lock()
+	rt.renter.files = make(map[string]*file)
+	rt.renter.dedupChunks = make(map[crypto.Hash]*dedupChunk)
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.RLock()
+	dc, exists := rt.renter.dedupChunks[foo.dedupKeys[0]]
+	numChunks = len(rt.renter.dedupChunks)
+	rt.renter.mu.RUnlock(id)
+	if !exists || len(dc.refs) != 2 || numChunks != 2 {
+		t.Fatal("index was not rebuilt")
+	}
+}
@@ -0,0 +1,511 @@
+package renter
+
+// The renter's files are keyed by their full siapath, which is a '/'
+// separated path. Directories are derived from those paths: a directory
+// exists if it is the root directory, if it has been created explicitly, or if
+// any file or explicitly created directory lives beneath it. Only explicitly
+// created directories are persisted, so that empty directories survive a
+// restart.
+//
+// The renter keeps an index of its files and explicitly created directories by
+// the directories that contain them, so that directory operations only visit
+// the files beneath the directory. Files and directories must be added to and
+// removed from the renter through addFileEntry, removeFileEntry, addDirEntry,
+// and removeDirEntry to keep the index up to date.
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// ErrDirExists is returned when creating or renaming a directory to a
+	// path that is already in use by another directory.
+	ErrDirExists = errors.New("a directory already exists at that location")
+
+	// ErrUnknownDir is returned when a directory cannot be found.
+	ErrUnknownDir = errors.New("no directory known with that path")
+
+	// errDirIntoItself is returned when a directory is renamed to a path
+	// inside of itself.
+	errDirIntoItself = errors.New("cannot move a directory inside of itself")
+
+	// errInvalidSiaPath is returned when a siapath contains an empty, '.', or
+	// '..' element, or begins or ends with a '/'.
+	errInvalidSiaPath = errors.New("siapath elements must be nonempty and cannot be '.' or '..'")
+
+	// errReservedSiaPath is returned when a file or directory is created in
+	// one of the directories that the renter keeps its own data in.
+	errReservedSiaPath = errors.New("siapath cannot begin with a reserved directory")
+
+	// errRootDir is returned when attempting to create, rename, or delete the
+	// root directory.
+	errRootDir = errors.New("cannot modify the root directory")
+
+	// reservedDirs are the directories within the renter's persist directory
+	// that the renter keeps its own data in. The .sia files of the renter's
+	// files share the persist directory, so no file or directory may be
+	// created beneath them.
+	reservedDirs = map[string]struct{}{
+		archiveDir:    {},
+		chunkCacheDir: {},
+		packsDir:      {},
+	}
+)
+
+// A dirIndex indexes the renter's files and explicitly created directories by
+// the directories that contain them.
+type dirIndex struct {
+	// entries counts the files and explicitly created directories beneath
+	// each directory, including the directory itself if it was created
+	// explicitly. A directory other than the root exists if its count is
+	// nonzero.
+	entries map[string]int
+
+	// files holds the siapaths of the files directly within each directory,
+	// and subdirs holds the siapaths of the immediate subdirectories of each
+	// directory.
+	files   map[string]map[string]struct{}
+	subdirs map[string]map[string]struct{}
+}
+
+// newDirIndex returns the index of a set of files and explicitly created
+// directories.
+func newDirIndex(files map[string]*file, dirs map[string]struct{}) dirIndex {
+	di := dirIndex{
+		entries: make(map[string]int),
+		files:   make(map[string]map[string]struct{}),
+		subdirs: make(map[string]map[string]struct{}),
+	}
+	for name := range files {
+		di.addFile(name)
+	}
+	for dir := range dirs {
+		di.addEntry(dir)
+	}
+	return di
+}
+
+// parentDir returns the directory that contains siaPath.
+func parentDir(siaPath string) string {
+	i := strings.LastIndex(siaPath, "/")
+	if i < 0 {
+		return ""
+	}
+	return siaPath[:i]
+}
+
+// addEntry counts an entry towards dir and each of its parent directories.
+func (di dirIndex) addEntry(dir string) {
+	for {
+		di.entries[dir]++
+		if dir == "" {
+			return
+		}
+		parent := parentDir(dir)
+		if di.entries[dir] == 1 {
+			if di.subdirs[parent] == nil {
+				di.subdirs[parent] = make(map[string]struct{})
+			}
+			di.subdirs[parent][dir] = struct{}{}
+		}
+		dir = parent
+	}
+}
+
+// removeEntry removes an entry from dir and each of its parent directories.
+// Directories that no longer contain any entries are removed from the index.
+func (di dirIndex) removeEntry(dir string) {
+	for {
+		di.entries[dir]--
+		if dir == "" {
+			return
+		}
+		parent := parentDir(dir)
+		if di.entries[dir] == 0 {
+			delete(di.entries, dir)
+			delete(di.subdirs[parent], dir)
+			if len(di.subdirs[parent]) == 0 {
+				delete(di.subdirs, parent)
+			}
+		}
+		dir = parent
+	}
+}
+
+// addFile adds the file at siaPath to the index.
+func (di dirIndex) addFile(siaPath string) {
+	dir := parentDir(siaPath)
+	if di.files[dir] == nil {
+		di.files[dir] = make(map[string]struct{})
+	}
+	di.files[dir][siaPath] = struct{}{}
+	di.addEntry(dir)
+}
+
+// removeFile removes the file at siaPath from the index.
+func (di dirIndex) removeFile(siaPath string) {
+	dir := parentDir(siaPath)
+	delete(di.files[dir], siaPath)
+	if len(di.files[dir]) == 0 {
+		delete(di.files, dir)
+	}
+	di.removeEntry(dir)
+}
+
+// filesWithin returns the siapaths of the files beneath dir.
+func (di dirIndex) filesWithin(dir string) []string {
+	var names []string
+	for name := range di.files[dir] {
+		names = append(names, name)
+	}
+	for subdir := range di.subdirs[dir] {
+		names = append(names, di.filesWithin(subdir)...)
+	}
+	return names
+}
+
+// dirsWithin returns the siapaths of the directories beneath dir.
+func (di dirIndex) dirsWithin(dir string) []string {
+	var dirs []string
+	for subdir := range di.subdirs[dir] {
+		dirs = append(dirs, subdir)
+		dirs = append(dirs, di.dirsWithin(subdir)...)
+	}
+	return dirs
+}
+
+// addFileEntry stores f in the renter's files at siaPath.
+func (r *Renter) addFileEntry(siaPath string, f *file) {
+	if _, exists := r.files[siaPath]; !exists {
+		r.dirIndex.addFile(siaPath)
+	}
+	r.files[siaPath] = f
+}
+
+// removeFileEntry removes the file at siaPath from the renter's files.
+func (r *Renter) removeFileEntry(siaPath string) {
+	if _, exists := r.files[siaPath]; exists {
+		r.dirIndex.removeFile(siaPath)
+		delete(r.files, siaPath)
+	}
+}
+
+// addDirEntry adds siaPath to the renter's explicitly created directories.
+func (r *Renter) addDirEntry(siaPath string) {
+	if _, exists := r.dirs[siaPath]; !exists {
+		r.dirIndex.addEntry(siaPath)
+		r.dirs[siaPath] = struct{}{}
+	}
+}
+
+// removeDirEntry removes siaPath from the renter's explicitly created
+// directories.
+func (r *Renter) removeDirEntry(siaPath string) {
+	if _, exists := r.dirs[siaPath]; exists {
+		r.dirIndex.removeEntry(siaPath)
+		delete(r.dirs, siaPath)
+	}
+}
+
+// validateSiaPath checks that a siapath is well formed. The empty siapath
+// refers to the root directory and is considered valid.
+func validateSiaPath(siaPath string) error {
+	if siaPath == "" {
+		return nil
+	}
+	for _, elem := range strings.Split(siaPath, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return errInvalidSiaPath
+		}
+	}
+	return nil
+}
+
+// validateNewSiaPath checks that a file or directory can be created at a
+// siapath. The siapath must be well formed, and may not lie within one of the
+// reserved directories.
+func validateNewSiaPath(siaPath string) error {
+	if err := validateSiaPath(siaPath); err != nil {
+		return err
+	}
+	if _, reserved := reservedDirs[strings.SplitN(siaPath, "/", 2)[0]]; reserved {
+		return errReservedSiaPath
+	}
+	return nil
+}
+
+// isWithinDir returns true if siaPath is located beneath the directory dir.
+func isWithinDir(siaPath, dir string) bool {
+	if dir == "" {
+		return siaPath != ""
+	}
+	return strings.HasPrefix(siaPath, dir+"/")
+}
+
+// dirExists returns true if a directory exists at siaPath.
+func (r *Renter) dirExists(siaPath string) bool {
+	return siaPath == "" || r.dirIndex.entries[siaPath] > 0
+}
+
+// checkPathConflict returns an error if a file or directory cannot be created
+// at siaPath because a directory already occupies the path, or because a file
+// occupies one of the path's parent directories.
+func (r *Renter) checkPathConflict(siaPath string) error {
+	if r.dirExists(siaPath) {
+		return ErrDirExists
+	}
+	for i := range siaPath {
+		if siaPath[i] != '/' {
+			continue
+		}
+		if _, exists := r.files[siaPath[:i]]; exists {
+			return ErrPathOverload
+		}
+	}
+	return nil
+}
+
+// CreateDir creates an empty directory at siaPath. Any missing parent
+// directories are created implicitly.
+func (r *Renter) CreateDir(siaPath string) error {
+	if err := validateNewSiaPath(siaPath); err != nil {
+		return err
+	}
+	if siaPath == "" {
+		return errRootDir
+	}
+
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	if _, exists := r.files[siaPath]; exists {
+		return ErrPathOverload
+	}
+	if err := r.checkPathConflict(siaPath); err != nil {
+		return err
+	}
+	r.addDirEntry(siaPath)
+	return r.saveSync()
+}
+
+// DeleteDir removes a directory, along with every file and directory inside
+// of it, from the renter.
+func (r *Renter) DeleteDir(siaPath string) error {
+	if err := validateSiaPath(siaPath); err != nil {
+		return err
+	}
+	if siaPath == "" {
+		return errRootDir
+	}
+
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	if !r.dirExists(siaPath) {
+		return ErrUnknownDir
+	}
+
+	// Remove every file in the directory.
+	for _, name := range r.dirIndex.filesWithin(siaPath) {
+		r.removeFile(name, r.files[name])
+	}
+
+	// Remove the directory and every directory inside of it.
+	for _, dir := range append(r.dirIndex.dirsWithin(siaPath), siaPath) {
+		r.removeDirEntry(dir)
+	}
+	if err := r.saveArchive(); err != nil {
+		return err
+	}
+	return r.saveSync()
+}
+
+// RenameDir moves a directory, along with every file and directory inside of
+// it, to newSiaPath. Every file is saved under its new siapath before any of
+// them is moved, so that the renter is left unchanged if a file cannot be
+// saved.
+func (r *Renter) RenameDir(siaPath, newSiaPath string) error {
+	if err := validateSiaPath(siaPath); err != nil {
+		return err
+	}
+	if err := validateNewSiaPath(newSiaPath); err != nil {
+		return err
+	}
+	if siaPath == "" || newSiaPath == "" {
+		return errRootDir
+	}
+	if newSiaPath == siaPath || isWithinDir(newSiaPath, siaPath) {
+		return errDirIntoItself
+	}
+
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	if !r.dirExists(siaPath) {
+		return ErrUnknownDir
+	}
+	if _, exists := r.files[newSiaPath]; exists {
+		return ErrPathOverload
+	}
+	if err := r.checkPathConflict(newSiaPath); err != nil {
+		return err
+	}
+	for versionPath := range r.versions {
+		if isWithinDir(versionPath, siaPath) && len(r.versions[newSiaPath+strings.TrimPrefix(versionPath, siaPath)]) != 0 {
+			return ErrPathOverload
+		}
+	}
+
+	// Save every file in the directory under its new siapath. If a file
+	// cannot be saved, the files that were saved are restored.
+	names := r.dirIndex.filesWithin(siaPath)
+	for i, name := range names {
+		f := r.files[name]
+		f.mu.Lock()
+		f.name = newSiaPath + strings.TrimPrefix(name, siaPath)
+		err := r.saveFile(f)
+		f.mu.Unlock()
+		if err == nil {
+			continue
+		}
+		for _, saved := range names[:i+1] {
+			f := r.files[saved]
+			f.mu.Lock()
+			os.RemoveAll(filepath.Join(r.persistDir, f.name+ShareExtension))
+			f.name = saved
+			f.mu.Unlock()
+		}
+		return err
+	}
+
+	// Move every file in the directory.
+	var oldPaths []string
+	for _, name := range names {
+		r.renameFileEntry(name, newSiaPath+strings.TrimPrefix(name, siaPath))
+		oldPaths = append(oldPaths, filepath.Join(r.persistDir, name+ShareExtension))
+	}
+
+	// Move the versions of the files in the directory, including files that
+	// have since been deleted.
+	var versionPaths []string
+	for versionPath := range r.versions {
+		if isWithinDir(versionPath, siaPath) {
+			versionPaths = append(versionPaths, versionPath)
+		}
+	}
+	for _, versionPath := range versionPaths {
+		r.moveVersions(versionPath, newSiaPath+strings.TrimPrefix(versionPath, siaPath))
+	}
+
+	// Move the directory and every directory inside of it.
+	for _, dir := range append(r.dirIndex.dirsWithin(siaPath), siaPath) {
+		if _, exists := r.dirs[dir]; exists {
+			r.removeDirEntry(dir)
+			r.addDirEntry(newSiaPath + strings.TrimPrefix(dir, siaPath))
+		}
+	}
+	err := r.saveSync()
+	if err != nil {
+		return err
+	}
+	err = r.saveArchive()
+	if err != nil {
+		return err
+	}
+
+	// Delete the old .sia files.
+	for _, oldPath := range oldPaths {
+		os.RemoveAll(oldPath)
+	}
+	return nil
+}
+
+// DirList returns information on the directory at siaPath, followed by its
+// immediate subdirectories, along with the files that the directory contains
+// directly. The size and redundancy of each directory is aggregated over
+// every file beneath it.
+func (r *Renter) DirList(siaPath string) ([]modules.DirectoryInfo, []modules.FileInfo, error) {
+	if err := validateSiaPath(siaPath); err != nil {
+		return nil, nil, err
+	}
+
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	if !r.dirExists(siaPath) {
+		return nil, nil, ErrUnknownDir
+	}
+
+	// Aggregate each file into the directory and, if the file is not stored
+	// directly in the directory, into the subdirectory that contains it.
+	dir := newDirectoryInfo(siaPath)
+	var files []modules.FileInfo
+	for name := range r.dirIndex.files[siaPath] {
+		f := r.files[name]
+		f.mu.RLock()
+		fi := fileInfo(f)
+		f.mu.RUnlock()
+		addFileToDirectoryInfo(&dir, fi)
+		files = append(files, fi)
+	}
+	var dirs []modules.DirectoryInfo
+	for path := range r.dirIndex.subdirs[siaPath] {
+		sd := newDirectoryInfo(path)
+		sd.NumSubDirs = uint64(len(r.dirIndex.subdirs[path]))
+		for _, name := range r.dirIndex.filesWithin(path) {
+			f := r.files[name]
+			f.mu.RLock()
+			fi := fileInfo(f)
+			f.mu.RUnlock()
+			addFileToDirectoryInfo(&dir, fi)
+			addFileToDirectoryInfo(&sd, fi)
+		}
+		dirs = append(dirs, sd)
+	}
+
+	// Assemble the results, sorted by siapath.
+	dir.NumSubDirs = uint64(len(dirs))
+	sort.Sort(directoryInfosBySiaPath(dirs))
+	sort.Sort(fileInfosBySiaPath(files))
+	return append([]modules.DirectoryInfo{dir}, dirs...), files, nil
+}
+
+// directoryInfosBySiaPath implements sort.Interface for a slice of
+// DirectoryInfo, sorting by siapath.
+type directoryInfosBySiaPath []modules.DirectoryInfo
+
+func (d directoryInfosBySiaPath) Len() int           { return len(d) }
+func (d directoryInfosBySiaPath) Less(i, j int) bool { return d[i].SiaPath < d[j].SiaPath }
+func (d directoryInfosBySiaPath) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// fileInfosBySiaPath implements sort.Interface for a slice of FileInfo,
+// sorting by siapath.
+type fileInfosBySiaPath []modules.FileInfo
+
+func (f fileInfosBySiaPath) Len() int           { return len(f) }
+func (f fileInfosBySiaPath) Less(i, j int) bool { return f[i].SiaPath < f[j].SiaPath }
+func (f fileInfosBySiaPath) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// newDirectoryInfo returns the DirectoryInfo of an empty directory.
+func newDirectoryInfo(siaPath string) modules.DirectoryInfo {
+	return modules.DirectoryInfo{
+		SiaPath:       siaPath,
+		Available:     true,
+		MinRedundancy: -1,
+	}
+}
+
+// addFileToDirectoryInfo adds a file to the aggregate statistics of a
+// directory.
+func addFileToDirectoryInfo(di *modules.DirectoryInfo, fi modules.FileInfo) {
+	di.NumFiles++
+	di.AggregateSize += fi.Filesize
+	di.Available = di.Available && fi.Available
+	// Empty files have a redundancy of -1, and do not affect the redundancy
+	// of the directory.
+	if fi.Redundancy >= 0 && (di.MinRedundancy < 0 || fi.Redundancy < di.MinRedundancy) {
+		di.MinRedundancy = fi.Redundancy
+	}
+}
@@ -0,0 +1,238 @@
+package renter
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestValidateSiaPath probes the validateSiaPath function.
+func TestValidateSiaPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		valid bool
+	}{
+		{"", true},
+		{"foo", true},
+		{"foo/bar", true},
+		{"foo/bar.txt", true},
+		{"/foo", false},
+		{"foo/", false},
+		{"foo//bar", false},
+		{"foo/./bar", false},
+		{"foo/../bar", false},
+		{"..", false},
+	}
+	for _, test := range tests {
+		err := validateSiaPath(test.path)
+		if test.valid && err != nil {
+			t.Errorf("%q: expected path to be valid, got %v", test.path, err)
+		} else if !test.valid && err != errInvalidSiaPath {
+			t.Errorf("%q: expected errInvalidSiaPath, got %v", test.path, err)
+		}
+	}
+}
+
+// TestValidateNewSiaPath checks that files and directories cannot be created
+// within the reserved directories.
+func TestValidateNewSiaPath(t *testing.T) {
+	tests := []struct {
+		path string
+		err  error
+	}{
+		{"foo/chunkcache", nil},
+		{"chunkcaches/foo", nil},
+		{"foo//bar", errInvalidSiaPath},
+		{"chunkcache", errReservedSiaPath},
+		{"chunkcache/foo", errReservedSiaPath},
+		{"packs/foo", errReservedSiaPath},
+		{"archive/foo/bar", errReservedSiaPath},
+	}
+	for _, test := range tests {
+		if err := validateNewSiaPath(test.path); err != test.err {
+			t.Errorf("%q: expected %v, got %v", test.path, test.err, err)
+		}
+	}
+}
+
+// TestDirIndex checks that the directory index tracks the files and
+// directories beneath each directory as entries are added and removed.
+func TestDirIndex(t *testing.T) {
+	di := newDirIndex(map[string]*file{"a/b/c": nil, "a/d": nil, "e": nil}, map[string]struct{}{"a/f": {}, "g/h": {}})
+	sorted := func(paths []string) string {
+		sort.Strings(paths)
+		return strings.Join(paths, ",")
+	}
+	if got := sorted(di.filesWithin("")); got != "a/b/c,a/d,e" {
+		t.Error("wrong files within the root:", got)
+	}
+	if got := sorted(di.filesWithin("a")); got != "a/b/c,a/d" {
+		t.Error("wrong files within a:", got)
+	}
+	if got := sorted(di.dirsWithin("")); got != "a,a/b,a/f,g,g/h" {
+		t.Error("wrong directories within the root:", got)
+	}
+	if di.entries["a"] != 3 || di.entries["g"] != 1 || di.entries[""] != 5 {
+		t.Error("wrong entry counts:", di.entries)
+	}
+
+	// Removing the last entry beneath a directory removes the directory.
+	di.removeFile("a/b/c")
+	if _, exists := di.entries["a/b"]; exists {
+		t.Error("empty directory was not removed")
+	}
+	if got := sorted(di.dirsWithin("a")); got != "a/f" {
+		t.Error("wrong directories within a:", got)
+	}
+	di.removeEntry("g/h")
+	if len(di.subdirs[""]) != 1 || di.entries[""] != 3 {
+		t.Error("wrong root entries after removing g/h:", di.subdirs[""], di.entries[""])
+	}
+
+	// An explicitly created directory is kept until both it and its entries
+	// are removed.
+	di.addFile("a/f/i")
+	di.removeEntry("a/f")
+	if di.entries["a/f"] != 1 {
+		t.Error("directory containing a file was removed")
+	}
+	di.removeFile("a/f/i")
+	di.removeFile("a/d")
+	if len(di.entries) != 1 || di.entries[""] != 1 {
+		t.Error("wrong entries after removing a:", di.entries)
+	}
+}
+
+// TestRenterDirs checks that directories can be created, listed, renamed, and
+// deleted.
+func TestRenterDirs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterDirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add files at several depths.
+	for _, name := range []string{"a", "dir/b", "dir/c", "dir/sub/d"} {
+		f := newTestingFile()
+		f.name = name
+		f.size = 1000
+		f.pieceSize = 100
+		rt.renter.addFileEntry(name, f)
+	}
+
+	// Create an empty directory, and check that conflicting directories
+	// cannot be created.
+	if err := rt.renter.CreateDir("empty"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateDir("empty"); err != ErrDirExists {
+		t.Error("expected ErrDirExists, got", err)
+	}
+	if err := rt.renter.CreateDir("dir"); err != ErrDirExists {
+		t.Error("expected ErrDirExists, got", err)
+	}
+	if err := rt.renter.CreateDir("a"); err != ErrPathOverload {
+		t.Error("expected ErrPathOverload, got", err)
+	}
+	if err := rt.renter.CreateDir("a/b"); err != ErrPathOverload {
+		t.Error("expected ErrPathOverload, got", err)
+	}
+	if err := rt.renter.CreateDir(""); err != errRootDir {
+		t.Error("expected errRootDir, got", err)
+	}
+
+	// The empty directory should persist.
+	rt.renter.dirs = make(map[string]struct{})
+	id := rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := rt.renter.dirs["empty"]; !exists {
+		t.Fatal("empty directory was not persisted")
+	}
+
+	// List the root directory.
+	dirs, files, err := rt.renter.DirList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 3 || dirs[0].SiaPath != "" || dirs[1].SiaPath != "dir" || dirs[2].SiaPath != "empty" {
+		t.Fatal("unexpected directories:", dirs)
+	}
+	if dirs[0].NumFiles != 4 || dirs[0].NumSubDirs != 2 {
+		t.Error("unexpected root directory info:", dirs[0])
+	}
+	if dirs[1].NumFiles != 3 || dirs[1].NumSubDirs != 1 || dirs[1].AggregateSize != 3000 {
+		t.Error("unexpected subdirectory info:", dirs[1])
+	}
+	if dirs[2].NumFiles != 0 || dirs[2].NumSubDirs != 0 || dirs[2].MinRedundancy != -1 {
+		t.Error("unexpected empty directory info:", dirs[2])
+	}
+	if len(files) != 1 || files[0].SiaPath != "a" {
+		t.Fatal("unexpected files:", files)
+	}
+
+	// List a subdirectory.
+	dirs, files, err = rt.renter.DirList("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 2 || dirs[1].SiaPath != "dir/sub" || dirs[1].NumFiles != 1 {
+		t.Fatal("unexpected directories:", dirs)
+	}
+	if len(files) != 2 || files[0].SiaPath != "dir/b" || files[1].SiaPath != "dir/c" {
+		t.Fatal("unexpected files:", files)
+	}
+	if _, _, err := rt.renter.DirList("nonexistent"); err != ErrUnknownDir {
+		t.Error("expected ErrUnknownDir, got", err)
+	}
+
+	// Rename the directory, and check that its files and tracking entries
+	// were moved.
+	rt.renter.tracking["dir/sub/d"] = trackedFile{RepairPath: "foo"}
+	if err := rt.renter.RenameDir("dir", "dir/inner"); err != errDirIntoItself {
+		t.Error("expected errDirIntoItself, got", err)
+	}
+	if err := rt.renter.RenameDir("dir", "empty"); err != ErrDirExists {
+		t.Error("expected ErrDirExists, got", err)
+	}
+	if err := rt.renter.RenameDir("dir", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"moved/b", "moved/c", "moved/sub/d"} {
+		if _, exists := rt.renter.files[name]; !exists {
+			t.Error("file was not moved:", name)
+		}
+	}
+	if _, exists := rt.renter.tracking["moved/sub/d"]; !exists {
+		t.Error("tracking entry was not moved")
+	}
+	if rt.renter.dirExists("dir") {
+		t.Error("old directory still exists after rename")
+	}
+
+	// Rename the empty directory.
+	if err := rt.renter.RenameDir("empty", "moved/empty"); err != nil {
+		t.Fatal(err)
+	}
+	if !rt.renter.dirExists("moved/empty") || rt.renter.dirExists("empty") {
+		t.Error("empty directory was not moved")
+	}
+
+	// Delete the directory.
+	if err := rt.renter.DeleteDir("moved"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.renter.files) != 1 || len(rt.renter.dirs) != 0 || len(rt.renter.tracking) != 0 {
+		t.Error("directory contents were not deleted")
+	}
+	if err := rt.renter.DeleteDir("moved"); err != ErrUnknownDir {
+		t.Error("expected ErrUnknownDir, got", err)
+	}
+}
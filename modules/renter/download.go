@@ -6,8 +6,8 @@ package renter
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
-	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,7 +15,6 @@ import (
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
-	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
@@ -54,16 +53,35 @@ type (
 		// piece of the chunk, mapped to an indication of whether or not they
 		// have tried to fetch a piece of the chunk.
 		completedPieces map[uint64][]byte
-		workerAttempts  map[types.FileContractID]bool
+		workerAttempts  map[string]bool
+
+		// pendingPieces is the number of pieces that are being downloaded.
+		// recoveredChan is closed once the chunk has been recovered, which
+		// cancels the downloads of the pieces that are no longer needed, even
+		// if workers have already started downloading them.
+		pendingPieces int
+		recoveredChan chan struct{}
+
+		// pieceOffset and pieceLength describe the section of each piece that
+		// is downloaded when only part of the chunk is needed. A pieceLength
+		// of zero means that the whole pieces are downloaded.
+		pieceOffset uint64
+		pieceLength uint64
 	}
 
 	// A download is a file download that has been queued by the renter.
 	download struct {
 		// Progress variables.
+		//
+		// queuedChunks indicates which chunks are in the chunk queue or are
+		// being downloaded, so that resuming a paused download does not queue
+		// a chunk twice.
 		atomicDataReceived uint64
 		downloadComplete   bool
 		downloadErr        error
 		finishedChunks     []bool
+		paused             bool
+		queuedChunks       []bool
 
 		// Timestamp information.
 		completeTime time.Time
@@ -71,15 +89,50 @@ type (
 
 		// Static information about the file - can be read without a lock.
 		chunkSize         uint64
-		destination       string
+		dedupKeys         []crypto.Hash
+		destination       downloadDestination
+		destinationString string // the path of the destination, if it is a file
+		destinationType   string
 		erasureCode       modules.ErasureCoder
 		fileSize          uint64
+		id                string
+		length            uint64 // length of the requested section of the file
 		masterKey         crypto.TwofishKey
 		numChunks         uint64
-		pieceSet          []map[types.FileContractID]pieceData
+		offset            uint64 // offset of the requested section of the file
+		pieceSet          []map[string]pieceData
+		reportedFileSize  uint64
 		reportedPieceSize uint64
 		siapath           string
 
+		// packOffset is the offset of the file within its pack if the file is
+		// packed, in which case the section is downloaded from the pack, and
+		// fileSize and offset refer to the pack.
+		packOffset uint64
+
+		// compression and chunkOffsets are set if the file is compressed, in
+		// which case each chunk is decompressed after it has been recovered,
+		// and fileSize refers to the compressed chunks.
+		compression  string
+		chunkOffsets []uint64
+
+		// archived is set if the download is of an archived file rather than
+		// of the current file at siapath.
+		archived bool
+
+		// file is the file whose sectors are downloaded, and generation is
+		// the generation of the file when the piece set was assembled.
+		file       *file
+		generation uint64
+
+		// localRepair is set if the download fetches the pieces of a chunk
+		// that are needed to rebuild its missing pieces within their local
+		// groups, rather than the data of the chunk. The piece set of the
+		// chunk then holds only those pieces, and repairedPieces holds the
+		// decrypted pieces of the chunk once they have been rebuilt.
+		localRepair    bool
+		repairedPieces [][]byte
+
 		// Syncrhonization tools.
 		downloadFinished chan error
 		mu               sync.Mutex
@@ -108,54 +161,231 @@ type (
 		//
 		// resultChan is the channel that is used to receive completed worker
 		// downloads.
+		//
+		// overdrive is the number of pieces of each new chunk that are
+		// downloaded beyond the minimum needed to recover the chunk.
 		activePieces     int
-		activeWorkers    map[types.FileContractID]struct{}
+		activeWorkers    map[string]struct{}
 		availableWorkers []*worker
 		incompleteChunks []*chunkDownload
+		overdrive        int
 		resultChan       chan finishedDownload
 	}
 )
 
-// newDownload initializes and returns a download object.
-func newDownload(f *file, destination string) *download {
+// recovered returns true if the chunk has been recovered, in which case its
+// remaining pieces are not needed.
+func (cd *chunkDownload) recovered() bool {
+	select {
+	case <-cd.recoveredChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// newSectionDownload initializes and returns a download object that fetches
+// the section of f that starts at offset and spans length bytes. Only the
+// chunks that overlap the section are scheduled for download.
+func newSectionDownload(f *file, destination downloadDestination, destinationString, destinationType string, offset, length uint64) *download {
+	// The size of the file changes during a stream upload.
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	d := &download{
 		finishedChunks: make([]bool, f.numChunks()),
+		queuedChunks:   make([]bool, f.numChunks()),
 
 		startTime: time.Now(),
 
-		chunkSize:   f.chunkSize(),
-		destination: destination,
-		erasureCode: f.erasureCode,
-		fileSize:    f.size,
-		masterKey:   f.masterKey,
-		numChunks:   f.numChunks(),
-		siapath:     f.name,
+		dedupKeys:         f.dedupKeys,
+		chunkSize:         f.chunkSize(),
+		destination:       destination,
+		destinationString: destinationString,
+		destinationType:   destinationType,
+		erasureCode:       f.erasureCode,
+		fileSize:          f.storedSize(),
+		id:                newDownloadID(),
+		length:            length,
+		masterKey:         f.masterKey,
+		numChunks:         f.numChunks(),
+		offset:            offset,
+		reportedFileSize:  f.size,
+		siapath:           f.name,
+
+		file:       f,
+		generation: f.generation,
+
+		// The channel is buffered so that the download can finish without
+		// anyone waiting on it, as is the case for downloads that were resumed
+		// after a restart.
+		downloadFinished: make(chan error, 1),
+	}
 
-		downloadFinished: make(chan error),
+	// Mark every chunk that does not overlap the requested section as
+	// finished, so that it is never added to the chunk queue. An empty
+	// section still fetches the chunk at the offset, which ensures that the
+	// destination is created.
+	firstChunk := offset / d.chunkSize
+	lastChunk := firstChunk
+	if length > 0 {
+		lastChunk = (offset + length - 1) / d.chunkSize
 	}
+	for i := range d.finishedChunks {
+		if uint64(i) < firstChunk || uint64(i) > lastChunk {
+			d.finishedChunks[i] = true
+		}
+	}
+
 	// Allocate the piece size and progress bar so that the download will
 	// finish at exactly 100%. Due to rounding error and padding, there is not
 	// a strict mapping between 'progress' and 'bytes downloaded' - it is
-	// actually necessary to download more bytes than the size of the file.
-	d.reportedPieceSize = d.fileSize / (d.numChunks * uint64(d.erasureCode.MinPieces()))
-	d.atomicDataReceived = d.fileSize - (d.reportedPieceSize * d.numChunks * uint64(d.erasureCode.MinPieces()))
+	// actually necessary to download more bytes than the size of the section.
+	sectionChunks := lastChunk - firstChunk + 1
+	d.reportedPieceSize = d.length / (sectionChunks * uint64(d.erasureCode.MinPieces()))
+	d.atomicDataReceived = d.length - (d.reportedPieceSize * sectionChunks * uint64(d.erasureCode.MinPieces()))
 
 	// Assemble the piece set for the download.
-	d.pieceSet = make([]map[types.FileContractID]pieceData, f.numChunks())
+	d.pieceSet = make([]map[string]pieceData, f.numChunks())
 	for i := range d.pieceSet {
-		d.pieceSet[i] = make(map[types.FileContractID]pieceData)
+		d.pieceSet[i] = make(map[string]pieceData)
 	}
-	f.mu.RLock()
 	for _, contract := range f.contracts {
 		for i := range contract.Pieces {
-			d.pieceSet[contract.Pieces[i].Chunk][contract.ID] = contract.Pieces[i]
+			if contract.Pieces[i].Unavailable {
+				continue
+			}
+			// A host that stores several pieces of a chunk provides a piece
+			// other than a local parity piece if it can.
+			host := contract.HostPublicKey.String()
+			existing, exists := d.pieceSet[contract.Pieces[i].Chunk][host]
+			if exists && localParityPiece(f.erasureCode, contract.Pieces[i].Piece) && !localParityPiece(f.erasureCode, existing.Piece) {
+				continue
+			}
+			d.pieceSet[contract.Pieces[i].Chunk][host] = contract.Pieces[i]
 		}
 	}
-	f.mu.RUnlock()
 
 	return d
 }
 
+// newFileSectionDownload initializes and returns a download object that
+// fetches the section of f that starts at offset and spans length bytes. If f
+// is packed, the section is fetched from the pack that stores f.
+func newFileSectionDownload(f *file, destination downloadDestination, destinationString, destinationType string, offset, length uint64) *download {
+	if f.compression != "" {
+		return newCompressedSectionDownload(f, destination, destinationString, destinationType, offset, length)
+	}
+	if f.pack == nil {
+		return newSectionDownload(f, destination, destinationString, destinationType, offset, length)
+	}
+	d := newSectionDownload(f.pack, destination, destinationString, destinationType, f.packOffset+offset, length)
+	d.packOffset = f.packOffset
+	d.reportedFileSize = f.size
+	d.siapath = f.name
+	return d
+}
+
+// newDownload initializes and returns a download object that writes the
+// entire file to the destination path.
+func newDownload(f *file, destination string) *download {
+	f.mu.RLock()
+	size := f.size
+	f.mu.RUnlock()
+	return newFileSectionDownload(f, &downloadDestinationFile{path: destination}, destination, destinationTypeFile, 0, size)
+}
+
+// pieceSection returns the section of each piece that must be downloaded to
+// recover the part of a chunk that overlaps the requested section of the
+// file. A length of zero is returned if the whole pieces must be downloaded.
+//
+// Pieces can only be partially downloaded if the needed part of the chunk
+// lies within a single data piece. The same section of any MinPieces pieces
+// is then enough to recover that part of the data piece, because the erasure
+// codes of the renter operate on each byte position of the pieces
+// independently. The chunks of compressed files are always downloaded whole.
+func (d *download) pieceSection(chunkIndex uint64) (offset, length uint64) {
+	if d.compression != "" {
+		return 0, 0
+	}
+
+	// Determine which part of the chunk is needed.
+	chunkStart := chunkIndex * d.chunkSize
+	start := d.offset
+	if start < chunkStart {
+		start = chunkStart
+	}
+	end := d.offset + d.length
+	if end > chunkStart+d.chunkSize {
+		end = chunkStart + d.chunkSize
+	}
+	if end <= start {
+		return 0, 0
+	}
+	start -= chunkStart
+	end -= chunkStart
+
+	// Check that the needed part is within a single data piece, and that
+	// downloading part of each piece is cheaper than downloading the whole
+	// sector.
+	pieceSize := d.chunkSize / uint64(d.erasureCode.MinPieces())
+	if start/pieceSize != (end-1)/pieceSize {
+		return 0, 0
+	}
+	offset = start % pieceSize
+	length = end - start
+	var downloadSize uint64
+	for _, action := range pieceSectionActions(crypto.Hash{}, offset, length) {
+		downloadSize += action.Length
+	}
+	if downloadSize >= modules.SectorSize {
+		return 0, 0
+	}
+	return offset, length
+}
+
+// newDownloadID returns a random identifier for a download.
+func newDownloadID() string {
+	b, _ := crypto.RandBytes(8)
+	return hex.EncodeToString(b)
+}
+
+// status returns the status of the download. d.mu must be held.
+func (d *download) status() string {
+	switch {
+	case d.downloadComplete && d.downloadErr == errDownloadCancelled:
+		return modules.DownloadStatusCancelled
+	case d.downloadComplete && d.downloadErr != nil:
+		return modules.DownloadStatusFailed
+	case d.downloadComplete:
+		return modules.DownloadStatusComplete
+	case d.paused:
+		return modules.DownloadStatusPaused
+	default:
+		return modules.DownloadStatusActive
+	}
+}
+
+// windowFull returns true if the download is streamed to a destination that
+// cannot accept more chunks until its reader catches up. The chunks of a
+// download that has already completed or failed are never held back.
+func (d *download) windowFull() bool {
+	ddw, ok := d.destination.(*downloadDestinationWriter)
+	if !ok {
+		return false
+	}
+	d.mu.Lock()
+	complete := d.downloadComplete
+	d.mu.Unlock()
+	return !complete && ddw.full()
+}
+
+// persisted returns true if the progress of the download is saved to disk so
+// that the download can be resumed after a restart. Only downloads to a file
+// can be resumed, and downloads of archived files are not resumed.
+func (d *download) persisted() bool {
+	return d.destinationType == destinationTypeFile && !d.archived
+}
+
 // fail will mark the download as complete, but with the provided error.
 func (d *download) fail(err error) {
 	if d.downloadComplete {
@@ -168,9 +398,18 @@ func (d *download) fail(err error) {
 	d.downloadFinished <- err
 }
 
+// stale returns whether an update of the file has replaced pieces of the file
+// since the piece set of the download was assembled.
+func (d *download) stale() bool {
+	d.file.mu.RLock()
+	defer d.file.mu.RUnlock()
+	return d.file.generation != d.generation
+}
+
 // recoverChunk takes a chunk that has had a sufficient number of pieces
-// downloaded and verified and decryptps + decodes them into the file.
-func (cd *chunkDownload) recoverChunk() error {
+// downloaded and verified and decryptps + decodes them into the file. Whole
+// chunks are added to cache once they have been recovered.
+func (cd *chunkDownload) recoverChunk(cache *chunkCache) error {
 	// Assemble the chunk from the download.
 	cd.download.mu.Lock()
 	chunk := make([][]byte, cd.download.erasureCode.NumPieces())
@@ -186,7 +425,10 @@ func (cd *chunkDownload) recoverChunk() error {
 		return build.ComposeErrors(errPrevErr, prevErr)
 	}
 
-	// Decrypt the chunk pieces.
+	// Decrypt the chunk pieces. If only a section of each piece was
+	// downloaded, the piece data holds the nonce of the piece followed by the
+	// encrypted section. The section has already been verified against the
+	// Merkle root of the piece.
 	for i := range chunk {
 		// Skip pieces that were not downloaded.
 		if chunk[i] == nil {
@@ -194,50 +436,131 @@ func (cd *chunkDownload) recoverChunk() error {
 		}
 
 		// Decrypt the piece.
-		key := deriveKey(cd.download.masterKey, cd.index, uint64(i))
-		decryptedPiece, err := key.DecryptBytes(chunk[i])
+		key := pieceKey(cd.download.masterKey, cd.download.dedupKeys, cd.index, uint64(i))
+		var decryptedPiece []byte
+		var err error
+		if cd.pieceLength > 0 {
+			decryptedPiece, err = key.DecryptBytesInRange(chunk[i][:crypto.TwofishNonceSize], chunk[i][crypto.TwofishNonceSize:], cd.pieceOffset)
+		} else {
+			decryptedPiece, err = key.DecryptBytes(chunk[i])
+		}
 		if err != nil {
 			return build.ExtendErr("unable to decrypt piece", err)
 		}
 		chunk[i] = decryptedPiece
 	}
 
-	// Recover the chunk into a byte slice.
+	// The pieces of a local repair are rebuilt within their groups rather
+	// than recovered into the data of the chunk.
+	if cd.download.localRepair {
+		cd.download.erasureCode.(*lrCode).rebuildGroups(chunk)
+		cd.download.mu.Lock()
+		complete, prevErr = cd.download.downloadComplete, cd.download.downloadErr
+		if !complete {
+			cd.download.repairedPieces = chunk
+		}
+		cd.download.mu.Unlock()
+		// The download may have been cancelled or failed while the chunk was
+		// being recovered.
+		if complete {
+			return build.ComposeErrors(errPrevErr, prevErr)
+		}
+		cd.finishChunk()
+		return nil
+	}
+
+	// Recover the chunk into a byte slice. If only a section of each piece
+	// was downloaded, only the matching section of each data piece can be
+	// recovered, of which the section of a single data piece is needed.
 	recoverWriter := new(bytes.Buffer)
 	recoverSize := cd.download.chunkSize
-	if cd.index == cd.download.numChunks-1 && cd.download.fileSize%cd.download.chunkSize != 0 {
+	if cd.pieceLength > 0 {
+		recoverSize = cd.pieceLength * uint64(cd.download.erasureCode.MinPieces())
+	} else if cd.index == cd.download.numChunks-1 && cd.download.fileSize%cd.download.chunkSize != 0 {
 		recoverSize = cd.download.fileSize % cd.download.chunkSize
 	}
 	err := cd.download.erasureCode.Recover(chunk, recoverSize, recoverWriter)
 	if err != nil {
 		return build.ExtendErr("unable to recover chunk", err)
 	}
+	result := recoverWriter.Bytes()
+	// Chunks recovered from pieces that an update has since replaced are not
+	// cached, as they hold the old data of the chunk.
+	if cd.pieceLength == 0 && !cd.download.stale() {
+		cache.put(cd.download.masterKey, cd.index, result)
+	}
+	return cd.writeChunk(result)
+}
 
-	// Open a file handle for the download.
-	fileDest, err := os.OpenFile(cd.download.destination, os.O_CREATE|os.O_WRONLY, defaultFilePerm)
-	if err != nil {
-		return build.ExtendErr("unable to open download destination", err)
+// writeChunk writes the part of the recovered data of the chunk that overlaps
+// the requested section to the destination, and marks the chunk as finished.
+func (cd *chunkDownload) writeChunk(result []byte) error {
+	var err error
+	chunkOffset := cd.index * cd.download.chunkSize
+	resultOffset := chunkOffset
+	if cd.pieceLength > 0 {
+		pieceSize := cd.download.chunkSize / uint64(cd.download.erasureCode.MinPieces())
+		neededStart := chunkOffset
+		if cd.download.offset > neededStart {
+			neededStart = cd.download.offset
+		}
+		dataPiece := (neededStart - chunkOffset) / pieceSize
+		result = result[dataPiece*cd.pieceLength : (dataPiece+1)*cd.pieceLength]
+		resultOffset = chunkOffset + dataPiece*pieceSize + cd.pieceOffset
+	}
+	if cd.download.compression != "" {
+		var length uint64
+		resultOffset, length = chunkSpan(cd.download.chunkOffsets, cd.download.reportedFileSize, cd.index)
+		result, err = decompressChunk(cd.download.compression, result, length)
+		if err != nil {
+			return build.ExtendErr("unable to decompress chunk", err)
+		}
 	}
-	defer fileDest.Close()
 
-	// Write the bytes to the download file.
-	result := recoverWriter.Bytes()
-	_, err = fileDest.WriteAt(result, int64(cd.index*cd.download.chunkSize))
-	if err != nil {
-		return build.ExtendErr("unable to write to download destination", err)
+	// Nothing is written if the download has been cancelled or has failed
+	// since the chunk was recovered.
+	cd.download.mu.Lock()
+	complete, prevErr := cd.download.downloadComplete, cd.download.downloadErr
+	cd.download.mu.Unlock()
+	if complete {
+		return build.ComposeErrors(errPrevErr, prevErr)
 	}
 
-	// Sync the write to provide proper durability.
-	err = fileDest.Sync()
+	// Write the portion of the recovered data that overlaps the requested
+	// section to the destination. The destination offset is relative to the
+	// start of the section.
+	sectionStart := cd.download.offset
+	sectionEnd := cd.download.offset + cd.download.length
+	if resultOffset > sectionStart {
+		sectionStart = resultOffset
+	}
+	if resultOffset+uint64(len(result)) < sectionEnd {
+		sectionEnd = resultOffset + uint64(len(result))
+	}
+	if sectionStart > sectionEnd {
+		sectionStart = sectionEnd
+	}
+	_, err = cd.download.destination.WriteAt(result[sectionStart-resultOffset:sectionEnd-resultOffset], int64(sectionStart-cd.download.offset))
 	if err != nil {
-		return build.ExtendErr("unable to sync downlaod destination", err)
+		return build.ExtendErr("unable to write to download destination", err)
 	}
+	cd.finishChunk()
+	return nil
+}
 
+// finishChunk marks the chunk as finished, completing the download once every
+// chunk has finished. Chunks that finish after the download has been
+// cancelled or has failed are ignored, as the download has already been
+// completed and released.
+func (cd *chunkDownload) finishChunk() {
 	cd.download.mu.Lock()
 	defer cd.download.mu.Unlock()
+	if cd.download.downloadComplete {
+		return
+	}
 
 	// Update the download to signal that this chunk has completed. Only update
-	// after the sync, so that durability is maintained.
+	// after the write, so that durability is maintained.
 	if cd.download.finishedChunks[cd.index] {
 		build.Critical("recovering chunk when the chunk has already finished downloading")
 	}
@@ -256,7 +579,41 @@ func (cd *chunkDownload) recoverChunk() error {
 		cd.download.downloadComplete = true
 		cd.download.downloadFinished <- nil
 	}
-	return nil
+}
+
+// neededPieces returns the number of pieces that must count towards the
+// recovery of the chunk before it can be recovered. Every piece in the piece
+// set of a local repair is needed.
+func (cd *chunkDownload) neededPieces() int {
+	if cd.download.localRepair {
+		return len(cd.download.pieceSet[cd.index])
+	}
+	return cd.download.erasureCode.MinPieces()
+}
+
+// effectivePieces returns the number of downloaded pieces that count towards
+// the recovery of the chunk.
+func (cd *chunkDownload) effectivePieces() int {
+	if cd.download.localRepair {
+		return len(cd.completedPieces)
+	}
+	pieces := make(map[uint64]int, len(cd.completedPieces))
+	for pieceIndex := range cd.completedPieces {
+		pieces[pieceIndex] = 1
+	}
+	return effectivePieces(cd.download.erasureCode, pieces)
+}
+
+// otherPieceAvailable reports whether a worker in the set of available
+// workers can download a piece of the chunk that is not a local parity piece.
+func (cd *chunkDownload) otherPieceAvailable(ds *downloadState) bool {
+	for _, worker := range ds.availableWorkers {
+		piece, exists := cd.download.pieceSet[cd.index][worker.id()]
+		if exists && !cd.workerAttempts[worker.id()] && !localParityPiece(cd.download.erasureCode, piece.Piece) {
+			return true
+		}
+	}
+	return false
 }
 
 // addDownloadToChunkQueue takes a file and adds all incomplete work from the file
@@ -265,18 +622,22 @@ func (r *Renter) addDownloadToChunkQueue(d *download) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	// Skip this file if it has already errored out or has already finished
-	// downloading.
-	if d.downloadComplete {
+	// Skip this file if it has already errored out, has already finished
+	// downloading, or has been paused.
+	if d.downloadComplete || d.paused {
 		return
 	}
 
-	// Add the unfinished chunks one at a time.
+	// Add the unfinished chunks one at a time. Whole pieces are downloaded
+	// while the chunk cache is enabled, so that the chunks can be cached.
+	cacheEnabled := r.chunkCache.getMaxSize() != 0
 	for i := range d.finishedChunks {
-		// Skip chunks that have already finished downloading.
-		if d.finishedChunks[i] {
+		// Skip chunks that have already finished downloading, or that are
+		// already queued.
+		if d.finishedChunks[i] || d.queuedChunks[i] {
 			continue
 		}
+		d.queuedChunks[i] = true
 
 		// Add this chunk to the chunk queue.
 		cd := &chunkDownload{
@@ -284,10 +645,14 @@ func (r *Renter) addDownloadToChunkQueue(d *download) {
 			index:    uint64(i),
 
 			completedPieces: make(map[uint64][]byte),
-			workerAttempts:  make(map[types.FileContractID]bool),
+			workerAttempts:  make(map[string]bool),
+			recoveredChan:   make(chan struct{}),
+		}
+		if !cacheEnabled && !d.localRepair {
+			cd.pieceOffset, cd.pieceLength = d.pieceSection(uint64(i))
 		}
-		for fcid := range d.pieceSet[i] {
-			cd.workerAttempts[fcid] = false
+		for host := range d.pieceSet[i] {
+			cd.workerAttempts[host] = false
 		}
 		r.chunkQueue = append(r.chunkQueue, cd)
 	}
@@ -320,7 +685,7 @@ func (r *Renter) managedDownloadIteration(ds *downloadState) {
 	ds.availableWorkers = make([]*worker, 0, len(r.workerPool))
 	for _, worker := range r.workerPool {
 		// Ignore workers that are already in the active set of workers.
-		_, exists := ds.activeWorkers[worker.contractID]
+		_, exists := ds.activeWorkers[worker.id()]
 		if exists {
 			continue
 		}
@@ -336,6 +701,8 @@ func (r *Renter) managedDownloadIteration(ds *downloadState) {
 
 		ds.availableWorkers = append(ds.availableWorkers, worker)
 	}
+	r.sortWorkersBySpeed(ds.availableWorkers)
+	ds.overdrive = int(r.overdrive)
 	r.mu.Unlock(id)
 
 	// Add new chunks to the extent that resources allow.
@@ -371,10 +738,18 @@ loop:
 			continue
 		}
 
+		// Drop the remaining pieces of a chunk that has been recovered.
+		if incompleteChunk.recovered() {
+			ds.activePieces--
+			continue
+		}
+
 		// Try to find a worker that is able to pick up the slack on the
-		// incomplete download from the set of available workers.
+		// incomplete download from the set of available workers. Local
+		// parity pieces only help if a data piece of their group is missing,
+		// so they are only downloaded if no other piece is available.
 		for i, worker := range ds.availableWorkers {
-			scheduled, exists := incompleteChunk.workerAttempts[worker.contractID]
+			scheduled, exists := incompleteChunk.workerAttempts[worker.id()]
 			if scheduled || !exists {
 				// Either this worker does not contain a piece of this chunk,
 				// or this worker has already been scheduled to download a
@@ -384,20 +759,26 @@ loop:
 
 			// If no piece exists for this worker, do not give the worker this
 			// download.
-			piece, exists := incompleteChunk.download.pieceSet[incompleteChunk.index][worker.contractID]
+			piece, exists := incompleteChunk.download.pieceSet[incompleteChunk.index][worker.id()]
 			if !exists {
 				continue
 			}
+			if localParityPiece(incompleteChunk.download.erasureCode, piece.Piece) && !incompleteChunk.download.localRepair && incompleteChunk.otherPieceAvailable(ds) {
+				continue
+			}
 
 			dw := downloadWork{
 				dataRoot:      piece.MerkleRoot,
 				pieceIndex:    piece.Piece,
+				pieceOffset:   incompleteChunk.pieceOffset,
+				pieceLength:   incompleteChunk.pieceLength,
 				chunkDownload: incompleteChunk,
 				resultChan:    ds.resultChan,
 			}
-			incompleteChunk.workerAttempts[worker.contractID] = true
+			incompleteChunk.workerAttempts[worker.id()] = true
+			incompleteChunk.pendingPieces++
 			ds.availableWorkers = append(ds.availableWorkers[:i], ds.availableWorkers[i+1:]...)
-			ds.activeWorkers[worker.contractID] = struct{}{}
+			ds.activeWorkers[worker.id()] = struct{}{}
 			select {
 			case worker.priorityDownloadChan <- dw:
 			default:
@@ -409,10 +790,10 @@ loop:
 		// Determine whether any of the workers in the set of active workers is
 		// able to pick up the slack, indicating that the chunk can be
 		// completed just not at this time.
-		for fcid := range ds.activeWorkers {
+		for workerID := range ds.activeWorkers {
 			// Check whether a piece exists for this worker.
-			_, exists1 := incompleteChunk.download.pieceSet[incompleteChunk.index][fcid]
-			scheduled, exists2 := incompleteChunk.workerAttempts[fcid]
+			_, exists1 := incompleteChunk.download.pieceSet[incompleteChunk.index][workerID]
+			scheduled, exists2 := incompleteChunk.workerAttempts[workerID]
 			if !scheduled && exists1 && exists2 {
 				// This worker is able to complete the download for this chunk,
 				// but is busy. Keep this chunk until the next iteration of the
@@ -426,10 +807,21 @@ loop:
 		// or the active set is able to pick up the slack. Verify that they are
 		// safe to be scheduled, and then schedule them if so.
 
+		// An overdrive piece that no worker can download is not needed if
+		// the chunk can be recovered from the pieces that are already
+		// downloaded or being downloaded.
+		if incompleteChunk.effectivePieces()+incompleteChunk.pendingPieces >= incompleteChunk.neededPieces() {
+			ds.activePieces--
+			continue
+		}
+
 		// Cannot find workers to complete this download, fail the download
 		// connected to this chunk.
 		r.log.Println("Not enough workers to finish download:", errInsufficientHosts)
+		incompleteChunk.download.mu.Lock()
 		incompleteChunk.download.fail(errInsufficientHosts)
+		incompleteChunk.download.mu.Unlock()
+		r.managedUpdateDownload(incompleteChunk.download)
 
 		// Clear out the piece burden for this chunk.
 		ds.activePieces--                                       // for the current incomplete chunk
@@ -442,52 +834,124 @@ loop:
 }
 
 // managedScheduleNewChunks uses the set of available workers to schedule new
-// chunks if there are resources available to begin downloading them.
+// chunks if there are resources available to begin downloading them. Chunks
+// of streams whose destination is full are left in the queue.
 func (r *Renter) managedScheduleNewChunks(ds *downloadState) {
 	// Keep adding chunks until a break condition is hit.
-	for {
-		chunkQueueLen := len(r.chunkQueue)
-		if chunkQueueLen == 0 {
+	for i := 0; ; {
+		if i == len(r.chunkQueue) {
 			// There are no more chunks to initiate, return.
 			return
 		}
 
-		// View the next chunk.
-		nextChunk := r.chunkQueue[0]
+		// View the next chunk, skipping it if its stream is not ready for
+		// more data.
+		nextChunk := r.chunkQueue[i]
+		if nextChunk.download.windowFull() {
+			i++
+			continue
+		}
+
+		// Determine how many pieces of the chunk to download. Overdrive
+		// pieces are only downloaded if there are hosts to download them
+		// from.
+		numPieces := nextChunk.neededPieces()
+		if extra := len(nextChunk.download.pieceSet[nextChunk.index]) - numPieces; extra > 0 {
+			if extra > ds.overdrive {
+				extra = ds.overdrive
+			}
+			numPieces += extra
+		}
 
 		// Check whether there are enough resources to perform the download.
-		if ds.activePieces+nextChunk.download.erasureCode.MinPieces() > maxActiveDownloadPieces {
+		if ds.activePieces+numPieces > maxActiveDownloadPieces {
 			// There is a limited amount of RAM available, and scheduling the
 			// next piece would consume too much RAM.
 			return
 		}
 
 		// Chunk is set to be downloaded. Clear it from the queue.
-		r.chunkQueue = r.chunkQueue[1:]
+		r.chunkQueue = append(r.chunkQueue[:i], r.chunkQueue[i+1:]...)
 
 		// Check if the download has already completed. If it has, it's because
-		// the download failed.
+		// the download failed. Chunks of paused downloads are dropped, and are
+		// queued again when the download is resumed.
 		nextChunk.download.mu.Lock()
 		downloadComplete := nextChunk.download.downloadComplete
+		paused := nextChunk.download.paused
+		if paused {
+			nextChunk.download.queuedChunks[nextChunk.index] = false
+		}
 		nextChunk.download.mu.Unlock()
-		if downloadComplete {
-			// Download has already failed.
+		if downloadComplete || paused {
+			// Download has already failed or has been paused.
+			continue
+		}
+
+		// Serve the chunk from the cache if it has been recovered before. The
+		// cached chunk is read and written in its own thread, so that the
+		// download loop is not blocked on disk. The pieces of a local repair
+		// are always downloaded.
+		if !nextChunk.download.localRepair && r.chunkCache.lookup(nextChunk.download.masterKey, nextChunk.index) {
+			go r.threadedServeCachedChunk(nextChunk)
 			continue
 		}
 
 		// Add an incomplete chunk entry for every piece of the download.
-		for i := 0; i < nextChunk.download.erasureCode.MinPieces(); i++ {
+		for i := 0; i < numPieces; i++ {
 			ds.incompleteChunks = append(ds.incompleteChunks, nextChunk)
 		}
-		ds.activePieces += nextChunk.download.erasureCode.MinPieces()
+		ds.activePieces += numPieces
+	}
+}
+
+// threadedServeCachedChunk writes a chunk from the chunk cache to the
+// destination of its download. If the chunk was evicted from the cache in the
+// meantime, the chunk is queued again to be downloaded from the hosts.
+func (r *Renter) threadedServeCachedChunk(cd *chunkDownload) {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	data, cached := r.chunkCache.get(cd.download.masterKey, cd.index)
+	if !cached {
+		cd.download.mu.Lock()
+		cd.download.queuedChunks[cd.index] = false
+		cd.download.mu.Unlock()
+		select {
+		case r.newDownloads <- cd.download:
+		case <-r.tg.StopChan():
+		}
+		return
 	}
+
+	cd.pieceOffset, cd.pieceLength = 0, 0
+	if err := cd.writeChunk(data); err != nil {
+		r.log.Println("Download failed - could not write a cached chunk:", err)
+		cd.download.mu.Lock()
+		cd.download.fail(err)
+		cd.download.mu.Unlock()
+	}
+	close(cd.recoveredChan)
+	atomic.AddUint64(&cd.download.atomicDataReceived, cd.download.reportedPieceSize*uint64(cd.download.erasureCode.MinPieces()))
+	r.managedUpdateDownload(cd.download)
 }
 
 // managedWaitOnDownloadWork will wait for workers to return after attempting to
 // download a piece.
 func (r *Renter) managedWaitOnDownloadWork(ds *downloadState) {
-	// If there are no workers performing work, return early.
+	// If there are no workers performing work, return early. If chunks are
+	// left in the queue, they are waiting for their streams to be consumed.
 	if len(ds.activeWorkers) == 0 {
+		if len(r.chunkQueue) != 0 && len(ds.incompleteChunks) == 0 {
+			select {
+			case <-r.tg.StopChan():
+			case d := <-r.newDownloads:
+				r.addDownloadToChunkQueue(d)
+			case <-r.streamsDrained:
+			}
+		}
 		return
 	}
 
@@ -507,6 +971,14 @@ func (r *Renter) managedWaitOnDownloadWork(ds *downloadState) {
 	workerID := finishedDownload.workerID
 	delete(ds.activeWorkers, workerID)
 
+	// Discard the pieces of chunks that have already been recovered.
+	cd := finishedDownload.chunkDownload
+	cd.pendingPieces--
+	if cd.recovered() {
+		ds.activePieces--
+		return
+	}
+
 	// Fetch the corresponding worker.
 	id := r.mu.RLock()
 	worker, exists := r.workerPool[workerID]
@@ -516,7 +988,6 @@ func (r *Renter) managedWaitOnDownloadWork(ds *downloadState) {
 	}
 
 	// Check for an error.
-	cd := finishedDownload.chunkDownload
 	if finishedDownload.err != nil {
 		r.log.Debugln("Error when downloading a piece:", finishedDownload.err)
 		worker.recentDownloadFailure = time.Now()
@@ -524,13 +995,25 @@ func (r *Renter) managedWaitOnDownloadWork(ds *downloadState) {
 		return
 	}
 
-	// Add this returned piece to the appropriate chunk.
+	// Add this returned piece to the appropriate chunk. A piece that does not
+	// count towards the recovery of the chunk, such as a local parity piece
+	// that does not rebuild a missing data piece, or a piece that has already
+	// been downloaded from another host, is replaced by another piece.
+	_, duplicate := cd.completedPieces[finishedDownload.pieceIndex]
+	effective := cd.effectivePieces()
 	cd.completedPieces[finishedDownload.pieceIndex] = finishedDownload.data
 	atomic.AddUint64(&cd.download.atomicDataReceived, cd.download.reportedPieceSize)
+	if cd.effectivePieces() == effective {
+		ds.incompleteChunks = append(ds.incompleteChunks, cd)
+		if !duplicate {
+			ds.activePieces++
+		}
+	}
 
 	// If the chunk has completed, perform chunk recovery.
-	if len(cd.completedPieces) == cd.download.erasureCode.MinPieces() {
-		err := cd.recoverChunk()
+	if cd.effectivePieces() >= cd.neededPieces() {
+		err := cd.recoverChunk(&r.chunkCache)
+		close(cd.recoveredChan)
 		ds.activePieces -= len(cd.completedPieces)
 		cd.completedPieces = make(map[uint64][]byte)
 		if err != nil {
@@ -539,6 +1022,7 @@ func (r *Renter) managedWaitOnDownloadWork(ds *downloadState) {
 			cd.download.fail(err)
 			cd.download.mu.Unlock()
 		}
+		r.managedUpdateDownload(cd.download)
 	}
 }
 
@@ -555,7 +1039,7 @@ func (r *Renter) threadedDownloadLoop() {
 
 	// Create the download state.
 	ds := &downloadState{
-		activeWorkers:    make(map[types.FileContractID]struct{}),
+		activeWorkers:    make(map[string]struct{}),
 		availableWorkers: availableWorkers,
 		incompleteChunks: make([]*chunkDownload, 0),
 		resultChan:       make(chan finishedDownload),
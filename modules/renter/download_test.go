@@ -0,0 +1,107 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestPieceSection probes the pieceSection method of the download.
+func TestPieceSection(t *testing.T) {
+	rsc, _ := NewRSCode(2, 2)
+	f := newFile("foo", rsc, pieceSize, pieceSize*5)
+	chunkSize := f.chunkSize()
+
+	tests := []struct {
+		offset, length uint64
+		chunkIndex     uint64
+		expectedOffset uint64
+		expectedLength uint64
+	}{
+		// A small section within the first data piece of a chunk.
+		{100, 50, 0, 100, 50},
+		// A small section within the second data piece of a chunk.
+		{pieceSize + 100, 50, 0, 100, 50},
+		// A small section within the second chunk.
+		{chunkSize + 10, 20, 1, 10, 20},
+		// A section that spans two data pieces must be fully downloaded.
+		{pieceSize - 10, 20, 0, 0, 0},
+		// A section that covers most of a data piece must be fully
+		// downloaded, as the partial download would not be cheaper.
+		{0, pieceSize, 0, 0, 0},
+		// The part of a large section that overlaps the start of a chunk.
+		{chunkSize - 10, 30, 1, 0, 20},
+	}
+	for _, test := range tests {
+		d := newSectionDownload(f, nil, "", destinationTypeBuffer, test.offset, test.length)
+		offset, length := d.pieceSection(test.chunkIndex)
+		if offset != test.expectedOffset || length != test.expectedLength {
+			t.Errorf("section [%v, +%v) of chunk %v: expected piece section (%v, %v), got (%v, %v)",
+				test.offset, test.length, test.chunkIndex, test.expectedOffset, test.expectedLength, offset, length)
+		}
+	}
+}
+
+// TestPieceSectionActions checks that pieceSectionActions requests the
+// segments holding the nonce and the requested section of the piece.
+func TestPieceSectionActions(t *testing.T) {
+	root := crypto.Hash{1}
+
+	// A section at the start of the piece shares a segment with the nonce.
+	actions := pieceSectionActions(root, 0, 10)
+	if len(actions) != 1 || actions[0].Offset != 0 || actions[0].Length != crypto.SegmentSize {
+		t.Fatal("wrong actions for a section at the start of the piece:", actions)
+	}
+
+	// A section later in the piece needs a separate segment for the nonce.
+	actions = pieceSectionActions(root, 1000, 100)
+	if len(actions) != 2 {
+		t.Fatal("expected two actions, got", actions)
+	}
+	if actions[0].Offset != 0 || actions[0].Length != crypto.SegmentSize {
+		t.Error("wrong nonce action:", actions[0])
+	}
+	start := uint64(crypto.TwofishNonceSize + 1000)
+	end := start + 100
+	if actions[1].Offset > start || actions[1].Offset+actions[1].Length < end {
+		t.Error("section action does not cover the section:", actions[1])
+	}
+	for _, action := range actions {
+		if action.MerkleRoot != root || !modules.IsRangeProofRequest(action) {
+			t.Error("action is not a valid range proof request:", action)
+		}
+	}
+}
+
+// TestWriteChunkAfterCancel checks that a chunk finishing after its download
+// was cancelled is neither written to the destination nor completes and
+// releases the download a second time.
+func TestWriteChunkAfterCancel(t *testing.T) {
+	rsc, _ := NewRSCode(2, 2)
+	f := newFile("foo", rsc, pieceSize, pieceSize*2)
+	dest := make(downloadDestinationBuffer, pieceSize*2)
+	d := newSectionDownload(f, dest, "", destinationTypeBuffer, 0, pieceSize*2)
+
+	d.mu.Lock()
+	d.fail(errDownloadCancelled)
+	d.mu.Unlock()
+	if err := <-d.downloadFinished; err != errDownloadCancelled {
+		t.Fatal("expected errDownloadCancelled, got", err)
+	}
+
+	cd := &chunkDownload{download: d, index: 0}
+	data := make([]byte, pieceSize*2)
+	data[0] = 1
+	if err := cd.writeChunk(data); err == nil {
+		t.Fatal("expected an error when writing a chunk of a cancelled download")
+	}
+	if dest[0] != 0 {
+		t.Error("chunk of a cancelled download was written to the destination")
+	}
+	select {
+	case err := <-d.downloadFinished:
+		t.Error("cancelled download finished a second time:", err)
+	default:
+	}
+}
@@ -0,0 +1,176 @@
+package renter
+
+// Downloads can be written to any object that implements the
+// downloadDestination interface. Chunks are recovered in whatever order their
+// pieces arrive, so destinations must either support random access or buffer
+// out-of-order data until the gap in front of it has been filled.
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/build"
+)
+
+const (
+	// destinationTypeBuffer indicates that a download is being written to an
+	// in-memory buffer for use by the renter itself, such as when repairing a
+	// chunk whose local source is unavailable.
+	destinationTypeBuffer = "buffer"
+
+	// destinationTypeFile indicates that a download is being written to a
+	// file on the local filesystem.
+	destinationTypeFile = "file"
+
+	// destinationTypeStream indicates that a download is being written to an
+	// io.Writer, such as an HTTP response.
+	destinationTypeStream = "stream"
+
+	// streamWindowChunks is the number of chunks of data that a stream
+	// destination may buffer ahead of the data consumed by its reader. The
+	// chunks of a stream are not scheduled while its window is full.
+	streamWindowChunks = 4
+)
+
+var (
+	// errBufferOverflow is returned if a download destination buffer is
+	// asked to write data that does not fit within the buffer.
+	errBufferOverflow = errors.New("download destination buffer received a write that does not fit")
+
+	// errOverlappingWrite is returned if a download destination is asked to
+	// write data that overlaps data it has already written.
+	errOverlappingWrite = errors.New("download destination received an overlapping write")
+)
+
+type (
+	// downloadDestination is the interface that recovered chunk data is
+	// written to. The offset is relative to the start of the requested
+	// section, not to the start of the file.
+	downloadDestination interface {
+		WriteAt(data []byte, offset int64) (int, error)
+	}
+
+	// downloadDestinationBuffer writes download data to a preallocated
+	// in-memory buffer.
+	downloadDestinationBuffer []byte
+
+	// downloadDestinationFile writes download data to a file on disk. The
+	// file is opened and synced for each write, which provides durability
+	// between chunks at the cost of some performance.
+	downloadDestinationFile struct {
+		path string
+	}
+
+	// downloadDestinationWriter buffers download data for an io.Writer.
+	// WriteAt never writes to w, so that a slow reader cannot hold up the
+	// download loop; the buffered data is written to w in order by flush,
+	// which is called by the goroutine that requested the download. Once
+	// window bytes are buffered, the destination is full, and no more chunks
+	// of the download are scheduled until the reader catches up.
+	downloadDestinationWriter struct {
+		w        io.Writer
+		window   uint64
+		buffered uint64           // total size of the pending writes
+		progress int64            // offset of the next byte to be written to w
+		pending  map[int64][]byte // buffered writes, keyed by offset
+		ready    chan struct{}    // signalled when data is buffered
+		mu       sync.Mutex
+	}
+)
+
+// WriteAt copies data into the buffer at the provided offset.
+func (ddb downloadDestinationBuffer) WriteAt(data []byte, offset int64) (int, error) {
+	if offset < 0 || offset+int64(len(data)) > int64(len(ddb)) {
+		return 0, errBufferOverflow
+	}
+	return copy(ddb[offset:], data), nil
+}
+
+// WriteAt writes data to the file at the provided offset, creating the file
+// if it does not exist.
+func (ddf *downloadDestinationFile) WriteAt(data []byte, offset int64) (int, error) {
+	fileDest, err := os.OpenFile(ddf.path, os.O_CREATE|os.O_WRONLY, defaultFilePerm)
+	if err != nil {
+		return 0, build.ExtendErr("unable to open download destination", err)
+	}
+	defer fileDest.Close()
+
+	n, err := fileDest.WriteAt(data, offset)
+	if err != nil {
+		return n, build.ExtendErr("unable to write to download destination", err)
+	}
+
+	// Sync the write to provide proper durability.
+	err = fileDest.Sync()
+	if err != nil {
+		return n, build.ExtendErr("unable to sync download destination", err)
+	}
+	return n, nil
+}
+
+// newDownloadDestinationWriter returns a downloadDestinationWriter that
+// writes to w, and that is full once window bytes are buffered.
+func newDownloadDestinationWriter(w io.Writer, window uint64) *downloadDestinationWriter {
+	return &downloadDestinationWriter{
+		w:       w,
+		window:  window,
+		pending: make(map[int64][]byte),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// WriteAt buffers data until it is written to the underlying io.Writer by
+// flush.
+func (ddw *downloadDestinationWriter) WriteAt(data []byte, offset int64) (int, error) {
+	ddw.mu.Lock()
+	defer ddw.mu.Unlock()
+
+	if offset < ddw.progress {
+		return 0, errOverlappingWrite
+	}
+	if _, exists := ddw.pending[offset]; exists {
+		return 0, errOverlappingWrite
+	}
+	// Copy the data, as the caller may reuse the slice.
+	ddw.pending[offset] = append([]byte(nil), data...)
+	ddw.buffered += uint64(len(data))
+	select {
+	case ddw.ready <- struct{}{}:
+	default:
+	}
+	return len(data), nil
+}
+
+// full returns true if the destination cannot accept more data until the
+// data it has buffered is consumed by the reader.
+func (ddw *downloadDestinationWriter) full() bool {
+	ddw.mu.Lock()
+	defer ddw.mu.Unlock()
+	return ddw.buffered >= ddw.window
+}
+
+// flush writes the buffered data that is contiguous with the data already
+// written to the underlying io.Writer. The lock is not held while writing,
+// so that the download loop can continue to buffer data.
+func (ddw *downloadDestinationWriter) flush() error {
+	for {
+		ddw.mu.Lock()
+		next, exists := ddw.pending[ddw.progress]
+		ddw.mu.Unlock()
+		if !exists {
+			return nil
+		}
+		n, err := ddw.w.Write(next)
+
+		ddw.mu.Lock()
+		delete(ddw.pending, ddw.progress)
+		ddw.buffered -= uint64(len(next))
+		ddw.progress += int64(n)
+		ddw.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
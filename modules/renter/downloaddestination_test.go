@@ -0,0 +1,59 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestDownloadDestinationWriter checks that the downloadDestinationWriter
+// writes out-of-order data to the underlying writer in order, and that it is
+// full once its window of data is buffered.
+func TestDownloadDestinationWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ddw := newDownloadDestinationWriter(buf, 6)
+
+	// Write the final section first; nothing should reach the writer.
+	data := []byte("abcdefghi")
+	if _, err := ddw.WriteAt(data[6:], 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := ddw.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("out-of-order data was written to the writer")
+	}
+	// A second write at the same offset is an overlap.
+	if _, err := ddw.WriteAt(data[6:], 6); err != errOverlappingWrite {
+		t.Fatal("expected errOverlappingWrite, got", err)
+	}
+
+	// Write the middle section, which fills the window, then the first
+	// section. Nothing reaches the writer until the data is flushed.
+	if _, err := ddw.WriteAt(data[3:6], 3); err != nil {
+		t.Fatal(err)
+	}
+	if !ddw.full() {
+		t.Fatal("destination should be full")
+	}
+	if _, err := ddw.WriteAt(data[:3], 0); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("data was written to the writer before it was flushed")
+	}
+	if err := ddw.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("expected %q, got %q", data, buf.Bytes())
+	}
+	if ddw.full() {
+		t.Fatal("destination should not be full after it was flushed")
+	}
+
+	// Data before the current progress is an overlap.
+	if _, err := ddw.WriteAt(data[:3], 0); err != errOverlappingWrite {
+		t.Fatal("expected errOverlappingWrite, got", err)
+	}
+}
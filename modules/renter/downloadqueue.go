@@ -2,11 +2,30 @@ package renter
 
 import (
 	"errors"
+	"io"
 	"sync/atomic"
 
 	"github.com/NebulousLabs/Sia/modules"
 )
 
+var (
+	// errDownloadCancelled is returned to the caller of a download that has
+	// been cancelled.
+	errDownloadCancelled = errors.New("download was cancelled")
+
+	// errDownloadFinished is returned when trying to pause, resume or cancel
+	// a download that has already completed, failed or been cancelled.
+	errDownloadFinished = errors.New("download has already finished")
+
+	// ErrUnknownDownload is returned when no download in the queue has the
+	// requested id.
+	ErrUnknownDownload = errors.New("no download with that id")
+
+	// errDownloadSectionOutOfBounds is returned if the requested section
+	// extends past the end of the file.
+	errDownloadSectionOutOfBounds = errors.New("requested section extends past the end of the file")
+)
+
 // Download downloads a file, identified by its path, to the destination
 // specified.
 func (r *Renter) Download(path, destination string) error {
@@ -20,10 +39,85 @@ func (r *Renter) Download(path, destination string) error {
 
 	// Create the download object and add it to the queue.
 	d := newDownload(file, destination)
-	lockID = r.mu.Lock()
+	return r.managedQueueDownload(d)
+}
+
+// DownloadSection downloads length bytes of a file, starting at offset, and
+// writes them to w in order. The data is written to w by the calling
+// goroutine, so that a slow writer only holds up its own download.
+func (r *Renter) DownloadSection(path string, w io.Writer, offset, length uint64) error {
+	// Lookup the file associated with the nickname.
+	lockID := r.mu.RLock()
+	file, exists := r.files[path]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return errors.New("no file with that path")
+	}
+	file.mu.RLock()
+	size := file.size
+	file.mu.RUnlock()
+	if offset+length < offset || offset+length > size {
+		return errDownloadSectionOutOfBounds
+	}
+	if length == 0 {
+		return nil
+	}
+
+	// Create the download object and hand it to the download loop. Streams
+	// are not added to the download queue, where every request of a stream
+	// would otherwise remain.
+	ddw := newDownloadDestinationWriter(w, streamWindowChunks*file.chunkSize())
+	d := newFileSectionDownload(file, ddw, "", destinationTypeStream, offset, length)
+	select {
+	case r.newDownloads <- d:
+	case <-r.tg.StopChan():
+		return errors.New("download interrupted by shutdown")
+	}
+
+	// Write the data to w as it arrives, until the download has completed.
+	for {
+		select {
+		case err := <-d.downloadFinished:
+			if err != nil {
+				return err
+			}
+			return ddw.flush()
+		case <-ddw.ready:
+		case <-r.tg.StopChan():
+			return errors.New("download interrupted by shutdown")
+		}
+		// A failed stream is marked as complete before the download loop is
+		// woken, so that the loop does not keep waiting for its window to
+		// drain.
+		err := ddw.flush()
+		if err != nil {
+			d.mu.Lock()
+			d.fail(err)
+			d.mu.Unlock()
+		}
+		select {
+		case r.streamsDrained <- struct{}{}:
+		default:
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// managedAddDownload adds a download to the download queue.
+func (r *Renter) managedAddDownload(d *download) {
+	lockID := r.mu.Lock()
 	r.downloadQueue = append(r.downloadQueue, d)
 	r.mu.Unlock(lockID)
+	r.managedSyncDownload(d)
 	r.newDownloads <- d
+}
+
+// managedQueueDownload adds a download to the download queue and blocks until
+// the download has completed.
+func (r *Renter) managedQueueDownload(d *download) error {
+	r.managedAddDownload(d)
 
 	// Block until the download has completed.
 	//
@@ -46,13 +140,122 @@ func (r *Renter) DownloadQueue() []modules.DownloadInfo {
 	downloads := make([]modules.DownloadInfo, len(r.downloadQueue))
 	for i := range r.downloadQueue {
 		d := r.downloadQueue[len(r.downloadQueue)-i-1]
+		d.mu.Lock()
 		downloads[i] = modules.DownloadInfo{
-			SiaPath:     d.siapath,
-			Destination: d.destination,
-			Filesize:    d.fileSize,
-			StartTime:   d.startTime,
+			ID:              d.id,
+			Status:          d.status(),
+			SiaPath:         d.siapath,
+			Destination:     d.destinationString,
+			DestinationType: d.destinationType,
+			Filesize:        d.reportedFileSize,
+			Offset:          d.offset - d.packOffset,
+			Length:          d.length,
+			StartTime:       d.startTime,
 		}
+		if d.downloadErr != nil {
+			downloads[i].Error = d.downloadErr.Error()
+		}
+		d.mu.Unlock()
 		downloads[i].Received = atomic.LoadUint64(&d.atomicDataReceived)
 	}
 	return downloads
 }
+
+// managedFindDownload returns the download in the queue with the given id.
+func (r *Renter) managedFindDownload(id string) (*download, error) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	for _, d := range r.downloadQueue {
+		if d.id == id {
+			return d, nil
+		}
+	}
+	return nil, ErrUnknownDownload
+}
+
+// CancelDownload stops the download with the given id. Chunks that are being
+// downloaded are discarded, and the caller of the download receives
+// errDownloadCancelled. Data that has already been written to the destination
+// is left in place.
+func (r *Renter) CancelDownload(id string) error {
+	d, err := r.managedFindDownload(id)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	if d.downloadComplete {
+		d.mu.Unlock()
+		return errDownloadFinished
+	}
+	d.fail(errDownloadCancelled)
+	d.mu.Unlock()
+	r.managedSyncDownload(d)
+	return nil
+}
+
+// PauseDownload pauses the download with the given id. Chunks that are
+// already being downloaded are finished, but no new chunks are started until
+// the download is resumed.
+func (r *Renter) PauseDownload(id string) error {
+	d, err := r.managedFindDownload(id)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	if d.downloadComplete {
+		d.mu.Unlock()
+		return errDownloadFinished
+	}
+	d.paused = true
+	d.mu.Unlock()
+	r.managedSyncDownload(d)
+	return nil
+}
+
+// ResumeDownload resumes the paused download with the given id. Resuming a
+// download that is not paused has no effect.
+func (r *Renter) ResumeDownload(id string) error {
+	d, err := r.managedFindDownload(id)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	if d.downloadComplete {
+		d.mu.Unlock()
+		return errDownloadFinished
+	}
+	d.paused = false
+	d.mu.Unlock()
+	r.managedSyncDownload(d)
+
+	// Send the download to the download loop so that its remaining chunks are
+	// queued again.
+	select {
+	case r.newDownloads <- d:
+	case <-r.tg.StopChan():
+		return errors.New("download interrupted by shutdown")
+	}
+	return nil
+}
+
+// threadedResumeDownloads hands the downloads that were restored at startup to
+// the download loop. Paused downloads are handed over once they are resumed.
+func (r *Renter) threadedResumeDownloads() {
+	lockID := r.mu.RLock()
+	downloads := append([]*download(nil), r.downloadQueue...)
+	r.mu.RUnlock(lockID)
+
+	for _, d := range downloads {
+		d.mu.Lock()
+		paused := d.paused
+		d.mu.Unlock()
+		if paused {
+			continue
+		}
+		select {
+		case r.newDownloads <- d:
+		case <-r.tg.StopChan():
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package renter
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestDownloadQueuePersistence checks that unfinished downloads can be paused
+// and cancelled, and that their progress is restored after a restart.
+func TestDownloadQueuePersistence(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestDownloadQueuePersistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add a file and a download of the file to the queue. The download is not
+	// handed to the download loop, as the file is not stored on any hosts.
+	rsc, _ := NewRSCode(1, 1)
+	f := newFile("foo", rsc, pieceSize, pieceSize*5)
+	destination := build.TempDir("renter", "TestDownloadQueuePersistence", "foo")
+	d := newDownload(f, destination)
+	id := rt.renter.mu.Lock()
+	rt.renter.addFileEntry(f.name, f)
+	rt.renter.downloadQueue = append(rt.renter.downloadQueue, d)
+	rt.renter.mu.Unlock(id)
+
+	if err := rt.renter.PauseDownload("foo"); err != ErrUnknownDownload {
+		t.Fatal("expected ErrUnknownDownload, got", err)
+	}
+	if err := rt.renter.PauseDownload(d.id); err != nil {
+		t.Fatal(err)
+	}
+	if status := rt.renter.DownloadQueue()[0].Status; status != modules.DownloadStatusPaused {
+		t.Fatal("download has wrong status:", status)
+	}
+
+	// Finish a chunk. The queue is saved by threadedSaveDownloads.
+	d.mu.Lock()
+	d.finishedChunks[1] = true
+	d.mu.Unlock()
+	rt.renter.managedUpdateDownload(d)
+	for i := 0; i < 50 && atomic.LoadUint32(&rt.renter.atomicDownloadsChanged) == 1; i++ {
+		time.Sleep(downloadsSaveInterval)
+	}
+	if atomic.LoadUint32(&rt.renter.atomicDownloadsChanged) == 1 {
+		t.Fatal("download queue was not saved")
+	}
+	// Wait for the save to finish writing the queue.
+	rt.renter.downloadsSaveMu.Lock()
+	rt.renter.downloadsSaveMu.Unlock()
+
+	// Reload the queue. The download should be restored along with its
+	// progress.
+	id = rt.renter.mu.Lock()
+	rt.renter.downloadQueue = nil
+	err = rt.renter.loadDownloads()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := rt.renter.DownloadQueue()
+	if len(queue) != 1 {
+		t.Fatal("expected 1 download to be restored, got", len(queue))
+	}
+	if queue[0].ID != d.id || queue[0].Status != modules.DownloadStatusPaused || queue[0].Destination != destination {
+		t.Fatal("download was not restored correctly:", queue[0])
+	}
+	if queue[0].Received != pieceSize {
+		t.Fatal("progress was not restored: expected", pieceSize, "got", queue[0].Received)
+	}
+
+	// Cancel the restored download. Cancelled downloads are not saved.
+	if err := rt.renter.CancelDownload(d.id); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.PauseDownload(d.id); err != errDownloadFinished {
+		t.Fatal("expected errDownloadFinished, got", err)
+	}
+	queue = rt.renter.DownloadQueue()
+	if queue[0].Status != modules.DownloadStatusCancelled || queue[0].Error != errDownloadCancelled.Error() {
+		t.Fatal("download was not cancelled:", queue[0])
+	}
+	id = rt.renter.mu.Lock()
+	rt.renter.downloadQueue = nil
+	err = rt.renter.loadDownloads()
+	numDownloads := len(rt.renter.downloadQueue)
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numDownloads != 0 {
+		t.Fatal("cancelled download was restored")
+	}
+}
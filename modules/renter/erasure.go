@@ -1,13 +1,84 @@
 package renter
 
 import (
+	"errors"
 	"io"
 
 	"github.com/klauspost/reedsolomon"
 
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
+// maxErasureCodePieces is the maximum number of pieces that a chunk can be
+// encoded into, which is the limit of the Reed-Solomon code.
+const maxErasureCodePieces = 256
+
+var (
+	errErasureCodeParams  = errors.New("wrong number of erasure code parameters")
+	errTooManyPieces      = errors.New("erasure code has too many pieces")
+	errUnknownErasureCode = errors.New("unknown erasure code type")
+)
+
+// erasureCodes maps the identifier of each type of erasure code to a function
+// that creates an erasure code of that type from its parameters. The type and
+// parameters of the erasure code of a file are stored in its metadata, so an
+// erasure code must be registered here before files can be uploaded with it.
+var erasureCodes = map[types.Specifier]func(params []uint64) (modules.ErasureCoder, error){
+	modules.ErasureCodeReedSolomon: func(params []uint64) (modules.ErasureCoder, error) {
+		if len(params) != 2 {
+			return nil, errErasureCodeParams
+		}
+		return NewRSCode(int(params[0]), int(params[1]))
+	},
+	modules.ErasureCodeReplication: func(params []uint64) (modules.ErasureCoder, error) {
+		if len(params) != 1 {
+			return nil, errErasureCodeParams
+		}
+		return NewReplicationCode(int(params[0]))
+	},
+	modules.ErasureCodeLRC: func(params []uint64) (modules.ErasureCoder, error) {
+		if len(params) != 3 {
+			return nil, errErasureCodeParams
+		}
+		return NewLRCode(int(params[0]), int(params[1]), int(params[2]))
+	},
+}
+
+// NewErasureCoder creates an erasure code of the type identified by codeType
+// using the supplied parameters.
+func NewErasureCoder(codeType types.Specifier, params []uint64) (modules.ErasureCoder, error) {
+	newCode, exists := erasureCodes[codeType]
+	if !exists {
+		return nil, errUnknownErasureCode
+	}
+	return newCode(params)
+}
+
+// effectivePieces returns the number of pieces that count towards the
+// MinPieces pieces needed to recover a chunk that was encoded with ec, given
+// the number of available copies of each piece of the chunk. Every copy
+// counts, except for the local parity pieces of a locally repairable code,
+// which only count if they can rebuild a missing data piece of their group.
+func effectivePieces(ec modules.ErasureCoder, pieces map[uint64]int) int {
+	if lrc, ok := ec.(*lrCode); ok {
+		return lrc.effectivePieces(pieces)
+	}
+	var n int
+	for _, copies := range pieces {
+		n += copies
+	}
+	return n
+}
+
+// localParityPiece reports whether the piece at pieceIndex is a local parity
+// piece of a locally repairable code. Local parity pieces are only downloaded
+// when no other piece of the chunk can be downloaded.
+func localParityPiece(ec modules.ErasureCoder, pieceIndex uint64) bool {
+	lrc, ok := ec.(*lrCode)
+	return ok && pieceIndex >= uint64(lrc.rs.numPieces)
+}
+
 // rsCode is a Reed-Solomon encoder/decoder. It implements the
 // modules.ErasureCoder interface.
 type rsCode struct {
@@ -24,6 +95,14 @@ func (rs *rsCode) NumPieces() int { return rs.numPieces }
 // recover the original data.
 func (rs *rsCode) MinPieces() int { return rs.dataPieces }
 
+// Type returns the identifier of the Reed-Solomon erasure code.
+func (rs *rsCode) Type() types.Specifier { return modules.ErasureCodeReedSolomon }
+
+// Params returns the number of data pieces and parity pieces of the code.
+func (rs *rsCode) Params() []uint64 {
+	return []uint64{uint64(rs.dataPieces), uint64(rs.numPieces - rs.dataPieces)}
+}
+
 // Encode splits data into equal-length pieces, some containing the original
 // data and some containing parity data.
 func (rs *rsCode) Encode(data []byte) ([][]byte, error) {
@@ -65,3 +144,260 @@ func NewRSCode(nData, nParity int) (modules.ErasureCoder, error) {
 		dataPieces: nData,
 	}, nil
 }
+
+// replicationCode is an erasure code that stores a full copy of the data in
+// each piece. It implements the modules.ErasureCoder interface.
+type replicationCode struct {
+	copies int
+}
+
+// NumPieces returns the number of pieces returned by Encode.
+func (rc *replicationCode) NumPieces() int { return rc.copies }
+
+// MinPieces return the minimum number of pieces that must be present to
+// recover the original data, which is a single copy.
+func (rc *replicationCode) MinPieces() int { return 1 }
+
+// Type returns the identifier of the replication erasure code.
+func (rc *replicationCode) Type() types.Specifier { return modules.ErasureCodeReplication }
+
+// Params returns the number of copies stored by the code.
+func (rc *replicationCode) Params() []uint64 { return []uint64{uint64(rc.copies)} }
+
+// Encode returns a copy of data for each piece.
+func (rc *replicationCode) Encode(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, reedsolomon.ErrShortData
+	}
+	pieces := make([][]byte, rc.copies)
+	for i := range pieces {
+		pieces[i] = append([]byte(nil), data...)
+	}
+	return pieces, nil
+}
+
+// Recover writes the first n bytes of any present piece to w.
+func (rc *replicationCode) Recover(pieces [][]byte, n uint64, w io.Writer) error {
+	for _, piece := range pieces {
+		if piece == nil {
+			continue
+		}
+		if uint64(len(piece)) < n {
+			return reedsolomon.ErrShortData
+		}
+		_, err := w.Write(piece[:n])
+		return err
+	}
+	return reedsolomon.ErrTooFewShards
+}
+
+// NewReplicationCode creates a new replication code that stores the supplied
+// number of copies.
+func NewReplicationCode(copies int) (modules.ErasureCoder, error) {
+	if copies <= 0 {
+		return nil, reedsolomon.ErrInvShardNum
+	} else if copies > maxErasureCodePieces {
+		return nil, errTooManyPieces
+	}
+	return &replicationCode{copies: copies}, nil
+}
+
+// lrCode is a locally repairable code. The data pieces and global parity
+// pieces of a Reed-Solomon code are followed by a local parity piece for each
+// group of data pieces, which is the XOR of the data pieces of its group. A
+// lost data piece or local parity piece can be rebuilt from the other pieces
+// of its group instead of from MinPieces pieces, and any MinPieces of the
+// data pieces and global parity pieces recover the data. lrCode implements
+// the modules.ErasureCoder interface.
+type lrCode struct {
+	rs          *rsCode
+	localGroups int
+}
+
+// NumPieces returns the number of pieces returned by Encode.
+func (lrc *lrCode) NumPieces() int { return lrc.rs.numPieces + lrc.localGroups }
+
+// MinPieces return the minimum number of data pieces and global parity pieces
+// that must be present to recover the original data.
+func (lrc *lrCode) MinPieces() int { return lrc.rs.dataPieces }
+
+// Type returns the identifier of the locally repairable erasure code.
+func (lrc *lrCode) Type() types.Specifier { return modules.ErasureCodeLRC }
+
+// Params returns the number of data pieces, global parity pieces, and local
+// groups of the code.
+func (lrc *lrCode) Params() []uint64 {
+	return append(lrc.rs.Params(), uint64(lrc.localGroups))
+}
+
+// group returns the index of the local group of a data piece.
+func (lrc *lrCode) group(dataPiece int) int {
+	return dataPiece * lrc.localGroups / lrc.rs.dataPieces
+}
+
+// Encode splits data into the data pieces and global parity pieces of the
+// Reed-Solomon code, and appends the local parity piece of each group.
+func (lrc *lrCode) Encode(data []byte) ([][]byte, error) {
+	pieces, err := lrc.rs.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	for g := 0; g < lrc.localGroups; g++ {
+		pieces = append(pieces, make([]byte, len(pieces[0])))
+	}
+	for i := 0; i < lrc.rs.dataPieces; i++ {
+		xorBytes(pieces[lrc.rs.numPieces+lrc.group(i)], pieces[i])
+	}
+	return pieces, nil
+}
+
+// missingData returns the data pieces of group g that are not in pieces.
+func (lrc *lrCode) missingData(g int, pieces map[uint64]int) []uint64 {
+	var missing []uint64
+	for i := 0; i < lrc.rs.dataPieces; i++ {
+		if _, ok := pieces[uint64(i)]; lrc.group(i) == g && !ok {
+			missing = append(missing, uint64(i))
+		}
+	}
+	return missing
+}
+
+// effectivePieces returns the number of copies of data pieces and global
+// parity pieces in pieces, plus the number of missing data pieces that can be
+// rebuilt from the local parity pieces in pieces.
+func (lrc *lrCode) effectivePieces(pieces map[uint64]int) int {
+	var n int
+	for i, copies := range pieces {
+		if i < uint64(lrc.rs.numPieces) {
+			n += copies
+		}
+	}
+	for g := 0; g < lrc.localGroups; g++ {
+		_, parity := pieces[uint64(lrc.rs.numPieces+g)]
+		if parity && len(lrc.missingData(g, pieces)) == 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// localRepairSources returns the pieces that must be downloaded to rebuild
+// every piece that is not in pieces from the other pieces of its group. ok is
+// false if a missing piece cannot be rebuilt within its group, because a
+// global parity piece or more than one piece of the group is missing, in
+// which case the chunk must be recovered from MinPieces pieces instead.
+func (lrc *lrCode) localRepairSources(pieces map[uint64]int) (sources []uint64, ok bool) {
+	for i := lrc.rs.dataPieces; i < lrc.rs.numPieces; i++ {
+		if _, exists := pieces[uint64(i)]; !exists {
+			return nil, false
+		}
+	}
+	for g := 0; g < lrc.localGroups; g++ {
+		parity := uint64(lrc.rs.numPieces + g)
+		_, parityExists := pieces[parity]
+		missing := lrc.missingData(g, pieces)
+		if parityExists && len(missing) == 0 {
+			continue
+		} else if len(missing) > 1 || (!parityExists && len(missing) == 1) {
+			return nil, false
+		}
+		for i := 0; i < lrc.rs.dataPieces; i++ {
+			if _, exists := pieces[uint64(i)]; exists && lrc.group(i) == g {
+				sources = append(sources, uint64(i))
+			}
+		}
+		if parityExists {
+			sources = append(sources, parity)
+		}
+	}
+	return sources, true
+}
+
+// rebuildGroups rebuilds the missing data piece of each group that is missing
+// a single data piece from its local parity piece, and then rebuilds the
+// missing local parity piece of each group whose data pieces are present.
+// Missing pieces are set to nil.
+func (lrc *lrCode) rebuildGroups(pieces [][]byte) {
+	for g := 0; g < lrc.localGroups; g++ {
+		parity := pieces[lrc.rs.numPieces+g]
+		missing := -1
+		for i := 0; i < lrc.rs.dataPieces; i++ {
+			if lrc.group(i) != g || pieces[i] != nil {
+				continue
+			} else if missing != -1 {
+				missing = -1
+				break
+			}
+			missing = i
+		}
+		if parity == nil || missing == -1 {
+			continue
+		}
+		rebuilt := append([]byte(nil), parity...)
+		for i := 0; i < lrc.rs.dataPieces; i++ {
+			if lrc.group(i) == g && i != missing {
+				xorBytes(rebuilt, pieces[i])
+			}
+		}
+		pieces[missing] = rebuilt
+	}
+	for g := 0; g < lrc.localGroups; g++ {
+		if pieces[lrc.rs.numPieces+g] != nil {
+			continue
+		}
+		var parity []byte
+		for i := 0; i < lrc.rs.dataPieces; i++ {
+			if lrc.group(i) != g {
+				continue
+			} else if pieces[i] == nil {
+				parity = nil
+				break
+			} else if parity == nil {
+				parity = make([]byte, len(pieces[i]))
+			}
+			xorBytes(parity, pieces[i])
+		}
+		pieces[lrc.rs.numPieces+g] = parity
+	}
+}
+
+// Recover first rebuilds each group that is missing a single data piece from
+// its local parity piece, and then recovers the remaining data pieces from the
+// global parity pieces. The recovered data is written to w.
+func (lrc *lrCode) Recover(pieces [][]byte, n uint64, w io.Writer) error {
+	if len(pieces) != lrc.NumPieces() {
+		return reedsolomon.ErrTooFewShards
+	}
+	lrc.rebuildGroups(pieces)
+	return lrc.rs.Recover(pieces[:lrc.rs.numPieces], n, w)
+}
+
+// NewLRCode creates a new locally repairable code with nData data pieces,
+// nGlobal global parity pieces, and a local parity piece for each of
+// localGroups groups of data pieces.
+func NewLRCode(nData, nGlobal, localGroups int) (modules.ErasureCoder, error) {
+	if localGroups <= 0 || localGroups > nData {
+		return nil, reedsolomon.ErrInvShardNum
+	} else if nData+nGlobal+localGroups > maxErasureCodePieces {
+		return nil, errTooManyPieces
+	}
+	rs, err := NewRSCode(nData, nGlobal)
+	if err != nil {
+		return nil, err
+	}
+	return &lrCode{
+		rs:          rs.(*rsCode),
+		localGroups: localGroups,
+	}, nil
+}
+
+// xorBytes sets dst to the XOR of dst and src. A piece that is shorter than
+// dst is treated as if it were padded with zeros.
+func xorBytes(dst, src []byte) {
+	for i := range src {
+		if i >= len(dst) {
+			return
+		}
+		dst[i] ^= src[i]
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"crypto/rand"
 	"io/ioutil"
+	"reflect"
 	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // TestRSEncode tests the rsCode type.
@@ -57,6 +61,177 @@ func TestRSEncode(t *testing.T) {
 	}
 }
 
+// TestReplicationEncode tests the replicationCode type.
+func TestReplicationEncode(t *testing.T) {
+	if _, err := NewReplicationCode(0); err == nil {
+		t.Error("expected bad parameter error, got nil")
+	}
+	if _, err := NewReplicationCode(maxErasureCodePieces + 1); err != errTooManyPieces {
+		t.Error("expected too many pieces error, got", err)
+	}
+	rc, err := NewReplicationCode(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.NumPieces() != 3 || rc.MinPieces() != 1 {
+		t.Fatal("wrong number of pieces:", rc.NumPieces(), rc.MinPieces())
+	}
+
+	data := make([]byte, 777)
+	rand.Read(data)
+	pieces, err := rc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Encode(nil); err == nil {
+		t.Fatal("expected nil data error, got nil")
+	}
+
+	// Any single piece recovers the data.
+	pieces[0], pieces[1] = nil, nil
+	buf := new(bytes.Buffer)
+	if err := rc.Recover(pieces, 777, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Fatal("recovered data does not match original")
+	}
+	pieces[2] = nil
+	if err := rc.Recover(pieces, 777, buf); err == nil {
+		t.Fatal("expected too few pieces error, got nil")
+	}
+}
+
+// TestLRCEncode tests the lrCode type.
+func TestLRCEncode(t *testing.T) {
+	badParams := []struct {
+		data, global, groups int
+	}{
+		{4, 2, 0},
+		{4, 2, 5},
+		{0, 2, 1},
+		{4, 0, 2},
+		{200, 50, 10},
+	}
+	for _, ps := range badParams {
+		if _, err := NewLRCode(ps.data, ps.global, ps.groups); err == nil {
+			t.Error("expected bad parameter error, got nil", ps)
+		}
+	}
+
+	lrc, err := NewLRCode(6, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lrc.NumPieces() != 10 || lrc.MinPieces() != 6 {
+		t.Fatal("wrong number of pieces:", lrc.NumPieces(), lrc.MinPieces())
+	}
+	data := make([]byte, 777)
+	rand.Read(data)
+	pieces, err := lrc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recoverWithout := func(missing ...int) error {
+		chunk := make([][]byte, len(pieces))
+		copy(chunk, pieces)
+		for _, i := range missing {
+			chunk[i] = nil
+		}
+		buf := new(bytes.Buffer)
+		if err := lrc.Recover(chunk, 777, buf); err != nil {
+			return err
+		} else if !bytes.Equal(data, buf.Bytes()) {
+			t.Fatal("recovered data does not match original")
+		}
+		return nil
+	}
+
+	// A lost data piece of each group is rebuilt from its local parity piece,
+	// even without the global parity pieces.
+	if err := recoverWithout(0, 4, 6, 7); err != nil {
+		t.Fatal(err)
+	}
+	// Any MinPieces of the data pieces and global parity pieces recover the
+	// data.
+	if err := recoverWithout(0, 1, 8, 9); err != nil {
+		t.Fatal(err)
+	}
+	// Three lost data pieces of a group cannot be recovered without the
+	// global parity pieces.
+	if err := recoverWithout(0, 1, 2, 6); err == nil {
+		t.Fatal("expected too few pieces error, got nil")
+	}
+
+	// Local parity pieces only count towards recovery if they rebuild a
+	// missing data piece of their group.
+	set := func(pieces ...uint64) map[uint64]int {
+		m := make(map[uint64]int)
+		for _, p := range pieces {
+			m[p] = 1
+		}
+		return m
+	}
+	if n := effectivePieces(lrc, set(1, 2, 3, 4, 5, 8, 9)); n != 6 {
+		t.Error("expected 6 effective pieces, got", n)
+	}
+	if n := effectivePieces(lrc, set(0, 1, 2, 3, 8, 9)); n != 4 {
+		t.Error("expected 4 effective pieces, got", n)
+	}
+	for i := uint64(0); i < uint64(lrc.NumPieces()); i++ {
+		if localParityPiece(lrc, i) != (i >= 8) {
+			t.Error("wrong local parity piece", i)
+		}
+	}
+
+	// A lost data piece and a lost local parity piece are rebuilt from the
+	// other pieces of their groups.
+	sources, ok := lrc.(*lrCode).localRepairSources(set(1, 2, 3, 4, 5, 6, 7, 8))
+	if !ok || !reflect.DeepEqual(sources, []uint64{1, 2, 8, 3, 4, 5}) {
+		t.Fatal("wrong local repair sources:", sources, ok)
+	}
+	chunk := make([][]byte, len(pieces))
+	for _, i := range sources {
+		chunk[i] = pieces[i]
+	}
+	lrc.(*lrCode).rebuildGroups(chunk)
+	if !bytes.Equal(chunk[0], pieces[0]) || !bytes.Equal(chunk[9], pieces[9]) {
+		t.Fatal("rebuilt pieces do not match the originals")
+	}
+	// Two lost data pieces of a group, or a lost global parity piece, cannot
+	// be rebuilt within their groups.
+	if _, ok := lrc.(*lrCode).localRepairSources(set(2, 3, 4, 5, 6, 7, 8, 9)); ok {
+		t.Error("expected two lost data pieces to need a full repair")
+	}
+	if _, ok := lrc.(*lrCode).localRepairSources(set(0, 1, 2, 3, 4, 5, 6, 8, 9)); ok {
+		t.Error("expected a lost global parity piece to need a full repair")
+	}
+}
+
+// TestNewErasureCoder checks that erasure codes are recreated from their type
+// and parameters.
+func TestNewErasureCoder(t *testing.T) {
+	rsc, _ := NewRSCode(3, 2)
+	rc, _ := NewReplicationCode(3)
+	lrc, _ := NewLRCode(4, 2, 2)
+	for _, ec := range []modules.ErasureCoder{rsc, rc, lrc} {
+		newEC, err := NewErasureCoder(ec.Type(), ec.Params())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ec, newEC) {
+			t.Error("erasure code was not recreated:", ec.Type())
+		}
+		if _, err := NewErasureCoder(ec.Type(), nil); err != errErasureCodeParams {
+			t.Error("expected parameter error, got", err)
+		}
+	}
+	if _, err := NewErasureCoder(types.Specifier{'f', 'o', 'o'}, nil); err != errUnknownErasureCode {
+		t.Error("expected unknown erasure code error, got", err)
+	}
+}
+
 func BenchmarkRSEncode(b *testing.B) {
 	rsc, err := NewRSCode(80, 20)
 	if err != nil {
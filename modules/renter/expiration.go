@@ -0,0 +1,191 @@
+package renter
+
+// A file may be given an expiration height, after which the renter no longer
+// keeps it. Files without an expiration height are kept for as long as the
+// renter renews its contracts. Once the expiration height of a file is
+// reached, the file is removed from the renter along with its earlier
+// versions, and its sectors are deleted from the hosts unless a snapshot still
+// refers to it.
+//
+// The expiration of files also determines which contracts are renewed: the
+// renter reports to the contractor how many of the sectors stored with each
+// host are retained by files that have not expired by the end of a contract,
+// and contracts that store no retained data are left to expire.
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// expirationCheckInterval is the amount of time that the renter waits
+	// between checks for files that have expired.
+	expirationCheckInterval = build.Select(build.Var{
+		Standard: 10 * time.Minute,
+		Dev:      time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	errExpirationPassed = errors.New("expiration height has already passed")
+)
+
+// expired returns true if the expiration height of f has been reached.
+func (f *file) expired(height types.BlockHeight) bool {
+	return f.expireHeight != 0 && height >= f.expireHeight
+}
+
+// retainedAt returns true if f is still kept at the given height.
+func (f *file) retainedAt(height types.BlockHeight) bool {
+	return f.expireHeight == 0 || f.expireHeight > height
+}
+
+// renewing returns true if the data of f is carried over to renewed contracts
+// when its current contracts end.
+func (f *file) renewing() bool {
+	return f.retainedAt(f.expiration())
+}
+
+// SetFileExpiration sets the height at which the file at siaPath expires. A
+// height of 0 keeps the file for as long as the renter renews its contracts.
+func (r *Renter) SetFileExpiration(siaPath string, height types.BlockHeight) error {
+	if height != 0 && height <= r.cs.Height() {
+		return errExpirationPassed
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	f, exists := r.files[siaPath]
+	if !exists {
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireHeight = height
+	return r.persistFile(f)
+}
+
+// RetainedSectors implements the contractor.Retainer interface. It returns
+// the number of distinct sectors stored with host that belong to files that
+// are still kept at the given height. The data of archived files is always
+// retained, and the data of packs and deduplicated chunks is retained as long
+// as one of the files stored in them is.
+func (r *Renter) RetainedSectors(host types.SiaPublicKey, height types.BlockHeight) uint64 {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	roots := make(map[crypto.Hash]struct{})
+	addContracts := func(contracts map[types.FileContractID]fileContract) {
+		for _, fc := range contracts {
+			if fc.HostPublicKey.String() != host.String() {
+				continue
+			}
+			for _, p := range fc.Pieces {
+				roots[p.MerkleRoot] = struct{}{}
+			}
+		}
+	}
+	retained := func(f *file) bool {
+		if _, archived := r.archived[f]; archived {
+			return true
+		}
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+		return f.retainedAt(height)
+	}
+	for _, f := range r.files {
+		f.mu.RLock()
+		if f.retainedAt(height) {
+			addContracts(f.contracts)
+		}
+		f.mu.RUnlock()
+	}
+	for f := range r.archived {
+		f.mu.RLock()
+		addContracts(f.contracts)
+		f.mu.RUnlock()
+	}
+	for name, p := range r.packs {
+		for m := range r.packMembers[name] {
+			if retained(m) {
+				p.mu.RLock()
+				addContracts(p.contracts)
+				p.mu.RUnlock()
+				break
+			}
+		}
+	}
+	for _, dc := range r.dedupChunks {
+		for rf := range dc.refs {
+			if retained(rf) {
+				addContracts(dc.contracts)
+				break
+			}
+		}
+	}
+	return uint64(len(roots))
+}
+
+// expireFile removes f, the current file at siaPath, from the renter along
+// with its earlier versions, because its expiration height has been reached.
+// The data of the file is deleted from the hosts unless a snapshot still
+// refers to it.
+func (r *Renter) expireFile(siaPath string, f *file) {
+	versions := r.versions[siaPath]
+	delete(r.versions, siaPath)
+	for _, v := range versions {
+		r.releaseArchivedFile(v.file)
+	}
+	r.removeFileEntry(siaPath)
+	delete(r.tracking, siaPath)
+	os.RemoveAll(filepath.Join(r.persistDir, siaPath+ShareExtension))
+	if _, archived := r.archived[f]; archived {
+		return
+	}
+	r.releaseFileData(f)
+}
+
+// expireFiles removes the files whose expiration height has been reached. true
+// is returned if any file expired.
+func (r *Renter) expireFiles(height types.BlockHeight) bool {
+	var expired bool
+	for siaPath, f := range r.files {
+		f.mu.RLock()
+		isExpired := f.expired(height)
+		f.mu.RUnlock()
+		if isExpired {
+			r.log.Println("INFO: file", siaPath, "has expired at height", height)
+			r.expireFile(siaPath, f)
+			expired = true
+		}
+	}
+	return expired
+}
+
+// threadedExpireFiles periodically removes the files whose expiration height
+// has been reached.
+func (r *Renter) threadedExpireFiles() {
+	for {
+		select {
+		case <-time.After(expirationCheckInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+
+		height := r.cs.Height()
+		id := r.mu.Lock()
+		if r.expireFiles(height) {
+			if err := r.saveSync(); err != nil {
+				r.log.Println("WARN: could not save the renter:", err)
+			}
+			if err := r.saveArchive(); err != nil {
+				r.log.Println("WARN: could not save the archive:", err)
+			}
+		}
+		r.mu.Unlock(id)
+	}
+}
@@ -0,0 +1,198 @@
+package renter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/sync"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRetainedSectors checks that only the sectors of files that are still
+// kept at a given height are retained.
+func TestRetainedSectors(t *testing.T) {
+	r := &Renter{
+		dirIndex: newDirIndex(nil, nil),
+		files:    make(map[string]*file),
+		mu:       sync.New(modules.SafeMutexDelay, 1),
+	}
+	rsc, _ := NewRSCode(1, 1)
+	forever := newFile("forever", rsc, 10, 10)
+	forever.contracts[types.FileContractID{1}] = fileContract{
+		ID:            types.FileContractID{1},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("foo")},
+		WindowStart:   100,
+		Pieces:        []pieceData{{MerkleRoot: crypto.Hash{1}}, {MerkleRoot: crypto.Hash{2}}},
+	}
+	expiring := newFile("expiring", rsc, 10, 10)
+	expiring.expireHeight = 50
+	expiring.contracts[types.FileContractID{1}] = fileContract{
+		ID:            types.FileContractID{1},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("foo")},
+		WindowStart:   100,
+		Pieces:        []pieceData{{MerkleRoot: crypto.Hash{2}}, {MerkleRoot: crypto.Hash{3}}},
+	}
+	expiring.contracts[types.FileContractID{2}] = fileContract{
+		ID:            types.FileContractID{2},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("bar")},
+		WindowStart:   100,
+		Pieces:        []pieceData{{MerkleRoot: crypto.Hash{4}}},
+	}
+	r.addFileEntry(forever.name, forever)
+	r.addFileEntry(expiring.name, expiring)
+
+	tests := []struct {
+		host     string
+		height   types.BlockHeight
+		retained uint64
+	}{
+		{"foo", 40, 3},
+		{"foo", 50, 2},
+		{"bar", 40, 1},
+		{"bar", 50, 0},
+		{"baz", 40, 0},
+	}
+	for _, test := range tests {
+		if retained := r.RetainedSectors(types.SiaPublicKey{Key: []byte(test.host)}, test.height); retained != test.retained {
+			t.Errorf("expected %v sectors of %v to be retained at height %v, got %v", test.retained, test.host, test.height, retained)
+		}
+	}
+
+	if !forever.renewing() {
+		t.Error("file without an expiration height should be renewing")
+	}
+	if expiring.renewing() {
+		t.Error("file that expires before its contracts end should not be renewing")
+	}
+}
+
+// TestRetainedSharedSectors checks that the sectors of packs and deduplicated
+// chunks are only retained while one of the files stored in them is kept.
+func TestRetainedSharedSectors(t *testing.T) {
+	r := &Renter{
+		archived:    make(map[*file]archivedFile),
+		dedupChunks: make(map[crypto.Hash]*dedupChunk),
+		files:       make(map[string]*file),
+		packMembers: make(map[string]map[*file]struct{}),
+		packs:       make(map[string]*file),
+		mu:          sync.New(modules.SafeMutexDelay, 1),
+	}
+	rsc, _ := NewRSCode(1, 1)
+	host := types.SiaPublicKey{Key: []byte("foo")}
+	sharedContract := func(root crypto.Hash) map[types.FileContractID]fileContract {
+		return map[types.FileContractID]fileContract{
+			{1}: {
+				ID:            types.FileContractID{1},
+				HostPublicKey: host,
+				WindowStart:   100,
+				Pieces:        []pieceData{{MerkleRoot: root}},
+			},
+		}
+	}
+	expiringAt := func(name string, height types.BlockHeight) *file {
+		f := newFile(name, rsc, 10, 10)
+		f.expireHeight = height
+		return f
+	}
+
+	// A pack that stores two files, the later of which expires at height 60.
+	pack := newFile("pack", rsc, 10, 10)
+	pack.contracts = sharedContract(crypto.Hash{1})
+	r.packs[pack.name] = pack
+	r.packMembers[pack.name] = map[*file]struct{}{
+		expiringAt("packed1", 50): {},
+		expiringAt("packed2", 60): {},
+	}
+
+	// A deduplicated chunk of a file that expires at height 50, and one of
+	// an expiring file that is kept by a snapshot.
+	r.dedupChunks[crypto.Hash{1}] = &dedupChunk{
+		contracts: sharedContract(crypto.Hash{2}),
+		refs:      map[*file][]uint64{expiringAt("dedup", 50): {0}},
+	}
+	snapshotted := expiringAt("snapshotted", 50)
+	r.archived[snapshotted] = archivedFile{}
+	r.dedupChunks[crypto.Hash{2}] = &dedupChunk{
+		contracts: sharedContract(crypto.Hash{3}),
+		refs:      map[*file][]uint64{snapshotted: {0}},
+	}
+
+	tests := []struct {
+		height   types.BlockHeight
+		retained uint64
+	}{
+		{40, 3},
+		{50, 2},
+		{60, 1},
+	}
+	for _, test := range tests {
+		if retained := r.RetainedSectors(host, test.height); retained != test.retained {
+			t.Errorf("expected %v sectors to be retained at height %v, got %v", test.retained, test.height, retained)
+		}
+	}
+}
+
+// TestExpireFiles checks that files are removed once their expiration height
+// is reached, and that files without an expiration height are kept.
+func TestExpireFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestExpireFiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	for _, name := range []string{"forever", "expiring"} {
+		f := newFile(name, rsc, 10, 15)
+		rt.renter.addFileEntry(name, f)
+		rt.renter.tracking[name] = trackedFile{}
+	}
+	height := rt.cs.Height()
+	if err := rt.renter.SetFileExpiration("expiring", height); err != errExpirationPassed {
+		t.Fatal("expected errExpirationPassed, got", err)
+	}
+	if err := rt.renter.SetFileExpiration("dne", height+10); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	if err := rt.renter.SetFileExpiration("expiring", height+10); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := rt.renter.File("expiring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.ExpirationHeight != height+10 {
+		t.Fatal("expiration height was not set:", fi.ExpirationHeight)
+	}
+
+	// Nothing expires before the expiration height.
+	id := rt.renter.mu.Lock()
+	expired := rt.renter.expireFiles(height + 9)
+	rt.renter.mu.Unlock(id)
+	if expired || len(rt.renter.FileList()) != 2 {
+		t.Fatal("file expired before its expiration height")
+	}
+
+	id = rt.renter.mu.Lock()
+	expired = rt.renter.expireFiles(height + 10)
+	rt.renter.mu.Unlock(id)
+	if !expired {
+		t.Fatal("file did not expire at its expiration height")
+	}
+	files := rt.renter.FileList()
+	if len(files) != 1 || files[0].SiaPath != "forever" {
+		t.Fatal("wrong files after expiration:", files)
+	}
+	if _, exists := rt.renter.tracking["expiring"]; exists {
+		t.Error("expired file is still tracked")
+	}
+	if _, err := os.Stat(filepath.Join(rt.renter.persistDir, "expiring"+ShareExtension)); !os.IsNotExist(err) {
+		t.Error("the .sia file of the expired file was not removed:", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -25,35 +26,86 @@ var (
 // contract covers many pieces.
 type file struct {
 	name        string
-	size        uint64 // Static - can be accessed without lock.
+	size        uint64 // Static - can be accessed without lock, except during a stream upload or while the file is an open pack.
 	contracts   map[types.FileContractID]fileContract
 	masterKey   crypto.TwofishKey    // Static - can be accessed without lock.
 	erasureCode modules.ErasureCoder // Static - can be accessed without lock.
 	pieceSize   uint64               // Static - can be accessed without lock.
 	mode        uint32               // actually an os.FileMode
 
+	// pack is set if the file is a small file whose data is stored at
+	// packOffset within a pack that is shared with other small files. The
+	// contracts of a packed file are empty.
+	pack       *file  // Static - can be accessed without lock.
+	packOffset uint64 // Static - can be accessed without lock.
+
+	// chunkHashes is set if the file is deduplicated. It contains the hash
+	// of the content of each chunk. dedupKeys contains the key of each chunk
+	// in the index of deduplicated chunks, from which the key of the chunk is
+	// derived instead of from the master key. Both are set by
+	// setChunkHashes.
+	chunkHashes []crypto.Hash // Static - can be accessed without lock.
+	dedupKeys   []crypto.Hash // Static - can be accessed without lock.
+
+	// compression is set if the file is compressed before it is erasure
+	// coded. Each chunk of a compressed file is compressed on its own and
+	// holds a variable amount of the file's data; chunkOffsets contains the
+	// offset within the file at which the data of each chunk begins, and
+	// compressedHashes contains the hash of each compressed chunk.
+	compression      string        // Static - can be accessed without lock.
+	chunkOffsets     []uint64      // Static - can be accessed without lock.
+	compressedHashes []crypto.Hash // Static - can be accessed without lock.
+
+	// metadata contains the key/value tags attached to the file, such as its
+	// content type and owner.
+	metadata map[string]string
+
+	// expireHeight is the height at which the file expires and is removed
+	// from the renter. A value of 0 keeps the file forever.
+	expireHeight types.BlockHeight
+
+	// COMPATv1.1.0 - legacyAddrs is set if the file was decoded from a .sia
+	// file that identifies the host of each contract by its address. It maps
+	// the contracts whose host has not been resolved to the address of the
+	// host.
+	legacyAddrs map[types.FileContractID]modules.NetAddress
+
+	// streaming is set while a stream upload appends chunks to the file. The
+	// file is not queued for repair while it is streaming, because the repair
+	// loop would try to fetch the chunk that is being uploaded.
+	streaming bool
+
+	// updating is set while the file is being updated. An updated file is
+	// not queued for repair until the update is done, and only one update
+	// can run at a time. generation is incremented whenever an update
+	// replaces pieces of the file, so that pieces and chunks produced from
+	// the old data can be told apart from those of the new data.
+	updating   bool
+	generation uint64
+
 	mu sync.RWMutex
 }
 
 // A fileContract is a contract covering an arbitrary number of file pieces.
 // Chunk/Piece metadata is used to split the raw contract data appropriately.
+// The host of the contract is identified by its public key, so that its
+// pieces can still be found after the host moves to a new address.
 type fileContract struct {
-	ID     types.FileContractID
-	IP     modules.NetAddress
-	Pieces []pieceData
+	ID            types.FileContractID
+	HostPublicKey types.SiaPublicKey
+	Pieces        []pieceData
 
 	WindowStart types.BlockHeight
 }
 
 // pieceData contains the metadata necessary to request a piece from a
-// fetcher.
-//
-// TODO: Add an 'Unavailable' flag that can be set if the host loses the piece.
-// Some TODOs exist in 'repair.go' related to this field.
+// fetcher. Unavailable is set when the host fails an audit of the piece; such
+// pieces are not used for downloads and are replaced by the repair loop.
 type pieceData struct {
-	Chunk      uint64      // which chunk the piece belongs to
-	Piece      uint64      // the index of the piece in the chunk
-	MerkleRoot crypto.Hash // the Merkle root of the piece
+	Chunk       uint64      // which chunk the piece belongs to
+	Piece       uint64      // the index of the piece in the chunk
+	MerkleRoot  crypto.Hash // the Merkle root of the piece
+	Unavailable bool        // whether the host has lost the piece
 }
 
 // deriveKey derives the key used to encrypt and decrypt a specific file piece.
@@ -61,6 +113,36 @@ func deriveKey(masterKey crypto.TwofishKey, chunkIndex, pieceIndex uint64) crypt
 	return crypto.TwofishKey(crypto.HashAll(masterKey, chunkIndex, pieceIndex))
 }
 
+// pieceKey derives the key used to encrypt and decrypt a specific piece of a
+// file. The pieces of a deduplicated chunk are encrypted with a key derived
+// from its dedup key (convergent encryption), so that identical chunks produce
+// identical pieces regardless of their file or position.
+func pieceKey(masterKey crypto.TwofishKey, dedupKeys []crypto.Hash, chunkIndex, pieceIndex uint64) crypto.TwofishKey {
+	if len(dedupKeys) != 0 {
+		return deriveKey(crypto.TwofishKey(dedupKeys[chunkIndex]), 0, pieceIndex)
+	}
+	return deriveKey(masterKey, chunkIndex, pieceIndex)
+}
+
+// dedupKey returns the key of a deduplicated chunk in the index of
+// deduplicated chunks. The pieces of a chunk depend on the erasure code and
+// the piece size as well as on its content, so chunks are only shared between
+// files that encode them the same way.
+func dedupKey(chunkHash crypto.Hash, ec modules.ErasureCoder, pieceSize uint64) crypto.Hash {
+	return crypto.HashAll(chunkHash, ec.Type(), ec.Params(), pieceSize)
+}
+
+// setChunkHashes sets the content hashes of the chunks of a deduplicated file,
+// and derives their dedup keys. The erasure code and the piece size of the
+// file must already be set.
+func (f *file) setChunkHashes(hashes []crypto.Hash) {
+	f.chunkHashes = hashes
+	f.dedupKeys = nil
+	for _, h := range hashes {
+		f.dedupKeys = append(f.dedupKeys, dedupKey(h, f.erasureCode, f.pieceSize))
+	}
+}
+
 // chunkSize returns the size of one chunk.
 func (f *file) chunkSize() uint64 {
 	return f.pieceSize * uint64(f.erasureCode.MinPieces())
@@ -68,6 +150,9 @@ func (f *file) chunkSize() uint64 {
 
 // numChunks returns the number of chunks that f was split into.
 func (f *file) numChunks() uint64 {
+	if f.compression != "" {
+		return uint64(len(f.chunkOffsets))
+	}
 	// empty files still need at least one chunk
 	if f.size == 0 {
 		return 1
@@ -80,29 +165,79 @@ func (f *file) numChunks() uint64 {
 	return n
 }
 
+// storedSize returns the number of bytes of f that are stored on the
+// network, excluding the padding of the last chunk. The stored size of a
+// compressed file covers all of its chunks.
+func (f *file) storedSize() uint64 {
+	if f.compression != "" {
+		return f.numChunks() * f.chunkSize()
+	}
+	return f.size
+}
+
 // available indicates whether the file is ready to be downloaded.
 func (f *file) available() bool {
-	chunkPieces := make([]int, f.numChunks())
+	// The health of a packed file is the health of its pack.
+	if f.pack != nil {
+		f.pack.mu.RLock()
+		defer f.pack.mu.RUnlock()
+		return f.pack.available()
+	}
+	for _, pieces := range f.chunkPieces() {
+		if effectivePieces(f.erasureCode, pieces) < f.erasureCode.MinPieces() {
+			return false
+		}
+	}
+	return true
+}
+
+// chunkPieces returns the number of copies of each piece of each chunk that
+// have been uploaded and have not been lost by their hosts.
+func (f *file) chunkPieces() []map[uint64]int {
+	chunkPieces := make([]map[uint64]int, f.numChunks())
+	for i := range chunkPieces {
+		chunkPieces[i] = make(map[uint64]int)
+	}
 	for _, fc := range f.contracts {
 		for _, p := range fc.Pieces {
-			chunkPieces[p.Chunk]++
+			if !p.Unavailable && p.Chunk < uint64(len(chunkPieces)) {
+				chunkPieces[p.Chunk][p.Piece]++
+			}
 		}
 	}
-	for _, n := range chunkPieces {
-		if n < f.erasureCode.MinPieces() {
-			return false
+	return chunkPieces
+}
+
+// numChunkPieces returns the number of pieces of a chunk that have been
+// uploaded and count towards the pieces needed to recover the chunk.
+func (f *file) numChunkPieces(chunkIndex uint64) int {
+	pieces := make(map[uint64]int)
+	for _, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			if p.Chunk == chunkIndex && !p.Unavailable {
+				pieces[p.Piece]++
+			}
 		}
 	}
-	return true
+	return effectivePieces(f.erasureCode, pieces)
 }
 
 // uploadProgress indicates what percentage of the file (plus redundancy) has
 // been uploaded. Note that a file may be Available long before UploadProgress
 // reaches 100%, and UploadProgress may report a value greater than 100%.
 func (f *file) uploadProgress() float64 {
+	if f.pack != nil {
+		f.pack.mu.RLock()
+		defer f.pack.mu.RUnlock()
+		return f.pack.uploadProgress()
+	}
 	var uploaded uint64
 	for _, fc := range f.contracts {
-		uploaded += uint64(len(fc.Pieces)) * f.pieceSize
+		for _, p := range fc.Pieces {
+			if !p.Unavailable {
+				uploaded += f.pieceSize
+			}
+		}
 	}
 	desired := f.pieceSize * uint64(f.erasureCode.NumPieces()) * f.numChunks()
 
@@ -116,22 +251,22 @@ func (f *file) redundancy() float64 {
 	if f.size == 0 {
 		return -1
 	}
-	piecesPerChunk := make([]int, f.numChunks())
+	if f.pack != nil {
+		f.pack.mu.RLock()
+		defer f.pack.mu.RUnlock()
+		return f.pack.redundancy()
+	}
+	chunkPieces := f.chunkPieces()
 	// If the file has non-0 size then the number of chunks should also be
 	// non-0. Therefore the f.size == 0 conditional block above must appear
 	// before this check.
-	if len(piecesPerChunk) == 0 {
+	if len(chunkPieces) == 0 {
 		build.Critical("cannot get redundancy of a file with 0 chunks")
 		return -1
 	}
-	for _, fc := range f.contracts {
-		for _, p := range fc.Pieces {
-			piecesPerChunk[p.Chunk]++
-		}
-	}
-	minPieces := piecesPerChunk[0]
-	for _, numPieces := range piecesPerChunk {
-		if numPieces < minPieces {
+	minPieces := effectivePieces(f.erasureCode, chunkPieces[0])
+	for _, pieces := range chunkPieces {
+		if numPieces := effectivePieces(f.erasureCode, pieces); numPieces < minPieces {
 			minPieces = numPieces
 		}
 	}
@@ -141,6 +276,11 @@ func (f *file) redundancy() float64 {
 // expiration returns the lowest height at which any of the file's contracts
 // will expire.
 func (f *file) expiration() types.BlockHeight {
+	if f.pack != nil {
+		f.pack.mu.RLock()
+		defer f.pack.mu.RUnlock()
+		return f.pack.expiration()
+	}
 	if len(f.contracts) == 0 {
 		return 0
 	}
@@ -167,29 +307,39 @@ func newFile(name string, code modules.ErasureCoder, pieceSize, fileSize uint64)
 }
 
 // DeleteFile removes a file entry from the renter and deletes its data from
-// the hosts it is stored on.
+// the hosts it is stored on. The data of a packed file is deleted once every
+// other file in its pack has been deleted as well. If the file has earlier
+// versions, it is kept as the latest version instead.
 //
 // TODO: The data is not cleared from any contracts where the host is not
 // immediately online.
 func (r *Renter) DeleteFile(nickname string) error {
 	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
 	f, exists := r.files[nickname]
 	if !exists {
-		r.mu.Unlock(lockID)
 		return ErrUnknownPath
 	}
-	delete(r.files, nickname)
-	os.RemoveAll(filepath.Join(r.persistDir, f.name+ShareExtension))
-	r.saveSync()
-	r.mu.Unlock(lockID)
-
-	// delete the file's associated contract data.
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	// TODO: delete the sectors of the file as well.
+	r.removeFile(nickname, f)
+	if err := r.saveSync(); err != nil {
+		return err
+	}
+	return r.saveArchive()
+}
 
-	return nil
+// fileInfo returns information on f. f.mu must be held.
+func fileInfo(f *file) modules.FileInfo {
+	return modules.FileInfo{
+		SiaPath:          f.name,
+		Filesize:         f.size,
+		Available:        f.available(),
+		Redundancy:       f.redundancy(),
+		Renewing:         f.renewing(),
+		UploadProgress:   f.uploadProgress(),
+		Expiration:       f.expiration(),
+		ExpirationHeight: f.expireHeight,
+		Metadata:         f.copyMetadata(),
+	}
 }
 
 // FileList returns all of the files that the renter has.
@@ -200,21 +350,116 @@ func (r *Renter) FileList() []modules.FileInfo {
 	files := make([]modules.FileInfo, 0, len(r.files))
 	for _, f := range r.files {
 		f.mu.RLock()
-		renewing := true
-		files = append(files, modules.FileInfo{
-			SiaPath:        f.name,
-			Filesize:       f.size,
-			Available:      f.available(),
-			Redundancy:     f.redundancy(),
-			Renewing:       renewing,
-			UploadProgress: f.uploadProgress(),
-			Expiration:     f.expiration(),
-		})
+		files = append(files, fileInfo(f))
 		f.mu.RUnlock()
 	}
 	return files
 }
 
+// File returns information on the file stored at siaPath.
+func (r *Renter) File(siaPath string) (modules.FileInfo, error) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	f, exists := r.files[siaPath]
+	if !exists {
+		return modules.FileInfo{}, ErrUnknownPath
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return fileInfo(f), nil
+}
+
+// FileHealth returns the locations of the pieces of each chunk of the file
+// stored at siaPath, along with the state of the contracts and hosts storing
+// them. The chunks of a packed file are the chunks of the pack storing it.
+func (r *Renter) FileHealth(siaPath string) ([]modules.ChunkHealth, error) {
+	lockID := r.mu.RLock()
+	f, exists := r.files[siaPath]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return nil, ErrUnknownPath
+	}
+	if f.pack != nil {
+		f = f.pack
+	}
+
+	// Copy the contracts of the file, including their pieces, so that the
+	// contractor is not queried while holding the lock of the file.
+	f.mu.RLock()
+	chunks := make([]modules.ChunkHealth, f.numChunks())
+	for i := range chunks {
+		chunks[i] = modules.ChunkHealth{
+			Index:     uint64(i),
+			MinPieces: f.erasureCode.MinPieces(),
+			NumPieces: f.erasureCode.NumPieces(),
+			Pieces:    []modules.PieceLocation{},
+		}
+	}
+	contracts := make([]fileContract, 0, len(f.contracts))
+	for _, fc := range f.contracts {
+		fc.Pieces = append([]pieceData(nil), fc.Pieces...)
+		contracts = append(contracts, fc)
+	}
+	f.mu.RUnlock()
+
+	// Add the location of each piece to its chunk, and count the distinct
+	// pieces of each chunk that are stored on hosts that are online.
+	height := r.cs.Height()
+	onlinePieces := make([]map[uint64]struct{}, len(chunks))
+	for i := range onlinePieces {
+		onlinePieces[i] = make(map[uint64]struct{})
+	}
+	for _, fc := range contracts {
+		offline := r.hostContractor.IsOffline(fc.ID)
+		replaced := r.hostContractor.ShouldReplace(fc.ID)
+		host, _ := r.hostDB.Host(fc.HostPublicKey)
+
+		// The pieces are carried over when the contract is renewed, so they
+		// are stored until the end of the latest contract with the host.
+		endHeight := fc.WindowStart
+		if contract, ok := r.hostContractor.Contract(fc.HostPublicKey); ok {
+			endHeight = contract.EndHeight()
+		}
+		var remaining types.BlockHeight
+		if endHeight > height {
+			remaining = endHeight - height
+		}
+		for _, p := range fc.Pieces {
+			if p.Chunk >= uint64(len(chunks)) {
+				continue
+			}
+			chunks[p.Chunk].Pieces = append(chunks[p.Chunk].Pieces, modules.PieceLocation{
+				Piece:           p.Piece,
+				ContractID:      fc.ID,
+				HostPublicKey:   fc.HostPublicKey,
+				NetAddress:      host.NetAddress,
+				Offline:         offline,
+				Replaced:        replaced,
+				Unavailable:     p.Unavailable,
+				EndHeight:       endHeight,
+				BlocksRemaining: remaining,
+			})
+			if !offline && !p.Unavailable {
+				onlinePieces[p.Chunk][p.Piece] = struct{}{}
+			}
+		}
+	}
+	for i := range chunks {
+		chunks[i].OnlinePieces = len(onlinePieces[i])
+		sort.Sort(pieceLocationsByPiece(chunks[i].Pieces))
+	}
+	return chunks, nil
+}
+
+// pieceLocationsByPiece implements sort.Interface for a slice of
+// PieceLocation, sorting by piece index.
+type pieceLocationsByPiece []modules.PieceLocation
+
+func (pl pieceLocationsByPiece) Len() int           { return len(pl) }
+func (pl pieceLocationsByPiece) Less(i, j int) bool { return pl[i].Piece < pl[j].Piece }
+func (pl pieceLocationsByPiece) Swap(i, j int)      { pl[i], pl[j] = pl[j], pl[i] }
+
 // RenameFile takes an existing file and changes the nickname. The original
 // file must exist, and there must not be any file that already has the
 // replacement nickname.
@@ -226,6 +471,9 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 	if newName == "" {
 		return ErrEmptyFilename
 	}
+	if err := validateNewSiaPath(newName); err != nil {
+		return err
+	}
 
 	// Check that currentName exists and newName doesn't.
 	file, exists := r.files[currentName]
@@ -233,32 +481,61 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 		return ErrUnknownPath
 	}
 	_, exists = r.files[newName]
-	if exists {
+	if exists || len(r.versions[newName]) != 0 {
 		return ErrPathOverload
 	}
+	if err := r.checkPathConflict(newName); err != nil {
+		return err
+	}
 
+	err := r.moveFile(file, newName)
+	if err != nil {
+		return err
+	}
+	r.moveVersions(currentName, newName)
+	err = r.saveSync()
+	if err != nil {
+		return err
+	}
+	err = r.saveArchive()
+	if err != nil {
+		return err
+	}
+
+	// Delete the old .sia file.
+	oldPath := filepath.Join(r.persistDir, currentName+ShareExtension)
+	return os.RemoveAll(oldPath)
+}
+
+// moveFile changes the nickname of a file, saving the file under its new
+// nickname and updating the file's entries in the renter. The caller is
+// responsible for calling saveSync and for removing the old .sia file.
+func (r *Renter) moveFile(file *file, newName string) error {
 	// Modify the file and save it to disk.
 	file.mu.Lock()
+	currentName := file.name
 	file.name = newName
 	err := r.saveFile(file)
+	if err != nil {
+		file.name = currentName
+	}
 	file.mu.Unlock()
 	if err != nil {
 		return err
 	}
 
-	// Update the entries in the renter.
-	delete(r.files, currentName)
-	r.files[newName] = file
+	r.renameFileEntry(currentName, newName)
+	return nil
+}
+
+// renameFileEntry moves the entries of the file at currentName in the renter
+// to newName.
+func (r *Renter) renameFileEntry(currentName, newName string) {
+	file := r.files[currentName]
+	r.removeFileEntry(currentName)
+	r.addFileEntry(newName, file)
 	if t, ok := r.tracking[currentName]; ok {
 		delete(r.tracking, currentName)
 		r.tracking[newName] = t
 	}
-	err = r.saveSync()
-	if err != nil {
-		return err
-	}
-
-	// Delete the old .sia file.
-	oldPath := filepath.Join(r.persistDir, currentName+ShareExtension)
-	return os.RemoveAll(oldPath)
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -198,9 +199,9 @@ func TestRenterDeleteFile(t *testing.T) {
 	}
 
 	// Put a file in the renter.
-	rt.renter.files["1"] = &file{
+	rt.renter.addFileEntry("1", &file{
 		name: "one",
-	}
+	})
 	// Delete a different file.
 	err = rt.renter.DeleteFile("one")
 	if err != ErrUnknownPath {
@@ -218,7 +219,7 @@ func TestRenterDeleteFile(t *testing.T) {
 	// Put a file in the renter, then rename it.
 	f := newTestingFile()
 	f.name = "1"
-	rt.renter.files[f.name] = f
+	rt.renter.addFileEntry(f.name, f)
 	rt.renter.RenameFile(f.name, "one")
 	// Call delete on the previous name.
 	err = rt.renter.DeleteFile("1")
@@ -265,11 +266,11 @@ func TestRenterFileList(t *testing.T) {
 
 	// Put a file in the renter.
 	rsc, _ := NewRSCode(1, 1)
-	rt.renter.files["1"] = &file{
+	rt.renter.addFileEntry("1", &file{
 		name:        "one",
 		erasureCode: rsc,
 		pieceSize:   1,
-	}
+	})
 	if len(rt.renter.FileList()) != 1 {
 		t.Error("FileList is not returning the only file in the renter")
 	}
@@ -278,11 +279,11 @@ func TestRenterFileList(t *testing.T) {
 	}
 
 	// Put multiple files in the renter.
-	rt.renter.files["2"] = &file{
+	rt.renter.addFileEntry("2", &file{
 		name:        "two",
 		erasureCode: rsc,
 		pieceSize:   1,
-	}
+	})
 	if len(rt.renter.FileList()) != 2 {
 		t.Error("FileList is not returning both files in the renter")
 	}
@@ -294,6 +295,86 @@ func TestRenterFileList(t *testing.T) {
 	}
 }
 
+// replacingContractor is a hostContractor whose host of one contract should
+// be replaced.
+type replacingContractor struct {
+	hostKeyContractor
+	replaced types.FileContractID
+}
+
+func (rc replacingContractor) ShouldReplace(id types.FileContractID) bool { return id == rc.replaced }
+
+// TestRenterFileHealth probes the FileHealth method of the renter.
+func TestRenterFileHealth(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	// The contract with the host "foo" has been renewed, so that it ends at
+	// height 1000. The host "bar" should be replaced.
+	hc := replacingContractor{hostKeyContractor{contracts: []modules.RenterContract{{
+		ID:            types.FileContractID{3},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("foo")},
+		LastRevision:  types.FileContractRevision{NewWindowStart: 1000},
+	}}}, types.FileContractID{2}}
+	rt, err := newContractorTester("TestRenterFileHealth", stubHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if _, err := rt.renter.FileHealth("foo"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Put a file of two chunks in the renter. The first chunk has a piece on
+	// two hosts, and the second chunk has no pieces.
+	rsc, _ := NewRSCode(1, 1)
+	f := newFile("foo", rsc, pieceSize, pieceSize*2)
+	height := rt.cs.Height()
+	f.contracts[types.FileContractID{1}] = fileContract{
+		ID:            types.FileContractID{1},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("foo")},
+		Pieces:        []pieceData{{Chunk: 0, Piece: 1}},
+		WindowStart:   height + 100,
+	}
+	f.contracts[types.FileContractID{2}] = fileContract{
+		ID:            types.FileContractID{2},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("bar")},
+		Pieces:        []pieceData{{Chunk: 0, Piece: 0}},
+		WindowStart:   height + 50,
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.addFileEntry(f.name, f)
+	rt.renter.mu.Unlock(id)
+
+	chunks, err := rt.renter.FileHealth("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Fatal("expected 2 chunks, got", len(chunks))
+	}
+	if chunks[0].OnlinePieces != 2 || chunks[0].MinPieces != 1 || chunks[0].NumPieces != 2 || len(chunks[0].Pieces) != 2 {
+		t.Fatal("first chunk has wrong health:", chunks[0])
+	}
+	p0, p1 := chunks[0].Pieces[0], chunks[0].Pieces[1]
+	if p0.Piece != 0 || string(p0.HostPublicKey.Key) != "bar" || p0.BlocksRemaining != 50 || p0.EndHeight != height+50 {
+		t.Error("first piece has wrong location:", p0)
+	}
+	if !p0.Replaced || p0.Offline {
+		t.Error("piece on a host that should be replaced is not reported as replaced:", p0)
+	}
+	if p1.Piece != 1 || p1.ContractID != (types.FileContractID{1}) || p1.BlocksRemaining != 1000-height || p1.EndHeight != 1000 {
+		t.Error("second piece has wrong location:", p1)
+	}
+	if p1.Replaced || p1.Offline {
+		t.Error("piece on an online host is reported as offline or replaced:", p1)
+	}
+	if chunks[1].Index != 1 || chunks[1].OnlinePieces != 0 || len(chunks[1].Pieces) != 0 {
+		t.Error("second chunk has wrong health:", chunks[1])
+	}
+}
+
 // TestRenterRenameFile probes the rename method of the renter.
 func TestRenterRenameFile(t *testing.T) {
 	rt, err := newRenterTester("TestRenterRenameFile")
@@ -311,7 +392,7 @@ func TestRenterRenameFile(t *testing.T) {
 	// Rename a file that does exist.
 	f := newTestingFile()
 	f.name = "1"
-	rt.renter.files["1"] = f
+	rt.renter.addFileEntry("1", f)
 	err = rt.renter.RenameFile("1", "1a")
 	if err != nil {
 		t.Fatal(err)
@@ -327,7 +408,7 @@ func TestRenterRenameFile(t *testing.T) {
 	// Rename a file to an existing name.
 	f2 := newTestingFile()
 	f2.name = "1"
-	rt.renter.files["1"] = f2
+	rt.renter.addFileEntry("1", f2)
 	err = rt.renter.RenameFile("1", "1a")
 	if err != ErrPathOverload {
 		t.Error("Expecting ErrPathOverload, got", err)
@@ -340,7 +421,7 @@ func TestRenterRenameFile(t *testing.T) {
 	}
 
 	// Renaming should also update the tracking set
-	rt.renter.tracking["1"] = trackedFile{"foo"}
+	rt.renter.tracking["1"] = trackedFile{RepairPath: "foo"}
 	err = rt.renter.RenameFile("1", "1b")
 	if err != nil {
 		t.Fatal(err)
@@ -20,6 +20,10 @@ type (
 		DialTimeout(modules.NetAddress, time.Duration) (net.Conn, error)
 	}
 
+	resolver interface {
+		LookupIP(string) ([]net.IP, error)
+	}
+
 	sleeper interface {
 		Sleep(time.Duration)
 	}
@@ -38,6 +42,11 @@ func (d stdDialer) DialTimeout(addr modules.NetAddress, timeout time.Duration) (
 	return net.DialTimeout("tcp", string(addr), timeout)
 }
 
+// stdResolver implements the resolver interface via net.LookupIP.
+type stdResolver struct{}
+
+func (r stdResolver) LookupIP(host string) ([]net.IP, error) { return net.LookupIP(host) }
+
 // stdSleeper implements the sleeper interface via time.Sleep.
 type stdSleeper struct{}
 
@@ -0,0 +1,159 @@
+package hostdb
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errUnknownFilterMode = errors.New("filter mode must be disabled, blacklist, or whitelist")
+)
+
+// A hostFilter is the parsed form of a modules.HostDBFilter, which decides
+// whether a host may be used by the renter.
+type hostFilter struct {
+	mode    string
+	keys    map[string]struct{}
+	addrs   map[modules.NetAddress]struct{}
+	subnets []*net.IPNet
+}
+
+// newHostFilter parses the hosts listed by a modules.HostDBFilter. Each host
+// is either a public key, an IP subnet in CIDR notation, or a NetAddress.
+func newHostFilter(f modules.HostDBFilter) (hostFilter, error) {
+	hf := hostFilter{
+		mode:  f.Mode,
+		keys:  make(map[string]struct{}),
+		addrs: make(map[modules.NetAddress]struct{}),
+	}
+	switch f.Mode {
+	case "":
+		hf.mode = modules.HostDBFilterDisabled
+	case modules.HostDBFilterDisabled, modules.HostDBFilterBlacklist, modules.HostDBFilterWhitelist:
+	default:
+		return hostFilter{}, errUnknownFilterMode
+	}
+
+	for _, host := range f.Hosts {
+		if _, subnet, err := net.ParseCIDR(host); err == nil {
+			hf.subnets = append(hf.subnets, subnet)
+		} else if strings.HasPrefix(host, "ed25519:") {
+			key, err := hex.DecodeString(strings.TrimPrefix(host, "ed25519:"))
+			if err != nil {
+				return hostFilter{}, errors.New("invalid public key " + host + ": " + err.Error())
+			} else if len(key) != crypto.PublicKeySize {
+				return hostFilter{}, errors.New("invalid public key " + host + ": wrong length")
+			}
+			// Keys are matched in the canonical form of SiaPublicKey.String.
+			spk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: key}
+			hf.keys[spk.String()] = struct{}{}
+		} else if err := modules.NetAddress(host).IsStdValid(); err == nil {
+			hf.addrs[modules.NetAddress(host)] = struct{}{}
+		} else {
+			return hostFilter{}, errors.New("host " + host + " is not a public key, subnet, or address")
+		}
+	}
+	return hf, nil
+}
+
+// matches reports whether a host is listed by the filter. A host whose
+// NetAddress is a hostname is matched by the subnets that the hostname
+// resolved to when the host was last scanned. Those are the /24 (IPv4) and /54
+// (IPv6) subnets that the hostdb groups hosts by, so a listed subnet matches a
+// host if it overlaps any of them.
+func (hf hostFilter) matches(entry modules.HostDBEntry) bool {
+	if _, ok := hf.keys[entry.PublicKey.String()]; ok {
+		return true
+	}
+	if _, ok := hf.addrs[entry.NetAddress]; ok {
+		return true
+	}
+	if len(hf.subnets) == 0 {
+		return false
+	}
+	if ip := net.ParseIP(entry.NetAddress.Host()); ip != nil {
+		for _, subnet := range hf.subnets {
+			if subnet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	for _, s := range entry.IPNets {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			continue
+		}
+		for _, subnet := range hf.subnets {
+			if subnet.Contains(ipnet.IP) || ipnet.Contains(subnet.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows reports whether the filter allows a host to be used.
+func (hf hostFilter) allows(entry modules.HostDBEntry) bool {
+	switch hf.mode {
+	case modules.HostDBFilterBlacklist:
+		return !hf.matches(entry)
+	case modules.HostDBFilterWhitelist:
+		return hf.matches(entry)
+	}
+	return true
+}
+
+// setFilter parses and applies a filter. hdb.mu must be held.
+func (hdb *HostDB) setFilter(f modules.HostDBFilter) error {
+	hf, err := newHostFilter(f)
+	if err != nil {
+		return err
+	}
+	f.Mode = hf.mode
+	hdb.filter = f
+	hdb.hostFilter = hf
+	hdb.hostTree.SetFilter(hf.allows)
+	return nil
+}
+
+// Filter returns the filter that restricts the hosts that can be selected
+// from the hostdb.
+func (hdb *HostDB) Filter() modules.HostDBFilter {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return modules.HostDBFilter{
+		Mode:  hdb.filter.Mode,
+		Hosts: append([]string(nil), hdb.filter.Hosts...),
+	}
+}
+
+// SetFilter sets the filter that restricts the hosts that can be selected from
+// the hostdb.
+func (hdb *HostDB) SetFilter(f modules.HostDBFilter) error {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	f.Hosts = append([]string(nil), f.Hosts...)
+	if err := hdb.setFilter(f); err != nil {
+		return err
+	}
+	return hdb.saveSync()
+}
+
+// IsFiltered reports whether the host with the given public key is excluded by
+// the filter of the hostdb.
+func (hdb *HostDB) IsFiltered(pk types.SiaPublicKey) bool {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	entry := modules.HostDBEntry{}
+	entry.PublicKey = pk
+	if host, exists := hdb.allHosts[pk.String()]; exists {
+		entry = host.HostDBEntry
+	}
+	return !hdb.hostFilter.allows(entry)
+}
@@ -0,0 +1,128 @@
+package hostdb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestHostFilter checks that the host filter is honored by RandomHosts and
+// IsFiltered, and that it is persisted.
+func TestHostFilter(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = new(memPersist)
+
+	var entries []modules.HostDBEntry
+	for i := 0; i < 4; i++ {
+		entry := makeHostDBEntry()
+		entry.NetAddress = fakeAddr(uint8(i))
+		entries = append(entries, entry)
+		hdb.allHosts[entry.PublicKey.String()] = &hostEntry{HostDBEntry: entry}
+		hdb.activeHosts[entry.PublicKey.String()] = &hostEntry{HostDBEntry: entry}
+		hdb.hostTree.Insert(entry)
+	}
+
+	// Invalid filters should be rejected.
+	for _, f := range []modules.HostDBFilter{
+		{Mode: "greylist"},
+		{Mode: modules.HostDBFilterBlacklist, Hosts: []string{"foo"}},
+		{Mode: modules.HostDBFilterBlacklist, Hosts: []string{"ed25519:xyz"}},
+		{Mode: modules.HostDBFilterBlacklist, Hosts: []string{"ed25519:0102"}},
+	} {
+		if err := hdb.SetFilter(f); err == nil {
+			t.Error("expected an error when setting filter", f)
+		}
+	}
+
+	// Blacklist one host by public key and another by address. Hex keys may be
+	// given in upper case.
+	err := hdb.SetFilter(modules.HostDBFilter{
+		Mode:  modules.HostDBFilterBlacklist,
+		Hosts: []string{"ed25519:" + strings.ToUpper(entries[0].PublicKey.String()[8:]), string(entries[1].NetAddress)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := hdb.RandomHosts(len(entries), nil)
+	if len(hosts) != 2 {
+		t.Fatal("wrong number of hosts returned with a blacklist:", len(hosts))
+	}
+	for _, host := range hosts {
+		if host.NetAddress == entries[0].NetAddress || host.NetAddress == entries[1].NetAddress {
+			t.Fatal("RandomHosts returned a blacklisted host")
+		}
+	}
+	if !hdb.IsFiltered(entries[0].PublicKey) || !hdb.IsFiltered(entries[1].PublicKey) || hdb.IsFiltered(entries[2].PublicKey) {
+		t.Error("IsFiltered does not match the blacklist")
+	}
+
+	// Whitelist a subnet that contains a single host.
+	err = hdb.SetFilter(modules.HostDBFilter{
+		Mode:  modules.HostDBFilterWhitelist,
+		Hosts: []string{"127.0.0.3/32"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts = hdb.RandomHosts(len(entries), nil)
+	if len(hosts) != 1 || hosts[0].NetAddress != entries[3].NetAddress {
+		t.Fatal("RandomHosts did not honor the whitelist:", hosts)
+	}
+
+	// The filter is persisted.
+	hdb.hostTree.SetFilter(nil)
+	if err := hdb.load(); err != nil {
+		t.Fatal(err)
+	}
+	if f := hdb.Filter(); f.Mode != modules.HostDBFilterWhitelist || len(f.Hosts) != 1 {
+		t.Fatal("filter was not persisted:", f)
+	}
+	if !hdb.IsFiltered(entries[0].PublicKey) || hdb.IsFiltered(entries[3].PublicKey) {
+		t.Error("IsFiltered does not match the loaded whitelist")
+	}
+
+	// Disabling the filter allows every host again.
+	err = hdb.SetFilter(modules.HostDBFilter{Mode: modules.HostDBFilterDisabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts = hdb.RandomHosts(len(entries), nil); len(hosts) != len(entries) {
+		t.Fatal("wrong number of hosts returned without a filter:", len(hosts))
+	}
+}
+
+// TestHostFilterResolved checks that subnets in the filter are matched against
+// the subnets that the hostname of a host resolved to.
+func TestHostFilterResolved(t *testing.T) {
+	entry := makeHostDBEntry()
+	entry.NetAddress = "foo.com:9982"
+	entry.IPNets = []string{"1.2.3.0/24", "2001:db8::/54"}
+
+	tests := []struct {
+		subnet  string
+		matches bool
+	}{
+		{"1.2.3.0/24", true},
+		{"1.2.0.0/16", true},
+		{"1.2.3.4/32", true},
+		{"1.2.4.0/24", false},
+		{"2001:db8::/32", true},
+		{"2001:db9::/32", false},
+	}
+	for _, test := range tests {
+		hf, err := newHostFilter(modules.HostDBFilter{
+			Mode:  modules.HostDBFilterBlacklist,
+			Hosts: []string{test.subnet},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hf.matches(entry) != test.matches {
+			t.Errorf("%v: expected match to be %v", test.subnet, test.matches)
+		}
+		if hf.allows(entry) == test.matches {
+			t.Errorf("%v: blacklist did not honor the match", test.subnet)
+		}
+	}
+}
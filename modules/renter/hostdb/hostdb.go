@@ -43,25 +43,26 @@ var (
 // for uploading files.
 type HostDB struct {
 	// dependencies
-	dialer  dialer
-	log     *persist.Logger
-	mu      sync.RWMutex
-	persist persister
-	sleeper sleeper
-	tg      siasync.ThreadGroup
+	dialer   dialer
+	log      *persist.Logger
+	mu       sync.RWMutex
+	persist  persister
+	resolver resolver
+	sleeper  sleeper
+	tg       siasync.ThreadGroup
 
 	// The hostTree is the root node of the tree that organizes hosts by
 	// weight. The tree is necessary for selecting weighted hosts at
-	// random. 'activeHosts' provides a lookup from hostname to the the
-	// corresponding node, as the hostTree is unsorted. A host is active if
-	// it is currently responding to queries about price and other
+	// random. 'activeHosts' provides a lookup from the public key of a host
+	// to the corresponding node, as the hostTree is unsorted. A host is
+	// active if it is currently responding to queries about price and other
 	// settings.
 	hostTree    *hosttree.HostTree
-	activeHosts map[modules.NetAddress]*hostEntry
+	activeHosts map[string]*hostEntry
 
-	// allHosts is a simple list of all known hosts by their network address,
+	// allHosts is a simple list of all known hosts by their public key,
 	// including hosts that are currently offline.
-	allHosts map[modules.NetAddress]*hostEntry
+	allHosts map[string]*hostEntry
 
 	// the scanPool is a set of hosts that need to be scanned. There are a
 	// handful of goroutines constantly waiting on the channel for hosts to
@@ -70,6 +71,15 @@ type HostDB struct {
 	scanPool chan *hostEntry
 	scanWait bool
 
+	// filter restricts the hosts that can be selected from the hostTree, and
+	// hostFilter is its parsed form.
+	filter     modules.HostDBFilter
+	hostFilter hostFilter
+
+	// scoreWeights are the weights of the factors that make up the score of
+	// each host, which is its weight in the hostTree.
+	scoreWeights modules.HostScoreWeights
+
 	blockHeight types.BlockHeight
 	lastChange  modules.ConsensusChangeID
 }
@@ -93,24 +103,26 @@ func New(cs consensusSet, persistDir string) (*HostDB, error) {
 	}
 
 	// Create HostDB using production dependencies.
-	return newHostDB(cs, stdDialer{}, stdSleeper{}, newPersist(persistDir), logger)
+	return newHostDB(cs, stdDialer{}, stdResolver{}, stdSleeper{}, newPersist(persistDir), logger)
 }
 
 // newHostDB creates a HostDB using the provided dependencies. It loads the old
 // persistence data, spawns the HostDB's scanning threads, and subscribes it to
 // the consensusSet.
-func newHostDB(cs consensusSet, d dialer, s sleeper, p persister, l *persist.Logger) (*HostDB, error) {
+func newHostDB(cs consensusSet, d dialer, r resolver, s sleeper, p persister, l *persist.Logger) (*HostDB, error) {
 	// Create the HostDB object.
 	hdb := &HostDB{
-		dialer:  d,
-		sleeper: s,
-		persist: p,
-		log:     l,
-
-		// TODO: should index by pubkey, not ip
-		activeHosts: make(map[modules.NetAddress]*hostEntry),
-		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		dialer:   d,
+		resolver: r,
+		sleeper:  s,
+		persist:  p,
+		log:      l,
+
+		activeHosts: make(map[string]*hostEntry),
+		allHosts:    make(map[string]*hostEntry),
 		scanPool:    make(chan *hostEntry, scanPoolSize),
+
+		scoreWeights: modules.DefaultHostScoreWeights,
 	}
 
 	hdb.hostTree = hosttree.New(hdb.calculateHostWeight)
@@ -125,8 +137,8 @@ func newHostDB(cs consensusSet, d dialer, s sleeper, p persister, l *persist.Log
 	if err == modules.ErrInvalidConsensusChangeID {
 		hdb.lastChange = modules.ConsensusChangeBeginning
 		// clear the host sets
-		hdb.activeHosts = make(map[modules.NetAddress]*hostEntry)
-		hdb.allHosts = make(map[modules.NetAddress]*hostEntry)
+		hdb.activeHosts = make(map[string]*hostEntry)
+		hdb.allHosts = make(map[string]*hostEntry)
 		// subscribe again using the new ID
 		err = cs.ConsensusSetSubscribe(hdb, hdb.lastChange)
 	}
@@ -149,21 +161,10 @@ func (hdb *HostDB) Close() error {
 }
 
 // RandomHosts implements the HostDB interface's RandomHosts() method. It takes
-// a number of hosts to return, and a slice of netaddresses to ignore, and
-// returns a slice of entries.
-func (hdb *HostDB) RandomHosts(n int, exclude []modules.NetAddress) []modules.HostDBEntry {
-	// The HostTree uses public keys: we have to convert the exclusion netaddress
-	// to keys using activeHosts first. This will go away once the HostDB is
-	// transitioned to using public keys.
-	var excludeKeys []types.SiaPublicKey
-	for _, addr := range exclude {
-		entry, exists := hdb.activeHosts[addr]
-		if exists {
-			excludeKeys = append(excludeKeys, entry.PublicKey)
-		}
-	}
-
-	hosts, err := hdb.hostTree.SelectRandom(n, excludeKeys)
+// a number of hosts to return, and a slice of public keys of hosts to ignore,
+// and returns a slice of entries.
+func (hdb *HostDB) RandomHosts(n int, exclude []types.SiaPublicKey) []modules.HostDBEntry {
+	hosts, err := hdb.hostTree.SelectRandom(n, exclude)
 	if err != nil {
 		hdb.log.Debugln("error selecting random hosts from the tree: ", err)
 	}
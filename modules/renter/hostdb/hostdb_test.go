@@ -9,17 +9,21 @@ import (
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb/hosttree"
 	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // bareHostDB returns a HostDB with its fields initialized, but without any
 // dependencies or scanning threads. It is only intended for use in unit tests.
 func bareHostDB() *HostDB {
 	hdb := &HostDB{
-		log: persist.NewLogger(ioutil.Discard),
+		log:      persist.NewLogger(ioutil.Discard),
+		resolver: stdResolver{},
 
-		activeHosts: make(map[modules.NetAddress]*hostEntry),
-		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		activeHosts: make(map[string]*hostEntry),
+		allHosts:    make(map[string]*hostEntry),
 		scanPool:    make(chan *hostEntry, scanPoolSize),
+
+		scoreWeights: modules.DefaultHostScoreWeights,
 	}
 	hdb.hostTree = hosttree.New(hdb.calculateHostWeight)
 	return hdb
@@ -70,7 +74,7 @@ func TestRandomHosts(t *testing.T) {
 		entry := makeHostDBEntry()
 		entry.NetAddress = fakeAddr(uint8(i))
 		entries = append(entries, entry)
-		hdb.activeHosts[entry.NetAddress] = &hostEntry{HostDBEntry: entry}
+		hdb.activeHosts[entry.PublicKey.String()] = &hostEntry{HostDBEntry: entry}
 		hdb.hostTree.Insert(entry)
 	}
 
@@ -92,12 +96,12 @@ func TestRandomHosts(t *testing.T) {
 		}
 	}
 
-	var exclusionAddresses []modules.NetAddress
+	var exclusionKeys []types.SiaPublicKey
 	for _, exclusionHost := range exclude {
-		exclusionAddresses = append(exclusionAddresses, exclusionHost.NetAddress)
+		exclusionKeys = append(exclusionKeys, exclusionHost.PublicKey)
 	}
 
-	hosts = hdb.RandomHosts(nentries, exclusionAddresses)
+	hosts = hdb.RandomHosts(nentries, exclusionKeys)
 	if len(hosts) != len(entries)/2 {
 		t.Fatalf("hosts had wrong length after passing exclusion slice. got %v wanted %v\n", len(hosts), len(entries)/2)
 	}
@@ -1,8 +1,6 @@
 package hostdb
 
 import (
-	"bytes"
-
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -17,7 +15,9 @@ type hostEntry struct {
 
 // insertHost adds a host entry to the state. The host will be inserted into
 // the set of all hosts, and if it is online and responding to requests it will
-// be put into the list of active hosts.
+// be put into the list of active hosts. Hosts are identified by their public
+// key, so a host that announces a new address keeps its history, and is
+// scanned at its new address.
 //
 // TODO: Function should return an error.
 func (hdb *HostDB) insertHost(host modules.HostDBEntry) {
@@ -26,9 +26,14 @@ func (hdb *HostDB) insertHost(host modules.HostDBEntry) {
 		hdb.log.Debugf("WARN: host '%v' has an invalid NetAddress: %v", host.NetAddress, err)
 		return
 	}
-	// Don't do anything if we've already seen this host and the public key is
-	// the same.
-	if knownHost, exists := hdb.allHosts[host.NetAddress]; exists && bytes.Equal(host.PublicKey.Key, knownHost.PublicKey.Key) {
+	// Don't do anything if we've already seen this host at the same address.
+	if knownHost, exists := hdb.allHosts[host.PublicKey.String()]; exists {
+		if knownHost.NetAddress == host.NetAddress {
+			return
+		}
+		hdb.log.Debugln("Host", host.PublicKey.String(), "moved from", knownHost.NetAddress, "to", host.NetAddress)
+		hdb.updateAddress(knownHost, host.NetAddress)
+		hdb.queueHostEntry(knownHost)
 		return
 	}
 
@@ -39,34 +44,46 @@ func (hdb *HostDB) insertHost(host modules.HostDBEntry) {
 		HostDBEntry: host,
 		Reliability: DefaultReliability,
 	}
-	hdb.allHosts[host.NetAddress] = h
+	hdb.allHosts[host.PublicKey.String()] = h
 
 	// Add the host to the scan queue. If the scan is successful, the host
 	// will be placed in activeHosts.
 	hdb.queueHostEntry(h)
 }
 
+// updateAddress changes the address of a known host. The subnets of the old
+// address no longer apply, so the host is removed from the set of active hosts
+// until it has been scanned at its new address.
+func (hdb *HostDB) updateAddress(entry *hostEntry, addr modules.NetAddress) {
+	entry.NetAddress = addr
+	entry.IPNets = nil
+	if _, exists := hdb.activeHosts[entry.PublicKey.String()]; exists {
+		hdb.hostTree.Remove(entry.PublicKey)
+		delete(hdb.activeHosts, entry.PublicKey.String())
+	}
+}
+
 // Remove deletes an entry from the hostdb.
-func (hdb *HostDB) removeHost(addr modules.NetAddress) error {
+func (hdb *HostDB) removeHost(pk types.SiaPublicKey) error {
 	// See if the node is in the set of active hosts.
-	entry, exists := hdb.activeHosts[addr]
+	entry, exists := hdb.activeHosts[pk.String()]
 	if exists {
 		hdb.hostTree.Remove(entry.HostDBEntry.PublicKey)
-		delete(hdb.activeHosts, addr)
+		delete(hdb.activeHosts, pk.String())
 	}
 
 	// Remove the node from all hosts.
-	delete(hdb.allHosts, addr)
+	delete(hdb.allHosts, pk.String())
 
 	return nil
 }
 
-// Host returns the HostSettings associated with the specified NetAddress. If
+// Host returns the HostSettings associated with the specified public key. If
 // no matching host is found, Host returns false.
-func (hdb *HostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool) {
-	hdb.mu.Lock()
-	defer hdb.mu.Unlock()
-	entry, ok := hdb.allHosts[addr]
+func (hdb *HostDB) Host(pk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	entry, ok := hdb.allHosts[pk.String()]
 	if !ok || entry == nil {
 		return modules.HostDBEntry{}, false
 	}
@@ -76,16 +93,7 @@ func (hdb *HostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool) {
 // ActiveHosts returns the hosts that can be randomly selected out of the
 // hostdb, sorted by preference.
 func (hdb *HostDB) ActiveHosts() (activeHosts []modules.HostDBEntry) {
-	hdb.mu.RLock()
-	numHosts := len(hdb.activeHosts)
-	hdb.mu.RUnlock()
-
-	// Get the hosts using RandomHosts so that they are in sorted order.
-	sortedHosts, err := hdb.hostTree.SelectRandom(numHosts, nil)
-	if err != nil {
-		hdb.log.Severe("error selecting random hosts in ActiveHosts() call: ", err)
-	}
-	return sortedHosts
+	return hdb.hostTree.All()
 }
 
 // AllHosts returns all of the hosts known to the hostdb, including the
@@ -68,6 +68,61 @@ func TestInsertHost(t *testing.T) {
 	}
 }
 
+// TestInsertHostNewAddress checks that a host that announces a new address
+// keeps its entry in the hostdb, is removed from the set of active hosts, and
+// is scanned at the new address.
+func TestInsertHostNewAddress(t *testing.T) {
+	hdb := bareHostDB()
+
+	dbe := makeHostDBEntry()
+	dbe.NetAddress = "foo.com:1234"
+	hdb.mu.Lock()
+	hdb.insertHost(dbe)
+	hdb.mu.Unlock()
+	<-hdb.scanPool
+	entry := hdb.allHosts[dbe.PublicKey.String()]
+	entry.ScanHistory = modules.HostDBScans{{Success: true}}
+	entry.IPNets = []string{"1.2.3.0/24"}
+	if err := hdb.hostTree.Insert(entry.HostDBEntry); err != nil {
+		t.Fatal(err)
+	}
+	hdb.activeHosts[dbe.PublicKey.String()] = entry
+
+	// re-announce the host at a new address
+	dbe.NetAddress = "bar.com:1234"
+	hdb.mu.Lock()
+	hdb.insertHost(dbe)
+	hdb.mu.Unlock()
+	select {
+	case entry := <-hdb.scanPool:
+		if entry.NetAddress != dbe.NetAddress {
+			t.Error("host was not scanned at its new address:", entry.NetAddress)
+		}
+	case <-time.After(time.Second):
+		t.Error("moved host was not scanned")
+	}
+
+	if len(hdb.allHosts) != 1 {
+		t.Fatal("moved host was added as a new host:", hdb.allHosts)
+	}
+	host, ok := hdb.Host(dbe.PublicKey)
+	if !ok {
+		t.Fatal("moved host is not in the hostdb")
+	} else if host.NetAddress != dbe.NetAddress {
+		t.Error("address of moved host was not updated:", host.NetAddress)
+	} else if len(host.ScanHistory) != 1 {
+		t.Error("history of moved host was not kept:", host.ScanHistory)
+	} else if host.IPNets != nil {
+		t.Error("subnets of the old address were kept:", host.IPNets)
+	}
+	if _, exists := hdb.activeHosts[dbe.PublicKey.String()]; exists {
+		t.Error("moved host is still active before it was scanned")
+	}
+	if err := hdb.hostTree.Remove(dbe.PublicKey); err == nil {
+		t.Error("moved host is still in the host tree before it was scanned")
+	}
+}
+
 // TestActiveHosts tests the ActiveHosts method.
 func TestActiveHosts(t *testing.T) {
 	hdb := bareHostDB()
@@ -81,7 +136,7 @@ func TestActiveHosts(t *testing.T) {
 	h1 := makeHostDBEntry()
 	h1.AcceptingContracts = true
 	hdb.hostTree.Insert(h1)
-	hdb.activeHosts[h1.NetAddress] = &hostEntry{HostDBEntry: h1}
+	hdb.activeHosts[h1.PublicKey.String()] = &hostEntry{HostDBEntry: h1}
 	if hosts := hdb.ActiveHosts(); len(hosts) != 1 {
 		t.Errorf("wrong number of hosts: expected %v, got %v", 1, len(hosts))
 	} else if hosts[0].NetAddress != h1.NetAddress {
@@ -93,7 +148,7 @@ func TestActiveHosts(t *testing.T) {
 	h2.NetAddress = "bar"
 	h2.AcceptingContracts = true
 	hdb.hostTree.Insert(h2)
-	hdb.activeHosts[h2.NetAddress] = &hostEntry{HostDBEntry: h2}
+	hdb.activeHosts[h2.PublicKey.String()] = &hostEntry{HostDBEntry: h2}
 	if hosts := hdb.ActiveHosts(); len(hosts) != 2 {
 		t.Errorf("wrong number of hosts: expected %v, got %v", 2, len(hosts))
 	} else if hosts[0].NetAddress != h1.NetAddress && hosts[1].NetAddress != h1.NetAddress {
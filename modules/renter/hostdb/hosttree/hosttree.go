@@ -3,6 +3,7 @@ package hosttree
 import (
 	"crypto/rand"
 	"errors"
+	"sort"
 	"sync"
 
 	"github.com/NebulousLabs/Sia/modules"
@@ -36,6 +37,10 @@ type (
 	// WeightFunc is a function used to weight a given HostDBEntry in the tree.
 	WeightFunc func(modules.HostDBEntry) types.Currency
 
+	// FilterFunc is a function that reports whether a given HostDBEntry may be
+	// selected from the tree.
+	FilterFunc func(modules.HostDBEntry) bool
+
 	// HostTree is used to store and select host database entries. Each HostTree
 	// is initialized with a weighting func that is able to assign a weight to
 	// each entry. The entries can then be selected at random, weighted by the
@@ -49,6 +54,10 @@ type (
 		// weightFn calculates the weight of a hostEntry
 		weightFn WeightFunc
 
+		// filterFn reports whether a hostEntry may be selected. Every host
+		// may be selected if filterFn is nil.
+		filterFn FilterFunc
+
 		mu sync.Mutex
 	}
 
@@ -58,6 +67,9 @@ type (
 		weight types.Currency
 	}
 
+	// byWeight sorts host entries by weight, heaviest first.
+	byWeight []*hostEntry
+
 	// node is a node in the tree.
 	node struct {
 		parent *node
@@ -72,6 +84,10 @@ type (
 	}
 )
 
+func (bw byWeight) Len() int           { return len(bw) }
+func (bw byWeight) Less(i, j int) bool { return bw[i].weight.Cmp(bw[j].weight) > 0 }
+func (bw byWeight) Swap(i, j int)      { bw[i], bw[j] = bw[j], bw[i] }
+
 // createNode creates a new node using the provided `parent` and `entry`.
 func createNode(parent *node, entry *hostEntry) *node {
 	return &node{
@@ -241,16 +257,80 @@ func (ht *HostTree) Modify(hdbe modules.HostDBEntry) error {
 	return nil
 }
 
+// SetWeightFunc sets the function used to weight the hosts in the tree, and
+// reweights every host that is already in the tree.
+func (ht *HostTree) SetWeightFunc(wf WeightFunc) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	ht.weightFn = wf
+	var entries []*hostEntry
+	for _, node := range ht.hosts {
+		node.remove()
+		entries = append(entries, node.entry)
+	}
+	for _, entry := range entries {
+		entry = &hostEntry{
+			HostDBEntry: entry.HostDBEntry,
+			weight:      ht.weightFn(entry.HostDBEntry),
+		}
+		_, node := ht.root.recursiveInsert(entry)
+		ht.hosts[string(entry.PublicKey.Key)] = node
+	}
+}
+
+// SetFilter sets the function that reports whether a host may be selected by
+// SelectRandom. A nil FilterFunc allows every host to be selected.
+func (ht *HostTree) SetFilter(ff FilterFunc) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+	ht.filterFn = ff
+}
+
+// selectable reports whether an entry may be returned by SelectRandom or All.
+// Hosts that are not accepting contracts or that are rejected by the filter of
+// the tree are never returned.
+func (ht *HostTree) selectable(entry *hostEntry) bool {
+	return entry.AcceptingContracts && (ht.filterFn == nil || ht.filterFn(entry.HostDBEntry))
+}
+
+// All returns every host in the tree that may be selected, sorted by weight
+// from heaviest to lightest. Unlike SelectRandom, All returns hosts that share
+// a subnet.
+func (ht *HostTree) All() []modules.HostDBEntry {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	var entries []*hostEntry
+	for _, node := range ht.hosts {
+		if ht.selectable(node.entry) {
+			entries = append(entries, node.entry)
+		}
+	}
+	sort.Sort(byWeight(entries))
+
+	hosts := make([]modules.HostDBEntry, len(entries))
+	for i, entry := range entries {
+		hosts[i] = entry.HostDBEntry
+	}
+	return hosts
+}
+
 // SelectRandom grabs a random n hosts from the tree. There will be no repeats, but
 // the length of the slice returned may be less than n, and may even be zero.
 // The hosts that are returned first have the higher priority. Hosts passed to
 // 'ignore' will not be considered; pass `nil` if no blacklist is desired.
+// Hosts that are not accepting contracts or that are rejected by the filter of
+// the tree are never returned. To keep a single operator from holding several
+// pieces of the same chunk, no host is returned that shares a subnet with
+// another returned host or with a host passed to 'ignore'.
 func (ht *HostTree) SelectRandom(n int, ignore []types.SiaPublicKey) ([]modules.HostDBEntry, error) {
 	ht.mu.Lock()
 	defer ht.mu.Unlock()
 
 	var hosts []modules.HostDBEntry
 	var removedEntries []*hostEntry
+	usedNets := make(map[string]struct{})
 
 	for _, pubkey := range ignore {
 		node, exists := ht.hosts[string(pubkey.Key)]
@@ -260,6 +340,9 @@ func (ht *HostTree) SelectRandom(n int, ignore []types.SiaPublicKey) ([]modules.
 		node.remove()
 		delete(ht.hosts, string(pubkey.Key))
 		removedEntries = append(removedEntries, node.entry)
+		for _, ipnet := range node.entry.IPNets {
+			usedNets[ipnet] = struct{}{}
+		}
 	}
 
 	for len(hosts) < n && len(ht.hosts) > 0 {
@@ -272,8 +355,11 @@ func (ht *HostTree) SelectRandom(n int, ignore []types.SiaPublicKey) ([]modules.
 			return hosts, err
 		}
 
-		if node.entry.HostDBEntry.AcceptingContracts {
+		if ht.selectable(node.entry) && !node.entry.SharesIPNet(usedNets) {
 			hosts = append(hosts, node.entry.HostDBEntry)
+			for _, ipnet := range node.entry.IPNets {
+				usedNets[ipnet] = struct{}{}
+			}
 		}
 
 		removedEntries = append(removedEntries, node.entry)
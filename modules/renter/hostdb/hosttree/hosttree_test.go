@@ -562,3 +562,101 @@ func TestRandomHosts(t *testing.T) {
 		t.Error("doubled up")
 	}
 }
+
+// TestSelectRandomFilter checks that SelectRandom only returns hosts that are
+// allowed by the filter of the tree.
+func TestSelectRandomFilter(t *testing.T) {
+	tree := New(func(modules.HostDBEntry) types.Currency { return types.NewCurrency64(1) })
+	var entries []modules.HostDBEntry
+	for i := 0; i < 5; i++ {
+		entry := makeHostDBEntry()
+		entries = append(entries, entry)
+		if err := tree.Insert(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	excluded := entries[0].PublicKey.String()
+	tree.SetFilter(func(entry modules.HostDBEntry) bool {
+		return entry.PublicKey.String() != excluded
+	})
+	hosts, err := tree.SelectRandom(len(entries), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != len(entries)-1 {
+		t.Fatal("wrong number of hosts selected:", len(hosts))
+	}
+	for _, host := range hosts {
+		if host.PublicKey.String() == excluded {
+			t.Fatal("filtered host was selected")
+		}
+	}
+
+	// The filtered host remains in the tree.
+	tree.SetFilter(nil)
+	if hosts, _ = tree.SelectRandom(len(entries), nil); len(hosts) != len(entries) {
+		t.Fatal("filtered host was removed from the tree")
+	}
+}
+
+// TestSelectRandomIPNets checks that SelectRandom does not return more than
+// one host per subnet, and that All returns every host.
+func TestSelectRandomIPNets(t *testing.T) {
+	tree := New(func(entry modules.HostDBEntry) types.Currency {
+		return types.NewCurrency64(uint64(len(entry.IPNets)))
+	})
+	ipnets := [][]string{
+		{"1.2.3.0/24"},
+		{"1.2.3.0/24"},
+		{"1.2.4.0/24", "2001:db8::/54"},
+		{"2001:db8::/54"},
+		{"5.6.7.0/24"},
+	}
+	var entries []modules.HostDBEntry
+	for _, nets := range ipnets {
+		entry := makeHostDBEntry()
+		entry.IPNets = nets
+		entries = append(entries, entry)
+		if err := tree.Insert(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		hosts, err := tree.SelectRandom(len(entries), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hosts) != 3 {
+			t.Fatal("wrong number of hosts selected:", len(hosts))
+		}
+		seen := make(map[string]struct{})
+		for _, host := range hosts {
+			for _, ipnet := range host.IPNets {
+				if _, exists := seen[ipnet]; exists {
+					t.Fatal("two hosts were selected from", ipnet)
+				}
+				seen[ipnet] = struct{}{}
+			}
+		}
+	}
+
+	// Hosts that share a subnet with an ignored host are not selected.
+	hosts, err := tree.SelectRandom(len(entries), []types.SiaPublicKey{entries[0].PublicKey, entries[2].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].PublicKey.String() != entries[4].PublicKey.String() {
+		t.Fatal("wrong hosts selected:", hosts)
+	}
+
+	// All returns every host, heaviest first.
+	hosts = tree.All()
+	if len(hosts) != len(entries) {
+		t.Fatal("wrong number of hosts returned:", len(hosts))
+	}
+	if hosts[0].PublicKey.String() != entries[2].PublicKey.String() {
+		t.Fatal("hosts were not sorted by weight")
+	}
+}
@@ -1,6 +1,8 @@
 package hostdb
 
 import (
+	"errors"
+	"math"
 	"math/big"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -9,6 +11,8 @@ import (
 )
 
 var (
+	errInvalidScoreWeight = errors.New("score weights must be non-negative numbers")
+
 	// Because most weights would otherwise be fractional, we set the base
 	// weight to 10^150 to give ourselves lots of precision when determing the
 	// weight of a host
@@ -30,9 +34,51 @@ var (
 	}()
 )
 
+const (
+	// collateralPriceRatio is the ratio of collateral to storage price above
+	// which hosts are not rewarded for putting up more collateral.
+	collateralPriceRatio = 2
+
+	// minCollateralAdjustment is the adjustment of hosts that do not put up
+	// collateral.
+	minCollateralAdjustment = 0.01
+
+	// minUptimeAdjustment is the adjustment of hosts that were offline during
+	// every scan.
+	minUptimeAdjustment = 0.001
+)
+
 // calculateHostWeight returns the weight of a host according to the settings of
-// the host database entry. Currently, only the price is considered.
+// the host database entry, which is the score of the host.
 func (hdb *HostDB) calculateHostWeight(entry modules.HostDBEntry) types.Currency {
+	return hdb.scoreBreakdown(entry).Score
+}
+
+// scoreBreakdown returns the score of a host and the contribution of each
+// factor to it. hdb.mu must be held.
+func (hdb *HostDB) scoreBreakdown(entry modules.HostDBEntry) modules.HostScoreBreakdown {
+	w := hdb.scoreWeights
+	sb := modules.HostScoreBreakdown{
+		PriceScore:                 priceScore(entry, w.Price),
+		StorageRemainingAdjustment: math.Pow(storageRemainingAdjustment(entry), w.Storage),
+		UptimeAdjustment:           math.Pow(uptimeAdjustment(entry), w.Uptime),
+		AgeAdjustment:              math.Pow(hdb.ageAdjustment(entry), w.Age),
+		CollateralAdjustment:       math.Pow(collateralAdjustment(entry), w.Collateral),
+		VersionAdjustment:          math.Pow(versionAdjustment(entry), w.Version),
+	}
+	sb.Score = sb.PriceScore.MulFloat(sb.StorageRemainingAdjustment * sb.UptimeAdjustment *
+		sb.AgeAdjustment * sb.CollateralAdjustment * sb.VersionAdjustment)
+
+	// The host tree cannot select hosts with a weight of zero.
+	if sb.Score.IsZero() {
+		sb.Score = types.NewCurrency64(1)
+	}
+	return sb
+}
+
+// priceScore returns the base weight divided by the total price of a host
+// raised to the given exponent.
+func priceScore(entry modules.HostDBEntry, exponent float64) types.Currency {
 	// Prices tiered as follows:
 	//    - the storage price is presented as 'per block per byte'
 	//    - the contract price is presented as a flat rate
@@ -53,92 +99,178 @@ func (hdb *HostDB) calculateHostWeight(entry modules.HostDBEntry) types.Currency
 	siafundFee := adjustedContractPrice.Add(adjustedUploadPrice).Add(adjustedDownloadPrice).Add(entry.Collateral).MulTax()
 	totalPrice := entry.StoragePrice.Add(adjustedContractPrice).Add(adjustedUploadPrice).Add(adjustedDownloadPrice).Add(siafundFee)
 
-	// Set the weight to the base weight, and then divide it by the price
-	// raised to the fifth power. This means that a host which has half the
-	// total price will be 32x as likely to be selected. A host with a quarter
-	// the total price will be 1024x as likely to be selected, and so on.
-	weight := baseWeight
-	if !totalPrice.IsZero() {
-		// To avoid a divide-by-zero error, this operation is only performed on
-		// non-zero prices.
-		weight = baseWeight.Div(totalPrice).Div(totalPrice).Div(totalPrice).Div(totalPrice).Div(totalPrice)
+	// Divide the base weight by the price raised to the exponent. With the
+	// default exponent of 5, a host which has half the total price will be
+	// 32x as likely to be selected. A host with a quarter the total price
+	// will be 1024x as likely to be selected, and so on. To avoid a
+	// divide-by-zero error, this operation is only performed on non-zero
+	// prices.
+	score := baseWeight
+	if totalPrice.IsZero() {
+		return score
+	}
+	whole, frac := math.Modf(exponent)
+	for i := 0; i < int(whole); i++ {
+		score = score.Div(totalPrice)
 	}
+	if frac > 0 {
+		price, _ := new(big.Rat).SetInt(totalPrice.Big()).Float64()
+		score = score.MulFloat(math.Pow(price, -frac))
+	}
+	return score
+}
 
-	// Enact penalties if the host does not have very much storage remaining.
+// storageRemainingAdjustment penalizes hosts that do not have very much
+// storage remaining.
+func storageRemainingAdjustment(entry modules.HostDBEntry) float64 {
+	adjustment := 1.0
 	if entry.RemainingStorage < 200*requiredStorage {
-		weight = weight.Div64(2) // 2x total penalty
+		adjustment /= 2 // 2x total penalty
 	}
 	if entry.RemainingStorage < 100*requiredStorage {
-		weight = weight.Div64(3) // 6x total penalty
+		adjustment /= 3 // 6x total penalty
 	}
 	if entry.RemainingStorage < 50*requiredStorage {
-		weight = weight.Div64(4) // 24x total penalty
+		adjustment /= 4 // 24x total penalty
 	}
 	if entry.RemainingStorage < 25*requiredStorage {
-		weight = weight.Div64(5) // 95x total penalty
+		adjustment /= 5 // 120x total penalty
 	}
 	if entry.RemainingStorage < 10*requiredStorage {
-		weight = weight.Div64(6) // 570x total penalty
+		adjustment /= 6 // 720x total penalty
 	}
 	if entry.RemainingStorage < 5*requiredStorage {
-		weight = weight.Div64(10) // 5,700x total penalty
+		adjustment /= 10 // 7,200x total penalty
 	}
 	if entry.RemainingStorage < requiredStorage {
-		weight = weight.Div64(100) // 570,000x total penalty
+		adjustment /= 100 // 720,000x total penalty
+	}
+	return adjustment
+}
+
+// uptimeAdjustment penalizes hosts that were offline during their scans. The
+// adjustment is the fraction of scans that succeeded. Hosts that have not been
+// scanned yet are not penalized.
+func uptimeAdjustment(entry modules.HostDBEntry) float64 {
+	if len(entry.ScanHistory) == 0 {
+		return 1
+	}
+	var successes int
+	for _, scan := range entry.ScanHistory {
+		if scan.Success {
+			successes++
+		}
+	}
+	if successes == 0 {
+		return minUptimeAdjustment
+	}
+	return float64(successes) / float64(len(entry.ScanHistory))
+}
+
+// ageAdjustment penalizes newer hosts, as it's less certain that they will
+// have reliable uptime. hdb.mu must be held.
+func (hdb *HostDB) ageAdjustment(entry modules.HostDBEntry) float64 {
+	if hdb.blockHeight < entry.FirstSeen {
+		// Shouldn't happen, but the usecase is covered anyway. Because
+		// something weird is happening, don't trust this host very much.
+		return 1.0 / 1000
+	}
+	age := hdb.blockHeight - entry.FirstSeen
+	adjustment := 1.0
+	if age < 6000 {
+		adjustment /= 2 // 2x total
+	}
+	if age < 4000 {
+		adjustment /= 2 // 4x total
 	}
+	if age < 2000 {
+		adjustment /= 4 // 16x total
+	}
+	if age < 1000 {
+		adjustment /= 4 // 64x total
+	}
+	if age < 288 {
+		adjustment /= 10 // 640x total
+	}
+	return adjustment
+}
 
-	// Enact penalities for hosts running older versions.
+// collateralAdjustment rewards hosts for the collateral they put up relative
+// to their storage price. Raising the collateral inherently raises the price
+// for renters, which is already accounted for by the price score, so hosts
+// are not rewarded for collateral beyond collateralPriceRatio times their
+// storage price.
+func collateralAdjustment(entry modules.HostDBEntry) float64 {
+	if entry.Collateral.IsZero() {
+		return minCollateralAdjustment
+	}
+	if entry.StoragePrice.IsZero() {
+		return 1
+	}
+	ratio, _ := new(big.Rat).SetFrac(entry.Collateral.Big(), entry.StoragePrice.Big()).Float64()
+	adjustment := ratio / collateralPriceRatio
+	if adjustment > 1 {
+		return 1
+	} else if adjustment < minCollateralAdjustment {
+		return minCollateralAdjustment
+	}
+	return adjustment
+}
+
+// versionAdjustment penalizes hosts running older versions.
+func versionAdjustment(entry modules.HostDBEntry) float64 {
+	adjustment := 1.0
 	if build.VersionCmp(entry.Version, "1.0.3") < 0 {
-		weight = weight.Div64(5) // 5x total penalty.
+		adjustment /= 5 // 5x total penalty.
 	}
 	if build.VersionCmp(entry.Version, "1.0.0") < 0 {
-		weight = weight.Div64(10) // 50x total penalty.
+		adjustment /= 10 // 50x total penalty.
 	}
+	return adjustment
+}
 
-	// Enact penalities for newer hosts, as it's less certain that they will
-	// have reliable uptime.
-	if hdb.blockHeight >= entry.FirstSeen {
-		age := hdb.blockHeight - entry.FirstSeen
-		if age < 6000 {
-			weight = weight.Div64(2) // 2x total
-		}
-		if age < 4000 {
-			weight = weight.Div64(2) // 4x total
-		}
-		if age < 2000 {
-			weight = weight.Div64(4) // 16x total
-		}
-		if age < 1000 {
-			weight = weight.Div64(4) // 64x total
-		}
-		if age < 288 {
-			weight = weight.Div64(10) // 640x total
+// ScoreBreakdown returns the score of a host and the contribution of each
+// factor to it.
+func (hdb *HostDB) ScoreBreakdown(entry modules.HostDBEntry) modules.HostScoreBreakdown {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return hdb.scoreBreakdown(entry)
+}
+
+// ScoreWeights returns the weights of the factors that make up the score of a
+// host.
+func (hdb *HostDB) ScoreWeights() modules.HostScoreWeights {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return hdb.scoreWeights
+}
+
+// setScoreWeights sets the weights of the factors that make up the score of a
+// host, and reweights the active hosts. hdb.mu must be held.
+func (hdb *HostDB) setScoreWeights(w modules.HostScoreWeights) error {
+	for _, weight := range []float64{w.Price, w.Storage, w.Uptime, w.Age, w.Collateral, w.Version} {
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return errInvalidScoreWeight
 		}
-	} else {
-		// Shouldn't happen, but the usecase is covered anyway.
-		weight = weight.Div64(1000) // Because something weird is happening, don't trust this host very much.
-	}
-
-	// Account for collateral. Collateral has a somewhat complicated
-	// relationship with price, because raising the collateral inherently
-	// raises the price for renters. If the host's score increases linearly to
-	// the amount of collateral they put up, then the host will gain score from
-	// increasing collateral until the siafund fee makes up about 15% of the
-	// total price. After that, the host will actually lose points for having
-	// too much collateral.
-	//
-	// The renter has control over how much collateral the host uses.
-	// Currently, this control is not implemented, so the hosts are penalized
-	// for setting very high collateral values. Once the renter is clamping the
-	// amount being spent on collateral, the hostdb can also clamp the amount
-	// of collateral being taken into account by the host, to optimize the
-	// host's score for the renter's needs.
-	if entry.Collateral.IsZero() {
-		// Instead of zeroing out the weight, just return the weight as though
-		// the collateral is 1 hasting. Competitively speaking, this is
-		// effectively zero.
-		return weight
 	}
-	weight = weight.Mul(entry.Collateral)
-	return weight
+	if w == (modules.HostScoreWeights{}) {
+		w = modules.DefaultHostScoreWeights
+	}
+	hdb.scoreWeights = w
+	hdb.hostTree.SetWeightFunc(hdb.calculateHostWeight)
+	return nil
+}
+
+// SetScoreWeights sets the weights of the factors that make up the score of a
+// host. If every weight is zero, the default weights are used.
+func (hdb *HostDB) SetScoreWeights(w modules.HostScoreWeights) error {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if w == hdb.scoreWeights {
+		return nil
+	}
+	if err := hdb.setScoreWeights(w); err != nil {
+		return err
+	}
+	return hdb.saveSync()
 }
@@ -1,8 +1,10 @@
 package hostdb
 
 import (
+	"math"
 	"testing"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -50,3 +52,92 @@ func TestHostWeightWithBothPricesZero(t *testing.T) {
 		t.Error("Weight of two zero-priced hosts should be equal.")
 	}
 }
+
+// TestHostScoreBreakdown checks that the score of a host is the product of
+// the contributions of its factors, and that the weights of the factors are
+// applied.
+func TestHostScoreBreakdown(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	hdb.blockHeight = 10000
+	var entry modules.HostDBEntry
+	entry.RemainingStorage = 250e3
+	entry.StoragePrice = types.NewCurrency64(100)
+	entry.Collateral = types.NewCurrency64(100)
+	entry.Version = "1.1.0"
+	entry.ScanHistory = modules.HostDBScans{{Success: true}, {Success: false}, {Success: true}, {Success: true}}
+
+	sb := hdb.ScoreBreakdown(entry)
+	if sb.StorageRemainingAdjustment != 1 || sb.AgeAdjustment != 1 || sb.VersionAdjustment != 1 {
+		t.Error("host was penalized for its storage, age, or version:", sb)
+	}
+	if sb.UptimeAdjustment != math.Pow(0.75, modules.DefaultHostScoreWeights.Uptime) {
+		t.Error("wrong uptime adjustment:", sb.UptimeAdjustment)
+	}
+	if sb.CollateralAdjustment != 0.5 {
+		t.Error("wrong collateral adjustment:", sb.CollateralAdjustment)
+	}
+	if sb.Score.Cmp(sb.PriceScore.MulFloat(sb.UptimeAdjustment*sb.CollateralAdjustment)) != 0 {
+		t.Error("score is not the product of its factors")
+	}
+	if sb.Score.Cmp(hdb.calculateHostWeight(entry)) != 0 {
+		t.Error("score does not match the weight of the host")
+	}
+
+	// Ignore every factor except for uptime.
+	err := hdb.SetScoreWeights(modules.HostScoreWeights{Uptime: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb = hdb.ScoreBreakdown(entry)
+	if sb.PriceScore.Cmp(baseWeight) != 0 || sb.CollateralAdjustment != 1 || sb.UptimeAdjustment != 0.75 {
+		t.Error("weights were not applied:", sb)
+	}
+
+	// Invalid weights are rejected.
+	for _, w := range []modules.HostScoreWeights{{Price: -1}, {Age: math.NaN()}, {Uptime: math.Inf(1)}} {
+		if err := hdb.SetScoreWeights(w); err != errInvalidScoreWeight {
+			t.Errorf("expected %v, got %v", errInvalidScoreWeight, err)
+		}
+	}
+
+	// Zero weights restore the defaults.
+	hdb.mu.Lock()
+	err = hdb.setScoreWeights(modules.HostScoreWeights{})
+	hdb.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdb.ScoreWeights() != modules.DefaultHostScoreWeights {
+		t.Error("default weights were not restored:", hdb.ScoreWeights())
+	}
+}
+
+// TestSetScoreWeightsReweights checks that changing the score weights
+// reweights the hosts in the host tree.
+func TestSetScoreWeightsReweights(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	cheap := makeHostDBEntry()
+	cheap.StoragePrice = types.NewCurrency64(10)
+	cheap.ScanHistory = modules.HostDBScans{{Success: true}, {Success: false}}
+	reliable := makeHostDBEntry()
+	reliable.StoragePrice = types.NewCurrency64(20)
+	reliable.ScanHistory = modules.HostDBScans{{Success: true}, {Success: true}}
+	for _, entry := range []modules.HostDBEntry{cheap, reliable} {
+		if err := hdb.hostTree.Insert(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hosts := hdb.ActiveHosts(); hosts[0].PublicKey.String() != cheap.PublicKey.String() {
+		t.Fatal("cheaper host should be preferred by default")
+	}
+
+	// Only consider uptime.
+	if err := hdb.SetScoreWeights(modules.HostScoreWeights{Uptime: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := hdb.ActiveHosts(); hosts[0].PublicKey.String() != reliable.PublicKey.String() {
+		t.Fatal("more reliable host should be preferred after reweighting")
+	}
+}
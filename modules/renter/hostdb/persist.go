@@ -6,9 +6,11 @@ import (
 
 // hdbPersist defines what HostDB data persists across sessions.
 type hdbPersist struct {
-	AllHosts    []hostEntry
-	ActiveHosts []hostEntry
-	LastChange  modules.ConsensusChangeID
+	AllHosts     []hostEntry
+	ActiveHosts  []hostEntry
+	LastChange   modules.ConsensusChangeID
+	Filter       modules.HostDBFilter
+	ScoreWeights modules.HostScoreWeights
 }
 
 // persistData returns the data in the hostdb that will be saved to disk.
@@ -21,6 +23,8 @@ func (hdb *HostDB) persistData() hdbPersist {
 		data.ActiveHosts = append(data.ActiveHosts, *entry)
 	}
 	data.LastChange = hdb.lastChange
+	data.Filter = hdb.filter
+	data.ScoreWeights = hdb.scoreWeights
 	return data
 }
 
@@ -41,14 +45,32 @@ func (hdb *HostDB) load() error {
 	if err != nil {
 		return err
 	}
+	// Hosts are weighted by their scores, so the weights must be loaded
+	// before the hosts are inserted into the tree.
+	if err := hdb.setScoreWeights(data.ScoreWeights); err != nil {
+		return err
+	}
+	// Hosts are indexed by their public key. Older versions indexed hosts by
+	// their address, so a host that moved may be listed more than once; only
+	// the most recently seen entry is kept.
 	for i := range data.AllHosts {
-		hdb.allHosts[data.AllHosts[i].NetAddress] = &data.AllHosts[i]
+		key := data.AllHosts[i].PublicKey.String()
+		if prior, exists := hdb.allHosts[key]; exists && prior.FirstSeen > data.AllHosts[i].FirstSeen {
+			continue
+		}
+		hdb.allHosts[key] = &data.AllHosts[i]
 	}
-	for i := range data.ActiveHosts {
-		host := data.AllHosts[i]
-		hdb.activeHosts[host.NetAddress] = &host
-		hdb.hostTree.Insert(host.HostDBEntry)
+	for _, host := range data.ActiveHosts {
+		entry, exists := hdb.allHosts[host.PublicKey.String()]
+		if !exists || entry.NetAddress != host.NetAddress {
+			continue
+		}
+		if _, active := hdb.activeHosts[host.PublicKey.String()]; active {
+			continue
+		}
+		hdb.activeHosts[host.PublicKey.String()] = entry
+		hdb.hostTree.Insert(entry.HostDBEntry)
 	}
 	hdb.lastChange = data.LastChange
-	return nil
+	return hdb.setFilter(data.Filter)
 }
@@ -22,19 +22,21 @@ func TestSaveLoad(t *testing.T) {
 	hdb.persist = new(memPersist)
 
 	// add some fake hosts
-	var host1, host2, host3 hostEntry
+	host1 := hostEntry{HostDBEntry: makeHostDBEntry()}
+	host2 := hostEntry{HostDBEntry: makeHostDBEntry()}
+	host3 := hostEntry{HostDBEntry: makeHostDBEntry()}
 	host1.NetAddress = "foo"
 	host2.NetAddress = "bar"
 	host3.NetAddress = "baz"
-	hdb.allHosts = map[modules.NetAddress]*hostEntry{
-		host1.NetAddress: &host1,
-		host2.NetAddress: &host2,
-		host3.NetAddress: &host3,
+	hdb.allHosts = map[string]*hostEntry{
+		host1.PublicKey.String(): &host1,
+		host2.PublicKey.String(): &host2,
+		host3.PublicKey.String(): &host3,
 	}
-	hdb.activeHosts = map[modules.NetAddress]*hostEntry{
-		host1.NetAddress: &host1,
-		host2.NetAddress: &host2,
-		host3.NetAddress: &host3,
+	hdb.activeHosts = map[string]*hostEntry{
+		host1.PublicKey.String(): &host1,
+		host2.PublicKey.String(): &host2,
+		host3.PublicKey.String(): &host3,
 	}
 	hdb.lastChange = modules.ConsensusChangeID{1, 2, 3}
 
@@ -54,17 +56,17 @@ func TestSaveLoad(t *testing.T) {
 	}
 
 	// check that AllHosts was loaded
-	_, ok0 := hdb.allHosts[host1.NetAddress]
-	_, ok1 := hdb.allHosts[host2.NetAddress]
-	_, ok2 := hdb.allHosts[host3.NetAddress]
+	_, ok0 := hdb.allHosts[host1.PublicKey.String()]
+	_, ok1 := hdb.allHosts[host2.PublicKey.String()]
+	_, ok2 := hdb.allHosts[host3.PublicKey.String()]
 	if !ok0 || !ok1 || !ok2 || len(hdb.allHosts) != 3 {
 		t.Fatal("allHosts was not restored properly:", hdb.allHosts)
 	}
 
 	// check that ActiveHosts was loaded
-	_, ok0 = hdb.activeHosts[host1.NetAddress]
-	_, ok1 = hdb.activeHosts[host2.NetAddress]
-	_, ok2 = hdb.activeHosts[host3.NetAddress]
+	_, ok0 = hdb.activeHosts[host1.PublicKey.String()]
+	_, ok1 = hdb.activeHosts[host2.PublicKey.String()]
+	_, ok2 = hdb.activeHosts[host3.PublicKey.String()]
 	if !ok0 || !ok1 || !ok2 || len(hdb.activeHosts) != 3 {
 		t.Fatal("active was not restored properly:", hdb.activeHosts)
 	}
@@ -111,19 +113,21 @@ func TestRescan(t *testing.T) {
 	hdb.persist = new(memPersist)
 
 	// add some fake hosts
-	var host1, host2, host3 hostEntry
+	host1 := hostEntry{HostDBEntry: makeHostDBEntry()}
+	host2 := hostEntry{HostDBEntry: makeHostDBEntry()}
+	host3 := hostEntry{HostDBEntry: makeHostDBEntry()}
 	host1.NetAddress = "foo"
 	host2.NetAddress = "bar"
 	host3.NetAddress = "baz"
-	hdb.allHosts = map[modules.NetAddress]*hostEntry{
-		host1.NetAddress: &host1,
-		host2.NetAddress: &host2,
-		host3.NetAddress: &host3,
+	hdb.allHosts = map[string]*hostEntry{
+		host1.PublicKey.String(): &host1,
+		host2.PublicKey.String(): &host2,
+		host3.PublicKey.String(): &host3,
 	}
-	hdb.activeHosts = map[modules.NetAddress]*hostEntry{
-		host1.NetAddress: &host1,
-		host2.NetAddress: &host2,
-		host3.NetAddress: &host3,
+	hdb.activeHosts = map[string]*hostEntry{
+		host1.PublicKey.String(): &host1,
+		host2.PublicKey.String(): &host2,
+		host3.PublicKey.String(): &host3,
 	}
 
 	// use a bogus change ID
@@ -151,14 +155,16 @@ func TestRescan(t *testing.T) {
 	// Reload the hostdb using the same persist and the mocked consensus set.
 	// The old change ID will be rejected, causing a rescan, which should
 	// discover the new announcement.
-	hdb, err = newHostDB(cs, stdDialer{}, stdSleeper{}, hdb.persist, hdb.log)
+	hdb, err = newHostDB(cs, stdDialer{}, stdResolver{}, stdSleeper{}, hdb.persist, hdb.log)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if len(hdb.allHosts) != 1 {
 		t.Fatal("hostdb rescan resulted in wrong host set:", hdb.allHosts)
 	}
-	if _, exists := hdb.allHosts["quux.com:1234"]; !exists {
-		t.Fatal("hostdb rescan resulted in wrong host set:", hdb.allHosts)
+	for _, host := range hdb.allHosts {
+		if host.NetAddress != "quux.com:1234" {
+			t.Fatal("hostdb rescan resulted in wrong host set:", hdb.allHosts)
+		}
 	}
 }
@@ -5,7 +5,6 @@ package hostdb
 // settings of the hosts.
 
 import (
-	"bytes"
 	"crypto/rand"
 	"math/big"
 	"net"
@@ -35,6 +34,12 @@ const (
 	// scanningThreads is the number of threads that will be probing hosts for
 	// their settings and checking for reliability.
 	scanningThreads = 50
+
+	// ipv4SubnetBits and ipv6SubnetBits are the prefix lengths of the subnets
+	// that hosts are grouped into. No more than one host per subnet is
+	// selected for contracts.
+	ipv4SubnetBits = 24
+	ipv6SubnetBits = 54
 )
 
 // Reliability is a measure of a host's uptime.
@@ -94,11 +99,11 @@ func (hdb *HostDB) queueHostEntry(entry *hostEntry) {
 
 // decrementReliability reduces the reliability of a node, moving it out of the
 // set of active hosts or deleting it entirely if necessary.
-func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.Currency) {
-	hdb.log.Debugln("reliability decrement issued for", addr)
+func (hdb *HostDB) decrementReliability(pk types.SiaPublicKey, penalty types.Currency) {
+	hdb.log.Debugln("reliability decrement issued for", pk.String())
 
 	// Look up the entry and decrement the reliability.
-	entry, exists := hdb.allHosts[addr]
+	entry, exists := hdb.allHosts[pk.String()]
 	if !exists {
 		build.Critical("host to be decremented did not exist in hostdb")
 		return
@@ -107,27 +112,73 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 
 	// If the entry is in the active database, remove it from the active
 	// database.
-	existingEntry, exists := hdb.activeHosts[addr]
+	existingEntry, exists := hdb.activeHosts[pk.String()]
 	if exists {
-		hdb.log.Debugln("host is being pulled from list of active hosts", addr)
+		hdb.log.Debugln("host is being pulled from list of active hosts", entry.NetAddress)
 		hdb.hostTree.Remove(existingEntry.PublicKey)
-		delete(hdb.activeHosts, entry.NetAddress)
+		delete(hdb.activeHosts, pk.String())
 	}
 
 	// If the reliability has fallen to 0, remove the host from the
 	// database entirely.
 	if entry.Reliability.IsZero() {
-		hdb.log.Debugln("host is being dropped from hostdb", addr)
-		delete(hdb.allHosts, addr)
+		hdb.log.Debugln("host is being dropped from hostdb", entry.NetAddress)
+		delete(hdb.allHosts, pk.String())
+	}
+}
+
+// hostIPNets returns the subnets that the supplied IP addresses belong to.
+// Loopback addresses are not placed in a subnet. Hosts are only allowed to use
+// them in testing builds, where every host runs on the same machine.
+func hostIPNets(ips []net.IP) []string {
+	var ipnets []string
+	seen := make(map[string]struct{})
+	for _, ip := range ips {
+		if ip.IsLoopback() {
+			continue
+		}
+		mask := net.CIDRMask(ipv6SubnetBits, 8*net.IPv6len)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+			mask = net.CIDRMask(ipv4SubnetBits, 8*net.IPv4len)
+		}
+		ipnet := (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+		if _, exists := seen[ipnet]; !exists {
+			seen[ipnet] = struct{}{}
+			ipnets = append(ipnets, ipnet)
+		}
+	}
+	return ipnets
+}
+
+// managedLookupIPNets resolves the NetAddress of a host and returns the
+// subnets of its IP addresses.
+func (hdb *HostDB) managedLookupIPNets(addr modules.NetAddress) ([]string, error) {
+	ips := []net.IP{net.ParseIP(addr.Host())}
+	if ips[0] == nil {
+		var err error
+		ips, err = hdb.resolver.LookupIP(addr.Host())
+		if err != nil {
+			return nil, err
+		}
 	}
+	return hostIPNets(ips), nil
 }
 
 // managedUpdateEntry updates an entry in the hostdb after a scan has taken
-// place.
-func (hdb *HostDB) managedUpdateEntry(entry *hostEntry, newSettings modules.HostExternalSettings, netErr error) {
+// place. netAddr is the address that the host was scanned at, and ipnets are
+// the subnets that it resolved to during the scan.
+func (hdb *HostDB) managedUpdateEntry(entry *hostEntry, netAddr modules.NetAddress, newSettings modules.HostExternalSettings, ipnets []string, netErr error) {
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
 
+	// The host may have announced a new address during the scan. The results
+	// of the scan do not apply to the new address, which is scanned
+	// separately.
+	if entry.NetAddress != netAddr {
+		return
+	}
+
 	// Add a data point for the scan.
 	entry.ScanHistory = append(entry.ScanHistory, modules.HostDBScan{
 		Timestamp: time.Now(),
@@ -139,19 +190,16 @@ func (hdb *HostDB) managedUpdateEntry(entry *hostEntry, newSettings modules.Host
 	}
 
 	// Add the host to allHosts.
-	priorHost, exists := hdb.allHosts[entry.NetAddress]
+	key := entry.PublicKey.String()
+	_, exists := hdb.allHosts[key]
 	if !exists {
-		hdb.allHosts[entry.NetAddress] = entry
+		hdb.allHosts[key] = entry
 	}
 
 	// If the scan was unsuccessful, decrement the host's reliability.
 	if netErr != nil {
-		if exists && bytes.Equal(priorHost.PublicKey.Key, entry.PublicKey.Key) {
-			// Only decrement the reliability if the public key in the
-			// hostdb matches the public key in the host announcement -
-			// the failure may just be a failed signature, indicating
-			// the wrong public key.
-			hdb.decrementReliability(entry.NetAddress, UnreachablePenalty)
+		if exists {
+			hdb.decrementReliability(entry.PublicKey, UnreachablePenalty)
 		}
 		return
 	}
@@ -160,7 +208,7 @@ func (hdb *HostDB) managedUpdateEntry(entry *hostEntry, newSettings modules.Host
 	// properties of the tree require that the weight does not change while the
 	// node is in the tree, so the node must be removed before the settings and
 	// weight are changed.
-	existingEntry, exists := hdb.activeHosts[entry.NetAddress]
+	existingEntry, exists := hdb.activeHosts[key]
 	if !exists && len(hdb.activeHosts) > maxActiveHosts {
 		return
 	}
@@ -169,20 +217,21 @@ func (hdb *HostDB) managedUpdateEntry(entry *hostEntry, newSettings modules.Host
 	// must be preserved.
 	newSettings.NetAddress = entry.HostExternalSettings.NetAddress
 	entry.HostExternalSettings = newSettings
+	entry.IPNets = ipnets
 	entry.Reliability = MaxReliability
 
 	if exists {
 		hdb.hostTree.Remove(existingEntry.PublicKey)
-		delete(hdb.activeHosts, entry.NetAddress)
+		delete(hdb.activeHosts, key)
 	}
 	err := hdb.hostTree.Insert(entry.HostDBEntry)
-	hdb.activeHosts[entry.NetAddress] = entry
+	hdb.activeHosts[key] = entry
 	if err != nil {
 		hdb.log.Println("errorinserting entry into tree: ", err)
 	}
 
 	// Sanity check - the node should be in the hostdb now.
-	_, exists = hdb.activeHosts[entry.NetAddress]
+	_, exists = hdb.activeHosts[key]
 	if !exists {
 		hdb.log.Critical("Host was not added to the list of active hosts after the entry was updated.")
 	}
@@ -229,6 +278,13 @@ func (hdb *HostDB) managedScanHost(hostEntry *hostEntry) {
 		copy(pubkey[:], pubKey.Key)
 		return crypto.ReadSignedObject(conn, &settings, maxSettingsLen, pubkey)
 	}()
+	// A host whose address cannot be resolved cannot be checked against the
+	// subnets of other hosts, so the scan counts as a failure and the host is
+	// kept out of the set of active hosts.
+	var ipnets []string
+	if err == nil {
+		ipnets, err = hdb.managedLookupIPNets(netAddr)
+	}
 	if err != nil {
 		hdb.log.Debugln("Scanning", netAddr, pubKey, "failed:", err)
 	} else {
@@ -236,7 +292,7 @@ func (hdb *HostDB) managedScanHost(hostEntry *hostEntry) {
 	}
 
 	// Update the host tree to have a new entry.
-	hdb.managedUpdateEntry(hostEntry, settings, err)
+	hdb.managedUpdateEntry(hostEntry, netAddr, settings, ipnets, err)
 }
 
 // threadedProbeHosts tries to fetch the settings of a host. If successful, the
@@ -284,7 +340,7 @@ func (hdb *HostDB) threadedScan() {
 			// Assemble all of the inactive hosts into a single array.
 			var entries []*hostEntry
 			for _, entry := range hdb.allHosts {
-				_, exists := hdb.activeHosts[entry.NetAddress]
+				_, exists := hdb.activeHosts[entry.PublicKey.String()]
 				if !exists {
 					entries = append(entries, entry)
 				}
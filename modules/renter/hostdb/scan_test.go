@@ -1,6 +1,8 @@
 package hostdb
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -22,23 +24,23 @@ func TestDecrementReliability(t *testing.T) {
 				t.Fatal("decrementReliability should build.Critical with nonexistent host")
 			}
 		}()
-		hdb.decrementReliability("foo", types.NewCurrency64(0))
+		hdb.decrementReliability(types.SiaPublicKey{}, types.NewCurrency64(0))
 	}()
 
 	// Add a host to allHosts and activeHosts. Decrementing it should remove it
 	// from activeHosts.
-	h := new(hostEntry)
+	h := &hostEntry{HostDBEntry: makeHostDBEntry()}
 	h.NetAddress = "foo"
 	h.Reliability = types.NewCurrency64(1)
-	hdb.allHosts[h.NetAddress] = h
-	hdb.activeHosts[h.NetAddress] = h
-	hdb.decrementReliability(h.NetAddress, types.NewCurrency64(0))
+	hdb.allHosts[h.PublicKey.String()] = h
+	hdb.activeHosts[h.PublicKey.String()] = h
+	hdb.decrementReliability(h.PublicKey, types.NewCurrency64(0))
 	if len(hdb.ActiveHosts()) != 0 {
 		t.Error("decrementing did not remove host from activeHosts")
 	}
 
 	// Decrement reliability to 0. This should remove the host from allHosts.
-	hdb.decrementReliability(h.NetAddress, h.Reliability)
+	hdb.decrementReliability(h.PublicKey, h.Reliability)
 	if len(hdb.AllHosts()) != 0 {
 		t.Error("decrementing did not remove host from allHosts")
 	}
@@ -232,7 +234,7 @@ func TestThreadedScan(t *testing.T) {
 	h := new(hostEntry)
 	h.NetAddress = "foo"
 	h.Reliability = types.NewCurrency64(1)
-	hdb.activeHosts[h.NetAddress] = h
+	hdb.activeHosts[h.PublicKey.String()] = h
 
 	// perform one scan
 	go hdb.threadedScan()
@@ -246,8 +248,8 @@ func TestThreadedScan(t *testing.T) {
 
 	// remove the host from activeHosts and add it to allHosts
 	hdb.mu.Lock()
-	delete(hdb.activeHosts, h.NetAddress)
-	hdb.allHosts[h.NetAddress] = h
+	delete(hdb.activeHosts, h.PublicKey.String())
+	hdb.allHosts[h.PublicKey.String()] = h
 	hdb.mu.Unlock()
 
 	// perform one scan
@@ -260,3 +262,77 @@ func TestThreadedScan(t *testing.T) {
 		t.Error("host was not scanned")
 	}
 }
+
+// stubResolver resolves every host to the same IP addresses.
+type stubResolver []net.IP
+
+func (r stubResolver) LookupIP(string) ([]net.IP, error) { return r, nil }
+
+// failResolver fails to resolve every host.
+type failResolver struct{}
+
+func (failResolver) LookupIP(string) ([]net.IP, error) { return nil, errors.New("no such host") }
+
+// TestLookupIPNets tests that hosts are grouped into the correct subnets.
+func TestLookupIPNets(t *testing.T) {
+	hdb := bareHostDB()
+	tests := []struct {
+		addr   modules.NetAddress
+		ips    []net.IP
+		ipnets []string
+	}{
+		{"1.2.3.4:9982", nil, []string{"1.2.3.0/24"}},
+		{"[2001:db8:1:3fff::1]:9982", nil, []string{"2001:db8:1:3c00::/54"}},
+		{"127.0.0.1:9982", nil, nil},
+		{"foo.com:9982", []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("1.2.3.5"), net.ParseIP("::ffff:5.6.7.8")}, []string{"1.2.3.0/24", "5.6.7.0/24"}},
+		{"localhost:9982", []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}, nil},
+	}
+	for _, test := range tests {
+		hdb.resolver = stubResolver(test.ips)
+		ipnets, err := hdb.managedLookupIPNets(test.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(ipnets) != fmt.Sprint(test.ipnets) {
+			t.Errorf("%v: expected %v, got %v", test.addr, test.ipnets, ipnets)
+		}
+	}
+
+	// A host that cannot be resolved has no subnets, and must not be
+	// mistaken for a host that resolved to loopback addresses.
+	hdb.resolver = failResolver{}
+	if _, err := hdb.managedLookupIPNets("foo.com:9982"); err == nil {
+		t.Error("expected an error when the host cannot be resolved")
+	}
+}
+
+// TestUpdateEntryMovedHost checks that the results of a scan are discarded if
+// the host announced a new address while it was being scanned.
+func TestUpdateEntryMovedHost(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = new(memPersist)
+	entry := &hostEntry{
+		HostDBEntry: makeHostDBEntry(),
+		Reliability: DefaultReliability,
+	}
+	entry.NetAddress = "bar.com:9982"
+	hdb.allHosts[entry.PublicKey.String()] = entry
+
+	settings := modules.HostExternalSettings{AcceptingContracts: true}
+	hdb.managedUpdateEntry(entry, "foo.com:9982", settings, []string{"1.2.3.0/24"}, nil)
+	if _, exists := hdb.activeHosts[entry.PublicKey.String()]; exists {
+		t.Error("host was activated by a scan of its old address")
+	}
+	if entry.IPNets != nil || len(entry.ScanHistory) != 0 {
+		t.Error("scan of the old address was recorded:", entry.IPNets, entry.ScanHistory)
+	}
+
+	// A scan of the current address is recorded.
+	hdb.managedUpdateEntry(entry, entry.NetAddress, settings, []string{"5.6.7.0/24"}, nil)
+	if _, exists := hdb.activeHosts[entry.PublicKey.String()]; !exists {
+		t.Error("host was not activated by a scan of its current address")
+	}
+	if entry.NetAddress != "bar.com:9982" || len(entry.IPNets) != 1 {
+		t.Error("scan of the current address was not recorded:", entry.NetAddress, entry.IPNets)
+	}
+}
@@ -0,0 +1,145 @@
+package renter
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// maxMetadataSize is the maximum combined size of the keys and values in
+	// the metadata of a file. Metadata is stored in the file's .sia file, so
+	// it is kept small.
+	maxMetadataSize = 4096
+)
+
+var (
+	errEmptyMetadataKey = errors.New("metadata keys must be nonempty")
+	errMetadataTooLarge = errors.New("metadata of a file must not exceed 4096 bytes")
+)
+
+// A metadataEntry is a key/value pair of the metadata of a file, as encoded in
+// a .sia file.
+type metadataEntry struct {
+	Key   string
+	Value string
+}
+
+// metadataEntries returns the metadata of f as entries sorted by key, so that
+// the encoding of a file is deterministic.
+func (f *file) metadataEntries() []metadataEntry {
+	entries := make([]metadataEntry, 0, len(f.metadata))
+	for k, v := range f.metadata {
+		entries = append(entries, metadataEntry{k, v})
+	}
+	sort.Sort(metadataEntriesByKey(entries))
+	return entries
+}
+
+// metadataEntriesByKey implements sort.Interface for a slice of
+// metadataEntry, sorting by key.
+type metadataEntriesByKey []metadataEntry
+
+func (me metadataEntriesByKey) Len() int           { return len(me) }
+func (me metadataEntriesByKey) Less(i, j int) bool { return me[i].Key < me[j].Key }
+func (me metadataEntriesByKey) Swap(i, j int)      { me[i], me[j] = me[j], me[i] }
+
+// copyMetadata returns a copy of the metadata of f, which may be handed to
+// callers without holding the lock of f.
+func (f *file) copyMetadata() map[string]string {
+	metadata := make(map[string]string, len(f.metadata))
+	for k, v := range f.metadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+// SetFileMetadata sets the metadata of the file at siaPath. Keys with an empty
+// value are removed from the metadata, and keys that are not given keep their
+// current value.
+func (r *Renter) SetFileMetadata(siaPath string, metadata map[string]string) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	f, exists := r.files[siaPath]
+	if !exists {
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	updated := f.copyMetadata()
+	for k, v := range metadata {
+		if k == "" {
+			return errEmptyMetadataKey
+		}
+		if v == "" {
+			delete(updated, k)
+		} else {
+			updated[k] = v
+		}
+	}
+	var size int
+	for k, v := range updated {
+		size += len(k) + len(v)
+	}
+	if size > maxMetadataSize {
+		return errMetadataTooLarge
+	}
+	f.metadata = updated
+	return r.persistFile(f)
+}
+
+// matchesFilter returns true if the file at siaPath matches filter. f must be
+// locked.
+func matchesFilter(f *file, siaPath string, filter modules.FileFilter) bool {
+	if !strings.HasPrefix(siaPath, filter.Prefix) {
+		return false
+	}
+	if f.size < filter.MinSize || (filter.MaxSize != 0 && f.size > filter.MaxSize) {
+		return false
+	}
+	for k, v := range filter.Tags {
+		fv, exists := f.metadata[k]
+		if !exists || (v != "" && fv != v) {
+			return false
+		}
+	}
+	if filter.MinRedundancy != 0 || filter.MaxRedundancy != 0 {
+		redundancy := f.redundancy()
+		if redundancy < filter.MinRedundancy || (filter.MaxRedundancy != 0 && redundancy > filter.MaxRedundancy) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterFiles returns the page of the files that match filter selected by its
+// Offset and Limit, along with the total number of files that match filter.
+// Files are sorted by SiaPath.
+func (r *Renter) FilterFiles(filter modules.FileFilter) ([]modules.FileInfo, int) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	names := make([]string, 0, len(r.files))
+	for name := range r.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := []modules.FileInfo{}
+	var total int
+	for _, name := range names {
+		f := r.files[name]
+		f.mu.RLock()
+		if matchesFilter(f, name, filter) {
+			if total >= filter.Offset && (filter.Limit == 0 || len(files) < filter.Limit) {
+				files = append(files, fileInfo(f))
+			}
+			total++
+		}
+		f.mu.RUnlock()
+	}
+	return files, total
+}
@@ -0,0 +1,121 @@
+package renter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/sync"
+)
+
+// TestFilterFiles checks that files are filtered by their tags, SiaPath, and
+// size, and that the matching files are paginated.
+func TestFilterFiles(t *testing.T) {
+	r := &Renter{
+		dirIndex: newDirIndex(nil, nil),
+		files:    make(map[string]*file),
+		mu:       sync.New(modules.SafeMutexDelay, 1),
+	}
+	rsc, _ := NewRSCode(1, 1)
+	for _, f := range []struct {
+		name     string
+		size     uint64
+		metadata map[string]string
+	}{
+		{"photos/a.jpg", 100, map[string]string{modules.MetadataContentType: "image/jpeg", modules.MetadataOwner: "alice"}},
+		{"photos/b.png", 200, map[string]string{modules.MetadataContentType: "image/png", modules.MetadataOwner: "bob"}},
+		{"photos/c.jpg", 300, map[string]string{modules.MetadataContentType: "image/jpeg", modules.MetadataOwner: "bob"}},
+		{"docs/d.txt", 400, nil},
+	} {
+		nf := newFile(f.name, rsc, 10, f.size)
+		nf.metadata = f.metadata
+		r.addFileEntry(f.name, nf)
+	}
+
+	tests := []struct {
+		filter modules.FileFilter
+		names  []string
+		total  int
+	}{
+		{modules.FileFilter{}, []string{"docs/d.txt", "photos/a.jpg", "photos/b.png", "photos/c.jpg"}, 4},
+		{modules.FileFilter{Tags: map[string]string{modules.MetadataOwner: "bob"}}, []string{"photos/b.png", "photos/c.jpg"}, 2},
+		{modules.FileFilter{Tags: map[string]string{modules.MetadataOwner: ""}}, []string{"photos/a.jpg", "photos/b.png", "photos/c.jpg"}, 3},
+		{modules.FileFilter{Tags: map[string]string{modules.MetadataOwner: "bob", modules.MetadataContentType: "image/jpeg"}}, []string{"photos/c.jpg"}, 1},
+		{modules.FileFilter{Prefix: "docs/"}, []string{"docs/d.txt"}, 1},
+		{modules.FileFilter{MinSize: 200, MaxSize: 300}, []string{"photos/b.png", "photos/c.jpg"}, 2},
+		{modules.FileFilter{MinRedundancy: 1}, nil, 0},
+		{modules.FileFilter{Offset: 1, Limit: 2}, []string{"photos/a.jpg", "photos/b.png"}, 4},
+		{modules.FileFilter{Offset: 3, Limit: 2}, []string{"photos/c.jpg"}, 4},
+		{modules.FileFilter{Offset: 5}, nil, 4},
+	}
+	for _, test := range tests {
+		files, total := r.FilterFiles(test.filter)
+		var names []string
+		for _, f := range files {
+			names = append(names, f.SiaPath)
+		}
+		if strings.Join(names, ",") != strings.Join(test.names, ",") || total != test.total {
+			t.Errorf("filter %+v returned %v of %v files, expected %v of %v", test.filter, names, total, test.names, test.total)
+		}
+	}
+}
+
+// TestSetFileMetadata checks that the metadata of a file is updated and
+// persisted.
+func TestSetFileMetadata(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestSetFileMetadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	f := newFile("foo", rsc, 10, 15)
+	rt.renter.addFileEntry(f.name, f)
+
+	if err := rt.renter.SetFileMetadata("dne", map[string]string{"a": "b"}); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	if err := rt.renter.SetFileMetadata("foo", map[string]string{"": "b"}); err != errEmptyMetadataKey {
+		t.Fatal("expected errEmptyMetadataKey, got", err)
+	}
+	if err := rt.renter.SetFileMetadata("foo", map[string]string{"a": strings.Repeat("b", maxMetadataSize)}); err != errMetadataTooLarge {
+		t.Fatal("expected errMetadataTooLarge, got", err)
+	}
+
+	err = rt.renter.SetFileMetadata("foo", map[string]string{modules.MetadataOwner: "alice", "a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.SetFileMetadata("foo", map[string]string{"a": "", "c": "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := rt.renter.File("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fi.Metadata) != 2 || fi.Metadata[modules.MetadataOwner] != "alice" || fi.Metadata["c"] != "d" {
+		t.Fatal("metadata was not updated:", fi.Metadata)
+	}
+
+	// The metadata should have been saved to the .sia file of the file.
+	handle, err := os.Open(filepath.Join(rt.renter.persistDir, "foo"+ShareExtension))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+	files, err := readSharedFiles(handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !reflect.DeepEqual(files[0].metadata, fi.Metadata) {
+		t.Fatal("metadata was not saved:", files[0].metadata)
+	}
+}
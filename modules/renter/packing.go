@@ -0,0 +1,407 @@
+package renter
+
+// Small files are packed together so that they do not each occupy a full
+// chunk on the network. A pack is a file of a single chunk that holds the data
+// of many small files, which each record their offset within the pack. Packs
+// are repaired and downloaded like any other file, but are not visible to the
+// user. A pack is garbage collected, and its sectors deleted from the hosts,
+// once every file stored in it has been deleted.
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// packsDir is the directory within the renter's persist directory that
+	// holds the metadata of each pack.
+	packsDir = "packs"
+
+	// packExtension is the extension of the metadata file of a pack. It
+	// differs from ShareExtension so that packs are not loaded as files.
+	packExtension = ".siapack"
+)
+
+var (
+	// errPackSourceUnavailable is returned when the chunk of a pack cannot
+	// be assembled because a file stored in the pack has no local source,
+	// which is the case for archived files. The pack is then repaired from
+	// the network.
+	errPackSourceUnavailable = errors.New("a file stored in the pack has no local source")
+
+	// errSharePackedFile is returned when trying to share a file that is
+	// stored in a pack, as the pack is shared with other files.
+	errSharePackedFile = errors.New("files that are packed with other files cannot be shared")
+
+	// packFlushInterval is the amount of time that a pack waits for more
+	// small files before it is queued for upload.
+	packFlushInterval = build.Select(build.Var{
+		Standard: time.Minute,
+		Dev:      time.Second * 10,
+		Testing:  time.Second,
+	}).(time.Duration)
+)
+
+type (
+	// An openPack is a pack that is still accepting small files. Open packs
+	// are not uploaded until they are full or have been open for
+	// packFlushInterval, as any change to the contents of an uploaded chunk
+	// would require uploading the chunk again.
+	openPack struct {
+		pack   *file
+		opened time.Time
+	}
+
+	// A packMember describes the local source of a file that is stored in a
+	// pack, along with the location of the file's data within the pack.
+	packMember struct {
+		repairPath string
+		offset     uint64
+		size       uint64
+	}
+)
+
+// packKey returns the key of the open pack that files with the given erasure
+// code are added to. Files can only share a chunk if they share an erasure
+// code.
+func packKey(code modules.ErasureCoder) string {
+	return fmt.Sprintf("%v%v", code.Type(), code.Params())
+}
+
+// newPackName returns a random name for a new pack.
+func newPackName() string {
+	b, _ := crypto.RandBytes(16)
+	return hex.EncodeToString(b)
+}
+
+// packPath returns the location of the metadata file of a pack.
+func (r *Renter) packPath(name string) string {
+	return filepath.Join(r.persistDir, packsDir, name+packExtension)
+}
+
+// savePack saves the metadata of a pack to the packs directory.
+func (r *Renter) savePack(p *file) error {
+	return saveFileAt(p, r.packPath(p.name))
+}
+
+// loadPacks loads the metadata of each pack from the packs directory. Errors
+// encountered while loading a pack are logged, but are not considered fatal.
+func (r *Renter) loadPacks() error {
+	paths, err := filepath.Glob(filepath.Join(r.persistDir, packsDir, "*"+packExtension))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		handle, err := os.Open(path)
+		if err != nil {
+			r.log.Println("ERROR: could not open pack:", err)
+			continue
+		}
+		files, err := readSharedFiles(handle)
+		handle.Close()
+		if err != nil || len(files) != 1 {
+			r.log.Println("ERROR: could not load pack:", path, err)
+			continue
+		}
+		if r.resolveHostKeys(files[0]) {
+			if err := r.savePack(files[0]); err != nil {
+				r.log.Println("ERROR: could not save pack:", path, err)
+			}
+		}
+		r.packs[files[0].name] = files[0]
+		r.packMembers[files[0].name] = make(map[*file]struct{})
+	}
+	return nil
+}
+
+// linkPackedFiles points each packed file, including archived files that are
+// no longer current, at the pack that stores its data. Packs that no longer
+// store any files are collected. A packed file whose pack cannot be found is
+// uploaded as a regular file instead.
+func (r *Renter) linkPackedFiles() {
+	for f, af := range r.archived {
+		if af.tracking.Pack == "" || r.isCurrent(f) {
+			continue
+		}
+		p, exists := r.packs[af.tracking.Pack]
+		if !exists {
+			r.log.Println("WARN: could not find the pack of archived file", f.name)
+			continue
+		}
+		f.pack = p
+		f.packOffset = af.tracking.PackOffset
+		r.packMembers[p.name][f] = struct{}{}
+	}
+	for name, tf := range r.tracking {
+		if tf.Pack == "" {
+			continue
+		}
+		f, exists := r.files[name]
+		if !exists {
+			continue
+		}
+		p, exists := r.packs[tf.Pack]
+		if !exists {
+			r.log.Println("WARN: could not find the pack of", name, "- the file will be uploaded on its own")
+			tf.Pack = ""
+			tf.PackOffset = 0
+			r.tracking[name] = tf
+			continue
+		}
+		f.pack = p
+		f.packOffset = tf.PackOffset
+		r.packMembers[p.name][f] = struct{}{}
+	}
+	for _, p := range r.packs {
+		if len(r.packMembers[p.name]) == 0 {
+			r.collectPack(p)
+		}
+	}
+}
+
+// managedUploadPacked adds a small file to the open pack of its erasure code,
+// opening a new pack if the file does not fit. Packs are queued for upload
+// once they are full. Like other uploads, the data of the file is read from
+// its local source when the pack is uploaded.
+func (r *Renter) managedUploadPacked(up modules.FileUploadParams, size uint64, mode os.FileMode) error {
+	lockID := r.mu.Lock()
+	if err := r.replaceFile(up.SiaPath, up.Versioned); err != nil {
+		r.mu.Unlock(lockID)
+		return err
+	}
+
+	// Close the open pack if the file does not fit into it.
+	var closedPacks []*file
+	key := packKey(up.ErasureCode)
+	op, exists := r.openPacks[key]
+	if exists && op.pack.size+size > op.pack.chunkSize() {
+		if p := r.closePack(key); p != nil {
+			closedPacks = append(closedPacks, p)
+		}
+		exists = false
+	}
+	if !exists {
+		op = &openPack{
+			pack:   newFile(newPackName(), up.ErasureCode, pieceSize, 0),
+			opened: time.Now(),
+		}
+		r.openPacks[key] = op
+		r.packs[op.pack.name] = op.pack
+		r.packMembers[op.pack.name] = make(map[*file]struct{})
+	}
+
+	// Add the file to the pack.
+	f := newFile(up.SiaPath, up.ErasureCode, pieceSize, size)
+	f.mode = uint32(mode)
+	f.expireHeight = up.ExpirationHeight
+	f.pack = op.pack
+	op.pack.mu.Lock()
+	f.packOffset = op.pack.size
+	op.pack.size += size
+	op.pack.mu.Unlock()
+	r.addFileEntry(up.SiaPath, f)
+	r.tracking[up.SiaPath] = trackedFile{
+		RepairPath: up.Source,
+		Pack:       op.pack.name,
+		PackOffset: f.packOffset,
+	}
+	r.packMembers[op.pack.name][f] = struct{}{}
+	r.saveSync()
+	r.saveArchive()
+	err := r.saveFile(f)
+	if err == nil {
+		err = r.savePack(op.pack)
+	}
+	if op.pack.size == op.pack.chunkSize() {
+		if p := r.closePack(key); p != nil {
+			closedPacks = append(closedPacks, p)
+		}
+	}
+	r.mu.Unlock(lockID)
+
+	// Send the closed packs to the repair loop.
+	for _, p := range closedPacks {
+		select {
+		case r.newRepairs <- p:
+		case <-r.tg.StopChan():
+			return err
+		}
+	}
+	return err
+}
+
+// closePack stops adding files to the open pack with the given key. The pack
+// is returned so that it can be queued for upload, unless every file in the
+// pack has already been deleted, in which case the pack is collected and nil
+// is returned.
+func (r *Renter) closePack(key string) *file {
+	op := r.openPacks[key]
+	delete(r.openPacks, key)
+	if len(r.packMembers[op.pack.name]) == 0 {
+		r.collectPack(op.pack)
+		return nil
+	}
+	return op.pack
+}
+
+// isOpenPack returns true if files are still being added to the pack.
+func (r *Renter) isOpenPack(p *file) bool {
+	for _, op := range r.openPacks {
+		if op.pack == p {
+			return true
+		}
+	}
+	return false
+}
+
+// removePackMember removes a file that is being deleted from its pack. The
+// pack is collected once it no longer stores any files, unless it is still
+// open.
+func (r *Renter) removePackMember(f *file) {
+	if f.pack == nil {
+		return
+	}
+	members := r.packMembers[f.pack.name]
+	delete(members, f)
+	if len(members) == 0 && !r.isOpenPack(f.pack) {
+		r.collectPack(f.pack)
+	}
+}
+
+// collectPack removes a pack that no longer stores any files from the renter.
+// The sectors of the pack are deleted from the hosts in the background.
+func (r *Renter) collectPack(p *file) {
+	delete(r.packs, p.name)
+	delete(r.packMembers, p.name)
+	os.RemoveAll(r.packPath(p.name))
+	r.chunkCache.invalidate(p.masterKey)
+	go r.threadedDeletePackSectors(p)
+}
+
+// packSources returns the local sources of the files stored in a pack.
+// Archived files that are no longer current have no local source.
+func (r *Renter) packSources(p *file) []packMember {
+	var members []packMember
+	for f := range r.packMembers[p.name] {
+		var repairPath string
+		if r.isCurrent(f) {
+			repairPath = r.tracking[f.name].RepairPath
+		}
+		members = append(members, packMember{
+			repairPath: repairPath,
+			offset:     f.packOffset,
+			size:       f.size,
+		})
+	}
+	return members
+}
+
+// readPackChunk assembles the chunk of a pack from the local sources of the
+// files stored in the pack. The returned data is padded with zeroes to the
+// full chunk size. errPackSourceUnavailable is returned if a file stored in
+// the pack has no local source.
+func readPackChunk(p *file, members []packMember) ([]byte, error) {
+	chunkData := make([]byte, p.chunkSize())
+	for _, m := range members {
+		if m.size == 0 {
+			continue
+		}
+		if m.repairPath == "" {
+			return nil, errPackSourceUnavailable
+		}
+		fHandle, err := os.Open(m.repairPath)
+		if err != nil {
+			return nil, build.ExtendErr("unable to open packed file to repair pack", err)
+		}
+		n, err := fHandle.ReadAt(chunkData[m.offset:m.offset+m.size], 0)
+		fHandle.Close()
+		if uint64(n) != m.size {
+			return nil, build.ExtendErr("unable to read packed file to repair pack", err)
+		}
+	}
+	return chunkData, nil
+}
+
+// threadedDeletePackSectors deletes the sectors of a collected pack from the
+// hosts that store them.
+func (r *Renter) threadedDeletePackSectors(p *file) {
+	p.mu.RLock()
+	var contracts []fileContract
+	for _, fc := range p.contracts {
+		contracts = append(contracts, fc)
+	}
+	p.mu.RUnlock()
+
+	r.threadedDeleteSectors(contracts)
+}
+
+// threadedDeleteSectors deletes the sectors of the pieces stored under each
+// of the contracts from the hosts that store them. Hosts that cannot be
+// reached keep the sectors until their contracts expire.
+func (r *Renter) threadedDeleteSectors(contracts []fileContract) {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for _, fc := range contracts {
+		editor, err := r.hostContractor.Editor(fc.ID)
+		if err != nil {
+			r.log.Debugln("Unable to delete sectors from", fc.HostPublicKey.String(), "::", err)
+			continue
+		}
+		for _, piece := range fc.Pieces {
+			select {
+			case <-r.tg.StopChan():
+				editor.Close()
+				return
+			default:
+			}
+			if err := editor.Delete(piece.MerkleRoot); err != nil {
+				r.log.Debugln("Unable to delete sector from", fc.HostPublicKey.String(), "::", err)
+				continue
+			}
+		}
+		editor.Close()
+	}
+}
+
+// threadedFlushPacks periodically closes the packs that have been open for
+// longer than packFlushInterval and queues them for upload.
+func (r *Renter) threadedFlushPacks() {
+	for {
+		select {
+		case <-time.After(packFlushInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+
+		id := r.mu.Lock()
+		var closedPacks []*file
+		for key, op := range r.openPacks {
+			if time.Since(op.opened) < packFlushInterval {
+				continue
+			}
+			if p := r.closePack(key); p != nil {
+				closedPacks = append(closedPacks, p)
+			}
+		}
+		r.mu.Unlock(id)
+
+		for _, p := range closedPacks {
+			select {
+			case r.newRepairs <- p:
+			case <-r.tg.StopChan():
+				return
+			}
+		}
+	}
+}
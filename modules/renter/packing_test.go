@@ -0,0 +1,152 @@
+package renter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestUploadPacked checks that small files are packed into shared chunks, and
+// that packs are collected once every file in them has been deleted.
+func TestUploadPacked(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestUploadPacked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a few small files, three of which fit into one chunk.
+	ec, _ := NewRSCode(1, 1)
+	chunkSize := pieceSize * uint64(ec.MinPieces())
+	fileSize := chunkSize / 3
+	sourceDir := build.TempDir("renter", "TestUploadPacked", "sources")
+	if err := os.MkdirAll(sourceDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	upload := func(name string, size uint64) {
+		source := filepath.Join(sourceDir, name)
+		if err := ioutil.WriteFile(source, make([]byte, size), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := rt.renter.Upload(modules.FileUploadParams{
+			Source:      source,
+			SiaPath:     name,
+			ErasureCode: ec,
+			Pack:        true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		upload(strconv.Itoa(i), fileSize)
+	}
+
+	// The first three files should share a pack, which has been closed, and
+	// the fourth file should be in a new, open pack.
+	id := rt.renter.mu.RLock()
+	first := rt.renter.files["0"].pack
+	fourth := rt.renter.files["3"].pack
+	for i := 0; i < 3; i++ {
+		f := rt.renter.files[strconv.Itoa(i)]
+		if f.pack != first || f.packOffset != uint64(i)*fileSize {
+			t.Error("file", i, "was not packed correctly")
+		}
+	}
+	if first == nil || fourth == nil || first == fourth {
+		t.Fatal("files were not packed into separate packs")
+	}
+	if rt.renter.isOpenPack(first) || !rt.renter.isOpenPack(fourth) {
+		t.Error("wrong packs are open")
+	}
+	if len(rt.renter.packs) != 2 || len(rt.renter.packMembers[first.name]) != 3 {
+		t.Error("packs are not being tracked correctly")
+	}
+	rt.renter.mu.RUnlock(id)
+
+	// Files that do not fit into a chunk are not packed.
+	upload("large", chunkSize)
+	id = rt.renter.mu.RLock()
+	if rt.renter.files["large"].pack != nil {
+		t.Error("large file was packed")
+	}
+	rt.renter.mu.RUnlock(id)
+
+	// Packed files cannot be shared.
+	if _, err := rt.renter.ShareFilesAscii([]string{"0"}); err != errSharePackedFile {
+		t.Error("expected errSharePackedFile, got", err)
+	}
+
+	// The packs and packed files should survive a reload.
+	id = rt.renter.mu.Lock()
+	err = rt.renter.load()
+	if err == nil && (rt.renter.files["1"].pack == nil || rt.renter.files["1"].pack.name != first.name || rt.renter.files["1"].packOffset != fileSize) {
+		t.Error("packed file was not loaded correctly")
+	}
+	first = rt.renter.packs[first.name]
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pack should only be collected once all of its files are deleted.
+	for i := 0; i < 3; i++ {
+		id = rt.renter.mu.RLock()
+		_, exists := rt.renter.packs[first.name]
+		rt.renter.mu.RUnlock(id)
+		if !exists {
+			t.Fatal("pack was collected while it still stored files")
+		}
+		if err := rt.renter.DeleteFile(strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id = rt.renter.mu.RLock()
+	_, exists := rt.renter.packs[first.name]
+	rt.renter.mu.RUnlock(id)
+	if exists {
+		t.Fatal("pack was not collected after all of its files were deleted")
+	}
+	if _, err := os.Stat(rt.renter.packPath(first.name)); !os.IsNotExist(err) {
+		t.Fatal("metadata of collected pack was not removed:", err)
+	}
+}
+
+// TestReadPackChunk checks that the chunk of a pack is assembled from the
+// local sources of its files, and that it cannot be assembled when a file
+// has no local source.
+func TestReadPackChunk(t *testing.T) {
+	dir := build.TempDir("renter", "TestReadPackChunk")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(source, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ec, _ := NewRSCode(1, 1)
+	p := newFile("pack", ec, pieceSize, 0)
+
+	members := []packMember{{repairPath: source, offset: 2, size: 3}}
+	chunk, err := readPackChunk(p, members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(chunk)) != p.chunkSize() || string(chunk[:5]) != "\x00\x00foo" {
+		t.Fatal("pack chunk was not assembled correctly:", chunk[:5])
+	}
+
+	// An archived file has no local source.
+	members = append(members, packMember{offset: 5, size: 3})
+	if _, err := readPackChunk(p, members); err != errPackSourceUnavailable {
+		t.Fatal("expected errPackSourceUnavailable, got", err)
+	}
+}
@@ -0,0 +1,131 @@
+package renter
+
+// The renter tracks how quickly each host serves the pieces that are
+// downloaded from it, and prefers the hosts that are expected to deliver a
+// piece soonest when it schedules downloads. With overdrive enabled, more
+// pieces of each chunk are requested than are needed to recover it. The chunk
+// is recovered from the first pieces to arrive; the downloads of its remaining
+// pieces are cancelled if they have not yet begun, and their data is
+// discarded if they have.
+//
+// The latency of a host is the time taken to complete a download request,
+// including connecting to the host if necessary, and its throughput is the
+// rate at which the data of each request arrived. Both are exponentially
+// weighted moving averages, so that they follow changes in the performance of
+// the host.
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// performanceDecay is the weight given to the previous average when a
+	// new measurement of the performance of a host is recorded.
+	performanceDecay = 0.8
+)
+
+var (
+	// errPieceCancelled is returned by a worker when the chunk that it
+	// was to download a piece of has already been recovered.
+	errPieceCancelled = errors.New("piece download was cancelled because the chunk has been recovered")
+)
+
+// hostPerformanceByAddress implements sort.Interface for a slice of
+// HostPerformanceInfo, sorting by the address of the host.
+type hostPerformanceByAddress []modules.HostPerformanceInfo
+
+func (hp hostPerformanceByAddress) Len() int           { return len(hp) }
+func (hp hostPerformanceByAddress) Less(i, j int) bool { return hp[i].NetAddress < hp[j].NetAddress }
+func (hp hostPerformanceByAddress) Swap(i, j int)      { hp[i], hp[j] = hp[j], hp[i] }
+
+// workersBySpeed implements sort.Interface for a slice of workers, sorting by
+// the estimated time that the host of each worker takes to deliver a piece.
+type workersBySpeed struct {
+	workers   []*worker
+	estimates map[string]time.Duration
+}
+
+func (ws workersBySpeed) Len() int      { return len(ws.workers) }
+func (ws workersBySpeed) Swap(i, j int) { ws.workers[i], ws.workers[j] = ws.workers[j], ws.workers[i] }
+func (ws workersBySpeed) Less(i, j int) bool {
+	return ws.estimates[ws.workers[i].id()] < ws.estimates[ws.workers[j].id()]
+}
+
+// movingAverage adds a sample to an exponentially weighted moving average. The
+// first sample becomes the average.
+func movingAverage(avg, sample uint64, first bool) uint64 {
+	if first {
+		return sample
+	}
+	return uint64(performanceDecay*float64(avg) + (1-performanceDecay)*float64(sample))
+}
+
+// managedRecordDownload records the outcome of a download of size bytes from
+// the host with public key hostKey, which took elapsed to complete.
+func (r *Renter) managedRecordDownload(hostKey types.SiaPublicKey, size uint64, elapsed time.Duration, err error) {
+	host, _ := r.hostDB.Host(hostKey)
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	info := r.performance[hostKey.String()]
+	info.HostPublicKey = hostKey
+	if host.NetAddress != "" {
+		info.NetAddress = host.NetAddress
+	}
+	switch {
+	case err == errPieceCancelled:
+		info.Cancelled++
+	case err != nil:
+		info.Failures++
+	default:
+		if elapsed <= 0 {
+			elapsed = time.Nanosecond
+		}
+		latency := uint64(elapsed / time.Millisecond)
+		throughput := size * uint64(time.Second) / uint64(elapsed)
+		info.Latency = movingAverage(info.Latency, latency, info.Downloads == 0)
+		info.Throughput = movingAverage(info.Throughput, throughput, info.Downloads == 0)
+		info.Downloads++
+		info.LastDownload = time.Now()
+	}
+	r.performance[hostKey.String()] = info
+}
+
+// estimatedDownloadTime returns the time that the host with public key
+// hostKey is expected to take to deliver size bytes. Hosts that have not yet
+// delivered any data are expected to take no time at all, so that they are
+// tried and measured.
+func (r *Renter) estimatedDownloadTime(hostKey types.SiaPublicKey, size uint64) time.Duration {
+	info, exists := r.performance[hostKey.String()]
+	if !exists || info.Downloads == 0 || info.Throughput == 0 {
+		return 0
+	}
+	return time.Duration(size * uint64(time.Second) / info.Throughput)
+}
+
+// sortWorkersBySpeed sorts workers so that the workers whose hosts are
+// expected to deliver a sector soonest come first.
+func (r *Renter) sortWorkersBySpeed(workers []*worker) {
+	estimates := make(map[string]time.Duration)
+	for _, w := range workers {
+		estimates[w.id()] = r.estimatedDownloadTime(w.hostKey, modules.SectorSize)
+	}
+	sort.Sort(workersBySpeed{workers, estimates})
+}
+
+// HostPerformance returns the performance of each host that the renter has
+// downloaded from.
+func (r *Renter) HostPerformance() []modules.HostPerformanceInfo {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	performance := make([]modules.HostPerformanceInfo, 0, len(r.performance))
+	for _, info := range r.performance {
+		performance = append(performance, info)
+	}
+	sort.Sort(hostPerformanceByAddress(performance))
+	return performance
+}
@@ -0,0 +1,167 @@
+package renter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/contractor"
+	"github.com/NebulousLabs/Sia/sync"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// addrHostDB is a hostDB that knows of every host, using the key of the host
+// as its address.
+type addrHostDB struct {
+	stubHostDB
+}
+
+func (addrHostDB) Host(pk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	var host modules.HostDBEntry
+	host.PublicKey = pk
+	host.NetAddress = modules.NetAddress(pk.Key)
+	return host, true
+}
+
+// TestRecordDownload checks that the performance of a host is recorded, and
+// that workers are sorted so that the fastest hosts come first.
+func TestRecordDownload(t *testing.T) {
+	r := &Renter{
+		hostDB:      addrHostDB{},
+		performance: make(map[string]modules.HostPerformanceInfo),
+		mu:          sync.New(modules.SafeMutexDelay, 1),
+	}
+	fast := types.SiaPublicKey{Key: []byte("fast")}
+	slow := types.SiaPublicKey{Key: []byte("slow")}
+	r.managedRecordDownload(fast, modules.SectorSize, time.Second, nil)
+	r.managedRecordDownload(fast, modules.SectorSize, time.Second, nil)
+	r.managedRecordDownload(slow, modules.SectorSize, 10*time.Second, nil)
+	r.managedRecordDownload(slow, modules.SectorSize, 0, errors.New("failed"))
+	r.managedRecordDownload(slow, 0, 0, errPieceCancelled)
+
+	perf := r.HostPerformance()
+	if len(perf) != 2 || perf[0].NetAddress != "fast" || perf[1].NetAddress != "slow" {
+		t.Fatal("wrong hosts:", perf)
+	}
+	if perf[0].Downloads != 2 || perf[0].Latency != 1000 || perf[0].Throughput != modules.SectorSize {
+		t.Error("wrong performance of fast host:", perf[0])
+	}
+	if perf[1].Downloads != 1 || perf[1].Failures != 1 || perf[1].Cancelled != 1 || perf[1].Latency != 10000 {
+		t.Error("wrong performance of slow host:", perf[1])
+	}
+
+	// Hosts that have not been measured come first, followed by the fastest
+	// host.
+	workers := []*worker{
+		{contractID: types.FileContractID{1}, hostKey: slow},
+		{contractID: types.FileContractID{2}, hostKey: fast},
+		{contractID: types.FileContractID{3}, hostKey: types.SiaPublicKey{Key: []byte("new")}},
+	}
+	r.sortWorkersBySpeed(workers)
+	if string(workers[0].hostKey.Key) != "new" || string(workers[1].hostKey.Key) != "fast" || string(workers[2].hostKey.Key) != "slow" {
+		t.Error("workers were not sorted by speed:", workers[0].id(), workers[1].id(), workers[2].id())
+	}
+}
+
+// TestScheduleOverdrive checks that overdrive pieces are scheduled for a
+// chunk, but only as many as there are hosts to download them from.
+func TestScheduleOverdrive(t *testing.T) {
+	rsc, _ := NewRSCode(1, 4)
+	f := newFile("foo", rsc, 10, 10)
+	for i := 0; i < 3; i++ {
+		id := types.FileContractID{byte(i)}
+		f.contracts[id] = fileContract{
+			ID:            id,
+			HostPublicKey: types.SiaPublicKey{Key: []byte{byte(i)}},
+			Pieces:        []pieceData{{Chunk: 0, Piece: uint64(i)}},
+		}
+	}
+
+	tests := []struct {
+		overdrive int
+		pieces    int
+	}{
+		{0, 1},
+		{1, 2},
+		{5, 3},
+	}
+	for _, test := range tests {
+		r := &Renter{}
+		r.addDownloadToChunkQueue(newDownload(f, "/foo"))
+		ds := &downloadState{overdrive: test.overdrive}
+		r.managedScheduleNewChunks(ds)
+		if len(ds.incompleteChunks) != test.pieces || ds.activePieces != test.pieces {
+			t.Errorf("expected %v pieces to be scheduled with an overdrive of %v, got %v", test.pieces, test.overdrive, len(ds.incompleteChunks))
+		}
+	}
+}
+
+// blockingContractor is a contractor whose downloaders block until release is
+// closed.
+type blockingContractor struct {
+	stubContractor
+	release chan struct{}
+}
+
+func (bc blockingContractor) Downloader(types.FileContractID) (contractor.Downloader, error) {
+	return blockingDownloader(bc), nil
+}
+
+// blockingDownloader is a downloader whose transfers block until release is
+// closed.
+type blockingDownloader blockingContractor
+
+func (bd blockingDownloader) Sector(crypto.Hash) ([]byte, error) {
+	<-bd.release
+	return make([]byte, modules.SectorSize), nil
+}
+func (bd blockingDownloader) PartialSectors([]modules.DownloadAction) ([][]byte, error) {
+	<-bd.release
+	return nil, errors.New("partial sectors are not supported")
+}
+func (bd blockingDownloader) Segment(crypto.Hash, uint64) ([]byte, []crypto.Hash, error) {
+	<-bd.release
+	return nil, nil, errors.New("segments are not supported")
+}
+func (blockingDownloader) Close() error { return nil }
+
+// TestWorkerCancelPiece checks that a worker gives up on a piece that it is
+// downloading once the chunk of the piece has been recovered.
+func TestWorkerCancelPiece(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	r := &Renter{
+		hostContractor: blockingContractor{release: release},
+		hostDB:         addrHostDB{},
+		performance:    make(map[string]modules.HostPerformanceInfo),
+		mu:             sync.New(modules.SafeMutexDelay, 1),
+		tg:             new(sync.ThreadGroup),
+	}
+	w := &worker{
+		hostKey: types.SiaPublicKey{Key: []byte("slow")},
+		renter:  r,
+	}
+	cd := &chunkDownload{recoveredChan: make(chan struct{})}
+	resultChan := make(chan finishedDownload)
+	go w.download(downloadWork{chunkDownload: cd, resultChan: resultChan})
+
+	// The worker should not return while the piece is being downloaded.
+	select {
+	case <-resultChan:
+		t.Fatal("worker returned before the piece was downloaded")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Recovering the chunk should cancel the piece.
+	close(cd.recoveredChan)
+	select {
+	case fd := <-resultChan:
+		if fd.err != errPieceCancelled {
+			t.Fatal("expected the piece to be cancelled, got", fd.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not give up on the piece after the chunk was recovered")
+	}
+}
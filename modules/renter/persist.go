@@ -9,8 +9,11 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
@@ -20,6 +23,7 @@ import (
 const (
 	PersistFilename = "renter.json"
 	ShareExtension  = ".sia"
+	downloadsFile   = "downloads.json"
 	logFile         = modules.RenterDir + ".log"
 )
 
@@ -29,15 +33,56 @@ var (
 	ErrBadFile        = errors.New("not a .sia file")
 	ErrIncompatible   = errors.New("file is not compatible with current version")
 
+	// errUnresolvedHosts is returned when saving or importing a file that
+	// was decoded from a version 0.4 .sia file, if the hosts of some of its
+	// contracts have not been found.
+	errUnresolvedHosts = errors.New("the hosts of some of the file's contracts could not be found")
+
 	shareHeader  = [15]byte{'S', 'i', 'a', ' ', 'S', 'h', 'a', 'r', 'e', 'd', ' ', 'F', 'i', 'l', 'e'}
-	shareVersion = "0.4"
+	shareVersion = "0.5"
+
+	// COMPATv1.1.0 - .sia files of version 0.4 encode the erasure code as the
+	// name and parameters of a Reed-Solomon code, identify the host of each
+	// contract by its address instead of its public key, encode pieces
+	// without the Unavailable flag, and end after the contracts. Version 0.5
+	// made all of these changes at once, so a file is either entirely in the
+	// old format or entirely in the new one.
+	shareVersionCompatV04 = "0.4"
 
 	saveMetadata = persist.Metadata{
 		Header:  "Renter Persistence",
 		Version: "0.4",
 	}
+
+	downloadsMetadata = persist.Metadata{
+		Header:  "Renter Downloads",
+		Version: "1.0",
+	}
+
+	// downloadsSaveInterval is the minimum amount of time between saves of
+	// the download queue when the progress of a download changes.
+	downloadsSaveInterval = build.Select(build.Var{
+		Standard: time.Second * 10,
+		Dev:      time.Second * 5,
+		Testing:  time.Millisecond * 100,
+	}).(time.Duration)
 )
 
+// A persistedDownload is the on-disk record of an unfinished download to a
+// file. FinishedChunks records which chunks have already been written to the
+// destination, so that they are not downloaded again when the download is
+// resumed.
+type persistedDownload struct {
+	ID             string
+	SiaPath        string
+	Destination    string
+	Offset         uint64
+	Length         uint64
+	FinishedChunks []bool
+	Paused         bool
+	StartTime      time.Time
+}
+
 // MarshalSia implements the encoding.SiaMarshaller interface, writing the
 // file data to w.
 func (f *file) MarshalSia(w io.Writer) error {
@@ -62,21 +107,9 @@ func (f *file) MarshalSia(w io.Writer) error {
 	}
 
 	// encode erasureCode
-	switch code := f.erasureCode.(type) {
-	case *rsCode:
-		err = enc.EncodeAll(
-			"Reed-Solomon",
-			uint64(code.dataPieces),
-			uint64(code.numPieces-code.dataPieces),
-		)
-		if err != nil {
-			return err
-		}
-	default:
-		if build.DEBUG {
-			panic("unknown erasure code")
-		}
-		return errors.New("unknown erasure code")
+	err = enc.EncodeAll(f.erasureCode.Type(), f.erasureCode.Params())
+	if err != nil {
+		return err
 	}
 	// encode contracts
 	if err := enc.Encode(uint64(len(f.contracts))); err != nil {
@@ -87,12 +120,23 @@ func (f *file) MarshalSia(w io.Writer) error {
 			return err
 		}
 	}
-	return nil
+	// encode the fields that version 0.5 appends to the file, in the order in
+	// which they were introduced: the content hashes of deduplicated chunks,
+	// the compression of the file with the offsets and hashes of its
+	// compressed chunks, the metadata, and the expiration height. Fields that
+	// are added later must likewise go at the end, behind a new version.
+	return enc.EncodeAll(f.chunkHashes, f.compression, f.chunkOffsets, f.compressedHashes, f.metadataEntries(), f.expireHeight)
 }
 
 // UnmarshalSia implements the encoding.SiaUnmarshaller interface,
 // reconstructing a file from the encoded bytes read from r.
 func (f *file) UnmarshalSia(r io.Reader) error {
+	return f.unmarshalSiaVersion(r, shareVersion)
+}
+
+// unmarshalSiaVersion reconstructs a file from bytes that were encoded by the
+// given version of the .sia format.
+func (f *file) unmarshalSiaVersion(r io.Reader, version string) error {
 	dec := encoding.NewDecoder(r)
 
 	// COMPATv0.4.3 - decode bytesUploaded and chunksUploaded into dummy vars.
@@ -112,57 +156,199 @@ func (f *file) UnmarshalSia(r io.Reader) error {
 		return err
 	}
 
+	// COMPATv1.1.0
+	if version == shareVersionCompatV04 {
+		return f.unmarshalSiaCompatV04(dec)
+	}
+
 	// decode erasure coder
-	var codeType string
-	if err := dec.Decode(&codeType); err != nil {
+	var codeType types.Specifier
+	var params []uint64
+	if err := dec.DecodeAll(&codeType, &params); err != nil {
 		return err
 	}
-	switch codeType {
-	case "Reed-Solomon":
-		var nData, nParity uint64
-		err = dec.DecodeAll(
-			&nData,
-			&nParity,
-		)
-		if err != nil {
+	f.erasureCode, err = NewErasureCoder(codeType, params)
+	if err != nil {
+		return build.ExtendErr("unable to create erasure code of type "+codeType.String(), err)
+	}
+
+	// decode contracts
+	var nContracts uint64
+	if err := dec.Decode(&nContracts); err != nil {
+		return err
+	}
+	f.contracts = make(map[types.FileContractID]fileContract)
+	var contract fileContract
+	for i := uint64(0); i < nContracts; i++ {
+		if err := dec.Decode(&contract); err != nil {
 			return err
 		}
-		rsc, err := NewRSCode(int(nData), int(nParity))
-		if err != nil {
-			return err
+		f.contracts[contract.ID] = contract
+	}
+
+	// decode the content hashes of deduplicated chunks, the compression, and
+	// the metadata
+	var entries []metadataEntry
+	var chunkHashes []crypto.Hash
+	if err := dec.DecodeAll(&chunkHashes, &f.compression, &f.chunkOffsets, &f.compressedHashes, &entries); err != nil {
+		return err
+	}
+	f.setChunkHashes(chunkHashes)
+	if len(entries) != 0 {
+		f.metadata = make(map[string]string, len(entries))
+		for _, e := range entries {
+			f.metadata[e.Key] = e.Value
 		}
-		f.erasureCode = rsc
-	default:
+	}
+
+	// decode the expiration height
+	return dec.Decode(&f.expireHeight)
+}
+
+// COMPATv1.1.0 - unmarshalSiaCompatV04 decodes the erasure code and the
+// contracts of a version 0.4 .sia file. The hosts of the contracts are
+// recorded in f.legacyAddrs, to be resolved by resolveHostKeys.
+func (f *file) unmarshalSiaCompatV04(dec *encoding.Decoder) error {
+	var codeType string
+	if err := dec.Decode(&codeType); err != nil {
+		return err
+	}
+	if codeType != "Reed-Solomon" {
 		return errors.New("unrecognized erasure code type: " + codeType)
 	}
+	var nData, nParity uint64
+	if err := dec.DecodeAll(&nData, &nParity); err != nil {
+		return err
+	}
+	rsc, err := NewRSCode(int(nData), int(nParity))
+	if err != nil {
+		return err
+	}
+	f.erasureCode = rsc
 
-	// decode contracts
 	var nContracts uint64
 	if err := dec.Decode(&nContracts); err != nil {
 		return err
 	}
 	f.contracts = make(map[types.FileContractID]fileContract)
-	var contract fileContract
+	f.legacyAddrs = make(map[types.FileContractID]modules.NetAddress)
 	for i := uint64(0); i < nContracts; i++ {
-		if err := dec.Decode(&contract); err != nil {
+		var compatContract fileContractV04
+		if err := dec.Decode(&compatContract); err != nil {
 			return err
 		}
+		contract := compatContract.convert()
 		f.contracts[contract.ID] = contract
+		f.legacyAddrs[contract.ID] = compatContract.IP
 	}
 	return nil
 }
 
+// COMPATv1.1.0 - fileContractV04 and pieceDataV04 are the encodings of
+// fileContract and pieceData used by version 0.4 of the .sia format.
+type (
+	fileContractV04 struct {
+		ID          types.FileContractID
+		IP          modules.NetAddress
+		Pieces      []pieceDataV04
+		WindowStart types.BlockHeight
+	}
+	pieceDataV04 struct {
+		Chunk      uint64
+		Piece      uint64
+		MerkleRoot crypto.Hash
+	}
+)
+
+// convert returns the fileContract described by a fileContractV04. None of
+// its pieces are marked unavailable, and the public key of the host is not
+// known, and must be resolved from its address.
+func (fc fileContractV04) convert() fileContract {
+	pieces := make([]pieceData, len(fc.Pieces))
+	for i, p := range fc.Pieces {
+		pieces[i] = pieceData{
+			Chunk:      p.Chunk,
+			Piece:      p.Piece,
+			MerkleRoot: p.MerkleRoot,
+		}
+	}
+	return fileContract{
+		ID:          fc.ID,
+		Pieces:      pieces,
+		WindowStart: fc.WindowStart,
+	}
+}
+
+// COMPATv1.1.0 - resolveHostKeys sets the public key of the host of each
+// contract of f that was decoded from a .sia file that identifies hosts by
+// their address. The host is found by the ID of the contract, or else by the
+// address of a contract or of a host in the hostdb. The contracts are only
+// changed once the hosts of all of them are found, as the addresses of the
+// hosts are lost when the file is saved. It returns true if the contracts of
+// f were changed.
+func (r *Renter) resolveHostKeys(f *file) bool {
+	if len(f.legacyAddrs) == 0 {
+		return false
+	}
+	byID := make(map[types.FileContractID]types.SiaPublicKey)
+	byAddr := make(map[modules.NetAddress]types.SiaPublicKey)
+	for _, host := range r.hostDB.AllHosts() {
+		byAddr[host.NetAddress] = host.PublicKey
+	}
+	for _, c := range r.hostContractor.Contracts() {
+		byID[c.ID] = c.HostPublicKey
+		byAddr[c.NetAddress] = c.HostPublicKey
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resolved := make(map[types.FileContractID]types.SiaPublicKey)
+	for id, addr := range f.legacyAddrs {
+		pk, ok := byID[id]
+		if !ok {
+			pk, ok = byAddr[addr]
+		}
+		if !ok {
+			r.log.Printf("WARN: could not find the host of contract %v of %v at %v", id, f.name, addr)
+			continue
+		}
+		resolved[id] = pk
+	}
+	if len(resolved) != len(f.legacyAddrs) {
+		return false
+	}
+	for id, pk := range resolved {
+		fc := f.contracts[id]
+		fc.HostPublicKey = pk
+		f.contracts[id] = fc
+	}
+	f.legacyAddrs = nil
+	return true
+}
+
 // saveFile saves a file to the renter directory.
 func (r *Renter) saveFile(f *file) error {
+	return saveFileAt(f, filepath.Join(r.persistDir, f.name+ShareExtension))
+}
+
+// saveFileAt saves a file to the specified path, creating any missing
+// directories.
+func saveFileAt(f *file, path string) error {
+	// COMPATv1.1.0 - the addresses of hosts that have not been resolved to
+	// their public keys cannot be encoded, so a file decoded from a version
+	// 0.4 .sia file keeps that encoding until all of its hosts are resolved.
+	if len(f.legacyAddrs) != 0 {
+		return errUnresolvedHosts
+	}
+
 	// Create directory structure specified in nickname.
-	fullPath := filepath.Join(r.persistDir, f.name+ShareExtension)
-	err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
 	if err != nil {
 		return err
 	}
 
 	// Open SafeFile handle.
-	handle, err := persist.NewSafeFile(filepath.Join(r.persistDir, f.name+ShareExtension))
+	handle, err := persist.NewSafeFile(path)
 	if err != nil {
 		return err
 	}
@@ -181,19 +367,148 @@ func (r *Renter) saveFile(f *file) error {
 // save stores the current renter data to disk.
 func (r *Renter) save() error {
 	data := struct {
-		Tracking map[string]trackedFile
-	}{r.tracking}
+		Tracking    map[string]trackedFile
+		Directories map[string]struct{}
+		Bandwidth   bandwidthLimits
+		Audits      map[string]modules.HostAuditInfo
+		Performance map[string]modules.HostPerformanceInfo
+		Overdrive   uint64
+		ChunkCache  uint64
+	}{r.tracking, r.dirs, r.bandwidth.limits(), r.audits, r.performance, r.overdrive, r.chunkCache.getMaxSize()}
 	return persist.SaveFile(saveMetadata, data, filepath.Join(r.persistDir, PersistFilename))
 }
 
 // saveSync stores the current renter data to disk and then syncs to disk.
 func (r *Renter) saveSync() error {
 	data := struct {
-		Tracking map[string]trackedFile
-	}{r.tracking}
+		Tracking    map[string]trackedFile
+		Directories map[string]struct{}
+		Bandwidth   bandwidthLimits
+		Audits      map[string]modules.HostAuditInfo
+		Performance map[string]modules.HostPerformanceInfo
+		Overdrive   uint64
+		ChunkCache  uint64
+	}{r.tracking, r.dirs, r.bandwidth.limits(), r.audits, r.performance, r.overdrive, r.chunkCache.getMaxSize()}
 	return persist.SaveFileSync(saveMetadata, data, filepath.Join(r.persistDir, PersistFilename))
 }
 
+// managedUpdateDownload records that the progress of d has changed. If d is a
+// download whose progress is persisted, the download queue is saved by
+// threadedSaveDownloads, so that the queue is not written to disk for every
+// chunk.
+func (r *Renter) managedUpdateDownload(d *download) {
+	if d.persisted() {
+		atomic.StoreUint32(&r.atomicDownloadsChanged, 1)
+	}
+}
+
+// managedSyncDownload saves the download queue right away if d is a download
+// whose progress is persisted. It is used for changes made by the user, such
+// as pausing a download.
+func (r *Renter) managedSyncDownload(d *download) {
+	if !d.persisted() {
+		return
+	}
+	if err := r.managedSaveDownloads(); err != nil {
+		r.log.Println("WARN: could not save the download queue:", err)
+	}
+}
+
+// threadedSaveDownloads saves the download queue whenever the progress of a
+// persisted download has changed, at most once every downloadsSaveInterval.
+func (r *Renter) threadedSaveDownloads() {
+	for {
+		select {
+		case <-time.After(downloadsSaveInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+		if atomic.LoadUint32(&r.atomicDownloadsChanged) == 0 {
+			continue
+		}
+		if err := r.managedSaveDownloads(); err != nil {
+			r.log.Println("WARN: could not save the download queue:", err)
+		}
+	}
+}
+
+// managedSaveDownloads saves the unfinished downloads to a file so that they
+// can be resumed after a restart. The file is written without holding the
+// renter's lock.
+func (r *Renter) managedSaveDownloads() error {
+	r.downloadsSaveMu.Lock()
+	defer r.downloadsSaveMu.Unlock()
+	atomic.StoreUint32(&r.atomicDownloadsChanged, 0)
+
+	lockID := r.mu.RLock()
+	downloads := []persistedDownload{}
+	for _, d := range r.downloadQueue {
+		if !d.persisted() {
+			continue
+		}
+		d.mu.Lock()
+		if !d.downloadComplete {
+			downloads = append(downloads, persistedDownload{
+				ID:             d.id,
+				SiaPath:        d.siapath,
+				Destination:    d.destinationString,
+				Offset:         d.offset - d.packOffset,
+				Length:         d.length,
+				FinishedChunks: append([]bool(nil), d.finishedChunks...),
+				Paused:         d.paused,
+				StartTime:      d.startTime,
+			})
+		}
+		d.mu.Unlock()
+	}
+	r.mu.RUnlock(lockID)
+
+	err := persist.SaveFile(downloadsMetadata, downloads, filepath.Join(r.persistDir, downloadsFile))
+	if err != nil {
+		atomic.StoreUint32(&r.atomicDownloadsChanged, 1)
+	}
+	return err
+}
+
+// loadDownloads adds the unfinished downloads that were saved before the
+// renter was shut down to the download queue. Downloads of files that no
+// longer exist are dropped. The downloads are handed to the download loop by
+// threadedResumeDownloads.
+func (r *Renter) loadDownloads() error {
+	var downloads []persistedDownload
+	err := persist.LoadFile(downloadsMetadata, &downloads, filepath.Join(r.persistDir, downloadsFile))
+	if err != nil {
+		return err
+	}
+	for _, pd := range downloads {
+		f, exists := r.files[pd.SiaPath]
+		if !exists || pd.Offset+pd.Length > f.size {
+			r.log.Println("WARN: dropping download of", pd.SiaPath, "- the file has changed since the download was queued")
+			continue
+		}
+		d := newFileSectionDownload(f, &downloadDestinationFile{path: pd.Destination}, pd.Destination, destinationTypeFile, pd.Offset, pd.Length)
+		if len(pd.FinishedChunks) != len(d.finishedChunks) {
+			r.log.Println("WARN: dropping download of", pd.SiaPath, "- the file has changed since the download was queued")
+			continue
+		}
+		d.id = pd.ID
+		d.paused = pd.Paused
+		d.startTime = pd.StartTime
+
+		// Restore the progress of the download. Chunks outside of the
+		// requested section are already marked as finished.
+		chunkData := d.reportedPieceSize * uint64(d.erasureCode.MinPieces())
+		for i, finished := range pd.FinishedChunks {
+			if finished && !d.finishedChunks[i] {
+				d.finishedChunks[i] = true
+				d.atomicDataReceived += chunkData
+			}
+		}
+		r.downloadQueue = append(r.downloadQueue, d)
+	}
+	return nil
+}
+
 // load fetches the saved renter data from disk.
 func (r *Renter) load() error {
 	// Recursively load all files found in renter directory. Errors
@@ -220,7 +535,7 @@ func (r *Renter) load() error {
 		defer file.Close()
 
 		// Load the file contents into the renter.
-		_, err = r.loadSharedFiles(file)
+		_, err = r.loadSharedFiles(file, true)
 		if err != nil {
 			r.log.Println("ERROR: could not load .sia file:", err)
 			return nil
@@ -231,10 +546,21 @@ func (r *Renter) load() error {
 		return err
 	}
 
+	// Load the packs that store the data of small files.
+	if err := r.loadPacks(); err != nil {
+		return err
+	}
+
 	// Load contracts, repair set, and entropy.
 	data := struct {
-		Tracking  map[string]trackedFile
-		Repairing map[string]string // COMPATv0.4.8
+		Tracking    map[string]trackedFile
+		Directories map[string]struct{}
+		Bandwidth   bandwidthLimits
+		Audits      map[string]modules.HostAuditInfo
+		Performance map[string]modules.HostPerformanceInfo
+		Overdrive   uint64
+		ChunkCache  uint64
+		Repairing   map[string]string // COMPATv0.4.8
 	}{}
 	err = persist.LoadFile(saveMetadata, &data, filepath.Join(r.persistDir, PersistFilename))
 	if err != nil {
@@ -243,8 +569,29 @@ func (r *Renter) load() error {
 	if data.Tracking != nil {
 		r.tracking = data.Tracking
 	}
+	if data.Directories != nil {
+		r.dirs = data.Directories
+	}
+	r.dirIndex = newDirIndex(r.files, r.dirs)
+	if data.Audits != nil {
+		r.audits = data.Audits
+	}
+	if data.Performance != nil {
+		r.performance = data.Performance
+	}
+	r.overdrive = data.Overdrive
+	r.chunkCache.setMaxSize(data.ChunkCache)
+	r.bandwidth.setLimits(data.Bandwidth)
 
-	return nil
+	// Load the archived files, which must be loaded before the packs are
+	// linked so that packs still storing archived files are kept.
+	if err := r.loadArchive(); err != nil {
+		return err
+	}
+	r.linkPackedFiles()
+
+	// Load the record of the most recent backup stored on the hosts.
+	return r.loadBackup()
 }
 
 // shareFiles writes the specified files to w. First a header is written,
@@ -298,6 +645,9 @@ func (r *Renter) ShareFiles(nicknames []string, shareDest string) error {
 		if !exists {
 			return ErrUnknownPath
 		}
+		if f.pack != nil {
+			return errSharePackedFile
+		}
 		files[i] = f
 	}
 
@@ -322,6 +672,9 @@ func (r *Renter) ShareFilesAscii(nicknames []string) (string, error) {
 		if !exists {
 			return "", ErrUnknownPath
 		}
+		if f.pack != nil {
+			return "", errSharePackedFile
+		}
 		files[i] = f
 	}
 
@@ -334,9 +687,9 @@ func (r *Renter) ShareFilesAscii(nicknames []string) (string, error) {
 	return buf.String(), nil
 }
 
-// loadSharedFiles reads .sia data from reader and registers the contained
-// files in the renter. It returns the nicknames of the loaded files.
-func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
+// readSharedFiles reads .sia data from reader and returns the contained
+// files.
+func readSharedFiles(reader io.Reader) ([]*file, error) {
 	// read header
 	var header [15]byte
 	var version string
@@ -350,7 +703,7 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 		return nil, err
 	} else if header != shareHeader {
 		return nil, ErrBadFile
-	} else if version != shareVersion {
+	} else if version != shareVersion && version != shareVersionCompatV04 {
 		return nil, ErrIncompatible
 	}
 
@@ -359,18 +712,42 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	dec := encoding.NewDecoder(unzip)
 
 	// Read each file.
 	files := make([]*file, numFiles)
 	for i := range files {
 		files[i] = new(file)
-		err := dec.Decode(files[i])
+		err := files[i].unmarshalSiaVersion(unzip, version)
 		if err != nil {
 			return nil, err
 		}
+	}
+	return files, nil
+}
+
+// loadSharedFiles reads .sia data from reader and registers the contained
+// files in the renter. It returns the nicknames of the loaded files. If
+// persisted is set, the files are loaded from the renter directory, and are
+// only saved again if the hosts of their contracts were resolved. Otherwise
+// the files are imported, and are rejected unless all of their hosts are
+// known.
+func (r *Renter) loadSharedFiles(reader io.Reader, persisted bool) ([]string, error) {
+	files, err := readSharedFiles(reader)
+	if err != nil {
+		return nil, err
+	}
 
-		// Make sure the file's name does not conflict with existing files.
+	// COMPATv1.1.0 - resolve the hosts of files in the version 0.4 format.
+	resolved := make([]bool, len(files))
+	for i, f := range files {
+		resolved[i] = r.resolveHostKeys(f)
+		if !persisted && len(f.legacyAddrs) != 0 {
+			return nil, errUnresolvedHosts
+		}
+	}
+
+	// Make sure the names of the files do not conflict with existing files.
+	for i := range files {
 		dupCount := 0
 		origName := files[i].name
 		for {
@@ -384,14 +761,19 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 	}
 
 	// Add files to renter.
-	names := make([]string, numFiles)
+	names := make([]string, len(files))
 	for i, f := range files {
-		r.files[f.name] = f
+		r.addFileEntry(f.name, f)
 		names[i] = f.name
 	}
-	// Save the files.
 	for _, f := range files {
-		r.saveFile(f)
+		r.linkDedupChunks(f)
+	}
+	// Save the files.
+	for i, f := range files {
+		if !persisted || resolved[i] {
+			r.saveFile(f)
+		}
 	}
 
 	return names, nil
@@ -412,11 +794,23 @@ func (r *Renter) initPersist() error {
 		return err
 	}
 
+	// Empty the chunk cache, as its index is not persisted.
+	err = r.chunkCache.init(filepath.Join(r.persistDir, chunkCacheDir))
+	if err != nil {
+		return err
+	}
+
 	// Load the prior persistence structures.
 	err = r.load()
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+
+	// Restore the unfinished downloads.
+	err = r.loadDownloads()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
@@ -431,7 +825,7 @@ func (r *Renter) LoadSharedFiles(filename string) ([]string, error) {
 		return nil, err
 	}
 	defer file.Close()
-	return r.loadSharedFiles(file)
+	return r.loadSharedFiles(file, false)
 }
 
 // LoadSharedFilesAscii loads an ASCII-encoded .sia file into the renter. It
@@ -441,5 +835,5 @@ func (r *Renter) LoadSharedFilesAscii(asciiSia string) ([]string, error) {
 	defer r.mu.Unlock(lockID)
 
 	dec := base64.NewDecoder(base64.URLEncoding, bytes.NewBufferString(asciiSia))
-	return r.loadSharedFiles(dec)
+	return r.loadSharedFiles(dec, false)
 }
@@ -3,14 +3,19 @@ package renter
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // newTestingFile initializes a file object with random parameters.
@@ -22,11 +27,13 @@ func newTestingFile() *file {
 	rsc, _ := NewRSCode(nData+1, nParity+1)
 
 	return &file{
-		name:        "testfile-" + strconv.Itoa(int(data[0])),
-		size:        encoding.DecUint64(data[1:5]),
-		masterKey:   key,
-		erasureCode: rsc,
-		pieceSize:   encoding.DecUint64(data[6:8]),
+		name:         "testfile-" + strconv.Itoa(int(data[0])),
+		size:         encoding.DecUint64(data[1:5]),
+		masterKey:    key,
+		erasureCode:  rsc,
+		pieceSize:    encoding.DecUint64(data[6:8]),
+		metadata:     map[string]string{"owner": "alice", "tag": strconv.Itoa(int(data[0]))},
+		expireHeight: types.BlockHeight(data[5]),
 	}
 }
 
@@ -47,6 +54,15 @@ func equalFiles(f1, f2 *file) error {
 	if f1.pieceSize != f2.pieceSize {
 		return fmt.Errorf("pieceSizes do not match: %v %v", f1.pieceSize, f2.pieceSize)
 	}
+	if !reflect.DeepEqual(f1.metadata, f2.metadata) {
+		return fmt.Errorf("metadata does not match: %v %v", f1.metadata, f2.metadata)
+	}
+	if f1.expireHeight != f2.expireHeight {
+		return fmt.Errorf("expiration heights do not match: %v %v", f1.expireHeight, f2.expireHeight)
+	}
+	if f1.erasureCode.Type() != f2.erasureCode.Type() || !reflect.DeepEqual(f1.erasureCode.Params(), f2.erasureCode.Params()) {
+		return fmt.Errorf("erasure codes do not match: %v%v %v%v", f1.erasureCode.Type(), f1.erasureCode.Params(), f2.erasureCode.Type(), f2.erasureCode.Params())
+	}
 	return nil
 }
 
@@ -69,6 +85,40 @@ func TestFileMarshalling(t *testing.T) {
 	}
 }
 
+// TestFileMarshallingErasureCodes checks that the type and parameters of the
+// erasure code of a file are persisted.
+func TestFileMarshallingErasureCodes(t *testing.T) {
+	rsc, _ := NewRSCode(3, 2)
+	rc, _ := NewReplicationCode(3)
+	lrc, _ := NewLRCode(4, 2, 2)
+	for _, ec := range []modules.ErasureCoder{rsc, rc, lrc} {
+		savedFile := newTestingFile()
+		savedFile.erasureCode = ec
+		buf := new(bytes.Buffer)
+		if err := savedFile.MarshalSia(buf); err != nil {
+			t.Fatal(err)
+		}
+		loadedFile := new(file)
+		if err := loadedFile.UnmarshalSia(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := equalFiles(savedFile, loadedFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Files with an unregistered erasure code cannot be loaded.
+	savedFile := newTestingFile()
+	buf := new(bytes.Buffer)
+	savedFile.MarshalSia(buf)
+	b := buf.Bytes()
+	i := bytes.Index(b, modules.ErasureCodeReedSolomon[:])
+	copy(b[i:], "Unknown")
+	if err := new(file).UnmarshalSia(bytes.NewReader(b)); err == nil {
+		t.Fatal("file with an unknown erasure code was loaded")
+	}
+}
+
 // TestFileShareLoad tests the sharing/loading functions of the renter.
 func TestFileShareLoad(t *testing.T) {
 	if testing.Short() {
@@ -83,7 +133,7 @@ func TestFileShareLoad(t *testing.T) {
 	// Create a file and add it to the renter.
 	savedFile := newTestingFile()
 	id := rt.renter.mu.Lock()
-	rt.renter.files[savedFile.name] = savedFile
+	rt.renter.addFileEntry(savedFile.name, savedFile)
 	rt.renter.mu.Unlock(id)
 
 	// Share .sia file to disk.
@@ -111,7 +161,7 @@ func TestFileShareLoad(t *testing.T) {
 
 	// Share and load multiple files.
 	savedFile2 := newTestingFile()
-	rt.renter.files[savedFile2.name] = savedFile2
+	rt.renter.addFileEntry(savedFile2.name, savedFile2)
 	path = filepath.Join(build.SiaTestingDir, "renter", "TestRenterShareLoad", "test2.sia")
 	err = rt.renter.ShareFiles([]string{savedFile.name, savedFile2.name}, path)
 	if err != nil {
@@ -153,7 +203,7 @@ func TestFileShareLoadASCII(t *testing.T) {
 	// Create a file and add it to the renter.
 	savedFile := newTestingFile()
 	id := rt.renter.mu.Lock()
-	rt.renter.files[savedFile.name] = savedFile
+	rt.renter.addFileEntry(savedFile.name, savedFile)
 	rt.renter.mu.Unlock(id)
 
 	ascii, err := rt.renter.ShareFilesAscii([]string{savedFile.name})
@@ -229,6 +279,47 @@ func TestRenterSaveLoad(t *testing.T) {
 	}
 }
 
+// TestRenterReservedDirRestart checks that a file that was created within the
+// directory of the chunk cache, before its name was reserved, survives a
+// restart of the renter, while the cached chunks are removed.
+func TestRenterReservedDirRestart(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newContractorTester("TestRenterReservedDirRestart", stubHostDB{}, stubContractor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	f := newTestingFile()
+	f.name = chunkCacheDir + "/x"
+	if err := rt.renter.saveFile(f); err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.chunkCache.setMaxSize(10)
+	rt.renter.chunkCache.put(f.masterKey, 0, []byte("foo"))
+	if err := rt.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := newRenter(rt.cs, rt.tpool, rt.wallet, stubHostDB{}, stubContractor{}, rt.renter.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := equalFiles(f, r.files[f.name]); err != nil {
+		t.Fatal("file in the chunk cache directory did not survive a restart:", err)
+	}
+	cached, err := filepath.Glob(filepath.Join(r.persistDir, chunkCacheDir, "*"+chunkCacheExtension))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 0 {
+		t.Error("cached chunks were not removed on restart:", cached)
+	}
+}
+
 // TestRenterPaths checks that the renter properly handles nicknames
 // containing the path separator ("/").
 func TestRenterPaths(t *testing.T) {
@@ -315,3 +406,124 @@ func TestSiafileCompatibility(t *testing.T) {
 		t.Fatal("nickname not loaded properly:", names)
 	}
 }
+
+// hostKeyHostDB is a hostDB that knows of a fixed set of hosts.
+type hostKeyHostDB struct {
+	stubHostDB
+	hosts []modules.HostDBEntry
+}
+
+func (hdb hostKeyHostDB) AllHosts() []modules.HostDBEntry { return hdb.hosts }
+
+// hostKeyContractor is a hostContractor with a fixed set of contracts.
+type hostKeyContractor struct {
+	stubContractor
+	contracts []modules.RenterContract
+}
+
+func (hc hostKeyContractor) Contracts() []modules.RenterContract { return hc.contracts }
+
+func (hc hostKeyContractor) Contract(hostKey types.SiaPublicKey) (modules.RenterContract, bool) {
+	for _, c := range hc.contracts {
+		if c.HostPublicKey.String() == hostKey.String() {
+			return c, true
+		}
+	}
+	return modules.RenterContract{}, false
+}
+
+// TestSiafileCompatV04Hosts checks that the hosts of the contracts of a
+// version 0.4 .sia file, which are identified by their address, are resolved
+// to their public keys, and that the file is not saved until all of them are
+// resolved.
+func TestSiafileCompatV04Hosts(t *testing.T) {
+	// Encode a file with three contracts in version 0.4 of the .sia format.
+	f := newTestingFile()
+	f.metadata = nil
+	f.expireHeight = 0
+	rsc := f.erasureCode.(*rsCode)
+	buf := new(bytes.Buffer)
+	enc := encoding.NewEncoder(buf)
+	enc.EncodeAll(f.name, f.size, f.masterKey, f.pieceSize, f.mode, uint64(0), uint64(0))
+	enc.EncodeAll("Reed-Solomon", uint64(rsc.dataPieces), uint64(rsc.numPieces-rsc.dataPieces))
+	enc.Encode(uint64(3))
+	for i, addr := range []modules.NetAddress{"foo:1234", "bar:1234", "baz:1234"} {
+		enc.Encode(fileContractV04{
+			ID:     types.FileContractID{byte(i)},
+			IP:     addr,
+			Pieces: []pieceDataV04{{Chunk: 0, Piece: uint64(i)}},
+		})
+	}
+
+	loaded := new(file)
+	if err := loaded.unmarshalSiaVersion(buf, shareVersionCompatV04); err != nil {
+		t.Fatal(err)
+	}
+	if err := equalFiles(f, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.contracts) != 3 || len(loaded.legacyAddrs) != 3 {
+		t.Fatal("wrong contracts:", loaded.contracts, loaded.legacyAddrs)
+	}
+
+	// The host of the first contract has moved, but is found by the ID of
+	// the contract. The host of the second contract is found by its address
+	// in the hostdb, and the host of the third contract is unknown.
+	fooKey := types.SiaPublicKey{Key: []byte("foo")}
+	barKey := types.SiaPublicKey{Key: []byte("bar")}
+	var bar modules.HostDBEntry
+	bar.PublicKey = barKey
+	bar.NetAddress = "bar:1234"
+	r := &Renter{
+		hostDB: hostKeyHostDB{hosts: []modules.HostDBEntry{bar}},
+		hostContractor: hostKeyContractor{contracts: []modules.RenterContract{{
+			ID:            types.FileContractID{0},
+			HostPublicKey: fooKey,
+			NetAddress:    "qux:1234",
+		}}},
+		log: persist.NewLogger(ioutil.Discard),
+	}
+	if r.resolveHostKeys(loaded) {
+		t.Fatal("file with an unknown host was changed")
+	}
+	for id, fc := range loaded.contracts {
+		if len(fc.HostPublicKey.Key) != 0 {
+			t.Error("host of contract", id, "was resolved before all hosts were found")
+		}
+	}
+	if len(loaded.legacyAddrs) != 3 {
+		t.Error("unresolved hosts lost their addresses:", loaded.legacyAddrs)
+	}
+	path := filepath.Join(build.TempDir("renter", "TestSiafileCompatV04Hosts"), "foo"+ShareExtension)
+	if err := saveFileAt(loaded, path); err != errUnresolvedHosts {
+		t.Error("expected errUnresolvedHosts, got", err)
+	}
+
+	// Once the third host is known, all of the hosts are resolved.
+	bazKey := types.SiaPublicKey{Key: []byte("baz")}
+	var baz modules.HostDBEntry
+	baz.PublicKey = bazKey
+	baz.NetAddress = "baz:1234"
+	r.hostDB = hostKeyHostDB{hosts: []modules.HostDBEntry{bar, baz}}
+	if !r.resolveHostKeys(loaded) {
+		t.Fatal("hosts were not resolved")
+	}
+	if pk := loaded.contracts[types.FileContractID{0}].HostPublicKey; pk.String() != fooKey.String() {
+		t.Error("moved host was not resolved by contract ID:", pk.String())
+	}
+	if pk := loaded.contracts[types.FileContractID{1}].HostPublicKey; pk.String() != barKey.String() {
+		t.Error("host was not resolved by address:", pk.String())
+	}
+	if pk := loaded.contracts[types.FileContractID{2}].HostPublicKey; pk.String() != bazKey.String() {
+		t.Error("host was not resolved by address:", pk.String())
+	}
+	if len(loaded.legacyAddrs) != 0 {
+		t.Error("resolved hosts are still recorded as unresolved:", loaded.legacyAddrs)
+	}
+	if err := saveFileAt(loaded, path); err != nil {
+		t.Error(err)
+	}
+	if r.resolveHostKeys(loaded) {
+		t.Error("resolved file was changed again")
+	}
+}
@@ -12,10 +12,16 @@ import (
 
 // A Downloader retrieves sectors by calling the download RPC on a host.
 // Downloaders are NOT thread- safe; calls to Sector must be serialized.
+//
+// Each method returns the contract as of the last revision, even if the
+// download fails after the revision was signed, so that the caller can
+// persist it.
 type Downloader struct {
-	host     modules.HostDBEntry
-	contract modules.RenterContract // updated after each revision
-	conn     net.Conn
+	host          modules.HostDBEntry
+	allowance     modules.Allowance
+	contract      modules.RenterContract // updated after each revision
+	conn          net.Conn
+	noRangeProofs bool // set once the host answers without a range proof
 
 	SaveFn revisionSaver
 }
@@ -24,21 +30,126 @@ type Downloader struct {
 // the underlying contract to pay the host proportionally to the data
 // retrieve.
 func (hd *Downloader) Sector(root crypto.Hash) (modules.RenterContract, []byte, error) {
+	payload, err := hd.download([]modules.DownloadAction{{
+		MerkleRoot: root,
+		Offset:     0,
+		Length:     modules.SectorSize,
+	}}, modules.SectorSize+16)
+	if err != nil {
+		return hd.contract, nil, err
+	}
+	sector := payload[0]
+	if uint64(len(sector)) != modules.SectorSize {
+		return hd.contract, nil, errors.New("host did not send enough sector data")
+	} else if crypto.MerkleRoot(sector) != root {
+		return hd.contract, nil, errors.New("host sent bad sector data")
+	}
+	return hd.contract, sector, nil
+}
+
+// PartialSectors retrieves sections of sectors, revising the underlying
+// contract to pay the host only for the requested bytes. The offset and
+// length of each action must be aligned to crypto.SegmentSize, and every
+// section is verified against the Merkle root of its sector using a range
+// proof supplied by the host. modules.ErrNoRangeProof is returned if the host
+// does not support range proofs. Only the first such request is sent to the
+// host; later requests are rejected before the host is paid.
+func (hd *Downloader) PartialSectors(actions []modules.DownloadAction) (modules.RenterContract, [][]byte, error) {
+	if hd.noRangeProofs {
+		return hd.contract, nil, modules.ErrNoRangeProof
+	}
+	var maxLen uint64
+	for _, action := range actions {
+		if !modules.IsRangeProofRequest(action) || action.Offset+action.Length > modules.SectorSize {
+			return hd.contract, nil, errors.New("invalid partial sector request")
+		}
+		maxLen += action.Length + modules.RangeProofLength(action) + 16
+	}
+
+	payload, err := hd.download(actions, maxLen)
+	if err != nil {
+		return hd.contract, nil, err
+	}
+	numSegments := modules.SectorSize / crypto.SegmentSize
+	sections := make([][]byte, len(actions))
+	for i, action := range actions {
+		data, proof, err := modules.DecodeRangeProof(action, payload[i])
+		if err == modules.ErrNoRangeProof {
+			hd.noRangeProofs = true
+		}
+		if err != nil {
+			return hd.contract, nil, err
+		}
+		start := action.Offset / crypto.SegmentSize
+		end := (action.Offset + action.Length) / crypto.SegmentSize
+		if !crypto.VerifyRangeProof(data, proof, numSegments, start, end, action.MerkleRoot) {
+			return hd.contract, nil, errors.New("host sent bad sector data")
+		}
+		sections[i] = data
+	}
+	return hd.contract, sections, nil
+}
+
+// Segment retrieves a single segment of a sector together with the Merkle
+// proof supplied by the host, revising the underlying contract to pay the
+// host for the segment. The proof is not verified; it is returned in the form
+// expected by crypto.VerifySegment so that the caller can check it.
+// modules.ErrNoRangeProof is returned if the host does not support range
+// proofs, as with PartialSectors.
+func (hd *Downloader) Segment(root crypto.Hash, index uint64) (modules.RenterContract, []byte, []crypto.Hash, error) {
+	if hd.noRangeProofs {
+		return hd.contract, nil, nil, modules.ErrNoRangeProof
+	}
+	numSegments := modules.SectorSize / crypto.SegmentSize
+	if index >= numSegments {
+		return hd.contract, nil, nil, errors.New("invalid segment request")
+	}
+	action := modules.DownloadAction{
+		MerkleRoot: root,
+		Offset:     index * crypto.SegmentSize,
+		Length:     crypto.SegmentSize,
+	}
+	payload, err := hd.download([]modules.DownloadAction{action}, action.Length+modules.RangeProofLength(action)+16)
+	if err != nil {
+		return hd.contract, nil, nil, err
+	}
+	segment, proof, err := modules.DecodeRangeProof(action, payload[0])
+	if err == modules.ErrNoRangeProof {
+		hd.noRangeProofs = true
+	}
+	if err != nil {
+		return hd.contract, nil, nil, err
+	}
+	hashSet, ok := crypto.SegmentProof(proof, numSegments, index)
+	if !ok {
+		return hd.contract, nil, nil, errors.New("host sent a malformed segment proof")
+	}
+	return hd.contract, segment, hashSet, nil
+}
+
+// download performs one iteration of the download loop, fetching the data
+// described by actions. maxLen is the maximum number of bytes that the host
+// is allowed to send.
+func (hd *Downloader) download(actions []modules.DownloadAction, maxLen uint64) ([][]byte, error) {
 	extendDeadline(hd.conn, modules.NegotiateDownloadTime)
 	defer extendDeadline(hd.conn, time.Hour) // reset deadline when finished
 
-	// calculate price
-	sectorPrice := hd.host.DownloadBandwidthPrice.Mul64(modules.SectorSize)
-	if hd.contract.RenterFunds().Cmp(sectorPrice) < 0 {
-		return modules.RenterContract{}, nil, errors.New("contract has insufficient funds to support download")
+	// calculate price, which includes the range proofs sent by the host
+	var totalLength uint64
+	for _, action := range actions {
+		totalLength += action.Length + modules.RangeProofLength(action)
+	}
+	price := hd.host.DownloadBandwidthPrice.Mul64(totalLength)
+	if hd.contract.RenterFunds().Cmp(price) < 0 {
+		return nil, errors.New("contract has insufficient funds to support download")
 	}
 
 	// create the download revision
-	rev := newDownloadRevision(hd.contract.LastRevision, sectorPrice)
+	rev := newDownloadRevision(hd.contract.LastRevision, price)
 
 	// initiate download by confirming host settings
-	if err := startDownload(hd.conn, hd.host); err != nil {
-		return modules.RenterContract{}, nil, err
+	if err := startDownload(hd.conn, hd.host, hd.allowance); err != nil {
+		return nil, err
 	}
 
 	// Before we continue, save the revision. Unexpected termination (e.g.
@@ -48,18 +159,14 @@ func (hd *Downloader) Sector(root crypto.Hash) (modules.RenterContract, []byte,
 	// we save the old revision as a fallback.
 	if hd.SaveFn != nil {
 		if err := hd.SaveFn(rev, hd.contract.MerkleRoots); err != nil {
-			return modules.RenterContract{}, nil, err
+			return nil, err
 		}
 	}
 
-	// send download action
-	err := encoding.WriteObject(hd.conn, []modules.DownloadAction{{
-		MerkleRoot: root,
-		Offset:     0,
-		Length:     modules.SectorSize,
-	}})
+	// send download actions
+	err := encoding.WriteObject(hd.conn, actions)
 	if err != nil {
-		return modules.RenterContract{}, nil, err
+		return nil, err
 	}
 
 	// send the revision to the host for approval
@@ -67,32 +174,25 @@ func (hd *Downloader) Sector(root crypto.Hash) (modules.RenterContract, []byte,
 	if err == modules.ErrStopResponse {
 		// if host gracefully closed, close our connection as well; this will
 		// cause the next download to fail. However, we must delay closing
-		// until we've finished downloading the sector.
+		// until we've finished downloading the data.
 		defer hd.conn.Close()
 	} else if err != nil {
-		return modules.RenterContract{}, nil, err
-	}
-
-	// read sector data, completing one iteration of the download loop
-	var sectors [][]byte
-	if err := encoding.ReadObject(hd.conn, &sectors, modules.SectorSize+16); err != nil {
-		return modules.RenterContract{}, nil, err
-	} else if len(sectors) != 1 {
-		return modules.RenterContract{}, nil, errors.New("host did not send enough sectors")
-	}
-	sector := sectors[0]
-	if uint64(len(sector)) != modules.SectorSize {
-		return modules.RenterContract{}, nil, errors.New("host did not send enough sector data")
-	} else if crypto.MerkleRoot(sector) != root {
-		return modules.RenterContract{}, nil, errors.New("host sent bad sector data")
+		return nil, err
 	}
 
 	// update contract and metrics
 	hd.contract.LastRevision = rev
 	hd.contract.LastRevisionTxn = signedTxn
-	hd.contract.DownloadSpending = hd.contract.DownloadSpending.Add(sectorPrice)
+	hd.contract.DownloadSpending = hd.contract.DownloadSpending.Add(price)
 
-	return hd.contract, sector, nil
+	// read the data, completing one iteration of the download loop
+	var payload [][]byte
+	if err := encoding.ReadObject(hd.conn, &payload, maxLen); err != nil {
+		return nil, err
+	} else if len(payload) != len(actions) {
+		return nil, errors.New("host did not send enough sectors")
+	}
+	return payload, nil
 }
 
 // Close cleanly terminates the download loop with the host and closes the
@@ -106,8 +206,9 @@ func (hd *Downloader) Close() error {
 }
 
 // NewDownloader initiates the download request loop with a host, and returns a
-// Downloader.
-func NewDownloader(host modules.HostDBEntry, contract modules.RenterContract) (*Downloader, error) {
+// Downloader. Downloads are rejected if the host's download bandwidth price
+// exceeds the maximum price of the allowance.
+func NewDownloader(host modules.HostDBEntry, contract modules.RenterContract, a modules.Allowance) (*Downloader, error) {
 	// check that contract has enough value to support a download
 	if len(contract.LastRevision.NewValidProofOutputs) != 2 {
 		return nil, errors.New("invalid contract")
@@ -136,8 +237,9 @@ func NewDownloader(host modules.HostDBEntry, contract modules.RenterContract) (*
 
 	// the host is now ready to accept revisions
 	return &Downloader{
-		contract: contract,
-		host:     host,
-		conn:     conn,
+		contract:  contract,
+		host:      host,
+		allowance: a,
+		conn:      conn,
 	}, nil
 }
@@ -0,0 +1,33 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestDownloaderNoRangeProofs checks that partial sector downloads from a
+// host that has answered without a range proof are rejected before the host
+// is paid.
+func TestDownloaderNoRangeProofs(t *testing.T) {
+	contract := modules.RenterContract{ID: types.FileContractID{1}}
+	contract.LastRevision.NewRevisionNumber = 3
+	// The connection is nil, so any attempt to contact the host panics.
+	hd := &Downloader{contract: contract, noRangeProofs: true}
+
+	actions := []modules.DownloadAction{{Offset: 0, Length: crypto.SegmentSize}}
+	c, _, err := hd.PartialSectors(actions)
+	if err != modules.ErrNoRangeProof {
+		t.Fatal("expected ErrNoRangeProof, got", err)
+	} else if c.ID != contract.ID || c.LastRevision.NewRevisionNumber != 3 {
+		t.Fatal("contract was revised:", c.LastRevision.NewRevisionNumber)
+	}
+	c, _, _, err = hd.Segment(crypto.Hash{}, 0)
+	if err != modules.ErrNoRangeProof {
+		t.Fatal("expected ErrNoRangeProof, got", err)
+	} else if c.LastRevision.NewRevisionNumber != 3 {
+		t.Fatal("contract was revised:", c.LastRevision.NewRevisionNumber)
+	}
+}
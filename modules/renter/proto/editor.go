@@ -36,8 +36,9 @@ func cachedMerkleRoot(roots []crypto.Hash) crypto.Hash {
 // A Editor modifies a Contract by calling the revise RPC on a host. It
 // Editors are NOT thread-safe; calls to Upload must happen in serial.
 type Editor struct {
-	conn net.Conn
-	host modules.HostDBEntry
+	conn      net.Conn
+	host      modules.HostDBEntry
+	allowance modules.Allowance
 
 	height   types.BlockHeight
 	contract modules.RenterContract // updated after each revision
@@ -60,7 +61,7 @@ func (he *Editor) Close() error {
 // Contract.
 func (he *Editor) runRevisionIteration(actions []modules.RevisionAction, rev types.FileContractRevision, newRoots []crypto.Hash) error {
 	// initiate revision
-	if err := startRevision(he.conn, he.host); err != nil {
+	if err := startRevision(he.conn, he.host, he.allowance); err != nil {
 		return err
 	}
 
@@ -237,8 +238,9 @@ func (he *Editor) Modify(oldRoot, newRoot crypto.Hash, offset uint64, newData []
 }
 
 // NewEditor initiates the contract revision process with a host, and returns
-// an Editor.
-func NewEditor(host modules.HostDBEntry, contract modules.RenterContract, currentHeight types.BlockHeight) (*Editor, error) {
+// an Editor. Revisions are rejected if the host's storage or upload bandwidth
+// price exceeds the maximum price of the allowance.
+func NewEditor(host modules.HostDBEntry, contract modules.RenterContract, currentHeight types.BlockHeight, a modules.Allowance) (*Editor, error) {
 	// check that contract has enough value to support an upload
 	if len(contract.LastRevision.NewValidProofOutputs) != 2 {
 		return nil, errors.New("invalid contract")
@@ -263,9 +265,10 @@ func NewEditor(host modules.HostDBEntry, contract modules.RenterContract, curren
 
 	// the host is now ready to accept revisions
 	return &Editor{
-		host:     host,
-		height:   currentHeight,
-		contract: contract,
-		conn:     conn,
+		host:      host,
+		allowance: a,
+		height:    currentHeight,
+		contract:  contract,
+		conn:      conn,
 	}, nil
 }
@@ -23,11 +23,16 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 	// extract vars from params, for convenience
 	host, filesize, startHeight, endHeight, refundAddress := params.Host, params.Filesize, params.StartHeight, params.EndHeight, params.RefundAddress
 
-	// create our key
-	ourSK, ourPK, err := crypto.GenerateKeyPair()
-	if err != nil {
-		return modules.RenterContract{}, err
-	}
+	// create our key, unless one was supplied
+	ourSK := params.SecretKey
+	var err error
+	if ourSK == (crypto.SecretKey{}) {
+		ourSK, _, err = crypto.GenerateKeyPair()
+		if err != nil {
+			return modules.RenterContract{}, err
+		}
+	}
+	ourPK := ourSK.PublicKey()
 	ourPublicKey := types.SiaPublicKey{
 		Algorithm: types.SignatureEd25519,
 		Key:       ourPK[:],
@@ -120,6 +125,9 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 	if !host.AcceptingContracts {
 		return modules.RenterContract{}, errors.New("host is not accepting contracts")
 	}
+	if err = params.Allowance.CheckPrices(host.HostExternalSettings); err != nil {
+		return modules.RenterContract{}, err
+	}
 
 	// allot time for negotiation
 	extendDeadline(conn, modules.NegotiateFileContractTime)
@@ -255,6 +263,7 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 
 	return modules.RenterContract{
 		FileContract:    fc,
+		HostPublicKey:   host.PublicKey,
 		ID:              fcid,
 		LastRevision:    initRevision,
 		LastRevisionTxn: revisionTxn,
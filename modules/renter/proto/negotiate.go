@@ -17,23 +17,33 @@ func extendDeadline(conn net.Conn, d time.Duration) { _ = conn.SetDeadline(time.
 
 // startRevision is run at the beginning of each revision iteration. It reads
 // the host's settings confirms that the values are acceptable, and writes an acceptance.
-func startRevision(conn net.Conn, host modules.HostDBEntry) error {
+// The revision is rejected if the host's storage or upload bandwidth price
+// exceeds the maximum price of the allowance.
+func startRevision(conn net.Conn, host modules.HostDBEntry, a modules.Allowance) error {
 	// verify the host's settings and confirm its identity
-	_, err := verifySettings(conn, host)
+	host, err := verifySettings(conn, host)
 	if err != nil {
 		return err
 	}
+	if err := a.CheckUploadPrices(host.HostExternalSettings); err != nil {
+		return modules.WriteNegotiationRejection(conn, err)
+	}
 	return modules.WriteNegotiationAcceptance(conn)
 }
 
 // startDownload is run at the beginning of each download iteration. It reads
 // the host's settings confirms that the values are acceptable, and writes an acceptance.
-func startDownload(conn net.Conn, host modules.HostDBEntry) error {
+// The download is rejected if the host's download bandwidth price exceeds the
+// maximum price of the allowance.
+func startDownload(conn net.Conn, host modules.HostDBEntry, a modules.Allowance) error {
 	// verify the host's settings and confirm its identity
-	_, err := verifySettings(conn, host)
+	host, err := verifySettings(conn, host)
 	if err != nil {
 		return err
 	}
+	if err := a.CheckDownloadPrices(host.HostExternalSettings); err != nil {
+		return modules.WriteNegotiationRejection(conn, err)
+	}
 	return modules.WriteNegotiationAcceptance(conn)
 }
 
@@ -36,7 +36,15 @@ type ContractParams struct {
 	StartHeight   types.BlockHeight
 	EndHeight     types.BlockHeight
 	RefundAddress types.UnlockHash
-	// TODO: add optional keypair
+
+	// SecretKey is the key that the renter uses to sign revisions of the
+	// contract. If it is not set, a random key is generated when forming a
+	// contract, and the key of the old contract is used when renewing one.
+	SecretKey crypto.SecretKey
+
+	// Allowance limits the prices that the renter will pay the host. The
+	// contract is not formed if the host's prices exceed them.
+	Allowance modules.Allowance
 }
 
 // A revisionSaver is called just before we send our revision signature to the host; this
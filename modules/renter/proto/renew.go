@@ -16,7 +16,19 @@ import (
 func Renew(contract modules.RenterContract, params ContractParams, txnBuilder transactionBuilder, tpool transactionPool) (modules.RenterContract, error) {
 	// extract vars from params, for convenience
 	host, filesize, startHeight, endHeight, refundAddress := params.Host, params.Filesize, params.StartHeight, params.EndHeight, params.RefundAddress
+	// the renewed contract uses the key supplied in params, if any
 	ourSK := contract.SecretKey
+	if params.SecretKey != (crypto.SecretKey{}) {
+		ourSK = params.SecretKey
+	}
+	ourPK := ourSK.PublicKey()
+	uc := types.UnlockConditions{
+		PublicKeys: []types.SiaPublicKey{{
+			Algorithm: types.SignatureEd25519,
+			Key:       ourPK[:],
+		}, host.PublicKey},
+		SignaturesRequired: 2,
+	}
 
 	// calculate cost to renter and cost to host
 	storageAllocation := host.StoragePrice.Mul64(filesize).Mul64(uint64(endHeight - startHeight))
@@ -54,7 +66,7 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 		WindowStart:    endHeight,
 		WindowEnd:      endHeight + host.WindowSize,
 		Payout:         payout,
-		UnlockHash:     contract.LastRevision.NewUnlockHash,
+		UnlockHash:     uc.UnlockHash(),
 		RevisionNumber: 0,
 		ValidProofOutputs: []types.SiacoinOutput{
 			// renter
@@ -114,6 +126,9 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 	if !host.AcceptingContracts {
 		return modules.RenterContract{}, errors.New("host is not accepting contracts")
 	}
+	if err = params.Allowance.CheckPrices(host.HostExternalSettings); err != nil {
+		return modules.RenterContract{}, err
+	}
 
 	// allot time for negotiation
 	extendDeadline(conn, modules.NegotiateRenewContractTime)
@@ -125,7 +140,7 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 	if err = encoding.WriteObject(conn, txnSet); err != nil {
 		return modules.RenterContract{}, errors.New("couldn't send the contract signed by us: " + err.Error())
 	}
-	if err = encoding.WriteObject(conn, ourSK.PublicKey()); err != nil {
+	if err = encoding.WriteObject(conn, ourPK); err != nil {
 		return modules.RenterContract{}, errors.New("couldn't send our public key: " + err.Error())
 	}
 
@@ -173,7 +188,7 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 	// create initial (no-op) revision, transaction, and signature
 	initRevision := types.FileContractRevision{
 		ParentID:          signedTxnSet[len(signedTxnSet)-1].FileContractID(0),
-		UnlockConditions:  contract.LastRevision.UnlockConditions,
+		UnlockConditions:  uc,
 		NewRevisionNumber: 1,
 
 		NewFileSize:           fc.FileSize,
@@ -249,6 +264,7 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 
 	return modules.RenterContract{
 		FileContract:    fc,
+		HostPublicKey:   host.PublicKey,
 		ID:              fcid,
 		LastRevision:    initRevision,
 		LastRevisionTxn: revisionTxn,
@@ -0,0 +1,86 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// SectorRoots requests the most recent revision of the contract with the
+// given ID from the host, along with the Merkle roots of the sectors covered
+// by the contract. It allows a renter that knows only the ID and the secret
+// key of a contract to recover the rest of the contract. The revision is
+// returned within a transaction that holds the signatures of both parties.
+func SectorRoots(host modules.HostDBEntry, id types.FileContractID, sk crypto.SecretKey) (types.Transaction, []crypto.Hash, error) {
+	conn, err := net.DialTimeout("tcp", string(host.NetAddress), 15*time.Second)
+	if err != nil {
+		return types.Transaction{}, nil, err
+	}
+	defer conn.Close()
+	extendDeadline(conn, modules.NegotiateSectorRootsTime)
+	if err := encoding.WriteObject(conn, modules.RPCSectorRoots); err != nil {
+		return types.Transaction{}, nil, errors.New("couldn't initiate RPC: " + err.Error())
+	}
+
+	// send contract ID
+	if err := encoding.WriteObject(conn, id); err != nil {
+		return types.Transaction{}, nil, errors.New("couldn't send contract ID: " + err.Error())
+	}
+	// read challenge
+	var challenge crypto.Hash
+	if err := encoding.ReadObject(conn, &challenge, 32); err != nil {
+		return types.Transaction{}, nil, errors.New("couldn't read challenge: " + err.Error())
+	}
+	// sign and return
+	sig, err := crypto.SignHash(challenge, sk)
+	if err != nil {
+		return types.Transaction{}, nil, err
+	} else if err := encoding.WriteObject(conn, sig); err != nil {
+		return types.Transaction{}, nil, errors.New("couldn't send challenge response: " + err.Error())
+	}
+	// read acceptance
+	if err := modules.ReadNegotiationAcceptance(conn); err != nil {
+		return types.Transaction{}, nil, errors.New("host did not accept sector roots request: " + err.Error())
+	}
+	// read last revision, signatures, and roots
+	var lastRevision types.FileContractRevision
+	var hostSignatures []types.TransactionSignature
+	var roots []crypto.Hash
+	if err := encoding.ReadObject(conn, &lastRevision, 2048); err != nil {
+		return types.Transaction{}, nil, errors.New("couldn't read last revision: " + err.Error())
+	}
+	if err := encoding.ReadObject(conn, &hostSignatures, 2048); err != nil {
+		return types.Transaction{}, nil, errors.New("couldn't read host signatures: " + err.Error())
+	}
+	numSectors := lastRevision.NewFileSize / modules.SectorSize
+	if err := encoding.ReadObject(conn, &roots, 8+numSectors*crypto.HashSize); err != nil {
+		return types.Transaction{}, nil, errors.New("couldn't read sector roots: " + err.Error())
+	}
+
+	// Check that the revision belongs to the contract and to our key, that it
+	// is signed by both parties, and that the roots match the revision.
+	pk := sk.PublicKey()
+	if lastRevision.ParentID != id {
+		return types.Transaction{}, nil, errors.New("host sent a revision of a different contract")
+	} else if len(lastRevision.UnlockConditions.PublicKeys) != 2 || !bytes.Equal(lastRevision.UnlockConditions.PublicKeys[0].Key, pk[:]) {
+		return types.Transaction{}, nil, errors.New("unlock conditions do not match")
+	} else if cachedMerkleRoot(roots) != lastRevision.NewFileMerkleRoot {
+		return types.Transaction{}, nil, errors.New("sector roots do not match the revision")
+	}
+	// NOTE: we can fake the blockheight here because it doesn't affect
+	// verification; it just needs to be above the fork height and below the
+	// contract expiration.
+	if err := modules.VerifyFileContractRevisionTransactionSignatures(lastRevision, hostSignatures, lastRevision.NewWindowStart-1); err != nil {
+		return types.Transaction{}, nil, err
+	}
+	return types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{lastRevision},
+		TransactionSignatures: hostSignatures,
+	}, roots, nil
+}
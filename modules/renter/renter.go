@@ -9,7 +9,9 @@ package renter
 
 import (
 	"errors"
+	"sync/atomic"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/contractor"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
@@ -23,6 +25,7 @@ var (
 	errNilCS         = errors.New("cannot create renter with nil consensus set")
 	errNilTpool      = errors.New("cannot create renter with nil transaction pool")
 	errNilHdb        = errors.New("cannot create renter with nil hostdb")
+	errNilWallet     = errors.New("cannot create renter with nil wallet")
 )
 
 // A hostDB is a database of hosts that the renter can use for figuring out who
@@ -42,8 +45,28 @@ type hostDB interface {
 	// Close closes the hostdb.
 	Close() error
 
-	// Host returns the HostDBEntry for a given host.
-	Host(modules.NetAddress) (modules.HostDBEntry, bool)
+	// Filter returns the filter that restricts the hosts that the renter
+	// forms contracts with.
+	Filter() modules.HostDBFilter
+
+	// Host returns the HostDBEntry of the host with the given public key.
+	Host(types.SiaPublicKey) (modules.HostDBEntry, bool)
+
+	// ScoreBreakdown returns the score of a host and the contribution of
+	// each factor to it.
+	ScoreBreakdown(modules.HostDBEntry) modules.HostScoreBreakdown
+
+	// ScoreWeights returns the weights of the factors that make up the score
+	// of a host.
+	ScoreWeights() modules.HostScoreWeights
+
+	// SetFilter sets the filter that restricts the hosts that the renter
+	// forms contracts with.
+	SetFilter(modules.HostDBFilter) error
+
+	// SetScoreWeights sets the weights of the factors that make up the
+	// score of a host.
+	SetScoreWeights(modules.HostScoreWeights) error
 }
 
 // A hostContractor negotiates, revises, renews, and provides access to file
@@ -58,8 +81,9 @@ type hostContractor interface {
 	// Allowance returns the current allowance
 	Allowance() modules.Allowance
 
-	// Contract returns the latest contract formed with the specified host.
-	Contract(modules.NetAddress) (modules.RenterContract, bool)
+	// Contract returns the latest contract formed with the host with the
+	// specified public key.
+	Contract(types.SiaPublicKey) (modules.RenterContract, bool)
 
 	// Contracts returns the contracts formed by the contractor.
 	Contracts() []modules.RenterContract
@@ -75,9 +99,24 @@ type hostContractor interface {
 	// IsOffline reports whether the specified host is considered offline.
 	IsOffline(types.FileContractID) bool
 
+	// ShouldReplace reports whether the data stored with the specified host
+	// should be moved to other hosts.
+	ShouldReplace(types.FileContractID) bool
+
 	// Downloader creates a Downloader from the specified contract ID,
 	// allowing the retrieval of sectors.
 	Downloader(types.FileContractID) (contractor.Downloader, error)
+
+	// RecoverContracts recovers the contracts that were formed using keys
+	// derived from the wallet seed.
+	RecoverContracts() ([]modules.RenterContract, error)
+
+	// RestoreContracts recovers the contracts of a backup, along with the
+	// allowance and current period if no allowance has been set.
+	RestoreContracts(modules.Allowance, types.BlockHeight, []modules.RenterContract) error
+
+	// SetRetainer sets the Retainer that decides which contracts are renewed.
+	SetRetainer(contractor.Retainer)
 }
 
 // A trackedFile contains metadata about files being tracked by the Renter.
@@ -87,6 +126,11 @@ type hostContractor interface {
 type trackedFile struct {
 	// location of original file on disk
 	RepairPath string
+
+	// name of the pack that stores the file's data, and the offset of the
+	// data within the pack, if the file is packed with other small files
+	Pack       string
+	PackOffset uint64
 }
 
 // A Renter is responsible for tracking all of the files that a user has
@@ -96,8 +140,33 @@ type Renter struct {
 	//
 	// tracking contains a list of files that the user intends to maintain. By
 	// default, files loaded through sharing are not maintained by the user.
-	files    map[string]*file
-	tracking map[string]trackedFile // map from nickname to metadata
+	//
+	// dirs contains the set of directories that have been created explicitly.
+	// Directories that contain files exist implicitly, and are not included.
+	//
+	// packs contains the files that store the data of packed small files,
+	// keyed by the name of the pack. packMembers contains the set of files
+	// stored in each pack, and openPacks contains the packs that files are
+	// still being added to, keyed by erasure code.
+	//
+	// dedupChunks is the index of the chunks of deduplicated files, keyed by
+	// the hash of their content, erasure code and piece size.
+	//
+	// versions contains the earlier versions of each file, oldest first,
+	// keyed by the path of the file, and snapshots contains the snapshots,
+	// keyed by name. archived contains every file that is kept by a version
+	// or a snapshot.
+	archived    map[*file]archivedFile
+	dedupChunks map[crypto.Hash]*dedupChunk
+	dirIndex    dirIndex
+	dirs        map[string]struct{}
+	files       map[string]*file
+	openPacks   map[string]*openPack
+	packMembers map[string]map[*file]struct{}
+	packs       map[string]*file
+	snapshots   map[string]*snapshot
+	tracking    map[string]trackedFile // map from nickname to metadata
+	versions    map[string][]fileVersion
 
 	// Work management.
 	//
@@ -107,11 +176,54 @@ type Renter struct {
 	//
 	// downloadQueue contains a complete history of work that has been
 	// submitted to the download loop.
-	chunkQueue    []*chunkDownload // Accessed without locks.
-	downloadQueue []*download
-	newDownloads  chan *download
-	newRepairs    chan *file
-	workerPool    map[types.FileContractID]*worker
+	//
+	// streamsDrained is signalled when the reader of a stream consumes
+	// buffered data, so that the download loop can schedule chunks that
+	// were held back because the stream was full.
+	//
+	// atomicDownloadsChanged is set when the progress of a persisted
+	// download has changed since the download queue was last saved.
+	// downloadsSaveMu is held while the download queue is saved.
+	atomicDownloadsChanged uint32
+	chunkQueue             []*chunkDownload // Accessed without locks.
+	downloadQueue          []*download
+	downloadsSaveMu        sync.TryMutex
+	newDownloads           chan *download
+	newRepairs             chan *file
+	newStreamChunks        chan streamChunk
+	streamsDrained         chan struct{}
+	workerPool             map[string]*worker
+
+	// bandwidth limits and measures the bandwidth used by the workers.
+	bandwidth bandwidthManager
+
+	// chunkCache caches recovered chunks on disk, so that repeated downloads
+	// do not fetch their pieces from the hosts again.
+	chunkCache chunkCache
+
+	// audits contains the results of the audits of the pieces stored on each
+	// host, indexed by the public key of the host.
+	audits map[string]modules.HostAuditInfo
+
+	// auditFailures counts the audits in a row in which the request for a
+	// piece has failed, indexed by the Merkle root of the piece.
+	auditFailures map[crypto.Hash]int
+
+	// performance tracks how quickly each host has served the pieces that
+	// were downloaded from it, indexed by the public key of the host.
+	// overdrive is the number of pieces of each chunk that are downloaded
+	// beyond the minimum needed to recover it.
+	performance map[string]modules.HostPerformanceInfo
+	overdrive   uint64
+
+	// retention limits the earlier versions that are kept of each file.
+	retention versionRetention
+
+	// backup records where the most recent backup of the renter's metadata
+	// is stored on the hosts. backupMu is held while a backup is created or
+	// recovered.
+	backup   backupRecord
+	backupMu sync.TryMutex
 
 	// Utilities.
 	cs             modules.ConsensusSet
@@ -121,6 +233,7 @@ type Renter struct {
 	persistDir     string
 	mu             *sync.RWMutex
 	tg             *sync.ThreadGroup
+	wallet         modules.Wallet
 }
 
 // New returns an initialized renter.
@@ -134,17 +247,20 @@ func New(cs modules.ConsensusSet, wallet modules.Wallet, tpool modules.Transacti
 		return nil, err
 	}
 
-	return newRenter(cs, tpool, hdb, hc, persistDir)
+	return newRenter(cs, tpool, wallet, hdb, hc, persistDir)
 }
 
 // newRenter initializes a renter and returns it.
-func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostDB, hc hostContractor, persistDir string) (*Renter, error) {
+func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, wallet modules.Wallet, hdb hostDB, hc hostContractor, persistDir string) (*Renter, error) {
 	if cs == nil {
 		return nil, errNilCS
 	}
 	if tpool == nil {
 		return nil, errNilTpool
 	}
+	if wallet == nil {
+		return nil, errNilWallet
+	}
 	if hc == nil {
 		return nil, errNilContractor
 	}
@@ -154,12 +270,26 @@ func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostD
 	}
 
 	r := &Renter{
-		newRepairs: make(chan *file),
-		files:      make(map[string]*file),
-		tracking:   make(map[string]trackedFile),
-
-		newDownloads: make(chan *download),
-		workerPool:   make(map[types.FileContractID]*worker),
+		archived:        make(map[*file]archivedFile),
+		audits:          make(map[string]modules.HostAuditInfo),
+		auditFailures:   make(map[crypto.Hash]int),
+		performance:     make(map[string]modules.HostPerformanceInfo),
+		newRepairs:      make(chan *file),
+		newStreamChunks: make(chan streamChunk),
+		dedupChunks:     make(map[crypto.Hash]*dedupChunk),
+		dirs:            make(map[string]struct{}),
+		dirIndex:        newDirIndex(nil, nil),
+		files:           make(map[string]*file),
+		openPacks:       make(map[string]*openPack),
+		packMembers:     make(map[string]map[*file]struct{}),
+		packs:           make(map[string]*file),
+		snapshots:       make(map[string]*snapshot),
+		tracking:        make(map[string]trackedFile),
+		versions:        make(map[string][]fileVersion),
+
+		newDownloads:   make(chan *download),
+		streamsDrained: make(chan struct{}, 1),
+		workerPool:     make(map[string]*worker),
 
 		cs:             cs,
 		hostDB:         hdb,
@@ -167,6 +297,7 @@ func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostD
 		persistDir:     persistDir,
 		mu:             sync.New(modules.SafeMutexDelay, 1),
 		tg:             new(sync.ThreadGroup),
+		wallet:         wallet,
 	}
 	if err := r.initPersist(); err != nil {
 		return nil, err
@@ -177,38 +308,106 @@ func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostD
 	go r.threadedRepairLoop()
 	go r.threadedDownloadLoop()
 	go r.threadedQueueRepairs()
+	go r.threadedFlushPacks()
+	go r.threadedResumeDownloads()
+	go r.threadedSaveDownloads()
+	go r.threadedAuditLoop()
+	go r.threadedPruneVersions()
+	go r.threadedBackup()
+	go r.threadedExpireFiles()
+
+	// Renew only the contracts that store data of files that are still kept.
+	hc.SetRetainer(r)
 	return r, nil
 }
 
 // Close closes the Renter and its dependencies
 func (r *Renter) Close() error {
 	r.tg.Stop()
+	// Save the progress that the downloads made since the download queue was
+	// last saved.
+	if atomic.LoadUint32(&r.atomicDownloadsChanged) == 1 {
+		if err := r.managedSaveDownloads(); err != nil {
+			r.log.Println("WARN: could not save the download queue:", err)
+		}
+	}
 	return r.hostDB.Close()
 }
 
 // SetSettings will update the settings for the renter.
 func (r *Renter) SetSettings(s modules.RenterSettings) error {
-	err := r.hostContractor.SetAllowance(s.Allowance)
-	if err != nil {
+	// Set the score weights first, so that new contracts are formed with
+	// hosts that are scored using them.
+	if err := r.hostDB.SetScoreWeights(s.HostScoreWeights); err != nil {
 		return err
 	}
 
+	// Only set the allowance if it has changed, so that the bandwidth limits
+	// can be changed without touching the contracts.
+	if a := r.hostContractor.Allowance(); !s.Allowance.Funds.Equals(a.Funds) || s.Allowance.Hosts != a.Hosts || s.Allowance.Period != a.Period || s.Allowance.RenewWindow != a.RenewWindow || !s.Allowance.MaxPricesEqual(a) {
+		err := r.hostContractor.SetAllowance(s.Allowance)
+		if err != nil {
+			return err
+		}
+	}
+
 	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.bandwidth.setLimits(bandwidthLimits{
+		MaxBandwidth:     s.MaxBandwidth,
+		MaxDownloadSpeed: s.MaxDownloadSpeed,
+		MaxUploadSpeed:   s.MaxUploadSpeed,
+	})
+	r.overdrive = s.DownloadOverdrive
+	r.chunkCache.setMaxSize(s.ChunkCacheSize)
+	err := r.saveSync()
 	r.updateWorkerPool()
-	r.mu.Unlock(id)
-	return nil
+	if err != nil {
+		return err
+	}
+
+	// Apply the new retention to the versions that have already been kept.
+	r.retention = versionRetention{
+		MaxVersions: s.MaxVersions,
+		MaxAge:      s.MaxVersionAge,
+	}
+	r.pruneAllVersions()
+	return r.saveArchive()
 }
 
 // hostdb passthroughs
 func (r *Renter) ActiveHosts() []modules.HostDBEntry { return r.hostDB.ActiveHosts() }
 func (r *Renter) AllHosts() []modules.HostDBEntry    { return r.hostDB.AllHosts() }
+func (r *Renter) HostDBFilter() modules.HostDBFilter { return r.hostDB.Filter() }
+func (r *Renter) Host(spk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	return r.hostDB.Host(spk)
+}
+func (r *Renter) ScoreBreakdown(e modules.HostDBEntry) modules.HostScoreBreakdown {
+	return r.hostDB.ScoreBreakdown(e)
+}
+func (r *Renter) SetHostDBFilter(f modules.HostDBFilter) error {
+	return r.hostDB.SetFilter(f)
+}
 
 // contractor passthroughs
 func (r *Renter) Contracts() []modules.RenterContract { return r.hostContractor.Contracts() }
 func (r *Renter) CurrentPeriod() types.BlockHeight    { return r.hostContractor.CurrentPeriod() }
 func (r *Renter) Settings() modules.RenterSettings {
+	limits := r.bandwidth.limits()
+	id := r.mu.RLock()
+	retention := r.retention
+	overdrive := r.overdrive
+	r.mu.RUnlock(id)
 	return modules.RenterSettings{
-		Allowance: r.hostContractor.Allowance(),
+		Allowance:         r.hostContractor.Allowance(),
+		DownloadOverdrive: overdrive,
+		MaxBandwidth:      limits.MaxBandwidth,
+		MaxDownloadSpeed:  limits.MaxDownloadSpeed,
+		MaxUploadSpeed:    limits.MaxUploadSpeed,
+		MaxVersions:       retention.MaxVersions,
+		MaxVersionAge:     retention.MaxAge,
+		ChunkCacheSize:    r.chunkCache.getMaxSize(),
+		HostScoreWeights:  r.hostDB.ScoreWeights(),
 	}
 }
 func (r *Renter) AllContracts() []modules.RenterContract {
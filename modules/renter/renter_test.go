@@ -131,7 +131,7 @@ func newContractorTester(name string, hdb hostDB, hc hostContractor) (*renterTes
 	if err != nil {
 		return nil, err
 	}
-	r, err := newRenter(cs, tp, hdb, hc, filepath.Join(testdir, modules.RenterDir))
+	r, err := newRenter(cs, tp, w, hdb, hc, filepath.Join(testdir, modules.RenterDir))
 	if err != nil {
 		return nil, err
 	}
@@ -171,6 +171,16 @@ func (stubHostDB) AllHosts() []modules.HostDBEntry      { return nil }
 func (stubHostDB) AverageContractPrice() types.Currency { return types.Currency{} }
 func (stubHostDB) Close() error                         { return nil }
 func (stubHostDB) IsOffline(modules.NetAddress) bool    { return true }
+func (stubHostDB) Filter() modules.HostDBFilter         { return modules.HostDBFilter{} }
+func (stubHostDB) SetFilter(modules.HostDBFilter) error { return nil }
+func (stubHostDB) Host(types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	return modules.HostDBEntry{}, false
+}
+func (stubHostDB) ScoreBreakdown(modules.HostDBEntry) modules.HostScoreBreakdown {
+	return modules.HostScoreBreakdown{}
+}
+func (stubHostDB) ScoreWeights() modules.HostScoreWeights         { return modules.HostScoreWeights{} }
+func (stubHostDB) SetScoreWeights(modules.HostScoreWeights) error { return nil }
 
 // stubContractor is the minimal implementation of the hostContractor
 // interface.
@@ -178,13 +188,19 @@ type stubContractor struct{}
 
 func (stubContractor) SetAllowance(modules.Allowance) error { return nil }
 func (stubContractor) Allowance() modules.Allowance         { return modules.Allowance{} }
-func (stubContractor) Contract(modules.NetAddress) (modules.RenterContract, bool) {
+func (stubContractor) Contract(types.SiaPublicKey) (modules.RenterContract, bool) {
 	return modules.RenterContract{}, false
 }
 func (stubContractor) Contracts() []modules.RenterContract                    { return nil }
 func (stubContractor) CurrentPeriod() types.BlockHeight                       { return 0 }
-func (stubContractor) IsOffline(modules.NetAddress) bool                      { return false }
+func (stubContractor) IsOffline(types.FileContractID) bool                    { return false }
+func (stubContractor) ShouldReplace(types.FileContractID) bool                { return false }
 func (stubContractor) Editor(types.FileContractID) (contractor.Editor, error) { return nil, nil }
 func (stubContractor) Downloader(types.FileContractID) (contractor.Downloader, error) {
 	return nil, nil
 }
+func (stubContractor) RecoverContracts() ([]modules.RenterContract, error) { return nil, nil }
+func (stubContractor) RestoreContracts(modules.Allowance, types.BlockHeight, []modules.RenterContract) error {
+	return nil
+}
+func (stubContractor) SetRetainer(contractor.Retainer) {}
@@ -1,7 +1,5 @@
 package renter
 
-// TODO: There are no download-to-reupload strategies implemented.
-
 // TODO: The chunkStatus stuff needs to recognize when two different contract
 // ids are actually a part of the same file contract.
 
@@ -12,37 +10,106 @@ import (
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
-	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/Sia/crypto"
 )
 
 // TODO: Move to a consts file.
 const uploadFailureCooldown = time.Second * 61 // Prime to avoid intersecting with regular events.
 const maxConsecutivePenalty = 10               // Limit the number of doublings to prevent overflows.
 const minPiecesRepair = 5
+const maxActiveRepairFetches = 5 // Limit the number of chunks fetched for remote repair that are held in memory.
 
 var (
 	// errFileDeleted indicates that a chunk which is trying to be repaired
 	// cannot be found in the renter.
 	errFileDeleted = errors.New("cannot repair chunk as the file is not being tracked by the renter")
+
+	// errFileUpdated indicates that a chunk which is trying to be repaired
+	// is being replaced, or has been replaced, by an update of its file.
+	errFileUpdated = errors.New("cannot repair chunk as the file has been updated")
+
+	// errInsufficientPiecesRepair indicates that a chunk cannot be repaired,
+	// because the local source is unavailable and too few pieces remain on
+	// the network to recover the chunk.
+	errInsufficientPiecesRepair = errors.New("cannot repair chunk as the local source is unavailable and too few pieces remain on the network")
+
+	// repairQueueFileInterval is the amount of time that the repair queue
+	// waits between adding files to the repair loop.
+	repairQueueFileInterval = build.Select(build.Var{
+		Standard: time.Second * 5,
+		Dev:      time.Second * 5,
+		Testing:  time.Millisecond * 100,
+	}).(time.Duration)
+
+	// repairQueueCycleInterval is the amount of extra time that the repair
+	// queue waits after adding every file to the repair loop before starting
+	// over.
+	repairQueueCycleInterval = build.Select(build.Var{
+		Standard: time.Minute * 5,
+		Dev:      time.Minute * 5,
+		Testing:  time.Second * 1,
+	}).(time.Duration)
 )
 
 type (
 	// chunkStatus contains information about a chunk to assist with repairing
 	// the chunk.
 	chunkStatus struct {
-		// contracts is the set of file contracts which are already storing
-		// pieces for the chunk.
+		// hosts is the set of hosts, identified by their public key, which are
+		// already storing pieces for the chunk.
 		//
 		// pieces contains the indices of the pieces that have already been
 		// uploaded for this chunk.
 		//
 		// recordedGaps indicates the value that this chunk has recorded in the
 		// gapCounts map.
-		activePieces int
-		contracts    map[types.FileContractID]struct{}
-		pieces       map[uint64]struct{}
-		recordedGaps int
-		totalPieces  int
+		//
+		// data holds the contents of the chunk once it has been downloaded
+		// from the network, which happens when the local source of the file
+		// is unavailable. fetching is set while that download is in progress,
+		// and fetched is set once data holds the downloaded chunk. If the
+		// file uses a locally repairable code and every missing piece can be
+		// rebuilt within its local group, only the pieces of those groups
+		// are downloaded, and repairedPieces instead holds the decrypted
+		// pieces of the chunk with the missing pieces rebuilt.
+		//
+		// doneChan is set if the chunk is being uploaded from a stream, and
+		// receives the outcome of the upload once the chunk leaves the
+		// repair state.
+		//
+		// generation is the generation of the file when the chunk was added
+		// to the repair state. The chunk is dropped if an update of the file
+		// changes it.
+		activePieces   int
+		data           []byte
+		doneChan       chan error
+		fetched        bool
+		fetching       bool
+		generation     uint64
+		hosts          map[string]struct{}
+		pieces         map[uint64]struct{}
+		recordedGaps   int
+		repairedPieces [][]byte
+		totalPieces    int
+	}
+
+	// fetchedChunk contains the data and error from downloading a chunk so
+	// that it can be repaired. pieces is set instead of data if the missing
+	// pieces of the chunk were rebuilt within their local groups.
+	fetchedChunk struct {
+		chunkID chunkID
+		data    []byte
+		pieces  [][]byte
+		err     error
+	}
+
+	// streamChunk contains a chunk of a file that is being uploaded from a
+	// stream, along with a channel that receives the outcome of the upload.
+	streamChunk struct {
+		chunkID  chunkID
+		data     []byte
+		doneChan chan error
+		file     *file
 	}
 
 	// chunkID can be used to uniquely identify a chunk within the repair
@@ -68,8 +135,18 @@ type (
 		// aren't being used.
 		//
 		// workerSet tracks the set of workers which can be used for uploading.
-		activeWorkers    map[types.FileContractID]*worker
-		availableWorkers map[types.FileContractID]*worker
+		//
+		// activeFetches is the number of chunks that are being downloaded from
+		// the network because their local source is unavailable. The results
+		// are delivered on fetchChan.
+		//
+		// fetchedChunks is the number of chunks that have been downloaded from
+		// the network and are held in memory until they have been repaired.
+		activeFetches    int
+		activeWorkers    map[string]*worker
+		availableWorkers map[string]*worker
+		fetchChan        chan fetchedChunk
+		fetchedChunks    int
 		gapCounts        map[int]int
 		incompleteChunks map[chunkID]*chunkStatus
 		resultChan       chan finishedUpload
@@ -79,9 +156,9 @@ type (
 // numGaps returns the number of gaps that a chunk has.
 func (cs *chunkStatus) numGaps(rs *repairState) int {
 	incompatContracts := 0
-	for contract := range cs.contracts {
-		_, exists1 := rs.activeWorkers[contract]
-		_, exists2 := rs.availableWorkers[contract]
+	for host := range cs.hosts {
+		_, exists1 := rs.activeWorkers[host]
+		_, exists2 := rs.availableWorkers[host]
 		if exists1 || exists2 {
 			incompatContracts++
 		}
@@ -95,11 +172,44 @@ func (cs *chunkStatus) numGaps(rs *repairState) int {
 	return pieceGaps
 }
 
+// notifyDone reports the outcome of the chunk's upload to the stream that the
+// chunk was read from, if any.
+func (cs *chunkStatus) notifyDone(err error) {
+	if cs.doneChan != nil {
+		cs.doneChan <- err
+		cs.doneChan = nil
+	}
+}
+
+// addStreamChunkToRepairState adds a chunk that has been read from a stream to
+// the repair state, along with the data of the chunk. The chunk may already be
+// in the repair state if the file was queued for repair while the chunk was
+// being read.
+func (r *Renter) addStreamChunkToRepairState(rs *repairState, sc streamChunk) {
+	cs, exists := rs.incompleteChunks[sc.chunkID]
+	if !exists {
+		sc.file.mu.RLock()
+		generation := sc.file.generation
+		sc.file.mu.RUnlock()
+		cs = &chunkStatus{
+			generation:  generation,
+			hosts:       make(map[string]struct{}),
+			pieces:      make(map[uint64]struct{}),
+			totalPieces: sc.file.erasureCode.NumPieces(),
+		}
+		cs.recordedGaps = cs.numGaps(rs)
+		rs.incompleteChunks[sc.chunkID] = cs
+		rs.gapCounts[cs.recordedGaps]++
+	}
+	cs.data = sc.data
+	cs.doneChan = sc.doneChan
+}
+
 // addFileToRepairState will take a file and add each of the incomplete chunks
 // to the repair state, along with data about which pieces need attention.
 func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 	// Fetch the list of potential contracts from the repair state.
-	contracts := make([]types.FileContractID, 0)
+	contracts := make([]string, 0)
 	for contract := range rs.activeWorkers {
 		contracts = append(contracts, contract)
 	}
@@ -107,33 +217,39 @@ func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 		contracts = append(contracts, contract)
 	}
 
+	// The size and contracts of the file change during uploads and updates.
+	file.mu.RLock()
+	defer file.mu.RUnlock()
+	if file.streaming || file.updating {
+		return
+	}
+
 	// Create the data structures that allow us to fill out the status for each
 	// chunk.
 	chunkCount := file.numChunks()
 	availablePieces := make([]map[uint64]struct{}, chunkCount)
-	utilizedContracts := make([]map[types.FileContractID]struct{}, chunkCount)
+	utilizedContracts := make([]map[string]struct{}, chunkCount)
 	for i := uint64(0); i < chunkCount; i++ {
 		availablePieces[i] = make(map[uint64]struct{})
-		utilizedContracts[i] = make(map[types.FileContractID]struct{})
+		utilizedContracts[i] = make(map[string]struct{})
 	}
 
 	// Iterate through each contract and figure out which pieces are available.
 	for _, contract := range file.contracts {
-		// Check whether this contract is offline. Even if the contract is
-		// offline, we want to record that the chunk has attempted to use this
-		// contract.
-		offline := r.hostContractor.IsOffline(contract.ID)
+		// Check whether this contract is offline, or whether its host should
+		// be replaced, in which case its pieces are treated as missing. Even
+		// if the contract is offline, we want to record that the chunk has
+		// attempted to use this contract.
+		offline := r.hostContractor.IsOffline(contract.ID) || r.hostContractor.ShouldReplace(contract.ID)
 
 		// Scan all of the pieces of the contract.
 		for _, piece := range contract.Pieces {
-			utilizedContracts[piece.Chunk][contract.ID] = struct{}{}
+			utilizedContracts[piece.Chunk][contract.HostPublicKey.String()] = struct{}{}
 
 			// Only mark the piece as complete if the piece can be recovered.
-			//
-			// TODO: Add an 'unavailable' flag to the piece that gets set to
-			// true if the host loses the piece, and only add the piece to the
-			// 'availablePieces' set if !unavailable.
-			if !offline {
+			// Pieces that the host has lost are re-uploaded to a different
+			// contract.
+			if !offline && !piece.Unavailable {
 				availablePieces[piece.Chunk][piece.Piece] = struct{}{}
 			}
 		}
@@ -157,7 +273,8 @@ func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 		// Create the chunkStatus object and add it to the set of incomplete
 		// chunks.
 		cs := &chunkStatus{
-			contracts:   utilizedContracts[i],
+			generation:  file.generation,
+			hosts:       utilizedContracts[i],
 			pieces:      availablePieces[i],
 			totalPieces: file.erasureCode.NumPieces(),
 		}
@@ -172,23 +289,26 @@ func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 // uploading to chunks.
 func (r *Renter) managedRepairIteration(rs *repairState) {
 	// Wait for work if there is nothing to do.
-	if len(rs.activeWorkers) == 0 && len(rs.incompleteChunks) == 0 {
+	if len(rs.activeWorkers) == 0 && rs.activeFetches == 0 && len(rs.incompleteChunks) == 0 {
 		select {
 		case <-r.tg.StopChan():
 			return
 		case file := <-r.newRepairs:
 			r.addFileToRepairState(rs, file)
 			return
+		case sc := <-r.newStreamChunks:
+			r.addStreamChunkToRepairState(rs, sc)
+			return
 		}
 	}
 
 	// Reset the available workers.
 	id := r.mu.Lock()
 	r.updateWorkerPool()
-	rs.availableWorkers = make(map[types.FileContractID]*worker)
+	rs.availableWorkers = make(map[string]*worker)
 	for id, worker := range r.workerPool {
 		// Ignore workers that are already in the active set of workers.
-		_, exists := rs.activeWorkers[worker.contractID]
+		_, exists := rs.activeWorkers[worker.id()]
 		if exists {
 			continue
 		}
@@ -204,6 +324,12 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 			continue
 		}
 
+		// Ignore workers whose hosts should be replaced. They still download
+		// the data stored with them, but no new pieces are uploaded to them.
+		if r.hostContractor.ShouldReplace(worker.contractID) {
+			continue
+		}
+
 		// TODO: Prune workers that do not provide value. The biggest flag is
 		// an increase in the price of storage cost. If there are more workers
 		// available than needed and upload bandwidth is saturated, the slow
@@ -226,6 +352,11 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 	// Scan through the chunks until a candidate for uploads is found.
 	var chunksToDelete []chunkID
 	for chunkID, chunkStatus := range rs.incompleteChunks {
+		// Skip this chunk if it is still being downloaded from the network.
+		if chunkStatus.fetching {
+			continue
+		}
+
 		// Update the number of gaps for this chunk.
 		numGaps := chunkStatus.numGaps(rs)
 		rs.gapCounts[chunkStatus.recordedGaps]--
@@ -246,9 +377,9 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 
 		// Determine the set of useful workers - workers that are both
 		// available and able to repair this chunk.
-		var usefulWorkers []types.FileContractID
+		var usefulWorkers []string
 		for workerID := range rs.availableWorkers {
-			_, exists := chunkStatus.contracts[workerID]
+			_, exists := chunkStatus.hosts[workerID]
 			if !exists {
 				usefulWorkers = append(usefulWorkers, workerID)
 			}
@@ -270,11 +401,16 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 		err := r.managedScheduleChunkRepair(rs, chunkID, chunkStatus, usefulWorkers)
 		if err != nil {
 			r.log.Println("Unable to repair chunk:", err)
+			chunkStatus.notifyDone(err)
 			chunksToDelete = append(chunksToDelete, chunkID)
 			continue
 		}
 	}
 	for _, cid := range chunksToDelete {
+		if rs.incompleteChunks[cid].fetched {
+			rs.fetchedChunks--
+		}
+		rs.incompleteChunks[cid].notifyDone(nil)
 		delete(rs.incompleteChunks, cid)
 	}
 
@@ -284,48 +420,75 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 
 // managedScheduleChunkRepair takes a chunk and schedules some repair on that
 // chunk using the chunk state and a list of workers.
-func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, chunkStatus *chunkStatus, usefulWorkers []types.FileContractID) error {
-	// Check that the file is still in the renter.
+func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, chunkStatus *chunkStatus, usefulWorkers []string) error {
+	// Check that the file is still in the renter. Packs are not tracked, and
+	// their chunk is read from the local sources of the files they store.
 	filename := chunkID.filename
 	id := r.mu.RLock()
 	file, exists1 := r.files[filename]
 	meta, exists2 := r.tracking[filename]
+	pack, isPack := r.packs[filename]
+	var members []packMember
+	if isPack {
+		file, exists1, exists2 = pack, true, true
+		members = r.packSources(pack)
+	}
 	r.mu.RUnlock(id)
 	if !exists1 || !exists2 {
 		return errFileDeleted
 	}
 
-	// Read the file data into memory.
-	chunkIndex := chunkID.index
-	fHandle, err := os.Open(meta.RepairPath)
-	if err != nil {
-		// TODO: Perform a download-and-repair instead of returning this error.
-		return build.ExtendErr("unable to open file to repair chunk", err)
+	// Chunks of a file that is being updated are not repaired, except for
+	// the chunks that the update appends to the file, and chunks that an
+	// update has replaced are dropped. The file is queued for repair again
+	// once the update is done.
+	file.mu.RLock()
+	updated := (file.updating && chunkStatus.doneChan == nil) || file.generation != chunkStatus.generation
+	file.mu.RUnlock()
+	if updated {
+		return errFileUpdated
 	}
-	defer fHandle.Close()
-	chunkData := make([]byte, file.chunkSize())
-	_, err = fHandle.ReadAt(chunkData, int64(chunkIndex*file.chunkSize()))
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-		// TODO: We should be doing better error handling here - shouldn't be
-		// running into ErrUnexpectedEOF intentionally because if it happens
-		// unintentionally we will believe that the chunk was read from memory
-		// correctly.
 
-		// TODO: Perform a download-and-repair instead of returning this error.
-		return build.ExtendErr("unable to read file to repair chunk", err)
+	// Read the chunk data into memory. If the local source of the file is
+	// unavailable, the chunk is instead downloaded from the network and
+	// repaired once the download has completed.
+	chunkIndex := chunkID.index
+	chunkData := chunkStatus.data
+	if chunkData == nil && chunkStatus.repairedPieces == nil {
+		var err error
+		if isPack {
+			chunkData, err = readPackChunk(pack, members)
+		} else {
+			chunkData, err = readChunk(meta.RepairPath, file, chunkIndex)
+		}
+		// The pieces of a deduplicated chunk are shared with other files, so
+		// they must match the content that the chunk had when it was
+		// uploaded.
+		if err == nil && len(file.chunkHashes) != 0 && crypto.HashBytes(chunkData) != file.chunkHashes[chunkIndex] {
+			err = errDedupChunkChanged
+		}
+		if err != nil {
+			r.log.Debugln("Unable to read chunk from local source, fetching from the network:", err)
+			return r.managedScheduleChunkFetch(rs, chunkID, chunkStatus, file)
+		}
 	}
 
-	// Erasure code the pieces.
-	pieces, err := file.erasureCode.Encode(chunkData)
-	if err != nil {
-		return build.ExtendErr("unable to erasure code chunk data", err)
+	// Erasure code the pieces, unless the missing pieces have already been
+	// rebuilt within their local groups.
+	pieces := chunkStatus.repairedPieces
+	if pieces == nil {
+		var err error
+		pieces, err = file.erasureCode.Encode(chunkData)
+		if err != nil {
+			return build.ExtendErr("unable to erasure code chunk data", err)
+		}
 	}
 
 	// Get the set of pieces that are missing from the chunk.
 	var missingPieces []uint64
 	for i := uint64(0); i < uint64(file.erasureCode.NumPieces()); i++ {
 		_, exists := chunkStatus.pieces[i]
-		if !exists {
+		if !exists && pieces[i] != nil {
 			missingPieces = append(missingPieces, i)
 		}
 	}
@@ -337,7 +500,8 @@ func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, ch
 
 	// Encrypt the missing pieces.
 	for _, missingPiece := range missingPieces {
-		key := deriveKey(file.masterKey, chunkIndex, uint64(missingPiece))
+		var err error
+		key := pieceKey(file.masterKey, file.dedupKeys, chunkIndex, uint64(missingPiece))
 		pieces[missingPiece], err = key.EncryptBytes(pieces[missingPiece])
 		if err != nil {
 			return build.ExtendErr("unable to encrypt chunk pieces", err)
@@ -350,6 +514,7 @@ func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, ch
 			chunkID:    chunkID,
 			data:       pieces[missingPieces[0]],
 			file:       file,
+			generation: chunkStatus.generation,
 			pieceIndex: missingPieces[0],
 
 			resultChan: rs.resultChan,
@@ -360,7 +525,7 @@ func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, ch
 		delete(rs.availableWorkers, usefulWorkers[0])
 
 		chunkStatus.activePieces++
-		chunkStatus.contracts[usefulWorkers[0]] = struct{}{}
+		chunkStatus.hosts[usefulWorkers[0]] = struct{}{}
 		chunkStatus.pieces[missingPieces[0]] = struct{}{}
 
 		// Update the number of gaps for this chunk.
@@ -384,21 +549,205 @@ func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, ch
 	return nil
 }
 
-// managedWaitOnRepairWork will block until a worker returns from an upload,
-// handling the results.
+// readChunk reads a chunk of a file from its local source. The returned data
+// is padded with zeroes to the full chunk size.
+func readChunk(path string, file *file, chunkIndex uint64) ([]byte, error) {
+	if file.compression != "" {
+		return readCompressedChunk(path, file, chunkIndex)
+	}
+	fHandle, err := os.Open(path)
+	if err != nil {
+		return nil, build.ExtendErr("unable to open file to repair chunk", err)
+	}
+	defer fHandle.Close()
+	chunkData := make([]byte, file.chunkSize())
+	_, err = fHandle.ReadAt(chunkData, int64(chunkIndex*file.chunkSize()))
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		// TODO: We should be doing better error handling here - shouldn't be
+		// running into ErrUnexpectedEOF intentionally because if it happens
+		// unintentionally we will believe that the chunk was read from memory
+		// correctly.
+		return nil, build.ExtendErr("unable to read file to repair chunk", err)
+	}
+	return chunkData, nil
+}
+
+// managedScheduleChunkFetch starts a download of a chunk whose local source is
+// unavailable. The download runs in the background, and the repair loop
+// resumes repairing the chunk once the data has arrived on rs.fetchChan.
+func (r *Renter) managedScheduleChunkFetch(rs *repairState, chunkID chunkID, chunkStatus *chunkStatus, file *file) error {
+	// The chunk can only be recovered if enough of its pieces are still
+	// available on the network.
+	available := make(map[uint64]int, len(chunkStatus.pieces))
+	for piece := range chunkStatus.pieces {
+		available[piece] = 1
+	}
+	if effectivePieces(file.erasureCode, available) < file.erasureCode.MinPieces() {
+		return errInsufficientPiecesRepair
+	}
+	// Limit the number of chunks that are downloaded or held in memory at
+	// once, as each of them is held in memory until it has been repaired.
+	// The chunk will be retried in a later iteration.
+	if rs.activeFetches+rs.fetchedChunks >= maxActiveRepairFetches {
+		return nil
+	}
+
+	// The missing pieces of a chunk of a locally repairable code are rebuilt
+	// from the other pieces of their groups if possible.
+	var sources []uint64
+	if lrc, ok := file.erasureCode.(*lrCode); ok {
+		sources, _ = lrc.localRepairSources(available)
+	}
+
+	chunkStatus.fetching = true
+	rs.activeFetches++
+	go r.threadedFetchChunk(file, chunkID, sources, rs.fetchChan)
+	return nil
+}
+
+// threadedFetchChunk downloads a chunk from the network and delivers the
+// result to the repair loop. If sources is set, only those pieces of the chunk
+// are downloaded to rebuild its missing pieces within their local groups, and
+// the whole chunk is only downloaded if that fails.
+func (r *Renter) threadedFetchChunk(file *file, chunkID chunkID, sources []uint64, fetchChan chan fetchedChunk) {
+	fc := fetchedChunk{chunkID: chunkID}
+	if len(sources) != 0 {
+		fc.pieces, fc.err = r.managedRebuildPieces(file, chunkID.index, sources)
+		if fc.err != nil && fc.err != errTransferInterrupted {
+			r.log.Debugln("Unable to rebuild the pieces of a chunk within their local groups, downloading the chunk:", fc.err)
+		}
+	}
+	if len(sources) == 0 || (fc.err != nil && fc.err != errTransferInterrupted) {
+		fc.data, fc.err = r.managedDownloadChunk(file, chunkID.index)
+	}
+	if fc.err == errTransferInterrupted {
+		return
+	} else if fc.err != nil {
+		fc.err = build.ExtendErr("unable to download chunk for repair", fc.err)
+	}
+
+	select {
+	case fetchChan <- fc:
+	case <-r.tg.StopChan():
+	}
+}
+
+// managedRebuildPieces downloads the sources of a chunk of a file that uses a
+// locally repairable code, and returns the decrypted pieces of the chunk with
+// its missing pieces rebuilt from the other pieces of their local groups.
+// Pieces that are neither sources nor rebuilt are nil.
+func (r *Renter) managedRebuildPieces(file *file, chunkIndex uint64, sources []uint64) ([][]byte, error) {
+	offset := chunkIndex * file.chunkSize()
+	length := file.chunkSize()
+	if offset+length > file.storedSize() {
+		length = file.storedSize() - offset
+	}
+
+	// Only the sources are downloaded, each of them from a different host.
+	d := newSectionDownload(file, downloadDestinationBuffer(nil), "", destinationTypeBuffer, offset, length)
+	d.localRepair = true
+	pieceSet := make(map[string]pieceData)
+	for host, piece := range d.pieceSet[chunkIndex] {
+		for _, source := range sources {
+			if piece.Piece == source {
+				pieceSet[host] = piece
+			}
+		}
+	}
+	if len(pieceSet) != len(sources) {
+		return nil, errInsufficientHosts
+	}
+	d.pieceSet[chunkIndex] = pieceSet
+
+	var err error
+	select {
+	case r.newDownloads <- d:
+		select {
+		case err = <-d.downloadFinished:
+		case <-r.tg.StopChan():
+			return nil, errTransferInterrupted
+		}
+	case <-r.tg.StopChan():
+		return nil, errTransferInterrupted
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.repairedPieces, nil
+}
+
+// managedDownloadChunk downloads a chunk of a file from the network. The
+// returned data is padded with zeroes to the full chunk size, matching the
+// data that would be read from the local source. The chunks of compressed
+// files are downloaded without being decompressed.
+func (r *Renter) managedDownloadChunk(file *file, chunkIndex uint64) ([]byte, error) {
+	// Determine which section of the file is covered by the chunk.
+	offset := chunkIndex * file.chunkSize()
+	length := file.chunkSize()
+	if offset+length > file.storedSize() {
+		length = file.storedSize() - offset
+	}
+
+	chunkData := make([]byte, file.chunkSize())
+	d := newSectionDownload(file, downloadDestinationBuffer(chunkData), "", destinationTypeBuffer, offset, length)
+	var err error
+	select {
+	case r.newDownloads <- d:
+		select {
+		case err = <-d.downloadFinished:
+		case <-r.tg.StopChan():
+			return nil, errTransferInterrupted
+		}
+	case <-r.tg.StopChan():
+		return nil, errTransferInterrupted
+	}
+	if err != nil {
+		return nil, err
+	}
+	return chunkData, nil
+}
+
+// managedWaitOnRepairWork will block until a worker returns from an upload or
+// a chunk has been fetched from the network, handling the results.
 func (r *Renter) managedWaitOnRepairWork(rs *repairState) {
-	// If there are no active workers, return early.
-	if len(rs.activeWorkers) == 0 {
+	// If there are no active workers or fetches, return early.
+	if len(rs.activeWorkers) == 0 && rs.activeFetches == 0 {
 		return
 	}
 
-	// Wait for an upload to finish.
+	// Wait for an upload or a fetch to finish.
 	var finishedUpload finishedUpload
 	select {
 	case finishedUpload = <-rs.resultChan:
+	case fc := <-rs.fetchChan:
+		rs.activeFetches--
+		cs, exists := rs.incompleteChunks[fc.chunkID]
+		if !exists {
+			// The chunk was removed from the repair state while the fetch
+			// was in progress.
+			return
+		}
+		cs.fetching = false
+		if fc.err != nil {
+			r.log.Println("Unable to repair chunk:", fc.err)
+			cs.notifyDone(fc.err)
+			rs.gapCounts[cs.recordedGaps]--
+			delete(rs.incompleteChunks, fc.chunkID)
+			return
+		}
+		cs.data = fc.data
+		cs.repairedPieces = fc.pieces
+		cs.fetched = true
+		rs.fetchedChunks++
+		return
 	case file := <-r.newRepairs:
 		r.addFileToRepairState(rs, file)
 		return
+	case sc := <-r.newStreamChunks:
+		r.addStreamChunkToRepairState(rs, sc)
+		return
 	case <-r.tg.StopChan():
 		return
 	}
@@ -415,8 +764,10 @@ func (r *Renter) managedWaitOnRepairWork(rs *repairState) {
 	}
 
 	// If there was no error, add the worker back to the set of
-	// available workers and wait for the next worker.
-	if finishedUpload.err == nil {
+	// available workers and wait for the next worker. Pieces that were
+	// discarded because their chunk was updated are not the fault of the
+	// worker.
+	if finishedUpload.err == nil || finishedUpload.err == errFileUpdated {
 		rs.availableWorkers[finishedUpload.workerID] = rs.activeWorkers[finishedUpload.workerID]
 		delete(rs.activeWorkers, finishedUpload.workerID)
 		return
@@ -441,10 +792,25 @@ func (r *Renter) managedWaitOnRepairWork(rs *repairState) {
 func (r *Renter) threadedQueueRepairs() {
 	for {
 		// Compress the set of files into a slice.
+		// Packed files are repaired through their packs, and open packs are
+		// queued once they are closed. Expired files are no longer repaired,
+		// and streaming and updating files are repaired once their upload
+		// or update finishes.
+		height := r.cs.Height()
 		id := r.mu.RLock()
 		var files []*file
 		for _, file := range r.files {
-			files = append(files, file)
+			file.mu.RLock()
+			skip := file.expired(height) || file.streaming || file.updating
+			file.mu.RUnlock()
+			if file.pack == nil && !skip {
+				files = append(files, file)
+			}
+		}
+		for _, pack := range r.packs {
+			if !r.isOpenPack(pack) {
+				files = append(files, pack)
+			}
 		}
 		r.mu.RUnlock(id)
 
@@ -457,18 +823,17 @@ func (r *Renter) threadedQueueRepairs() {
 				return
 			}
 
-			// Wait 5 seconds before going to the next file.
+			// Wait before going to the next file.
 			select {
-			case <-time.After(time.Second * 5):
+			case <-time.After(repairQueueFileInterval):
 			case <-r.tg.StopChan():
 				return
 			}
 		}
 
-		// Chill out for an extra 5 minutes before going through the files
-		// again.
+		// Chill out for a while before going through the files again.
 		select {
-		case <-time.After(time.Minute * 5):
+		case <-time.After(repairQueueCycleInterval):
 		case <-r.tg.StopChan():
 			return
 		}
@@ -480,8 +845,9 @@ func (r *Renter) threadedQueueRepairs() {
 // before the file reaches full redundancy.
 func (r *Renter) threadedRepairLoop() {
 	rs := &repairState{
-		activeWorkers:    make(map[types.FileContractID]*worker),
-		availableWorkers: make(map[types.FileContractID]*worker),
+		activeWorkers:    make(map[string]*worker),
+		availableWorkers: make(map[string]*worker),
+		fetchChan:        make(chan fetchedChunk),
 		gapCounts:        make(map[int]int),
 		incompleteChunks: make(map[chunkID]*chunkStatus),
 		resultChan:       make(chan finishedUpload),
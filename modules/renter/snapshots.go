@@ -0,0 +1,225 @@
+package renter
+
+// A snapshot records the files of a directory tree at a point in time. The
+// files in a snapshot are archived, so that they can be downloaded and
+// restored even after they have been replaced or deleted. Snapshots are kept
+// until they are deleted; they are not subject to the retention policy.
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// errInvalidSnapshotName is returned when a snapshot name is empty or
+	// contains a '/'.
+	errInvalidSnapshotName = errors.New("snapshot names must be nonempty and cannot contain '/'")
+
+	// errSnapshotExists is returned when creating a snapshot with the name of
+	// an existing snapshot.
+	errSnapshotExists = errors.New("a snapshot with that name already exists")
+
+	// errUnknownSnapshot is returned when a snapshot cannot be found.
+	errUnknownSnapshot = errors.New("no snapshot with that name")
+
+	// errUnknownSnapshotFile is returned when a snapshot does not contain a
+	// file at the requested SiaPath.
+	errUnknownSnapshotFile = errors.New("no file with that path in the snapshot")
+)
+
+// A snapshot is a named record of the files within a directory at the time
+// that the snapshot was created. files is keyed by the SiaPath of each file
+// at that time.
+type snapshot struct {
+	name    string
+	dir     string
+	created time.Time
+	files   map[string]*file
+}
+
+// snapshotInfosByName implements sort.Interface for a slice of SnapshotInfo,
+// sorting by name.
+type snapshotInfosByName []modules.SnapshotInfo
+
+func (s snapshotInfosByName) Len() int           { return len(s) }
+func (s snapshotInfosByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s snapshotInfosByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// findSnapshotFile returns the file at siaPath in the snapshot with the given
+// name.
+func (r *Renter) findSnapshotFile(name, siaPath string) (*file, error) {
+	s, exists := r.snapshots[name]
+	if !exists {
+		return nil, errUnknownSnapshot
+	}
+	f, exists := s.files[siaPath]
+	if !exists {
+		return nil, errUnknownSnapshotFile
+	}
+	return f, nil
+}
+
+// CreateSnapshot records the current files within dir, which may be the root
+// directory, as a snapshot with the given name.
+func (r *Renter) CreateSnapshot(name, dir string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return errInvalidSnapshotName
+	}
+	if err := validateSiaPath(dir); err != nil {
+		return err
+	}
+
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	if _, exists := r.snapshots[name]; exists {
+		return errSnapshotExists
+	}
+	if !r.dirExists(dir) {
+		return ErrUnknownDir
+	}
+	s := &snapshot{
+		name:    name,
+		dir:     dir,
+		created: time.Now(),
+		files:   make(map[string]*file),
+	}
+	for siaPath, f := range r.files {
+		if isWithinDir(siaPath, dir) {
+			r.archiveFile(f, r.tracking[siaPath])
+			s.files[siaPath] = f
+		}
+	}
+	r.snapshots[name] = s
+	return r.saveArchive()
+}
+
+// Snapshots returns information on each snapshot, sorted by name.
+func (r *Renter) Snapshots() []modules.SnapshotInfo {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	infos := make([]modules.SnapshotInfo, 0, len(r.snapshots))
+	for _, s := range r.snapshots {
+		info := modules.SnapshotInfo{
+			Name:     s.name,
+			Dir:      s.dir,
+			Created:  s.created,
+			NumFiles: uint64(len(s.files)),
+		}
+		for _, f := range s.files {
+			f.mu.RLock()
+			info.Size += f.size
+			f.mu.RUnlock()
+		}
+		infos = append(infos, info)
+	}
+	sort.Sort(snapshotInfosByName(infos))
+	return infos
+}
+
+// SnapshotFiles returns information on the files in a snapshot, sorted by the
+// SiaPath that each file had when the snapshot was created.
+func (r *Renter) SnapshotFiles(name string) ([]modules.FileInfo, error) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	s, exists := r.snapshots[name]
+	if !exists {
+		return nil, errUnknownSnapshot
+	}
+	files := make([]modules.FileInfo, 0, len(s.files))
+	for siaPath, f := range s.files {
+		f.mu.RLock()
+		fi := fileInfo(f)
+		fi.SiaPath = siaPath
+		files = append(files, fi)
+		f.mu.RUnlock()
+	}
+	sort.Sort(fileInfosBySiaPath(files))
+	return files, nil
+}
+
+// DownloadSnapshotFile downloads the file at siaPath in a snapshot to
+// destination.
+func (r *Renter) DownloadSnapshotFile(name, siaPath, destination string) error {
+	lockID := r.mu.RLock()
+	f, err := r.findSnapshotFile(name, siaPath)
+	r.mu.RUnlock(lockID)
+	if err != nil {
+		return err
+	}
+	return r.managedDownloadArchived(f, siaPath, destination)
+}
+
+// RestoreSnapshot returns the directory of a snapshot to the state that it
+// was in when the snapshot was created. Every file in the snapshot is made
+// current again, and files that were added to the directory since the
+// snapshot was created are removed. Files that are replaced or removed are
+// kept as earlier versions, so that the restore can be undone.
+func (r *Renter) RestoreSnapshot(name string) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	s, exists := r.snapshots[name]
+	if !exists {
+		return errUnknownSnapshot
+	}
+
+	// Set aside the files that are not part of the snapshot. Files that are
+	// part of the snapshot but were moved elsewhere are moved back by
+	// restoreFile.
+	for siaPath, f := range r.files {
+		if _, inSnapshot := s.files[siaPath]; !isWithinDir(siaPath, s.dir) || inSnapshot {
+			continue
+		}
+		snapshotFile := false
+		for _, sf := range s.files {
+			if sf == f {
+				snapshotFile = true
+			}
+		}
+		if !snapshotFile {
+			r.archiveCurrent(siaPath, f)
+			r.pruneVersions(siaPath, time.Now())
+		}
+	}
+
+	// Restore the files in order, so that the outcome does not depend on the
+	// order of the map.
+	paths := make([]string, 0, len(s.files))
+	for siaPath := range s.files {
+		paths = append(paths, siaPath)
+	}
+	sort.Strings(paths)
+	var restoreErr error
+	for _, siaPath := range paths {
+		if err := r.restoreFile(siaPath, s.files[siaPath]); err != nil && restoreErr == nil {
+			restoreErr = err
+		}
+	}
+	if err := r.saveSync(); err != nil {
+		return err
+	}
+	if err := r.saveArchive(); err != nil {
+		return err
+	}
+	return restoreErr
+}
+
+// DeleteSnapshot removes a snapshot. The data of the files in the snapshot is
+// deleted from the hosts unless the files are still current or are still kept
+// by a version or another snapshot.
+func (r *Renter) DeleteSnapshot(name string) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	s, exists := r.snapshots[name]
+	if !exists {
+		return errUnknownSnapshot
+	}
+	delete(r.snapshots, name)
+	for _, f := range s.files {
+		r.releaseArchivedFile(f)
+	}
+	return r.saveArchive()
+}
@@ -0,0 +1,112 @@
+package renter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestSnapshots checks that snapshots record the files of a directory, and
+// that restoring a snapshot returns the directory to its recorded state.
+func TestSnapshots(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestSnapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	sourceDir := build.TempDir("renter", "TestSnapshots", "sources")
+	if err := os.MkdirAll(sourceDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(1, 1)
+	upload := func(siaPath string, size int) {
+		source := filepath.Join(sourceDir, "source")
+		if err := ioutil.WriteFile(source, make([]byte, size), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := rt.renter.Upload(modules.FileUploadParams{
+			Source:      source,
+			SiaPath:     siaPath,
+			ErasureCode: rsc,
+			Versioned:   true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload("dir/foo", 10)
+	upload("dir/bar", 20)
+	upload("baz", 30)
+
+	if err := rt.renter.CreateSnapshot("snap", "dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateSnapshot("snap", ""); err != errSnapshotExists {
+		t.Fatal("expected errSnapshotExists, got", err)
+	}
+	if err := rt.renter.CreateSnapshot("a/b", ""); err != errInvalidSnapshotName {
+		t.Fatal("expected errInvalidSnapshotName, got", err)
+	}
+	if err := rt.renter.CreateSnapshot("missing", "missing"); err != ErrUnknownDir {
+		t.Fatal("expected ErrUnknownDir, got", err)
+	}
+	snapshots := rt.renter.Snapshots()
+	if len(snapshots) != 1 || snapshots[0].NumFiles != 2 || snapshots[0].Size != 30 {
+		t.Fatal("wrong snapshots:", snapshots)
+	}
+
+	// Change the directory after the snapshot was taken.
+	upload("dir/foo", 40)
+	if err := rt.renter.DeleteFile("dir/bar"); err != nil {
+		t.Fatal(err)
+	}
+	upload("dir/new", 50)
+	files, err := rt.renter.SnapshotFiles("snap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].SiaPath != "dir/bar" || files[1].SiaPath != "dir/foo" || files[1].Filesize != 10 {
+		t.Fatal("wrong snapshot files:", files)
+	}
+
+	// Restore the snapshot.
+	if err := rt.renter.RestoreSnapshot("snap"); err != nil {
+		t.Fatal(err)
+	}
+	_, dirFiles, err := rt.renter.DirList("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirFiles) != 2 || dirFiles[0].SiaPath != "dir/bar" || dirFiles[1].Filesize != 10 {
+		t.Fatal("snapshot was not restored:", dirFiles)
+	}
+	if versions, err := rt.renter.FileVersions("dir/new"); err != nil || len(versions) != 1 {
+		t.Fatal("file added after the snapshot was not kept as a version:", versions, err)
+	}
+	if _, err := rt.renter.File("baz"); err != nil {
+		t.Fatal("file outside of the snapshot was affected by the restore:", err)
+	}
+
+	// Deleting the snapshot releases the files that are no longer kept.
+	if err := rt.renter.DeleteSnapshot("snap"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.DeleteSnapshot("snap"); err != errUnknownSnapshot {
+		t.Fatal("expected errUnknownSnapshot, got", err)
+	}
+	id := rt.renter.mu.RLock()
+	foo := rt.renter.files["dir/foo"]
+	_, fooArchived := rt.renter.archived[foo]
+	rt.renter.mu.RUnlock(id)
+	if fooArchived {
+		t.Error("file is still archived after its snapshot was deleted")
+	}
+}
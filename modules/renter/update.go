@@ -0,0 +1,434 @@
+package renter
+
+// Files can be updated in place: a range of bytes is written into an existing
+// file without uploading the rest of the file again. Only the chunks that the
+// range overlaps are re-encoded, and each of their pieces is overwritten on
+// its host with a Modify revision, which costs upload bandwidth but no
+// additional storage. Chunks that extend the file past its last chunk are
+// uploaded in the same way as the chunks of a stream.
+//
+// The pieces of all updated chunks are modified before the file metadata is
+// changed, and the new Merkle roots are then recorded in a single step. All
+// of the pieces of a chunk must encode the same data, so a chunk takes its
+// new data only if enough of its pieces were modified to recover it, and the
+// pieces that still hold the other version of the chunk are dropped and
+// replaced by the repair loop. An update stops at the first chunk that
+// cannot be updated, in which case the chunk keeps its old data and the file
+// keeps its size.
+//
+// While a file is updated it is not repaired, and only one update of a file
+// can run at a time. Each commit increments the generation of the file, so
+// that chunks that were recovered or encoded from the old pieces are neither
+// cached nor uploaded. Downloads that are running during an update recover
+// the chunks from the pieces that still match the roots they were given, or
+// fail. Once a file has been updated its local source no longer matches it,
+// and the file is repaired from the network instead.
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules/renter/contractor"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// ErrUpdateArchived is returned when updating a file that is kept by a
+	// version or a snapshot, as the archived file shares its sectors.
+	ErrUpdateArchived = errors.New("files that are kept by a version or snapshot cannot be updated")
+
+	// ErrUpdateCompressed is returned when updating a compressed file, as its
+	// chunks hold a variable amount of the file's data.
+	ErrUpdateCompressed = errors.New("compressed files cannot be updated")
+
+	// ErrUpdateDeduplicated is returned when updating a deduplicated file, as
+	// its pieces may be shared with other files.
+	ErrUpdateDeduplicated = errors.New("deduplicated files cannot be updated")
+
+	// ErrUpdateInProgress is returned when updating a file that is already
+	// being updated or uploaded.
+	ErrUpdateInProgress = errors.New("file is already being updated or uploaded")
+
+	// ErrUpdateOffset is returned when the range to be written begins past
+	// the end of the file.
+	ErrUpdateOffset = errors.New("offset is beyond the end of the file")
+
+	// ErrUpdatePacked is returned when updating a packed file, as its data is
+	// stored in a pack along with other files.
+	ErrUpdatePacked = errors.New("packed files cannot be updated")
+
+	// errUpdatedChunkUnrecoverable is returned when fewer pieces of an updated
+	// chunk than are needed to recover it could be modified.
+	errUpdatedChunkUnrecoverable = errors.New("chunk could not be updated on enough hosts to be recoverable")
+)
+
+// A pieceUpdate is the result of modifying a piece of a chunk on its host.
+type pieceUpdate struct {
+	contractID types.FileContractID
+	piece      pieceData
+	newRoot    crypto.Hash
+	err        error
+}
+
+// A chunkUpdate holds the outcome of modifying the pieces of an updated chunk.
+type chunkUpdate struct {
+	index  uint64
+	pieces []pieceUpdate
+}
+
+// UpdateFile writes the data read from reader into the file at siaPath,
+// starting at offset. The data is read one chunk at a time. The file grows if
+// the data extends past its end, but offset may not be past the end of the
+// file.
+func (r *Renter) UpdateFile(siaPath string, offset uint64, reader io.Reader) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+
+	// Check that the file can be updated, and mark it as updating.
+	lockID := r.mu.RLock()
+	f, exists := r.files[siaPath]
+	if !exists {
+		r.mu.RUnlock(lockID)
+		return ErrUnknownPath
+	}
+	_, archived := r.archived[f]
+	f.mu.Lock()
+	size := f.size
+	numChunks := f.numChunks()
+	var err error
+	switch {
+	case f.pack != nil:
+		err = ErrUpdatePacked
+	case len(f.chunkHashes) != 0:
+		err = ErrUpdateDeduplicated
+	case f.compression != "":
+		err = ErrUpdateCompressed
+	case archived:
+		err = ErrUpdateArchived
+	case offset > size:
+		err = ErrUpdateOffset
+	case f.updating || f.streaming:
+		err = ErrUpdateInProgress
+	}
+	if err == nil {
+		f.updating = true
+	}
+	f.mu.Unlock()
+	r.mu.RUnlock(lockID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.mu.Lock()
+		f.updating = false
+		f.mu.Unlock()
+
+		// Replace any pieces that could not be updated.
+		select {
+		case r.newRepairs <- f:
+		case <-r.tg.StopChan():
+		}
+	}()
+
+	// Modify the pieces of the existing chunks that are overlapped by the
+	// data, stopping at the first chunk that cannot be updated.
+	chunkSize := f.chunkSize()
+	end := offset
+	var updates []chunkUpdate
+	var updateErr error
+	for chunkIndex := offset / chunkSize; chunkIndex < numChunks; chunkIndex++ {
+		data := make([]byte, (chunkIndex+1)*chunkSize-end)
+		n, err := io.ReadFull(reader, data)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			updateErr = build.ExtendErr("unable to read data", err)
+			break
+		} else if n == 0 {
+			break
+		}
+		cu, err := r.managedUpdateChunk(f, chunkIndex, size, end, data[:n])
+		updates = append(updates, cu)
+		if err != nil {
+			updateErr = build.ExtendErr("unable to update chunk", err)
+			break
+		}
+		end += uint64(n)
+		if n < len(data) {
+			break
+		}
+	}
+
+	// Check whether any data extends past the last chunk of the file.
+	var next [1]byte
+	var appending bool
+	if updateErr == nil && end == numChunks*chunkSize {
+		n, err := io.ReadFull(reader, next[:])
+		if err != nil && err != io.EOF {
+			updateErr = build.ExtendErr("unable to read data", err)
+		}
+		appending = n == 1
+	}
+
+	// Record the new pieces of the updated chunks in a single step. The file
+	// only grows if every existing chunk was updated. The local source of the
+	// file is outdated once any of its data has changed.
+	newSize := size
+	if updateErr == nil && end > size {
+		newSize = end
+	}
+	var updated []uint64
+	var stale []fileContract
+	lockID = r.mu.Lock()
+	f.mu.Lock()
+	for _, cu := range updates {
+		applied, dropped := f.applyChunkUpdate(cu)
+		if applied {
+			updated = append(updated, cu.index)
+		}
+		stale = append(stale, dropped...)
+	}
+	prevTracking := r.tracking[siaPath]
+	if len(updated) > 0 || appending {
+		f.size = newSize
+		f.generation++
+		r.tracking[siaPath] = trackedFile{}
+	}
+	err = r.persistFile(f)
+	if err == nil {
+		err = r.saveSync()
+	}
+	f.mu.Unlock()
+	r.mu.Unlock(lockID)
+	for _, chunk := range updated {
+		r.chunkCache.invalidateChunk(f.masterKey, chunk)
+	}
+	if len(stale) > 0 {
+		go r.threadedDeleteSectors(stale)
+	}
+	if err != nil {
+		return err
+	} else if updateErr != nil {
+		return updateErr
+	} else if !appending {
+		return nil
+	}
+
+	// Upload the data that extends past the last chunk of the file as new
+	// chunks. If the upload fails, the appended chunks are dropped again.
+	err = r.managedUploadStreamChunks(f, io.MultiReader(bytes.NewReader(next[:]), reader), numChunks)
+	if err != nil {
+		lockID = r.mu.Lock()
+		f.mu.Lock()
+		appended := f.removeChunkPieces(func(chunk uint64) bool { return chunk >= numChunks })
+		f.size = newSize
+		if len(updated) == 0 {
+			r.tracking[siaPath] = prevTracking
+		}
+		r.persistFile(f)
+		r.saveSync()
+		f.mu.Unlock()
+		r.mu.Unlock(lockID)
+		go r.threadedDeleteSectors(appended)
+		return err
+	}
+	return nil
+}
+
+// managedUpdateChunk writes the part of data that overlaps a chunk of f into
+// the chunk, and overwrites each piece of the chunk on its host. data is
+// written at offset within the file, which has the given size. The outcome of
+// every modification is returned, even if the chunk cannot be recovered from
+// the modified pieces, so that the file can be brought in line with its
+// hosts.
+func (r *Renter) managedUpdateChunk(f *file, chunkIndex, size, offset uint64, data []byte) (chunkUpdate, error) {
+	cu := chunkUpdate{index: chunkIndex}
+	chunkSize := f.chunkSize()
+	chunkStart := chunkIndex * chunkSize
+
+	// Get the current data of the chunk, unless all of it is overwritten.
+	chunkEnd := chunkStart + chunkSize
+	if chunkEnd > size {
+		chunkEnd = size
+	}
+	end := offset + uint64(len(data))
+	var chunkData []byte
+	if offset <= chunkStart && end >= chunkEnd {
+		chunkData = make([]byte, chunkSize)
+	} else {
+		var err error
+		chunkData, err = r.managedDownloadChunk(f, chunkIndex)
+		if err != nil {
+			return cu, build.ExtendErr("unable to download chunk", err)
+		}
+	}
+	if offset > chunkStart {
+		copy(chunkData[offset-chunkStart:], data)
+	} else {
+		copy(chunkData, data[chunkStart-offset:])
+	}
+
+	// Erasure code the updated chunk.
+	pieces, err := f.erasureCode.Encode(chunkData)
+	if err != nil {
+		return cu, build.ExtendErr("unable to erasure code chunk data", err)
+	}
+
+	// Modify the pieces of the chunk, one editor per contract.
+	byContract := make(map[types.FileContractID][]int)
+	f.mu.RLock()
+	for id, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			if p.Chunk == chunkIndex && !p.Unavailable {
+				byContract[id] = append(byContract[id], len(cu.pieces))
+				cu.pieces = append(cu.pieces, pieceUpdate{contractID: id, piece: p})
+			}
+		}
+	}
+	f.mu.RUnlock()
+	var wg sync.WaitGroup
+	for id, indices := range byContract {
+		wg.Add(1)
+		go func(id types.FileContractID, indices []int) {
+			defer wg.Done()
+			editor, err := r.hostContractor.Editor(id)
+			if err != nil {
+				for _, i := range indices {
+					cu.pieces[i].err = err
+				}
+				return
+			}
+			defer editor.Close()
+			for _, i := range indices {
+				u := &cu.pieces[i]
+				u.newRoot, u.err = r.managedModifyPiece(f, editor, u.piece, pieces[u.piece.Piece])
+			}
+		}(id, indices)
+	}
+	wg.Wait()
+
+	var modified int
+	for _, u := range cu.pieces {
+		if u.err != nil {
+			r.log.Debugln("Unable to update piece of", f.name, "::", u.err)
+		} else {
+			modified++
+		}
+	}
+	if modified < f.erasureCode.MinPieces() {
+		return cu, errUpdatedChunkUnrecoverable
+	}
+	return cu, nil
+}
+
+// managedModifyPiece encrypts the new data of a piece of f and overwrites the
+// piece on the host of editor. The Merkle root of the new piece is returned.
+func (r *Renter) managedModifyPiece(f *file, editor contractor.Editor, piece pieceData, data []byte) (crypto.Hash, error) {
+	key := pieceKey(f.masterKey, f.dedupKeys, piece.Chunk, piece.Piece)
+	sector, err := key.EncryptBytes(data)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	if err := r.managedWaitUpload(uint64(len(sector))); err != nil {
+		return crypto.Hash{}, err
+	}
+	newRoot := crypto.MerkleRoot(sector)
+	if err := editor.Modify(piece.MerkleRoot, newRoot, 0, sector); err != nil {
+		return crypto.Hash{}, err
+	}
+	r.bandwidth.uploadMeter.record(uint64(len(sector)))
+	return newRoot, nil
+}
+
+// applyChunkUpdate records the outcome of an update of a chunk in f. The
+// chunk takes its new data if enough of its pieces were modified to recover
+// it, or if its old data cannot be recovered either, and all pieces that hold
+// the other version of the chunk are dropped. applyChunkUpdate returns
+// whether the chunk took its new data, and the dropped pieces that hosts
+// still store, grouped by contract. f.mu must be held.
+func (f *file) applyChunkUpdate(cu chunkUpdate) (bool, []fileContract) {
+	var modified int
+	newRoots := make(map[types.FileContractID]map[pieceData]crypto.Hash)
+	for _, u := range cu.pieces {
+		if u.err != nil {
+			continue
+		}
+		if newRoots[u.contractID] == nil {
+			newRoots[u.contractID] = make(map[pieceData]crypto.Hash)
+		}
+		newRoots[u.contractID][u.piece] = u.newRoot
+		modified++
+	}
+	minPieces := f.erasureCode.MinPieces()
+	if modified == 0 {
+		return false, nil
+	}
+	applied := modified >= minPieces || len(cu.pieces)-modified < minPieces
+
+	var dropped []fileContract
+	for id, fc := range f.contracts {
+		kept := fc.Pieces[:0]
+		var stale []pieceData
+		for _, p := range fc.Pieces {
+			newRoot, ok := newRoots[id][p]
+			switch {
+			case p.Chunk != cu.index:
+				kept = append(kept, p)
+			case applied && ok:
+				p.MerkleRoot = newRoot
+				kept = append(kept, p)
+			case !applied && !ok:
+				kept = append(kept, p)
+			case ok:
+				p.MerkleRoot = newRoot
+				stale = append(stale, p)
+			case !p.Unavailable:
+				stale = append(stale, p)
+			}
+		}
+		fc.Pieces = kept
+		f.contracts[id] = fc
+		if len(stale) > 0 {
+			dropped = append(dropped, fileContract{
+				ID:            fc.ID,
+				HostPublicKey: fc.HostPublicKey,
+				Pieces:        stale,
+				WindowStart:   fc.WindowStart,
+			})
+		}
+	}
+	return applied, dropped
+}
+
+// removeChunkPieces removes the pieces of the chunks for which remove returns
+// true from f, and returns them grouped by contract. f.mu must be held.
+func (f *file) removeChunkPieces(remove func(chunk uint64) bool) []fileContract {
+	var removed []fileContract
+	for id, fc := range f.contracts {
+		kept := fc.Pieces[:0]
+		var dropped []pieceData
+		for _, p := range fc.Pieces {
+			if remove(p.Chunk) {
+				dropped = append(dropped, p)
+			} else {
+				kept = append(kept, p)
+			}
+		}
+		if len(dropped) == 0 {
+			continue
+		}
+		fc.Pieces = kept
+		f.contracts[id] = fc
+		removed = append(removed, fileContract{
+			ID:            fc.ID,
+			HostPublicKey: fc.HostPublicKey,
+			Pieces:        dropped,
+			WindowStart:   fc.WindowStart,
+		})
+	}
+	return removed
+}
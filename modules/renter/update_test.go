@@ -0,0 +1,155 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestUpdateFileErrors checks that files which cannot be updated, and updates
+// that cannot be completed, leave the file unchanged.
+func TestUpdateFileErrors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestUpdateFileErrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if err := rt.renter.UpdateFile("dne", 0, bytes.NewReader([]byte{1})); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	rsc, _ := NewRSCode(1, 1)
+	newUpdateFile := func() *file {
+		f := newFile("foo", rsc, 10, 15)
+		rt.renter.addFileEntry(f.name, f)
+		rt.renter.tracking[f.name] = trackedFile{RepairPath: "/foo"}
+		return f
+	}
+	tests := []struct {
+		modify func(f *file)
+		offset uint64
+		err    error
+	}{
+		{func(f *file) { f.pack = newFile("pack", rsc, 10, 15) }, 0, ErrUpdatePacked},
+		{func(f *file) { f.setChunkHashes([]crypto.Hash{{}, {}}) }, 0, ErrUpdateDeduplicated},
+		{func(f *file) { f.compression = modules.CompressionGzip }, 0, ErrUpdateCompressed},
+		{func(f *file) { rt.renter.archived[f] = archivedFile{} }, 0, ErrUpdateArchived},
+		{func(f *file) {}, 16, ErrUpdateOffset},
+		{func(f *file) { f.updating = true }, 0, ErrUpdateInProgress},
+		{func(f *file) { f.streaming = true }, 0, ErrUpdateInProgress},
+	}
+	for _, test := range tests {
+		f := newUpdateFile()
+		test.modify(f)
+		if err := rt.renter.UpdateFile(f.name, test.offset, bytes.NewReader([]byte{1})); err != test.err {
+			t.Errorf("expected %v, got %v", test.err, err)
+		}
+		if rt.renter.tracking[f.name].RepairPath != "/foo" {
+			t.Error("file that was not updated lost its repair path")
+		}
+		delete(rt.renter.archived, f)
+	}
+
+	// Overwriting a whole chunk does not require the chunk to be downloaded,
+	// but the update fails if the pieces of the chunk cannot be modified, and
+	// the file is left unchanged.
+	f := newUpdateFile()
+	f.contracts[types.FileContractID{1}] = fileContract{
+		ID:     types.FileContractID{1},
+		Pieces: []pieceData{{Chunk: 1, Piece: 0, MerkleRoot: crypto.Hash{1}}},
+	}
+	if err := rt.renter.UpdateFile(f.name, 10, bytes.NewReader(make([]byte, 10))); err == nil {
+		t.Fatal("expected the update to fail without any hosts to modify pieces on")
+	}
+	if rt.renter.tracking[f.name].RepairPath != "/foo" {
+		t.Error("file that was not updated lost its repair path")
+	}
+	if f.size != 15 {
+		t.Error("file that was not updated changed size:", f.size)
+	}
+	if f.generation != 0 || f.updating {
+		t.Error("file that was not updated was marked as updated")
+	}
+	if pieces := f.contracts[types.FileContractID{1}].Pieces; len(pieces) != 1 || pieces[0].MerkleRoot != (crypto.Hash{1}) {
+		t.Error("pieces of a file that was not updated were changed:", pieces)
+	}
+}
+
+// TestApplyChunkUpdate checks that an updated chunk only takes its new data
+// if it can be recovered from the modified pieces, and that the pieces holding
+// the other version of the chunk are dropped.
+func TestApplyChunkUpdate(t *testing.T) {
+	rsc, _ := NewRSCode(2, 1)
+	newUpdateFile := func() *file {
+		f := newFile("foo", rsc, 10, 60)
+		for i := uint64(0); i < 3; i++ {
+			id := types.FileContractID{byte(i)}
+			f.contracts[id] = fileContract{ID: id, Pieces: []pieceData{
+				{Chunk: 0, Piece: i, MerkleRoot: crypto.Hash{byte(i)}},
+				{Chunk: 1, Piece: i, MerkleRoot: crypto.Hash{byte(i + 10)}},
+			}}
+		}
+		return f
+	}
+	newChunkUpdate := func(f *file, failed int) chunkUpdate {
+		cu := chunkUpdate{index: 1}
+		for i := 0; i < 3; i++ {
+			id := types.FileContractID{byte(i)}
+			u := pieceUpdate{contractID: id, piece: f.contracts[id].Pieces[1], newRoot: crypto.Hash{byte(i + 20)}}
+			if i < failed {
+				u.err = errors.New("modify failed")
+			}
+			cu.pieces = append(cu.pieces, u)
+		}
+		return cu
+	}
+
+	// With one failed modification the chunk takes its new data, and the
+	// piece that holds the old data is dropped.
+	f := newUpdateFile()
+	applied, dropped := f.applyChunkUpdate(newChunkUpdate(f, 1))
+	if !applied {
+		t.Fatal("chunk with enough modified pieces was not updated")
+	}
+	if len(dropped) != 1 || dropped[0].Pieces[0].MerkleRoot != (crypto.Hash{10}) {
+		t.Error("expected the old piece to be dropped, got", dropped)
+	}
+	for i := 1; i < 3; i++ {
+		pieces := f.contracts[types.FileContractID{byte(i)}].Pieces
+		if len(pieces) != 2 || pieces[1].MerkleRoot != (crypto.Hash{byte(i + 20)}) {
+			t.Error("modified piece was not recorded:", pieces)
+		}
+	}
+	if n := f.numChunkPieces(0); n != 3 {
+		t.Error("pieces of other chunks were changed")
+	}
+
+	// With two failed modifications the chunk keeps its old data, and the
+	// modified piece is dropped under its new root.
+	f = newUpdateFile()
+	applied, dropped = f.applyChunkUpdate(newChunkUpdate(f, 2))
+	if applied {
+		t.Fatal("chunk without enough modified pieces was updated")
+	}
+	if len(dropped) != 1 || dropped[0].Pieces[0].MerkleRoot != (crypto.Hash{22}) {
+		t.Error("expected the modified piece to be dropped, got", dropped)
+	}
+	if n := f.numChunkPieces(1); n != 2 {
+		t.Error("expected 2 old pieces of the chunk to remain, got", n)
+	}
+
+	// Without any modified pieces the file is unchanged.
+	f = newUpdateFile()
+	applied, dropped = f.applyChunkUpdate(newChunkUpdate(f, 3))
+	if applied || len(dropped) != 0 || f.numChunkPieces(1) != 3 {
+		t.Error("file was changed although no piece was modified")
+	}
+}
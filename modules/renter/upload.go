@@ -3,8 +3,11 @@ package renter
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
@@ -14,6 +17,23 @@ import (
 var (
 	errInsufficientContracts = errors.New("not enough contracts to upload file")
 
+	// errInsufficientPiecesUploaded is returned when a chunk of a stream
+	// could not be uploaded to enough hosts to be recoverable.
+	errInsufficientPiecesUploaded = errors.New("chunk could not be uploaded to enough hosts to be recoverable")
+
+	// errStreamUploadInterrupted is returned when the renter shuts down
+	// during an upload from a stream.
+	errStreamUploadInterrupted = errors.New("upload was interrupted by the renter shutting down")
+
+	// errSharedStream is returned when a stream is uploaded with packing or
+	// deduplication, which require the size or the content of the file to
+	// be known before it is uploaded.
+	errSharedStream = errors.New("uploads from a stream cannot be packed or deduplicated")
+
+	// defaultStreamFileMode is the mode given to files that are uploaded from
+	// a stream, as they have no local file to take the mode from.
+	defaultStreamFileMode = os.FileMode(0666)
+
 	// Erasure-coded piece size
 	pieceSize = modules.SectorSize - crypto.TwofishOverhead
 
@@ -45,9 +65,10 @@ var (
 	}()
 )
 
-// Upload instructs the renter to start tracking a file. The renter will
-// automatically upload and repair tracked files using a background loop.
-func (r *Renter) Upload(up modules.FileUploadParams) error {
+// managedValidateUploadParams enforces the nickname rules, checks that the
+// siapath is not already in use, and fills in any missing upload params with
+// sensible defaults.
+func (r *Renter) managedValidateUploadParams(up *modules.FileUploadParams) error {
 	// Enforce nickname rules.
 	if strings.HasPrefix(up.SiaPath, "/") {
 		return errors.New("nicknames cannot begin with /")
@@ -55,23 +76,34 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	if up.SiaPath == "" {
 		return ErrEmptyFilename
 	}
+	if err := validateNewSiaPath(up.SiaPath); err != nil {
+		return err
+	}
 
 	// Check for a nickname conflict.
 	lockID := r.mu.RLock()
 	_, exists := r.files[up.SiaPath]
+	conflictErr := r.checkPathConflict(up.SiaPath)
 	r.mu.RUnlock(lockID)
-	if exists {
+	if exists && !up.Versioned {
 		return ErrPathOverload
 	}
-
-	// Fill in any missing upload params with sensible defaults.
-	fileInfo, err := os.Stat(up.Source)
-	if err != nil {
-		return err
+	if conflictErr != nil {
+		return conflictErr
 	}
+
 	if up.ErasureCode == nil {
 		up.ErasureCode, _ = NewRSCode(defaultDataPieces, defaultParityPieces)
 	}
+	if _, registered := erasureCodes[up.ErasureCode.Type()]; !registered {
+		return errUnknownErasureCode
+	}
+	if up.Compression != "" && up.Compression != modules.CompressionGzip {
+		return errUnknownCompression
+	}
+	if up.ExpirationHeight != 0 && up.ExpirationHeight <= r.cs.Height() {
+		return errExpirationPassed
+	}
 
 	// Check that we have contracts to upload to. We need at least (data +
 	// parity/2) contracts; since NumPieces = data + parity, we arrive at the
@@ -79,18 +111,61 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	if nContracts := len(r.hostContractor.Contracts()); nContracts < (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2 && build.Release != "testing" {
 		return fmt.Errorf("not enough contracts to upload file: got %v, needed %v", nContracts, (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2)
 	}
+	return nil
+}
+
+// Upload instructs the renter to start tracking a file. The renter will
+// automatically upload and repair tracked files using a background loop. If
+// up.Pack is set, files that are smaller than a chunk share a chunk with
+// other small files. If up.Dedup is set, chunks that are identical to chunks
+// of other deduplicated files share their pieces. If up.Compression is set,
+// the file is compressed before it is uploaded.
+func (r *Renter) Upload(up modules.FileUploadParams) error {
+	if err := r.managedValidateUploadParams(&up); err != nil {
+		return err
+	}
+	fileInfo, err := os.Stat(up.Source)
+	if err != nil {
+		return err
+	}
+	if up.Compression != "" && (up.Pack || up.Dedup) {
+		return errCompressedSharedFile
+	}
+	if up.Dedup {
+		if up.Pack {
+			return errDedupPackedFile
+		}
+		return r.managedUploadDeduplicated(up, uint64(fileInfo.Size()), fileInfo.Mode())
+	}
+	chunkSize := pieceSize * uint64(up.ErasureCode.MinPieces())
+	if up.Pack && uint64(fileInfo.Size()) < chunkSize {
+		return r.managedUploadPacked(up, uint64(fileInfo.Size()), fileInfo.Mode())
+	}
 
 	// Create file object.
 	f := newFile(up.SiaPath, up.ErasureCode, pieceSize, uint64(fileInfo.Size()))
 	f.mode = uint32(fileInfo.Mode())
+	f.expireHeight = up.ExpirationHeight
+	if up.Compression != "" {
+		f.compression = up.Compression
+		f.chunkOffsets, f.compressedHashes, err = compressedChunks(up.Source, f.chunkSize())
+		if err != nil {
+			return build.ExtendErr("unable to compress file", err)
+		}
+	}
 
 	// Add file to renter.
-	lockID = r.mu.Lock()
-	r.files[up.SiaPath] = f
+	lockID := r.mu.Lock()
+	if err := r.replaceFile(up.SiaPath, up.Versioned); err != nil {
+		r.mu.Unlock(lockID)
+		return err
+	}
+	r.addFileEntry(up.SiaPath, f)
 	r.tracking[up.SiaPath] = trackedFile{
 		RepairPath: up.Source,
 	}
 	r.saveSync()
+	r.saveArchive()
 	err = r.saveFile(f)
 	r.mu.Unlock(lockID)
 	if err != nil {
@@ -101,3 +176,172 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	r.newRepairs <- f
 	return nil
 }
+
+// UploadStreamFromReader uploads the data read from reader to the network as
+// a file at up.SiaPath. up.Source is ignored. The data is split into chunks as
+// it arrives, and each chunk is erasure coded, encrypted and uploaded before
+// the next chunk is read, so that only one chunk is held in memory at a time.
+// Because the file has no local source, any later repairs will download the
+// missing chunks from the network.
+//
+// If the upload fails, the partially uploaded file is removed from the
+// renter.
+func (r *Renter) UploadStreamFromReader(up modules.FileUploadParams, reader io.Reader) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+
+	if err := r.managedValidateUploadParams(&up); err != nil {
+		return err
+	}
+	if up.Compression != "" {
+		return errCompressedStream
+	}
+	if up.Pack || up.Dedup {
+		return errSharedStream
+	}
+
+	// Create the file object. The size of the file grows as chunks are read
+	// from the stream.
+	f := newFile(up.SiaPath, up.ErasureCode, pieceSize, 0)
+	f.mode = uint32(defaultStreamFileMode)
+	f.expireHeight = up.ExpirationHeight
+
+	// Add the file to the renter. The file is tracked without a repair path.
+	// The file that it replaces is kept as an earlier version, but versions
+	// are only pruned once the upload has succeeded, so that the replaced
+	// file can be restored if the upload fails.
+	lockID := r.mu.Lock()
+	prev, replaced := r.files[up.SiaPath]
+	if replaced && !up.Versioned {
+		r.mu.Unlock(lockID)
+		return ErrPathOverload
+	}
+	prevTracking := r.tracking[up.SiaPath]
+	if replaced {
+		r.archiveCurrent(up.SiaPath, prev)
+	}
+	r.addFileEntry(up.SiaPath, f)
+	r.tracking[up.SiaPath] = trackedFile{}
+	r.saveSync()
+	r.saveArchive()
+	err := r.saveFile(f)
+	r.mu.Unlock(lockID)
+	if err == nil {
+		err = r.managedUploadStreamChunks(f, reader, 0)
+	}
+
+	lockID = r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	if err != nil {
+		r.abortStreamUpload(f, prev, prevTracking)
+		r.saveSync()
+		r.saveArchive()
+		return err
+	}
+	if r.pruneVersions(up.SiaPath, time.Now()) {
+		r.saveArchive()
+	}
+	return nil
+}
+
+// abortStreamUpload removes f, a file whose stream upload failed, from the
+// renter, and deletes the sectors that were uploaded for it. If f replaced
+// prev, prev is made the current version of the file again, with the given
+// tracking. Nothing is restored if f is no longer current, as the file has
+// then been changed since the upload began.
+func (r *Renter) abortStreamUpload(f, prev *file, tf trackedFile) {
+	if !r.isCurrent(f) {
+		return
+	}
+	siaPath := f.name
+	r.removeFileEntry(siaPath)
+	delete(r.tracking, siaPath)
+	os.RemoveAll(filepath.Join(r.persistDir, siaPath+ShareExtension))
+	if !r.archiveReferenced(f) {
+		r.releaseFileData(f)
+	}
+
+	if prev == nil {
+		return
+	}
+	if err := r.restoreFile(siaPath, prev); err != nil {
+		r.log.Println("WARN: could not restore", siaPath, "after a failed upload:", err)
+		return
+	}
+	r.tracking[siaPath] = tf
+}
+
+// managedUploadStreamChunks reads the chunks of f from reader one at a time,
+// starting at chunk firstChunk, and hands each of them to the repair loop,
+// waiting for every chunk to be uploaded before the next chunk is read. The
+// file is marked as streaming until all chunks have been uploaded.
+func (r *Renter) managedUploadStreamChunks(f *file, reader io.Reader, firstChunk uint64) error {
+	f.mu.Lock()
+	f.streaming = true
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.streaming = false
+		f.mu.Unlock()
+	}()
+
+	chunkSize := f.chunkSize()
+	for chunkIndex := firstChunk; ; chunkIndex++ {
+		// Read the next chunk. The last chunk is padded with zeroes. Empty
+		// files still need at least one chunk.
+		chunkData := make([]byte, chunkSize)
+		n, err := io.ReadFull(reader, chunkData)
+		if err == io.EOF && chunkIndex > 0 {
+			return nil
+		} else if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return build.ExtendErr("unable to read chunk from stream", err)
+		}
+
+		// Extend the file to cover the chunk before any of its pieces are
+		// uploaded.
+		lockID := r.mu.Lock()
+		f.mu.Lock()
+		f.size += uint64(n)
+		err = r.saveFile(f)
+		f.mu.Unlock()
+		r.mu.Unlock(lockID)
+		if err != nil {
+			return err
+		}
+
+		// Send the chunk to the repair loop and wait for it to be uploaded.
+		sc := streamChunk{
+			chunkID:  chunkID{chunkIndex, f.name},
+			data:     chunkData,
+			doneChan: make(chan error, 1),
+			file:     f,
+		}
+		select {
+		case r.newStreamChunks <- sc:
+		case <-r.tg.StopChan():
+			return errStreamUploadInterrupted
+		}
+		select {
+		case err = <-sc.doneChan:
+		case <-r.tg.StopChan():
+			return errStreamUploadInterrupted
+		}
+		if err != nil {
+			return build.ExtendErr("unable to upload chunk", err)
+		}
+
+		// The chunk must be recoverable before the next chunk is read.
+		f.mu.RLock()
+		uploadedPieces := f.numChunkPieces(chunkIndex)
+		f.mu.RUnlock()
+		if uploadedPieces < f.erasureCode.MinPieces() {
+			return errInsufficientPiecesUploaded
+		}
+
+		if uint64(n) < chunkSize {
+			return nil
+		}
+	}
+}
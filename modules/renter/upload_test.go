@@ -0,0 +1,79 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestUploadStreamNoHosts checks that a stream upload fails when there are no
+// hosts to upload to, and that the partially uploaded file is removed and the
+// file it replaced is restored.
+func TestUploadStreamNoHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestUploadStreamNoHosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	ec, _ := NewRSCode(1, 1)
+	up := modules.FileUploadParams{
+		SiaPath:     "foo/bar",
+		ErasureCode: ec,
+	}
+	err = rt.renter.UploadStreamFromReader(up, bytes.NewReader([]byte("some data")))
+	if err == nil {
+		t.Fatal("expected the upload to fail without any hosts")
+	}
+	if len(rt.renter.FileList()) != 0 {
+		t.Fatal("failed upload was not removed from the renter")
+	}
+	if _, exists := rt.renter.tracking["foo/bar"]; exists {
+		t.Fatal("failed upload is still being tracked")
+	}
+
+	// A failed upload that replaces a file restores the replaced file
+	// instead of keeping the failed upload as a version.
+	prev := newFile("foo/bar", ec, 10, 15)
+	rt.renter.addFileEntry(prev.name, prev)
+	rt.renter.tracking[prev.name] = trackedFile{RepairPath: "/foo/bar"}
+	up.Versioned = true
+	if err := rt.renter.UploadStreamFromReader(up, bytes.NewReader([]byte("some data"))); err == nil {
+		t.Fatal("expected the upload to fail without any hosts")
+	}
+	if f := rt.renter.files["foo/bar"]; f != prev {
+		t.Fatal("replaced file was not restored")
+	}
+	if rt.renter.tracking["foo/bar"].RepairPath != "/foo/bar" {
+		t.Error("restored file lost its repair path")
+	}
+	if len(rt.renter.versions["foo/bar"]) != 0 {
+		t.Error("failed upload left versions behind:", rt.renter.versions["foo/bar"])
+	}
+	if _, archived := rt.renter.archived[prev]; archived {
+		t.Error("restored file is still archived")
+	}
+	up.Versioned = false
+
+	// Stream uploads follow the same nickname rules as regular uploads.
+	up.SiaPath = ""
+	err = rt.renter.UploadStreamFromReader(up, bytes.NewReader(nil))
+	if err != ErrEmptyFilename {
+		t.Fatal("expected ErrEmptyFilename, got", err)
+	}
+
+	// Streams cannot be packed or deduplicated.
+	up.SiaPath = "foo/baz"
+	up.Pack = true
+	if err = rt.renter.UploadStreamFromReader(up, bytes.NewReader(nil)); err != errSharedStream {
+		t.Fatal("expected errSharedStream, got", err)
+	}
+	up.Pack, up.Dedup = false, true
+	if err = rt.renter.UploadStreamFromReader(up, bytes.NewReader(nil)); err != errSharedStream {
+		t.Fatal("expected errSharedStream, got", err)
+	}
+}
@@ -0,0 +1,660 @@
+package renter
+
+// Files that are uploaded with versioning enabled keep the file that they
+// replace as an earlier version, so that the SiaPath refers to a history of
+// files rather than a single file. Earlier versions, along with the files
+// captured by snapshots, are archived: the metadata of each archived file is
+// kept in the archive directory, and its data is kept on the hosts, even once
+// the file is no longer the current version of any SiaPath.
+//
+// An archived file is released once no version or snapshot refers to it. If
+// the file is no longer current, its sectors are then deleted from the hosts.
+// Versions are released when they exceed the renter's retention policy, which
+// limits the number of versions kept per file and the age of each version.
+//
+// Archived files that are no longer current are not repaired, as their local
+// sources have usually been replaced by the newer version. Versions that were
+// still being uploaded when they were replaced are not completed. An archived
+// file that is restored is repaired from the network like any current file.
+//
+// Versions follow their file when it is renamed, so a file cannot be renamed
+// to a SiaPath that still has versions of another file.
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+)
+
+const (
+	// archiveDir is the directory within the renter's persist directory that
+	// holds the metadata of each archived file.
+	archiveDir = "archive"
+
+	// archiveExtension is the extension of the metadata file of an archived
+	// file. It differs from ShareExtension so that archived files are not
+	// loaded as current files.
+	archiveExtension = ".siaarchive"
+
+	// archiveFilename is the file that records the versions and snapshots
+	// that refer to the archived files.
+	archiveFilename = "archive.json"
+)
+
+var (
+	// archiveMetadata is the header of the archive file.
+	archiveMetadata = persist.Metadata{
+		Header:  "Renter Archive",
+		Version: "1.0",
+	}
+
+	// errUnknownVersion is returned when a file has no version with the
+	// requested number.
+	errUnknownVersion = errors.New("no version of the file with that number")
+
+	// versionPruneInterval is the amount of time that the renter waits
+	// between releasing the versions that have exceeded the retention policy.
+	versionPruneInterval = build.Select(build.Var{
+		Standard: time.Hour,
+		Dev:      time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+)
+
+type (
+	// An archivedFile records where the metadata of an archived file is kept.
+	// tracking holds the location of the file within its pack, if the file is
+	// packed. The repair path of the file is not kept, as it is only repaired
+	// once it is restored, and then from the network. refs is the number of
+	// versions and snapshots that refer to the file.
+	archivedFile struct {
+		id       string
+		refs     int
+		tracking trackedFile
+	}
+
+	// A fileVersion is an earlier version of the file at a SiaPath. Versions
+	// are numbered in the order in which they were archived.
+	fileVersion struct {
+		file     *file
+		version  uint64
+		archived time.Time
+	}
+
+	// versionRetention limits the versions that are kept of each file. A
+	// limit of zero means that the number or the age of versions is not
+	// limited. MaxAge is in seconds.
+	versionRetention struct {
+		MaxVersions uint64
+		MaxAge      uint64
+	}
+
+	// persistedVersion is the persisted form of a fileVersion.
+	persistedVersion struct {
+		ID       string
+		Version  uint64
+		Archived time.Time
+	}
+
+	// persistedSnapshot is the persisted form of a snapshot. Files maps the
+	// SiaPath of each file in the snapshot to its archive ID.
+	persistedSnapshot struct {
+		Name    string
+		Dir     string
+		Created time.Time
+		Files   map[string]string
+	}
+)
+
+// newArchiveID returns a random ID for a newly archived file.
+func newArchiveID() string {
+	b, _ := crypto.RandBytes(16)
+	return hex.EncodeToString(b)
+}
+
+// archivePath returns the location of the metadata file of an archived file.
+func (r *Renter) archivePath(id string) string {
+	return filepath.Join(r.persistDir, archiveDir, id+archiveExtension)
+}
+
+// saveArchivedFile saves the metadata of an archived file to the archive
+// directory.
+func (r *Renter) saveArchivedFile(f *file) error {
+	return saveFileAt(f, r.archivePath(r.archived[f].id))
+}
+
+// saveArchive saves the versions and snapshots of the renter, along with the
+// retention policy.
+func (r *Renter) saveArchive() error {
+	data := struct {
+		Files     map[string]trackedFile
+		Retention versionRetention
+		Snapshots []persistedSnapshot
+		Versions  map[string][]persistedVersion
+	}{
+		Files:     make(map[string]trackedFile, len(r.archived)),
+		Retention: r.retention,
+		Versions:  make(map[string][]persistedVersion, len(r.versions)),
+	}
+	for _, af := range r.archived {
+		data.Files[af.id] = af.tracking
+	}
+	for siaPath, versions := range r.versions {
+		for _, v := range versions {
+			data.Versions[siaPath] = append(data.Versions[siaPath], persistedVersion{
+				ID:       r.archived[v.file].id,
+				Version:  v.version,
+				Archived: v.archived,
+			})
+		}
+	}
+	for _, s := range r.snapshots {
+		ps := persistedSnapshot{
+			Name:    s.name,
+			Dir:     s.dir,
+			Created: s.created,
+			Files:   make(map[string]string, len(s.files)),
+		}
+		for siaPath, f := range s.files {
+			ps.Files[siaPath] = r.archived[f].id
+		}
+		data.Snapshots = append(data.Snapshots, ps)
+	}
+	return persist.SaveFileSync(archiveMetadata, data, filepath.Join(r.persistDir, archiveFilename))
+}
+
+// loadArchivedFile loads the metadata of an archived file from the archive
+// directory.
+func (r *Renter) loadArchivedFile(id string) (*file, error) {
+	handle, err := os.Open(r.archivePath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	files, err := readSharedFiles(handle)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) != 1 {
+		return nil, errors.New("archived file does not hold exactly one file")
+	}
+	if r.resolveHostKeys(files[0]) {
+		if err := saveFileAt(files[0], r.archivePath(id)); err != nil {
+			return nil, err
+		}
+	}
+	return files[0], nil
+}
+
+// loadArchive loads the archived files, versions, and snapshots. It must be
+// called after the current files have been loaded, as an archived file that
+// is still current shares the metadata of the current file. Errors
+// encountered while loading an archived file are logged, but are not
+// considered fatal.
+func (r *Renter) loadArchive() error {
+	var data struct {
+		Files     map[string]trackedFile
+		Retention versionRetention
+		Snapshots []persistedSnapshot
+		Versions  map[string][]persistedVersion
+	}
+	err := persist.LoadFile(archiveMetadata, &data, filepath.Join(r.persistDir, archiveFilename))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	r.retention = data.Retention
+
+	current := make(map[crypto.TwofishKey]*file, len(r.files))
+	for _, f := range r.files {
+		current[f.masterKey] = f
+	}
+	files := make(map[string]*file, len(data.Files))
+	for id, tf := range data.Files {
+		f, err := r.loadArchivedFile(id)
+		if err != nil {
+			r.log.Println("ERROR: could not load archived file:", id, err)
+			continue
+		}
+		if cf, exists := current[f.masterKey]; exists {
+			f = cf
+		} else {
+			r.linkDedupChunks(f)
+		}
+		r.archived[f] = archivedFile{
+			id:       id,
+			tracking: tf,
+		}
+		files[id] = f
+	}
+	addRef := func(f *file) {
+		af := r.archived[f]
+		af.refs++
+		r.archived[f] = af
+	}
+	for siaPath, versions := range data.Versions {
+		for _, pv := range versions {
+			if f, exists := files[pv.ID]; exists {
+				addRef(f)
+				r.versions[siaPath] = append(r.versions[siaPath], fileVersion{
+					file:     f,
+					version:  pv.Version,
+					archived: pv.Archived,
+				})
+			}
+		}
+	}
+	for _, ps := range data.Snapshots {
+		s := &snapshot{
+			name:    ps.Name,
+			dir:     ps.Dir,
+			created: ps.Created,
+			files:   make(map[string]*file, len(ps.Files)),
+		}
+		for siaPath, id := range ps.Files {
+			if f, exists := files[id]; exists {
+				addRef(f)
+				s.files[siaPath] = f
+			}
+		}
+		r.snapshots[s.name] = s
+	}
+	return nil
+}
+
+// persistFile saves the metadata of a file wherever the renter keeps it:
+// packs are saved to the packs directory, current files to the renter
+// directory, and archived files to the archive directory. Files that have
+// been deleted are not saved. f must be locked.
+func (r *Renter) persistFile(f *file) error {
+	var err error
+	if p, isPack := r.packs[f.name]; isPack && p == f {
+		err = r.savePack(f)
+	} else if r.isCurrent(f) {
+		err = r.saveFile(f)
+	}
+	if _, archived := r.archived[f]; archived && err == nil {
+		err = r.saveArchivedFile(f)
+	}
+	return err
+}
+
+// isCurrent returns true if f is the current version of the file at its
+// SiaPath.
+func (r *Renter) isCurrent(f *file) bool {
+	cf, exists := r.files[f.name]
+	return exists && cf == f
+}
+
+// archiveFile adds a reference of a version or a snapshot to f, adding f to
+// the archive so that its data is kept once it is no longer current. tf is
+// the tracking of the file while it was current.
+func (r *Renter) archiveFile(f *file, tf trackedFile) {
+	af, exists := r.archived[f]
+	if !exists {
+		af = archivedFile{
+			id: newArchiveID(),
+			tracking: trackedFile{
+				Pack:       tf.Pack,
+				PackOffset: tf.PackOffset,
+			},
+		}
+	}
+	af.refs++
+	r.archived[f] = af
+	f.mu.RLock()
+	err := r.saveArchivedFile(f)
+	f.mu.RUnlock()
+	if err != nil {
+		r.log.Println("WARN: could not save archived file:", err)
+	}
+}
+
+// archiveReferenced returns true if a version or a snapshot refers to f.
+func (r *Renter) archiveReferenced(f *file) bool {
+	return r.archived[f].refs > 0
+}
+
+// releaseArchivedFile drops a reference of a version or a snapshot to f, and
+// removes f from the archive once no version or snapshot refers to it. Unless
+// f is still current, it is then removed from its pack or from the index of
+// deduplicated chunks, and the sectors that store its data are deleted from
+// the hosts in the background.
+func (r *Renter) releaseArchivedFile(f *file) {
+	af, exists := r.archived[f]
+	if !exists {
+		return
+	}
+	af.refs--
+	if af.refs > 0 {
+		r.archived[f] = af
+		return
+	}
+	delete(r.archived, f)
+	os.RemoveAll(r.archivePath(af.id))
+	if r.isCurrent(f) {
+		return
+	}
+	r.releaseFileData(f)
+}
+
+// releaseFileData releases the data of f, which is no longer kept by the
+// renter. The sectors of f are deleted from the hosts, unless f is stored in a
+// pack or in deduplicated chunks, in which case its references to them are
+// removed instead.
+func (r *Renter) releaseFileData(f *file) {
+	r.chunkCache.invalidate(f.masterKey)
+	if f.pack != nil || len(f.chunkHashes) != 0 {
+		r.removePackMember(f)
+		r.unlinkDedupChunks(f)
+		return
+	}
+	f.mu.RLock()
+	var contracts []fileContract
+	for _, fc := range f.contracts {
+		contracts = append(contracts, fc)
+	}
+	f.mu.RUnlock()
+	go r.threadedDeleteSectors(contracts)
+}
+
+// addVersion keeps f, which is no longer the current version of the file at
+// siaPath, as the latest earlier version of the file. tf is the tracking of f
+// while it was current. The caller is responsible for calling pruneVersions.
+func (r *Renter) addVersion(siaPath string, f *file, tf trackedFile) {
+	number := uint64(1)
+	if versions := r.versions[siaPath]; len(versions) != 0 {
+		number = versions[len(versions)-1].version + 1
+	}
+	r.archiveFile(f, tf)
+	r.versions[siaPath] = append(r.versions[siaPath], fileVersion{
+		file:     f,
+		version:  number,
+		archived: time.Now(),
+	})
+}
+
+// moveVersions moves the earlier versions of the file at oldPath to newPath,
+// which must not have versions of its own.
+func (r *Renter) moveVersions(oldPath, newPath string) {
+	if versions, exists := r.versions[oldPath]; exists {
+		delete(r.versions, oldPath)
+		r.versions[newPath] = versions
+	}
+}
+
+// replaceFile prepares siaPath for the upload of a new file. If a file
+// already exists at siaPath, it is kept as an earlier version when versioned
+// is set, and ErrPathOverload is returned otherwise.
+func (r *Renter) replaceFile(siaPath string, versioned bool) error {
+	f, exists := r.files[siaPath]
+	if !exists {
+		return nil
+	}
+	if !versioned {
+		return ErrPathOverload
+	}
+	r.archiveCurrent(siaPath, f)
+	r.pruneVersions(siaPath, time.Now())
+	return nil
+}
+
+// archiveCurrent removes f, the current version of the file at siaPath, from
+// the renter's files and keeps it as the latest earlier version of the file.
+func (r *Renter) archiveCurrent(siaPath string, f *file) {
+	tf := r.tracking[siaPath]
+	r.removeFileEntry(siaPath)
+	delete(r.tracking, siaPath)
+	os.RemoveAll(filepath.Join(r.persistDir, siaPath+ShareExtension))
+	r.addVersion(siaPath, f, tf)
+}
+
+// removeFile removes f, the current version of the file at siaPath, from the
+// renter. If the file has earlier versions, it is kept as the latest version
+// so that the deletion can be undone. The data of the file is kept for as
+// long as a version or a snapshot refers to it.
+func (r *Renter) removeFile(siaPath string, f *file) {
+	if len(r.versions[siaPath]) != 0 {
+		r.archiveCurrent(siaPath, f)
+		r.pruneVersions(siaPath, time.Now())
+		return
+	}
+	r.removeFileEntry(siaPath)
+	delete(r.tracking, siaPath)
+	os.RemoveAll(filepath.Join(r.persistDir, f.name+ShareExtension))
+	if r.archiveReferenced(f) {
+		return
+	}
+	r.releaseFileData(f)
+}
+
+// pruneVersions releases the versions of the file at siaPath that exceed the
+// retention policy at the given time. true is returned if any version was
+// released.
+func (r *Renter) pruneVersions(siaPath string, now time.Time) bool {
+	versions := r.versions[siaPath]
+	var kept []fileVersion
+	var released []*file
+	for i, v := range versions {
+		tooMany := r.retention.MaxVersions != 0 && uint64(len(versions)-i) > r.retention.MaxVersions
+		tooOld := r.retention.MaxAge != 0 && now.Sub(v.archived) > time.Duration(r.retention.MaxAge)*time.Second
+		if tooMany || tooOld {
+			released = append(released, v.file)
+		} else {
+			kept = append(kept, v)
+		}
+	}
+	if len(released) == 0 {
+		return false
+	}
+	if len(kept) == 0 {
+		delete(r.versions, siaPath)
+	} else {
+		r.versions[siaPath] = kept
+	}
+	for _, f := range released {
+		r.releaseArchivedFile(f)
+	}
+	return true
+}
+
+// pruneAllVersions releases the versions of every file that exceed the
+// retention policy. true is returned if any version was released.
+func (r *Renter) pruneAllVersions() bool {
+	pruned := false
+	now := time.Now()
+	for siaPath := range r.versions {
+		if r.pruneVersions(siaPath, now) {
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// threadedPruneVersions periodically releases the versions that have
+// exceeded the maximum age of the retention policy.
+func (r *Renter) threadedPruneVersions() {
+	for {
+		select {
+		case <-time.After(versionPruneInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+
+		id := r.mu.Lock()
+		if r.pruneAllVersions() {
+			if err := r.saveArchive(); err != nil {
+				r.log.Println("WARN: could not save the archive:", err)
+			}
+		}
+		r.mu.Unlock(id)
+	}
+}
+
+// restoreFile makes the archived file f the current version of the file at
+// siaPath. The file that it replaces is kept as an earlier version. If f is
+// currently the file at another SiaPath, it is moved to siaPath.
+func (r *Renter) restoreFile(siaPath string, f *file) error {
+	cf, exists := r.files[siaPath]
+	if exists && cf == f {
+		return nil
+	}
+	if !exists {
+		if err := r.checkPathConflict(siaPath); err != nil {
+			return err
+		}
+	}
+
+	// The replaced file is archived first, so that it is numbered after f.
+	if exists {
+		r.archiveCurrent(siaPath, cf)
+	}
+
+	// f is no longer an earlier version of any file.
+	var versionRefs int
+	for versionPath, versions := range r.versions {
+		for i, v := range versions {
+			if v.file == f {
+				r.versions[versionPath] = append(versions[:i], versions[i+1:]...)
+				versionRefs++
+				break
+			}
+		}
+		if len(r.versions[versionPath]) == 0 {
+			delete(r.versions, versionPath)
+		}
+	}
+
+	if r.isCurrent(f) {
+		oldPath := f.name
+		if err := r.moveFile(f, siaPath); err != nil {
+			return err
+		}
+		os.RemoveAll(filepath.Join(r.persistDir, oldPath+ShareExtension))
+	} else {
+		f.mu.Lock()
+		f.name = siaPath
+		err := r.saveFile(f)
+		f.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		r.addFileEntry(siaPath, f)
+		r.tracking[siaPath] = r.archived[f].tracking
+	}
+
+	// The archive no longer needs to keep f if it was only kept as a
+	// version.
+	for i := 0; i < versionRefs; i++ {
+		r.releaseArchivedFile(f)
+	}
+	r.pruneVersions(siaPath, time.Now())
+	return nil
+}
+
+// findVersion returns the version of the file at siaPath with the given
+// number.
+func (r *Renter) findVersion(siaPath string, version uint64) (*file, error) {
+	for _, v := range r.versions[siaPath] {
+		if v.version == version {
+			return v.file, nil
+		}
+	}
+	return nil, errUnknownVersion
+}
+
+// managedDownloadArchived downloads an archived file, which is reported under
+// siaPath, to destination. Downloads of archived files are not resumed after
+// a restart, as they cannot be told apart from downloads of the current file.
+func (r *Renter) managedDownloadArchived(f *file, siaPath, destination string) error {
+	d := newDownload(f, destination)
+	d.siapath = siaPath
+	d.archived = true
+	return r.managedQueueDownload(d)
+}
+
+// FileVersions returns information on the earlier versions of the file at
+// siaPath, from oldest to newest.
+func (r *Renter) FileVersions(siaPath string) ([]modules.FileVersionInfo, error) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	versions := r.versions[siaPath]
+	if _, exists := r.files[siaPath]; !exists && len(versions) == 0 {
+		return nil, ErrUnknownPath
+	}
+	infos := make([]modules.FileVersionInfo, 0, len(versions))
+	for _, v := range versions {
+		v.file.mu.RLock()
+		infos = append(infos, modules.FileVersionInfo{
+			Version:        v.version,
+			Filesize:       v.file.size,
+			Available:      v.file.available(),
+			UploadProgress: v.file.uploadProgress(),
+			Archived:       v.archived,
+		})
+		v.file.mu.RUnlock()
+	}
+	return infos, nil
+}
+
+// DownloadVersion downloads an earlier version of the file at siaPath to
+// destination.
+func (r *Renter) DownloadVersion(siaPath string, version uint64, destination string) error {
+	lockID := r.mu.RLock()
+	f, err := r.findVersion(siaPath, version)
+	r.mu.RUnlock(lockID)
+	if err != nil {
+		return err
+	}
+	return r.managedDownloadArchived(f, siaPath, destination)
+}
+
+// RestoreVersion makes an earlier version of the file at siaPath the current
+// version. The current version, if any, is kept as the latest earlier
+// version.
+func (r *Renter) RestoreVersion(siaPath string, version uint64) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	f, err := r.findVersion(siaPath, version)
+	if err != nil {
+		return err
+	}
+	if err := r.restoreFile(siaPath, f); err != nil {
+		return err
+	}
+	if err := r.saveSync(); err != nil {
+		return err
+	}
+	return r.saveArchive()
+}
+
+// DeleteVersion removes an earlier version of the file at siaPath. The data
+// of the version is deleted from the hosts unless a snapshot still refers to
+// it.
+func (r *Renter) DeleteVersion(siaPath string, version uint64) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	versions := r.versions[siaPath]
+	for i, v := range versions {
+		if v.version != version {
+			continue
+		}
+		if len(versions) == 1 {
+			delete(r.versions, siaPath)
+		} else {
+			r.versions[siaPath] = append(versions[:i], versions[i+1:]...)
+		}
+		r.releaseArchivedFile(v.file)
+		return r.saveArchive()
+	}
+	return errUnknownVersion
+}
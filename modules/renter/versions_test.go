@@ -0,0 +1,235 @@
+package renter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestPruneVersions checks that versions exceeding the retention policy are
+// released, oldest first.
+func TestPruneVersions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestPruneVersions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	id := rt.renter.mu.Lock()
+	for i := 0; i < 4; i++ {
+		rt.renter.addVersion("foo", newFile("foo", rsc, pieceSize, 10), trackedFile{})
+	}
+	rt.renter.retention = versionRetention{MaxVersions: 2}
+	if len(rt.renter.versions["foo"]) != 4 {
+		t.Fatal("versions were released before pruning")
+	}
+	pruned := rt.renter.pruneVersions("foo", time.Now())
+	versions := rt.renter.versions["foo"]
+	numArchived := len(rt.renter.archived)
+	rt.renter.mu.Unlock(id)
+	if !pruned || len(versions) != 2 || versions[0].version != 3 || versions[1].version != 4 {
+		t.Fatal("wrong versions were kept:", versions)
+	}
+	if numArchived != 2 {
+		t.Fatal("released versions were not removed from the archive")
+	}
+
+	// Versions older than the maximum age are released.
+	id = rt.renter.mu.Lock()
+	rt.renter.retention = versionRetention{MaxAge: 60}
+	pruned = rt.renter.pruneVersions("foo", time.Now().Add(time.Hour))
+	_, exists := rt.renter.versions["foo"]
+	rt.renter.mu.Unlock(id)
+	if !pruned || exists {
+		t.Fatal("old versions were not released")
+	}
+}
+
+// TestRenameVersions checks that the versions of a file follow it when the
+// file or its directory is renamed, and that a file cannot be renamed to a
+// SiaPath that still has versions.
+func TestRenameVersions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenameVersions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	id := rt.renter.mu.Lock()
+	rt.renter.addFileEntry("foo", newFile("foo", rsc, pieceSize, 10))
+	rt.renter.addVersion("foo", newFile("foo", rsc, pieceSize, 10), trackedFile{})
+	rt.renter.addVersion("baz", newFile("baz", rsc, pieceSize, 10), trackedFile{})
+	rt.renter.addFileEntry("dir/a", newFile("dir/a", rsc, pieceSize, 10))
+	rt.renter.addVersion("dir/a", newFile("dir/a", rsc, pieceSize, 10), trackedFile{})
+	rt.renter.addVersion("dir/b", newFile("dir/b", rsc, pieceSize, 10), trackedFile{})
+	rt.renter.mu.Unlock(id)
+
+	if err := rt.renter.RenameFile("foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.renter.versions["foo"]) != 0 || len(rt.renter.versions["bar"]) != 1 {
+		t.Error("versions did not follow the renamed file:", rt.renter.versions)
+	}
+	if err := rt.renter.RenameFile("bar", "baz"); err != ErrPathOverload {
+		t.Error("expected ErrPathOverload, got", err)
+	}
+
+	if err := rt.renter.RenameDir("dir", "dir2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.renter.versions["dir2/a"]) != 1 || len(rt.renter.versions["dir2/b"]) != 1 {
+		t.Error("versions did not follow the renamed directory:", rt.renter.versions)
+	}
+	if len(rt.renter.versions["dir/a"]) != 0 || len(rt.renter.versions["dir/b"]) != 0 {
+		t.Error("versions were left behind by the renamed directory:", rt.renter.versions)
+	}
+}
+
+// TestArchiveRefs checks that an archived file is kept until every version
+// and snapshot that refers to it is released.
+func TestArchiveRefs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestArchiveRefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	f := newFile("foo", rsc, pieceSize, 10)
+	id := rt.renter.mu.Lock()
+	defer rt.renter.mu.Unlock(id)
+	rt.renter.archiveFile(f, trackedFile{})
+	rt.renter.archiveFile(f, trackedFile{})
+	if !rt.renter.archiveReferenced(f) {
+		t.Fatal("archived file is not referenced")
+	}
+	rt.renter.releaseArchivedFile(f)
+	if !rt.renter.archiveReferenced(f) {
+		t.Fatal("archived file was released while still referenced")
+	}
+	rt.renter.releaseArchivedFile(f)
+	if _, exists := rt.renter.archived[f]; exists {
+		t.Fatal("archived file was kept after every reference was released")
+	}
+}
+
+// TestVersionedUpload checks that versioned uploads keep the file that they
+// replace, that versions can be restored and deleted, and that versions
+// survive a reload of the renter.
+func TestVersionedUpload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestVersionedUpload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	sourceDir := build.TempDir("renter", "TestVersionedUpload", "sources")
+	if err := os.MkdirAll(sourceDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(1, 1)
+	upload := func(size int, versioned bool) error {
+		data, err := crypto.RandBytes(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := filepath.Join(sourceDir, "source")
+		if err := ioutil.WriteFile(source, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return rt.renter.Upload(modules.FileUploadParams{
+			Source:      source,
+			SiaPath:     "foo",
+			ErasureCode: rsc,
+			Versioned:   versioned,
+		})
+	}
+
+	if err := upload(10, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload(20, false); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+	if err := upload(20, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload(30, true); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := rt.renter.FileVersions("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version != 1 || versions[0].Filesize != 10 || versions[1].Filesize != 20 {
+		t.Fatal("wrong versions:", versions)
+	}
+
+	// Restoring the first version keeps the current file as a version.
+	if err := rt.renter.RestoreVersion("foo", 1); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := rt.renter.File("foo"); err != nil || fi.Filesize != 10 {
+		t.Fatal("version was not restored:", fi, err)
+	}
+	versions, _ = rt.renter.FileVersions("foo")
+	if len(versions) != 2 || versions[0].Filesize != 20 || versions[1].Version != 3 || versions[1].Filesize != 30 {
+		t.Fatal("wrong versions after restore:", versions)
+	}
+	if err := rt.renter.RestoreVersion("foo", 1); err != errUnknownVersion {
+		t.Fatal("expected errUnknownVersion, got", err)
+	}
+
+	// Deleting the file keeps it as the latest version.
+	if err := rt.renter.DeleteFile("foo"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err = rt.renter.FileVersions("foo")
+	if err != nil || len(versions) != 3 || versions[2].Filesize != 10 {
+		t.Fatal("deleted file was not kept as a version:", versions, err)
+	}
+	if err := rt.renter.DeleteVersion("foo", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload the renter. The versions should be loaded from the archive.
+	id := rt.renter.mu.Lock()
+	rt.renter.files = make(map[string]*file)
+	rt.renter.archived = make(map[*file]archivedFile)
+	rt.renter.versions = make(map[string][]fileVersion)
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err = rt.renter.FileVersions("foo")
+	if err != nil || len(versions) != 2 || versions[0].Version != 3 || versions[1].Version != 4 {
+		t.Fatal("versions were not reloaded:", versions, err)
+	}
+	if err := rt.renter.RestoreVersion("foo", 4); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := rt.renter.File("foo"); err != nil || fi.Filesize != 10 {
+		t.Fatal("reloaded version was not restored:", fi, err)
+	}
+}
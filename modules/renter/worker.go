@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/contractor"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -20,6 +22,12 @@ type (
 		dataRoot   crypto.Hash
 		pieceIndex uint64
 
+		// pieceOffset and pieceLength describe the section of the piece that
+		// is needed. A pieceLength of zero means that the whole piece is
+		// needed.
+		pieceOffset uint64
+		pieceLength uint64
+
 		chunkDownload *chunkDownload
 
 		// resultChan is a channel that the worker will use to return the
@@ -33,7 +41,7 @@ type (
 		data          []byte
 		err           error
 		pieceIndex    uint64
-		workerID      types.FileContractID
+		workerID      string
 	}
 
 	// finishedUpload contains the Merkle root and error from performing an
@@ -43,16 +51,18 @@ type (
 		dataRoot   crypto.Hash
 		err        error
 		pieceIndex uint64
-		workerID   types.FileContractID
+		workerID   string
 	}
 
 	// uploadWork contains instructions to upload a piece to a host, and a
 	// channel for returning the results.
 	uploadWork struct {
-		// data is the payload of the upload.
+		// data is the payload of the upload. generation is the generation of
+		// the file that the data was encoded from.
 		chunkID    chunkID
 		data       []byte
 		file       *file
+		generation uint64
 		pieceIndex uint64
 
 		// resultChan is a channel that the worker will use to return the
@@ -63,8 +73,12 @@ type (
 	// A worker listens for work on a certain host.
 	worker struct {
 		// contractID specifies which contract the worker specifically works
-		// with.
+		// with, and hostKey is the public key of the host of the contract.
+		// Workers are identified by the public key of their host, so that
+		// the pieces stored with a host can still be reached after its
+		// contract is renewed.
 		contractID types.FileContractID
+		hostKey    types.SiaPublicKey
 
 		// If there is work on all three channels, the worker will first do all
 		// of the work in the download chan, then all of the work in the
@@ -92,33 +106,165 @@ type (
 	}
 )
 
-// download will perform some download work.
+// download will perform some download work. The piece is downloaded in a
+// separate goroutine, and the worker gives up on it as soon as the chunk has
+// been recovered from other pieces, so that a slow overdrive piece holds up
+// neither the worker nor the download loop. An abandoned transfer runs to
+// completion in the background, and its result is discarded.
 func (w *worker) download(dw downloadWork) {
-	d, err := w.renter.hostContractor.Downloader(w.contractID)
-	if err != nil {
+	// Skip the download if the chunk has already been recovered from other
+	// pieces.
+	if dw.chunkDownload.recovered() {
+		w.renter.managedRecordDownload(w.hostKey, 0, 0, errPieceCancelled)
 		select {
-		case dw.resultChan <- finishedDownload{dw.chunkDownload, nil, err, dw.pieceIndex, w.contractID}:
+		case dw.resultChan <- finishedDownload{dw.chunkDownload, nil, errPieceCancelled, dw.pieceIndex, w.id()}:
 		case <-w.renter.tg.StopChan():
 		}
 		return
 	}
-	defer d.Close()
 
-	data, err := d.Sector(dw.dataRoot)
+	pieceChan := make(chan finishedDownload, 1)
+	go w.threadedDownloadPiece(dw, pieceChan)
+	var result finishedDownload
 	select {
-	case dw.resultChan <- finishedDownload{dw.chunkDownload, data, err, dw.pieceIndex, w.contractID}:
+	case result = <-pieceChan:
+	case <-dw.chunkDownload.recoveredChan:
+		result = finishedDownload{dw.chunkDownload, nil, errPieceCancelled, dw.pieceIndex, w.id()}
+	}
+	select {
+	case dw.resultChan <- result:
 	case <-w.renter.tg.StopChan():
 	}
 }
 
+// threadedDownloadPiece downloads the piece described by dw from the host of
+// the worker, and sends the result on pieceChan, which must be buffered. The
+// transfer is skipped if the chunk is recovered while the worker waits for
+// the bandwidth limits to allow the download.
+func (w *worker) threadedDownloadPiece(dw downloadWork, pieceChan chan<- finishedDownload) {
+	if err := w.renter.tg.Add(); err != nil {
+		pieceChan <- finishedDownload{dw.chunkDownload, nil, err, dw.pieceIndex, w.id()}
+		return
+	}
+	defer w.renter.tg.Done()
+
+	// Wait until the bandwidth limits allow the download.
+	size := dw.size()
+	if err := w.renter.managedWaitDownload(size); err != nil {
+		pieceChan <- finishedDownload{dw.chunkDownload, nil, err, dw.pieceIndex, w.id()}
+		return
+	}
+	if dw.chunkDownload.recovered() {
+		w.renter.managedRecordDownload(w.hostKey, 0, 0, errPieceCancelled)
+		pieceChan <- finishedDownload{dw.chunkDownload, nil, errPieceCancelled, dw.pieceIndex, w.id()}
+		return
+	}
+
+	start := time.Now()
+	d, err := w.renter.hostContractor.Downloader(w.contractID)
+	if err != nil {
+		w.renter.managedRecordDownload(w.hostKey, size, time.Since(start), err)
+		pieceChan <- finishedDownload{dw.chunkDownload, nil, err, dw.pieceIndex, w.id()}
+		return
+	}
+	defer d.Close()
+
+	var data []byte
+	if dw.pieceLength > 0 {
+		data, err = downloadPieceSection(d, dw)
+	} else {
+		data, err = d.Sector(dw.dataRoot)
+	}
+	w.renter.managedRecordDownload(w.hostKey, size, time.Since(start), err)
+	if err == nil {
+		w.renter.bandwidth.downloadMeter.record(size)
+	}
+	pieceChan <- finishedDownload{dw.chunkDownload, data, err, dw.pieceIndex, w.id()}
+}
+
+// size returns the number of bytes that are downloaded from the host to
+// complete the download work.
+func (dw downloadWork) size() uint64 {
+	if dw.pieceLength == 0 {
+		return modules.SectorSize
+	}
+	var size uint64
+	for _, action := range pieceSectionActions(dw.dataRoot, dw.pieceOffset, dw.pieceLength) {
+		size += action.Length
+	}
+	return size
+}
+
+// pieceSectionActions returns the download actions that fetch the sector
+// segments covering a section of an encrypted piece, along with the segment
+// holding the nonce of the piece. The nonce is always in the first action, and
+// the section is always in the last action.
+func pieceSectionActions(root crypto.Hash, pieceOffset, pieceLength uint64) []modules.DownloadAction {
+	// The sector holds the nonce, followed by the encrypted piece.
+	sectionStart := crypto.TwofishNonceSize + pieceOffset
+	sectionEnd := sectionStart + pieceLength
+	segStart := sectionStart / crypto.SegmentSize
+	segEnd := (sectionEnd + crypto.SegmentSize - 1) / crypto.SegmentSize
+
+	var actions []modules.DownloadAction
+	if segStart > 0 {
+		actions = append(actions, modules.DownloadAction{
+			MerkleRoot: root,
+			Offset:     0,
+			Length:     crypto.SegmentSize,
+		})
+	}
+	return append(actions, modules.DownloadAction{
+		MerkleRoot: root,
+		Offset:     segStart * crypto.SegmentSize,
+		Length:     (segEnd - segStart) * crypto.SegmentSize,
+	})
+}
+
+// downloadPieceSection downloads the section of a piece described by dw,
+// returning the nonce of the piece followed by the encrypted bytes of the
+// section. Only the segments of the sector that cover the section and the
+// nonce are downloaded, unless the host does not support range proofs, in
+// which case the whole sector is downloaded.
+func downloadPieceSection(d contractor.Downloader, dw downloadWork) ([]byte, error) {
+	actions := pieceSectionActions(dw.dataRoot, dw.pieceOffset, dw.pieceLength)
+	sections, err := d.PartialSectors(actions)
+	if err == modules.ErrNoRangeProof {
+		sector, err := d.Sector(dw.dataRoot)
+		if err != nil {
+			return nil, err
+		}
+		actions = []modules.DownloadAction{{MerkleRoot: dw.dataRoot, Offset: 0, Length: modules.SectorSize}}
+		sections = [][]byte{sector}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Trim the last section down to the requested bytes of the piece.
+	sectionStart := crypto.TwofishNonceSize + dw.pieceOffset - actions[len(actions)-1].Offset
+	section := sections[len(sections)-1][sectionStart : sectionStart+dw.pieceLength]
+	data := make([]byte, 0, crypto.TwofishNonceSize+dw.pieceLength)
+	data = append(data, sections[0][:crypto.TwofishNonceSize]...)
+	return append(data, section...), nil
+}
+
 // upload will perform some upload work.
 func (w *worker) upload(uw uploadWork) {
+	// Wait until the bandwidth limits allow the upload.
+	if err := w.renter.managedWaitUpload(uint64(len(uw.data))); err != nil {
+		select {
+		case uw.resultChan <- finishedUpload{uw.chunkID, crypto.Hash{}, err, uw.pieceIndex, w.id()}:
+		case <-w.renter.tg.StopChan():
+		}
+		return
+	}
+
 	e, err := w.renter.hostContractor.Editor(w.contractID)
 	if err != nil {
 		w.recentUploadFailure = time.Now()
 		w.consecutiveUploadFailures++
 		select {
-		case uw.resultChan <- finishedUpload{uw.chunkID, crypto.Hash{}, err, uw.pieceIndex, w.contractID}:
+		case uw.resultChan <- finishedUpload{uw.chunkID, crypto.Hash{}, err, uw.pieceIndex, w.id()}:
 		case <-w.renter.tg.StopChan():
 		}
 		return
@@ -130,7 +276,7 @@ func (w *worker) upload(uw uploadWork) {
 		w.recentUploadFailure = time.Now()
 		w.consecutiveUploadFailures++
 		select {
-		case uw.resultChan <- finishedUpload{uw.chunkID, root, err, uw.pieceIndex, w.contractID}:
+		case uw.resultChan <- finishedUpload{uw.chunkID, root, err, uw.pieceIndex, w.id()}:
 		case <-w.renter.tg.StopChan():
 		}
 		return
@@ -138,30 +284,50 @@ func (w *worker) upload(uw uploadWork) {
 
 	// Success - reset the consecutive upload failures count.
 	w.consecutiveUploadFailures = 0
+	w.renter.bandwidth.uploadMeter.record(uint64(len(uw.data)))
 
-	// Update the renter metadata.
+	// Update the renter metadata. The piece is discarded if an update of the
+	// file has replaced the chunk since the piece was encoded.
 	id := w.renter.mu.Lock()
 	uw.file.mu.Lock()
+	if uw.file.generation != uw.generation {
+		uw.file.mu.Unlock()
+		w.renter.mu.Unlock(id)
+		if err := e.Delete(root); err != nil {
+			w.renter.log.Debugln("Unable to delete outdated piece from", w.hostKey.String(), "::", err)
+		}
+		select {
+		case uw.resultChan <- finishedUpload{uw.chunkID, root, errFileUpdated, uw.pieceIndex, w.id()}:
+		case <-w.renter.tg.StopChan():
+		}
+		return
+	}
 	contract, exists := uw.file.contracts[w.contractID]
 	if !exists {
 		contract = fileContract{
-			ID:          w.contractID,
-			IP:          e.Address(),
-			WindowStart: e.EndHeight(),
+			ID:            w.contractID,
+			HostPublicKey: e.HostPublicKey(),
+			WindowStart:   e.EndHeight(),
 		}
 	}
-	contract.Pieces = append(contract.Pieces, pieceData{
+	piece := pieceData{
 		Chunk:      uw.chunkID.index,
 		Piece:      uw.pieceIndex,
 		MerkleRoot: root,
-	})
+	}
+	contract.addPiece(piece)
 	uw.file.contracts[w.contractID] = contract
-	w.renter.saveFile(uw.file)
+	w.renter.persistFile(uw.file)
 	uw.file.mu.Unlock()
+	// Pieces of deduplicated chunks are shared with the other files that
+	// refer to the same chunk.
+	if len(uw.file.chunkHashes) != 0 {
+		w.renter.shareDedupPiece(uw.file, contract, piece)
+	}
 	w.renter.mu.Unlock(id)
 
 	select {
-	case uw.resultChan <- finishedUpload{uw.chunkID, root, err, uw.pieceIndex, w.contractID}:
+	case uw.resultChan <- finishedUpload{uw.chunkID, root, err, uw.pieceIndex, w.id()}:
 	case <-w.renter.tg.StopChan():
 	}
 }
@@ -225,21 +391,34 @@ func (w *worker) threadedWorkLoop() {
 	}
 }
 
+// id returns the identifier of the worker in the worker pool, which is the
+// public key of its host.
+func (w *worker) id() string {
+	return w.hostKey.String()
+}
+
 // updateWorkerPool will grab the set of contracts from the contractor and
-// update the worker pool to match.
+// update the worker pool to match. The worker pool is indexed by the public
+// keys of the hosts, and the worker of a host is replaced when its contract
+// is renewed.
 func (r *Renter) updateWorkerPool() {
 	// Get a map of all the contracts in the contractor.
-	newContracts := make(map[types.FileContractID]struct{})
+	newContracts := make(map[string]modules.RenterContract)
 	for _, nc := range r.hostContractor.Contracts() {
-		newContracts[nc.ID] = struct{}{}
+		newContracts[nc.HostPublicKey.String()] = nc
 	}
 
 	// Add a worker for any contract that does not already have a worker.
-	for id := range newContracts {
-		_, exists := r.workerPool[id]
+	for id, contract := range newContracts {
+		old, exists := r.workerPool[id]
+		if exists && old.contractID != contract.ID {
+			close(old.killChan)
+			exists = false
+		}
 		if !exists {
 			worker := &worker{
-				contractID: id,
+				contractID: contract.ID,
+				hostKey:    contract.HostPublicKey,
 
 				downloadChan:         make(chan downloadWork, 1),
 				killChan:             make(chan struct{}),
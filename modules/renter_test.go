@@ -0,0 +1,64 @@
+package modules
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestAllowanceCheckPrices checks that CheckPrices rejects hosts whose prices
+// exceed the maximum prices of an allowance.
+func TestAllowanceCheckPrices(t *testing.T) {
+	settings := HostExternalSettings{
+		ContractPrice:          types.NewCurrency64(10),
+		DownloadBandwidthPrice: types.NewCurrency64(20),
+		StoragePrice:           types.NewCurrency64(30),
+		UploadBandwidthPrice:   types.NewCurrency64(40),
+	}
+
+	// An allowance without maximum prices accepts any host.
+	if err := (Allowance{}).CheckPrices(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Prices equal to the maximum prices are accepted.
+	a := Allowance{
+		MaxContractPrice:          types.NewCurrency64(10),
+		MaxDownloadBandwidthPrice: types.NewCurrency64(20),
+		MaxStoragePrice:           types.NewCurrency64(30),
+		MaxUploadBandwidthPrice:   types.NewCurrency64(40),
+	}
+	if err := a.CheckPrices(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		a   Allowance
+		err error
+	}{
+		{Allowance{MaxContractPrice: types.NewCurrency64(9)}, ErrMaxContractPrice},
+		{Allowance{MaxDownloadBandwidthPrice: types.NewCurrency64(19)}, ErrMaxDownloadBandwidthPrice},
+		{Allowance{MaxStoragePrice: types.NewCurrency64(29)}, ErrMaxStoragePrice},
+		{Allowance{MaxUploadBandwidthPrice: types.NewCurrency64(39)}, ErrMaxUploadBandwidthPrice},
+	}
+	for _, test := range tests {
+		if err := test.a.CheckPrices(settings); err != test.err {
+			t.Errorf("expected %v, got %v", test.err, err)
+		}
+	}
+
+	// Downloads only depend on the download bandwidth price, and uploads on
+	// the storage and upload bandwidth prices.
+	if err := tests[2].a.CheckDownloadPrices(settings); err != nil {
+		t.Error("storage price should not affect downloads:", err)
+	}
+	if err := tests[1].a.CheckUploadPrices(settings); err != nil {
+		t.Error("download price should not affect uploads:", err)
+	}
+	if err := tests[1].a.CheckDownloadPrices(settings); err != ErrMaxDownloadBandwidthPrice {
+		t.Error("expected", ErrMaxDownloadBandwidthPrice, "got", err)
+	}
+	if err := tests[3].a.CheckUploadPrices(settings); err != ErrMaxUploadBandwidthPrice {
+		t.Error("expected", ErrMaxUploadBandwidthPrice, "got", err)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
@@ -18,6 +20,51 @@ var (
 		Long:  "Add and remove hosts, or list active hosts on the network.",
 		Run:   wrap(hostdbcmd),
 	}
+
+	hostdbViewCmd = &cobra.Command{
+		Use:   "view [pubkey]",
+		Short: "View the details of a host",
+		Long: `View the settings of the host with the given public key, and the
+contribution of each factor to its score. Use 'siac hostdb' to list the
+public keys of the active hosts.`,
+		Run: wrap(hostdbviewcmd),
+	}
+
+	hostdbFilterCmd = &cobra.Command{
+		Use:   "filter",
+		Short: "View the host filter",
+		Long: `View the hosts that are blacklisted or whitelisted. Hosts are listed by
+public key, address, or IP subnet.`,
+		Run: wrap(hostdbfiltercmd),
+	}
+
+	hostdbFilterBlacklistCmd = &cobra.Command{
+		Use:   "blacklist [hosts]",
+		Short: "Blacklist hosts",
+		Long: `Prevent the renter from using the listed hosts. [hosts] is a comma-separated
+list of host public keys (ed25519:...), addresses, and IP subnets in CIDR
+notation. Contracts with blacklisted hosts are not renewed, and their data is
+moved to other hosts. The list replaces any existing filter.`,
+		Run: wrap(hostdbfilterblacklistcmd),
+	}
+
+	hostdbFilterWhitelistCmd = &cobra.Command{
+		Use:   "whitelist [hosts]",
+		Short: "Whitelist hosts",
+		Long: `Only allow the renter to use the listed hosts. [hosts] is a comma-separated
+list of host public keys (ed25519:...), addresses, and IP subnets in CIDR
+notation. Contracts with hosts that are not whitelisted are not renewed, and
+their data is moved to whitelisted hosts. The list replaces any existing
+filter.`,
+		Run: wrap(hostdbfilterwhitelistcmd),
+	}
+
+	hostdbFilterDisableCmd = &cobra.Command{
+		Use:   "disable",
+		Short: "Disable the host filter",
+		Long:  "Allow the renter to use any host.",
+		Run:   wrap(hostdbfilterdisablecmd),
+	}
 )
 
 func hostdbcmd() {
@@ -32,10 +79,106 @@ func hostdbcmd() {
 	}
 	fmt.Println(len(info.Hosts), "active hosts:")
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "Address\tPrice")
+	fmt.Fprintln(w, "Address\tPrice\tPublic Key")
 	for _, host := range info.Hosts {
 		price := host.StoragePrice.Mul(modules.BlockBytesPerMonthTerabyte)
-		fmt.Fprintf(w, "%v\t%v / TB / Month\n", host.NetAddress, currencyUnits(price))
+		fmt.Fprintf(w, "%v\t%v / TB / Month\t%v\n", host.NetAddress, currencyUnits(price), host.PublicKey.String())
 	}
 	w.Flush()
 }
+
+// hostdbviewcmd is the handler for the command `siac hostdb view [pubkey]`.
+// It displays the settings of a host and the breakdown of its score.
+func hostdbviewcmd(pubkey string) {
+	var info api.HostdbHostsGET
+	err := getAPI("/hostdb/hosts/"+pubkey, &info)
+	if err != nil {
+		die("Could not fetch host:", err)
+	}
+	host, sb := info.Entry, info.ScoreBreakdown
+
+	fmt.Println("Host info:")
+	fmt.Printf("\tPublic Key:       %v\n", host.PublicKey.String())
+	fmt.Printf("\tAddress:          %v\n", host.NetAddress)
+	fmt.Printf("\tSubnets:          %v\n", strings.Join(host.IPNets, ", "))
+	fmt.Printf("\tVersion:          %v\n", host.Version)
+	fmt.Printf("\tAccepting:        %v\n", yesNo(host.AcceptingContracts))
+	fmt.Printf("\tFirst Seen:       %v\n", host.FirstSeen)
+	fmt.Printf("\tRemaining:        %v of %v\n", filesizeUnits(int64(host.RemainingStorage)), filesizeUnits(int64(host.TotalStorage)))
+	fmt.Printf("\tStorage Price:    %v / TB / Month\n", currencyUnits(host.StoragePrice.Mul(modules.BlockBytesPerMonthTerabyte)))
+	fmt.Printf("\tCollateral:       %v / TB / Month\n", currencyUnits(host.Collateral.Mul(modules.BlockBytesPerMonthTerabyte)))
+	fmt.Printf("\tContract Price:   %v\n", currencyUnits(host.ContractPrice))
+	fmt.Printf("\tUpload Price:     %v / TB\n", currencyUnits(host.UploadBandwidthPrice.Mul(modules.BytesPerTerabyte)))
+	fmt.Printf("\tDownload Price:   %v / TB\n", currencyUnits(host.DownloadBandwidthPrice.Mul(modules.BytesPerTerabyte)))
+	var successes int
+	for _, scan := range host.ScanHistory {
+		if scan.Success {
+			successes++
+		}
+	}
+	fmt.Printf("\tScans:            %v of %v succeeded\n", successes, len(host.ScanHistory))
+
+	fmt.Println()
+	fmt.Println("Score breakdown:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\tPrice Score:\t%v\n", sb.PriceScore)
+	fmt.Fprintf(w, "\tStorage Remaining:\tx %.6g\n", sb.StorageRemainingAdjustment)
+	fmt.Fprintf(w, "\tUptime:\tx %.6g\n", sb.UptimeAdjustment)
+	fmt.Fprintf(w, "\tAge:\tx %.6g\n", sb.AgeAdjustment)
+	fmt.Fprintf(w, "\tCollateral:\tx %.6g\n", sb.CollateralAdjustment)
+	fmt.Fprintf(w, "\tVersion:\tx %.6g\n", sb.VersionAdjustment)
+	fmt.Fprintf(w, "\tScore:\t%v\n", sb.Score)
+	w.Flush()
+}
+
+// hostdbfiltercmd is the handler for the command `siac hostdb filter`.
+// It displays the host filter.
+func hostdbfiltercmd() {
+	var hf api.HostdbFilterGET
+	err := getAPI("/hostdb/filter", &hf)
+	if err != nil {
+		die("Could not fetch host filter:", err)
+	}
+	switch hf.Filter.Mode {
+	case modules.HostDBFilterBlacklist:
+		fmt.Println(len(hf.Filter.Hosts), "blacklisted hosts:")
+	case modules.HostDBFilterWhitelist:
+		fmt.Println(len(hf.Filter.Hosts), "whitelisted hosts:")
+	default:
+		fmt.Println("The host filter is disabled.")
+		return
+	}
+	for _, host := range hf.Filter.Hosts {
+		fmt.Println("  " + host)
+	}
+}
+
+// hostdbfilterblacklistcmd is the handler for the command
+// `siac hostdb filter blacklist [hosts]`. It blacklists the listed hosts.
+func hostdbfilterblacklistcmd(hosts string) {
+	err := post("/hostdb/filter", "mode="+modules.HostDBFilterBlacklist+"&hosts="+url.QueryEscape(hosts))
+	if err != nil {
+		die("Could not set host filter:", err)
+	}
+	fmt.Println("Blacklisted hosts.")
+}
+
+// hostdbfilterwhitelistcmd is the handler for the command
+// `siac hostdb filter whitelist [hosts]`. It whitelists the listed hosts.
+func hostdbfilterwhitelistcmd(hosts string) {
+	err := post("/hostdb/filter", "mode="+modules.HostDBFilterWhitelist+"&hosts="+url.QueryEscape(hosts))
+	if err != nil {
+		die("Could not set host filter:", err)
+	}
+	fmt.Println("Whitelisted hosts.")
+}
+
+// hostdbfilterdisablecmd is the handler for the command
+// `siac hostdb filter disable`. It disables the host filter.
+func hostdbfilterdisablecmd() {
+	err := post("/hostdb/filter", "mode="+modules.HostDBFilterDisabled)
+	if err != nil {
+		die("Could not set host filter:", err)
+	}
+	fmt.Println("Disabled host filter.")
+}
@@ -23,6 +23,26 @@ var (
 	hostVerbose       bool   // display additional host info
 	renterShowHistory bool   // Show download history in addition to download queue.
 	renterListVerbose bool   // Show additional info about uploaded files.
+	renterUploadPack  bool   // Pack small files into chunks shared with other files.
+	renterUploadDedup bool   // Share identical chunks with other files.
+
+	renterUploadCompression string // Compress files with this algorithm before uploading.
+	renterUploadVersioned   bool   // Keep the replaced file as an earlier version.
+	renterUploadExpiration  uint64 // Block height at which the uploaded file expires.
+	renterDownloadVersion   string // Download an earlier version of a file.
+	renterDownloadSnapshot  string // Download a file from a snapshot.
+	renterSnapshotDir       string // Directory recorded by a new snapshot.
+
+	renterSearchTags   []string // Tags that searched files must have.
+	renterSearchPrefix string   // Path prefix of searched files.
+	renterSearchOffset int      // Number of matching files to skip.
+	renterSearchLimit  int      // Maximum number of files to list.
+
+	renterUploadErasureCode  string // Type of erasure code of uploaded files.
+	renterUploadDataPieces   uint64 // Number of data pieces of the erasure code.
+	renterUploadParityPieces uint64 // Number of parity pieces of the erasure code.
+	renterUploadCopies       uint64 // Number of copies stored by a replication code.
+	renterUploadLocalGroups  uint64 // Number of local groups of a locally repairable code.
 )
 
 // exit codes
@@ -241,6 +261,8 @@ func main() {
 	hostCmd.Flags().BoolVarP(&hostVerbose, "verbose", "v", false, "Display detailed host info")
 
 	root.AddCommand(hostdbCmd)
+	hostdbCmd.AddCommand(hostdbFilterCmd, hostdbViewCmd)
+	hostdbFilterCmd.AddCommand(hostdbFilterBlacklistCmd, hostdbFilterWhitelistCmd, hostdbFilterDisableCmd)
 
 	root.AddCommand(minerCmd)
 	minerCmd.AddCommand(minerStartCmd, minerStopCmd)
@@ -256,11 +278,37 @@ func main() {
 	root.AddCommand(renterCmd)
 	renterCmd.AddCommand(renterFilesDeleteCmd, renterFilesDownloadCmd,
 		renterDownloadsCmd, renterAllowanceCmd, renterSetAllowanceCmd,
-		renterContractsCmd, renterFilesListCmd, renterFilesRenameCmd,
-		renterFilesUploadCmd, renterUploadsCmd, renterExportCmd)
+		renterSetBandwidthCmd, renterSetCacheCmd, renterSetMaxPriceCmd, renterSetOverdriveCmd, renterSetScoreWeightCmd, renterAuditsCmd, renterPerformanceCmd,
+		renterContractsCmd, renterFilesListCmd,
+		renterFilesRenameCmd, renterFilesSearchCmd, renterFilesUpdateCmd, renterFilesUploadCmd, renterUploadsCmd,
+		renterExportCmd, renterDirCmd, renterFileCmd, renterVersionsCmd,
+		renterSetVersionsCmd, renterSnapshotsCmd, renterBackupCmd)
+	renterBackupCmd.AddCommand(renterBackupCreateCmd, renterBackupExportCmd, renterBackupImportCmd, renterBackupRecoverCmd)
+	renterDownloadsCmd.AddCommand(renterDownloadsCancelCmd, renterDownloadsPauseCmd, renterDownloadsResumeCmd)
+	renterFileCmd.AddCommand(renterFileExpireCmd, renterFileHealthCmd, renterFileTagCmd)
+	renterDirCmd.AddCommand(renterDirCreateCmd, renterDirDeleteCmd, renterDirListCmd, renterDirRenameCmd)
+	renterVersionsCmd.AddCommand(renterVersionsDeleteCmd, renterVersionsListCmd, renterVersionsRestoreCmd)
+	renterSnapshotsCmd.AddCommand(renterSnapshotsCreateCmd, renterSnapshotsDeleteCmd, renterSnapshotsFilesCmd, renterSnapshotsRestoreCmd)
 	renterCmd.Flags().BoolVarP(&renterListVerbose, "verbose", "v", false, "Show additional file info such as redundancy")
 	renterDownloadsCmd.Flags().BoolVarP(&renterShowHistory, "history", "H", false, "Show download history in addition to the download queue")
 	renterFilesListCmd.Flags().BoolVarP(&renterListVerbose, "verbose", "v", false, "Show additional file info such as redundancy")
+	renterFilesUploadCmd.Flags().BoolVarP(&renterUploadPack, "pack", "p", false, "Share a chunk with other small files instead of using a chunk of its own")
+	renterFilesUploadCmd.Flags().BoolVarP(&renterUploadDedup, "dedup", "d", false, "Share chunks that are identical to chunks of other deduplicated files")
+	renterFilesUploadCmd.Flags().StringVarP(&renterUploadCompression, "compression", "c", "", "Compress the file before uploading it (gzip)")
+	renterFilesUploadCmd.Flags().BoolVarP(&renterUploadVersioned, "versioned", "k", false, "Keep an existing file at [path] as an earlier version")
+	renterFilesUploadCmd.Flags().Uint64VarP(&renterUploadExpiration, "expire", "e", 0, "Block height at which the file expires and is deleted (0 keeps it forever)")
+	renterFilesUploadCmd.Flags().StringVarP(&renterUploadErasureCode, "erasure-code", "", "", "Erasure code of the file (reedsolomon, replication, or lrc)")
+	renterFilesUploadCmd.Flags().Uint64VarP(&renterUploadDataPieces, "data-pieces", "", 0, "Number of data pieces of a reedsolomon or lrc code")
+	renterFilesUploadCmd.Flags().Uint64VarP(&renterUploadParityPieces, "parity-pieces", "", 0, "Number of parity pieces of a reedsolomon code, or global parity pieces of an lrc code")
+	renterFilesUploadCmd.Flags().Uint64VarP(&renterUploadCopies, "copies", "", 0, "Number of copies stored by a replication code")
+	renterFilesUploadCmd.Flags().Uint64VarP(&renterUploadLocalGroups, "local-groups", "", 0, "Number of groups of data pieces of an lrc code, each with a local parity piece")
+	renterFilesDownloadCmd.Flags().StringVar(&renterDownloadVersion, "version", "", "Download an earlier version of the file")
+	renterFilesDownloadCmd.Flags().StringVar(&renterDownloadSnapshot, "snapshot", "", "Download the file as it was recorded by a snapshot")
+	renterFilesSearchCmd.Flags().StringSliceVarP(&renterSearchTags, "tag", "t", nil, "Only list files with this tag, given as key:value or key (repeatable)")
+	renterFilesSearchCmd.Flags().StringVarP(&renterSearchPrefix, "prefix", "p", "", "Only list files whose path begins with this prefix")
+	renterFilesSearchCmd.Flags().IntVar(&renterSearchOffset, "offset", 0, "Number of matching files to skip")
+	renterFilesSearchCmd.Flags().IntVar(&renterSearchLimit, "limit", 0, "Maximum number of files to list (default: all)")
+	renterSnapshotsCreateCmd.Flags().StringVarP(&renterSnapshotDir, "dir", "d", "", "Directory to record in the snapshot (default: the root directory)")
 	renterExportCmd.AddCommand(renterExportContractsCmd)
 
 	root.AddCommand(gatewayCmd)
@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -12,6 +16,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/api"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 var (
@@ -32,10 +37,31 @@ var (
 	renterDownloadsCmd = &cobra.Command{
 		Use:   "downloads",
 		Short: "View the download queue",
-		Long:  "View the list of files currently downloading.",
+		Long:  "View the list of files currently downloading. Downloads can be paused, resumed, or cancelled using their ID.",
 		Run:   wrap(renterdownloadscmd),
 	}
 
+	renterDownloadsCancelCmd = &cobra.Command{
+		Use:   "cancel [id]",
+		Short: "Cancel a download",
+		Long:  "Cancel a download. Data that has already been downloaded is left at the destination.",
+		Run:   wrap(renterdownloadscancelcmd),
+	}
+
+	renterDownloadsPauseCmd = &cobra.Command{
+		Use:   "pause [id]",
+		Short: "Pause a download",
+		Long:  "Pause a download. Chunks that are already being downloaded are finished first.",
+		Run:   wrap(renterdownloadspausecmd),
+	}
+
+	renterDownloadsResumeCmd = &cobra.Command{
+		Use:   "resume [id]",
+		Short: "Resume a paused download",
+		Long:  "Resume a paused download, continuing from the last downloaded chunk.",
+		Run:   wrap(renterdownloadsresumecmd),
+	}
+
 	renterAllowanceCmd = &cobra.Command{
 		Use:   "allowance",
 		Short: "View the current allowance",
@@ -55,6 +81,72 @@ have a reasonable number (>30) of hosts in your hostdb.`,
 		Run: wrap(rentersetallowancecmd),
 	}
 
+	renterSetBandwidthCmd = &cobra.Command{
+		Use:   "setbandwidth [download] [upload] [total]",
+		Short: "Set the bandwidth limits",
+		Long: `Set the maximum bandwidth used to download data from hosts, to upload data to
+hosts, and for both combined. Limits are given in bytes per second, and
+accept units such as KB and MB. A limit of 0 removes the limit.`,
+		Run: wrap(rentersetbandwidthcmd),
+	}
+
+	renterSetMaxPriceCmd = &cobra.Command{
+		Use:   "setmaxprice [resource] [price]",
+		Short: "Set the maximum price paid to hosts",
+		Long: `Set the maximum price that the renter pays hosts for a resource. Hosts that
+charge more are not used, and their contracts are replaced. [resource] is one
+of contract, download, storage, or upload. The contract price is given in
+currency units (SC, KS, etc.), the storage price in currency units per TB per
+month, and the download and upload prices in currency units per TB. A price of
+0 removes the limit.`,
+		Run: wrap(rentersetmaxpricecmd),
+	}
+
+	renterSetOverdriveCmd = &cobra.Command{
+		Use:   "setoverdrive [pieces]",
+		Short: "Set the number of extra pieces requested when downloading",
+		Long: `Set how many more pieces of each chunk are requested from hosts than are
+needed to recover it. The chunk is recovered from the first pieces to arrive,
+so that slow hosts do not hold up downloads, at the cost of extra bandwidth.
+An overdrive of 0 disables overdrive.`,
+		Run: wrap(rentersetoverdrivecmd),
+	}
+
+	renterSetCacheCmd = &cobra.Command{
+		Use:   "setcache [size]",
+		Short: "Set the size of the chunk cache",
+		Long: `Set the maximum size of the on-disk cache of recovered chunks, e.g. 1GB.
+Files that are downloaded repeatedly are served from the cache instead of the
+hosts. A size of 0 disables the cache.`,
+		Run: wrap(rentersetcachecmd),
+	}
+
+	renterSetScoreWeightCmd = &cobra.Command{
+		Use:   "setscoreweight [factor] [weight]",
+		Short: "Set the weight of a host score factor",
+		Long: `Set how much a factor of the score of a host affects which hosts the renter
+forms contracts with. [factor] is one of price, storage, uptime, age,
+collateral, or version. A weight of 0 ignores the factor. Use 'siac hostdb
+view' to see the contribution of each factor to the score of a host.`,
+		Run: wrap(rentersetscoreweightcmd),
+	}
+
+	renterAuditsCmd = &cobra.Command{
+		Use:   "audits",
+		Short: "View the results of the Renter's audits of its hosts",
+		Long: `View how many of the pieces stored on each host have been audited, and how
+many of them the host failed to prove that it still stores.`,
+		Run: wrap(renterauditscmd),
+	}
+
+	renterPerformanceCmd = &cobra.Command{
+		Use:   "performance",
+		Short: "View the download performance of the Renter's hosts",
+		Long: `View the latency and throughput of each host that the Renter has downloaded
+from, and how many of the downloads from it failed or were cancelled.`,
+		Run: wrap(renterperformancecmd),
+	}
+
 	renterContractsCmd = &cobra.Command{
 		Use:   "contracts",
 		Short: "View the Renter's contracts",
@@ -62,6 +154,78 @@ have a reasonable number (>30) of hosts in your hostdb.`,
 		Run:   wrap(rentercontractscmd),
 	}
 
+	renterDirCmd = &cobra.Command{
+		Use:   "dir",
+		Short: "Perform directory actions",
+		Long:  "List, create, rename, or delete directories. Lists the root directory if no subcommand is given.",
+		Run:   wrap(renterdircmd),
+	}
+
+	renterDirCreateCmd = &cobra.Command{
+		Use:     "create [path]",
+		Aliases: []string{"mkdir"},
+		Short:   "Create a directory",
+		Long:    "Create an empty directory. Missing parent directories are created as well.",
+		Run:     wrap(renterdircreatecmd),
+	}
+
+	renterDirDeleteCmd = &cobra.Command{
+		Use:     "delete [path]",
+		Aliases: []string{"rm"},
+		Short:   "Delete a directory",
+		Long:    "Delete a directory along with every file and directory inside of it. Does not delete any files on disk.",
+		Run:     wrap(renterdirdeletecmd),
+	}
+
+	renterDirListCmd = &cobra.Command{
+		Use:     "list [path]",
+		Aliases: []string{"ls"},
+		Short:   "List a directory",
+		Long:    "List the subdirectories and files of a directory, along with the total size and health of each subdirectory.",
+		Run:     wrap(renterdirlistcmd),
+	}
+
+	renterDirRenameCmd = &cobra.Command{
+		Use:     "rename [path] [newpath]",
+		Aliases: []string{"mv"},
+		Short:   "Rename a directory",
+		Long:    "Rename a directory, moving every file and directory inside of it.",
+		Run:     wrap(renterdirrenamecmd),
+	}
+
+	renterFileCmd = &cobra.Command{
+		Use:   "file",
+		Short: "Inspect a file",
+		Long:  "Inspect how a file is stored on the Sia network.",
+		// Run field not provided; file requires a subcommand
+	}
+
+	renterFileExpireCmd = &cobra.Command{
+		Use:   "expire [path] [height|forever]",
+		Short: "Set the block height at which a file expires",
+		Long: `Set the block height at which a file expires. Once the height is reached, the
+file and its earlier versions are deleted from the renter and the hosts.
+"forever" removes the expiration height, so that the file is kept forever.`,
+		Run: wrap(renterfileexpirecmd),
+	}
+
+	renterFileHealthCmd = &cobra.Command{
+		Use:   "health [path]",
+		Short: "View the health of each chunk of a file",
+		Long: `List the pieces of each chunk of a file, along with the contracts and hosts
+storing them, whether each host is offline, and how many blocks are left until
+each contract ends.`,
+		Run: wrap(renterfilehealthcmd),
+	}
+
+	renterFileTagCmd = &cobra.Command{
+		Use:   "tag [path] [key] [value]",
+		Short: "Set a metadata tag of a file",
+		Long: `Set the value of a metadata tag of a file, such as its contenttype or owner.
+An empty value ("") removes the tag.`,
+		Run: wrap(renterfiletagcmd),
+	}
+
 	renterFilesDeleteCmd = &cobra.Command{
 		Use:     "delete [path]",
 		Aliases: []string{"rm"},
@@ -93,11 +257,152 @@ have a reasonable number (>30) of hosts in your hostdb.`,
 		Run:     wrap(renterfilesrenamecmd),
 	}
 
+	renterFilesSearchCmd = &cobra.Command{
+		Use:   "search",
+		Short: "Search for files by their metadata",
+		Long: `List the files that have every tag given with --tag, as key:value or as key to
+match any value, and whose path begins with --prefix.`,
+		Run: wrap(renterfilessearchcmd),
+	}
+
+	renterFilesUpdateCmd = &cobra.Command{
+		Use:   "update [path] [offset] [source]",
+		Short: "Write data into an uploaded file",
+		Long: `Write the contents of the [source] file into the file at [path] on the Sia
+network, starting at [offset]. Only the chunks that the data overlaps are
+updated on the hosts, and the file is extended if the data runs past its end.`,
+		Run: wrap(renterfilesupdatecmd),
+	}
+
 	renterFilesUploadCmd = &cobra.Command{
 		Use:   "upload [source] [path]",
 		Short: "Upload a file",
-		Long:  "Upload a file to [path] on the Sia network.",
-		Run:   wrap(renterfilesuploadcmd),
+		Long: `Upload a file to [path] on the Sia network. Files smaller than a chunk can
+be packed into a chunk shared with other small files using --pack. An existing
+file at [path] can be kept as an earlier version using --versioned. The file
+can be given a block height at which it expires using --expire.
+
+The file is erasure coded with the renter's default Reed-Solomon code unless
+--erasure-code is given. A reedsolomon code takes --data-pieces and
+--parity-pieces, a replication code takes --copies, and an lrc (locally
+repairable) code takes --data-pieces, --parity-pieces, and --local-groups.`,
+		Run: wrap(renterfilesuploadcmd),
+	}
+
+	renterSetVersionsCmd = &cobra.Command{
+		Use:   "setversions [count] [age]",
+		Short: "Set how many earlier versions of each file are kept",
+		Long: `Set the maximum number of earlier versions kept of each file, and the maximum
+age of each version, e.g. 720h. Versions beyond either limit are deleted from
+the hosts unless a snapshot still refers to them. A limit of 0 removes the
+limit.`,
+		Run: wrap(rentersetversionscmd),
+	}
+
+	renterSnapshotsCmd = &cobra.Command{
+		Use:   "snapshots",
+		Short: "Perform snapshot actions",
+		Long:  "List, create, restore, or delete snapshots of a directory. Lists the snapshots if no subcommand is given.",
+		Run:   wrap(rentersnapshotscmd),
+	}
+
+	renterSnapshotsCreateCmd = &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create a snapshot",
+		Long:  "Record the files in a directory, the root directory by default, as a snapshot.",
+		Run:   wrap(rentersnapshotscreatecmd),
+	}
+
+	renterSnapshotsDeleteCmd = &cobra.Command{
+		Use:     "delete [name]",
+		Aliases: []string{"rm"},
+		Short:   "Delete a snapshot",
+		Long:    "Delete a snapshot. Files that are no longer kept by a version or another snapshot are deleted from the hosts.",
+		Run:     wrap(rentersnapshotsdeletecmd),
+	}
+
+	renterSnapshotsFilesCmd = &cobra.Command{
+		Use:   "files [name]",
+		Short: "List the files in a snapshot",
+		Long:  "List the files in a snapshot. Files can be downloaded from a snapshot with 'siac renter download --snapshot'.",
+		Run:   wrap(rentersnapshotsfilescmd),
+	}
+
+	renterSnapshotsRestoreCmd = &cobra.Command{
+		Use:   "restore [name]",
+		Short: "Restore a snapshot",
+		Long: `Return the directory of a snapshot to the state recorded by the snapshot.
+Files that are replaced or removed are kept as earlier versions.`,
+		Run: wrap(rentersnapshotsrestorecmd),
+	}
+
+	renterBackupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Perform backup actions",
+		Long: `Back up the renter's files and contracts, or recover them using only the
+wallet seed. Shows the most recent backup stored on the hosts if no subcommand
+is given.`,
+		Run: wrap(renterbackupcmd),
+	}
+
+	renterBackupCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Store a backup on the hosts",
+		Long:  "Store an encrypted backup of the renter's files and contracts on the renter's hosts, replacing the previous backup.",
+		Run:   wrap(renterbackupcreatecmd),
+	}
+
+	renterBackupExportCmd = &cobra.Command{
+		Use:   "export [destination]",
+		Short: "Export a backup to a file",
+		Long:  "Write an encrypted backup of the renter's files and contracts to a local file.",
+		Run:   wrap(renterbackupexportcmd),
+	}
+
+	renterBackupImportCmd = &cobra.Command{
+		Use:   "import [source]",
+		Short: "Recover from a backup file",
+		Long:  "Recover the renter's contracts and files from a backup file created with 'siac renter backup export'.",
+		Run:   wrap(renterbackupimportcmd),
+	}
+
+	renterBackupRecoverCmd = &cobra.Command{
+		Use:   "recover",
+		Short: "Recover from the hosts",
+		Long: `Recover the renter's contracts from the blockchain, and its files from the
+most recent backup stored on its hosts. Only the wallet seed is required; the
+wallet must be unlocked.`,
+		Run: wrap(renterbackuprecovercmd),
+	}
+
+	renterVersionsCmd = &cobra.Command{
+		Use:   "versions",
+		Short: "Perform actions on the earlier versions of a file",
+		Long:  "List, restore, or delete the earlier versions of a file.",
+		// Run field not provided; versions requires a subcommand
+	}
+
+	renterVersionsDeleteCmd = &cobra.Command{
+		Use:     "delete [path] [version]",
+		Aliases: []string{"rm"},
+		Short:   "Delete an earlier version of a file",
+		Long:    "Delete an earlier version of a file from the hosts, unless a snapshot still refers to it.",
+		Run:     wrap(renterversionsdeletecmd),
+	}
+
+	renterVersionsListCmd = &cobra.Command{
+		Use:     "list [path]",
+		Aliases: []string{"ls"},
+		Short:   "List the earlier versions of a file",
+		Long:    "List the earlier versions of a file. Versions can be downloaded with 'siac renter download --version'.",
+		Run:     wrap(renterversionslistcmd),
+	}
+
+	renterVersionsRestoreCmd = &cobra.Command{
+		Use:   "restore [path] [version]",
+		Short: "Restore an earlier version of a file",
+		Long:  "Make an earlier version of a file the current file. The current file is kept as the latest version.",
+		Run:   wrap(renterversionsrestorecmd),
 	}
 )
 
@@ -129,9 +434,21 @@ func rentercmd() {
 	Unspent Funds:     %v
 	Total Allocated:   %v
 
+	Download Speed:    %v/s (limit: %v)
+	Upload Speed:      %v/s (limit: %v)
+	Total Limit:       %v
+
+	Chunk Cache:       %v of %v (%v chunks)
+	Cache Hit Rate:    %.2f%% (%v hits, %v misses)
+
 `, currencyUnits(fm.StorageSpending), currencyUnits(fm.UploadSpending),
 		currencyUnits(fm.DownloadSpending), currencyUnits(unspent),
-		currencyUnits(fm.ContractSpending))
+		currencyUnits(fm.ContractSpending),
+		filesizeUnits(int64(rg.Throughput.Download)), bandwidthLimit(rg.Settings.MaxDownloadSpeed),
+		filesizeUnits(int64(rg.Throughput.Upload)), bandwidthLimit(rg.Settings.MaxUploadSpeed),
+		bandwidthLimit(rg.Settings.MaxBandwidth),
+		filesizeUnits(int64(rg.ChunkCache.Size)), filesizeUnits(int64(rg.ChunkCache.MaxSize)), rg.ChunkCache.Chunks,
+		rg.ChunkCache.HitRate*100, rg.ChunkCache.Hits, rg.ChunkCache.Misses)
 
 	// also list files
 	renterfileslistcmd()
@@ -180,7 +497,7 @@ func renterdownloadscmd() {
 	// Filter out files that have been downloaded.
 	var downloading []modules.DownloadInfo
 	for _, file := range queue.Downloads {
-		if file.Received != file.Filesize {
+		if file.Status == modules.DownloadStatusActive || file.Status == modules.DownloadStatusPaused {
 			downloading = append(downloading, file)
 		}
 	}
@@ -189,7 +506,7 @@ func renterdownloadscmd() {
 	} else {
 		fmt.Println("Downloading", len(downloading), "files:")
 		for _, file := range downloading {
-			fmt.Printf("%s: %5.1f%% %s -> %s\n", file.StartTime.Format("Jan 02 03:04 PM"), 100*float64(file.Received)/float64(file.Filesize), file.SiaPath, file.Destination)
+			fmt.Printf("%s  %s: %5.1f%% %-6s %s -> %s\n", file.ID, file.StartTime.Format("Jan 02 03:04 PM"), 100*float64(file.Received)/float64(file.Length), file.Status, file.SiaPath, file.Destination)
 		}
 	}
 	if !renterShowHistory {
@@ -199,7 +516,7 @@ func renterdownloadscmd() {
 	// Filter out files that are downloading.
 	var downloaded []modules.DownloadInfo
 	for _, file := range queue.Downloads {
-		if file.Received == file.Filesize {
+		if file.Status != modules.DownloadStatusActive && file.Status != modules.DownloadStatusPaused {
 			downloaded = append(downloaded, file)
 		}
 	}
@@ -208,11 +525,45 @@ func renterdownloadscmd() {
 	} else {
 		fmt.Println("Downloaded", len(downloaded), "files:")
 		for _, file := range downloaded {
-			fmt.Printf("%s: %s -> %s\n", file.StartTime.Format("Jan 02 03:04 PM"), file.SiaPath, file.Destination)
+			fmt.Printf("%s  %s: %-9s %s -> %s", file.ID, file.StartTime.Format("Jan 02 03:04 PM"), file.Status, file.SiaPath, file.Destination)
+			if file.Error != "" {
+				fmt.Printf(" (%s)", file.Error)
+			}
+			fmt.Println()
 		}
 	}
 }
 
+// renterdownloadscancelcmd is the handler for the command
+// `siac renter downloads cancel [id]`. Cancels a download.
+func renterdownloadscancelcmd(id string) {
+	err := post("/renter/downloads/"+id, "action=cancel")
+	if err != nil {
+		die("Could not cancel download:", err)
+	}
+	fmt.Println("Cancelled download", id)
+}
+
+// renterdownloadspausecmd is the handler for the command
+// `siac renter downloads pause [id]`. Pauses a download.
+func renterdownloadspausecmd(id string) {
+	err := post("/renter/downloads/"+id, "action=pause")
+	if err != nil {
+		die("Could not pause download:", err)
+	}
+	fmt.Println("Paused download", id)
+}
+
+// renterdownloadsresumecmd is the handler for the command
+// `siac renter downloads resume [id]`. Resumes a paused download.
+func renterdownloadsresumecmd(id string) {
+	err := post("/renter/downloads/"+id, "action=resume")
+	if err != nil {
+		die("Could not resume download:", err)
+	}
+	fmt.Println("Resumed download", id)
+}
+
 // renterallowancecmd displays the current allowance.
 func renterallowancecmd() {
 	var rg api.RenterGET
@@ -227,6 +578,25 @@ func renterallowancecmd() {
 	Amount: %v
 	Period: %v blocks
 `, currencyUnits(allowance.Funds), allowance.Period)
+
+	// display the maximum prices, if any are set
+	maxPrice := func(c, unit types.Currency, suffix string) string {
+		if c.IsZero() {
+			return "none"
+		}
+		return currencyUnits(c.Mul(unit)) + suffix
+	}
+	if !allowance.MaxPricesEqual(modules.Allowance{}) {
+		fmt.Printf(`Maximum Prices:
+	Contract: %v
+	Download: %v
+	Storage:  %v
+	Upload:   %v
+`, maxPrice(allowance.MaxContractPrice, types.NewCurrency64(1), ""),
+			maxPrice(allowance.MaxDownloadBandwidthPrice, modules.BytesPerTerabyte, " / TB"),
+			maxPrice(allowance.MaxStoragePrice, modules.BlockBytesPerMonthTerabyte, " / TB / Month"),
+			maxPrice(allowance.MaxUploadBandwidthPrice, modules.BytesPerTerabyte, " / TB"))
+	}
 }
 
 // rentersetallowancecmd allows the user to set the allowance.
@@ -246,6 +616,119 @@ func rentersetallowancecmd(amount, period string) {
 	fmt.Println("Allowance updated.")
 }
 
+// rentersetbandwidthcmd allows the user to set the bandwidth limits.
+func rentersetbandwidthcmd(download, upload, total string) {
+	download, err := parseFilesize(download)
+	if err != nil {
+		die("Could not parse download limit:", err)
+	}
+	upload, err = parseFilesize(upload)
+	if err != nil {
+		die("Could not parse upload limit:", err)
+	}
+	total, err = parseFilesize(total)
+	if err != nil {
+		die("Could not parse total limit:", err)
+	}
+	err = post("/renter", fmt.Sprintf("maxdownloadspeed=%s&maxuploadspeed=%s&maxbandwidth=%s", download, upload, total))
+	if err != nil {
+		die("Could not set bandwidth limits:", err)
+	}
+	fmt.Println("Bandwidth limits updated.")
+}
+
+// rentersetmaxpricecmd is the handler for the command `siac renter
+// setmaxprice [resource] [price]`. Sets a maximum price of the allowance.
+func rentersetmaxpricecmd(resource, price string) {
+	hastings, err := parseCurrency(price)
+	if err != nil {
+		die("Could not parse price:", err)
+	}
+	i, _ := new(big.Int).SetString(hastings, 10)
+	c := types.NewCurrency(i)
+	var param string
+	switch resource {
+	case "contract":
+		param = "maxcontractprice"
+	case "download":
+		// currency/TB (convert to hastings/byte)
+		param = "maxdownloadbandwidthprice"
+		c = c.Div(modules.BytesPerTerabyte)
+	case "storage":
+		// currency/TB/month (convert to hastings/byte/block)
+		param = "maxstorageprice"
+		c = c.Div(modules.BlockBytesPerMonthTerabyte)
+	case "upload":
+		// currency/TB (convert to hastings/byte)
+		param = "maxuploadbandwidthprice"
+		c = c.Div(modules.BytesPerTerabyte)
+	default:
+		die("Unknown resource", resource+"; must be contract, download, storage, or upload")
+	}
+	err = post("/renter", param+"="+c.String())
+	if err != nil {
+		die("Could not set maximum price:", err)
+	}
+	fmt.Println("Maximum price updated.")
+}
+
+// rentersetoverdrivecmd is the handler for the command
+// `siac renter setoverdrive [pieces]`. Sets the number of extra pieces of each
+// chunk that are requested when downloading.
+func rentersetoverdrivecmd(pieces string) {
+	var overdrive uint64
+	if _, err := fmt.Sscan(pieces, &overdrive); err != nil {
+		die("Could not parse overdrive:", err)
+	}
+	err := post("/renter", fmt.Sprintf("downloadoverdrive=%v", overdrive))
+	if err != nil {
+		die("Could not set download overdrive:", err)
+	}
+	fmt.Println("Download overdrive updated.")
+}
+
+// rentersetscoreweightcmd is the handler for the command
+// `siac renter setscoreweight [factor] [weight]`. Sets the weight of a factor
+// of the score of a host.
+func rentersetscoreweightcmd(factor, weight string) {
+	switch factor {
+	case "price", "storage", "uptime", "age", "collateral", "version":
+	default:
+		die("Unknown factor", factor+"; must be price, storage, uptime, age, collateral, or version")
+	}
+	var w float64
+	if _, err := fmt.Sscan(weight, &w); err != nil {
+		die("Could not parse weight:", err)
+	}
+	err := post("/renter", fmt.Sprintf("scoreweight%v=%v", factor, w))
+	if err != nil {
+		die("Could not set score weight:", err)
+	}
+	fmt.Println("Score weight updated.")
+}
+
+// rentersetcachecmd is the handler for the command `siac renter setcache
+// [size]`. Sets the maximum size of the chunk cache.
+func rentersetcachecmd(size string) {
+	cacheSize, err := parseFilesize(size)
+	if err != nil {
+		die("Could not parse cache size:", err)
+	}
+	err = post("/renter", "chunkcachesize="+cacheSize)
+	if err != nil {
+		die("Could not set chunk cache size:", err)
+	}
+	fmt.Println("Chunk cache size updated.")
+}
+
+// bandwidthLimit returns a human-readable bandwidth limit.
+func bandwidthLimit(bps uint64) string {
+	if bps == 0 {
+		return "none"
+	}
+	return filesizeUnits(int64(bps)) + "/s"
+}
+
 // byValue sorts contracts by their value in siacoins, high to low. If two
 // contracts have the same value, they are sorted by their host's address.
 type byValue []api.RenterContract
@@ -260,6 +743,73 @@ func (s byValue) Less(i, j int) bool {
 	return cmp > 0
 }
 
+// renterauditscmd is the handler for the command `siac renter audits`. It
+// lists the results of the Renter's audits of its hosts.
+func renterauditscmd() {
+	var ra api.RenterAudits
+	err := getAPI("/renter/audits", &ra)
+	if err != nil {
+		die("Could not get audit results:", err)
+	}
+	if len(ra.Hosts) == 0 {
+		fmt.Println("No hosts have been audited.")
+		return
+	}
+	fmt.Println("Audits:")
+	w := tabwriter.NewWriter(os.Stdout, 2, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Host\tAudits\tFailures\tUnreachable\tLast Audit\tLast Failure")
+	for _, h := range ra.Hosts {
+		lastAudit, lastFailure := "-", "-"
+		if !h.LastAudit.IsZero() {
+			lastAudit = h.LastAudit.Format("Jan 02 03:04 PM")
+		}
+		if !h.LastFailure.IsZero() {
+			lastFailure = h.LastFailure.Format("Jan 02 03:04 PM")
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n",
+			h.NetAddress,
+			h.Audits,
+			h.Failures,
+			h.Unreachable,
+			lastAudit,
+			lastFailure)
+	}
+	w.Flush()
+}
+
+// renterperformancecmd is the handler for the command
+// `siac renter performance`. It lists the download performance of the
+// Renter's hosts.
+func renterperformancecmd() {
+	var rp api.RenterPerformance
+	err := getAPI("/renter/performance", &rp)
+	if err != nil {
+		die("Could not get host performance:", err)
+	}
+	if len(rp.Hosts) == 0 {
+		fmt.Println("No hosts have been downloaded from.")
+		return
+	}
+	fmt.Println("Performance:")
+	w := tabwriter.NewWriter(os.Stdout, 2, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Host\tDownloads\tFailures\tCancelled\tLatency\tThroughput\tLast Download")
+	for _, h := range rp.Hosts {
+		lastDownload := "-"
+		if !h.LastDownload.IsZero() {
+			lastDownload = h.LastDownload.Format("Jan 02 03:04 PM")
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v ms\t%v/s\t%v\n",
+			h.NetAddress,
+			h.Downloads,
+			h.Failures,
+			h.Cancelled,
+			h.Latency,
+			filesizeUnits(int64(h.Throughput)),
+			lastDownload)
+	}
+	w.Flush()
+}
+
 // rentercontractscmd is the handler for the comand `siac renter contracts`.
 // It lists the Renter's contracts.
 func rentercontractscmd() {
@@ -275,18 +825,153 @@ func rentercontractscmd() {
 	sort.Sort(byValue(rc.Contracts))
 	fmt.Println("Contracts:")
 	w := tabwriter.NewWriter(os.Stdout, 2, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "Host\tValue\tData\tEnd Height\tID")
+	fmt.Fprintln(w, "Host\tValue\tData\tEnd Height\tID\tHost Key")
 	for _, c := range rc.Contracts {
-		fmt.Fprintf(w, "%v\t%8s\t%v\t%v\t%v\n",
+		fmt.Fprintf(w, "%v\t%8s\t%v\t%v\t%v\t%v\n",
 			c.NetAddress,
 			currencyUnits(c.RenterFunds),
 			filesizeUnits(int64(c.Size)),
 			c.EndHeight,
-			c.ID)
+			c.ID,
+			c.HostPublicKey.String())
 	}
 	w.Flush()
 }
 
+// renterdircmd is the handler for the command `siac renter dir`. It lists the
+// root directory.
+func renterdircmd() {
+	renterdirlistcmd("")
+}
+
+// renterdircreatecmd is the handler for the command `siac renter dir create [path]`.
+// Creates an empty directory.
+func renterdircreatecmd(path string) {
+	err := post("/renter/dir/"+path, "action=create")
+	if err != nil {
+		die("Could not create directory:", err)
+	}
+	fmt.Println("Created", path)
+}
+
+// renterdirdeletecmd is the handler for the command `siac renter dir delete [path]`.
+// Deletes a directory and its contents.
+func renterdirdeletecmd(path string) {
+	err := post("/renter/dir/"+path, "action=delete")
+	if err != nil {
+		die("Could not delete directory:", err)
+	}
+	fmt.Println("Deleted", path)
+}
+
+// renterdirlistcmd is the handler for the command `siac renter dir list [path]`.
+// Lists the subdirectories and files of a directory.
+func renterdirlistcmd(path string) {
+	var rd api.RenterDirectory
+	err := getAPI("/renter/dir/"+path, &rd)
+	if err != nil {
+		die("Could not list directory:", err)
+	}
+	dir := rd.Directories[0]
+	fmt.Printf("%v/: %v files, %v\n", dir.SiaPath, dir.NumFiles, filesizeUnits(int64(dir.AggregateSize)))
+	if len(rd.Directories) == 1 && len(rd.Files) == 0 {
+		fmt.Println("Directory is empty.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Size\tFiles\tAvailable\tRedundancy\tSia path")
+	for _, d := range rd.Directories[1:] {
+		redundancyStr := fmt.Sprintf("%.2f", d.MinRedundancy)
+		if d.MinRedundancy == -1 {
+			redundancyStr = "-"
+		}
+		fmt.Fprintf(w, "%9s\t%v\t%s\t%10s\t%s/\n", filesizeUnits(int64(d.AggregateSize)), d.NumFiles, yesNo(d.Available), redundancyStr, d.SiaPath)
+	}
+	for _, f := range rd.Files {
+		redundancyStr := fmt.Sprintf("%.2f", f.Redundancy)
+		if f.Redundancy == -1 {
+			redundancyStr = "-"
+		}
+		fmt.Fprintf(w, "%9s\t\t%s\t%10s\t%s\n", filesizeUnits(int64(f.Filesize)), yesNo(f.Available), redundancyStr, f.SiaPath)
+	}
+	w.Flush()
+}
+
+// renterdirrenamecmd is the handler for the command `siac renter dir rename [path] [newpath]`.
+// Renames a directory and moves its contents.
+func renterdirrenamecmd(path, newpath string) {
+	err := post("/renter/dir/"+path, "action=rename&newsiapath="+newpath)
+	if err != nil {
+		die("Could not rename directory:", err)
+	}
+	fmt.Printf("Renamed %s to %s\n", path, newpath)
+}
+
+// renterfilehealthcmd is the handler for the command
+// `siac renter file health [path]`. Lists the pieces of each chunk of a file
+// and the hosts storing them.
+func renterfilehealthcmd(path string) {
+	var rh api.RenterFileHealth
+	err := getAPI("/renter/health/"+path, &rh)
+	if err != nil {
+		die("Could not get file health:", err)
+	}
+	for _, chunk := range rh.Chunks {
+		status := ""
+		if chunk.OnlinePieces < chunk.MinPieces {
+			status = " - unrecoverable"
+		} else if chunk.OnlinePieces < chunk.NumPieces {
+			status = " - missing pieces"
+		}
+		fmt.Printf("Chunk %v: %v/%v pieces online, %v needed%v\n", chunk.Index, chunk.OnlinePieces, chunk.NumPieces, chunk.MinPieces, status)
+		if len(chunk.Pieces) == 0 {
+			continue
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  Piece\tHost\tContract\tStatus\tBlocks Left")
+		for _, p := range chunk.Pieces {
+			status := "online"
+			if p.Offline {
+				status = "offline"
+			} else if p.Replaced {
+				status = "replacing"
+			}
+			fmt.Fprintf(w, "  %v\t%v\t%v\t%v\t%v\n", p.Piece, p.NetAddress, p.ContractID, status, p.BlocksRemaining)
+		}
+		w.Flush()
+	}
+}
+
+// renterfileexpirecmd is the handler for the command
+// `siac renter file expire [path] [height|forever]`. Sets the block height at
+// which a file expires.
+func renterfileexpirecmd(path, height string) {
+	var err error
+	if height == "forever" {
+		err = post("/renter/expiration/"+path, "keepforever=true")
+	} else {
+		var h uint64
+		if _, err := fmt.Sscan(height, &h); err != nil {
+			die("Could not parse expiration height:", err)
+		}
+		err = post("/renter/expiration/"+path, fmt.Sprintf("height=%v", h))
+	}
+	if err != nil {
+		die("Could not set expiration height:", err)
+	}
+	fmt.Println("Expiration height updated.")
+}
+
+// renterfiletagcmd is the handler for the command
+// `siac renter file tag [path] [key] [value]`. Sets a metadata tag of a file.
+func renterfiletagcmd(path, key, value string) {
+	err := post("/renter/metadata/"+path, url.Values{key: {value}}.Encode())
+	if err != nil {
+		die("Could not set metadata:", err)
+	}
+	fmt.Println("Metadata updated.")
+}
+
 // renterfilesdeletecmd is the handler for the command `siac renter delete [path]`.
 // Removes the specified path from the Sia network.
 func renterfilesdeletecmd(path string) {
@@ -322,19 +1007,26 @@ func renterfilesdownloadcmd(path, destination string) {
 						break
 					}
 				}
-				if d.Filesize == 0 {
+				if d.Length == 0 {
 					continue // file hasn't appeared in queue yet
 				}
-				pct := 100 * float64(d.Received) / float64(d.Filesize)
+				pct := 100 * float64(d.Received) / float64(d.Length)
 				elapsed := time.Since(d.StartTime)
 				elapsed -= elapsed % time.Second // round to nearest second
 				mbps := (float64(d.Received*8) / 1e6) / time.Since(d.StartTime).Seconds()
-				fmt.Printf("\rDownloading... %5.1f%% of %v, %v elapsed, %.2f Mbps    ", pct, filesizeUnits(int64(d.Filesize)), elapsed, mbps)
+				fmt.Printf("\rDownloading... %5.1f%% of %v, %v elapsed, %.2f Mbps    ", pct, filesizeUnits(int64(d.Length)), elapsed, mbps)
 			}
 		}
 	}()
 
-	err := get("/renter/download/" + path + "?destination=" + destination)
+	query := "?destination=" + destination
+	if renterDownloadVersion != "" {
+		query += "&version=" + renterDownloadVersion
+	}
+	if renterDownloadSnapshot != "" {
+		query += "&snapshot=" + renterDownloadSnapshot
+	}
+	err := get("/renter/download/" + path + query)
 	close(done)
 	if err != nil {
 		die("Could not download file:", err)
@@ -392,6 +1084,43 @@ func renterfileslistcmd() {
 	w.Flush()
 }
 
+// renterfilessearchcmd is the handler for the command `siac renter search`.
+// It lists the files that match the given tags and path prefix, along with
+// their metadata.
+func renterfilessearchcmd() {
+	vals := url.Values{
+		"tag":    renterSearchTags,
+		"prefix": {renterSearchPrefix},
+		"offset": {fmt.Sprint(renterSearchOffset)},
+		"limit":  {fmt.Sprint(renterSearchLimit)},
+	}
+	var rfs api.RenterFilesSearch
+	err := getAPI("/renter/files/search?"+vals.Encode(), &rfs)
+	if err != nil {
+		die("Could not search files:", err)
+	}
+	if rfs.Total == 0 {
+		fmt.Println("No files match the search.")
+		return
+	}
+	fmt.Printf("Showing %v of %v matching files:\n", len(rfs.Files), rfs.Total)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "File size\tSia path\tMetadata")
+	for _, file := range rfs.Files {
+		keys := make([]string, 0, len(file.Metadata))
+		for k := range file.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var tags []string
+		for _, k := range keys {
+			tags = append(tags, k+":"+file.Metadata[k])
+		}
+		fmt.Fprintf(w, "%9s\t%s\t%s\n", filesizeUnits(int64(file.Filesize)), file.SiaPath, strings.Join(tags, " "))
+	}
+	w.Flush()
+}
+
 // renterfilesrenamecmd is the handler for the command `siac renter rename [path] [newpath]`.
 // Renames a file on the Sia network.
 func renterfilesrenamecmd(path, newpath string) {
@@ -402,12 +1131,245 @@ func renterfilesrenamecmd(path, newpath string) {
 	fmt.Printf("Renamed %s to %s\n", path, newpath)
 }
 
+// renterfilesupdatecmd is the handler for the command
+// `siac renter update [path] [offset] [source]`. Writes the contents of the
+// [source] file into the file at [path], starting at [offset].
+func renterfilesupdatecmd(path, offset, source string) {
+	var off uint64
+	if _, err := fmt.Sscan(offset, &off); err != nil {
+		die("Could not parse offset:", err)
+	}
+	data, err := ioutil.ReadFile(abs(source))
+	if err != nil {
+		die("Could not read source file:", err)
+	}
+	err = post(fmt.Sprintf("/renter/update/%s?offset=%v", path, off), string(data))
+	if err != nil {
+		die("Could not update file:", err)
+	}
+	fmt.Printf("Wrote %s to %s at offset %v.\n", filesizeUnits(int64(len(data))), path, off)
+}
+
 // renterfilesuploadcmd is the handler for the command `siac renter upload [source] [path]`.
 // Uploads the [source] file to [path] on the Sia network.
 func renterfilesuploadcmd(source, path string) {
-	err := post("/renter/upload/"+path, "source="+abs(source))
+	query := fmt.Sprintf("source=%s&pack=%t&dedup=%t&compression=%s&versioned=%t&expirationheight=%v", abs(source), renterUploadPack, renterUploadDedup, renterUploadCompression, renterUploadVersioned, renterUploadExpiration)
+	if renterUploadErasureCode != "" {
+		query += "&erasurecode=" + renterUploadErasureCode
+	}
+	for _, param := range []struct {
+		name  string
+		value uint64
+	}{
+		{"datapieces", renterUploadDataPieces},
+		{"paritypieces", renterUploadParityPieces},
+		{"copies", renterUploadCopies},
+		{"localgroups", renterUploadLocalGroups},
+	} {
+		if param.value != 0 {
+			query += fmt.Sprintf("&%s=%v", param.name, param.value)
+		}
+	}
+	err := post("/renter/upload/"+path, query)
 	if err != nil {
 		die("Could not upload file:", err)
 	}
 	fmt.Printf("Uploaded '%s' as %s.\n", abs(source), path)
 }
+
+// rentersetversionscmd is the handler for the command
+// `siac renter setversions [count] [age]`. Sets the limits on the earlier
+// versions that are kept of each file.
+func rentersetversionscmd(count, age string) {
+	var maxVersions uint64
+	if _, err := fmt.Sscan(count, &maxVersions); err != nil {
+		die("Could not parse version count:", err)
+	}
+	var maxAge time.Duration
+	if age != "0" {
+		var err error
+		maxAge, err = time.ParseDuration(age)
+		if err != nil {
+			die("Could not parse version age:", err)
+		}
+	}
+	err := post("/renter", fmt.Sprintf("maxversions=%v&maxversionage=%v", maxVersions, uint64(maxAge.Seconds())))
+	if err != nil {
+		die("Could not set version limits:", err)
+	}
+	fmt.Println("Version limits updated.")
+}
+
+// renterversionslistcmd is the handler for the command
+// `siac renter versions list [path]`. Lists the earlier versions of a file.
+func renterversionslistcmd(path string) {
+	var rv api.RenterVersions
+	err := getAPI("/renter/versions/"+path, &rv)
+	if err != nil {
+		die("Could not list versions:", err)
+	}
+	if len(rv.Versions) == 0 {
+		fmt.Println("No earlier versions.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Version\tSize\tAvailable\tProgress\tReplaced")
+	for _, v := range rv.Versions {
+		fmt.Fprintf(w, "%v\t%9s\t%s\t%5.1f%%\t%v\n", v.Version, filesizeUnits(int64(v.Filesize)), yesNo(v.Available), v.UploadProgress, v.Archived.Format(time.RFC822))
+	}
+	w.Flush()
+}
+
+// renterversionsrestorecmd is the handler for the command
+// `siac renter versions restore [path] [version]`. Makes an earlier version of
+// a file the current file.
+func renterversionsrestorecmd(path, version string) {
+	err := post("/renter/versions/"+path, "action=restore&version="+version)
+	if err != nil {
+		die("Could not restore version:", err)
+	}
+	fmt.Printf("Restored version %s of %s\n", version, path)
+}
+
+// renterversionsdeletecmd is the handler for the command
+// `siac renter versions delete [path] [version]`. Deletes an earlier version
+// of a file.
+func renterversionsdeletecmd(path, version string) {
+	err := post("/renter/versions/"+path, "action=delete&version="+version)
+	if err != nil {
+		die("Could not delete version:", err)
+	}
+	fmt.Printf("Deleted version %s of %s\n", version, path)
+}
+
+// rentersnapshotscmd is the handler for the command `siac renter snapshots`.
+// Lists the snapshots.
+func rentersnapshotscmd() {
+	var rs api.RenterSnapshots
+	err := getAPI("/renter/snapshots", &rs)
+	if err != nil {
+		die("Could not list snapshots:", err)
+	}
+	if len(rs.Snapshots) == 0 {
+		fmt.Println("No snapshots.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tDirectory\tFiles\tSize\tCreated")
+	for _, s := range rs.Snapshots {
+		fmt.Fprintf(w, "%s\t%s/\t%v\t%9s\t%v\n", s.Name, s.Dir, s.NumFiles, filesizeUnits(int64(s.Size)), s.Created.Format(time.RFC822))
+	}
+	w.Flush()
+}
+
+// rentersnapshotscreatecmd is the handler for the command
+// `siac renter snapshots create [name]`. Records the files in a directory as a
+// snapshot.
+func rentersnapshotscreatecmd(name string) {
+	err := post("/renter/snapshots/"+name, "action=create&dir="+renterSnapshotDir)
+	if err != nil {
+		die("Could not create snapshot:", err)
+	}
+	fmt.Printf("Created snapshot %s of %s/\n", name, renterSnapshotDir)
+}
+
+// rentersnapshotsfilescmd is the handler for the command
+// `siac renter snapshots files [name]`. Lists the files in a snapshot.
+func rentersnapshotsfilescmd(name string) {
+	var rs api.RenterSnapshot
+	err := getAPI("/renter/snapshots/"+name, &rs)
+	if err != nil {
+		die("Could not list snapshot:", err)
+	}
+	if len(rs.Files) == 0 {
+		fmt.Println("Snapshot is empty.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Size\tAvailable\tSia path")
+	for _, f := range rs.Files {
+		fmt.Fprintf(w, "%9s\t%s\t%s\n", filesizeUnits(int64(f.Filesize)), yesNo(f.Available), f.SiaPath)
+	}
+	w.Flush()
+}
+
+// rentersnapshotsrestorecmd is the handler for the command
+// `siac renter snapshots restore [name]`. Restores the directory of a
+// snapshot.
+func rentersnapshotsrestorecmd(name string) {
+	err := post("/renter/snapshots/"+name, "action=restore")
+	if err != nil {
+		die("Could not restore snapshot:", err)
+	}
+	fmt.Println("Restored snapshot", name)
+}
+
+// rentersnapshotsdeletecmd is the handler for the command
+// `siac renter snapshots delete [name]`. Deletes a snapshot.
+func rentersnapshotsdeletecmd(name string) {
+	err := post("/renter/snapshots/"+name, "action=delete")
+	if err != nil {
+		die("Could not delete snapshot:", err)
+	}
+	fmt.Println("Deleted snapshot", name)
+}
+
+// renterbackupcmd is the handler for the command `siac renter backup`.
+// Shows the most recent backup stored on the hosts.
+func renterbackupcmd() {
+	var rb api.RenterBackup
+	err := getAPI("/renter/backup", &rb)
+	if err != nil {
+		die("Could not get backup info:", err)
+	}
+	if rb.Backup.NumHosts == 0 {
+		fmt.Println("No backup has been stored on the hosts.")
+		return
+	}
+	fmt.Printf(`Most recent backup:
+	Created: %v
+	Size:    %v
+	Hosts:   %v
+`, rb.Backup.Created.Format(time.RFC822), filesizeUnits(int64(rb.Backup.Size)), rb.Backup.NumHosts)
+}
+
+// renterbackupcreatecmd is the handler for the command
+// `siac renter backup create`. Stores a backup on the hosts.
+func renterbackupcreatecmd() {
+	err := post("/renter/backup", "")
+	if err != nil {
+		die("Could not create backup:", err)
+	}
+	fmt.Println("Stored backup on the hosts.")
+}
+
+// renterbackupexportcmd is the handler for the command
+// `siac renter backup export [destination]`. Writes a backup to a file.
+func renterbackupexportcmd(destination string) {
+	err := post("/renter/backup", "destination="+abs(destination))
+	if err != nil {
+		die("Could not export backup:", err)
+	}
+	fmt.Println("Exported backup to", abs(destination))
+}
+
+// renterbackupimportcmd is the handler for the command
+// `siac renter backup import [source]`. Recovers from a backup file.
+func renterbackupimportcmd(source string) {
+	err := post("/renter/recover", "source="+abs(source))
+	if err != nil {
+		die("Could not recover from backup:", err)
+	}
+	fmt.Println("Recovered from", abs(source))
+}
+
+// renterbackuprecovercmd is the handler for the command
+// `siac renter backup recover`. Recovers from the most recent backup stored
+// on the hosts.
+func renterbackuprecovercmd() {
+	err := post("/renter/recover", "")
+	if err != nil {
+		die("Could not recover from backup:", err)
+	}
+	fmt.Println("Recovered contracts and files from the hosts.")
+}
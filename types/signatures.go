@@ -7,8 +7,10 @@ package types
 // called 'UnlockConditions'.
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
@@ -25,6 +27,7 @@ var (
 	ErrEntropyKey                = errors.New("transaction tries to sign an entproy public key")
 	ErrFrivolousSignature        = errors.New("transaction contains a frivolous signature")
 	ErrInvalidPubKeyIndex        = errors.New("transaction contains a signature that points to a nonexistent public key")
+	ErrInvalidSiaPublicKey       = errors.New("public key must be an algorithm followed by ':' and a hex-encoded key")
 	ErrInvalidUnlockHashChecksum = errors.New("provided unlock hash has an invalid checksum")
 	ErrMissingSignatures         = errors.New("transaction has inputs with missing signatures")
 	ErrPrematureSignature        = errors.New("timelock on signature has not expired")
@@ -397,3 +400,20 @@ func (t *Transaction) validSignatures(currentHeight BlockHeight) error {
 func (spk *SiaPublicKey) String() string {
 	return spk.Algorithm.String() + ":" + fmt.Sprintf("%x", spk.Key)
 }
+
+// LoadString is the inverse of SiaPublicKey.String(). It loads a public key
+// from an algorithm and a hex-encoded key separated by a colon.
+func (spk *SiaPublicKey) LoadString(s string) error {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || len(parts[0]) > SpecifierLen {
+		return ErrInvalidSiaPublicKey
+	}
+	key, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidSiaPublicKey
+	}
+	spk.Algorithm = Specifier{}
+	copy(spk.Algorithm[:], parts[0])
+	spk.Key = key
+	return nil
+}
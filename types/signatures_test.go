@@ -366,3 +366,24 @@ func TestSiaPublicKeyString(t *testing.T) {
 		t.Error("got wrong value for spk.String():", spk.String())
 	}
 }
+
+// TestSiaPublicKeyLoadString checks that LoadString is the inverse of String.
+func TestSiaPublicKeyLoadString(t *testing.T) {
+	spk := SiaPublicKey{
+		Algorithm: SignatureEd25519,
+		Key:       []byte{1, 2, 3, 255},
+	}
+	var loaded SiaPublicKey
+	if err := loaded.LoadString(spk.String()); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.String() != spk.String() || loaded.Algorithm != spk.Algorithm {
+		t.Error("loaded key does not match:", loaded.String())
+	}
+
+	for _, s := range []string{"", "ed25519", ":0102", "ed25519:xyz", "averyveryverylongalgorithm:0102"} {
+		if err := loaded.LoadString(s); err != ErrInvalidSiaPublicKey {
+			t.Errorf("expected %v when loading %q, got %v", ErrInvalidSiaPublicKey, s, err)
+		}
+	}
+}